@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ACL grants users and groups edit rights over shortcut spaces, so teams
+// can manage their own links without an admin. It is managed by the
+// operator as a plain text file with one rule per line: a shortcut pattern
+// followed by a comma-separated list of users and "group:" names, e.g.
+//
+//	payments/*        alice@example.com, group:Payments
+//	wiki:onboarding/* group:People
+//
+// A pattern ending in /* covers that shortcut and everything under it, one
+// ending in * every shortcut starting with the rest, and anything else just
+// that shortcut. A "namespace:" prefix applies the rule to another
+// namespace, and "namespace:*" hands over the whole namespace. Lines
+// starting with # are comments, and matching is case-insensitive.
+type ACL struct {
+	mu       sync.RWMutex
+	rules    []aclRule
+	filePath string
+	modTime  time.Time
+}
+
+// aclRule grants one shortcut space to some users and groups
+type aclRule struct {
+	namespace string
+	pattern   string // lowercased
+	users     map[string]bool
+	groups    map[string]bool
+}
+
+// matches reports whether the rule covers shortcut in namespace
+func (rule aclRule) matches(namespace, shortcut string) bool {
+	if namespace != rule.namespace {
+		return false
+	}
+	shortcut = strings.ToLower(shortcut)
+	if base, ok := strings.CutSuffix(rule.pattern, "/*"); ok {
+		return shortcut == base || strings.HasPrefix(shortcut, base+"/")
+	}
+	if prefix, ok := strings.CutSuffix(rule.pattern, "*"); ok {
+		return strings.HasPrefix(shortcut, prefix)
+	}
+	return shortcut == rule.pattern
+}
+
+// grants reports whether the rule gives user, or one of groups, edit rights
+func (rule aclRule) grants(user string, groups []string) bool {
+	if user != "" && rule.users[strings.ToLower(user)] {
+		return true
+	}
+	for _, group := range groups {
+		if rule.groups[strings.ToLower(group)] {
+			return true
+		}
+	}
+	return false
+}
+
+// NewACL creates an ACL backed by filePath; call Load to read it
+func NewACL(filePath string) *ACL {
+	return &ACL{filePath: filePath}
+}
+
+// Load reads the ACL file, replacing the current rules. A missing file
+// means no rules.
+func (acl *ACL) Load() error {
+	info, err := os.Stat(acl.filePath)
+	if os.IsNotExist(err) {
+		acl.replace(nil, time.Time{})
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(acl.filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var rules []aclRule
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		pattern, members := fields[0], strings.Join(fields[1:], " ")
+		rule := aclRule{users: make(map[string]bool), groups: make(map[string]bool)}
+		if namespace, rest, ok := strings.Cut(pattern, ":"); ok {
+			rule.namespace, pattern = namespace, rest
+		}
+		rule.pattern = strings.ToLower(strings.Trim(pattern, "/"))
+		if rule.pattern == "" || (rule.pattern == "*" && rule.namespace == "") {
+			return fmt.Errorf("invalid ACL pattern %q, grant everything with admins instead", pattern)
+		}
+		for _, member := range splitList(members) {
+			if group, ok := strings.CutPrefix(member, "group:"); ok {
+				if group = strings.TrimSpace(group); group != "" {
+					rule.groups[strings.ToLower(group)] = true
+				}
+			} else {
+				rule.users[strings.ToLower(member)] = true
+			}
+		}
+		if len(rule.users) == 0 && len(rule.groups) == 0 {
+			return fmt.Errorf("ACL rule for %q grants nobody", pattern)
+		}
+		rules = append(rules, rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	acl.replace(rules, info.ModTime())
+	return nil
+}
+
+// replace swaps in a freshly loaded set of rules
+func (acl *ACL) replace(rules []aclRule, modTime time.Time) {
+	acl.mu.Lock()
+	defer acl.mu.Unlock()
+	acl.rules = rules
+	acl.modTime = modTime
+}
+
+// Rule returns the most specific rule covering shortcut in namespace
+func (acl *ACL) Rule(namespace, shortcut string) (aclRule, bool) {
+	acl.mu.RLock()
+	defer acl.mu.RUnlock()
+
+	var best aclRule
+	found := false
+	for _, rule := range acl.rules {
+		if rule.matches(namespace, shortcut) && (!found || len(rule.pattern) > len(best.pattern)) {
+			best, found = rule, true
+		}
+	}
+	return best, found
+}
+
+// GrantsAny reports whether any rule gives user, or one of groups, edit
+// rights
+func (acl *ACL) GrantsAny(user string, groups []string) bool {
+	acl.mu.RLock()
+	defer acl.mu.RUnlock()
+	for _, rule := range acl.rules {
+		if rule.grants(user, groups) {
+			return true
+		}
+	}
+	return false
+}
+
+// ReloadIfChanged reloads the ACL when the file has changed, so grants
+// apply without a restart
+func (acl *ACL) ReloadIfChanged() error {
+	info, err := os.Stat(acl.filePath)
+
+	acl.mu.RLock()
+	modTime := acl.modTime
+	acl.mu.RUnlock()
+
+	switch {
+	case err == nil && info.ModTime().Equal(modTime):
+		return nil
+	case err != nil && !os.IsNotExist(err):
+		return fmt.Errorf("checking ACL file: %w", err)
+	case os.IsNotExist(err) && modTime.IsZero():
+		return nil
+	}
+
+	if err := acl.Load(); err != nil {
+		// Keep the old rules and don't retry until the file changes again
+		acl.mu.Lock()
+		acl.modTime = info.ModTime()
+		acl.mu.Unlock()
+		return fmt.Errorf("reloading ACL: %w", err)
+	}
+	log.Printf("Reloaded ACL from %s", acl.filePath)
+	return nil
+}
+
+// currentGroups returns the groups of whoever is making a request: those
+// from their API token, session or authenticating proxy, and their local
+// groups
+func (s *Server) currentGroups(r *http.Request) []string {
+	var groups []string
+	if token, ok := s.tokens.FromRequest(r); ok {
+		if !token.Permits(r) {
+			return nil
+		}
+		groups = token.Groups
+	} else if proxyGroups := s.proxyGroups(r); proxyGroups != nil {
+		groups = proxyGroups
+	} else if s.sessions != nil {
+		sess, _, _ := s.sessions.current(r)
+		groups = sess.Groups
+	}
+
+	for _, group := range s.groups.Of(s.currentUser(r)) {
+		if !inGroup(groups, group) {
+			groups = append(slices.Clip(groups), group)
+		}
+	}
+	return groups
+}
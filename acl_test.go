@@ -0,0 +1,124 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeACL(t *testing.T, s *Server, rules string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "acl.txt")
+	if err := os.WriteFile(path, []byte(rules), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s.acl = NewACL(path)
+	if err := s.acl.Load(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestACLRules(t *testing.T) {
+	s := newTestServer(t)
+	writeACL(t, s, `# Team spaces
+payments/*         alice@example.com, group:Payments
+payments/ledger    carol@example.com
+wiki:onboarding*   group:People Ops
+eng:*              group:Engineering
+`)
+
+	for _, tc := range []struct {
+		namespace, shortcut, want string
+	}{
+		{"", "payments", "payments/*"},
+		{"", "Payments/Refunds/EU", "payments/*"},
+		{"", "payments/ledger", "payments/ledger"},
+		{"", "paymentsx", ""},
+		{"wiki", "onboarding-2024", "onboarding*"},
+		{"", "onboarding", ""},
+		{"eng", "anything/at/all", "*"},
+	} {
+		rule, _ := s.acl.Rule(tc.namespace, tc.shortcut)
+		if rule.pattern != tc.want {
+			t.Errorf("Rule(%q, %q) = %q, want %q", tc.namespace, tc.shortcut, rule.pattern, tc.want)
+		}
+	}
+
+	rule, _ := s.acl.Rule("wiki", "onboarding")
+	if !rule.grants("", []string{"people ops"}) || rule.grants("alice@example.com", nil) {
+		t.Error("onboarding rule doesn't grant just the People Ops group")
+	}
+
+	for _, rules := range []string{"*  alice", "payments/*", "payments/*  group:"} {
+		path := filepath.Join(t.TempDir(), "acl.txt")
+		os.WriteFile(path, []byte(rules), 0644)
+		if err := NewACL(path).Load(); err == nil {
+			t.Errorf("loading %q succeeded, want an error", rules)
+		}
+	}
+}
+
+func TestACLGrants(t *testing.T) {
+	s := newTestServer(t,
+		Link{Shortcut: "payments/refunds", URL: "https://refunds.example.com", CreatedBy: "dave@example.com"},
+		Link{Shortcut: "wiki", URL: "https://wiki.example.com", CreatedBy: "dave@example.com"},
+	)
+	s.userHeader = "X-User"
+	s.proxies = httptestProxy
+	s.signInToEdit = true
+	s.admins = NewAdminAuth("root@example.com", "")
+	s.sessions = NewSessions("secret", newMemorySessionStore())
+	writeACL(t, s, "payments/* alice@example.com, group:Payments\n")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /add", s.requireEditor(s.handleAdd))
+	mux.HandleFunc("PUT /api/links/{shortcut...}", s.requireLinkChanger(s.handleUpdate))
+	do := func(method, path string, form url.Values, setup func(*http.Request)) int {
+		r := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		setup(r)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w.Code
+	}
+	as := func(user string) func(*http.Request) {
+		return func(r *http.Request) { r.Header.Set("X-User", user) }
+	}
+
+	// A member of the Payments group, signed in without a user header
+	w := httptest.NewRecorder()
+	s.sessions.Start(w, httptest.NewRequest("GET", "/", nil), session{User: "erin", Groups: []string{"payments"}})
+	erin := func(r *http.Request) {
+		for _, cookie := range w.Result().Cookies() {
+			r.AddCookie(cookie)
+		}
+	}
+
+	add := func(shortcut string) url.Values {
+		return url.Values{"shortcut": {shortcut}, "url": {"https://example.com/" + shortcut}}
+	}
+	edit := url.Values{"url": {"https://new.example.com"}}
+	for _, tc := range []struct {
+		name, method, path string
+		form               url.Values
+		setup              func(*http.Request)
+		status             int
+	}{
+		{"editor outside the team adds", "POST", "/add", add("payments/cards"), as("bob@example.com"), http.StatusForbidden},
+		{"editor outside the team edits", "PUT", "/api/links/payments/refunds", edit, as("bob@example.com"), http.StatusForbidden},
+		{"granted user adds", "POST", "/add", add("payments/cards"), as("alice@example.com"), http.StatusSeeOther},
+		{"granted user edits another's link", "PUT", "/api/links/payments/refunds", edit, as("alice@example.com"), http.StatusOK},
+		{"granted user outside the space", "PUT", "/api/links/wiki", edit, as("alice@example.com"), http.StatusForbidden},
+		{"granted group", "POST", "/add", add("payments/payouts"), erin, http.StatusSeeOther},
+		{"granted group edits", "PUT", "/api/links/payments/cards", edit, erin, http.StatusOK},
+		{"admin", "PUT", "/api/links/payments/cards", edit, as("root@example.com"), http.StatusOK},
+	} {
+		if got := do(tc.method, tc.path, tc.form, tc.setup); got != tc.status {
+			t.Errorf("%s: status %d, want %d", tc.name, got, tc.status)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"cmp"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"net/url"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AdminAuth decides who may use the admin console: signed-in users listed
+// as admins (see currentUser), or anyone presenting the admin token as a
+// bearer token or basic-auth password. With neither configured the console
+// is disabled.
+type AdminAuth struct {
+	users map[string]bool
+	token string
+}
+
+// NewAdminAuth creates admin access rules from a comma-separated list of
+// admin users and an optional shared token
+func NewAdminAuth(users, token string) *AdminAuth {
+	aa := &AdminAuth{users: make(map[string]bool), token: token}
+	for _, user := range splitList(users) {
+		aa.users[strings.ToLower(user)] = true
+	}
+	return aa
+}
+
+// Enabled reports whether any way of signing in as an admin is configured
+func (aa *AdminAuth) Enabled() bool {
+	return len(aa.users) > 0 || aa.token != ""
+}
+
+// Allowed reports whether a request made by user (possibly "") is an admin's
+func (aa *AdminAuth) Allowed(r *http.Request, user string) bool {
+	if user != "" && aa.users[strings.ToLower(user)] {
+		return true
+	}
+	return aa.token != "" && subtle.ConstantTimeCompare([]byte(presentedToken(r)), []byte(aa.token)) == 1
+}
+
+// isAdmin reports whether a request is an admin's, either by AdminAuth or
+// by a session granting the admin role
+func (s *Server) isAdmin(r *http.Request) bool {
+	return s.admins.Allowed(r, s.currentUser(r)) || s.hasRole(r, roleAdmin)
+}
+
+// adminsEnabled reports whether anyone can be an admin
+func (s *Server) adminsEnabled() bool {
+	return s.admins.Enabled() || (s.ldap != nil && s.ldap.HasAdmins()) || s.clientCerts.HasAdmins()
+}
+
+// requireAdmin wraps an admin console handler so only admins reach it
+func (s *Server) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.adminsEnabled() {
+			http.Error(w, "The admin console is disabled", http.StatusNotFound)
+			return
+		}
+		if !s.isAdmin(r) {
+			if s.admins.token != "" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="go-links admin"`)
+				http.Error(w, "Admin sign-in required", http.StatusUnauthorized)
+			} else {
+				http.Error(w, "Admins only", http.StatusForbidden)
+			}
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		next(w, r)
+	}
+}
+
+// logTail keeps the last lines written to the log so recent warnings and
+// errors can be read from the admin console
+type logTail struct {
+	mu    sync.Mutex
+	lines []string
+	max   int
+}
+
+// newLogTail creates a log tail holding up to max lines
+func newLogTail(max int) *logTail {
+	return &logTail{max: max}
+}
+
+// Write records log output; it is meant to sit behind log.SetOutput
+func (lt *logTail) Write(p []byte) (int, error) {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		lt.lines = append(lt.lines, line)
+	}
+	if over := len(lt.lines) - lt.max; over > 0 {
+		lt.lines = append([]string(nil), lt.lines[over:]...)
+	}
+	return len(p), nil
+}
+
+// Lines returns the recorded lines, newest last
+func (lt *logTail) Lines() []string {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	return append([]string(nil), lt.lines...)
+}
+
+// handleAdmin serves GET /admin, the admin console
+func (s *Server) handleAdmin(w http.ResponseWriter, r *http.Request) {
+	var memory runtime.MemStats
+	runtime.ReadMemStats(&memory)
+
+	var logLines []string
+	if s.logs != nil {
+		logLines = s.logs.Lines()
+	}
+
+	var changes []AuditEntry
+	if s.auditLog != nil {
+		var err error
+		if changes, err = s.auditLog.Query(auditQuery{Limit: 20}); err != nil {
+			logFor(r).Error("Reading audit log", "error", err)
+		}
+		slices.Reverse(changes)
+	}
+
+	data := struct {
+		Prefix      string
+		Theme       *Theme
+		Maintenance *maintenanceState
+		CSRFToken   string
+		Lang        *translator
+		Done        string
+		Stats       StoreStats
+		Uptime      time.Duration
+		StartedAt   time.Time
+		Memory      string
+		Goroutines  int
+		Logs        []string
+		Audit       bool
+		Changes     []AuditEntry
+		Proposals   int
+		Digest      bool
+		Jobs        []JobStatus
+		Leader      string
+		Leading     bool
+	}{
+		Prefix:      s.hosts.Prefix(r),
+		Theme:       s.theme.Load(),
+		Maintenance: s.maintenance.State(),
+		CSRFToken:   s.csrfToken(w, r),
+		Lang:        translatorFor(w, r),
+		Done:        r.URL.Query().Get("done"),
+		Stats:       s.store.Stats(),
+		Uptime:      time.Since(s.startedAt).Round(time.Second),
+		StartedAt:   s.startedAt,
+		Memory:      fmt.Sprintf("%.1f MiB", float64(memory.Alloc)/(1<<20)),
+		Goroutines:  runtime.NumGoroutine(),
+		Logs:        logLines,
+		Audit:       s.auditLog != nil,
+		Changes:     changes,
+		Proposals:   len(s.proposals.List()),
+		Digest:      s.digest != nil,
+	}
+	if s.jobs != nil {
+		data.Jobs = s.jobs.Status()
+	}
+	if s.leadership != nil {
+		data.Leader, data.Leading = cmp.Or(s.leadership.Leader(), "none yet"), s.leadership.IsLeader()
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	if err := templates.ExecuteTemplate(w, "admin.html", data); err != nil {
+		http.Error(w, "Template execution error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// handleAdminReload serves POST /admin/reload, re-reading the links file
+// to pick up changes made to it by hand
+func (s *Server) handleAdminReload(w http.ResponseWriter, r *http.Request) {
+	if err := s.store.Load(); err != nil {
+		http.Error(w, "Reload failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.record(s.newAuditEntry(r, auditReload))
+	http.Redirect(w, r, "/admin?done=Reloaded+links+from+disk", http.StatusSeeOther)
+}
+
+// handleAdminCompact serves POST /admin/compact, trimming old click counts
+// and history and rewriting the links file
+func (s *Server) handleAdminCompact(w http.ResponseWriter, r *http.Request) {
+	trimmed, err := s.store.Compact()
+	if err != nil {
+		http.Error(w, "Compact failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	done := fmt.Sprintf("Compacted links file, trimmed %d links", trimmed)
+	http.Redirect(w, r, "/admin?done="+url.QueryEscape(done), http.StatusSeeOther)
+}
+
+// handleAdminExport serves GET /admin/export, a download of every link
+func (s *Server) handleAdminExport(w http.ResponseWriter, r *http.Request) {
+	filename := "links-" + time.Now().Format("20060102-150405") + ".json"
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	if err := s.store.Export(w); err != nil {
+		http.Error(w, "Export failed", http.StatusInternalServerError)
+	}
+}
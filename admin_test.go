@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestAdminRequiresAuth(t *testing.T) {
+	s := newTestServer(t, Link{Shortcut: "gh", URL: "https://github.com"})
+	handler := s.requireAdmin(s.handleAdmin)
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/admin", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("unconfigured: status %d, want 404", w.Code)
+	}
+
+	s.admins = NewAdminAuth("root@example.com", "s3cret")
+	s.userHeader = "X-Forwarded-Email"
+	s.proxies = httptestProxy
+
+	for _, tc := range []struct {
+		name   string
+		setup  func(*http.Request)
+		status int
+	}{
+		{"anonymous", func(*http.Request) {}, http.StatusUnauthorized},
+		{"wrong token", func(r *http.Request) { r.SetBasicAuth("admin", "guess") }, http.StatusUnauthorized},
+		{"basic auth", func(r *http.Request) { r.SetBasicAuth("admin", "s3cret") }, http.StatusOK},
+		{"bearer", func(r *http.Request) { r.Header.Set("Authorization", "Bearer s3cret") }, http.StatusOK},
+		{"admin user", func(r *http.Request) { r.Header.Set("X-Forwarded-Email", "Root@example.com") }, http.StatusOK},
+	} {
+		req := httptest.NewRequest("GET", "/admin", nil)
+		tc.setup(req)
+		w := httptest.NewRecorder()
+		handler(w, req)
+		if w.Code != tc.status {
+			t.Errorf("%s: status %d, want %d", tc.name, w.Code, tc.status)
+		}
+	}
+}
+
+func TestAdminReloadAndExport(t *testing.T) {
+	s := newTestServer(t, Link{Shortcut: "gh", URL: "https://github.com"}, Link{Shortcut: "old", URL: "https://old.example.com"})
+
+	// Edit the file by hand, then reload it
+	data := `[{"shortcut": "gh", "url": "https://github.com/edited"}]`
+	if err := os.WriteFile(s.store.filePath, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	s.handleAdminReload(w, httptest.NewRequest("POST", "/admin/reload", nil))
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("reload: status %d: %s", w.Code, w.Body)
+	}
+	if _, exists := s.store.Get("", "old"); exists {
+		t.Errorf("link removed from the file survived a reload")
+	}
+
+	w = httptest.NewRecorder()
+	s.handleAdminExport(w, httptest.NewRequest("GET", "/admin/export", nil))
+	if body := w.Body.String(); !strings.Contains(body, "https://github.com/edited") {
+		t.Errorf("export = %s", body)
+	}
+	if !strings.HasPrefix(w.Header().Get("Content-Disposition"), "attachment") {
+		t.Errorf("export is not a download")
+	}
+}
+
+func TestLogTailKeepsLastLines(t *testing.T) {
+	lt := newLogTail(2)
+	lt.Write([]byte("one\n"))
+	lt.Write([]byte("two\nthree\n"))
+
+	if got := strings.Join(lt.Lines(), ","); got != "two,three" {
+		t.Errorf("lines = %s, want two,three", got)
+	}
+}
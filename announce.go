@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// announceFormats are the chat webhooks new links can be announced to.
+// Slack's format also suits Mattermost, and Discord's Slack-compatible
+// webhook URLs; Matrix is posted to through a hookshot generic webhook.
+var announceFormats = map[string]bool{"slack": true, "teams": true, "matrix": true}
+
+// Announcer posts new links to a chat webhook, so teams come across new
+// shortcuts as they're added
+type Announcer struct {
+	webhook    string
+	format     string
+	namespaces map[string]bool // the watched namespaces, or nil for all
+	client     *http.Client
+}
+
+// NewAnnouncer creates the announcer for a webhook URL, its format (slack
+// by default, teams or matrix) and the comma-separated namespaces to watch,
+// where "default" is the default namespace and none means all of them.
+// Without a webhook it returns nil: new links aren't announced.
+func NewAnnouncer(webhook, format, namespaces string) (*Announcer, error) {
+	if webhook = strings.TrimSpace(webhook); webhook == "" {
+		return nil, nil
+	}
+	if u, err := url.Parse(webhook); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("webhook %q must be an http or https URL", webhook)
+	}
+	format = cmp.Or(strings.ToLower(strings.TrimSpace(format)), "slack")
+	if !announceFormats[format] {
+		return nil, fmt.Errorf("unknown format %q, want slack, teams or matrix", format)
+	}
+	a := &Announcer{webhook: webhook, format: format, client: &http.Client{Timeout: 10 * time.Second}}
+	if namespaces != "" {
+		a.namespaces = parseReservedNamespaces(namespaces)
+	}
+	return a, nil
+}
+
+// Announce posts the links created by entries in watched namespaces, in
+// the background so whoever added them isn't kept waiting. Hidden links
+// and those restricted to groups aren't announced.
+func (a *Announcer) Announce(hosts *HostMap, entries []AuditEntry) {
+	var links []Link
+	for _, entry := range entries {
+		if entry.Action != auditCreate || entry.New == nil {
+			continue
+		}
+		link := *entry.New
+		if a.namespaces != nil && !a.namespaces[link.Namespace] || link.Hidden || len(link.VisibleTo) > 0 {
+			continue
+		}
+		links = append(links, link)
+	}
+	if len(links) == 0 {
+		return
+	}
+	go func() {
+		if err := a.post(hosts, links); err != nil {
+			log.Printf("Warning: Could not announce new links: %v", err)
+		}
+	}()
+}
+
+// post sends one message announcing links
+func (a *Announcer) post(hosts *HostMap, links []Link) error {
+	var lines, markup []string
+	for _, link := range links {
+		shortcut := hosts.PrefixFor(link.Namespace) + "/" + link.Shortcut
+		var details string
+		if link.Description != "" {
+			details += ": " + link.Description
+		}
+		if link.CreatedBy != "" {
+			details += " (added by " + link.CreatedBy + ")"
+		}
+		switch a.format {
+		case "slack":
+			escape := strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace
+			lines = append(lines, fmt.Sprintf("New link *%s* → <%s>%s", escape(shortcut), escape(link.URL), escape(details)))
+		case "teams":
+			lines = append(lines, fmt.Sprintf("New link **%s** → [%s](%[2]s)%s", shortcut, link.URL, details))
+		case "matrix":
+			lines = append(lines, fmt.Sprintf("New link %s → %s%s", shortcut, link.URL, details))
+			markup = append(markup, fmt.Sprintf(`New link <b>%s</b> → <a href="%s">%[2]s</a>%s`,
+				html.EscapeString(shortcut), html.EscapeString(link.URL), html.EscapeString(details)))
+		}
+	}
+
+	message := map[string]string{"text": strings.Join(lines, "\n")}
+	if a.format == "matrix" {
+		message["html"] = strings.Join(markup, "<br>")
+	}
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	resp, err := a.client.Post(a.webhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
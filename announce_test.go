@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAnnouncer(t *testing.T) {
+	messages := make(chan map[string]string, 10)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var message map[string]string
+		json.NewDecoder(r.Body).Decode(&message)
+		messages <- message
+	}))
+	defer webhook.Close()
+	hosts, _ := NewHostMap("go=,wiki")
+
+	a, err := NewAnnouncer(webhook.URL, "", "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := func(link Link) AuditEntry {
+		return AuditEntry{Action: auditCreate, Namespace: link.Namespace, Shortcut: link.Shortcut, New: &link}
+	}
+	a.Announce(hosts, []AuditEntry{
+		created(Link{Shortcut: "gh", URL: "https://github.com", Description: "Code <and> issues", CreatedBy: "alice"}),
+		created(Link{Shortcut: "hr", URL: "https://hr.example.com", Hidden: true}),
+		created(Link{Shortcut: "pay", URL: "https://pay.example.com", VisibleTo: []string{"finance"}}),
+		created(Link{Namespace: "wiki", Shortcut: "onboarding", URL: "https://wiki.example.com"}),
+		{Action: auditUpdate, Shortcut: "docs", New: &Link{Shortcut: "docs"}},
+	})
+	select {
+	case message := <-messages:
+		if want := "New link *go/gh* → <https://github.com>: Code &lt;and&gt; issues (added by alice)"; message["text"] != want {
+			t.Errorf("Slack message = %q, want %q", message["text"], want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message posted")
+	}
+
+	a, _ = NewAnnouncer(webhook.URL, "matrix", "")
+	if err := a.post(hosts, []Link{{Namespace: "wiki", Shortcut: "onboarding", URL: "https://wiki.example.com"}}); err != nil {
+		t.Fatal(err)
+	}
+	message := <-messages
+	if message["text"] != "New link wiki/onboarding → https://wiki.example.com" ||
+		!strings.Contains(message["html"], `<a href="https://wiki.example.com">`) {
+		t.Errorf("Matrix message = %v", message)
+	}
+	select {
+	case message := <-messages:
+		t.Errorf("unexpected message %v", message)
+	default:
+	}
+
+	for _, bad := range [][]string{{"ftp://chat.example.com", ""}, {"https://chat.example.com", "irc"}} {
+		if _, err := NewAnnouncer(bad[0], bad[1], ""); err == nil {
+			t.Errorf("NewAnnouncer(%q) succeeded", bad)
+		}
+	}
+	if a, err := NewAnnouncer("", "teams", ""); a != nil || err != nil {
+		t.Errorf("NewAnnouncer without a webhook = %v, %v; want nil, nil", a, err)
+	}
+}
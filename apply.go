@@ -0,0 +1,193 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+)
+
+// linkRef names a link in a plan
+type linkRef struct {
+	Namespace string `json:"namespace,omitempty"`
+	Shortcut  string `json:"shortcut"`
+}
+
+// fieldChange is a field an apply changes on a link
+type fieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// linkUpdate is a link an apply changes, and how
+type linkUpdate struct {
+	linkRef
+	Changes []fieldChange `json:"changes"`
+}
+
+// applyPlan is what applying a file of links does, or would do when only
+// planned
+type applyPlan struct {
+	DryRun         bool            `json:"dry_run,omitempty"`
+	Create         []linkRef       `json:"create"`
+	Update         []linkUpdate    `json:"update"`
+	Delete         []linkRef       `json:"delete"`
+	Unchanged      int             `json:"unchanged"`
+	IgnoredColumns []string        `json:"ignored_columns,omitempty"`
+	Problems       []importProblem `json:"problems,omitempty"`
+	Skipped        []importProblem `json:"skipped,omitempty"`
+}
+
+// handleApply serves POST /api/apply, making the links match a file of
+// them kept elsewhere, such as in Git: links it lists are added or
+// changed to match, and with prune=true the links it leaves out of its
+// namespaces are deleted. The file is read as for an import, and
+// dry_run=true returns the plan without changing anything. output=text
+// writes the plan as a diff, for CI logs, instead of JSON.
+func (s *Server) handleApply(w http.ResponseWriter, r *http.Request) {
+	rows, mapping, ok := readImport(w, r)
+	if !ok {
+		return
+	}
+	result, links, before := s.checkImport(r, rows, mapping)
+	plan := applyPlan{
+		DryRun:         r.URL.Query().Get("dry_run") == "true",
+		Create:         []linkRef{},
+		Update:         []linkUpdate{},
+		Delete:         []linkRef{},
+		Unchanged:      result.Unchanged,
+		IgnoredColumns: result.IgnoredColumns,
+		Problems:       result.Problems,
+		Skipped:        result.Skipped,
+	}
+	for _, link := range links {
+		ref := linkRef{link.Namespace, link.Shortcut}
+		old, exists := before[linkKey{link.Namespace, link.Shortcut}]
+		if !exists {
+			plan.Create = append(plan.Create, ref)
+			continue
+		}
+		update := linkUpdate{linkRef: ref}
+		oldFields, newFields := editableFields(linkFields(old)), editableFields(linkFields(link))
+		for _, field := range slices.Sorted(maps.Keys(newFields)) {
+			if oldFields[field] != newFields[field] {
+				update.Changes = append(update.Changes, fieldChange{field, oldFields[field], newFields[field]})
+			}
+		}
+		plan.Update = append(plan.Update, update)
+	}
+
+	// Pruning deletes what the file leaves out of the namespaces it covers,
+	// including the request's, even when the file is empty
+	var pruned []Link
+	if r.URL.Query().Get("prune") == "true" {
+		listed := make(map[linkKey]bool)
+		namespaces := map[string]bool{s.hosts.Namespace(r): true}
+		for _, key := range result.listed {
+			listed[key] = true
+			namespaces[key.namespace] = true
+		}
+		for namespace := range namespaces {
+			for shortcut, link := range s.store.GetAll(namespace) {
+				if !listed[linkKey{namespace, shortcut}] {
+					pruned = append(pruned, link)
+					plan.Delete = append(plan.Delete, linkRef{namespace, shortcut})
+				}
+			}
+		}
+	}
+	byRef := func(a, b linkRef) int {
+		return cmp.Or(cmp.Compare(a.Namespace, b.Namespace), cmp.Compare(a.Shortcut, b.Shortcut))
+	}
+	slices.SortFunc(plan.Create, byRef)
+	slices.SortFunc(plan.Update, func(a, b linkUpdate) int { return byRef(a.linkRef, b.linkRef) })
+	slices.SortFunc(plan.Delete, byRef)
+
+	status := http.StatusOK
+	if len(plan.Problems) > 0 {
+		status = http.StatusUnprocessableEntity
+	} else if !plan.DryRun {
+		if err := s.applyChanges(r, links, before, pruned); err != nil {
+			logFor(r).Error("Applying links", "error", err)
+			http.Error(w, "Failed to save links", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if r.URL.Query().Get("output") == "text" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(status)
+		writePlan(w, s.hosts, plan)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(plan)
+}
+
+// applyChanges saves the links an apply adds or changes and deletes those
+// it prunes, recording each in the audit log
+func (s *Server) applyChanges(r *http.Request, links []Link, before map[linkKey]Link, pruned []Link) error {
+	if len(links) > 0 {
+		span := startSpan(r, "LinkStore.AddMany")
+		err := s.store.AddMany(links)
+		span.End()
+		if err != nil {
+			return err
+		}
+	}
+	deleting := make(map[string][]string)
+	for _, link := range pruned {
+		deleting[link.Namespace] = append(deleting[link.Namespace], link.Shortcut)
+	}
+	for namespace, shortcuts := range deleting {
+		if _, err := s.store.DeleteMany(namespace, shortcuts); err != nil {
+			return err
+		}
+	}
+
+	var entries []AuditEntry
+	for _, link := range links {
+		old, existed := before[linkKey{link.Namespace, link.Shortcut}]
+		entries = append(entries, s.linkEntry(r, auditLink(old, existed), auditLink(s.store.Get(link.Namespace, link.Shortcut))))
+	}
+	for _, link := range pruned {
+		entries = append(entries, s.linkEntry(r, &link, nil))
+	}
+	s.record(entries...)
+	logFor(r).Info("Applied links", "added", len(links)-len(before), "updated", len(before), "deleted", len(pruned), "user", s.currentUser(r))
+	return nil
+}
+
+// writePlan writes a plan as a diff: + for links added, ~ for those
+// changed, with each changed field, and - for those deleted
+func writePlan(w io.Writer, hosts *HostMap, plan applyPlan) {
+	name := func(ref linkRef) string {
+		return hosts.PrefixFor(ref.Namespace) + "/" + ref.Shortcut
+	}
+	for _, problem := range plan.Problems {
+		fmt.Fprintf(w, "! line %d: %s: %s\n", problem.Line, problem.Shortcut, problem.Error)
+	}
+	for _, ref := range plan.Create {
+		fmt.Fprintf(w, "+ %s\n", name(ref))
+	}
+	for _, update := range plan.Update {
+		fmt.Fprintf(w, "~ %s\n", name(update.linkRef))
+		for _, change := range update.Changes {
+			fmt.Fprintf(w, "    %s: %q → %q\n", change.Field, change.Old, change.New)
+		}
+	}
+	for _, ref := range plan.Delete {
+		fmt.Fprintf(w, "- %s\n", name(ref))
+	}
+
+	summary := "Applied: %d added, %d changed, %d deleted, %d unchanged\n"
+	if plan.DryRun || len(plan.Problems) > 0 {
+		summary = "Plan: %d to add, %d to change, %d to delete, %d unchanged\n"
+	}
+	fmt.Fprintf(w, summary, len(plan.Create), len(plan.Update), len(plan.Delete), plan.Unchanged)
+}
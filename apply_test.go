@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestApply(t *testing.T) {
+	s := newTestServer(t,
+		Link{Shortcut: "gh", URL: "https://github.com", Description: "GitHub"},
+		Link{Shortcut: "wiki", URL: "https://wiki.example.com"},
+		Link{Shortcut: "old", URL: "https://old.example.com"},
+		Link{Namespace: "eng", Shortcut: "ci", URL: "https://ci.example.com"},
+	)
+	desired := `
+- shortcut: gh
+  url: https://github.com
+  description: GitHub
+- shortcut: wiki
+  url: https://new-wiki.example.com
+- shortcut: docs
+  url: https://docs.example.com
+`
+	apply := func(query string) (int, applyPlan) {
+		r := httptest.NewRequest("POST", "/api/apply?format=yaml&"+query, strings.NewReader(desired))
+		w := httptest.NewRecorder()
+		s.handleApply(w, r)
+		var plan applyPlan
+		json.NewDecoder(w.Body).Decode(&plan)
+		return w.Code, plan
+	}
+
+	code, plan := apply("prune=true&dry_run=true")
+	if code != http.StatusOK || len(plan.Create) != 1 || plan.Create[0].Shortcut != "docs" ||
+		len(plan.Update) != 1 || plan.Update[0].Shortcut != "wiki" || plan.Unchanged != 1 ||
+		len(plan.Delete) != 1 || plan.Delete[0].Shortcut != "old" {
+		t.Fatalf("plan: status %d, %+v", code, plan)
+	}
+	if changes := plan.Update[0].Changes; len(changes) != 1 || changes[0] != (fieldChange{"url", "https://wiki.example.com", "https://new-wiki.example.com"}) {
+		t.Errorf("wiki changes = %+v", changes)
+	}
+	if _, ok := s.store.Get("", "docs"); ok {
+		t.Fatal("dry run added a link")
+	}
+
+	// Without prune, links left out of the file stay
+	if code, plan = apply(""); code != http.StatusOK || len(plan.Delete) != 0 {
+		t.Fatalf("apply: status %d, %+v", code, plan)
+	}
+	if _, ok := s.store.Get("", "old"); !ok {
+		t.Error("apply without prune deleted a link")
+	}
+	if link, _ := s.store.Get("", "wiki"); link.URL != "https://new-wiki.example.com" {
+		t.Errorf("wiki URL = %s", link.URL)
+	}
+
+	if code, plan = apply("prune=true"); code != http.StatusOK || len(plan.Delete) != 1 || plan.Unchanged != 3 {
+		t.Fatalf("apply with prune: status %d, %+v", code, plan)
+	}
+	if _, ok := s.store.Get("", "old"); ok {
+		t.Error("pruned link still exists")
+	}
+	if _, ok := s.store.Get("eng", "ci"); !ok {
+		t.Error("pruning reached a namespace the file doesn't cover")
+	}
+
+	// The text plan reads as a diff
+	r := httptest.NewRequest("POST", "/api/apply?format=yaml&dry_run=true&output=text", strings.NewReader(desired+"- shortcut: new\n  url: https://new.example.com\n"))
+	w := httptest.NewRecorder()
+	s.handleApply(w, r)
+	if want := "+ go/new\nPlan: 1 to add, 0 to change, 0 to delete, 3 unchanged\n"; w.Body.String() != want {
+		t.Errorf("text plan = %q, want %q", w.Body, want)
+	}
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Audit actions
+const (
+	auditCreate = "create"
+	auditUpdate = "update"
+	auditDelete = "delete"
+	auditMove   = "move"
+	auditReload = "reload" // an admin reloaded the links file
+
+	auditRestoreBackup = "restore_backup" // an admin restored a backup
+
+	auditArchive = "archive" // an unused link was archived, see ExpiryPolicy
+	auditRestore = "restore" // an archived link was brought back
+)
+
+// AuditEntry records one change to the links: who made it, from where,
+// and the link before and after
+type AuditEntry struct {
+	Time         time.Time `json:"time"`
+	Actor        string    `json:"actor,omitempty"` // empty when not signed in
+	IP           string    `json:"ip"`
+	ForwardedFor string    `json:"forwarded_for,omitempty"` // as sent, so not to be trusted
+	Action       string    `json:"action"`
+	Namespace    string    `json:"namespace,omitempty"`
+	Shortcut     string    `json:"shortcut,omitempty"`
+	Old          *Link     `json:"old,omitempty"`
+	New          *Link     `json:"new,omitempty"`
+}
+
+// AuditLog is an append-only record of every change to the links, one
+// JSON entry per line. Entries are never removed by go-links, only
+// rewritten to drop IP addresses once they are past retention (see ScrubIPs).
+type AuditLog struct {
+	mu       sync.Mutex
+	file     *os.File
+	filePath string
+}
+
+// OpenAuditLog opens the audit log at filePath for appending, creating it
+// if needed
+func OpenAuditLog(filePath string) (*AuditLog, error) {
+	file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &AuditLog{file: file, filePath: filePath}, nil
+}
+
+// auditLogPath returns where the audit log is kept for the links file at
+// dataPath: GOLINKS_AUDIT_LOG, or by default alongside the links, or ""
+// when it's turned off
+func auditLogPath(dataPath string) string {
+	if path, ok := os.LookupEnv("GOLINKS_AUDIT_LOG"); ok {
+		return path
+	}
+	return filepath.Join(filepath.Dir(dataPath), "audit.jsonl")
+}
+
+// Close closes the log file
+func (al *AuditLog) Close() error {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	return al.file.Close()
+}
+
+// Append writes entries to the end of the log
+func (al *AuditLog) Append(entries ...AuditEntry) error {
+	var buf []byte
+	for _, entry := range entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		buf = append(append(buf, line...), '\n')
+	}
+
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	if _, err := al.file.Write(buf); err != nil {
+		return err
+	}
+	return al.file.Sync()
+}
+
+// auditQuery selects audit entries; zero fields match everything
+type auditQuery struct {
+	Actor    string
+	Action   string
+	Shortcut string
+	Since    time.Time
+	Until    time.Time
+	Limit    int // most recent entries to return
+}
+
+func (q auditQuery) matches(entry AuditEntry) bool {
+	return (q.Actor == "" || entry.Actor == q.Actor) &&
+		(q.Action == "" || entry.Action == q.Action) &&
+		(q.Shortcut == "" || entry.Shortcut == q.Shortcut) &&
+		(q.Since.IsZero() || !entry.Time.Before(q.Since)) &&
+		(q.Until.IsZero() || entry.Time.Before(q.Until))
+}
+
+// Query returns the entries matching q, oldest first
+func (al *AuditLog) Query(q auditQuery) ([]AuditEntry, error) {
+	file, err := os.Open(al.filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	entries := []AuditEntry{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 16<<20)
+	for scanner.Scan() {
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, err
+		}
+		if q.matches(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if q.Limit > 0 && len(entries) > q.Limit {
+		entries = entries[len(entries)-q.Limit:]
+	}
+	return entries, nil
+}
+
+// auditLink returns a copy of link for the audit log, without its history
+// and click statistics, or nil for no link
+func auditLink(link Link, exists bool) *Link {
+	if !exists {
+		return nil
+	}
+	link.History = nil
+	link.Clicks = 0
+	link.DailyClicks = nil
+	link.Referrers = nil
+	link.Clients = nil
+	return &link
+}
+
+// newAuditEntry starts an entry for a change made by a request
+func (s *Server) newAuditEntry(r *http.Request, action string) AuditEntry {
+	return AuditEntry{
+		Time:         time.Now().UTC(),
+		Actor:        s.currentUser(r),
+		IP:           s.anonIP(r),
+		ForwardedFor: s.privacy.ForwardedFor(r.Header.Get("X-Forwarded-For")),
+		Action:       action,
+	}
+}
+
+// linkEntry describes a change to one link, made by a request. A missing
+// old link is a create and a missing new link a delete.
+func (s *Server) linkEntry(r *http.Request, oldLink, newLink *Link) AuditEntry {
+	action, link := auditUpdate, newLink
+	switch {
+	case oldLink == nil:
+		action = auditCreate
+	case newLink == nil:
+		action, link = auditDelete, oldLink
+	case oldLink.Namespace != newLink.Namespace:
+		action = auditMove
+	}
+
+	entry := s.newAuditEntry(r, action)
+	entry.Namespace, entry.Shortcut = link.Namespace, link.Shortcut
+	entry.Old, entry.New = oldLink, newLink
+	return entry
+}
+
+// audit records a change to one link, made by a request
+func (s *Server) audit(r *http.Request, oldLink, newLink *Link) {
+	s.record(s.linkEntry(r, oldLink, newLink))
+}
+
+// record passes a change on to whatever is configured to hear of it: other
+// instances, through Redis and directly to peers, the new-link announcer,
+// outbound webhooks, the Git repository and the audit log. The change has
+// already been made, so a failure is logged rather than returned.
+func (s *Server) record(entries ...AuditEntry) {
+	if s.invalidations != nil {
+		s.invalidations.Publish(entries)
+	}
+	if s.peers != nil {
+		s.peers.Publish(entries)
+	}
+	if s.announcer != nil {
+		s.announcer.Announce(s.hosts, entries)
+	}
+	if s.webhooks != nil {
+		s.webhooks.Send(s.hosts, entries)
+	}
+	if s.gitRepo != nil && len(entries) > 0 {
+		s.gitRepo.Commit(s.hosts, s.store.All, entries)
+	}
+	if s.auditLog == nil || len(entries) == 0 {
+		return
+	}
+	if err := s.auditLog.Append(entries...); err != nil {
+		log.Printf("Warning: Could not write audit log: %v", err)
+	}
+}
+
+// handleAudit serves GET /admin/audit, the audit log filtered by the actor,
+// action, shortcut, since and until (RFC 3339) and limit query parameters.
+// format picks JSON (the default, newest first), or csv or jsonl downloads
+// (oldest first).
+func (s *Server) handleAudit(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	q := auditQuery{
+		Actor:    query.Get("actor"),
+		Action:   query.Get("action"),
+		Shortcut: query.Get("shortcut"),
+	}
+	for name, field := range map[string]*time.Time{"since": &q.Since, "until": &q.Until} {
+		if value := query.Get(name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				http.Error(w, "Invalid "+name+" time, want RFC 3339", http.StatusBadRequest)
+				return
+			}
+			*field = t
+		}
+	}
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		q.Limit = limit
+	}
+
+	entries, err := s.auditLog.Query(q)
+	if err != nil {
+		log.Printf("Reading audit log: %v", err)
+		http.Error(w, "Failed to read audit log", http.StatusInternalServerError)
+		return
+	}
+
+	filename := "audit-" + time.Now().Format("20060102-150405")
+	switch query.Get("format") {
+	case "", "json":
+		slices.Reverse(entries)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(entries)
+	case "jsonl":
+		w.Header().Set("Content-Type", "application/jsonl")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`.jsonl"`)
+		encoder := json.NewEncoder(w)
+		for _, entry := range entries {
+			encoder.Encode(entry)
+		}
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`.csv"`)
+		writeAuditCSV(w, entries)
+	default:
+		http.Error(w, "Unknown format, want json, jsonl or csv", http.StatusBadRequest)
+	}
+}
+
+// writeAuditCSV writes entries as CSV with a header row. The old and new
+// links are included as JSON, with their URLs in columns of their own.
+func writeAuditCSV(w http.ResponseWriter, entries []AuditEntry) {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"time", "actor", "ip", "forwarded_for", "action", "namespace", "shortcut", "old_url", "new_url", "old", "new"})
+	for _, entry := range entries {
+		var oldURL, newURL, oldJSON, newJSON string
+		if entry.Old != nil {
+			oldURL = entry.Old.URL
+			data, _ := json.Marshal(entry.Old)
+			oldJSON = string(data)
+		}
+		if entry.New != nil {
+			newURL = entry.New.URL
+			data, _ := json.Marshal(entry.New)
+			newJSON = string(data)
+		}
+		cw.Write([]string{
+			entry.Time.Format(time.RFC3339), entry.Actor, entry.IP, entry.ForwardedFor, entry.Action,
+			entry.Namespace, entry.Shortcut, oldURL, newURL, oldJSON, newJSON,
+		})
+	}
+	cw.Flush()
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAuditLog(t *testing.T) {
+	s := newTestServer(t,
+		Link{Shortcut: "wiki", URL: "https://wiki.example.com", Clicks: 12},
+		Link{Shortcut: "ci", URL: "https://ci.example.com"},
+		Link{Shortcut: "ci", URL: "https://ci.example.org", Namespace: "eng"},
+	)
+	var err error
+	if s.auditLog, err = OpenAuditLog(filepath.Join(t.TempDir(), "audit.jsonl")); err != nil {
+		t.Fatal(err)
+	}
+	s.userHeader = "X-User"
+	s.proxies = httptestProxy
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /add", s.handleAdd)
+	mux.HandleFunc("POST /api/links/bulk", s.handleBulk)
+	mux.HandleFunc("PUT /api/links/{shortcut...}", s.handleUpdate)
+	mux.HandleFunc("DELETE /api/links/{shortcut...}", s.handleDelete)
+	do := func(method, path string, form url.Values) {
+		t.Helper()
+		r := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+		r.RemoteAddr = "192.0.2.7:4321"
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set("X-User", "alice@example.com")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		if w.Code >= 400 {
+			t.Fatalf("%s %s: status %d: %s", method, path, w.Code, w.Body)
+		}
+	}
+
+	do("POST", "/add", url.Values{"shortcut": {"docs"}, "url": {"https://docs.example.com"}})
+	do("PUT", "/api/links/wiki", url.Values{"url": {"https://wiki.example.org"}})
+	do("POST", "/api/links/bulk", url.Values{"action": {"move"}, "value": {"eng"}, "shortcut": {"docs", "ci"}})
+	do("DELETE", "/api/links/wiki", nil)
+
+	entries, err := s.auditLog.Query(auditQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, entry := range entries {
+		got = append(got, entry.Action+" "+entry.Namespace+":"+entry.Shortcut)
+		if entry.Actor != "alice@example.com" || entry.IP != "192.0.2.7" {
+			t.Errorf("%s by %q from %q, want alice@example.com from 192.0.2.7", entry.Action, entry.Actor, entry.IP)
+		}
+	}
+	// ci wasn't moved, since eng:ci is taken
+	if want := "create :docs,update :wiki,move eng:docs,delete :wiki"; strings.Join(got, ",") != want {
+		t.Errorf("audit log = %v, want %s", got, want)
+	}
+
+	update := entries[1]
+	if update.Old.URL != "https://wiki.example.com" || update.New.URL != "https://wiki.example.org" {
+		t.Errorf("update recorded %+v -> %+v", update.Old, update.New)
+	}
+	if update.Old.Clicks != 0 || update.New.History != nil {
+		t.Error("audit entries include click counts or history")
+	}
+	if entries[3].New != nil {
+		t.Errorf("delete recorded a new link %+v", entries[3].New)
+	}
+
+	entries, _ = s.auditLog.Query(auditQuery{Shortcut: "wiki", Limit: 1})
+	if len(entries) != 1 || entries[0].Action != auditDelete {
+		t.Errorf("latest change to wiki = %+v, want the delete", entries)
+	}
+}
+
+func TestHandleAudit(t *testing.T) {
+	s := newTestServer(t)
+	var err error
+	if s.auditLog, err = OpenAuditLog(filepath.Join(t.TempDir(), "audit.jsonl")); err != nil {
+		t.Fatal(err)
+	}
+	for _, shortcut := range []string{"a", "b"} {
+		r := httptest.NewRequest("POST", "/add", nil)
+		r.Header.Set("X-Forwarded-For", "198.51.100.1")
+		s.audit(r, nil, &Link{Shortcut: shortcut, URL: "https://" + shortcut + ".example.com"})
+	}
+
+	get := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.handleAudit(w, httptest.NewRequest("GET", "/admin/audit?"+query, nil))
+		return w
+	}
+
+	var entries []AuditEntry
+	if err := json.NewDecoder(get("").Body).Decode(&entries); err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Shortcut != "b" || entries[0].ForwardedFor != "198.51.100.1" {
+		t.Errorf("JSON = %+v, want b then a", entries)
+	}
+
+	w := get("format=csv&shortcut=a")
+	if !strings.Contains(w.Header().Get("Content-Disposition"), ".csv") {
+		t.Errorf("CSV Content-Disposition = %q", w.Header().Get("Content-Disposition"))
+	}
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0][0] != "time" || records[1][6] != "a" || records[1][8] != "https://a.example.com" {
+		t.Errorf("CSV = %v", records)
+	}
+
+	if lines := strings.Split(strings.TrimSpace(get("format=jsonl").Body.String()), "\n"); len(lines) != 2 || !strings.Contains(lines[0], `"shortcut":"a"`) {
+		t.Errorf("JSONL = %q, want a then b", lines)
+	}
+
+	for _, query := range []string{"since=yesterday", "limit=-1", "format=xml"} {
+		if w := get(query); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", query, w.Code)
+		}
+	}
+	if w := get("since=2999-01-01T00:00:00Z"); strings.TrimSpace(w.Body.String()) != "[]" {
+		t.Errorf("future since = %s, want no entries", w.Body)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// EditAuth optionally restricts who may add, edit and delete links: users
+// signing in with HTTP basic auth, or anyone presenting the shared edit
+// token. Redirects and browsing stay open. With neither configured anyone
+// may edit, as before.
+type EditAuth struct {
+	users map[string]string // username -> password
+	token string
+}
+
+// NewEditAuth creates edit access rules from a comma-separated list of
+// name:password pairs and an optional shared token
+func NewEditAuth(users, token string) (*EditAuth, error) {
+	ea := &EditAuth{users: make(map[string]string), token: token}
+	for _, entry := range splitList(users) {
+		name, password, ok := strings.Cut(entry, ":")
+		if !ok || name == "" || password == "" {
+			return nil, fmt.Errorf("invalid user %q, want name:password", name)
+		}
+		ea.users[name] = password
+	}
+	return ea, nil
+}
+
+// Enabled reports whether editing requires signing in
+func (ea *EditAuth) Enabled() bool {
+	return len(ea.users) > 0 || ea.token != ""
+}
+
+// User returns the user a request signed in as with basic auth, or "" when
+// it didn't present valid credentials
+func (ea *EditAuth) User(r *http.Request) string {
+	name, password, ok := r.BasicAuth()
+	if !ok {
+		return ""
+	}
+	want, exists := ea.users[name]
+	if !exists || subtle.ConstantTimeCompare([]byte(password), []byte(want)) != 1 {
+		return ""
+	}
+	return name
+}
+
+// Allowed reports whether a request may change links
+func (ea *EditAuth) Allowed(r *http.Request) bool {
+	if ea.User(r) != "" {
+		return true
+	}
+	return ea.token != "" && subtle.ConstantTimeCompare([]byte(presentedToken(r)), []byte(ea.token)) == 1
+}
+
+// presentedToken returns the token sent as a bearer token or, for
+// browsers, as the basic-auth password with any username
+func presentedToken(r *http.Request) string {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return token
+	}
+	_, password, _ := r.BasicAuth()
+	return password
+}
+
+// editRestricted reports whether changing links requires signing in
+func (s *Server) editRestricted() bool {
+	return s.editors.Enabled() || s.signInToEdit || (s.ldap != nil && s.ldap.RestrictsEditing())
+}
+
+// mayEdit reports whether a request may change links: anyone when edit
+// access isn't restricted, otherwise editors (see EditAuth), users whose
+// session grants the editor role, admins and, with
+// GOLINKS_REQUIRE_SIGN_IN, any signed-in user
+func (s *Server) mayEdit(r *http.Request) bool {
+	if !s.editRestricted() {
+		return true
+	}
+	return s.editors.Allowed(r) || (s.signInToEdit && s.currentUser(r) != "") ||
+		s.hasRole(r, roleEditor) || s.isAdmin(r)
+}
+
+// hasRole reports whether the request's session, or the API token or
+// client certificate it presents, grants role
+func (s *Server) hasRole(r *http.Request, role string) bool {
+	if token, ok := s.tokens.FromRequest(r); ok {
+		return token.Permits(r) && slices.Contains(token.Roles, role)
+	}
+	if _, ok := s.clientCerts.Identify(r); ok {
+		return s.clientCerts.HasRole(r, role)
+	}
+	return s.sessions != nil && s.sessions.HasRole(r, role)
+}
+
+// requireEditor wraps a handler that changes links so only editors,
+// admins and users the ACL grants a space to reach it, and only admins and
+// ACL grantees in reserved namespaces. Handlers check the links themselves
+// with mayAdd and mayChange.
+func (s *Server) requireEditor(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		role := s.roleOf(r)
+		if role != roleAdmin && s.acl.GrantsAny(s.currentUser(r), s.currentGroups(r)) {
+			next(w, r)
+			return
+		}
+		if role == roleViewer {
+			if s.editors.Enabled() {
+				w.Header().Set("WWW-Authenticate", `Basic realm="go-links"`)
+			}
+			http.Error(w, "Sign in to change links", http.StatusUnauthorized)
+			return
+		}
+		if role != roleAdmin && s.reserved[s.hosts.Namespace(r)] {
+			http.Error(w, "Only admins can change links here", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// requireLinkChanger wraps a handler that changes the link named by the
+// {shortcut} path value so only those who may change it reach it
+func (s *Server) requireLinkChanger(next http.HandlerFunc) http.HandlerFunc {
+	return s.requireEditor(func(w http.ResponseWriter, r *http.Request) {
+		link, exists := s.store.Get(s.hosts.Namespace(r), r.PathValue("shortcut"))
+		if exists && !s.mayChange(r, link) {
+			http.Error(w, "Only the link's creator, its owner, its team and admins can change it", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	})
+}
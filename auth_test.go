@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestNewEditAuth(t *testing.T) {
+	for _, users := range []string{"alice", "alice:", ":secret", "alice:secret,bob"} {
+		if _, err := NewEditAuth(users, ""); err == nil {
+			t.Errorf("NewEditAuth(%q) succeeded, want an error", users)
+		}
+	}
+}
+
+func TestRequireEditor(t *testing.T) {
+	s := newTestServer(t)
+	add := s.requireEditor(s.handleAdd)
+	post := func(setup func(*http.Request)) *httptest.ResponseRecorder {
+		form := url.Values{"shortcut": {"gh"}, "url": {"https://github.com"}}
+		r := httptest.NewRequest("POST", "/add", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		setup(r)
+		w := httptest.NewRecorder()
+		add(w, r)
+		return w
+	}
+
+	// Open by default
+	if w := post(func(*http.Request) {}); w.Code != http.StatusSeeOther {
+		t.Fatalf("unconfigured: status %d, want %d", w.Code, http.StatusSeeOther)
+	}
+
+	var err error
+	if s.editors, err = NewEditAuth("alice:wonderland", "s3cret"); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name   string
+		setup  func(*http.Request)
+		status int
+	}{
+		{"anonymous", func(*http.Request) {}, http.StatusUnauthorized},
+		{"wrong password", func(r *http.Request) { r.SetBasicAuth("alice", "guess") }, http.StatusUnauthorized},
+		{"unknown user", func(r *http.Request) { r.SetBasicAuth("mallory", "wonderland") }, http.StatusUnauthorized},
+		{"user", func(r *http.Request) { r.SetBasicAuth("alice", "wonderland") }, http.StatusSeeOther},
+		{"token as password", func(r *http.Request) { r.SetBasicAuth("anyone", "s3cret") }, http.StatusSeeOther},
+		{"bearer token", func(r *http.Request) { r.Header.Set("Authorization", "Bearer s3cret") }, http.StatusSeeOther},
+	} {
+		w := post(tc.setup)
+		if w.Code != tc.status {
+			t.Errorf("%s: status %d, want %d", tc.name, w.Code, tc.status)
+		}
+		if w.Code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s: no WWW-Authenticate challenge", tc.name)
+		}
+	}
+
+	// Basic-auth users are recorded as the link's creator
+	if _, err := s.store.Delete("", "gh"); err != nil {
+		t.Fatal(err)
+	}
+	post(func(r *http.Request) { r.SetBasicAuth("alice", "wonderland") })
+	if link, _ := s.store.Get("", "gh"); link.CreatedBy != "alice" {
+		t.Errorf("CreatedBy = %q, want alice", link.CreatedBy)
+	}
+
+	// Redirects stay open
+	w := httptest.NewRecorder()
+	s.handleHome(w, httptest.NewRequest("GET", "/gh", nil))
+	if w.Code != http.StatusFound {
+		t.Errorf("redirect status %d, want %d", w.Code, http.StatusFound)
+	}
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errNotEmpty refuses to restore a backup over links already there
+var errNotEmpty = errors.New("there are links here already; restore into an empty deployment")
+
+// backupPart is one of the stores held in a backup
+type backupPart struct {
+	name   string      // its name in the archive
+	path   string      // its file
+	perm   os.FileMode // the file's permissions
+	write  func(io.Writer) error
+	decode func([]byte) error // checks a copy of the file can be loaded
+	load   func() error
+}
+
+// decodes checks data unmarshals as a T
+func decodes[T any](data []byte) error {
+	var v T
+	return json.Unmarshal(data, &v)
+}
+
+// backupParts are the stores a backup holds: the links and, kept alongside
+// them, stars, API tokens, suggestions and missing shortcuts. Sessions,
+// the audit log and the leader lease are left out.
+func (s *Server) backupParts() []backupPart {
+	parts := []backupPart{{"links.json", s.store.filePath, 0644, s.store.Export, decodes[[]Link], s.store.Load}}
+	if s.stars != nil {
+		parts = append(parts, backupPart{"stars.json", s.stars.filePath, 0644, lockedFile(s.stars.mu.RLocker(), s.stars.filePath), decodes[[]starRecord], s.stars.Load})
+	}
+	if s.tokens != nil {
+		parts = append(parts, backupPart{"tokens.json", s.tokens.filePath, 0600, lockedFile(s.tokens.mu.RLocker(), s.tokens.filePath), decodes[[]APIToken], s.tokens.Load})
+	}
+	if s.proposals != nil {
+		parts = append(parts, backupPart{"proposals.json", s.proposals.filePath, 0644, lockedFile(s.proposals.mu.RLocker(), s.proposals.filePath), decodes[[]Proposal], s.proposals.Load})
+	}
+	if s.misses != nil {
+		write := lockedFile(&s.misses.mu, s.misses.filePath)
+		parts = append(parts, backupPart{"misses.json", s.misses.filePath, 0644, func(w io.Writer) error {
+			if err := s.misses.Flush(); err != nil {
+				return err
+			}
+			return write(w)
+		}, decodes[[]Miss], s.misses.Load})
+	}
+	return parts
+}
+
+// lockedFile copies a store's file while holding its lock, so it is never
+// caught half written
+func lockedFile(mu sync.Locker, path string) func(io.Writer) error {
+	return func(w io.Writer) error {
+		mu.Lock()
+		defer mu.Unlock()
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(w, f)
+		return err
+	}
+}
+
+// WriteBackup writes a snapshot of the stores to w as a gzipped tar file.
+// Links are read from the store rather than its file, so clicks not yet
+// saved are included; stores with no file yet are left out.
+func (s *Server) WriteBackup(w io.Writer) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	now := time.Now()
+	for _, part := range s.backupParts() {
+		var buf bytes.Buffer
+		if err := part.write(&buf); errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("backing up %s: %w", part.name, err)
+		}
+		header := &tar.Header{Name: part.name, Mode: int64(part.perm), Size: int64(buf.Len()), ModTime: now}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := tw.Write(buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// RestoreBackup restores a snapshot written by WriteBackup, returning how
+// many links it held. It only restores into a deployment with no links,
+// and decodes every part of the snapshot before replacing any files.
+func (s *Server) RestoreBackup(r io.Reader) (int, error) {
+	if s.store.Stats().Links > 0 {
+		return 0, errNotEmpty
+	}
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return 0, fmt.Errorf("not a go-links backup: %w", err)
+	}
+	parts := s.backupParts()
+	files := make(map[string][]byte)
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf("reading the backup: %w", err)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return 0, fmt.Errorf("reading the backup: %w", err)
+		}
+		files[header.Name] = data
+	}
+	if _, ok := files["links.json"]; !ok {
+		return 0, errors.New("not a go-links backup: it has no links.json")
+	}
+	for _, part := range parts {
+		if data, ok := files[part.name]; ok {
+			if err := part.decode(data); err != nil {
+				return 0, fmt.Errorf("the backup's %s is damaged: %w", part.name, err)
+			}
+		}
+	}
+
+	for _, part := range parts {
+		data, ok := files[part.name]
+		if !ok {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(part.path), 0755); err != nil {
+			return 0, err
+		}
+		if err := replaceFile(part.path, data, part.perm); err != nil {
+			return 0, fmt.Errorf("restoring %s: %w", part.name, err)
+		}
+	}
+	for _, part := range parts {
+		if _, ok := files[part.name]; !ok {
+			continue
+		}
+		if err := part.load(); err != nil {
+			return 0, fmt.Errorf("loading the restored %s: %w", part.name, err)
+		}
+	}
+	return s.store.Stats().Links, nil
+}
+
+// replaceFile writes data to path atomically, so a failed write never
+// leaves half a file and readers see either the old file or the new one
+func replaceFile(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// backupName is the file name for a snapshot taken at t
+func backupName(t time.Time) string {
+	return "go-links-" + t.Format("20060102-150405") + ".tar.gz"
+}
+
+// dataServer loads the stores kept with the links file at dataPath, for
+// backing up and restoring from the command line without a running server
+func dataServer(dataPath string) (*Server, error) {
+	dir := filepath.Dir(dataPath)
+	s := &Server{
+		store:     &LinkStore{filePath: dataPath},
+		stars:     NewStarStore(filepath.Join(dir, "stars.json")),
+		tokens:    NewTokenStore(filepath.Join(dir, "tokens.json")),
+		proposals: NewProposalStore(filepath.Join(dir, "proposals.json")),
+		misses:    NewMissStore(filepath.Join(dir, "misses.json")),
+	}
+	for _, part := range s.backupParts() {
+		if err := part.load(); err != nil {
+			return nil, fmt.Errorf("loading %s: %w", part.name, err)
+		}
+	}
+	return s, nil
+}
+
+// backupTo writes a timestamped snapshot of the data at dataPath into dir,
+// for go-links -backup, returning its path
+func backupTo(dataPath, dir string) (string, error) {
+	s, err := dataServer(dataPath)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := s.WriteBackup(&buf); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, backupName(time.Now()))
+	return path, replaceFile(path, buf.Bytes(), 0600)
+}
+
+// restoreFrom restores the snapshot at path into the empty deployment at
+// dataPath, for go-links -restore, returning how many links it held
+func restoreFrom(dataPath, path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	s, err := dataServer(dataPath)
+	if err != nil {
+		return 0, err
+	}
+	return s.RestoreBackup(f)
+}
+
+// handleAdminBackup serves GET /admin/backup, a download of a snapshot
+func (s *Server) handleAdminBackup(w http.ResponseWriter, r *http.Request) {
+	var buf bytes.Buffer
+	if err := s.WriteBackup(&buf); err != nil {
+		log.Printf("Warning: Backup failed: %v", err)
+		http.Error(w, "Backup failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+backupName(time.Now())+`"`)
+	w.Write(buf.Bytes())
+}
+
+// handleAdminRestore serves POST /admin/restore, restoring a snapshot into
+// an empty deployment. The snapshot is uploaded from the admin console as
+// the backup form field, or sent as the request body.
+func (s *Server) handleAdminRestore(w http.ResponseWriter, r *http.Request) {
+	var body io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, err := r.FormFile("backup")
+		if err != nil {
+			http.Error(w, "Choose a backup to restore", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		body = file
+	}
+	restored, err := s.RestoreBackup(body)
+	if errors.Is(err, errNotEmpty) {
+		http.Error(w, "Restore refused: "+err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Restore failed: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.record(s.newAuditEntry(r, auditRestoreBackup))
+	done := fmt.Sprintf("Restored %d links from the backup", restored)
+	if r.Header.Get("Sec-Fetch-Mode") != "navigate" {
+		fmt.Fprintln(w, done)
+		return
+	}
+	http.Redirect(w, r, "/admin?done="+url.QueryEscape(done), http.StatusSeeOther)
+}
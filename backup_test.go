@@ -0,0 +1,127 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBackupAndRestore(t *testing.T) {
+	s := newTestServer(t, Link{Shortcut: "wiki", URL: "https://wiki.example.com"}, Link{Namespace: "eng", Shortcut: "ci", URL: "https://ci.example.com"})
+	if _, err := s.stars.Toggle("alice", "", "wiki"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.tokens.Create("alice", "deploys", scopeWrite, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	s.store.RecordClick("", "wiki", clickSource{})
+	var backup bytes.Buffer
+	if err := s.WriteBackup(&backup); err != nil {
+		t.Fatal(err)
+	}
+
+	empty := newTestServer(t)
+	restored, err := empty.RestoreBackup(bytes.NewReader(backup.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored != 2 {
+		t.Errorf("restored %d links, want 2", restored)
+	}
+	if link, ok := empty.store.Get("", "wiki"); !ok || link.Clicks != 1 {
+		t.Errorf("restored wiki = %+v, %v, want it with its unsaved click", link, ok)
+	}
+	if !empty.stars.Starred("alice", "")["wiki"] {
+		t.Error("alice's star wasn't restored")
+	}
+	if tokens := empty.tokens.List("alice"); len(tokens) != 1 {
+		t.Errorf("restored %d of alice's tokens, want 1", len(tokens))
+	}
+	if info, err := os.Stat(empty.tokens.filePath); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("restored tokens file: %v, %v, want it private", info, err)
+	}
+
+	// Restoring again would replace the links now there
+	if _, err := empty.RestoreBackup(bytes.NewReader(backup.Bytes())); !errors.Is(err, errNotEmpty) {
+		t.Errorf("restoring over links = %v, want it refused", err)
+	}
+	for _, bad := range [][]byte{[]byte("links"), backup.Bytes()[:backup.Len()/2]} {
+		if _, err := newTestServer(t).RestoreBackup(bytes.NewReader(bad)); err == nil {
+			t.Errorf("restoring %d damaged bytes succeeded", len(bad))
+		}
+	}
+
+	// A part that can't be loaded leaves every file as it was
+	var damaged bytes.Buffer
+	gz := gzip.NewWriter(&damaged)
+	tw := tar.NewWriter(gz)
+	for _, file := range []struct{ name, data string }{
+		{"links.json", `[{"shortcut": "wiki", "url": "https://wiki.example.com"}]`},
+		{"tokens.json", `{"alice": "not a list of tokens"}`},
+	} {
+		tw.WriteHeader(&tar.Header{Name: file.name, Mode: 0644, Size: int64(len(file.data))})
+		tw.Write([]byte(file.data))
+	}
+	tw.Close()
+	gz.Close()
+	s = newTestServer(t)
+	if _, err := s.RestoreBackup(&damaged); err == nil || !strings.Contains(err.Error(), "tokens.json") {
+		t.Errorf("restoring damaged tokens = %v, want it refused", err)
+	}
+	if _, err := os.Stat(s.store.filePath); !os.IsNotExist(err) {
+		t.Errorf("links file after a refused restore: %v, want none", err)
+	}
+}
+
+func TestBackupCommands(t *testing.T) {
+	dataPath := filepath.Join(t.TempDir(), "links.json")
+	os.WriteFile(dataPath, []byte(`[{"shortcut": "wiki", "url": "https://wiki.example.com"}]`), 0644)
+	dir := filepath.Join(t.TempDir(), "backups")
+	path, err := backupTo(dataPath, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Dir(path) != dir || !strings.HasPrefix(filepath.Base(path), "go-links-") || !strings.HasSuffix(path, ".tar.gz") {
+		t.Errorf("backup written to %s, want a timestamped file in %s", path, dir)
+	}
+
+	if _, err := restoreFrom(dataPath, path); !errors.Is(err, errNotEmpty) {
+		t.Errorf("restoring over links = %v, want it refused", err)
+	}
+	restored, err := restoreFrom(filepath.Join(t.TempDir(), "new", "links.json"), path)
+	if err != nil || restored != 1 {
+		t.Errorf("restoring into a new deployment = %d, %v, want 1 link", restored, err)
+	}
+}
+
+func TestAdminBackupAndRestore(t *testing.T) {
+	s := newTestServer(t, Link{Shortcut: "wiki", URL: "https://wiki.example.com"})
+	w := httptest.NewRecorder()
+	s.handleAdminBackup(w, httptest.NewRequest("GET", "/admin/backup", nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/gzip" {
+		t.Fatalf("backup: status %d, type %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	backup := w.Body.Bytes()
+
+	w = httptest.NewRecorder()
+	s.handleAdminRestore(w, httptest.NewRequest("POST", "/admin/restore", bytes.NewReader(backup)))
+	if w.Code != http.StatusConflict {
+		t.Errorf("restoring over links: status %d, want 409", w.Code)
+	}
+	empty := newTestServer(t)
+	w = httptest.NewRecorder()
+	empty.handleAdminRestore(w, httptest.NewRequest("POST", "/admin/restore", bytes.NewReader(backup)))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Restored 1 links") {
+		t.Errorf("restore: status %d, %q", w.Code, w.Body.String())
+	}
+	if _, ok := empty.store.Get("", "wiki"); !ok {
+		t.Error("wiki wasn't restored")
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Blocklist holds shortcut names and glob patterns that may not be used.
+// It is managed by the operator as a plain text file with one entry per
+// line; lines starting with # are comments. Entries containing *, ? or [
+// are treated as glob patterns, everything else must match exactly.
+// Matching is case-insensitive.
+type Blocklist struct {
+	mu       sync.RWMutex
+	names    map[string]bool
+	patterns []string
+	filePath string
+	modTime  time.Time
+}
+
+// NewBlocklist creates a blocklist backed by filePath; call Load to read it
+func NewBlocklist(filePath string) *Blocklist {
+	return &Blocklist{
+		names:    make(map[string]bool),
+		filePath: filePath,
+	}
+}
+
+// Load reads the blocklist file, replacing the current entries. A missing
+// file means nothing is blocked.
+func (bl *Blocklist) Load() error {
+	info, err := os.Stat(bl.filePath)
+	if os.IsNotExist(err) {
+		bl.replace(make(map[string]bool), nil, time.Time{})
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(bl.filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	names := make(map[string]bool)
+	var patterns []string
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		entry := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+
+		if strings.ContainsAny(entry, "*?[") {
+			// Reject malformed patterns up front rather than on every lookup
+			if _, err := path.Match(entry, ""); err != nil {
+				return fmt.Errorf("invalid blocklist pattern %q: %w", entry, err)
+			}
+			patterns = append(patterns, entry)
+			continue
+		}
+		names[entry] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	bl.replace(names, patterns, info.ModTime())
+	return nil
+}
+
+// replace swaps in a freshly loaded set of entries
+func (bl *Blocklist) replace(names map[string]bool, patterns []string, modTime time.Time) {
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+	bl.names = names
+	bl.patterns = patterns
+	bl.modTime = modTime
+}
+
+// Blocked reports whether a shortcut matches the blocklist
+func (bl *Blocklist) Blocked(shortcut string) bool {
+	shortcut = strings.ToLower(shortcut)
+
+	bl.mu.RLock()
+	defer bl.mu.RUnlock()
+
+	if bl.names[shortcut] {
+		return true
+	}
+	for _, pattern := range bl.patterns {
+		if matched, _ := path.Match(pattern, shortcut); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// ReloadIfChanged reloads the blocklist when the file has changed, so
+// edits apply to existing links without a restart
+func (bl *Blocklist) ReloadIfChanged() error {
+	info, err := os.Stat(bl.filePath)
+
+	bl.mu.RLock()
+	modTime := bl.modTime
+	bl.mu.RUnlock()
+
+	switch {
+	case err == nil && info.ModTime().Equal(modTime):
+		return nil
+	case err != nil && !os.IsNotExist(err):
+		return fmt.Errorf("checking blocklist file: %w", err)
+	case os.IsNotExist(err) && modTime.IsZero():
+		return nil
+	}
+
+	if err := bl.Load(); err != nil {
+		// Keep the old entries and don't retry until the file changes again
+		bl.mu.Lock()
+		bl.modTime = info.ModTime()
+		bl.mu.Unlock()
+		return fmt.Errorf("reloading blocklist: %w", err)
+	}
+	log.Printf("Reloaded blocklist from %s", bl.filePath)
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBlocklist(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "blocklist.txt")
+	bl := NewBlocklist(file)
+	if err := bl.Load(); err != nil || bl.Blocked("admin") {
+		t.Fatalf("missing file: %v, blocks admin %v, want nothing blocked", err, bl.Blocked("admin"))
+	}
+
+	os.WriteFile(file, []byte(`# reserved
+Admin
+login
+admin/*
+tmp-*
+`), 0644)
+	if err := bl.Load(); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		shortcut string
+		want     bool
+	}{
+		{"admin", true},
+		{"ADMIN", true},
+		{"login", true},
+		{"logins", false},
+		{"admin/users", true},
+		{"admin/users/new", false},
+		{"administrator", false},
+		{"tmp-test", true},
+		{"tmp", false},
+		{"# reserved", false},
+	} {
+		if got := bl.Blocked(tc.shortcut); got != tc.want {
+			t.Errorf("Blocked(%q) = %v, want %v", tc.shortcut, got, tc.want)
+		}
+	}
+
+	// Edits are picked up, and a broken file keeps the entries before it
+	changed := func(data string, at time.Time) error {
+		os.WriteFile(file, []byte(data), 0644)
+		os.Chtimes(file, at, at)
+		return bl.ReloadIfChanged()
+	}
+	now := time.Now()
+	if err := changed("wiki\n", now.Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if !bl.Blocked("wiki") || bl.Blocked("admin") {
+		t.Errorf("after reloading: wiki %v, admin %v, want only wiki blocked", bl.Blocked("wiki"), bl.Blocked("admin"))
+	}
+	if err := changed("wiki\n[bad\n", now.Add(2*time.Second)); err == nil {
+		t.Error("reloading a malformed pattern succeeded")
+	}
+	if !bl.Blocked("wiki") {
+		t.Error("a failed reload dropped the entries before it")
+	}
+	if err := bl.ReloadIfChanged(); err != nil {
+		t.Errorf("reloading the unchanged broken file again: %v", err)
+	}
+	os.Remove(file)
+	if err := bl.ReloadIfChanged(); err != nil || bl.Blocked("wiki") {
+		t.Errorf("after removing the file: %v, wiki blocked %v, want nothing blocked", err, bl.Blocked("wiki"))
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// parseTags splits a comma-separated tag list, lowercasing and dropping
+// duplicates
+func parseTags(value string) []string {
+	var tags []string
+	for _, tag := range splitList(value) {
+		tag = strings.ToLower(tag)
+		if !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// bulkResult reports what a bulk action did
+type bulkResult struct {
+	Updated   int      `json:"updated"`
+	Conflicts []string `json:"conflicts,omitempty"`
+	Forbidden []string `json:"forbidden,omitempty"` // links the user may not change
+}
+
+// handleBulk serves POST /api/links/bulk, applying one action to several
+// links in the request's namespace. The form lists the links as repeated
+// "shortcut" fields, and "action" is one of:
+//
+//   - delete: remove the links
+//   - tag: add the comma-separated tags in "value"
+//   - untag: remove the comma-separated tags in "value"
+//   - owner: set the owner to "value"
+//   - move: move the links to the namespace in "value"
+func (s *Server) handleBulk(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	shortcuts := r.PostForm["shortcut"]
+	if len(shortcuts) == 0 {
+		http.Error(w, "No links selected", http.StatusBadRequest)
+		return
+	}
+
+	namespace := s.hosts.Namespace(r)
+	value := strings.TrimSpace(r.PostFormValue("value"))
+
+	// Leave out links the user may not change (or move where they're
+	// going), reporting them instead
+	var result bulkResult
+	move := r.PostFormValue("action") == "move"
+	shortcuts = slices.DeleteFunc(slices.Clone(shortcuts), func(shortcut string) bool {
+		link, exists := s.store.Get(namespace, shortcut)
+		if exists && (!s.mayChange(r, link) || (move && !s.mayAdd(r, value, shortcut))) {
+			result.Forbidden = append(result.Forbidden, shortcut)
+			return true
+		}
+		return false
+	})
+
+	before := make(map[string]Link, len(shortcuts))
+	for _, shortcut := range shortcuts {
+		if link, exists := s.store.Get(namespace, shortcut); exists {
+			before[shortcut] = link
+		}
+	}
+
+	span := startSpan(r, "LinkStore.Bulk",
+		attribute.String("golinks.namespace", namespace),
+		attribute.String("golinks.action", r.PostFormValue("action")),
+		attribute.Int("golinks.links", len(shortcuts)))
+	defer span.End()
+
+	var err error
+	switch r.PostFormValue("action") {
+	case "delete":
+		result.Updated, err = s.store.DeleteMany(namespace, shortcuts)
+	case "tag", "untag":
+		tags := parseTags(value)
+		if len(tags) == 0 {
+			http.Error(w, "Tags are required", http.StatusBadRequest)
+			return
+		}
+		remove := r.PostFormValue("action") == "untag"
+		result.Updated, err = s.store.UpdateMany(namespace, shortcuts, func(link Link) Link {
+			if remove {
+				link.Tags = slices.DeleteFunc(slices.Clone(link.Tags), func(tag string) bool {
+					return slices.Contains(tags, tag)
+				})
+			} else {
+				link.Tags = parseTags(strings.Join(append(slices.Clone(link.Tags), tags...), ","))
+			}
+			return link
+		})
+	case "owner":
+		result.Updated, err = s.store.UpdateMany(namespace, shortcuts, func(link Link) Link {
+			link.Owner = value
+			return link
+		})
+	case "move":
+		result.Updated, result.Conflicts, err = s.store.Move(namespace, shortcuts, value)
+	default:
+		http.Error(w, "Unknown action", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to save links", http.StatusInternalServerError)
+		return
+	}
+	s.auditBulk(r, namespace, value, shortcuts, before, move)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// auditBulk records what a bulk action did to each link, given the links
+// as they were before it. Links left in place by a move, because their
+// shortcut was taken, weren't changed.
+func (s *Server) auditBulk(r *http.Request, namespace, value string, shortcuts []string, before map[string]Link, move bool) {
+	var entries []AuditEntry
+	for _, shortcut := range shortcuts {
+		old, existed := before[shortcut]
+		if !existed {
+			continue
+		}
+		after := auditLink(s.store.Get(namespace, shortcut))
+		if move {
+			if after != nil {
+				continue
+			}
+			after = auditLink(s.store.Get(value, shortcut))
+		}
+		entries = append(entries, s.linkEntry(r, auditLink(old, true), after))
+	}
+	s.record(entries...)
+}
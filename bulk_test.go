@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func bulkRequest(s *Server, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/api/links/bulk", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	s.handleBulk(w, req)
+	return w
+}
+
+func TestBulkActions(t *testing.T) {
+	s := newTestServer(t,
+		Link{Shortcut: "a", URL: "https://a.example.com", Tags: []string{"old"}},
+		Link{Shortcut: "b", URL: "https://b.example.com"},
+		Link{Shortcut: "c", URL: "https://c.example.com"},
+		Link{Shortcut: "b", URL: "https://other.example.com", Namespace: "wiki"},
+	)
+
+	if w := bulkRequest(s, "action=tag&value=Eng,+old&shortcut=a&shortcut=b"); w.Code != 200 {
+		t.Fatalf("tag: status %d: %s", w.Code, w.Body)
+	}
+	a, _ := s.store.Get("", "a")
+	if !slices.Equal(a.Tags, []string{"old", "eng"}) || len(a.History) != 1 {
+		t.Errorf("after tagging, a = %+v", a)
+	}
+
+	bulkRequest(s, "action=owner&value=platform&shortcut=a&shortcut=c&shortcut=missing")
+	if c, _ := s.store.Get("", "c"); c.Owner != "platform" {
+		t.Errorf("owner of c = %q, want platform", c.Owner)
+	}
+
+	w := bulkRequest(s, "action=move&value=wiki&shortcut=a&shortcut=b")
+	if !strings.Contains(w.Body.String(), `"conflicts":["b"]`) {
+		t.Errorf("move: %s", w.Body)
+	}
+	if _, ok := s.store.Get("wiki", "a"); !ok {
+		t.Errorf("a was not moved to wiki")
+	}
+	if b, _ := s.store.Get("wiki", "b"); b.URL != "https://other.example.com" {
+		t.Errorf("move overwrote wiki/b: %+v", b)
+	}
+
+	bulkRequest(s, "action=delete&shortcut=b&shortcut=c")
+	if links := s.store.GetAll(""); len(links) != 0 {
+		t.Errorf("links left after delete: %v", links)
+	}
+
+	if w := bulkRequest(s, "action=explode&shortcut=a"); w.Code != 400 {
+		t.Errorf("unknown action: status %d, want 400", w.Code)
+	}
+}
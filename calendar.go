@@ -0,0 +1,432 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// calendarRefresh is how long a calendar feed is used before it's fetched
+// again
+const calendarRefresh = 5 * time.Minute
+
+// maxCalendarBytes caps the size of a calendar feed
+const maxCalendarBytes = 10 << 20
+
+// meetingHosts are video-call services whose links in an event's location
+// or description are preferred over other links there
+var meetingHosts = []string{
+	"meet.google.com", "zoom.us", "teams.microsoft.com", "teams.live.com",
+	"webex.com", "whereby.com", "chime.aws", "meet.jit.si",
+}
+
+// Calendars resolves links to the video call of an upcoming event, such as
+// go/next-standup, from ICS calendar feeds like a Google Calendar's secret
+// iCal address. Feeds are fetched when needed and kept for a few minutes.
+type Calendars struct {
+	feeds  map[string]string // name → feed URL
+	client *http.Client
+
+	mu     sync.Mutex
+	events map[string][]calendarEvent
+	loaded map[string]time.Time
+}
+
+// NewCalendars parses a comma-separated list of name=URL calendar feeds,
+// or returns nil when there are none. webcal:// URLs are fetched over
+// HTTPS.
+func NewCalendars(config string) (*Calendars, error) {
+	entries := splitList(config)
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	c := &Calendars{
+		feeds:  make(map[string]string),
+		client: &http.Client{Timeout: 10 * time.Second},
+		events: make(map[string][]calendarEvent),
+		loaded: make(map[string]time.Time),
+	}
+	for _, entry := range entries {
+		name, feed, ok := strings.Cut(entry, "=")
+		name, feed = strings.TrimSpace(name), strings.TrimSpace(feed)
+		if !ok || name == "" || feed == "" {
+			return nil, fmt.Errorf("calendar %q must be name=URL", entry)
+		}
+		if rest, ok := strings.CutPrefix(feed, "webcal://"); ok {
+			feed = "https://" + rest
+		}
+		if u, err := url.Parse(feed); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return nil, fmt.Errorf("calendar %q must be an http, https or webcal URL", name)
+		}
+		c.feeds[name] = feed
+	}
+	return c, nil
+}
+
+// parseEvent splits a link's calendar setting, "name: text to match", into
+// the calendar and the text event titles must contain. The calendar's name
+// can be left out when there's only one.
+func (c *Calendars) parseEvent(setting string) (name, match string, err error) {
+	name, match, ok := strings.Cut(setting, ":")
+	if !ok && len(c.feeds) == 1 {
+		for only := range c.feeds {
+			name, match = only, setting
+		}
+	}
+	name, match = strings.TrimSpace(name), strings.TrimSpace(match)
+	if _, known := c.feeds[name]; !known {
+		return "", "", fmt.Errorf("unknown calendar %q, write it as calendar: event title", name)
+	}
+	if match == "" {
+		return "", "", fmt.Errorf("say which events to follow, such as %s: Standup", name)
+	}
+	return name, match, nil
+}
+
+// Destination returns the video-call link of the event in progress or next
+// to start whose title contains the setting's text, or "" when there is
+// none or the calendar can't be read
+func (c *Calendars) Destination(setting string, now time.Time) string {
+	if c == nil {
+		return ""
+	}
+	name, match, err := c.parseEvent(setting)
+	if err != nil {
+		return ""
+	}
+	events, err := c.load(name, now)
+	if err != nil {
+		log.Printf("Warning: Could not read calendar %q: %v", name, err)
+	}
+	event, ok := nextEvent(events, match, now)
+	if !ok {
+		return ""
+	}
+	return event.Meeting
+}
+
+// load returns the calendar's events, fetching them again once they're
+// older than calendarRefresh. If it can't be fetched, the events it had
+// are returned with the error.
+func (c *Calendars) load(name string, now time.Time) ([]calendarEvent, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if now.Sub(c.loaded[name]) < calendarRefresh {
+		return c.events[name], nil
+	}
+
+	resp, err := c.client.Get(c.feeds[name])
+	if err != nil {
+		return c.events[name], err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return c.events[name], fmt.Errorf("feed returned %s", resp.Status)
+	}
+	events, err := parseICS(io.LimitReader(resp.Body, maxCalendarBytes))
+	if err != nil {
+		return c.events[name], err
+	}
+	c.events[name], c.loaded[name] = events, now
+	return events, nil
+}
+
+// calendarEvent is an event in a calendar feed, possibly recurring
+type calendarEvent struct {
+	Summary string
+	Start   time.Time
+	End     time.Time
+	Meeting string // the video-call link, or "" if it has none
+	Rule    *recurrence
+	Except  []time.Time // occurrences left out of the recurrence
+}
+
+// recurrence is the subset of an RRULE followed: daily, weekly on given
+// days, and monthly on the same day, every so many, until a time or for a
+// number of occurrences
+type recurrence struct {
+	Freq     string
+	Interval int
+	Days     []time.Weekday
+	Until    time.Time
+	Count    int
+}
+
+// icsDays maps RRULE BYDAY codes to weekdays
+var icsDays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+// parseICS reads the events of an iCalendar feed. Events it can't make
+// sense of, such as ones without a start, are left out.
+func parseICS(r io.Reader) ([]calendarEvent, error) {
+	// Long lines are folded onto lines starting with a space or tab
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxCalendarBytes)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	var events []calendarEvent
+	var event *calendarEvent
+	var props map[string]string
+	var duration time.Duration
+	for _, line := range lines {
+		head, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		name, params, _ := strings.Cut(head, ";")
+		switch {
+		case line == "BEGIN:VEVENT":
+			event, props, duration = &calendarEvent{}, make(map[string]string), 0
+		case event == nil:
+		case line == "END:VEVENT":
+			if !event.Start.IsZero() {
+				switch {
+				case !event.End.IsZero():
+				case duration > 0:
+					event.End = event.Start.Add(duration)
+				case strings.Contains(props["DTSTART"], "VALUE=DATE"):
+					event.End = event.Start.AddDate(0, 0, 1)
+				default:
+					event.End = event.Start.Add(time.Hour)
+				}
+				event.Meeting = meetingLink(props)
+				events = append(events, *event)
+			}
+			event = nil
+		case name == "SUMMARY":
+			event.Summary = icsText(value)
+		case name == "DTSTART":
+			event.Start, _ = icsTime(params, value)
+			props[name] = params
+		case name == "DTEND":
+			event.End, _ = icsTime(params, value)
+		case name == "DURATION":
+			duration = icsDuration(value)
+		case name == "RRULE":
+			event.Rule = parseRecurrence(value)
+		case name == "EXDATE":
+			for _, v := range strings.Split(value, ",") {
+				if t, err := icsTime(params, v); err == nil {
+					event.Except = append(event.Except, t)
+				}
+			}
+		default:
+			props[name] = icsText(value)
+		}
+	}
+	return events, nil
+}
+
+// icsText unescapes an iCalendar text value
+func icsText(value string) string {
+	return strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(value)
+}
+
+// icsTime parses an iCalendar date or time: UTC with a Z, in the zone its
+// TZID parameter names, or a date for all-day events
+func icsTime(params, value string) (time.Time, error) {
+	loc := time.UTC
+	for _, param := range strings.Split(params, ";") {
+		if tzid, ok := strings.CutPrefix(param, "TZID="); ok {
+			if l, err := time.LoadLocation(strings.Trim(tzid, `"`)); err == nil {
+				loc = l
+			}
+		}
+	}
+	value = strings.TrimSpace(value)
+	switch {
+	case strings.HasSuffix(value, "Z"):
+		return time.Parse("20060102T150405Z", value)
+	case len(value) == len("20060102"):
+		return time.ParseInLocation("20060102", value, loc)
+	default:
+		return time.ParseInLocation("20060102T150405", value, loc)
+	}
+}
+
+// icsDuration parses an iCalendar duration such as PT30M or P1D
+func icsDuration(value string) time.Duration {
+	var d time.Duration
+	n := 0
+	for _, c := range strings.TrimPrefix(value, "P") {
+		switch {
+		case c >= '0' && c <= '9':
+			n = n*10 + int(c-'0')
+			continue
+		case c == 'W':
+			d += time.Duration(n) * 7 * 24 * time.Hour
+		case c == 'D':
+			d += time.Duration(n) * 24 * time.Hour
+		case c == 'H':
+			d += time.Duration(n) * time.Hour
+		case c == 'M':
+			d += time.Duration(n) * time.Minute
+		case c == 'S':
+			d += time.Duration(n) * time.Second
+		}
+		n = 0
+	}
+	return d
+}
+
+// parseRecurrence parses an RRULE, or returns nil for one it doesn't follow
+func parseRecurrence(value string) *recurrence {
+	rule := &recurrence{Interval: 1}
+	for _, part := range strings.Split(value, ";") {
+		key, v, _ := strings.Cut(part, "=")
+		switch key {
+		case "FREQ":
+			rule.Freq = v
+		case "INTERVAL":
+			if n, err := strconv.Atoi(v); err == nil && n > 0 {
+				rule.Interval = n
+			}
+		case "COUNT":
+			rule.Count, _ = strconv.Atoi(v)
+		case "UNTIL":
+			rule.Until, _ = icsTime("", v)
+		case "BYDAY":
+			for _, day := range strings.Split(v, ",") {
+				if weekday, ok := icsDays[day]; ok {
+					rule.Days = append(rule.Days, weekday)
+				}
+			}
+		}
+	}
+	if rule.Freq != "DAILY" && rule.Freq != "WEEKLY" && rule.Freq != "MONTHLY" {
+		return nil
+	}
+	return rule
+}
+
+// occurs reports whether the rule has an occurrence on day, given the
+// midnight starting the first one's day. Both are midnight in the event's
+// time zone, so days are rounded to allow for daylight saving time.
+func (rule *recurrence) occurs(first, day time.Time) bool {
+	days := int(day.Sub(first).Hours()+12) / 24
+	switch rule.Freq {
+	case "DAILY":
+		return days%rule.Interval == 0
+	case "WEEKLY":
+		weekdays := rule.Days
+		if len(weekdays) == 0 {
+			weekdays = []time.Weekday{first.Weekday()}
+		}
+		// Weeks start on Monday
+		weeks := (days + (int(first.Weekday())+6)%7) / 7
+		return weeks%rule.Interval == 0 && slices.Contains(weekdays, day.Weekday())
+	default:
+		months := (day.Year()-first.Year())*12 + int(day.Month()-first.Month())
+		return day.Day() == first.Day() && months%rule.Interval == 0
+	}
+}
+
+// nextEvent returns the occurrence of an event whose title contains match
+// that is in progress at now or starts soonest after it
+func nextEvent(events []calendarEvent, match string, now time.Time) (calendarEvent, bool) {
+	match = strings.ToLower(match)
+	var next calendarEvent
+	found := false
+	for _, event := range events {
+		if !strings.Contains(strings.ToLower(event.Summary), match) {
+			continue
+		}
+		if occurrence, ok := event.next(now); ok && (!found || occurrence.Start.Before(next.Start)) {
+			next, found = occurrence, true
+		}
+	}
+	return next, found
+}
+
+// next returns the event's occurrence in progress at now or next to start,
+// looking up to a year ahead
+func (event calendarEvent) next(now time.Time) (calendarEvent, bool) {
+	if event.Rule == nil {
+		return event, event.End.After(now)
+	}
+	length := event.End.Sub(event.Start)
+	loc := event.Start.Location()
+	first := time.Date(event.Start.Year(), event.Start.Month(), event.Start.Day(), 0, 0, 0, 0, loc)
+
+	// Counting occurrences means starting from the first; otherwise start
+	// from the day before now, to include one that's still in progress
+	day := first
+	if event.Rule.Count == 0 {
+		if from := now.In(loc).Add(-length).AddDate(0, 0, -1); from.After(first) {
+			day = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, loc)
+		}
+	}
+	count := 0
+	for end := now.AddDate(1, 0, 0); day.Before(end); day = day.AddDate(0, 0, 1) {
+		if !event.Rule.occurs(first, day) {
+			continue
+		}
+		start := time.Date(day.Year(), day.Month(), day.Day(), event.Start.Hour(), event.Start.Minute(), event.Start.Second(), 0, loc)
+		if !event.Rule.Until.IsZero() && start.After(event.Rule.Until) {
+			break
+		}
+		if count++; event.Rule.Count > 0 && count > event.Rule.Count {
+			break
+		}
+		if slices.ContainsFunc(event.Except, start.Equal) {
+			continue
+		}
+		if start.Add(length).After(now) {
+			occurrence := event
+			occurrence.Start, occurrence.End = start, start.Add(length)
+			return occurrence, true
+		}
+	}
+	return calendarEvent{}, false
+}
+
+// meetingLink finds an event's video-call link: Google Calendar's
+// conference link, else a link to a known video-call service in its
+// location, description or URL, else any web link in its location or URL
+func meetingLink(props map[string]string) string {
+	if link := props["X-GOOGLE-CONFERENCE"]; link != "" {
+		return link
+	}
+	var links []string
+	for _, name := range []string{"LOCATION", "DESCRIPTION", "URL"} {
+		for _, word := range strings.FieldsFunc(props[name], func(c rune) bool {
+			return c == ' ' || c == '\n' || c == '<' || c == '>' || c == '"' || c == '(' || c == ')'
+		}) {
+			if strings.HasPrefix(word, "https://") || strings.HasPrefix(word, "http://") {
+				links = append(links, word)
+				for _, host := range meetingHosts {
+					if u, err := url.Parse(word); err == nil && (u.Hostname() == host || strings.HasSuffix(u.Hostname(), "."+host)) {
+						return word
+					}
+				}
+			}
+		}
+	}
+	for _, link := range links {
+		if !strings.Contains(props["DESCRIPTION"], link) {
+			return link
+		}
+	}
+	return ""
+}
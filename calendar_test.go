@@ -0,0 +1,168 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testCalendar = `BEGIN:VCALENDAR
+VERSION:2.0
+BEGIN:VEVENT
+SUMMARY:Team Standup
+DTSTART;TZID=Europe/Paris:20260105T093000
+DTEND;TZID=Europe/Paris:20260105T094500
+RRULE:FREQ=WEEKLY;BYDAY=MO,WE,FR
+EXDATE;TZID=Europe/Paris:20261019T093000
+X-GOOGLE-CONFERENCE:https://meet.google.com/abc-defg-hij
+END:VEVENT
+BEGIN:VEVENT
+SUMMARY:Planning
+DTSTART:20261020T130000Z
+DURATION:PT1H
+LOCATION:Room 4
+DESCRIPTION:Agenda at https://docs.example.com/plan\nJoin: https://example.zoom.us/j/123
+ ?pwd=x
+END:VEVENT
+BEGIN:VEVENT
+SUMMARY:Planning
+DTSTART:20261001T130000Z
+DTEND:20261001T140000Z
+LOCATION:https://meet.jit.si/old
+END:VEVENT
+END:VCALENDAR
+`
+
+func TestParseICS(t *testing.T) {
+	events, err := parseICS(strings.NewReader(strings.ReplaceAll(testCalendar, "\n", "\r\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("got %d events, want 3", len(events))
+	}
+	standup := events[0]
+	if standup.Summary != "Team Standup" || standup.Start.Location().String() != "Europe/Paris" || standup.End.Sub(standup.Start) != 15*time.Minute {
+		t.Errorf("standup = %+v", standup)
+	}
+	if standup.Rule == nil || standup.Rule.Freq != "WEEKLY" || len(standup.Rule.Days) != 3 || len(standup.Except) != 1 {
+		t.Errorf("standup recurrence = %+v, except %v", standup.Rule, standup.Except)
+	}
+	if events[1].End.Sub(events[1].Start) != time.Hour {
+		t.Errorf("planning lasts %v, want an hour", events[1].End.Sub(events[1].Start))
+	}
+	// A known video-call service wins over other links, and folded lines
+	// are joined
+	if want := "https://example.zoom.us/j/123?pwd=x"; events[1].Meeting != want {
+		t.Errorf("planning meeting = %q, want %q", events[1].Meeting, want)
+	}
+}
+
+func TestNextEvent(t *testing.T) {
+	events, _ := parseICS(strings.NewReader(testCalendar))
+	paris, _ := time.LoadLocation("Europe/Paris")
+
+	tests := []struct {
+		name  string
+		match string
+		now   time.Time
+		want  time.Time
+	}{
+		{"later that day", "standup", time.Date(2026, 10, 16, 8, 0, 0, 0, paris), time.Date(2026, 10, 16, 9, 30, 0, 0, paris)},
+		{"in progress", "standup", time.Date(2026, 10, 16, 9, 40, 0, 0, paris), time.Date(2026, 10, 16, 9, 30, 0, 0, paris)},
+		{"skips the weekend and exceptions", "standup", time.Date(2026, 10, 16, 10, 0, 0, 0, paris), time.Date(2026, 10, 21, 9, 30, 0, 0, paris)},
+		{"one-off events", "planning", time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC), time.Date(2026, 10, 20, 13, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, ok := nextEvent(events, tt.match, tt.now)
+			if !ok || !event.Start.Equal(tt.want) {
+				t.Errorf("next %q at %v = %v (%v), want %v", tt.match, tt.now, event.Start, ok, tt.want)
+			}
+		})
+	}
+	if event, ok := nextEvent(events, "retro", time.Now()); ok {
+		t.Errorf("found %+v for an event that isn't in the calendar", event)
+	}
+}
+
+func TestRecurrenceLimits(t *testing.T) {
+	start := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	event := calendarEvent{Start: start, End: start.Add(time.Hour), Rule: parseRecurrence("FREQ=DAILY;INTERVAL=2;COUNT=3")}
+	if next, ok := event.next(time.Date(2026, 1, 4, 12, 0, 0, 0, time.UTC)); !ok || next.Start.Day() != 5 {
+		t.Errorf("third occurrence = %v, %v, want January 5", next.Start, ok)
+	}
+	if _, ok := event.next(time.Date(2026, 1, 6, 0, 0, 0, 0, time.UTC)); ok {
+		t.Error("found an occurrence after COUNT ran out")
+	}
+
+	event.Rule = parseRecurrence("FREQ=MONTHLY;UNTIL=20260301T000000Z")
+	if next, ok := event.next(time.Date(2026, 1, 15, 0, 0, 0, 0, time.UTC)); !ok || next.Start.Month() != time.February {
+		t.Errorf("monthly occurrence = %v, %v, want February 1", next.Start, ok)
+	}
+	if _, ok := event.next(time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)); ok {
+		t.Error("found an occurrence after UNTIL")
+	}
+	if parseRecurrence("FREQ=YEARLY") != nil {
+		t.Error("yearly events should be left as one-off")
+	}
+}
+
+func TestCalendarLinks(t *testing.T) {
+	fetches := 0
+	feed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		w.Write([]byte(testCalendar))
+	}))
+	defer feed.Close()
+
+	if _, err := NewCalendars("team"); err == nil {
+		t.Error("a calendar without a URL was accepted")
+	}
+	if c, err := NewCalendars("team=webcal://calendar.example.com/team.ics"); err != nil || c.feeds["team"] != "https://calendar.example.com/team.ics" {
+		t.Errorf("webcal feed = %v, %v", c, err)
+	}
+
+	s := newTestServer(t, Link{Shortcut: "next-standup", URL: "https://wiki.example.com/standup", Calendar: "team: standup"})
+	link, _ := s.store.Get("", "next-standup")
+	if got := s.destinationFor(link, httptest.NewRequest("GET", "/next-standup", nil)); got != "https://wiki.example.com/standup" {
+		t.Errorf("without calendars, destination = %q", got)
+	}
+
+	s.calendars, _ = NewCalendars("team=" + feed.URL)
+	now := time.Date(2026, 10, 16, 7, 0, 0, 0, time.UTC)
+	if got := s.calendars.Destination("team: standup", now); got != "https://meet.google.com/abc-defg-hij" {
+		t.Errorf("destination = %q", got)
+	}
+	if got := s.calendars.Destination("standup", now); got != "https://meet.google.com/abc-defg-hij" {
+		t.Errorf("with the calendar left out, destination = %q", got)
+	}
+	if got := s.calendars.Destination("team: retro", now); got != "" {
+		t.Errorf("destination for no event = %q", got)
+	}
+	if fetches != 1 {
+		t.Errorf("feed fetched %d times, want once", fetches)
+	}
+
+	form := url.Values{"url": {"https://wiki.example.com"}, "calendar": {"other: standup"}}
+	if _, err := s.linkFromFields(form.Get, "", "x"); err == nil || !strings.Contains(err.Error(), "unknown calendar") {
+		t.Errorf("unknown calendar: error %v", err)
+	}
+	form.Set("calendar", "team:")
+	if _, err := s.linkFromFields(form.Get, "", "x"); err == nil {
+		t.Error("a calendar without an event title was accepted")
+	}
+	form.Set("calendar", "team: Standup")
+	if link, err := s.linkFromFields(form.Get, "", "x"); err != nil || link.Calendar != "team: Standup" {
+		t.Errorf("link = %+v, %v", link, err)
+	}
+
+	w := httptest.NewRecorder()
+	s.setRedirectCaching(w, Link{Calendar: "team: standup"})
+	if got := w.Header().Get("Cache-Control"); got != "no-store" {
+		t.Errorf("Cache-Control = %q, want no-store", got)
+	}
+}
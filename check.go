@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// runChecks sets go-links up for the data at dataPath as serving would, for
+// go-links -check, writing a line to w for each step: settings, the data
+// directory, the data files and templates, and everything else the server
+// would otherwise only find wrong when starting. Identity providers are
+// contacted as they would be at startup; nothing is created or started, and
+// listening addresses are only parsed, as they may be in use by the running
+// server. It reports whether every step passed, so deployment pipelines can
+// stop a broken configuration from rolling out.
+func runChecks(w io.Writer, dataPath string) bool {
+	passed := true
+	buildComponents(dataPath, true, func(step, detail string, err error, _ bool) {
+		status := "ok  "
+		if err != nil {
+			status, detail, passed = "FAIL", err.Error(), false
+		}
+		if detail != "" {
+			detail = ": " + detail
+		}
+		fmt.Fprintf(w, "%s %s%s\n", status, step, detail)
+	})
+	if passed {
+		fmt.Fprintln(w, "All checks passed")
+	} else {
+		fmt.Fprintln(w, "Some checks failed")
+	}
+	return passed
+}
+
+// checkWritable makes sure files can be written in dir, or in the nearest
+// directory above it when the server would create it, without creating or
+// writing anything
+func checkWritable(dir string) error {
+	for {
+		info, err := os.Stat(dir)
+		if err == nil && !info.IsDir() {
+			return fmt.Errorf("%s is not a directory", dir)
+		}
+		if err == nil {
+			return canWrite(dir)
+		}
+		if !os.IsNotExist(err) || dir == filepath.Dir(dir) {
+			return err
+		}
+		dir = filepath.Dir(dir)
+	}
+}
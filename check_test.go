@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunChecks(t *testing.T) {
+	dir := t.TempDir()
+	dataPath := filepath.Join(dir, "links.json")
+	os.WriteFile(dataPath, []byte(`[{"shortcut":"wiki","url":"https://wiki.example.com"}]`), 0644)
+
+	repo := filepath.Join(dir, "repo")
+	t.Setenv("GOLINKS_GIT_REPO", repo)
+
+	var report strings.Builder
+	if !runChecks(&report, dataPath) {
+		t.Fatalf("checks failed on a working setup:\n%s", report.String())
+	}
+	if !strings.Contains(report.String(), "ok   data files: 1 links") {
+		t.Errorf("report doesn't count the links:\n%s", report.String())
+	}
+	// Checking sets up what serving would without creating anything
+	for _, path := range []string{repo, filepath.Join(dir, "audit.jsonl")} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("checking created %s", path)
+		}
+	}
+
+	// Every problem is reported, not just the first
+	os.WriteFile(filepath.Join(dir, "stars.json"), []byte("{not json"), 0644)
+	templateDir := t.TempDir()
+	os.WriteFile(filepath.Join(templateDir, "notfound.html"), []byte(`{{define "notfound"}}{{.Missing`), 0644)
+	t.Setenv("GOLINKS_TEMPLATE_DIR", templateDir)
+	t.Setenv("GOLINKS_SHUTDOWN_TIMEOUT", "soon")
+	report.Reset()
+	if runChecks(&report, dataPath) {
+		t.Fatalf("checks passed with broken data, templates and settings:\n%s", report.String())
+	}
+	for _, want := range []string{"FAIL data files: loading stars.json", "FAIL templates", "FAIL server: shutdown timeout", "ok   settings", "Some checks failed"} {
+		if !strings.Contains(report.String(), want) {
+			t.Errorf("report doesn't say %q:\n%s", want, report.String())
+		}
+	}
+}
+
+func TestCheckWritable(t *testing.T) {
+	dir := t.TempDir()
+	missing := filepath.Join(dir, "data", "links")
+	if err := checkWritable(missing); err != nil {
+		t.Errorf("a directory the server would create: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "data")); !os.IsNotExist(err) {
+		t.Error("checking created the directory")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) > 0 {
+		t.Errorf("checking left %v behind", entries)
+	}
+
+	file := filepath.Join(dir, "links.json")
+	os.WriteFile(file, nil, 0644)
+	if err := checkWritable(filepath.Join(file, "data")); err == nil {
+		t.Error("a directory under a file passed")
+	}
+}
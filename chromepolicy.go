@@ -0,0 +1,74 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"io"
+	"slices"
+)
+
+// chromeBookmark is an entry of Chrome's ManagedBookmarks policy: the
+// folder's name first, then bookmarks, or folders of them
+type chromeBookmark struct {
+	TopLevelName string           `json:"toplevel_name,omitempty"`
+	Name         string           `json:"name,omitempty"`
+	URL          string           `json:"url,omitempty"`
+	Children     []chromeBookmark `json:"children,omitempty"`
+}
+
+// chromeBookmarks returns the ManagedBookmarks policy for links, in a
+// folder named folder. Links in several namespaces are put in a subfolder
+// for each. Bookmarks go to the go link itself, e.g. http://go/gh, so they
+// follow changes to it, unless destinations is set.
+func chromeBookmarks(hosts *HostMap, links []Link, folder string, destinations bool) []chromeBookmark {
+	slices.SortFunc(links, func(a, b Link) int {
+		return cmp.Or(cmp.Compare(a.Namespace, b.Namespace), cmp.Compare(a.Shortcut, b.Shortcut))
+	})
+	bookmarks := []chromeBookmark{{TopLevelName: folder}}
+	var namespaces []string
+	byNamespace := make(map[string][]chromeBookmark)
+	for _, link := range links {
+		name := hosts.PrefixFor(link.Namespace) + "/" + link.Shortcut
+		bookmark := chromeBookmark{Name: name, URL: "http://" + name}
+		if link.Description != "" {
+			bookmark.Name = link.Description + " (" + name + ")"
+		}
+		if destinations {
+			bookmark.URL = link.URL
+		}
+		if _, seen := byNamespace[link.Namespace]; !seen {
+			namespaces = append(namespaces, link.Namespace)
+		}
+		byNamespace[link.Namespace] = append(byNamespace[link.Namespace], bookmark)
+	}
+	if len(namespaces) == 1 {
+		return append(bookmarks, byNamespace[namespaces[0]]...)
+	}
+	for _, namespace := range namespaces {
+		bookmarks = append(bookmarks, chromeBookmark{Name: hosts.PrefixFor(namespace) + "/", Children: byNamespace[namespace]})
+	}
+	return bookmarks
+}
+
+// writeChromePolicy writes links as a Chrome policy file setting
+// ManagedBookmarks, as read from /etc/opt/chrome/policies/managed on Linux.
+// Only links anyone may see and follow are included, since the bookmarks
+// go to every managed browser, and with tags only links with one of them.
+func (s *Server) writeChromePolicy(w io.Writer, links []Link, tags []string, folder string, destinations bool) error {
+	var included []Link
+	for _, link := range links {
+		if link.Hidden || len(link.VisibleTo) > 0 || !link.ArchivedAt.IsZero() || s.blocklist.Blocked(link.Shortcut) {
+			continue
+		}
+		if len(tags) > 0 && !slices.ContainsFunc(link.Tags, func(tag string) bool { return slices.Contains(tags, tag) }) {
+			continue
+		}
+		included = append(included, link)
+	}
+	policy := map[string][]chromeBookmark{
+		"ManagedBookmarks": chromeBookmarks(s.hosts, included, cmp.Or(folder, "Go links"), destinations),
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(policy)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestChromePolicyExport(t *testing.T) {
+	s := newTestServer(t,
+		Link{Shortcut: "gh", URL: "https://github.com", Description: "Our code", Tags: []string{"eng"}},
+		Link{Shortcut: "hr", URL: "https://hr.example.com", Tags: []string{"people"}},
+		Link{Shortcut: "secret", URL: "https://example.com/secret", Hidden: true},
+		Link{Shortcut: "pay", URL: "https://pay.example.com", VisibleTo: []string{"finance"}},
+		Link{Shortcut: "old", URL: "https://old.example.com", ArchivedAt: time.Now()},
+	)
+
+	export := func(query string) []chromeBookmark {
+		t.Helper()
+		w := httptest.NewRecorder()
+		s.handleExport(w, httptest.NewRequest("GET", "/api/export?format=chrome"+query, nil))
+		if w.Code != 200 {
+			t.Fatalf("status %d: %s", w.Code, w.Body.String())
+		}
+		var policy map[string][]chromeBookmark
+		if err := json.Unmarshal(w.Body.Bytes(), &policy); err != nil {
+			t.Fatal(err)
+		}
+		return policy["ManagedBookmarks"]
+	}
+
+	want := []chromeBookmark{
+		{TopLevelName: "Go links"},
+		{Name: "Our code (go/gh)", URL: "http://go/gh"},
+		{Name: "go/hr", URL: "http://go/hr"},
+	}
+	if got := export(""); !reflect.DeepEqual(got, want) {
+		t.Errorf("bookmarks = %+v, want %+v", got, want)
+	}
+
+	want = []chromeBookmark{
+		{TopLevelName: "Engineering"},
+		{Name: "Our code (go/gh)", URL: "https://github.com"},
+	}
+	if got := export("&tags=ENG&folder=Engineering&destinations=true"); !reflect.DeepEqual(got, want) {
+		t.Errorf("tagged bookmarks = %+v, want %+v", got, want)
+	}
+}
+
+func TestChromeBookmarksByNamespace(t *testing.T) {
+	hosts, _ := NewHostMap("go=,wiki")
+	got := chromeBookmarks(hosts, []Link{
+		{Namespace: "wiki", Shortcut: "onboarding", URL: "https://wiki.example.com"},
+		{Shortcut: "gh", URL: "https://github.com"},
+	}, "Links", false)
+	want := []chromeBookmark{
+		{TopLevelName: "Links"},
+		{Name: "go/", Children: []chromeBookmark{{Name: "go/gh", URL: "http://go/gh"}}},
+		{Name: "wiki/", Children: []chromeBookmark{{Name: "wiki/onboarding", URL: "http://wiki/onboarding"}}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("bookmarks = %+v, want %+v", got, want)
+	}
+}
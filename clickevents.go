@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Click events are queued and sent in batches of up to clickBatchSize, at
+// least every clickFlushInterval. When clickQueueSize events are waiting,
+// new ones are dropped rather than slowing redirects down.
+const (
+	clickQueueSize     = 10000
+	clickBatchSize     = 100
+	clickFlushInterval = time.Second
+)
+
+// ClickEvent describes one redirect, for external analytics
+type ClickEvent struct {
+	Time        time.Time `json:"time"`
+	Namespace   string    `json:"namespace,omitempty"`
+	Shortcut    string    `json:"shortcut"`
+	Destination string    `json:"destination"`
+	Referrer    string    `json:"referrer"` // summed up, see clickSource
+	Client      string    `json:"client"`
+	RequestID   string    `json:"request_id,omitempty"`
+}
+
+// ClickSink sends batches of click events somewhere
+type ClickSink interface {
+	Name() string
+	Send(ctx context.Context, events []ClickEvent) error
+}
+
+// ClickEvents sends click events to sinks in the background, so redirects
+// never wait for them
+type ClickEvents struct {
+	sinks   []ClickSink
+	queue   chan ClickEvent
+	done    chan struct{} // closed once the queue is drained after Close
+	mu      sync.Mutex
+	dropped int
+}
+
+// NewClickEvents starts sending click events to sinks, returning nil when
+// there are none
+func NewClickEvents(sinks ...ClickSink) *ClickEvents {
+	if len(sinks) == 0 {
+		return nil
+	}
+	ce := &ClickEvents{sinks: sinks, queue: make(chan ClickEvent, clickQueueSize), done: make(chan struct{})}
+	go ce.run()
+	return ce
+}
+
+// Publish queues an event to be sent, dropping it if the queue is full.
+// It is safe to call on a nil *ClickEvents.
+func (ce *ClickEvents) Publish(event ClickEvent) {
+	if ce == nil {
+		return
+	}
+	select {
+	case ce.queue <- event:
+	default:
+		ce.mu.Lock()
+		ce.dropped++
+		ce.mu.Unlock()
+	}
+}
+
+// run sends queued events in batches until the queue is closed
+func (ce *ClickEvents) run() {
+	defer close(ce.done)
+	ticker := time.NewTicker(clickFlushInterval)
+	defer ticker.Stop()
+	var batch []ClickEvent
+	for {
+		select {
+		case event, ok := <-ce.queue:
+			if !ok {
+				ce.send(batch)
+				return
+			}
+			batch = append(batch, event)
+			if len(batch) < clickBatchSize {
+				continue
+			}
+		case <-ticker.C:
+		}
+		ce.send(batch)
+		batch = nil
+	}
+}
+
+// send hands a batch to every sink, logging failures and any events
+// dropped since the last batch
+func (ce *ClickEvents) send(batch []ClickEvent) {
+	ce.mu.Lock()
+	dropped := ce.dropped
+	ce.dropped = 0
+	ce.mu.Unlock()
+	if dropped > 0 {
+		log.Printf("Warning: Dropped %d click events, the analytics queue was full", dropped)
+	}
+	if len(batch) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, sink := range ce.sinks {
+		if err := sink.Send(ctx, batch); err != nil {
+			log.Printf("Warning: Could not send %d click events to %s: %v", len(batch), sink.Name(), err)
+		}
+	}
+}
+
+// Close sends any queued events and stops. It is safe to call on a nil
+// *ClickEvents.
+func (ce *ClickEvents) Close() {
+	if ce == nil {
+		return
+	}
+	close(ce.queue)
+	<-ce.done
+}
+
+// publishClick queues a click event for a redirect, if events are exported
+// and the request may be tracked
+func (s *Server) publishClick(r *http.Request, link Link, destination string) {
+	if s.clickEvents == nil || !s.privacy.Tracks(r) {
+		return
+	}
+	source := newClickSource(r)
+	s.clickEvents.Publish(ClickEvent{
+		Time:        time.Now().UTC(),
+		Namespace:   link.Namespace,
+		Shortcut:    link.Shortcut,
+		Destination: destination,
+		Referrer:    source.Referrer,
+		Client:      source.Client,
+		RequestID:   requestID(r),
+	})
+}
+
+// webhookSink posts batches of events to an HTTP endpoint as a JSON array
+type webhookSink struct {
+	url    string
+	client *http.Client
+}
+
+func (ws *webhookSink) Name() string { return "webhook" }
+
+func (ws *webhookSink) Send(ctx context.Context, events []ClickEvent) error {
+	body, err := json.Marshal(events)
+	if err != nil {
+		return err
+	}
+	return postJSON(ctx, ws.client, ws.url, body)
+}
+
+// gaEndpoint is where Google Analytics 4 takes Measurement Protocol events
+const gaEndpoint = "https://www.google-analytics.com/mp/collect"
+
+// gaMaxEvents is how many events the Measurement Protocol takes at once
+const gaMaxEvents = 25
+
+// gaSink sends events to Google Analytics 4 with the Measurement Protocol,
+// as go_link_click events
+type gaSink struct {
+	endpoint string // with the measurement ID and API secret
+	client   *http.Client
+}
+
+func (gs *gaSink) Name() string { return "Google Analytics" }
+
+func (gs *gaSink) Send(ctx context.Context, events []ClickEvent) error {
+	type gaEvent struct {
+		Name   string            `json:"name"`
+		Params map[string]string `json:"params"`
+	}
+	// Without a stable client ID to hand, each batch counts as a visitor
+	payload := struct {
+		ClientID string    `json:"client_id"`
+		Events   []gaEvent `json:"events"`
+	}{ClientID: "go-links." + newRequestID()}
+	for len(events) > 0 {
+		n := min(len(events), gaMaxEvents)
+		payload.Events = payload.Events[:0]
+		for _, event := range events[:n] {
+			payload.Events = append(payload.Events, gaEvent{Name: "go_link_click", Params: map[string]string{
+				"shortcut":    event.Shortcut,
+				"namespace":   event.Namespace,
+				"destination": event.Destination,
+				"referrer":    event.Referrer,
+				"client":      event.Client,
+			}})
+		}
+		body, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		if err := postJSON(ctx, gs.client, gs.endpoint, body); err != nil {
+			return err
+		}
+		events = events[n:]
+	}
+	return nil
+}
+
+// postJSON posts body to url, failing on anything but a 2xx response
+func postJSON(ctx context.Context, client *http.Client, url string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s returned %s", req.URL.Host, resp.Status)
+	}
+	return nil
+}
+
+// kafkaSink writes events to a Kafka topic as JSON messages keyed by
+// shortcut, so each link's clicks stay in order
+type kafkaSink struct {
+	writer *kafka.Writer
+}
+
+func (ks *kafkaSink) Name() string { return "Kafka" }
+
+func (ks *kafkaSink) Send(ctx context.Context, events []ClickEvent) error {
+	messages := make([]kafka.Message, len(events))
+	for i, event := range events {
+		value, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		messages[i] = kafka.Message{Key: []byte(event.Namespace + ":" + event.Shortcut), Value: value, Time: event.Time}
+	}
+	return ks.writer.WriteMessages(ctx, messages...)
+}
+
+// ClickSinkConfig says where to export click events
+type ClickSinkConfig struct {
+	WebhookURL      string // POST batches of events here
+	GAMeasurementID string // send to Google Analytics 4...
+	GAAPISecret     string // ...with this Measurement Protocol secret
+	KafkaBrokers    string // comma-separated host:port list
+	KafkaTopic      string // default go-links.clicks
+}
+
+// NewClickSinks creates the click event sinks that are configured
+func NewClickSinks(config ClickSinkConfig) ([]ClickSink, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	var sinks []ClickSink
+
+	if config.WebhookURL != "" {
+		if u, err := url.Parse(config.WebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return nil, fmt.Errorf("webhook %q must be an http or https URL", config.WebhookURL)
+		}
+		sinks = append(sinks, &webhookSink{url: config.WebhookURL, client: client})
+	}
+
+	if (config.GAMeasurementID == "") != (config.GAAPISecret == "") {
+		return nil, fmt.Errorf("Google Analytics needs both a measurement ID and an API secret")
+	}
+	if config.GAMeasurementID != "" {
+		query := url.Values{"measurement_id": {config.GAMeasurementID}, "api_secret": {config.GAAPISecret}}
+		sinks = append(sinks, &gaSink{endpoint: gaEndpoint + "?" + query.Encode(), client: client})
+	}
+
+	if config.KafkaBrokers != "" {
+		topic := config.KafkaTopic
+		if topic == "" {
+			topic = "go-links.clicks"
+		}
+		brokers := splitList(config.KafkaBrokers)
+		for _, broker := range brokers {
+			if !strings.Contains(broker, ":") {
+				return nil, fmt.Errorf("Kafka broker %q needs a port", broker)
+			}
+		}
+		sinks = append(sinks, &kafkaSink{writer: &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			Topic:        topic,
+			Balancer:     &kafka.Hash{},
+			BatchSize:    clickBatchSize,
+			RequiredAcks: kafka.RequireOne,
+		}})
+	}
+	return sinks, nil
+}
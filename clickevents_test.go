@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// recordingSink collects the batches it is sent
+type recordingSink struct {
+	batches chan []ClickEvent
+}
+
+func (rs *recordingSink) Name() string { return "recorder" }
+
+func (rs *recordingSink) Send(ctx context.Context, events []ClickEvent) error {
+	rs.batches <- events
+	return nil
+}
+
+func TestClickEventsArePublished(t *testing.T) {
+	s := newTestServer(t, Link{Shortcut: "wiki", URL: "https://wiki.example.com"})
+	sink := &recordingSink{batches: make(chan []ClickEvent, 10)}
+	s.clickEvents = NewClickEvents(sink)
+	defer s.clickEvents.Close()
+
+	r := httptest.NewRequest("GET", "/wiki/Some_Page", nil)
+	r.Header.Set("Referer", "https://app.slack.com/client/T01")
+	s.handleHome(httptest.NewRecorder(), r)
+	prefetch := httptest.NewRequest("GET", "/wiki", nil)
+	prefetch.Header.Set("Sec-Purpose", "prefetch")
+	s.handleHome(httptest.NewRecorder(), prefetch)
+
+	select {
+	case batch := <-sink.batches:
+		if len(batch) != 1 {
+			t.Fatalf("batch = %+v, want just the click", batch)
+		}
+		if event := batch[0]; event.Shortcut != "wiki" || event.Destination != "https://wiki.example.com/Some_Page" || event.Referrer != "Slack" {
+			t.Errorf("event = %+v", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no events were sent")
+	}
+}
+
+func TestClickEventsDropWhenFull(t *testing.T) {
+	ce := &ClickEvents{queue: make(chan ClickEvent, 1)}
+	ce.Publish(ClickEvent{Shortcut: "a"})
+	ce.Publish(ClickEvent{Shortcut: "b"})
+	if ce.dropped != 1 || len(ce.queue) != 1 {
+		t.Errorf("dropped %d, queued %d, want 1 and 1", ce.dropped, len(ce.queue))
+	}
+
+	// Publishing without exports configured does nothing
+	var none *ClickEvents
+	none.Publish(ClickEvent{Shortcut: "c"})
+}
+
+func TestGASinkBatchesEvents(t *testing.T) {
+	var requests []int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			ClientID string            `json:"client_id"`
+			Events   []json.RawMessage `json:"events"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.ClientID == "" {
+			http.Error(w, "bad payload", http.StatusBadRequest)
+			return
+		}
+		requests = append(requests, len(payload.Events))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	sink := &gaSink{endpoint: srv.URL, client: srv.Client()}
+	if err := sink.Send(t.Context(), make([]ClickEvent, 60)); err != nil {
+		t.Fatal(err)
+	}
+	if len(requests) != 3 || requests[0] != gaMaxEvents || requests[2] != 10 {
+		t.Errorf("requests carried %v events, want [25 25 10]", requests)
+	}
+
+	missing := httptest.NewServer(http.NotFoundHandler())
+	defer missing.Close()
+	webhook := &webhookSink{url: missing.URL, client: missing.Client()}
+	if err := webhook.Send(t.Context(), make([]ClickEvent, 1)); err == nil {
+		t.Error("webhook send succeeded against a 404")
+	}
+}
+
+func TestNewClickSinks(t *testing.T) {
+	if sinks, err := NewClickSinks(ClickSinkConfig{}); len(sinks) != 0 || err != nil {
+		t.Errorf("NewClickSinks with nothing configured = %v, %v", sinks, err)
+	}
+	for _, config := range []ClickSinkConfig{
+		{WebhookURL: "ftp://analytics.example.com"},
+		{GAMeasurementID: "G-123"},
+		{KafkaBrokers: "kafka1"},
+	} {
+		if _, err := NewClickSinks(config); err == nil {
+			t.Errorf("NewClickSinks(%+v) succeeded, want an error", config)
+		}
+	}
+	sinks, err := NewClickSinks(ClickSinkConfig{
+		WebhookURL:      "https://analytics.example.com/clicks",
+		GAMeasurementID: "G-123",
+		GAAPISecret:     "secret",
+		KafkaBrokers:    "kafka1:9092,kafka2:9092",
+	})
+	if err != nil || len(sinks) != 3 {
+		t.Errorf("NewClickSinks = %d sinks, %v, want 3", len(sinks), err)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+)
+
+// ClientCerts identifies API clients by the TLS client certificates they
+// present, for zero-trust setups where every caller has a certificate from
+// an internal CA. It needs go-links to terminate TLS itself.
+//
+// Certificates are mapped to users in a plain text file with one mapping per
+// line: a certificate identity (a URI, email or DNS subject alternative
+// name, or the subject common name), the go-links user it signs in as, and
+// optionally a comma-separated list of roles, e.g.
+//
+//	spiffe://example.com/ci/deploy  ci-bot@example.com  editor
+//	backup-job                      backup@example.com
+//
+// Lines starting with # are comments, and matching is case-insensitive.
+// Without a mapping file, certificates sign in as their first email address,
+// or else their common name, with no roles.
+type ClientCerts struct {
+	pool     *x509.CertPool
+	mappings map[string]certIdentity // by lowercased certificate identity
+}
+
+// certIdentity is who a client certificate signs in as
+type certIdentity struct {
+	User  string
+	Roles []string
+}
+
+// NewClientCerts trusts client certificates issued by the CAs in the PEM
+// file caFile, mapping them to users with the file mapFile (if it exists).
+// An empty caFile disables client certificates.
+func NewClientCerts(caFile, mapFile string) (*ClientCerts, error) {
+	if caFile == "" {
+		return nil, nil
+	}
+
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	cc := &ClientCerts{pool: x509.NewCertPool(), mappings: make(map[string]certIdentity)}
+	if !cc.pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", caFile)
+	}
+
+	file, err := os.Open(mapFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return cc, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("client certificate mapping %q names no user", line)
+		}
+		identity := certIdentity{User: fields[1]}
+		for _, role := range splitList(strings.Join(fields[2:], " ")) {
+			if role != roleEditor && role != roleAdmin && role != roleViewer {
+				return nil, fmt.Errorf("unknown role %q for %s", role, fields[0])
+			}
+			identity.Roles = append(identity.Roles, role)
+		}
+		cc.mappings[strings.ToLower(fields[0])] = identity
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return cc, nil
+}
+
+// TLSConfig asks browsers and API clients for a certificate, verifying any
+// they present. Clients without one can still connect, and sign in as
+// usual.
+func (cc *ClientCerts) TLSConfig() *tls.Config {
+	return &tls.Config{
+		ClientAuth: tls.VerifyClientCertIfGiven,
+		ClientCAs:  cc.pool,
+	}
+}
+
+// Identify returns who the request's verified client certificate signs in
+// as, if it presented one that maps to a user
+func (cc *ClientCerts) Identify(r *http.Request) (certIdentity, bool) {
+	if cc == nil || r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return certIdentity{}, false
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+
+	if len(cc.mappings) == 0 {
+		user := cert.Subject.CommonName
+		if len(cert.EmailAddresses) > 0 {
+			user = cert.EmailAddresses[0]
+		}
+		return certIdentity{User: user}, user != ""
+	}
+
+	var names []string
+	for _, uri := range cert.URIs {
+		names = append(names, uri.String())
+	}
+	names = append(append(names, cert.EmailAddresses...), cert.DNSNames...)
+	names = append(names, cert.Subject.CommonName)
+	for _, name := range names {
+		if identity, ok := cc.mappings[strings.ToLower(name)]; ok && name != "" {
+			return identity, true
+		}
+	}
+	return certIdentity{}, false
+}
+
+// HasAdmins reports whether any certificates are mapped to admins
+func (cc *ClientCerts) HasAdmins() bool {
+	if cc == nil {
+		return false
+	}
+	for _, identity := range cc.mappings {
+		if slices.Contains(identity.Roles, roleAdmin) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasRole reports whether the request's client certificate grants role
+func (cc *ClientCerts) HasRole(r *http.Request, role string) bool {
+	identity, ok := cc.Identify(r)
+	return ok && slices.Contains(identity.Roles, role)
+}
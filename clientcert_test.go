@@ -0,0 +1,210 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCA issues client certificates for tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns a client certificate with the given common name, email and
+// URI
+func (ca *testCA) issue(t *testing.T, cn, email, uri string) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if email != "" {
+		template.EmailAddresses = []string{email}
+	}
+	if uri != "" {
+		u, _ := url.Parse(uri)
+		template.URIs = []*url.URL{u}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// newTestClientCerts writes ca's certificate and mappings to files and
+// loads them
+func newTestClientCerts(t *testing.T, ca *testCA, mappings string) *ClientCerts {
+	t.Helper()
+	dir := t.TempDir()
+	caFile, mapFile := filepath.Join(dir, "ca.pem"), filepath.Join(dir, "client-certs.txt")
+	os.WriteFile(caFile, ca.pem, 0644)
+	if mappings != "" {
+		os.WriteFile(mapFile, []byte(mappings), 0644)
+	}
+	cc, err := NewClientCerts(caFile, mapFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cc
+}
+
+// withClientCert returns a request as if it arrived over TLS with cert,
+// verified
+func withClientCert(r *http.Request, cert tls.Certificate) *http.Request {
+	leaf, _ := x509.ParseCertificate(cert.Certificate[0])
+	r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf}, VerifiedChains: [][]*x509.Certificate{{leaf}}}
+	return r
+}
+
+func TestNewClientCerts(t *testing.T) {
+	if cc, err := NewClientCerts("", ""); cc != nil || err != nil {
+		t.Errorf("NewClientCerts with no CA = %v, %v, want disabled", cc, err)
+	}
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	os.WriteFile(caFile, []byte("not a certificate"), 0644)
+	if _, err := NewClientCerts(caFile, ""); err == nil {
+		t.Error("NewClientCerts with no certificates in the CA file succeeded")
+	}
+
+	ca := newTestCA(t)
+	os.WriteFile(caFile, ca.pem, 0644)
+	for _, mappings := range []string{"lonely-cert\n", "ci ci-bot@example.com superuser\n"} {
+		mapFile := filepath.Join(dir, "client-certs.txt")
+		os.WriteFile(mapFile, []byte(mappings), 0644)
+		if _, err := NewClientCerts(caFile, mapFile); err == nil {
+			t.Errorf("mappings %q loaded, want an error", mappings)
+		}
+	}
+}
+
+func TestClientCertIdentity(t *testing.T) {
+	ca := newTestCA(t)
+	deploy := ca.issue(t, "deploy", "", "spiffe://example.com/ci/deploy")
+	backup := ca.issue(t, "Backup-Job", "backup@example.com", "")
+
+	// Without mappings certificates sign in as their email or common name
+	s := newTestServer(t)
+	s.clientCerts = newTestClientCerts(t, ca, "")
+	if user := s.currentUser(withClientCert(httptest.NewRequest("GET", "/", nil), backup)); user != "backup@example.com" {
+		t.Errorf("unmapped certificate with an email = %q, want backup@example.com", user)
+	}
+	if user := s.currentUser(withClientCert(httptest.NewRequest("GET", "/", nil), deploy)); user != "deploy" {
+		t.Errorf("unmapped certificate = %q, want its common name", user)
+	}
+	if user := s.currentUser(httptest.NewRequest("GET", "/", nil)); user != "" {
+		t.Errorf("no certificate = %q, want nobody", user)
+	}
+
+	// With mappings only mapped certificates sign in, with their roles
+	s.clientCerts = newTestClientCerts(t, ca, `# certificate            user                roles
+spiffe://example.com/ci/deploy  ci-bot@example.com  editor, admin
+`)
+	s.editors, _ = NewEditAuth("alice:secret", "")
+	r := withClientCert(httptest.NewRequest("POST", "/add", nil), deploy)
+	if user := s.currentUser(r); user != "ci-bot@example.com" || !s.mayEdit(r) || !s.isAdmin(r) {
+		t.Errorf("deploy certificate: user %q, may edit %v, admin %v", user, s.mayEdit(r), s.isAdmin(r))
+	}
+	r = withClientCert(httptest.NewRequest("POST", "/add", nil), backup)
+	if user := s.currentUser(r); user != "" || s.mayEdit(r) {
+		t.Errorf("unmapped certificate: user %q, may edit %v, want nobody", user, s.mayEdit(r))
+	}
+
+	// A certificate mapped to admins opens the admin console on its own
+	console := s.requireAdmin(func(w http.ResponseWriter, r *http.Request) {})
+	for _, tc := range []struct {
+		cert tls.Certificate
+		want int
+	}{{deploy, http.StatusOK}, {backup, http.StatusForbidden}} {
+		w := httptest.NewRecorder()
+		console(w, withClientCert(httptest.NewRequest("GET", "/admin", nil), tc.cert))
+		if w.Code != tc.want {
+			t.Errorf("admin console: status %d, want %d", w.Code, tc.want)
+		}
+	}
+}
+
+func TestClientCertHandshake(t *testing.T) {
+	ca := newTestCA(t)
+	s := newTestServer(t)
+	s.clientCerts = newTestClientCerts(t, ca, "")
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, s.currentUser(r))
+	}))
+	srv.TLS = s.clientCerts.TLSConfig()
+	srv.StartTLS()
+	defer srv.Close()
+
+	get := func(certs ...tls.Certificate) (string, error) {
+		// A new transport for each client, so connections aren't reused
+		transport := srv.Client().Transport.(*http.Transport).Clone()
+		transport.TLSClientConfig.Certificates = certs
+		resp, err := (&http.Client{Transport: transport}).Get(srv.URL)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body), nil
+	}
+
+	if user, err := get(ca.issue(t, "ci", "ci@example.com", "")); err != nil || user != "ci@example.com" {
+		t.Errorf("with a certificate: %q, %v, want ci@example.com", user, err)
+	}
+	if user, err := get(); err != nil || user != "" {
+		t.Errorf("without a certificate: %q, %v, want anonymous", user, err)
+	}
+	if _, err := get(newTestCA(t).issue(t, "mallory", "", "")); err == nil {
+		t.Error("a certificate from another CA was accepted")
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// minCompressSize is the smallest response worth compressing: below it,
+// gzip's header and the work cost more than they save
+const minCompressSize = 1024
+
+// compressibleTypes are the media types compressed: pages, and the JSON,
+// CSV, YAML and feeds of the API and exports. Images are compressed
+// already, and redirects have next to no body.
+var compressibleTypes = map[string]bool{
+	"text/html":                             true,
+	"text/plain":                            true,
+	"text/css":                              true,
+	"text/csv":                              true,
+	"text/javascript":                       true,
+	"application/javascript":                true,
+	"application/json":                      true,
+	"application/jsonl":                     true,
+	"application/x-ndjson":                  true,
+	"application/x-suggestions+json":        true,
+	"application/manifest+json":             true,
+	"application/yaml":                      true,
+	"application/xml":                       true,
+	"application/atom+xml":                  true,
+	"application/opensearchdescription+xml": true,
+	"application/samlmetadata+xml":          true,
+	"image/svg+xml":                         true,
+}
+
+// gzipWriters are reused between responses, as each holds large buffers
+var gzipWriters = sync.Pool{New: func() any { return gzip.NewWriter(io.Discard) }}
+
+// compress gzips responses of compressible types and at least
+// minCompressSize bytes for clients that accept gzip. Responses already
+// encoded, partial and HEAD responses are left alone.
+func compress(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead || !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cw := &compressWriter{ResponseWriter: w}
+		defer cw.Close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip, by
+// name or as *, with a q-value above zero
+func acceptsGzip(header string) bool {
+	accepted := false
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+		q := 1.0
+		if name, value, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(name) == "q" {
+			q, _ = strconv.ParseFloat(strings.TrimSpace(value), 64)
+		}
+		if coding == "gzip" {
+			// An explicit gzip wins over *
+			return q > 0
+		}
+		accepted = q > 0
+	}
+	return accepted
+}
+
+// compressWriter holds back the start of a response until it knows
+// whether to compress it: once minCompressSize bytes are written, or the
+// handler flushes or finishes
+type compressWriter struct {
+	http.ResponseWriter
+	status  int
+	decided bool
+	buf     []byte
+	gz      *gzip.Writer // nil unless compressing
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.status != 0 || cw.decided {
+		return
+	}
+	if status < http.StatusOK {
+		// Informational responses, such as 103 Early Hints, go straight out
+		cw.ResponseWriter.WriteHeader(status)
+		return
+	}
+	cw.status = status
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	if !cw.decided {
+		cw.buf = append(cw.buf, p...)
+		if len(cw.buf) < minCompressSize {
+			return len(p), nil
+		}
+		if err := cw.decide(); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	if cw.gz != nil {
+		return cw.gz.Write(p)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+// decide sends the headers, compressed or not, and what's been held back
+func (cw *compressWriter) decide() error {
+	cw.decided = true
+	h := cw.Header()
+	if _, set := h["Content-Type"]; !set && len(cw.buf) > 0 {
+		// As the server would, had it seen the start of the body
+		h.Set("Content-Type", http.DetectContentType(cw.buf))
+	}
+	mediaType, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	compressible := compressibleTypes[mediaType]
+	if compressible {
+		h.Add("Vary", "Accept-Encoding")
+	}
+	if compressible && len(cw.buf) >= minCompressSize && h.Get("Content-Encoding") == "" && h.Get("Content-Range") == "" &&
+		cw.status != http.StatusNoContent && cw.status != http.StatusNotModified && cw.status != http.StatusPartialContent {
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		// A strong validator names the uncompressed bytes
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag)
+		}
+		cw.gz = gzipWriters.Get().(*gzip.Writer)
+		cw.gz.Reset(cw.ResponseWriter)
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if cw.gz != nil {
+		_, err = cw.gz.Write(buf)
+	} else {
+		_, err = cw.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// Flush sends what's been written so far, compressed if it's being
+// compressed, for responses streamed a piece at a time
+func (cw *compressWriter) Flush() {
+	if cw.status == 0 {
+		return
+	}
+	if !cw.decided {
+		cw.decide()
+	}
+	if cw.gz != nil {
+		cw.gz.Flush()
+	}
+	http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// Close sends anything held back and finishes the compressed stream
+func (cw *compressWriter) Close() error {
+	if cw.status == 0 {
+		// Nothing was written: let the server send its usual empty 200
+		return nil
+	}
+	if !cw.decided {
+		if err := cw.decide(); err != nil {
+			return err
+		}
+	}
+	if cw.gz == nil {
+		return nil
+	}
+	err := cw.gz.Close()
+	gzipWriters.Put(cw.gz)
+	cw.gz = nil
+	return err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCompress(t *testing.T) {
+	page := strings.Repeat("<p>go/gh goes to GitHub</p>\n", 100)
+	handler := compress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/page":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Header().Set("Content-Length", "2800")
+			io.WriteString(w, page[:1000])
+			io.WriteString(w, page[1000:])
+		case "/small":
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, `{"ok":true}`)
+		case "/png":
+			w.Header().Set("Content-Type", "image/png")
+			io.WriteString(w, page)
+		case "/sniffed":
+			io.WriteString(w, page)
+		case "/missing":
+			http.Error(w, page, http.StatusNotFound)
+		}
+	}))
+
+	get := func(path, acceptEncoding string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", path, nil)
+		r.Header.Set("Accept-Encoding", acceptEncoding)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+	for _, path := range []string{"/page", "/sniffed", "/missing"} {
+		w := get(path, "br, gzip;q=0.8")
+		if w.Header().Get("Content-Encoding") != "gzip" || w.Header().Get("Content-Length") != "" || w.Header().Get("Vary") != "Accept-Encoding" {
+			t.Fatalf("%s: headers %v", path, w.Header())
+		}
+		gz, err := gzip.NewReader(w.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if body, _ := io.ReadAll(gz); !strings.Contains(string(body), page) {
+			t.Errorf("%s: decompressed to %q", path, body)
+		}
+	}
+	if w := get("/missing", "gzip"); w.Code != http.StatusNotFound {
+		t.Errorf("status %d, want 404", w.Code)
+	}
+
+	for path, acceptEncoding := range map[string]string{
+		"/page":  "gzip;q=0, *",
+		"/small": "gzip",
+		"/png":   "gzip",
+	} {
+		w := get(path, acceptEncoding)
+		if w.Header().Get("Content-Encoding") != "" || w.Body.Len() < 11 {
+			t.Errorf("%s with %q: compressed, headers %v", path, acceptEncoding, w.Header())
+		}
+	}
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	for header, want := range map[string]bool{
+		"":                       false,
+		"gzip":                   true,
+		"GZIP, deflate":          true,
+		"br;q=1.0, gzip;q=0.5":   true,
+		"gzip;q=0":               false,
+		"*":                      true,
+		"*;q=0":                  false,
+		"gzip;q=0, *;q=1":        false,
+		"identity, deflate, br":  false,
+		"deflate, gzip ; q=0.01": true,
+	} {
+		if got := acceptsGzip(header); got != want {
+			t.Errorf("acceptsGzip(%q) = %v, want %v", header, got, want)
+		}
+	}
+}
+
+func TestCompressedHomepage(t *testing.T) {
+	s := newTestServer(t)
+	s.store = newBenchStore(t, 250)
+	r := httptest.NewRequest("GET", "/?per_page=250", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	compress(http.HandlerFunc(s.handleHome)).ServeHTTP(w, r)
+
+	plain := httptest.NewRecorder()
+	s.handleHome(plain, httptest.NewRequest("GET", "/?per_page=250", nil))
+	if w.Header().Get("Content-Encoding") != "gzip" || w.Body.Len()*5 > plain.Body.Len() {
+		t.Errorf("homepage of %d bytes compressed to %d, %v", plain.Body.Len(), w.Body.Len(), w.Header())
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// overloadMessage explains why a request was turned away while the server
+// was busy
+const overloadMessage = "go-links is very busy right now. Please try again in a moment."
+
+// ConcurrencyLimit caps how many requests are handled at once, so a spike,
+// such as a link in an all-hands email, can't pile up enough work to bring
+// the server and its store down. Requests over the limit wait their turn
+// in a queue of bounded length for a bounded time; those the queue has no
+// room for, or that wait too long, get 503 Service Unavailable with a
+// Retry-After header straight away, which costs next to nothing.
+type ConcurrencyLimit struct {
+	slots   chan struct{} // holds a token for each request being handled
+	queue   int64
+	timeout time.Duration
+
+	waiting atomic.Int64
+	shed    atomic.Int64
+}
+
+// NewConcurrencyLimit sets up a limit of maxRequests handled at once, with
+// up to queue more waiting (by default as many again) for at most timeout
+// (by default 5s, a number of seconds or a duration). With no maximum
+// requests aren't limited.
+func NewConcurrencyLimit(maxRequests, queue, timeout string) (*ConcurrencyLimit, error) {
+	n, err := parseLogCount("maximum requests", strings.TrimSpace(maxRequests), 0)
+	if err != nil || n == 0 {
+		return nil, err
+	}
+	queued, err := parseLogCount("request queue", queue, n)
+	if err != nil {
+		return nil, err
+	}
+	wait, err := parseTimeout("queue timeout", timeout, 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	return &ConcurrencyLimit{slots: make(chan struct{}, n), queue: int64(queued), timeout: wait}, nil
+}
+
+// acquire takes a slot for r, waiting in the queue when there's room,
+// and reports whether it got one. A slot taken must be released.
+func (cl *ConcurrencyLimit) acquire(r *http.Request) bool {
+	select {
+	case cl.slots <- struct{}{}:
+		return true
+	default:
+	}
+	if cl.waiting.Add(1) > cl.queue {
+		cl.waiting.Add(-1)
+		return false
+	}
+	defer cl.waiting.Add(-1)
+	timer := time.NewTimer(cl.timeout)
+	defer timer.Stop()
+	select {
+	case cl.slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-r.Context().Done():
+		// The client gave up; whatever is written goes nowhere
+		return false
+	}
+}
+
+// release frees a slot taken by acquire
+func (cl *ConcurrencyLimit) release() {
+	<-cl.slots
+}
+
+// InFlight returns how many requests are being handled and waiting, and
+// how many have been turned away since starting
+func (cl *ConcurrencyLimit) InFlight() (handling, waiting, shed int64) {
+	return int64(len(cl.slots)), cl.waiting.Load(), cl.shed.Load()
+}
+
+// limitConcurrency holds requests over the concurrency limit
+// (GOLINKS_MAX_REQUESTS) back in a queue, and turns away those that can't
+// wait with 503 and a Retry-After header. Metrics are always served, so
+// the overload can be watched.
+func (s *Server) limitConcurrency(next http.Handler) http.Handler {
+	if s.concurrency == nil {
+		return next
+	}
+	cl := s.concurrency
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/metrics" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !cl.acquire(r) {
+			// Logged once in a while, as a spike would flood the log
+			if shed := cl.shed.Add(1); shed == 1 || shed%100 == 0 {
+				log.Printf("Warning: Overloaded, turned away %d requests so far", shed)
+			}
+			w.Header().Set("Retry-After", strconv.Itoa(max(1, int(math.Ceil(cl.timeout.Seconds())))))
+			if r.Header.Get("Sec-Fetch-Mode") == "navigate" {
+				s.showError(w, r, http.StatusServiceUnavailable, overloadMessage)
+				return
+			}
+			http.Error(w, overloadMessage, http.StatusServiceUnavailable)
+			return
+		}
+		defer cl.release()
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNewConcurrencyLimit(t *testing.T) {
+	for _, disabled := range []string{"", "0"} {
+		if cl, err := NewConcurrencyLimit(disabled, "10", ""); cl != nil || err != nil {
+			t.Errorf("NewConcurrencyLimit(%q) = %v, %v, want disabled", disabled, cl, err)
+		}
+	}
+	cl, err := NewConcurrencyLimit("50", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cap(cl.slots) != 50 || cl.queue != 50 || cl.timeout != 5*time.Second {
+		t.Errorf("defaults = %d at once, %d queued for %v, want 50, 50 and 5s", cap(cl.slots), cl.queue, cl.timeout)
+	}
+	if cl, err := NewConcurrencyLimit("50", "0", "2"); err != nil || cl.queue != 0 || cl.timeout != 2*time.Second {
+		t.Errorf("no queue, 2s = %+v, %v", cl, err)
+	}
+	for _, limits := range [][3]string{{"many", "", ""}, {"-1", "", ""}, {"10", "x", ""}, {"10", "", "soon"}} {
+		if _, err := NewConcurrencyLimit(limits[0], limits[1], limits[2]); err == nil {
+			t.Errorf("NewConcurrencyLimit%q succeeded, want an error", limits)
+		}
+	}
+}
+
+func TestLimitConcurrency(t *testing.T) {
+	s := newTestServer(t)
+	s.concurrency, _ = NewConcurrencyLimit("1", "1", "1")
+	started, finish := make(chan struct{}), make(chan struct{})
+	handler := s.limitConcurrency(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			started <- struct{}{}
+			<-finish
+		}
+	}))
+	request := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	// One request is handled while the next waits its turn
+	var wg sync.WaitGroup
+	codes := make(chan int, 2)
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- request("/slow").Code
+		}()
+	}
+	<-started
+	eventually(t, "a request to queue", func() bool {
+		_, waiting, _ := s.concurrency.InFlight()
+		return waiting == 1
+	})
+
+	// With the queue full, others are turned away at once
+	w := request("/wiki")
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "1" || !strings.Contains(w.Body.String(), "busy") {
+		t.Errorf("over the limit: status %d, Retry-After %q, want 503 after 1s", w.Code, w.Header().Get("Retry-After"))
+	}
+	if w := request("/metrics"); w.Code != http.StatusOK {
+		t.Errorf("metrics while overloaded: status %d, want 200", w.Code)
+	}
+
+	// The queued request is handled once the first finishes
+	finish <- struct{}{}
+	<-started
+	finish <- struct{}{}
+	wg.Wait()
+	close(codes)
+	for code := range codes {
+		if code != http.StatusOK {
+			t.Errorf("limited request: status %d, want 200", code)
+		}
+	}
+	if handling, waiting, shed := s.concurrency.InFlight(); handling != 0 || waiting != 0 || shed != 1 {
+		t.Errorf("after = %d handling, %d waiting, %d shed, want 0, 0 and 1", handling, waiting, shed)
+	}
+}
+
+func TestLimitConcurrencyQueueTimeout(t *testing.T) {
+	s := newTestServer(t)
+	s.concurrency, _ = NewConcurrencyLimit("1", "10", "20ms")
+	s.concurrency.slots <- struct{}{} // a request that never finishes
+	handler := s.limitConcurrency(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	start := time.Now()
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/wiki", nil))
+	if w.Code != http.StatusServiceUnavailable || time.Since(start) < 20*time.Millisecond {
+		t.Errorf("waited %v: status %d, want 503 after 20ms", time.Since(start), w.Code)
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// settings are the names of every configuration setting, each read from
+// the environment variable GOLINKS_<NAME> in upper case
+var settings = []string{
+	"accent_color", "access_log", "acl", "addr", "admins", "admin_addr",
+	"admin_token", "allowed_domains", "allowed_schemes", "analytics",
+	"announce_format", "announce_namespaces", "announce_webhook",
+	"archive_grace_days", "archive_unused_days", "archive_webhook", "audit_log",
+	"auth_token", "autocert_cache", "autocert_directory", "autocert_email",
+	"autocert_hosts", "auth_users", "blocklist", "calendars", "compression",
+	"click_webhook", "client_ca", "client_certs", "data", "debug_addr",
+	"digest_day", "digest_hour", "digest_owners", "digest_to", "fallback_mode",
+	"fallback_url", "ga_api_secret", "ga_measurement_id", "git_branch",
+	"git_remote", "git_repo", "groups", "groups_header", "honor_dnt", "hosts",
+	"http2", "http_redirect_addr", "idle_timeout", "instance_id",
+	"invalidation_url", "ip_addresses", "ip_version", "ip_hash_key",
+	"kafka_brokers", "kafka_topic", "lazy_load", "leader_election",
+	"ldap_admin_groups", "ldap_base_dn", "ldap_bind_dn", "ldap_bind_password",
+	"ldap_editor_groups", "ldap_url", "ldap_user_filter", "ldap_user_groups",
+	"link_quota", "link_rate", "logo_url", "log_file", "log_format", "log_level",
+	"log_max_files", "log_max_size", "max_body_mb", "max_header_kb",
+	"max_requests", "memory_limit", "metrics", "metrics_buckets",
+	"metrics_refresh", "metrics_token", "metrics_top", "oidc_client_id",
+	"oidc_client_secret", "oidc_domains", "oidc_issuer", "oidc_redirect_url",
+	"peer_secret", "peers", "public_api", "queue_timeout", "quota_overrides",
+	"rate_burst", "rate_limit", "read_header_timeout", "read_only",
+	"read_timeout", "redirect_cache_control", "region_header", "region_networks",
+	"require_sign_in", "request_queue", "reserved_namespaces", "retention_days",
+	"reuse_port", "saml_cert", "saml_idp_metadata", "saml_key", "saml_root_url",
+	"saml_user_attribute", "session_secret", "session_store", "shutdown_timeout",
+	"slack_signing_secret", "smtp_addr", "smtp_from", "smtp_password",
+	"smtp_username", "socket_group", "socket_mode", "template_dir", "tls_cert",
+	"tls_key", "trusted_proxies", "upgrade_https", "user_header",
+	"user_rate_limit", "webhooks", "wiki", "wiki_interval", "wiki_page",
+	"wiki_token", "wiki_url", "wiki_user", "write_timeout",
+}
+
+// settingEnv returns the environment variable a setting is read from
+func settingEnv(name string) string {
+	return "GOLINKS_" + strings.ToUpper(name)
+}
+
+// command is a one-off task given on the command line, run instead of
+// serving
+type command struct {
+	backup  string // write a snapshot into this directory
+	restore string // restore this snapshot
+	migrate string // copy the data to this links file
+	check   bool   // check the configuration and data, then exit
+}
+
+// loadConfig applies configuration from a file and command-line flags on
+// top of the environment, which every setting is then read from. Flags win
+// over environment variables, which win over the file:
+//
+//	go-links -config /etc/go-links.yaml -addr :8080 -set log_level=debug
+//
+// The file is named by -config or GOLINKS_CONFIG. It also returns any
+// command given instead of serving, such as -backup.
+func loadConfig(args []string, stderr io.Writer) (command, error) {
+	flags := flag.NewFlagSet("go-links", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	configPath := flags.String("config", os.Getenv("GOLINKS_CONFIG"), "YAML or TOML configuration `file`")
+	addr := flags.String("addr", "", "`address` to listen on (default :3001)")
+	data := flags.String("data", "", "links `file`, with other data kept alongside (default /app/data/links.json)")
+	var cmd command
+	flags.StringVar(&cmd.backup, "backup", "", "back up the data into `directory` and exit")
+	flags.StringVar(&cmd.restore, "restore", "", "restore the backup `file` into an empty deployment and exit")
+	flags.StringVar(&cmd.migrate, "migrate", "", "copy the data to the links `file` given, with what's kept alongside it, verify it and exit; run again to copy changes since")
+	flags.BoolVar(&cmd.check, "check", false, "check the configuration, data files and templates, report and exit")
+	overrides := make(map[string]string)
+	flags.Func("set", "set any setting, as `name=value` (repeatable)", func(value string) error {
+		name, value, ok := strings.Cut(value, "=")
+		if !ok {
+			return fmt.Errorf("%q should be name=value", name)
+		}
+		name = settingName(name)
+		if !slices.Contains(settings, name) {
+			return fmt.Errorf("unknown setting %q", name)
+		}
+		overrides[name] = value
+		return nil
+	})
+	if err := flags.Parse(args); err != nil {
+		return cmd, err
+	}
+	if *addr != "" {
+		overrides["addr"] = *addr
+	}
+	if *data != "" {
+		overrides["data"] = *data
+	}
+
+	if *configPath != "" {
+		fromFile, err := readConfigFile(*configPath)
+		if err != nil {
+			return cmd, err
+		}
+		for name, value := range fromFile {
+			if _, set := os.LookupEnv(settingEnv(name)); !set {
+				os.Setenv(settingEnv(name), value)
+			}
+		}
+	}
+	for name, value := range overrides {
+		os.Setenv(settingEnv(name), value)
+	}
+	return cmd, nil
+}
+
+// settingName normalizes a setting name from a file or flag: GOLINKS_LOG_LEVEL,
+// log-level and log.level are all log_level
+func settingName(name string) string {
+	name = strings.TrimPrefix(strings.ToUpper(name), "GOLINKS_")
+	return strings.NewReplacer("-", "_", ".", "_").Replace(strings.ToLower(name))
+}
+
+// readConfigFile reads settings from a YAML (.yaml or .yml) or TOML (.toml)
+// file. Tables group settings by prefix, so
+//
+//	log:
+//	  format: json
+//
+// sets log_format, and a table's enabled key sets the setting named after
+// the table itself. Lists become comma-separated values.
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var tree map[string]any
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &tree)
+	case ".toml":
+		err = toml.Unmarshal(data, &tree)
+	default:
+		return nil, fmt.Errorf("%s: configuration files must be .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	values := make(map[string]string)
+	if err := flattenConfig(values, "", tree); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return values, nil
+}
+
+// flattenConfig adds the settings in table, whose keys are prefixed with
+// prefix, to values
+func flattenConfig(values map[string]string, prefix string, table map[string]any) error {
+	for key, value := range table {
+		name := settingName(key)
+		switch {
+		case prefix != "" && name == "enabled":
+			name = strings.TrimSuffix(prefix, "_")
+		case prefix != "":
+			name = prefix + name
+		}
+		if nested, ok := value.(map[string]any); ok {
+			if err := flattenConfig(values, name+"_", nested); err != nil {
+				return err
+			}
+			continue
+		}
+		if !slices.Contains(settings, name) {
+			return fmt.Errorf("unknown setting %q", name)
+		}
+		text, err := configValue(value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		values[name] = text
+	}
+	return nil
+}
+
+// configValue formats a value from a configuration file as an environment
+// variable would hold it
+func configValue(value any) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), nil
+	case []any:
+		items := make([]string, len(v))
+		for i, item := range v {
+			text, err := configValue(item)
+			if err != nil {
+				return "", err
+			}
+			items[i] = text
+		}
+		return strings.Join(items, ","), nil
+	default:
+		return "", fmt.Errorf("unsupported value %v", value)
+	}
+}
+
+// listenAddr returns the addresses to listen on, comma-separated:
+// GOLINKS_ADDR, or the port in PORT as set by many hosting platforms, or
+// def. Addresses without a port get def's, and IPv6 addresses may leave
+// out the brackets when they do, so ::1 means [::1]:3001.
+func listenAddr(def string) string {
+	addr := os.Getenv("GOLINKS_ADDR")
+	if addr == "" {
+		if port := os.Getenv("PORT"); port != "" {
+			return ":" + port
+		}
+		return def
+	}
+	_, defPort, _ := net.SplitHostPort(def)
+	var addrs []string
+	for _, addr := range splitList(addr) {
+		addrs = append(addrs, withPort(addr, defPort))
+	}
+	return strings.Join(addrs, ",")
+}
+
+// withPort adds port to a TCP address without one: a bare port number,
+// hostname or IP address, bracketed or not
+func withPort(addr, port string) string {
+	if _, _, err := net.SplitHostPort(addr); err == nil || strings.HasPrefix(addr, "unix:") {
+		return addr
+	}
+	if _, err := strconv.Atoi(addr); err == nil {
+		return ":" + addr
+	}
+	host := strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+	return net.JoinHostPort(host, port)
+}
+
+// displayAddr returns a listen address as it can be visited locally
+func displayAddr(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "localhost"
+	}
+	return net.JoinHostPort(host, port)
+}
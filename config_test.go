@@ -0,0 +1,148 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestEverySettingIsKnown(t *testing.T) {
+	files, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := regexp.MustCompile(`"GOLINKS_([A-Z0-9_]+)"`)
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+		source, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, match := range names.FindAllStringSubmatch(string(source), -1) {
+			if name := strings.ToLower(match[1]); name != "config" && !slices.Contains(settings, name) {
+				t.Errorf("%s reads GOLINKS_%s, which is missing from settings", file, match[1])
+			}
+		}
+	}
+}
+
+// unsetenv clears environment variables for a test, restoring them after
+func unsetenv(t *testing.T, names ...string) {
+	for _, name := range names {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	unsetenv(t, "GOLINKS_CONFIG", "GOLINKS_ADDR", "GOLINKS_DATA", "GOLINKS_LOG_FORMAT", "GOLINKS_LOG_LEVEL",
+		"GOLINKS_ADMINS", "GOLINKS_METRICS", "GOLINKS_METRICS_TOP", "GOLINKS_ACCENT_COLOR", "PORT")
+	dir := t.TempDir()
+	path := filepath.Join(dir, "go-links.yaml")
+	os.WriteFile(path, []byte(`
+addr: ":8080"
+data: /srv/go-links/links.json
+log:
+  format: json
+  level: debug
+admins: [alice@example.com, bob@example.com]
+metrics:
+  enabled: true
+  top: 20
+GOLINKS_ACCENT_COLOR: "#ff6600"
+`), 0644)
+
+	// The environment wins over the file, and flags over both
+	t.Setenv("GOLINKS_LOG_LEVEL", "warn")
+	if _, err := loadConfig([]string{"-config", path, "-addr", ":9090", "-set", "log-format=text"}, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{
+		"GOLINKS_ADDR":         ":9090",
+		"GOLINKS_DATA":         "/srv/go-links/links.json",
+		"GOLINKS_LOG_FORMAT":   "text",
+		"GOLINKS_LOG_LEVEL":    "warn",
+		"GOLINKS_ADMINS":       "alice@example.com,bob@example.com",
+		"GOLINKS_METRICS":      "true",
+		"GOLINKS_METRICS_TOP":  "20",
+		"GOLINKS_ACCENT_COLOR": "#ff6600",
+	} {
+		if got := os.Getenv(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	if got := listenAddr(":3001"); got != ":9090" {
+		t.Errorf("listenAddr() = %q, want :9090", got)
+	}
+	os.Unsetenv("GOLINKS_ADDR")
+	t.Setenv("PORT", "8000")
+	if got := listenAddr(":3001"); got != ":8000" {
+		t.Errorf("listenAddr() with PORT = %q, want :8000", got)
+	}
+}
+
+func TestListenAddrAddsPorts(t *testing.T) {
+	for addr, want := range map[string]string{
+		"[::1]:8080":              "[::1]:8080",
+		"::1":                     "[::1]:3001",
+		"[::]":                    "[::]:3001",
+		"fe80::1%eth0":            "[fe80::1%eth0]:3001",
+		"8080":                    ":8080",
+		"localhost":               "localhost:3001",
+		"127.0.0.1, ::1":          "127.0.0.1:3001,[::1]:3001",
+		"unix:/run/go-links.sock": "unix:/run/go-links.sock",
+		"0.0.0.0:80,[::]:80":      "0.0.0.0:80,[::]:80",
+	} {
+		t.Setenv("GOLINKS_ADDR", addr)
+		if got := listenAddr(":3001"); got != want {
+			t.Errorf("listenAddr() with GOLINKS_ADDR=%s = %q, want %q", addr, got, want)
+		}
+	}
+}
+
+func TestConfigFiles(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, []byte(content), 0644)
+		return path
+	}
+
+	values, err := readConfigFile(write("go-links.toml", `
+read_only = true
+link_quota = 50
+
+[oidc]
+issuer = "https://accounts.example.com"
+domains = ["example.com", "example.org"]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{"read_only": "true", "link_quota": "50",
+		"oidc_issuer": "https://accounts.example.com", "oidc_domains": "example.com,example.org"} {
+		if values[name] != want {
+			t.Errorf("%s = %q, want %q", name, values[name], want)
+		}
+	}
+
+	for name, content := range map[string]string{
+		"typo.yaml":    "log_levle: debug\n",
+		"table.toml":   "[ldap]\nenabled = true\n",
+		"invalid.yml":  "addr: [\n",
+		"go-links.ini": "addr = :8080\n",
+	} {
+		if _, err := readConfigFile(write(name, content)); err == nil {
+			t.Errorf("%s: read without error", name)
+		}
+	}
+	if _, err := loadConfig([]string{"-set", "no_such_thing=1"}, io.Discard); err == nil {
+		t.Error("setting an unknown setting succeeded")
+	}
+}
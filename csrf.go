@@ -0,0 +1,91 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"strings"
+)
+
+// csrfCookie holds the per-browser CSRF token. Pages echo the token in
+// forms (csrf_token) and in a <meta> tag for scripts (X-CSRF-Token), and
+// state-changing requests must send it back. Another site can make the
+// browser send the cookie but can't read it to fill in the form.
+const csrfCookie = "golinks_csrf"
+
+// csrfToken returns the request's CSRF token, issuing a new cookie when the
+// browser doesn't have one yet
+func (s *Server) csrfToken(w http.ResponseWriter, r *http.Request) string {
+	if cookie, err := r.Cookie(csrfCookie); err == nil && len(cookie.Value) >= 32 {
+		return cookie.Value
+	}
+
+	token := randomToken()
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookie,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   isHTTPS(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	return token
+}
+
+// randomToken returns 32 random bytes encoded for use in cookies and URLs
+func randomToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// csrfExempt are endpoints other sites legitimately post to, which check
+// the request's authenticity themselves
+var csrfExempt = map[string]bool{
+	"/saml/acs":      true, // signed SAML response matching a request we made
+	"/slack/command": true, // signed with the Slack app's signing secret
+}
+
+// csrfProtect rejects state-changing requests from browsers that don't
+// carry the CSRF token matching their cookie. Requests from non-browser
+// clients such as curl, which send no Origin, Sec-Fetch-Site or cookies,
+// can't be forged by another site and are let through.
+func (s *Server) csrfProtect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+		if csrfExempt[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if r.Header.Get("Origin") == "" && r.Header.Get("Sec-Fetch-Site") == "" && r.Header.Get("Cookie") == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Browsers never add a bearer token by themselves, and another site
+		// can't set one without a CORS preflight we don't answer, so requests
+		// carrying one, such as a browser extension's, are the client's own
+		if strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cookie, err := r.Cookie(csrfCookie)
+		presented := r.Header.Get("X-CSRF-Token")
+		if presented == "" {
+			presented = r.PostFormValue("csrf_token")
+		}
+		if err != nil || presented == "" || subtle.ConstantTimeCompare([]byte(presented), []byte(cookie.Value)) != 1 {
+			http.Error(w, "This form has expired or came from another site. Reload the page and try again.", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCSRFProtect(t *testing.T) {
+	s := newTestServer(t)
+	handler := s.csrfProtect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	// The homepage issues the cookie and embeds the same token in the form
+	w := httptest.NewRecorder()
+	s.handleHome(w, httptest.NewRequest("GET", "/", nil))
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != csrfCookie {
+		t.Fatalf("cookies = %v, want %s", cookies, csrfCookie)
+	}
+	token := cookies[0].Value
+	if !strings.Contains(w.Body.String(), `name="csrf_token" value="`+token+`"`) {
+		t.Errorf("homepage form is missing the CSRF token")
+	}
+
+	post := func(form url.Values, header http.Header) int {
+		r := httptest.NewRequest("POST", "/add", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		for name, values := range header {
+			r.Header[name] = values
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+	browser := http.Header{
+		"Origin": {"https://evil.example"},
+		"Cookie": {csrfCookie + "=" + token},
+	}
+
+	tests := []struct {
+		name   string
+		form   url.Values
+		header http.Header
+		want   int
+	}{
+		{"form token", url.Values{"csrf_token": {token}}, browser, http.StatusNoContent},
+		{"header token", url.Values{}, http.Header{"Origin": browser["Origin"], "Cookie": browser["Cookie"], "X-Csrf-Token": {token}}, http.StatusNoContent},
+		{"missing token", url.Values{}, browser, http.StatusForbidden},
+		{"wrong token", url.Values{"csrf_token": {strings.Repeat("x", 43)}}, browser, http.StatusForbidden},
+		{"no cookie", url.Values{"csrf_token": {token}}, http.Header{"Sec-Fetch-Site": {"cross-site"}}, http.StatusForbidden},
+		{"non-browser client", url.Values{}, http.Header{}, http.StatusNoContent},
+		{"bearer token", url.Values{}, http.Header{"Origin": browser["Origin"], "Cookie": browser["Cookie"], "Authorization": {"Bearer " + tokenPrefix + "x"}}, http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		if got := post(tt.form, tt.header); got != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCSRFTokenReusesCookie(t *testing.T) {
+	s := newTestServer(t)
+	token := strings.Repeat("a", 43)
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(&http.Cookie{Name: csrfCookie, Value: token})
+	w := httptest.NewRecorder()
+	if got := s.csrfToken(w, r); got != token {
+		t.Errorf("csrfToken = %q, want the cookie's %q", got, token)
+	}
+	if len(w.Result().Cookies()) != 0 {
+		t.Errorf("csrfToken reissued an existing cookie")
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// migrationFiles are the stores kept alongside the links that -migrate
+// copies with them, as a backup holds them
+var migrationFiles = []struct {
+	name string
+	perm os.FileMode
+}{{"stars.json", 0644}, {"tokens.json", 0600}, {"proposals.json", 0644}, {"misses.json", 0644}}
+
+// migrationCheckpointFile is kept in the destination directory
+const migrationCheckpointFile = ".migration.json"
+
+// migrationCheckpoint records what -migrate has copied and verified, so a
+// migration stopped part way resumes where it left off, and running it
+// again copies only what changed since
+type migrationCheckpoint struct {
+	Files       map[string]string `json:"files"`        // file name to the SHA-256 of its verified copy
+	AuditOffset int64             `json:"audit_offset"` // bytes of the audit log copied
+	AuditHash   string            `json:"audit_hash"`   // their SHA-256
+}
+
+// migrationReport is what a migration did
+type migrationReport struct {
+	Copied       int // files copied because they were new or changed
+	Unchanged    int // files already copied as they are
+	Links        int // in the destination, loaded back to check them
+	Clicks       int
+	AuditEntries int // audit entries copied this time
+}
+
+// migrateData copies the data at dataPath, the links with their click
+// counts and history, the stores kept alongside them and the audit log at
+// auditPath (none if ""), to the links file destPath, for go-links
+// -migrate. Each copy is checked against the original before it counts as
+// done, and the links are loaded back to check they read. It runs while
+// go-links keeps serving from dataPath: run it again to copy only what
+// changed since, such as once more in maintenance mode before switching.
+func migrateData(dataPath, auditPath, destPath string) (migrationReport, error) {
+	var report migrationReport
+	from, err := filepath.Abs(dataPath)
+	if err != nil {
+		return report, err
+	}
+	to, err := filepath.Abs(destPath)
+	if err != nil {
+		return report, err
+	}
+	if filepath.Dir(from) == filepath.Dir(to) {
+		return report, errors.New("migrate into a directory other than the data's own")
+	}
+	destDir := filepath.Dir(to)
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return report, err
+	}
+
+	checkpointPath := filepath.Join(destDir, migrationCheckpointFile)
+	cp := migrationCheckpoint{Files: make(map[string]string)}
+	switch data, err := os.ReadFile(checkpointPath); {
+	case err == nil:
+		if err := json.Unmarshal(data, &cp); err != nil {
+			return report, fmt.Errorf("reading the checkpoint %s: %w", checkpointPath, err)
+		}
+		if cp.Files == nil {
+			cp.Files = make(map[string]string)
+		}
+	case !os.IsNotExist(err):
+		return report, err
+	default:
+		if _, err := os.Stat(to); err == nil {
+			return report, fmt.Errorf("%s has links that weren't migrated there; migrate into an empty directory", to)
+		}
+	}
+	save := func() error {
+		data, err := json.MarshalIndent(cp, "", "  ")
+		if err != nil {
+			return err
+		}
+		return replaceFile(checkpointPath, data, 0600)
+	}
+
+	type file struct {
+		name, from, to string
+		perm           os.FileMode
+	}
+	files := []file{{filepath.Base(to), from, to, 0644}}
+	for _, f := range migrationFiles {
+		files = append(files, file{f.name, filepath.Join(filepath.Dir(from), f.name), filepath.Join(destDir, f.name), f.perm})
+	}
+	for i, f := range files {
+		data, err := os.ReadFile(f.from)
+		if os.IsNotExist(err) && i > 0 {
+			continue
+		} else if err != nil {
+			return report, err
+		}
+		sum := hashBytes(data)
+		if copied, _ := hashFile(f.to, -1); cp.Files[f.name] == sum && copied == sum {
+			report.Unchanged++
+			continue
+		}
+		if !json.Valid(data) {
+			return report, fmt.Errorf("%s is damaged", f.from)
+		}
+		if err := replaceFile(f.to, data, f.perm); err != nil {
+			return report, fmt.Errorf("copying %s: %w", f.name, err)
+		}
+		if copied, err := hashFile(f.to, -1); err != nil || copied != sum {
+			return report, fmt.Errorf("verifying %s: the copy differs from the original", f.name)
+		}
+		cp.Files[f.name] = sum
+		if err := save(); err != nil {
+			return report, err
+		}
+		report.Copied++
+	}
+
+	migrated := &LinkStore{filePath: to}
+	if err := migrated.Load(); err != nil {
+		return report, fmt.Errorf("loading the migrated links: %w", err)
+	}
+	for _, link := range migrated.All() {
+		report.Links++
+		report.Clicks += link.Clicks
+	}
+
+	if auditPath != "" {
+		if report.AuditEntries, err = migrateAuditLog(auditPath, filepath.Join(destDir, "audit.jsonl"), &cp); err != nil {
+			return report, fmt.Errorf("copying the audit log: %w", err)
+		}
+		if err := save(); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// migrateAuditLog appends the entries added to the audit log at from since
+// the checkpoint to the copy at to, returning how many. Entries are only
+// ever appended, so each run copies just the new ones; if the log was
+// rewritten since, as scrubbing IP addresses does, it's copied afresh.
+func migrateAuditLog(from, to string, cp *migrationCheckpoint) (int, error) {
+	src, err := os.Open(from)
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(to, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return 0, err
+	}
+	defer dst.Close()
+	// Anything past the checkpoint was copied by a run that stopped early
+	if err := dst.Truncate(cp.AuditOffset); err != nil {
+		return 0, err
+	}
+	if cp.AuditOffset > 0 {
+		original, _ := hashFile(from, cp.AuditOffset)
+		copied, _ := hashFile(to, -1)
+		if original != cp.AuditHash || copied != cp.AuditHash {
+			cp.AuditOffset, cp.AuditHash = 0, ""
+			if err := dst.Truncate(0); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	if _, err := src.Seek(cp.AuditOffset, io.SeekStart); err != nil {
+		return 0, err
+	}
+	added, err := io.ReadAll(src)
+	if err != nil {
+		return 0, err
+	}
+	// Only whole entries, not one being written
+	added = added[:bytes.LastIndexByte(added, '\n')+1]
+	if len(added) == 0 {
+		return 0, nil
+	}
+	if _, err := dst.WriteAt(added, cp.AuditOffset); err != nil {
+		return 0, err
+	}
+	if err := dst.Sync(); err != nil {
+		return 0, err
+	}
+
+	offset := cp.AuditOffset + int64(len(added))
+	original, err := hashFile(from, offset)
+	if err != nil {
+		return 0, err
+	}
+	if copied, err := hashFile(to, -1); err != nil || copied != original {
+		return 0, errors.New("the copy differs from the original")
+	}
+	cp.AuditOffset, cp.AuditHash = offset, original
+	return bytes.Count(added, []byte{'\n'}), nil
+}
+
+// hashBytes returns the SHA-256 of data, in hex
+func hashBytes(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// hashFile returns the SHA-256 of the first n bytes of the file at path,
+// or all of it when n is negative, in hex
+func hashFile(path string, n int64) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	var r io.Reader = f
+	if n >= 0 {
+		r = io.LimitReader(f, n)
+	}
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
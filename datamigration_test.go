@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMigrateData(t *testing.T) {
+	src, dst := filepath.Join(t.TempDir(), "links.json"), filepath.Join(t.TempDir(), "data", "links.json")
+	audit := filepath.Join(filepath.Dir(src), "audit.jsonl")
+	copiedAudit := filepath.Join(filepath.Dir(dst), "audit.jsonl")
+	store := &LinkStore{filePath: src}
+	store.Add(Link{Shortcut: "gh", URL: "https://github.com"})
+	store.Add(Link{Shortcut: "wiki", URL: "https://wiki.example.com"})
+	for range 3 {
+		store.RecordClick("", "gh", clickSource{})
+	}
+	store.Flush()
+	os.WriteFile(filepath.Join(filepath.Dir(src), "stars.json"), []byte(`{"alice": ["gh"]}`), 0644)
+	os.WriteFile(audit, []byte("{\"action\": \"create\"}\n{\"action\": \"create\"}\n"), 0600)
+
+	migrate := func(want migrationReport) {
+		t.Helper()
+		report, err := migrateData(src, audit, dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report != want {
+			t.Errorf("migrated %+v, want %+v", report, want)
+		}
+	}
+	sameAudit := func() {
+		t.Helper()
+		original, _ := os.ReadFile(audit)
+		copied, _ := os.ReadFile(copiedAudit)
+		if whole := original[:strings.LastIndexByte(string(original), '\n')+1]; string(copied) != string(whole) {
+			t.Errorf("audit log copied as %q, want %q", copied, whole)
+		}
+	}
+
+	migrate(migrationReport{Copied: 2, Links: 2, Clicks: 3, AuditEntries: 2})
+	sameAudit()
+	if data, _ := os.ReadFile(filepath.Join(filepath.Dir(dst), "stars.json")); string(data) != `{"alice": ["gh"]}` {
+		t.Errorf("stars copied as %s", data)
+	}
+
+	// Running again copies only what changed, and not an entry being written
+	migrate(migrationReport{Unchanged: 2, Links: 2, Clicks: 3})
+	store.Add(Link{Shortcut: "ci", URL: "https://ci.example.com"})
+	f, _ := os.OpenFile(audit, os.O_WRONLY|os.O_APPEND, 0600)
+	f.WriteString("{\"action\": \"create\"}\n{\"action\": ")
+	f.Close()
+	migrate(migrationReport{Copied: 1, Unchanged: 1, Links: 3, Clicks: 3, AuditEntries: 1})
+	sameAudit()
+
+	// A run that stopped part way through the audit log carries on
+	f, _ = os.OpenFile(audit, os.O_WRONLY|os.O_APPEND, 0600)
+	f.WriteString("\"delete\"}\n")
+	f.Close()
+	f, _ = os.OpenFile(copiedAudit, os.O_WRONLY|os.O_APPEND, 0600)
+	f.WriteString("{\"action\": \"de")
+	f.Close()
+	migrate(migrationReport{Unchanged: 2, Links: 3, Clicks: 3, AuditEntries: 1})
+	sameAudit()
+
+	// A rewritten audit log, or a copy changed since, is copied afresh
+	os.WriteFile(audit, []byte("{\"action\": \"update\"}\n"), 0600)
+	os.WriteFile(filepath.Join(filepath.Dir(dst), "stars.json"), []byte(`{}`), 0644)
+	migrate(migrationReport{Copied: 1, Unchanged: 1, Links: 3, Clicks: 3, AuditEntries: 1})
+	sameAudit()
+
+	// Links already there, or the data's own directory, are refused
+	other := filepath.Join(t.TempDir(), "links.json")
+	os.WriteFile(other, []byte(`[]`), 0644)
+	if _, err := migrateData(src, audit, other); err == nil {
+		t.Error("migrated over links already there")
+	}
+	if _, err := migrateData(src, audit, filepath.Join(filepath.Dir(src), "new.json")); err == nil {
+		t.Error("migrated into the data's own directory")
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+	"strconv"
+	"time"
+)
+
+// Profiles and traces run for the number of seconds asked for, up to
+// maxProfileSeconds
+const maxProfileSeconds = 300
+
+// newDebugHandler serves profiles and runtime stats for diagnosing slow or
+// memory-hungry servers:
+//
+//	/debug/pprof/          the available profiles
+//	/debug/pprof/profile   a CPU profile, for ?seconds= (30 by default)
+//	/debug/pprof/trace     an execution trace, for ?seconds= (1 by default)
+//	/debug/pprof/{name}    heap, goroutine, allocs, block, mutex, ...
+//	/debug/runtime         memory, GC and goroutine stats as JSON
+//
+// Profiles can be read with go tool pprof. net/http/pprof isn't used, as it
+// adds itself to http.DefaultServeMux without any access control.
+func newDebugHandler(startedAt time.Time) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /debug/pprof/{$}", handleProfileIndex)
+	mux.HandleFunc("GET /debug/pprof/profile", handleCPUProfile)
+	mux.HandleFunc("GET /debug/pprof/trace", handleTrace)
+	mux.HandleFunc("GET /debug/pprof/{name}", handleProfile)
+	mux.HandleFunc("GET /debug/runtime", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(readRuntimeStats(startedAt))
+	})
+	return mux
+}
+
+// handleProfileIndex lists the available profiles
+func handleProfileIndex(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, "Profiles (add ?debug=1 for text):")
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "%-14s %s\n", "profile", "CPU profile, ?seconds=30")
+	fmt.Fprintf(w, "%-14s %s\n", "trace", "execution trace, ?seconds=1")
+	for _, profile := range pprof.Profiles() {
+		fmt.Fprintf(w, "%-14s %d\n", profile.Name(), profile.Count())
+	}
+}
+
+// handleProfile writes a named profile, after a garbage collection for
+// heap profiles asked for with ?gc=1
+func handleProfile(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	profile := pprof.Lookup(name)
+	if profile == nil {
+		http.Error(w, "Unknown profile: "+name, http.StatusNotFound)
+		return
+	}
+	debug, _ := strconv.Atoi(r.URL.Query().Get("debug"))
+	if name == "heap" && r.URL.Query().Get("gc") == "1" {
+		runtime.GC()
+	}
+	if debug > 0 {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	}
+	profile.WriteTo(w, debug)
+}
+
+// handleCPUProfile profiles the CPU for the number of seconds asked for
+func handleCPUProfile(w http.ResponseWriter, r *http.Request) {
+	seconds, err := profileSeconds(r, 30)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	allowSlowResponse(w, seconds+10*time.Second)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="profile"`)
+	if err := pprof.StartCPUProfile(w); err != nil {
+		w.Header().Del("Content-Disposition")
+		http.Error(w, "Could not start profiling: "+err.Error(), http.StatusConflict)
+		return
+	}
+	sleep(r.Context(), seconds)
+	pprof.StopCPUProfile()
+}
+
+// handleTrace traces execution for the number of seconds asked for
+func handleTrace(w http.ResponseWriter, r *http.Request) {
+	seconds, err := profileSeconds(r, 1)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	allowSlowResponse(w, seconds+10*time.Second)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="trace"`)
+	if err := trace.Start(w); err != nil {
+		w.Header().Del("Content-Disposition")
+		http.Error(w, "Could not start tracing: "+err.Error(), http.StatusConflict)
+		return
+	}
+	sleep(r.Context(), seconds)
+	trace.Stop()
+}
+
+// profileSeconds parses the seconds parameter, defaulting to def
+func profileSeconds(r *http.Request, def int) (time.Duration, error) {
+	value := r.URL.Query().Get("seconds")
+	if value == "" {
+		return time.Duration(def) * time.Second, nil
+	}
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds < 1 || seconds > maxProfileSeconds {
+		return 0, fmt.Errorf("seconds must be between 1 and %d", maxProfileSeconds)
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// sleep waits for d, or until the request is cancelled
+func sleep(ctx context.Context, d time.Duration) {
+	select {
+	case <-time.After(d):
+	case <-ctx.Done():
+	}
+}
+
+// runtimeStats is a snapshot of the Go runtime, for /debug/runtime
+type runtimeStats struct {
+	GoVersion   string    `json:"go_version"`
+	Platform    string    `json:"platform"`
+	CPUs        int       `json:"cpus"`
+	GOMAXPROCS  int       `json:"gomaxprocs"`
+	Goroutines  int       `json:"goroutines"`
+	StartedAt   time.Time `json:"started_at"`
+	Uptime      string    `json:"uptime"`
+	HeapAlloc   uint64    `json:"heap_alloc_bytes"`
+	HeapInuse   uint64    `json:"heap_inuse_bytes"`
+	HeapObjects uint64    `json:"heap_objects"`
+	Sys         uint64    `json:"sys_bytes"`
+	TotalAlloc  uint64    `json:"total_alloc_bytes"`
+	NumGC       uint32    `json:"gc_runs"`
+	GCPauseTime string    `json:"gc_pause_total"`
+	LastGC      time.Time `json:"last_gc,omitzero"`
+}
+
+func readRuntimeStats(startedAt time.Time) runtimeStats {
+	var memory runtime.MemStats
+	runtime.ReadMemStats(&memory)
+	stats := runtimeStats{
+		GoVersion:   runtime.Version(),
+		Platform:    runtime.GOOS + "/" + runtime.GOARCH,
+		CPUs:        runtime.NumCPU(),
+		GOMAXPROCS:  runtime.GOMAXPROCS(0),
+		Goroutines:  runtime.NumGoroutine(),
+		StartedAt:   startedAt,
+		Uptime:      time.Since(startedAt).Round(time.Second).String(),
+		HeapAlloc:   memory.HeapAlloc,
+		HeapInuse:   memory.HeapInuse,
+		HeapObjects: memory.HeapObjects,
+		Sys:         memory.Sys,
+		TotalAlloc:  memory.TotalAlloc,
+		NumGC:       memory.NumGC,
+		GCPauseTime: time.Duration(memory.PauseTotalNs).String(),
+	}
+	if memory.LastGC > 0 {
+		stats.LastGC = time.Unix(0, int64(memory.LastGC)).UTC()
+	}
+	return stats
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDebugEndpoints(t *testing.T) {
+	s := newTestServer(t)
+	s.admins = NewAdminAuth("", "s3cret")
+	handler := s.requireAdmin(http.StripPrefix("/admin", newDebugHandler(time.Now())).ServeHTTP)
+	get := func(path string, admin bool) *httptest.ResponseRecorder {
+		t.Helper()
+		r := httptest.NewRequest("GET", path, nil)
+		if admin {
+			r.SetBasicAuth("admin", "s3cret")
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+	}
+
+	if w := get("/admin/debug/pprof/heap", false); w.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous: status %d, want 401", w.Code)
+	}
+
+	w := get("/admin/debug/pprof/", true)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "heap") || !strings.Contains(w.Body.String(), "goroutine") {
+		t.Errorf("index: status %d\n%s", w.Code, w.Body)
+	}
+	if w = get("/admin/debug/pprof/heap", true); w.Code != http.StatusOK || w.Body.Len() == 0 || w.Header().Get("Content-Type") != "application/octet-stream" {
+		t.Errorf("heap profile: status %d, %d bytes of %s", w.Code, w.Body.Len(), w.Header().Get("Content-Type"))
+	}
+	if w = get("/admin/debug/pprof/goroutine?debug=1", true); !strings.Contains(w.Body.String(), "goroutine profile:") {
+		t.Errorf("goroutine profile as text:\n%s", w.Body)
+	}
+	if w = get("/admin/debug/pprof/nonsense", true); w.Code != http.StatusNotFound {
+		t.Errorf("unknown profile: status %d, want 404", w.Code)
+	}
+	if w = get("/admin/debug/pprof/profile?seconds=100000", true); w.Code != http.StatusBadRequest {
+		t.Errorf("overlong CPU profile: status %d, want 400", w.Code)
+	}
+	if w = get("/admin/debug/pprof/profile?seconds=1", true); w.Code != http.StatusOK || w.Body.Len() == 0 {
+		t.Errorf("CPU profile: status %d, %d bytes", w.Code, w.Body.Len())
+	}
+
+	w = get("/admin/debug/runtime", true)
+	var stats runtimeStats
+	if err := json.NewDecoder(w.Body).Decode(&stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats.Goroutines == 0 || stats.HeapAlloc == 0 || stats.GoVersion == "" {
+		t.Errorf("runtime stats = %+v", stats)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// sparkline is an inline SVG chart of a link's daily clicks
+type sparkline struct {
+	Width, Height int
+	Points        string // SVG polyline points
+	Total         int
+	Peak          int
+	Days          int
+}
+
+// newSparkline plots daily click counts for the clickHistoryDays days up to
+// and including now, oldest on the left
+func newSparkline(daily map[string]int, now time.Time) sparkline {
+	sl := sparkline{Width: 300, Height: 40, Days: clickHistoryDays}
+
+	counts := make([]int, clickHistoryDays)
+	for i := range counts {
+		day := now.AddDate(0, 0, i-clickHistoryDays+1).Format(time.DateOnly)
+		counts[i] = daily[day]
+		sl.Total += counts[i]
+	}
+	sl.Peak = slices.Max(counts)
+
+	points := make([]string, len(counts))
+	for i, n := range counts {
+		x := i * sl.Width / (len(counts) - 1)
+		y := sl.Height - 1
+		if sl.Peak > 0 {
+			y = sl.Height - 1 - n*(sl.Height-2)/sl.Peak
+		}
+		points[i] = fmt.Sprintf("%d,%d", x, y)
+	}
+	sl.Points = strings.Join(points, " ")
+	return sl
+}
+
+// handleDetail serves GET /links/{shortcut}, a page describing one link:
+// its destinations, owner, clicks over time and where they came from, and
+// earlier versions
+func (s *Server) handleDetail(w http.ResponseWriter, r *http.Request) {
+	link, exists := s.store.Get(s.hosts.Namespace(r), r.PathValue("shortcut"))
+	if !exists || !s.canSee(r, link) {
+		s.showError(w, r, http.StatusNotFound, "There's no link with that shortcut.")
+		return
+	}
+
+	// Newest revision first
+	history := slices.Clone(link.History)
+	slices.Reverse(history)
+
+	data := struct {
+		Prefix      string
+		Theme       *Theme
+		Maintenance *maintenanceState
+		CSRFToken   string
+		Lang        *translator
+		Link        Link
+		Disabled    bool
+		Sparkline   sparkline
+		Referrers   []sourceCount
+		Clients     []sourceCount
+		History     []Revision
+	}{
+		Prefix:      s.hosts.Prefix(r),
+		Theme:       s.theme.Load(),
+		Maintenance: s.maintenance.State(),
+		CSRFToken:   s.csrfToken(w, r),
+		Lang:        translatorFor(w, r),
+		Link:        link,
+		Disabled:    s.blocklist.Blocked(link.Shortcut),
+		Sparkline:   newSparkline(link.DailyClicks, time.Now().UTC()),
+		Referrers:   breakdown(link.Referrers),
+		Clients:     breakdown(link.Clients),
+		History:     history,
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	if err := templates.ExecuteTemplate(w, "link.html", data); err != nil {
+		http.Error(w, "Template execution error", http.StatusInternalServerError)
+		return
+	}
+}
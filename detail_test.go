@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDetailPageShowsHistory(t *testing.T) {
+	s := newTestServer(t, Link{Shortcut: "gh", URL: "https://github.com/old", Owner: "<b>alice</b>"})
+	if err := s.store.Add(Link{Shortcut: "gh", URL: "https://github.com/new", Owner: "bob"}); err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /links/{shortcut...}", s.handleDetail)
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/links/gh", nil))
+
+	body := w.Body.String()
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body:\n%s", w.Code, body)
+	}
+	for _, want := range []string{"https://github.com/new", "https://github.com/old", "&lt;b&gt;alice&lt;/b&gt;", "bob"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("detail page is missing %q", want)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/links/missing", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("missing link: status = %d, want 404", w.Code)
+	}
+}
+
+func TestCountDailyClickDropsOldDays(t *testing.T) {
+	now := time.Date(2024, 3, 31, 12, 0, 0, 0, time.UTC)
+	daily := map[string]int{
+		"2024-03-31": 2,
+		"2024-03-02": 5, // exactly clickHistoryDays-1 days ago
+		"2024-03-01": 7,
+	}
+
+	got := countDailyClick(daily, now)
+
+	if got["2024-03-31"] != 3 || got["2024-03-02"] != 5 {
+		t.Errorf("counts = %v", got)
+	}
+	if _, ok := got["2024-03-01"]; ok {
+		t.Errorf("kept a day older than %d days: %v", clickHistoryDays, got)
+	}
+	if daily["2024-03-31"] != 2 {
+		t.Errorf("countDailyClick modified its input")
+	}
+}
+
+func TestPrefetchesAreNotCounted(t *testing.T) {
+	s := newTestServer(t, Link{Shortcut: "wiki", URL: "https://wiki.example.com"})
+
+	follow := func(method string, header ...string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/wiki", nil)
+		if len(header) == 2 {
+			r.Header.Set(header[0], header[1])
+		}
+		w := httptest.NewRecorder()
+		s.handleHome(w, r)
+		if w.Code != http.StatusFound {
+			t.Errorf("%s %v: status = %d, want %d", method, header, w.Code, http.StatusFound)
+		}
+		return w
+	}
+
+	for _, header := range [][]string{
+		{"Sec-Purpose", "prefetch"},
+		{"Sec-Purpose", "prefetch;prerender"},
+		{"Purpose", "prefetch"},
+		{"X-Moz", "prefetch"},
+		{"X-Purpose", "preview"},
+	} {
+		if w := follow("GET", header...); w.Header().Get("Cache-Control") != "no-store" {
+			t.Errorf("%v: Cache-Control = %q, want no-store", header, w.Header().Get("Cache-Control"))
+		}
+	}
+	follow("HEAD")
+	if link, _ := s.store.Get("", "wiki"); link.Clicks != 0 {
+		t.Errorf("clicks = %d after prefetches, want 0", link.Clicks)
+	}
+
+	follow("GET")
+	follow("GET")
+	link, _ := s.store.Get("", "wiki")
+	if today := time.Now().UTC().Format(time.DateOnly); link.Clicks != 2 || link.DailyClicks[today] != 2 {
+		t.Errorf("clicks = %d, today %d, want 2", link.Clicks, link.DailyClicks[today])
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import "strings"
+
+// mobileUserAgentTokens are substrings that identify phones and tablets
+var mobileUserAgentTokens = []string{
+	"mobile",
+	"android",
+	"iphone",
+	"ipad",
+	"ipod",
+	"windows phone",
+	"blackberry",
+	"opera mini",
+}
+
+// isMobileUserAgent reports whether a User-Agent belongs to a mobile device
+func isMobileUserAgent(userAgent string) bool {
+	ua := strings.ToLower(userAgent)
+	for _, token := range mobileUserAgentTokens {
+		if strings.Contains(ua, token) {
+			return true
+		}
+	}
+	return false
+}
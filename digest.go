@@ -0,0 +1,371 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// The digest covers the digestDays days before it is sent, listing up to
+// digestTop entries in each section
+const (
+	digestDays = 7
+	digestTop  = 10
+)
+
+// DigestConfig says how and to whom the weekly digest is emailed
+type DigestConfig struct {
+	SMTPAddr string // host:port of the mail server
+	Username string // optional SMTP credentials
+	Password string
+	From     string // the sender address
+	To       string // comma-separated admin addresses
+	Owners   bool   // also email owners about their own links
+	Day      string // weekday to send on, monday by default
+	Hour     string // hour of the day to send at, 8 by default
+}
+
+// Digest emails a weekly summary of link activity: new links, the most
+// used, those whose destinations no longer work and the most wanted
+// missing shortcuts
+type Digest struct {
+	from   string
+	to     []string
+	owners bool
+	day    time.Weekday
+	hour   int
+	client *http.Client // for checking destinations
+
+	// send delivers a message, by SMTP outside tests
+	send func(to []string, msg []byte) error
+}
+
+// NewDigest creates the digest from its configuration, returning nil when
+// no mail server is configured
+func NewDigest(config DigestConfig) (*Digest, error) {
+	if config.SMTPAddr == "" {
+		return nil, nil
+	}
+	host, _, ok := strings.Cut(config.SMTPAddr, ":")
+	if !ok {
+		return nil, fmt.Errorf("mail server %q needs a port", config.SMTPAddr)
+	}
+	if config.From == "" {
+		return nil, errors.New("a sender address is required")
+	}
+	d := &Digest{
+		from:   config.From,
+		to:     splitList(config.To),
+		owners: config.Owners,
+		day:    time.Monday,
+		hour:   8,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+	if len(d.to) == 0 && !d.owners {
+		return nil, errors.New("no recipients: set admin addresses or email owners")
+	}
+	if config.Day != "" {
+		day, ok := parseWeekday(config.Day)
+		if !ok {
+			return nil, fmt.Errorf("%q isn't a day of the week", config.Day)
+		}
+		d.day = day
+	}
+	if config.Hour != "" {
+		if _, err := fmt.Sscan(config.Hour, &d.hour); err != nil || d.hour < 0 || d.hour > 23 {
+			return nil, fmt.Errorf("%q isn't an hour of the day", config.Hour)
+		}
+	}
+
+	var auth smtp.Auth
+	if config.Username != "" {
+		auth = smtp.PlainAuth("", config.Username, config.Password, host)
+	}
+	d.send = func(to []string, msg []byte) error {
+		return smtp.SendMail(config.SMTPAddr, auth, d.from, to, msg)
+	}
+	return d, nil
+}
+
+// parseWeekday parses a day name such as "monday" or "Mon"
+func parseWeekday(name string) (time.Weekday, bool) {
+	name = strings.ToLower(name)
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if full := strings.ToLower(day.String()); name == full || name == full[:3] {
+			return day, true
+		}
+	}
+	return 0, false
+}
+
+// digestLink is a link as listed in a digest
+type digestLink struct {
+	Link
+	Name   string // the shortcut, with its namespace
+	Clicks int    // in the digest period
+	Status string // why the destination is broken
+}
+
+// digestReport is the content of one digest email
+type digestReport struct {
+	Since   time.Time
+	New     []digestLink
+	Top     []digestLink
+	Broken  []digestLink
+	Missing []Miss
+}
+
+// Empty reports whether there is nothing worth sending
+func (dr digestReport) Empty() bool {
+	return len(dr.New) == 0 && len(dr.Top) == 0 && len(dr.Broken) == 0 && len(dr.Missing) == 0
+}
+
+var digestTemplate = template.Must(template.New("digest").Parse(`Link activity since {{.Since.Format "Monday, January 2"}}
+{{if .New}}
+New links
+{{range .New}}
+  go/{{.Name}} -> {{.URL}}{{with or .Owner .CreatedBy}} (by {{.}}){{end}}
+{{- end}}
+{{end}}{{if .Top}}
+Most used
+{{range .Top}}
+  go/{{.Name}}: {{.Clicks}} click{{if ne .Clicks 1}}s{{end}}
+{{- end}}
+{{end}}{{if .Broken}}
+Broken destinations
+{{range .Broken}}
+  go/{{.Name}} -> {{.URL}}: {{.Status}}
+{{- end}}
+{{end}}{{if .Missing}}
+Most wanted missing links
+{{range .Missing}}
+  go/{{with .Namespace}}{{.}}:{{end}}{{.Shortcut}}: tried {{.Count}} time{{if ne .Count 1}}s{{end}}
+{{- end}}
+{{end}}`))
+
+// digestName returns a link's shortcut with its namespace, if any
+func digestName(link Link) string {
+	if link.Namespace == "" {
+		return link.Shortcut
+	}
+	return link.Namespace + ":" + link.Shortcut
+}
+
+// Build summarizes the digestDays days up to now. With owner set, only
+// that owner's links are included and missing shortcuts are left out.
+// broken holds destination problems by URL.
+func (d *Digest) Build(s *Server, links []Link, broken map[string]string, owner string, now time.Time) digestReport {
+	report := digestReport{Since: now.AddDate(0, 0, -digestDays)}
+	for _, link := range links {
+		if owner != "" && !strings.EqualFold(cmp.Or(link.Owner, link.CreatedBy), owner) {
+			continue
+		}
+		dl := digestLink{Link: link, Name: digestName(link)}
+		for i := range digestDays {
+			dl.Clicks += link.DailyClicks[now.AddDate(0, 0, -i).Format(time.DateOnly)]
+		}
+		if link.CreatedAt.After(report.Since) {
+			report.New = append(report.New, dl)
+		}
+		if dl.Clicks > 0 {
+			report.Top = append(report.Top, dl)
+		}
+		if status, ok := broken[link.URL]; ok {
+			dl.Status = status
+			report.Broken = append(report.Broken, dl)
+		}
+	}
+	slices.SortFunc(report.New, func(a, b digestLink) int { return b.CreatedAt.Compare(a.CreatedAt) })
+	slices.SortFunc(report.Top, func(a, b digestLink) int {
+		return cmp.Or(b.Clicks-a.Clicks, strings.Compare(a.Name, b.Name))
+	})
+	slices.SortFunc(report.Broken, func(a, b digestLink) int { return strings.Compare(a.Name, b.Name) })
+	report.New = report.New[:min(digestTop, len(report.New))]
+	report.Top = report.Top[:min(digestTop, len(report.Top))]
+	if owner == "" && s.misses != nil {
+		report.Missing = s.misses.Since(report.Since, digestTop)
+	}
+	return report
+}
+
+// checkDestinations requests each web destination once, returning what is
+// wrong with those that fail or answer with an error
+func (d *Digest) checkDestinations(links []Link) map[string]string {
+	urls := make(map[string]bool)
+	for _, link := range links {
+		// Destinations with placeholders only work once filled in
+		if link.ArchivedAt.IsZero() && strings.HasPrefix(link.URL, "http") && !strings.Contains(link.URL, "{") {
+			urls[link.URL] = true
+		}
+	}
+
+	var mu sync.Mutex
+	broken := make(map[string]string)
+	queue := make(chan string)
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for u := range queue {
+				if status := d.check(u); status != "" {
+					mu.Lock()
+					broken[u] = status
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for u := range urls {
+		queue <- u
+	}
+	close(queue)
+	wg.Wait()
+	return broken
+}
+
+// check requests a destination, returning what is wrong with it or ""
+func (d *Digest) check(u string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	status := 0
+	for _, method := range []string{http.MethodHead, http.MethodGet} {
+		req, err := http.NewRequestWithContext(ctx, method, u, nil)
+		if err != nil {
+			return "invalid URL"
+		}
+		req.Header.Set("User-Agent", "go-links link checker")
+		resp, err := d.client.Do(req)
+		if err != nil {
+			var urlErr *url.Error
+			if errors.As(err, &urlErr) {
+				err = urlErr.Err
+			}
+			return err.Error()
+		}
+		resp.Body.Close()
+		// Some servers refuse HEAD requests; ask again
+		if status = resp.StatusCode; status != http.StatusMethodNotAllowed && status != http.StatusNotImplemented {
+			break
+		}
+	}
+	// Sign-in pages often refuse anonymous requests, which isn't broken
+	if status >= 400 && status != http.StatusUnauthorized && status != http.StatusForbidden {
+		return http.StatusText(status)
+	}
+	return ""
+}
+
+// message renders a report as an email to the given addresses
+func (d *Digest) message(to []string, report digestReport) ([]byte, error) {
+	var body bytes.Buffer
+	if err := digestTemplate.Execute(&body, report); err != nil {
+		return nil, err
+	}
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", d.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", "Go links weekly digest"))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(body.String(), "\n", "\r\n"))
+	return msg.Bytes(), nil
+}
+
+// Send builds the digest and emails it to the admins and, if configured,
+// to each owner about their own links. It returns how many emails were sent.
+func (d *Digest) Send(s *Server, now time.Time) (int, error) {
+	links := s.store.All()
+	broken := d.checkDestinations(links)
+
+	sent := 0
+	var errs []error
+	deliver := func(to []string, report digestReport) {
+		if report.Empty() {
+			return
+		}
+		msg, err := d.message(to, report)
+		if err == nil {
+			err = d.send(to, msg)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("emailing %s: %w", strings.Join(to, ", "), err))
+			return
+		}
+		sent++
+	}
+
+	if len(d.to) > 0 {
+		deliver(d.to, d.Build(s, links, broken, "", now))
+	}
+	if d.owners {
+		owners := make(map[string]bool)
+		for _, link := range links {
+			if owner := strings.ToLower(cmp.Or(link.Owner, link.CreatedBy)); strings.Contains(owner, "@") {
+				owners[owner] = true
+			}
+		}
+		for owner := range owners {
+			deliver([]string{owner}, d.Build(s, links, broken, owner, now))
+		}
+	}
+	return sent, errors.Join(errs...)
+}
+
+// next returns when the digest is next due after now
+func (d *Digest) next(now time.Time) time.Time {
+	due := time.Date(now.Year(), now.Month(), now.Day(), d.hour, 0, 0, 0, now.Location())
+	due = due.AddDate(0, 0, int(d.day-due.Weekday()+7)%7)
+	if !due.After(now) {
+		due = due.AddDate(0, 0, 7)
+	}
+	return due
+}
+
+// Job returns the background job sending the digest every week on the
+// configured day and hour
+func (d *Digest) Job(s *Server) Job {
+	return Job{Name: "weekly_digest", Next: d.next, LeaderOnly: true, Run: func() error {
+		sent, err := d.Send(s, time.Now())
+		log.Printf("Sent %d weekly digest emails", sent)
+		return err
+	}}
+}
+
+// handleDigest serves GET /admin/digest, a preview of the admins' digest
+func (s *Server) handleDigest(w http.ResponseWriter, r *http.Request) {
+	// Checking every destination can outlast the write timeout
+	allowSlowResponse(w, 10*time.Minute)
+	links := s.store.All()
+	report := s.digest.Build(s, links, s.digest.checkDestinations(links), "", time.Now())
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if report.Empty() {
+		fmt.Fprintln(w, "Nothing to report this week.")
+		return
+	}
+	digestTemplate.Execute(w, report)
+}
+
+// handleSendDigest serves POST /admin/digest, sending the digest now
+func (s *Server) handleSendDigest(w http.ResponseWriter, r *http.Request) {
+	allowSlowResponse(w, 10*time.Minute)
+	sent, err := s.digest.Send(s, time.Now())
+	if err != nil {
+		logFor(r).Error("Sending digest", "error", err)
+		http.Error(w, "Failed to send the digest: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	http.Redirect(w, r, "/admin?done="+url.QueryEscape(fmt.Sprintf("Sent %d digest emails", sent)), http.StatusSeeOther)
+}
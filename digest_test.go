@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDigest(t *testing.T) {
+	destinations := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/gone":
+			http.NotFound(w, r)
+		case r.URL.Path == "/no-head" && r.Method == http.MethodHead:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		case r.URL.Path == "/private":
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer destinations.Close()
+
+	now := time.Now().UTC()
+	today := now.Format(time.DateOnly)
+	s := newTestServer(t,
+		Link{Shortcut: "wiki", URL: destinations.URL + "/wiki", Owner: "alice@example.com", DailyClicks: map[string]int{today: 5}},
+		Link{Shortcut: "old", URL: destinations.URL + "/gone", Owner: "bob@example.com", DailyClicks: map[string]int{today: 1}},
+		Link{Shortcut: "form", URL: destinations.URL + "/no-head", Owner: "alice@example.com"},
+		Link{Shortcut: "hr", URL: destinations.URL + "/private"},
+		Link{Shortcut: "search", URL: destinations.URL + "/gone?q={1}"},
+	)
+	s.misses.Record("", "roadmap", now)
+
+	d, err := NewDigest(DigestConfig{SMTPAddr: "mail.example.com:25", From: "go@example.com", To: "admins@example.com", Owners: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sent := make(map[string]string)
+	d.send = func(to []string, msg []byte) error {
+		sent[strings.Join(to, ",")] = string(msg)
+		return nil
+	}
+
+	n, err := d.Send(s, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 || len(sent) != 3 {
+		t.Fatalf("sent %d emails to %v, want admins, alice and bob", n, sent)
+	}
+
+	admins := sent["admins@example.com"]
+	for _, want := range []string{"Subject: Go links weekly digest", "New links", "go/wiki: 5 clicks", "go/old: 1 click\r\n",
+		"go/old -> " + destinations.URL + "/gone: Not Found", "go/roadmap: tried 1 time"} {
+		if !strings.Contains(admins, want) {
+			t.Errorf("admins' digest is missing %q:\n%s", want, admins)
+		}
+	}
+	// Sign-in pages, servers refusing HEAD and placeholders aren't broken
+	for _, unwanted := range []string{"Unauthorized", "Method Not Allowed", "q={1}: "} {
+		if strings.Contains(admins, unwanted) {
+			t.Errorf("admins' digest mentions %q:\n%s", unwanted, admins)
+		}
+	}
+
+	alice := sent["alice@example.com"]
+	if !strings.Contains(alice, "go/wiki") || strings.Contains(alice, "go/old") || strings.Contains(alice, "roadmap") {
+		t.Errorf("alice's digest should cover only their links:\n%s", alice)
+	}
+	if bob := sent["bob@example.com"]; !strings.Contains(bob, "Not Found") {
+		t.Errorf("bob's digest should report their broken link:\n%s", bob)
+	}
+}
+
+func TestDigestSchedule(t *testing.T) {
+	d, err := NewDigest(DigestConfig{SMTPAddr: "mail.example.com:587", From: "go@example.com", To: "admins@example.com", Day: "wed", Hour: "9"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for now, want := range map[string]string{
+		"2024-06-03 12:00": "2024-06-05 09:00", // Monday
+		"2024-06-05 08:59": "2024-06-05 09:00",
+		"2024-06-05 09:00": "2024-06-12 09:00",
+		"2024-06-08 23:00": "2024-06-12 09:00",
+	} {
+		at, _ := time.Parse("2006-01-02 15:04", now)
+		if got := d.next(at).Format("2006-01-02 15:04"); got != want {
+			t.Errorf("next digest after %s = %s, want %s", now, got, want)
+		}
+	}
+
+	for _, config := range []DigestConfig{
+		{SMTPAddr: "mail.example.com", From: "go@example.com", To: "admins@example.com"},
+		{SMTPAddr: "mail.example.com:25", To: "admins@example.com"},
+		{SMTPAddr: "mail.example.com:25", From: "go@example.com"},
+		{SMTPAddr: "mail.example.com:25", From: "go@example.com", To: "admins@example.com", Day: "someday"},
+		{SMTPAddr: "mail.example.com:25", From: "go@example.com", To: "admins@example.com", Hour: "25"},
+	} {
+		if _, err := NewDigest(config); err == nil {
+			t.Errorf("NewDigest(%+v) succeeded", config)
+		}
+	}
+	if d, err := NewDigest(DigestConfig{}); d != nil || err != nil {
+		t.Errorf("NewDigest without a mail server = %v, %v; want nil, nil", d, err)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// placeholderPattern matches {*} (the whole remaining path) and {1}, {2}, ...
+// (individual path segments) in destination URLs and fragments
+var placeholderPattern = regexp.MustCompile(`\{(\*|[0-9]+)\}`)
+
+// expandDestination builds the final redirect URL for a link. Any path left
+// over after the shortcut (rest) fills the placeholders in the destination
+// and fragment; when there are no placeholders it is appended to the
+// destination path instead. The default fragment is only added when the
+// destination doesn't already carry one.
+func expandDestination(destination, fragment, rest string) string {
+	var segments []string
+	if rest != "" {
+		segments = strings.Split(rest, "/")
+	}
+
+	templated := placeholderPattern.MatchString(destination) || placeholderPattern.MatchString(fragment)
+
+	// Split the destination so each part gets the right escaping
+	base, destFragment, hasFragment := strings.Cut(destination, "#")
+	path, query, hasQuery := strings.Cut(base, "?")
+
+	path = fillPlaceholders(path, segments, url.PathEscape)
+	if !templated && rest != "" {
+		path = strings.TrimSuffix(path, "/") + "/" + joinSegments(segments, url.PathEscape)
+	}
+
+	result := path
+	if hasQuery {
+		result += "?" + fillPlaceholders(query, segments, url.QueryEscape)
+	}
+
+	switch {
+	case hasFragment:
+		result += "#" + fillPlaceholders(destFragment, segments, escapeFragment)
+	case fragment != "":
+		result += "#" + fillPlaceholders(fragment, segments, escapeFragment)
+	}
+
+	return result
+}
+
+// fillPlaceholders replaces {*} and {n} in s with escaped path segments;
+// placeholders for missing segments become empty
+func fillPlaceholders(s string, segments []string, escape func(string) string) string {
+	return placeholderPattern.ReplaceAllStringFunc(s, func(match string) string {
+		name := match[1 : len(match)-1]
+		if name == "*" {
+			return joinSegments(segments, escape)
+		}
+
+		n, err := strconv.Atoi(name)
+		if err != nil || n < 1 || n > len(segments) {
+			return ""
+		}
+		return escape(segments[n-1])
+	})
+}
+
+// joinSegments escapes each segment and joins them with slashes
+func joinSegments(segments []string, escape func(string) string) string {
+	escaped := make([]string, len(segments))
+	for i, segment := range segments {
+		escaped[i] = escape(segment)
+	}
+	return strings.Join(escaped, "/")
+}
+
+// escapeFragment escapes a value for use in a URL fragment
+func escapeFragment(s string) string {
+	return (&url.URL{Fragment: s}).EscapedFragment()
+}
@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestExpandDestination(t *testing.T) {
+	for _, tc := range []struct {
+		name                        string
+		destination, fragment, rest string
+		want                        string
+	}{
+		{"plain", "https://example.com/docs", "", "", "https://example.com/docs"},
+		{"extra path appended", "https://github.com/my-org", "", "repo/pulls", "https://github.com/my-org/repo/pulls"},
+		{"extra path after a trailing slash", "https://github.com/my-org/", "", "repo", "https://github.com/my-org/repo"},
+		{"extra path before the query", "https://example.com/search?lang=en", "", "go", "https://example.com/search/go?lang=en"},
+		{"extra path before the fragment", "https://example.com/docs#top", "", "api", "https://example.com/docs/api#top"},
+		{"whole path", "https://example.com/{*}", "", "a/b", "https://example.com/a/b"},
+		{"numbered segments", "https://jira.example.com/browse/{1}-{2}", "", "ENG/42", "https://jira.example.com/browse/ENG-42"},
+		{"missing segment", "https://example.com/{1}/{2}", "", "a", "https://example.com/a/"},
+		{"segment escaped for the path", "https://example.com/{1}", "", "a b?c", "https://example.com/a%20b%3Fc"},
+		{"query placeholder", "https://google.com/search?q={*}", "", "a b/c&d", "https://google.com/search?q=a+b/c%26d"},
+		{"query kept without extra path", "https://example.com/search?q={1}&lang=en", "", "", "https://example.com/search?q=&lang=en"},
+		{"default fragment", "https://wiki.example.com/page", "setup", "", "https://wiki.example.com/page#setup"},
+		{"destination's own fragment", "https://wiki.example.com/page#intro", "setup", "", "https://wiki.example.com/page#intro"},
+		{"fragment placeholder", "https://wiki.example.com/page", "{1}", "install", "https://wiki.example.com/page#install"},
+	} {
+		if got := expandDestination(tc.destination, tc.fragment, tc.rest); got != tc.want {
+			t.Errorf("%s: expandDestination(%q, %q, %q) = %q, want %q", tc.name, tc.destination, tc.fragment, tc.rest, got, tc.want)
+		}
+	}
+}
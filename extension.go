@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// syncedLink is a link as a browser extension caches it, enough to
+// redirect go/ addresses itself where they don't reach go-links
+type syncedLink struct {
+	Shortcut    string `json:"shortcut"`
+	URL         string `json:"url"`
+	Description string `json:"description,omitempty"`
+}
+
+// syncResponse answers GET /api/sync. When Full is set the links replace
+// the extension's whole cache; otherwise they update it, and Removed lists
+// the shortcuts it should forget.
+type syncResponse struct {
+	SyncedAt time.Time    `json:"synced_at"`
+	Full     bool         `json:"full"`
+	Links    []syncedLink `json:"links"`
+	Removed  []string     `json:"removed,omitempty"`
+}
+
+// handleSync serves GET /api/sync?since=..., the links a browser
+// extension caches, changed since the synced_at of its last sync. Without
+// since, or when links have been deleted since then, every link is sent.
+func (s *Server) handleSync(w http.ResponseWriter, r *http.Request) {
+	var since time.Time
+	if v := r.URL.Query().Get("since"); v != "" {
+		var err error
+		if since, err = time.Parse(time.RFC3339Nano, v); err != nil {
+			http.Error(w, "since must be a time such as 2024-01-02T15:04:05Z", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Taken before reading, so a link changed meanwhile is sent again next
+	// time rather than missed
+	now := time.Now().UTC()
+	links, full := s.store.Changes(s.hosts.Namespace(r), since)
+	response := syncResponse{SyncedAt: now, Full: full, Links: []syncedLink{}}
+	for _, link := range links {
+		if !s.mayFollow(r, link) || !link.ArchivedAt.IsZero() || s.blocklist.Blocked(link.Shortcut) {
+			if !full {
+				response.Removed = append(response.Removed, link.Shortcut)
+			}
+			continue
+		}
+		response.Links = append(response.Links, syncedLink{
+			Shortcut:    link.Shortcut,
+			URL:         link.URL,
+			Description: link.Description,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(response)
+}
+
+// handleQuickAdd serves POST /api/links, adding a link from the same
+// fields as the add form, such as from a browser extension's "add this
+// page" button. Unlike the form it never changes an existing link.
+func (s *Server) handleQuickAdd(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	shortcut := strings.TrimPrefix(strings.TrimSpace(r.FormValue("shortcut")), s.hosts.Prefix(r)+"/")
+	if shortcut == "" {
+		http.Error(w, "Shortcut is required", http.StatusBadRequest)
+		return
+	}
+	if s.blocklist.Blocked(shortcut) {
+		http.Error(w, fmt.Sprintf("Shortcut %q is not allowed, please choose another", shortcut), http.StatusBadRequest)
+		return
+	}
+	link, err := s.linkFromForm(r, shortcut)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if _, exists := s.store.Get(link.Namespace, shortcut); exists {
+		http.Error(w, "Link already exists", http.StatusConflict)
+		return
+	}
+	if !s.mayAdd(r, link.Namespace, shortcut) {
+		http.Error(w, "That shortcut belongs to someone else, please choose another", http.StatusForbidden)
+		return
+	}
+	if status, message := s.quotaRefusal(w, r); status != 0 {
+		http.Error(w, message, status)
+		return
+	}
+
+	link.CreatedBy = s.currentUser(r)
+	span := startSpan(r, "LinkStore.Add", linkAttrs(link.Namespace, shortcut)...)
+	err = s.store.Add(link)
+	span.End()
+	if err != nil {
+		logFor(r).Error("Saving link", "shortcut", shortcut, "error", err)
+		http.Error(w, "Failed to save link", http.StatusInternalServerError)
+		return
+	}
+	saved, _ := s.store.Get(link.Namespace, shortcut)
+	s.audit(r, nil, auditLink(saved, true))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(saved)
+}
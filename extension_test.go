@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSync(t *testing.T) {
+	s := newTestServer(t,
+		Link{Shortcut: "gh", URL: "https://github.com", Description: "GitHub"},
+		Link{Shortcut: "hr", URL: "https://hr.example.com", VisibleTo: []string{"people"}},
+	)
+	sync := func(since time.Time) syncResponse {
+		t.Helper()
+		target := "/api/sync"
+		if !since.IsZero() {
+			target += "?since=" + url.QueryEscape(since.Format(time.RFC3339Nano))
+		}
+		w := httptest.NewRecorder()
+		s.handleSync(w, httptest.NewRequest("GET", target, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s: status %d: %s", target, w.Code, w.Body)
+		}
+		var response syncResponse
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+		return response
+	}
+	shortcuts := func(links []syncedLink) []string {
+		var names []string
+		for _, link := range links {
+			names = append(names, link.Shortcut)
+		}
+		slices.Sort(names)
+		return names
+	}
+
+	first := sync(time.Time{})
+	if !first.Full || !slices.Equal(shortcuts(first.Links), []string{"gh"}) {
+		t.Fatalf("first sync = %+v, want every link the visitor may follow", first)
+	}
+
+	s.store.Add(Link{Shortcut: "docs", URL: "https://docs.example.com"})
+	s.store.Mark("", "gh", func(link Link) Link { link.ArchivedAt = time.Now(); return link })
+	delta := sync(first.SyncedAt)
+	if delta.Full || !slices.Equal(shortcuts(delta.Links), []string{"docs"}) || !slices.Equal(delta.Removed, []string{"gh"}) {
+		t.Errorf("delta sync = %+v, want docs added and gh removed", delta)
+	}
+	if unchanged := sync(delta.SyncedAt); unchanged.Full || len(unchanged.Links) != 0 || len(unchanged.Removed) != 0 {
+		t.Errorf("sync with nothing changed = %+v", unchanged)
+	}
+
+	s.store.Delete("", "docs")
+	if afterDelete := sync(delta.SyncedAt); !afterDelete.Full || len(afterDelete.Links) != 0 {
+		t.Errorf("sync after a deletion = %+v, want a full sync", afterDelete)
+	}
+
+	w := httptest.NewRecorder()
+	s.handleSync(w, httptest.NewRequest("GET", "/api/sync?since=yesterday", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("bad since: status %d, want 400", w.Code)
+	}
+}
+
+func TestQuickAdd(t *testing.T) {
+	s := newTestServer(t, Link{Shortcut: "gh", URL: "https://github.com"})
+	s.signInToEdit = true
+	_, secret, err := s.tokens.Create("alice", "extension", scopeWrite, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := s.csrfProtect(s.requireEditor(s.handleQuickAdd))
+
+	add := func(form url.Values, token string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/api/links", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		// Sent from the extension, as a browser would
+		r.Header.Set("Origin", "chrome-extension://abcdef")
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	w := add(url.Values{"shortcut": {"go/docs"}, "url": {"https://docs.example.com"}}, secret)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("quick add: status %d: %s", w.Code, w.Body)
+	}
+	if link, ok := s.store.Get("", "docs"); !ok || link.CreatedBy != "alice" {
+		t.Errorf("saved link = %+v, %v; want docs created by alice", link, ok)
+	}
+
+	tests := []struct {
+		name  string
+		form  url.Values
+		token string
+		want  int
+	}{
+		{"existing", url.Values{"shortcut": {"gh"}, "url": {"https://example.com"}}, secret, http.StatusConflict},
+		{"invalid URL", url.Values{"shortcut": {"bad"}, "url": {"javascript:alert(1)"}}, secret, http.StatusBadRequest},
+		{"no shortcut", url.Values{"url": {"https://example.com"}}, secret, http.StatusBadRequest},
+		{"browser without a token", url.Values{"shortcut": {"wiki"}, "url": {"https://wiki.example.com"}}, "", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		if w := add(tt.form, tt.token); w.Code != tt.want {
+			t.Errorf("%s: status %d, want %d: %s", tt.name, w.Code, tt.want, w.Body)
+		}
+	}
+	if link, _ := s.store.Get("", "gh"); link.URL != "https://github.com" {
+		t.Errorf("quick add changed an existing link to %s", link.URL)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+)
+
+// Fallback sends requests for unknown shortcuts to an upstream (legacy)
+// shortener, so traffic can move over gradually during a migration
+type Fallback struct {
+	upstream *url.URL
+	proxy    *httputil.ReverseProxy
+}
+
+// NewFallback creates a fallback to upstream. Mode "redirect" (the default)
+// sends the browser to the upstream; "proxy" forwards the request, without
+// the cookies and credentials sent to go-links, and relays the upstream's
+// response. An empty upstream disables the fallback.
+func NewFallback(upstream, mode string) (*Fallback, error) {
+	if upstream == "" {
+		return nil, nil
+	}
+
+	u, err := url.Parse(upstream)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("fallback upstream %q must be an http(s) URL", upstream)
+	}
+
+	f := &Fallback{upstream: u}
+	switch mode {
+	case "", "redirect":
+	case "proxy":
+		f.proxy = &httputil.ReverseProxy{
+			Rewrite: func(pr *httputil.ProxyRequest) {
+				pr.SetURL(u)
+				pr.SetXForwarded()
+				// Sessions, CSRF cookies and API tokens are go-links' own
+				for _, header := range []string{"Cookie", "Authorization", "Proxy-Authorization"} {
+					pr.Out.Header.Del(header)
+				}
+			},
+			ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+				log.Printf("Fallback proxy error for %s: %v", r.URL.Path, err)
+				http.Error(w, "Upstream shortener unavailable", http.StatusBadGateway)
+			},
+		}
+	default:
+		return nil, fmt.Errorf("unknown fallback mode %q (use redirect or proxy)", mode)
+	}
+
+	return f, nil
+}
+
+// ServeHTTP hands an unknown shortcut to the upstream shortener
+func (f *Fallback) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if f.proxy != nil {
+		f.proxy.ServeHTTP(w, r)
+		return
+	}
+
+	target := *f.upstream
+	target.Path = strings.TrimSuffix(f.upstream.Path, "/") + r.URL.Path
+	target.RawPath = ""
+	target.RawQuery = r.URL.RawQuery
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
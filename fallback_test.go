@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFallbackProxy(t *testing.T) {
+	var got http.Header
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		w.Write([]byte("legacy " + r.URL.Path))
+	}))
+	defer upstream.Close()
+	f, err := NewFallback(upstream.URL, "proxy")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest("GET", "/old-link", nil)
+	r.Header.Set("Cookie", "go_links_session=secret; go_links_csrf=token")
+	r.Header.Set("Authorization", "Bearer gl_secret")
+	r.Header.Set("Proxy-Authorization", "Basic c2VjcmV0")
+	r.Header.Set("Accept-Language", "en")
+	w := httptest.NewRecorder()
+	f.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || w.Body.String() != "legacy /old-link" {
+		t.Fatalf("proxied: status %d: %s", w.Code, w.Body)
+	}
+	for _, header := range []string{"Cookie", "Authorization", "Proxy-Authorization"} {
+		if value := got.Get(header); value != "" {
+			t.Errorf("upstream got %s: %s", header, value)
+		}
+	}
+	if got.Get("Accept-Language") != "en" || got.Get("X-Forwarded-For") == "" {
+		t.Errorf("upstream got headers %v, want the rest forwarded", got)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"cmp"
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+)
+
+// feedSize is how many of the newest links the feed lists
+const feedSize = 50
+
+// listedLinks returns the links in the request's namespace that belong in
+// a sitemap or feed: those it can see, except hidden and archived ones
+func (s *Server) listedLinks(r *http.Request) []Link {
+	var links []Link
+	for _, link := range s.visibleLinks(r, s.hosts.Namespace(r)) {
+		if !link.Hidden && link.ArchivedAt.IsZero() {
+			links = append(links, link)
+		}
+	}
+	return links
+}
+
+// detailURL returns the absolute URL of a link's details page
+func detailURL(r *http.Request, shortcut string) string {
+	return baseURL(r) + (&url.URL{Path: "/links/" + shortcut}).EscapedPath()
+}
+
+// sitemapURLSet is a sitemap, as read by search crawlers
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+// sitemapURL is a page in a sitemap
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+// handleSitemap serves GET /sitemap.xml, listing the homepage and each
+// link's details page so an intranet search crawler indexes the shortcuts
+func (s *Server) handleSitemap(w http.ResponseWriter, r *http.Request) {
+	links := s.listedLinks(r)
+	slices.SortFunc(links, func(a, b Link) int { return cmp.Compare(a.Shortcut, b.Shortcut) })
+
+	sitemap := sitemapURLSet{URLs: []sitemapURL{{Loc: baseURL(r) + "/"}}}
+	for _, link := range links {
+		changed := link.CreatedAt
+		if link.UpdatedAt.After(changed) {
+			changed = link.UpdatedAt
+		}
+		entry := sitemapURL{Loc: detailURL(r, link.Shortcut)}
+		if !changed.IsZero() {
+			entry.LastMod = changed.UTC().Format(time.RFC3339)
+		}
+		sitemap.URLs = append(sitemap.URLs, entry)
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	w.Write([]byte(xml.Header))
+	xml.NewEncoder(w).Encode(sitemap)
+}
+
+// atomFeed is an Atom feed of new links
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  atomPerson  `xml:"author"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+// atomEntry is a new link in the feed
+type atomEntry struct {
+	ID        string      `xml:"id"`
+	Title     string      `xml:"title"`
+	Published string      `xml:"published"`
+	Updated   string      `xml:"updated"`
+	Author    *atomPerson `xml:"author,omitempty"`
+	Links     []atomLink  `xml:"link"`
+	Summary   string      `xml:"summary"`
+}
+
+// atomLink is a link from a feed or entry to a web page
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+// atomPerson is the author of a feed or entry
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+// handleFeed serves GET /feed.xml, an Atom feed of the newest links, so
+// people can follow new shortcuts in a feed reader
+func (s *Server) handleFeed(w http.ResponseWriter, r *http.Request) {
+	links := s.listedLinks(r)
+	slices.SortFunc(links, func(a, b Link) int { return b.CreatedAt.Compare(a.CreatedAt) })
+	links = links[:min(len(links), feedSize)]
+
+	prefix := s.hosts.Prefix(r)
+	base := baseURL(r)
+	feed := atomFeed{
+		ID:      base + "/feed.xml",
+		Title:   "New " + prefix + "/ links",
+		Updated: time.Now().UTC().Format(time.RFC3339),
+		Author:  atomPerson{Name: "go-links"},
+		Links:   []atomLink{{Rel: "self", Href: base + "/feed.xml"}, {Href: base + "/"}},
+	}
+	if len(links) > 0 {
+		feed.Updated = links[0].CreatedAt.UTC().Format(time.RFC3339)
+	}
+	for _, link := range links {
+		created := link.CreatedAt.UTC().Format(time.RFC3339)
+		entry := atomEntry{
+			ID:        detailURL(r, link.Shortcut),
+			Title:     prefix + "/" + link.Shortcut,
+			Published: created,
+			Updated:   created,
+			Links:     []atomLink{{Href: detailURL(r, link.Shortcut)}, {Rel: "related", Href: link.URL}},
+			Summary:   "→ " + link.URL,
+		}
+		if link.Description != "" {
+			entry.Summary = link.Description + " " + entry.Summary
+		}
+		if link.CreatedBy != "" {
+			entry.Author = &atomPerson{Name: link.CreatedBy}
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	w.Header().Set("Content-Type", "application/atom+xml")
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	w.Write([]byte(xml.Header))
+	xml.NewEncoder(w).Encode(feed)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSitemapAndFeed(t *testing.T) {
+	s := newTestServer(t,
+		Link{Shortcut: "gh", URL: "https://github.com", Description: "GitHub", CreatedBy: "alice"},
+		Link{Shortcut: "team/wiki", URL: "https://wiki.example.com"},
+		Link{Shortcut: "secret", URL: "https://secret.example.com", Hidden: true},
+		Link{Shortcut: "pay", URL: "https://pay.example.com", VisibleTo: []string{"finance"}},
+	)
+	s.store.Mark("", "gh", func(link Link) Link { link.CreatedAt = time.Now().Add(-time.Hour); return link })
+
+	w := httptest.NewRecorder()
+	s.handleSitemap(w, httptest.NewRequest("GET", "http://go/sitemap.xml", nil))
+	var sitemap sitemapURLSet
+	if err := xml.Unmarshal(w.Body.Bytes(), &sitemap); err != nil {
+		t.Fatalf("sitemap: %v\n%s", err, w.Body)
+	}
+	var locs []string
+	for _, u := range sitemap.URLs {
+		locs = append(locs, u.Loc)
+	}
+	if want := []string{"http://go/", "http://go/links/gh", "http://go/links/team/wiki"}; !slices.Equal(locs, want) {
+		t.Errorf("sitemap = %v, want %v", locs, want)
+	}
+
+	w = httptest.NewRecorder()
+	s.handleFeed(w, httptest.NewRequest("GET", "http://go/feed.xml", nil))
+	var feed atomFeed
+	if err := xml.Unmarshal(w.Body.Bytes(), &feed); err != nil {
+		t.Fatalf("feed: %v\n%s", err, w.Body)
+	}
+	if len(feed.Entries) != 2 || feed.Entries[0].Title != "go/team/wiki" || feed.Entries[1].Title != "go/gh" {
+		t.Fatalf("feed entries = %+v, want the newest first", feed.Entries)
+	}
+	if gh := feed.Entries[1]; gh.Summary != "GitHub → https://github.com" || gh.Author == nil || gh.Author.Name != "alice" {
+		t.Errorf("go/gh entry = %+v", gh)
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// gitLinksFile is the file in the Git repository holding the links
+const gitLinksFile = "links.yaml"
+
+// GitRepo commits the links to a local Git repository after every change,
+// and optionally pushes them to a remote, for history, review and a copy
+// to recover from. The repository holds the links as a YAML export, the
+// fields people edit without click counts, so each commit is one change, or
+// the few made while the last was being committed.
+type GitRepo struct {
+	dir    string
+	remote string
+	branch string
+
+	start   sync.Once
+	wake    chan struct{} // signalled when there are changes to commit
+	mu      sync.Mutex
+	hosts   *HostMap
+	links   func() []Link // the links as they are now
+	pending []AuditEntry  // changes not committed yet
+}
+
+// NewGitRepo sets up committing to the Git repository in dir, with an
+// optional remote to push to and the branch to commit on ("main" by
+// default); Init creates the repository. Without a directory it returns
+// nil: changes aren't committed.
+func NewGitRepo(dir, remote, branch string) (*GitRepo, error) {
+	if dir = strings.TrimSpace(dir); dir == "" {
+		return nil, nil
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil, fmt.Errorf("git isn't installed: %w", err)
+	}
+	g := &GitRepo{
+		dir:    dir,
+		remote: strings.TrimSpace(remote),
+		branch: cmp.Or(strings.TrimSpace(branch), "main"),
+		wake:   make(chan struct{}, 1),
+	}
+	return g, nil
+}
+
+// Init creates the repository, if it doesn't exist yet
+func (g *GitRepo) Init() error {
+	if err := os.MkdirAll(g.dir, 0755); err != nil {
+		return err
+	}
+	if _, err := os.Stat(filepath.Join(g.dir, ".git")); os.IsNotExist(err) {
+		if _, err := g.git("init", "-q", "-b", g.branch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Check reports whether the repository could be used, without creating
+// it: the directory, or the closest one above it, is a directory, and the
+// remote answers
+func (g *GitRepo) Check() (string, error) {
+	for dir := g.dir; ; dir = filepath.Dir(dir) {
+		info, err := os.Stat(dir)
+		if err == nil && !info.IsDir() {
+			return "", fmt.Errorf("%s is not a directory", dir)
+		}
+		if err == nil || dir == filepath.Dir(dir) {
+			break
+		}
+	}
+	if g.remote == "" {
+		return "", nil
+	}
+	cmd := exec.Command("git", "ls-remote", "--heads", g.remote, g.branch)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("git ls-remote %s: %v: %s", g.remote, err, bytes.TrimSpace(out))
+	}
+	return "pushing to " + g.remote, nil
+}
+
+// Commit commits the links links returns, as they are after the changes in
+// entries, in the background so whoever made them isn't kept waiting.
+// Changes made while a commit is under way, such as when the remote is
+// slow, are committed together next, with the links as they are then.
+func (g *GitRepo) Commit(hosts *HostMap, links func() []Link, entries []AuditEntry) {
+	g.start.Do(func() {
+		go func() {
+			for range g.wake {
+				if err := g.commit(); err != nil {
+					log.Printf("Warning: Could not commit links to Git: %v", err)
+				}
+			}
+		}()
+	})
+	g.mu.Lock()
+	g.hosts, g.links = hosts, links
+	for _, entry := range entries {
+		// Only what the commit message needs is kept
+		entry.Old, entry.New = nil, nil
+		g.pending = append(g.pending, entry)
+	}
+	g.mu.Unlock()
+	select {
+	case g.wake <- struct{}{}:
+	default:
+		// A commit is already due, and will take these changes too
+	}
+}
+
+// commit writes the links to the repository and commits the changes
+// pending, pulling first and pushing after when there's a remote. Nothing
+// is committed when the links in the repository are already the same, such
+// as after a change reviewed in the remote repository is applied, and
+// nothing is written while such a change hasn't been applied yet, as that
+// would undo it; the changes stay pending until it is.
+func (g *GitRepo) commit() error {
+	g.mu.Lock()
+	hosts, links, entries := g.hosts, g.links, g.pending
+	g.pending = nil
+	g.mu.Unlock()
+	if len(entries) == 0 {
+		return nil
+	}
+	message, author := gitMessage(hosts, entries)
+	snapshot := links()
+
+	base := g.committed()
+	if g.remote != "" {
+		// An empty remote has nothing to pull yet
+		if _, err := g.git("ls-remote", "--exit-code", "--heads", g.remote, g.branch); err == nil {
+			if _, err := g.git("pull", "-q", "--rebase", g.remote, g.branch); err != nil {
+				g.git("rebase", "--abort")
+				return err
+			}
+		}
+	}
+
+	slices.SortFunc(snapshot, func(a, b Link) int {
+		return cmp.Or(cmp.Compare(a.Namespace, b.Namespace), cmp.Compare(a.Shortcut, b.Shortcut))
+	})
+	var buf bytes.Buffer
+	if err := writeLinksYAML(&buf, snapshot, linkColumns, nil); err != nil {
+		return err
+	}
+	if g.changedUpstream(base, buf.Bytes()) {
+		g.mu.Lock()
+		g.pending = append(entries, g.pending...)
+		g.mu.Unlock()
+		return fmt.Errorf("%s was changed in the repository in ways the links don't have yet, so nothing is committed until they're applied, such as with POST /api/apply", gitLinksFile)
+	}
+	if err := replaceFile(filepath.Join(g.dir, gitLinksFile), buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	if _, err := g.git("add", gitLinksFile); err != nil {
+		return err
+	}
+	if _, err := g.git("diff", "--cached", "--quiet"); err == nil {
+		return nil
+	}
+
+	args := []string{"commit", "-q", "-m", message}
+	if author != "" {
+		args = append(args, "--author", author)
+	}
+	if _, err := g.git(args...); err != nil {
+		return err
+	}
+	if g.remote != "" {
+		if _, err := g.git("push", "-q", g.remote, "HEAD:"+g.branch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// committed returns the links file as last committed, or nil when there's
+// no commit yet
+func (g *GitRepo) committed() []byte {
+	out, err := g.git("cat-file", "-p", "HEAD:"+gitLinksFile)
+	if err != nil {
+		return nil
+	}
+	return []byte(out)
+}
+
+// changedUpstream reports whether the links file committed, after pulling,
+// has changes since base, as it was before, that ours, the links file to
+// write, lacks: merging those changes into ours would change it, or they
+// conflict with changes made here.
+func (g *GitRepo) changedUpstream(base, ours []byte) bool {
+	theirs := g.committed()
+	if bytes.Equal(theirs, base) || bytes.Equal(theirs, ours) {
+		return false
+	}
+	tmp, err := os.MkdirTemp("", "go-links-merge-*")
+	if err != nil {
+		return true
+	}
+	defer os.RemoveAll(tmp)
+	var paths []string
+	for i, data := range [][]byte{ours, base, theirs} {
+		path := filepath.Join(tmp, strconv.Itoa(i))
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			return true
+		}
+		paths = append(paths, path)
+	}
+	merged, err := g.git(append([]string{"merge-file", "-q", "-p"}, paths...)...)
+	return err != nil || merged != string(ours)
+}
+
+// git runs a git command in the repository, committing as go-links
+func (g *GitRepo) git(args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-c", "user.name=go-links", "-c", "user.email=go-links@localhost"}, args...)...)
+	cmd.Dir = g.dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %v: %s", args[0], err, bytes.TrimSpace(out))
+	}
+	return string(out), nil
+}
+
+// gitActions describe audit actions in commit messages
+var gitActions = map[string]string{
+	auditCreate:  "Add",
+	auditUpdate:  "Change",
+	auditDelete:  "Delete",
+	auditMove:    "Move",
+	auditReload:  "Reload",
+	auditArchive: "Archive",
+	auditRestore: "Restore",
+}
+
+// gitMessage describes a change for its commit message, such as "Add
+// go/gh", and returns the author to credit it to, if one person made it
+func gitMessage(hosts *HostMap, entries []AuditEntry) (message, author string) {
+	var lines []string
+	actors := make(map[string]bool)
+	for _, entry := range entries {
+		action := cmp.Or(gitActions[entry.Action], entry.Action)
+		if entry.Shortcut == "" {
+			lines = append(lines, action+" links")
+		} else {
+			lines = append(lines, action+" "+hosts.PrefixFor(entry.Namespace)+"/"+entry.Shortcut)
+		}
+		actors[entry.Actor] = true
+	}
+	switch {
+	case len(lines) == 0:
+		message = "Update links"
+	case len(lines) == 1:
+		message = lines[0]
+	default:
+		message = fmt.Sprintf("Change %d links\n\n%s", len(lines), strings.Join(lines, "\n"))
+	}
+
+	if len(actors) == 1 && len(entries) > 0 && entries[0].Actor != "" {
+		actor := entries[0].Actor
+		email := actor
+		if !strings.Contains(email, "@") {
+			email += "@go-links"
+		}
+		author = fmt.Sprintf("%s <%s>", actor, email)
+	}
+	return message, author
+}
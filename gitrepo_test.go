@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGitRepo(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git isn't installed")
+	}
+	remote := filepath.Join(t.TempDir(), "remote.git")
+	if out, err := exec.Command("git", "init", "-q", "--bare", "-b", "main", remote).CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v: %s", err, out)
+	}
+	s := newTestServer(t)
+	dir := filepath.Join(t.TempDir(), "links")
+	var err error
+	if s.gitRepo, err = NewGitRepo(dir, remote, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.gitRepo.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	add := func(link Link) {
+		s.store.Add(link)
+		saved, _ := s.store.Get(link.Namespace, link.Shortcut)
+		entry := s.linkEntry(httptest.NewRequest("POST", "/add", nil), nil, &saved)
+		entry.Actor = "alice"
+		s.record(entry)
+	}
+	// Commits are made in the background, and pushed
+	var log string
+	pushed := func(commits int) {
+		t.Helper()
+		for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+			out, _ := exec.Command("git", "-C", remote, "log", "--format=%an|%s", "main").Output()
+			if log = string(out); strings.Count(log, "\n") == commits {
+				return
+			}
+		}
+	}
+	add(Link{Shortcut: "gh", URL: "https://github.com", Clicks: 5})
+	pushed(1)
+	add(Link{Shortcut: "wiki", URL: "https://wiki.example.com"})
+	pushed(2)
+	if want := "alice|Add go/wiki\nalice|Add go/gh\n"; log != want {
+		t.Fatalf("remote log = %q, want %q", log, want)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, gitLinksFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file := string(data); !strings.Contains(file, "shortcut: wiki") || strings.Contains(file, "clicks") {
+		t.Errorf("%s =\n%s", gitLinksFile, file)
+	}
+}
+
+func TestGitRepoUpstreamChanges(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git isn't installed")
+	}
+	tmp := t.TempDir()
+	remote := filepath.Join(tmp, "remote.git")
+	if out, err := exec.Command("git", "init", "-q", "--bare", "-b", "main", remote).CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v: %s", err, out)
+	}
+	g, _ := NewGitRepo(filepath.Join(tmp, "links"), remote, "")
+	if err := g.Init(); err != nil {
+		t.Fatal(err)
+	}
+	hosts, _ := NewHostMap("")
+	links := []Link{{Shortcut: "gh", URL: "https://github.com"}}
+	commit := func(shortcut string) error {
+		snapshot := slices.Clone(links)
+		g.mu.Lock()
+		g.hosts, g.links = hosts, func() []Link { return snapshot }
+		g.pending = append(g.pending, AuditEntry{Action: auditCreate, Shortcut: shortcut})
+		g.mu.Unlock()
+		return g.commit()
+	}
+	if err := commit("gh"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A change reviewed and merged in the remote repository
+	review := &GitRepo{dir: filepath.Join(tmp, "review")}
+	if out, err := exec.Command("git", "clone", "-q", remote, review.dir).CombinedOutput(); err != nil {
+		t.Fatalf("git clone: %v: %s", err, out)
+	}
+	file := filepath.Join(review.dir, gitLinksFile)
+	data, _ := os.ReadFile(file)
+	os.WriteFile(file, []byte(strings.Replace(string(data), "https://github.com", "https://github.com/my-org", 1)), 0644)
+	for _, args := range [][]string{{"commit", "-q", "-am", "Change go/gh"}, {"push", "-q", "origin", "HEAD:main"}} {
+		if _, err := review.git(args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	remoteFile := func() string {
+		out, _ := exec.Command("git", "-C", remote, "show", "main:"+gitLinksFile).Output()
+		return string(out)
+	}
+
+	// Isn't undone by a change made here before it's applied
+	links = append(links, Link{Shortcut: "wiki", URL: "https://wiki.example.com"})
+	if err := commit("wiki"); err == nil {
+		t.Error("committed over a change made in the remote repository")
+	}
+	if file := remoteFile(); !strings.Contains(file, "https://github.com/my-org") || strings.Contains(file, "wiki") {
+		t.Errorf("remote %s =\n%s", gitLinksFile, file)
+	}
+
+	// Once applied, both are committed
+	links[0].URL = "https://github.com/my-org"
+	if err := commit("gh"); err != nil {
+		t.Fatal(err)
+	}
+	if file := remoteFile(); !strings.Contains(file, "https://github.com/my-org") || !strings.Contains(file, "wiki") {
+		t.Errorf("remote %s =\n%s", gitLinksFile, file)
+	}
+	out, _ := exec.Command("git", "-C", remote, "log", "-1", "--format=%B", "main").Output()
+	if message := string(out); !strings.Contains(message, "Add go/wiki") {
+		t.Errorf("commit message %q doesn't include the change kept pending", message)
+	}
+}
+
+func TestGitRepoBatches(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git isn't installed")
+	}
+	dir := filepath.Join(t.TempDir(), "links")
+	g, err := NewGitRepo(dir, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Init(); err != nil {
+		t.Fatal(err)
+	}
+	hosts, _ := NewHostMap("")
+
+	// Changes faster than they can be committed never keep anyone waiting,
+	// and are committed together
+	var links []Link
+	start := time.Now()
+	for i := range 500 {
+		links = append(links, Link{Shortcut: fmt.Sprintf("link%03d", i), URL: "https://example.com"})
+		snapshot := slices.Clone(links)
+		g.Commit(hosts, func() []Link { return snapshot }, []AuditEntry{{Action: auditCreate, Shortcut: links[i].Shortcut}})
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("500 changes took %v to hand over", elapsed)
+	}
+
+	var commits int
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		data, _ := os.ReadFile(filepath.Join(dir, gitLinksFile))
+		if strings.Contains(string(data), "shortcut: link499") {
+			out, _ := g.git("rev-list", "--count", "HEAD")
+			commits, _ = strconv.Atoi(strings.TrimSpace(out))
+			break
+		}
+	}
+	if commits == 0 || commits >= 500 {
+		t.Errorf("500 changes made %d commits, want a few batches", commits)
+	}
+}
+
+func TestGitRepoCheck(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git isn't installed")
+	}
+	tmp := t.TempDir()
+	remote := filepath.Join(tmp, "remote.git")
+	if out, err := exec.Command("git", "init", "-q", "--bare", "-b", "main", remote).CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v: %s", err, out)
+	}
+
+	// Checking creates nothing
+	dir := filepath.Join(tmp, "data", "links")
+	g, _ := NewGitRepo(dir, remote, "")
+	if _, err := g.Check(); err != nil {
+		t.Errorf("check: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmp, "data")); !os.IsNotExist(err) {
+		t.Errorf("check created the repository's directory: %v", err)
+	}
+
+	g, _ = NewGitRepo(dir, filepath.Join(tmp, "missing.git"), "")
+	if _, err := g.Check(); err == nil {
+		t.Error("check passed with a missing remote")
+	}
+	os.WriteFile(filepath.Join(tmp, "data"), nil, 0644)
+	g, _ = NewGitRepo(dir, "", "")
+	if _, err := g.Check(); err == nil {
+		t.Error("check passed with a file in the way")
+	}
+}
+
+func TestGitMessage(t *testing.T) {
+	hosts, _ := NewHostMap("wiki")
+	message, author := gitMessage(hosts, []AuditEntry{
+		{Action: auditUpdate, Namespace: "wiki", Shortcut: "onboarding", Actor: "bob@example.com"},
+		{Action: auditDelete, Shortcut: "old", Actor: "bob@example.com"},
+	})
+	if want := "Change 2 links\n\nChange wiki/onboarding\nDelete go/old"; message != want || author != "bob@example.com <bob@example.com>" {
+		t.Errorf("gitMessage = %q, %q; want %q", message, author, want)
+	}
+	if message, author = gitMessage(hosts, []AuditEntry{{Action: auditReload}}); message != "Reload links" || author != "" {
+		t.Errorf("reload message = %q, %q", message, author)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// groupOwnerPrefix marks a link's owner as a group rather than a user, e.g.
+// "group:Platform", so the link stays in the team's hands when people leave
+const groupOwnerPrefix = "group:"
+
+// GroupStore holds groups managed locally, for teams the identity provider
+// doesn't know about or when signing in without one. It is managed by the
+// operator as a plain text file with one group per line: its name, a
+// colon, and a comma-separated list of members, e.g.
+//
+//	Platform: alice@example.com, bob@example.com
+//
+// Lines starting with # are comments, and matching is case-insensitive.
+// Members have these groups on top of any their identity provider sends.
+type GroupStore struct {
+	mu       sync.RWMutex
+	groups   map[string][]string // group names by lowercased member
+	filePath string
+	modTime  time.Time
+}
+
+// NewGroupStore creates a group store backed by filePath; call Load to
+// read it
+func NewGroupStore(filePath string) *GroupStore {
+	return &GroupStore{groups: make(map[string][]string), filePath: filePath}
+}
+
+// Load reads the groups file, replacing the current groups. A missing file
+// means no local groups.
+func (gs *GroupStore) Load() error {
+	info, err := os.Stat(gs.filePath)
+	if os.IsNotExist(err) {
+		gs.replace(make(map[string][]string), time.Time{})
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(gs.filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	groups := make(map[string][]string)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name, members, ok := strings.Cut(line, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return fmt.Errorf("invalid group line %q, want name: members", line)
+		}
+		for _, member := range splitList(members) {
+			member = strings.ToLower(member)
+			if !slices.Contains(groups[member], name) {
+				groups[member] = append(groups[member], name)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	gs.replace(groups, info.ModTime())
+	return nil
+}
+
+// replace swaps in a freshly loaded set of groups
+func (gs *GroupStore) replace(groups map[string][]string, modTime time.Time) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	gs.groups = groups
+	gs.modTime = modTime
+}
+
+// Of returns the local groups user is a member of
+func (gs *GroupStore) Of(user string) []string {
+	if user == "" {
+		return nil
+	}
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+	return gs.groups[strings.ToLower(user)]
+}
+
+// ReloadIfChanged reloads the groups when the file has changed, so membership
+// changes apply without a restart
+func (gs *GroupStore) ReloadIfChanged() error {
+	info, err := os.Stat(gs.filePath)
+
+	gs.mu.RLock()
+	modTime := gs.modTime
+	gs.mu.RUnlock()
+
+	switch {
+	case err == nil && info.ModTime().Equal(modTime):
+		return nil
+	case err != nil && !os.IsNotExist(err):
+		return fmt.Errorf("checking groups file: %w", err)
+	case os.IsNotExist(err) && modTime.IsZero():
+		return nil
+	}
+
+	if err := gs.Load(); err != nil {
+		// Keep the old groups and don't retry until the file changes again
+		gs.mu.Lock()
+		gs.modTime = info.ModTime()
+		gs.mu.Unlock()
+		return fmt.Errorf("reloading groups: %w", err)
+	}
+	log.Printf("Reloaded groups from %s", gs.filePath)
+	return nil
+}
+
+// inGroup reports whether group is one of groups, ignoring case
+func inGroup(groups []string, group string) bool {
+	return slices.ContainsFunc(groups, func(g string) bool { return strings.EqualFold(g, group) })
+}
+
+// ownerGroup returns the group owning link, if a group owns it
+func ownerGroup(link Link) (string, bool) {
+	group, ok := strings.CutPrefix(link.Owner, groupOwnerPrefix)
+	group = strings.TrimSpace(group)
+	return group, ok && group != ""
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeGroups(t *testing.T, s *Server, groups string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "groups.txt")
+	if err := os.WriteFile(path, []byte(groups), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s.groups = NewGroupStore(path)
+	if err := s.groups.Load(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGroupStore(t *testing.T) {
+	s := newTestServer(t)
+	writeGroups(t, s, `# Teams
+Platform: alice@example.com, Bob@example.com
+On-call:  bob@example.com
+Empty:
+`)
+
+	for user, want := range map[string]string{
+		"alice@example.com": "Platform",
+		"BOB@example.com":   "Platform,On-call",
+		"carol@example.com": "",
+		"":                  "",
+	} {
+		if got := strings.Join(s.groups.Of(user), ","); got != want {
+			t.Errorf("Of(%q) = %q, want %q", user, got, want)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "groups.txt")
+	os.WriteFile(path, []byte("alice@example.com, bob@example.com\n"), 0644)
+	if err := NewGroupStore(path).Load(); err == nil {
+		t.Error("loading a line without a group name succeeded, want an error")
+	}
+}
+
+func TestGroupOwnership(t *testing.T) {
+	s := newTestServer(t,
+		Link{Shortcut: "deploy", URL: "https://deploy.example.com", CreatedBy: "gone@example.com", Owner: "group:Platform"},
+		Link{Shortcut: "oncall", URL: "https://oncall.example.com", CreatedBy: "gone@example.com", Owner: "group:SRE", Hidden: true},
+		Link{Shortcut: "wiki", URL: "https://wiki.example.com", CreatedBy: "gone@example.com"},
+	)
+	s.userHeader = "X-User"
+	s.proxies = httptestProxy
+	s.signInToEdit = true
+	s.sessions = NewSessions("secret", newMemorySessionStore())
+	writeGroups(t, s, "Platform: alice@example.com\n")
+
+	request := func(user string) *http.Request {
+		r := httptest.NewRequest("PUT", "/api/links/x", nil)
+		r.Header.Set("X-User", user)
+		return r
+	}
+	deploy, _ := s.store.Get("", "deploy")
+	oncall, _ := s.store.Get("", "oncall")
+	wiki, _ := s.store.Get("", "wiki")
+
+	alice := request("alice@example.com")
+	if !s.mayChange(alice, deploy) || s.mayChange(alice, wiki) {
+		t.Errorf("alice may change deploy %v, wiki %v, want only deploy", s.mayChange(alice, deploy), s.mayChange(alice, wiki))
+	}
+	if s.mayChange(request("carol@example.com"), deploy) {
+		t.Error("carol may change a link owned by a group they aren't in")
+	}
+
+	// Groups from the identity provider count too
+	w := httptest.NewRecorder()
+	if err := s.sessions.Start(w, httptest.NewRequest("GET", "/", nil), session{User: "dave@example.com", Groups: []string{"sre"}}); err != nil {
+		t.Fatal(err)
+	}
+	dave := httptest.NewRequest("GET", "/", nil)
+	s.userHeader = ""
+	for _, cookie := range w.Result().Cookies() {
+		dave.AddCookie(cookie)
+	}
+	if !s.canSee(dave, oncall) || !s.mayChange(dave, oncall) {
+		t.Error("dave can't see or change a hidden link owned by their identity provider group")
+	}
+	if s.canSee(httptest.NewRequest("GET", "/", nil), oncall) {
+		t.Error("anonymous users can see a hidden group link")
+	}
+
+	// My Links lists the links a user's groups own
+	s.userHeader = "X-User"
+	w = httptest.NewRecorder()
+	my := httptest.NewRequest("GET", "/my", nil)
+	my.Header.Set("X-User", "alice@example.com")
+	s.handleMyLinks(w, my)
+	if body := w.Body.String(); !strings.Contains(body, "Owned by Your Groups") || !strings.Contains(body, "/deploy") {
+		t.Errorf("My Links doesn't list alice's group's links")
+	}
+}
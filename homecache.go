@@ -0,0 +1,108 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// homeCacheTTL is how long the homepage's view of a namespace's links is
+// reused while only click counts change. Any other change to the links
+// makes it start over.
+const homeCacheTTL = 30 * time.Second
+
+// homeView is a namespace's links in the orders the homepage shows them,
+// worked out once for every visitor rather than for each. The slices are
+// shared, so they're never changed once built.
+type homeView struct {
+	version uint64 // the store's, see LinkStore.Version
+	builtAt time.Time
+	byName  []Link        // every link, by shortcut
+	recent  []Link        // links with a creation time, newest first
+	popular []popularLink // links clicked in the last week, busiest first
+}
+
+// homeCache keeps the homepage's view of each namespace. The zero value is
+// ready to use.
+type homeCache struct {
+	mu    sync.Mutex
+	views map[string]*homeView
+}
+
+// view returns the homepage's view of namespace, building it again when
+// the links have changed or it's older than homeCacheTTL. Visitors arriving
+// while it's built wait for it rather than each building their own.
+func (hc *homeCache) view(store *LinkStore, namespace string, now time.Time) *homeView {
+	version := store.Version()
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	if view := hc.views[namespace]; view != nil && view.version == version && now.Sub(view.builtAt) < homeCacheTTL {
+		return view
+	}
+
+	view := newHomeView(store, namespace, version, now)
+	if hc.views == nil {
+		hc.views = make(map[string]*homeView)
+	}
+	hc.views[namespace] = view
+	return view
+}
+
+// newHomeView works out the homepage's view of namespace as of version
+func newHomeView(store *LinkStore, namespace string, version uint64, now time.Time) *homeView {
+	links := store.GetAll(namespace)
+	return &homeView{
+		version: version,
+		builtAt: now,
+		byName:  searchLinks(links, ""),
+		recent:  recentLinks(links, len(links)),
+		popular: mostUsedLinks(links, now.UTC(), 7, len(links)),
+	}
+}
+
+// homeView returns the homepage's view of the namespace r is for, kept
+// for other visitors unless memory is short
+func (s *Server) homeView(r *http.Request) *homeView {
+	namespace := s.hosts.Namespace(r)
+	if s.memory.Over() {
+		return newHomeView(s.store, namespace, s.store.Version(), time.Now())
+	}
+	return s.home.view(s.store, namespace, time.Now())
+}
+
+// seenBy reports whether r may see link, as canSee does. Most links are
+// public, so they're let through without checking who's asking.
+func (s *Server) seenBy(r *http.Request, link *Link) bool {
+	if len(link.VisibleTo) == 0 && !link.Hidden && link.ArchivedAt.IsZero() {
+		return true
+	}
+	return s.canSee(r, *link)
+}
+
+// visibleIn returns the links of a view r may see, in the same order
+func (s *Server) visibleIn(r *http.Request, links []Link) []*Link {
+	visible := make([]*Link, 0, len(links))
+	for i := range links {
+		if s.seenBy(r, &links[i]) {
+			visible = append(visible, &links[i])
+		}
+	}
+	return visible
+}
+
+// discover returns the first n links from the view's newest and most
+// used links that r may see, leaving out disabled ones, to help people
+// discover useful shortcuts
+func (s *Server) discover(r *http.Request, view *homeView, n int) (mostUsed []popularLink, recent []Link) {
+	for i := 0; i < len(view.popular) && len(mostUsed) < n; i++ {
+		if link := &view.popular[i]; s.seenBy(r, &link.Link) && !s.blocklist.Blocked(link.Shortcut) {
+			mostUsed = append(mostUsed, *link)
+		}
+	}
+	for i := 0; i < len(view.recent) && len(recent) < n; i++ {
+		if link := &view.recent[i]; s.seenBy(r, link) && !s.blocklist.Blocked(link.Shortcut) {
+			recent = append(recent, *link)
+		}
+	}
+	return mostUsed, recent
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHomeCache(t *testing.T) {
+	s := newTestServer(t, Link{Shortcut: "gh", URL: "https://github.com"})
+	s.userHeader = "X-User"
+	s.proxies = httptestProxy
+	now := time.Now()
+
+	view := s.home.view(s.store, "", now)
+	if again := s.home.view(s.store, "", now.Add(time.Second)); again != view {
+		t.Error("view built again though the links haven't changed")
+	}
+	if later := s.home.view(s.store, "", now.Add(homeCacheTTL)); later == view {
+		t.Error("view kept past homeCacheTTL, with click counts out of date")
+	}
+
+	// Changing the links shows on the next page
+	s.store.Add(Link{Shortcut: "hr", URL: "https://hr.example.com", Hidden: true, CreatedBy: "alice"})
+	homepage := func(user string) string {
+		r := httptest.NewRequest("GET", "/", nil)
+		if user != "" {
+			r.Header.Set("X-User", user)
+		}
+		w := httptest.NewRecorder()
+		s.handleHome(w, r)
+		return w.Body.String()
+	}
+	// The view is shared, but hidden links are still only listed for
+	// their owners
+	if body := homepage("alice"); !strings.Contains(body, "hr.example.com") {
+		t.Error("new link not listed for its owner")
+	}
+	if body := homepage("bob"); strings.Contains(body, "hr.example.com") || !strings.Contains(body, "github.com") {
+		t.Error("hidden link listed for someone else")
+	}
+	if view := s.home.view(s.store, "", time.Now()); len(view.byName) != 2 || len(view.recent) != 2 {
+		t.Errorf("view has %d links, %d recent, want 2", len(view.byName), len(view.recent))
+	}
+}
+
+func TestHomeListingOrder(t *testing.T) {
+	s := newTestServer(t,
+		Link{Shortcut: "b", URL: "https://b.example.com", Clicks: 5},
+		Link{Shortcut: "a", URL: "https://a.example.com", Clicks: 1},
+		Link{Shortcut: "c", URL: "https://c.example.com/docs", Clicks: 9},
+	)
+	view := s.home.view(s.store, "", time.Now())
+
+	shortcuts := func(query string) string {
+		r := httptest.NewRequest("GET", "/?"+query, nil)
+		var names []string
+		for _, link := range newLinkListing(s.visibleIn(r, view.byName), r.URL.Query()).Links {
+			names = append(names, link.Shortcut)
+		}
+		return strings.Join(names, ",")
+	}
+	for query, want := range map[string]string{
+		"":                      "a,b,c",
+		"order=desc":            "c,b,a",
+		"sort=clicks":           "c,b,a",
+		"sort=clicks&order=asc": "a,b,c",
+		"q=EXAMPLE.COM/DOCS":    "c",
+		"per_page=25&page=9":    "a,b,c",
+	} {
+		if got := shortcuts(query); got != want {
+			t.Errorf("%q lists %s, want %s", query, got, want)
+		}
+	}
+	// Sorting a listing leaves the shared view in name order
+	if view.byName[0].Shortcut != "a" || view.byName[2].Shortcut != "c" {
+		t.Errorf("view reordered: %s, %s", view.byName[0].Shortcut, view.byName[2].Shortcut)
+	}
+}
+
+func BenchmarkHomepage(b *testing.B) {
+	s := newTestServer(b)
+	s.store = newBenchStore(b, 10000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			w := httptest.NewRecorder()
+			s.handleHome(w, httptest.NewRequest("GET", "/?page=3", nil))
+		}
+	})
+}
+
+func BenchmarkHomepageAfterChange(b *testing.B) {
+	s := newTestServer(b)
+	s.store = newBenchStore(b, 10000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for b.Loop() {
+		// Every change to the links makes the view start over
+		s.store.Mark("", "gh1", func(link Link) Link { return link })
+		w := httptest.NewRecorder()
+		s.handleHome(w, httptest.NewRequest("GET", "/", nil))
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// HostMap maps vanity hostnames (e.g. "go", "l", "wiki") to link
+// namespaces, so one deployment can serve separate sets of shortcuts for
+// different teams. Hosts that aren't listed use the default namespace.
+type HostMap struct {
+	namespaces map[string]string
+}
+
+// NewHostMap parses a comma-separated list of "host=namespace" pairs. A bare
+// host maps to a namespace of the same name, and "host=" maps explicitly to
+// the default namespace.
+func NewHostMap(config string) (*HostMap, error) {
+	hm := &HostMap{namespaces: make(map[string]string)}
+
+	for _, entry := range splitList(config) {
+		host, namespace, ok := strings.Cut(entry, "=")
+		host = strings.ToLower(strings.TrimSpace(host))
+		if !ok {
+			namespace = host
+		}
+		if host == "" {
+			return nil, fmt.Errorf("host mapping %q is missing a hostname", entry)
+		}
+		hm.namespaces[host] = strings.TrimSpace(namespace)
+	}
+
+	return hm, nil
+}
+
+// Namespace returns the namespace for a request's Host header
+func (hm *HostMap) Namespace(r *http.Request) string {
+	return hm.namespaces[requestHost(r)]
+}
+
+// Prefix returns how shortcuts are written for a request's host, e.g.
+// "wiki" for wiki/onboarding. Unmapped hosts use the conventional "go".
+func (hm *HostMap) Prefix(r *http.Request) string {
+	host := requestHost(r)
+	if _, ok := hm.namespaces[host]; ok {
+		return host
+	}
+	return "go"
+}
+
+// PrefixFor returns how shortcuts in namespace are written, for when there
+// is no request to go by: the first host mapped to it, or "go"
+func (hm *HostMap) PrefixFor(namespace string) string {
+	prefix := ""
+	for host, ns := range hm.namespaces {
+		if ns == namespace && (prefix == "" || host < prefix) {
+			prefix = host
+		}
+	}
+	return cmp.Or(prefix, "go")
+}
+
+// requestHost returns the lowercased Host header without any port
+func requestHost(r *http.Request) string {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(host)
+}
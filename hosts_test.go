@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHostMap(t *testing.T) {
+	hm, err := NewHostMap(" go=, l= ,Wiki, docs=wiki, eng=engineering")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		host, namespace, prefix string
+	}{
+		{"go", "", "go"},
+		{"l", "", "l"},
+		{"wiki", "wiki", "wiki"},
+		{"WIKI:8080", "wiki", "wiki"},
+		{"docs", "wiki", "docs"},
+		{"eng:443", "engineering", "eng"},
+		{"go.example.com", "", "go"},
+		{"links.example.com:3000", "", "go"},
+		{"[::1]:3000", "", "go"},
+		{"", "", "go"},
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Host = tc.host
+		if namespace, prefix := hm.Namespace(r), hm.Prefix(r); namespace != tc.namespace || prefix != tc.prefix {
+			t.Errorf("host %q: namespace %q, prefix %q; want %q, %q", tc.host, namespace, prefix, tc.namespace, tc.prefix)
+		}
+	}
+
+	for _, tc := range []struct {
+		namespace, want string
+	}{
+		{"", "go"},
+		{"wiki", "docs"},
+		{"engineering", "eng"},
+		{"unmapped", "go"},
+	} {
+		if got := hm.PrefixFor(tc.namespace); got != tc.want {
+			t.Errorf("PrefixFor(%q) = %q, want %q", tc.namespace, got, tc.want)
+		}
+	}
+
+	// The default namespace is written with a host mapped to it, or else go/
+	hm, _ = NewHostMap("l=, wiki")
+	if got := hm.PrefixFor(""); got != "l" {
+		t.Errorf("PrefixFor default with only l/ mapped = %q, want l", got)
+	}
+	hm, _ = NewHostMap("")
+	if got := hm.PrefixFor(""); got != "go" {
+		t.Errorf("PrefixFor default with nothing mapped = %q, want go", got)
+	}
+
+	if _, err := NewHostMap("=wiki"); err == nil {
+		t.Error("NewHostMap accepted a mapping without a host")
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ServerLimits says how long the server waits on clients and how much it
+// reads from them, so slow or oversized requests can't tie up connections,
+// and which versions of HTTP it speaks. Zero turns a timeout or the body
+// limit off.
+type ServerLimits struct {
+	ReadHeaderTimeout string // to read request headers, default 10s
+	ReadTimeout       string // to read a whole request, default 30s
+	WriteTimeout      string // to write a response, default 60s
+	IdleTimeout       string // to keep idle keep-alive connections, default 2m
+	MaxHeaderKB       string // request headers, in kilobytes, default 64 (0 for Go's 1MB)
+	MaxBodyMB         string // request bodies, in megabytes, default 10
+	HTTP2             string // true for HTTP/2 over TLS (default), false, or cleartext to also allow it unencrypted
+}
+
+// NewHTTPServer creates the server for handler with limits applied
+func NewHTTPServer(handler http.Handler, limits ServerLimits) (*http.Server, error) {
+	srv := &http.Server{}
+	var err error
+	for _, timeout := range []struct {
+		name   string
+		value  string
+		def    time.Duration
+		target *time.Duration
+	}{
+		{"read header timeout", limits.ReadHeaderTimeout, 10 * time.Second, &srv.ReadHeaderTimeout},
+		{"read timeout", limits.ReadTimeout, 30 * time.Second, &srv.ReadTimeout},
+		{"write timeout", limits.WriteTimeout, time.Minute, &srv.WriteTimeout},
+		{"idle timeout", limits.IdleTimeout, 2 * time.Minute, &srv.IdleTimeout},
+	} {
+		if *timeout.target, err = parseTimeout(timeout.name, timeout.value, timeout.def); err != nil {
+			return nil, err
+		}
+	}
+
+	maxHeaderKB, err := parseLogCount("maximum header size", limits.MaxHeaderKB, 64)
+	if err != nil {
+		return nil, err
+	}
+	srv.MaxHeaderBytes = maxHeaderKB << 10
+	maxBodyMB, err := parseLogCount("maximum body size", limits.MaxBodyMB, 10)
+	if err != nil {
+		return nil, err
+	}
+	srv.Handler = limitBodies(handler, int64(maxBodyMB)<<20)
+	if srv.Protocols, err = httpProtocols(limits.HTTP2); err != nil {
+		return nil, err
+	}
+	return srv, nil
+}
+
+// httpProtocols returns the versions of HTTP to serve for an HTTP/2
+// setting. HTTP/1.1 is always served; HTTP/2 is negotiated over TLS unless
+// turned off, and with cleartext also accepted without TLS (h2c), from a
+// proxy that terminates TLS and speaks HTTP/2 to go-links. The server only
+// advertises HTTP/2 to clients when it's on.
+func httpProtocols(value string) (*http.Protocols, error) {
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	switch strings.ToLower(value) {
+	case "", "true":
+		protocols.SetHTTP2(true)
+	case "false":
+	case "cleartext", "h2c":
+		protocols.SetHTTP2(true)
+		protocols.SetUnencryptedHTTP2(true)
+	case "h3", "http3", "quic":
+		return nil, errors.New("HTTP/3 isn't supported; serve it from a proxy in front")
+	default:
+		return nil, fmt.Errorf("HTTP/2 setting %q should be true, false or cleartext", value)
+	}
+	return protocols, nil
+}
+
+// parseTimeout parses a duration such as 30s, or a number of seconds,
+// defaulting to def
+func parseTimeout(name, value string, def time.Duration) (time.Duration, error) {
+	if value = strings.TrimSpace(value); value == "" {
+		return def, nil
+	}
+	if _, err := strconv.Atoi(value); err == nil {
+		value += "s"
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("%s %q is not a duration like 30s", name, value)
+	}
+	return d, nil
+}
+
+// limitBodies refuses to read more than maxBytes of any request body, so
+// reading one fails and the handler answers 400 or 413; zero means no limit
+func limitBodies(next http.Handler, maxBytes int64) http.Handler {
+	if maxBytes == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > maxBytes {
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allowSlowResponse lets a handler known to take a while, such as a CPU
+// profile, write its response for up to d despite the write timeout
+func allowSlowResponse(w http.ResponseWriter, d time.Duration) {
+	// Test recorders and other writers without deadlines have nothing to
+	// extend
+	http.NewResponseController(w).SetWriteDeadline(time.Now().Add(d))
+}
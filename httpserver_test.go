@@ -0,0 +1,121 @@
+package main
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewHTTPServer(t *testing.T) {
+	srv, err := NewHTTPServer(http.NotFoundHandler(), ServerLimits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if srv.ReadHeaderTimeout != 10*time.Second || srv.ReadTimeout != 30*time.Second ||
+		srv.WriteTimeout != time.Minute || srv.IdleTimeout != 2*time.Minute || srv.MaxHeaderBytes != 64<<10 {
+		t.Errorf("defaults = %v %v %v %v %d", srv.ReadHeaderTimeout, srv.ReadTimeout, srv.WriteTimeout, srv.IdleTimeout, srv.MaxHeaderBytes)
+	}
+
+	srv, err = NewHTTPServer(http.NotFoundHandler(), ServerLimits{ReadTimeout: "5", WriteTimeout: "0", IdleTimeout: "90s", MaxHeaderKB: "8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if srv.ReadTimeout != 5*time.Second || srv.WriteTimeout != 0 || srv.IdleTimeout != 90*time.Second || srv.MaxHeaderBytes != 8<<10 {
+		t.Errorf("configured = %v %v %v %d", srv.ReadTimeout, srv.WriteTimeout, srv.IdleTimeout, srv.MaxHeaderBytes)
+	}
+
+	for _, limits := range []ServerLimits{{ReadTimeout: "soon"}, {IdleTimeout: "-1s"}, {MaxHeaderKB: "-1"}, {MaxBodyMB: "lots"}} {
+		if _, err := NewHTTPServer(http.NotFoundHandler(), limits); err == nil {
+			t.Errorf("NewHTTPServer(%+v) succeeded, want an error", limits)
+		}
+	}
+}
+
+func TestMaxBodySize(t *testing.T) {
+	srv, err := NewHTTPServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		}
+	}), ServerLimits{MaxBodyMB: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	post := func(body io.Reader) int {
+		w := httptest.NewRecorder()
+		srv.Handler.ServeHTTP(w, httptest.NewRequest("POST", "/api/links/bulk", body))
+		return w.Code
+	}
+
+	if code := post(strings.NewReader(strings.Repeat("x", 1<<20))); code != http.StatusOK {
+		t.Errorf("1MB body: status %d, want 200", code)
+	}
+	if code := post(strings.NewReader(strings.Repeat("x", 1<<20+1))); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("body over 1MB: status %d, want 413", code)
+	}
+	// Without a length up front, reading stops at the limit
+	if code := post(io.LimitReader(strings.NewReader(strings.Repeat("x", 2<<20)), 2<<20)); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("streamed body over 1MB: status %d, want 413", code)
+	}
+}
+
+func TestHTTP2(t *testing.T) {
+	cert := newTestCA(t).issue(t, "localhost", "", "")
+	// serve starts a server with the HTTP/2 setting, over TLS or not
+	serve := func(setting string, overTLS bool) string {
+		t.Helper()
+		srv, err := NewHTTPServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, r.Proto)
+		}), ServerLimits{HTTP2: setting})
+		if err != nil {
+			t.Fatal(err)
+		}
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { srv.Close() })
+		if overTLS {
+			srv.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+			go srv.ServeTLS(listener, "", "")
+			return "https://" + listener.Addr().String()
+		}
+		go srv.Serve(listener)
+		return "http://" + listener.Addr().String()
+	}
+	get := func(transport *http.Transport, url string) (string, error) {
+		resp, err := (&http.Client{Transport: transport}).Get(url)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body), nil
+	}
+
+	for setting, want := range map[string]string{"": "HTTP/2.0", "false": "HTTP/1.1", "cleartext": "HTTP/2.0"} {
+		// Offer HTTP/2 as browsers do
+		transport := &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, ForceAttemptHTTP2: true}
+		if got, err := get(transport, serve(setting, true)); err != nil || got != want {
+			t.Errorf("HTTP2=%q over TLS: served %q, %v, want %s", setting, got, err, want)
+		}
+	}
+
+	// Unencrypted HTTP/2 is only accepted when asked for
+	h2c := new(http.Protocols)
+	h2c.SetUnencryptedHTTP2(true)
+	if got, err := get(&http.Transport{Protocols: h2c}, serve("cleartext", false)); err != nil || got != "HTTP/2.0" {
+		t.Errorf("HTTP2=cleartext without TLS: served %q, %v, want HTTP/2.0", got, err)
+	}
+	if _, err := get(&http.Transport{Protocols: h2c}, serve("", false)); err == nil {
+		t.Error("unencrypted HTTP/2 accepted by default")
+	}
+
+	if _, err := NewHTTPServer(nil, ServerLimits{HTTP2: "quic"}); err == nil || !strings.Contains(err.Error(), "HTTP/3 isn't supported") {
+		t.Errorf("NewHTTPServer with HTTP2=quic: %v, want HTTP/3 refused", err)
+	}
+}
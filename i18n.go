@@ -0,0 +1,127 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Language is a language the web UI can be shown in
+type Language struct {
+	Code string
+	Name string
+}
+
+// languages are the supported UI languages, the first being the default.
+// Each one other than English has a catalog in locales/<code>.json.
+var languages = []Language{
+	{"en", "English"},
+	{"de", "Deutsch"},
+	{"fr", "Français"},
+}
+
+// langCookie remembers the language picked with the switcher
+const langCookie = "golinks_lang"
+
+// localeFS holds the message catalogs, compiled into the binary
+//
+//go:embed locales/*.json
+var localeFS embed.FS
+
+// catalogs map each language code to its translations, keyed by the English
+// message. Messages missing from a catalog are shown in English.
+var catalogs = loadCatalogs()
+
+func loadCatalogs() map[string]map[string]string {
+	catalogs := make(map[string]map[string]string)
+	for _, lang := range languages[1:] {
+		data, err := localeFS.ReadFile("locales/" + lang.Code + ".json")
+		if err != nil {
+			panic(err)
+		}
+		var messages map[string]string
+		if err := json.Unmarshal(data, &messages); err != nil {
+			panic(fmt.Sprintf("locales/%s.json: %v", lang.Code, err))
+		}
+		catalogs[lang.Code] = messages
+	}
+	return catalogs
+}
+
+// translator translates the messages on one page into the visitor's
+// language
+type translator struct {
+	Code string
+}
+
+// T returns msg in the translator's language, formatting it with args when
+// there are any
+func (t *translator) T(msg string, args ...any) string {
+	if translated, ok := catalogs[t.Code][msg]; ok {
+		msg = translated
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(msg, args...)
+	}
+	return msg
+}
+
+// Languages returns the languages offered by the language switcher
+func (t *translator) Languages() []Language {
+	return languages
+}
+
+// translatorFor picks the language for a request: one just chosen with
+// ?lang=, which is remembered in a cookie, then the remembered one, then
+// the best match for the browser's Accept-Language header
+func translatorFor(w http.ResponseWriter, r *http.Request) *translator {
+	if code := r.URL.Query().Get("lang"); supportedLanguage(code) {
+		http.SetCookie(w, &http.Cookie{
+			Name:     langCookie,
+			Value:    code,
+			Path:     "/",
+			MaxAge:   365 * 24 * 60 * 60,
+			SameSite: http.SameSiteLaxMode,
+		})
+		return &translator{code}
+	}
+	if cookie, err := r.Cookie(langCookie); err == nil && supportedLanguage(cookie.Value) {
+		return &translator{cookie.Value}
+	}
+	return &translator{negotiateLanguage(r.Header.Get("Accept-Language"))}
+}
+
+func supportedLanguage(code string) bool {
+	for _, lang := range languages {
+		if lang.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// negotiateLanguage returns the supported language the Accept-Language
+// header prefers most, matching on the primary subtag so "de-CH" picks
+// German, or the default language when none match
+func negotiateLanguage(header string) string {
+	best, bestQ := languages[0].Code, 0.0
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+
+		code, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		if supportedLanguage(code) && q > bestQ {
+			best, bestQ = code, q
+		}
+	}
+	return best
+}
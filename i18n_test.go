@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestNegotiateLanguage(t *testing.T) {
+	tests := map[string]string{
+		"":                            "en",
+		"de-CH":                       "de",
+		"fr-FR,fr;q=0.9,en;q=0.8":     "fr",
+		"ja,de;q=0.5,fr;q=0.7":        "fr",
+		"es, en-GB;q=0.3":             "en",
+		"ja":                          "en",
+		"de;q=oops, fr;q=0.1":         "fr",
+		"en-US,en;q=0.9,de-DE;q=0.95": "en",
+	}
+	for header, want := range tests {
+		if got := negotiateLanguage(header); got != want {
+			t.Errorf("negotiateLanguage(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestCatalogsMatchFormatVerbs(t *testing.T) {
+	verbs := regexp.MustCompile(`%[a-z]`)
+	for code, messages := range catalogs {
+		for msg, translated := range messages {
+			if strings.Join(verbs.FindAllString(msg, -1), "") != strings.Join(verbs.FindAllString(translated, -1), "") {
+				t.Errorf("%s: %q has different format verbs from %q", code, translated, msg)
+			}
+		}
+	}
+}
+
+func TestHomepageLanguage(t *testing.T) {
+	s := newTestServer(t, Link{Shortcut: "gh", URL: "https://github.com"})
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept-Language", "de-DE,de;q=0.9")
+	w := httptest.NewRecorder()
+	s.handleHome(w, r)
+	if body := w.Body.String(); !strings.Contains(body, `<html lang="de">`) || !strings.Contains(body, "Link hinzufügen") {
+		t.Errorf("homepage isn't in German for a German browser")
+	}
+
+	// Picking a language overrides the browser's and is remembered
+	r = httptest.NewRequest("GET", "/?lang=fr", nil)
+	r.Header.Set("Accept-Language", "de")
+	w = httptest.NewRecorder()
+	s.handleHome(w, r)
+	if !strings.Contains(w.Body.String(), "Ajouter le lien") {
+		t.Errorf("?lang=fr didn't switch the homepage to French")
+	}
+	var remembered *http.Cookie
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == langCookie {
+			remembered = cookie
+		}
+	}
+	if remembered == nil || remembered.Value != "fr" {
+		t.Fatalf("language cookie = %v, want fr", remembered)
+	}
+
+	r = httptest.NewRequest("GET", "/nope", nil)
+	r.Header.Set("Accept-Language", "de")
+	r.AddCookie(remembered)
+	w = httptest.NewRecorder()
+	s.handleHome(w, r)
+	if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), "go/nope n&#39;existe pas encore") {
+		t.Errorf("not-found page isn't in the remembered language:\n%s", w.Body.String())
+	}
+}
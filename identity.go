@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// currentUser returns who is making a request, or "" when unknown. The
+// identity comes from an API token, when its scope allows the request, then
+// from a verified TLS client certificate, then from a header set by an
+// authenticating reverse proxy (e.g. X-Forwarded-User from oauth2-proxy)
+// when GOLINKS_USER_HEADER is configured, and otherwise from an OIDC, SAML
+// or LDAP session or the basic-auth users in GOLINKS_AUTH_USERS. Clients
+// could set the header themselves, so it is only trusted from the proxies
+// in GOLINKS_TRUSTED_PROXIES or, without that, from a proxy on the same
+// machine.
+func (s *Server) currentUser(r *http.Request) string {
+	if token, ok := s.tokens.FromRequest(r); ok {
+		if !token.Permits(r) {
+			return ""
+		}
+		return token.User
+	}
+	if identity, ok := s.clientCerts.Identify(r); ok {
+		return identity.User
+	}
+	if s.userHeader != "" && s.fromTrustedProxy(r) {
+		return strings.TrimSpace(r.Header.Get(s.userHeader))
+	}
+	if s.sessions != nil {
+		if user := s.sessions.User(r); user != "" {
+			return user
+		}
+	}
+	return s.editors.User(r)
+}
+
+// proxyGroups returns the groups the authenticating proxy sends in the
+// comma-separated GOLINKS_GROUPS_HEADER (e.g. X-Forwarded-Groups), if
+// configured and the request came through a trusted proxy
+func (s *Server) proxyGroups(r *http.Request) []string {
+	if s.groupsHeader == "" || !s.fromTrustedProxy(r) {
+		return nil
+	}
+	return splitList(r.Header.Get(s.groupsHeader))
+}
+
+// fromTrustedProxy reports whether identity headers on a request can be
+// trusted: it came from one of the trusted proxies or, when none are
+// configured, over loopback or a Unix socket
+func (s *Server) fromTrustedProxy(r *http.Request) bool {
+	ip := peerIP(r)
+	if len(s.proxies) > 0 || unixPeer(ip) {
+		return s.trustedProxy(ip)
+	}
+	addr, err := netip.ParseAddr(ip)
+	return err == nil && addr.Unmap().IsLoopback()
+}
+
+// parseTrustedProxies parses a comma-separated list of proxy addresses and
+// CIDR ranges
+func parseTrustedProxies(config string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, entry := range splitList(config) {
+		if !strings.Contains(entry, "/") {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, fmt.Errorf("trusted proxy %q: %w", entry, err)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxy %q: %w", entry, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// clientIP returns the address a request came from, without its port
+func clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
+
+// signInURL returns where to send people to sign in with single sign-on
+// or LDAP, or "" when neither is configured
+func (s *Server) signInURL() string {
+	switch {
+	case s.sso != nil:
+		return "/auth/login"
+	case s.saml != nil:
+		return "/saml/login"
+	case s.ldap != nil:
+		return "/ldap/login"
+	default:
+		return ""
+	}
+}
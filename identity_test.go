@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestTrustedProxyHeaders(t *testing.T) {
+	s := newTestServer(t)
+	s.userHeader = "X-Forwarded-User"
+	s.groupsHeader = "X-Forwarded-Groups"
+	var err error
+	if s.proxies, err = parseTrustedProxies("10.0.0.0/8, 192.0.2.1, ::1"); err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(remoteAddr string) (string, []string) {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = remoteAddr
+		r.Header.Set("X-Forwarded-User", "alice@example.com")
+		r.Header.Set("X-Forwarded-Groups", "Platform, SRE")
+		return s.currentUser(r), s.currentGroups(r)
+	}
+
+	for _, remoteAddr := range []string{"10.1.2.3:4321", "192.0.2.1:80", "[::1]:80", "[::ffff:10.0.0.1]:80"} {
+		if user, groups := request(remoteAddr); user != "alice@example.com" || strings.Join(groups, ",") != "Platform,SRE" {
+			t.Errorf("from proxy %s: %q %v, want alice@example.com [Platform SRE]", remoteAddr, user, groups)
+		}
+	}
+	for _, remoteAddr := range []string{"192.0.2.2:80", "203.0.113.9:80"} {
+		if user, groups := request(remoteAddr); user != "" || len(groups) != 0 {
+			t.Errorf("from %s: %q %v, want the headers ignored", remoteAddr, user, groups)
+		}
+	}
+
+	// Without trusted proxies they're only trusted from the same machine,
+	// so other clients can't claim to be anyone
+	s.proxies = nil
+	for _, remoteAddr := range []string{"127.0.0.1:80", "[::1]:80", "@"} {
+		if user, groups := request(remoteAddr); user != "alice@example.com" || len(groups) != 2 {
+			t.Errorf("without trusted proxies, from %s: %q %v, want alice@example.com [Platform SRE]", remoteAddr, user, groups)
+		}
+	}
+	for _, remoteAddr := range []string{"203.0.113.9:80", "10.1.2.3:4321", "[::ffff:192.0.2.1]:80"} {
+		if user, groups := request(remoteAddr); user != "" || len(groups) != 0 {
+			t.Errorf("without trusted proxies, from %s: %q %v, want the spoofed headers ignored", remoteAddr, user, groups)
+		}
+	}
+
+	for _, config := range []string{"proxy.internal", "10.0.0.0/33"} {
+		if _, err := parseTrustedProxies(config); err == nil {
+			t.Errorf("parseTrustedProxies(%q) succeeded, want an error", config)
+		}
+	}
+}
+
+// httptestProxy trusts requests made with httptest.NewRequest, which come
+// from 192.0.2.1, and others from its documentation range to carry
+// identity headers
+var httptestProxy = []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")}
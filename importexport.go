@@ -0,0 +1,568 @@
+package main
+
+import (
+	"cmp"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// linkColumns are the link fields exported and imported, in the order of
+// CSV columns. They are named like the add form's fields.
+var linkColumns = []string{
+	"namespace", "shortcut", "url", "description", "owner", "tags", "mobile_url",
+	"calendar", "fragment", "cache_control", "hidden", "visible_to", "regions",
+}
+
+// exportOnlyColumns are exported for reference, and left alone on import
+var exportOnlyColumns = []string{"created_at", "clicks"}
+
+// linkFields returns a link's fields as text, keyed by column. Lists are
+// comma-separated and regions are region=url lines, as on the add form.
+func linkFields(link Link) map[string]string {
+	var regions []string
+	for _, region := range slices.Sorted(maps.Keys(link.Regions)) {
+		regions = append(regions, region+"="+link.Regions[region])
+	}
+	fields := map[string]string{
+		"namespace":     link.Namespace,
+		"shortcut":      link.Shortcut,
+		"url":           link.URL,
+		"description":   link.Description,
+		"owner":         link.Owner,
+		"tags":          strings.Join(link.Tags, ","),
+		"mobile_url":    link.MobileURL,
+		"calendar":      link.Calendar,
+		"fragment":      link.Fragment,
+		"cache_control": link.CacheControl,
+		"visible_to":    strings.Join(link.VisibleTo, ","),
+		"regions":       strings.Join(regions, "\n"),
+		"clicks":        strconv.Itoa(link.Clicks),
+	}
+	if link.Hidden {
+		fields["hidden"] = "true"
+	}
+	if !link.CreatedAt.IsZero() {
+		fields["created_at"] = link.CreatedAt.Format(time.RFC3339)
+	}
+	return fields
+}
+
+// columnMap maps the columns of a spreadsheet to link fields, from map
+// query parameters such as map=Destination:url. Columns not mapped are
+// matched to fields by name, ignoring case.
+type columnMap map[string]string
+
+// parseColumnMap parses the map query parameters
+func parseColumnMap(values []string) (columnMap, error) {
+	columns := columnMap{}
+	for _, value := range values {
+		column, field, ok := strings.Cut(value, ":")
+		field = strings.ToLower(strings.TrimSpace(field))
+		if !ok || strings.TrimSpace(column) == "" || !slices.Contains(linkColumns, field) && !slices.Contains(exportOnlyColumns, field) {
+			return nil, fmt.Errorf("column mapping %q must be in the form column:field, with one of the fields %s", value, strings.Join(linkColumns, ", "))
+		}
+		columns[strings.TrimSpace(column)] = field
+	}
+	return columns, nil
+}
+
+// field returns the link field a column holds, or "" if none
+func (m columnMap) field(column string) string {
+	column = strings.TrimSpace(column)
+	for c, field := range m {
+		if strings.EqualFold(c, column) {
+			return field
+		}
+	}
+	column = strings.ToLower(column)
+	if slices.Contains(linkColumns, column) || slices.Contains(exportOnlyColumns, column) {
+		return column
+	}
+	return ""
+}
+
+// column returns the column a link field is exported as
+func (m columnMap) column(field string) string {
+	for column, f := range m {
+		if f == field {
+			return column
+		}
+	}
+	return field
+}
+
+// handleExport serves GET /api/export, every link in all namespaces as
+// format json (the default, the links file format), csv or yaml. For CSV
+// and YAML, columns picks the fields to include, comma-separated, and map
+// parameters rename them, as they would be mapped back on import. Format
+// chrome is a Chrome policy file of managed bookmarks, optionally of the
+// links with some tags, in a folder named by folder, and going straight to
+// their destinations with destinations=true.
+func (s *Server) handleExport(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	format := cmp.Or(query.Get("format"), "json")
+	filename := "links-" + time.Now().Format("20060102-150405") + "." + format
+	if format == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+		if err := s.store.Export(w); err != nil {
+			http.Error(w, "Export failed", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	columns := slices.Concat(linkColumns, exportOnlyColumns)
+	if value := query.Get("columns"); value != "" {
+		columns = splitList(strings.ToLower(value))
+		for _, column := range columns {
+			if !slices.Contains(linkColumns, column) && !slices.Contains(exportOnlyColumns, column) {
+				http.Error(w, fmt.Sprintf("Unknown column %q", column), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+	mapping, err := parseColumnMap(query["map"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	links := s.store.All()
+	sort.Slice(links, func(i, j int) bool {
+		if links[i].Namespace != links[j].Namespace {
+			return links[i].Namespace < links[j].Namespace
+		}
+		return links[i].Shortcut < links[j].Shortcut
+	})
+
+	switch format {
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+		writeLinksCSV(w, links, columns, mapping)
+	case "yaml":
+		w.Header().Set("Content-Type", "application/yaml")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+		if err := writeLinksYAML(w, links, columns, mapping); err != nil {
+			http.Error(w, "Export failed", http.StatusInternalServerError)
+		}
+	case "chrome":
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", `attachment; filename="go-links-bookmarks.json"`)
+		if err := s.writeChromePolicy(w, links, parseTags(query.Get("tags")), query.Get("folder"), query.Get("destinations") == "true"); err != nil {
+			http.Error(w, "Export failed", http.StatusInternalServerError)
+		}
+	default:
+		http.Error(w, "Unknown format, want json, csv, yaml or chrome", http.StatusBadRequest)
+	}
+}
+
+// writeLinksCSV writes links as CSV with a header row
+func writeLinksCSV(w io.Writer, links []Link, columns []string, mapping columnMap) {
+	cw := csv.NewWriter(w)
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = mapping.column(column)
+	}
+	cw.Write(header)
+	for _, link := range links {
+		fields := linkFields(link)
+		row := make([]string, len(columns))
+		for i, column := range columns {
+			row[i] = fields[column]
+		}
+		cw.Write(row)
+	}
+	cw.Flush()
+}
+
+// writeLinksYAML writes links as a YAML list, leaving out empty fields.
+// Lists are written as YAML lists and regions as a mapping.
+func writeLinksYAML(w io.Writer, links []Link, columns []string, mapping columnMap) error {
+	list := &yaml.Node{Kind: yaml.SequenceNode}
+	for _, link := range links {
+		fields := linkFields(link)
+		item := &yaml.Node{Kind: yaml.MappingNode}
+		for _, column := range columns {
+			value := fields[column]
+			if value == "" && column != "shortcut" && column != "url" {
+				continue
+			}
+			var node *yaml.Node
+			switch column {
+			case "tags", "visible_to":
+				node = &yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle}
+				for _, item := range splitList(value) {
+					node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: item})
+				}
+			case "regions":
+				node = &yaml.Node{Kind: yaml.MappingNode}
+				for _, line := range strings.Split(value, "\n") {
+					region, url, _ := strings.Cut(line, "=")
+					node.Content = append(node.Content,
+						&yaml.Node{Kind: yaml.ScalarNode, Value: region}, &yaml.Node{Kind: yaml.ScalarNode, Value: url})
+				}
+			default:
+				node = &yaml.Node{}
+				node.SetString(value)
+				if column == "hidden" || column == "clicks" {
+					node.Tag = ""
+				}
+			}
+			item.Content = append(item.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: mapping.column(column)}, node)
+		}
+		list.Content = append(list.Content, item)
+	}
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(list); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// importRow is one link read from an imported file, keyed by column
+type importRow struct {
+	line   int    // line or item number, for reporting problems
+	skip   string // why the row can't be imported, if it can't
+	values map[string]string
+}
+
+// readImportCSV reads CSV with a header row naming the columns
+func readImportCSV(r io.Reader) ([]importRow, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var rows []importRow
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := cr.FieldPos(0)
+		row := importRow{line: line, values: make(map[string]string, len(header))}
+		for i, column := range header {
+			if i < len(record) {
+				row.values[column] = record[i]
+			}
+		}
+		if strings.TrimSpace(strings.Join(record, "")) != "" {
+			rows = append(rows, row)
+		}
+	}
+}
+
+// readImportItems reads a JSON or YAML list of objects, such as an export
+// in either format. Lists become comma-separated and mappings region=url
+// lines, as in CSV.
+func readImportItems(r io.Reader, format string) ([]importRow, error) {
+	var items []map[string]any
+	var err error
+	if format == "json" {
+		err = json.NewDecoder(r).Decode(&items)
+	} else {
+		err = yaml.NewDecoder(r).Decode(&items)
+	}
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	rows := make([]importRow, len(items))
+	for i, item := range items {
+		rows[i] = importRow{line: i + 1, values: make(map[string]string, len(item))}
+		for column, value := range item {
+			rows[i].values[column] = importValue(value)
+		}
+	}
+	return rows, nil
+}
+
+// importValue turns a JSON or YAML value into a field's text
+func importValue(value any) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case []any:
+		items := make([]string, len(value))
+		for i, item := range value {
+			items[i] = importValue(item)
+		}
+		return strings.Join(items, ",")
+	case map[string]any:
+		var lines []string
+		for _, key := range slices.Sorted(maps.Keys(value)) {
+			lines = append(lines, key+"="+importValue(value[key]))
+		}
+		return strings.Join(lines, "\n")
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// importFormat picks the format of an import from the format query
+// parameter, or else the file name or content type
+func importFormat(r *http.Request, filename, contentType string) string {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return format
+	}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		return "csv"
+	case ".yaml", ".yml":
+		return "yaml"
+	case ".json":
+		return "json"
+	case ".html", ".htm":
+		return "bookmarks"
+	case ".conf":
+		return "nginx"
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "text/csv":
+		return "csv"
+	case "application/yaml", "application/x-yaml", "text/yaml":
+		return "yaml"
+	case "text/html":
+		return "bookmarks"
+	}
+	return "json"
+}
+
+// importProblem is why one imported row can't be imported
+type importProblem struct {
+	Line     int    `json:"line"`
+	Shortcut string `json:"shortcut,omitempty"`
+	Error    string `json:"error"`
+}
+
+// importResult reports what an import did, or would do in a dry run
+type importResult struct {
+	DryRun         bool            `json:"dry_run,omitempty"`
+	Added          int             `json:"added"`
+	Updated        int             `json:"updated"`
+	Unchanged      int             `json:"unchanged"`
+	IgnoredColumns []string        `json:"ignored_columns,omitempty"`
+	Problems       []importProblem `json:"problems,omitempty"`
+	Skipped        []importProblem `json:"skipped,omitempty"` // entries with no equivalent here
+
+	listed []linkKey // every link the rows name, changed or not
+}
+
+// handleImport serves POST /api/import, adding and updating links from a
+// CSV, YAML or JSON file sent as the request body or uploaded as the file
+// form field. map parameters say which link field a column holds, such as
+// map=Destination:url, and other columns are matched by name. Columns left
+// out keep their current values for existing links.
+//
+// Every row is checked first, and nothing is changed if any has problems,
+// which are listed in the result with 422 Unprocessable Entity. With
+// dry_run=true the rows are only checked.
+func (s *Server) handleImport(w http.ResponseWriter, r *http.Request) {
+	rows, mapping, ok := readImport(w, r)
+	if !ok {
+		return
+	}
+
+	result, links, before := s.checkImport(r, rows, mapping)
+	result.DryRun = r.URL.Query().Get("dry_run") == "true"
+	w.Header().Set("Content-Type", "application/json")
+	if len(result.Problems) > 0 {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(result)
+		return
+	}
+	if !result.DryRun && len(links) > 0 {
+		span := startSpan(r, "LinkStore.AddMany")
+		err := s.store.AddMany(links)
+		span.End()
+		if err != nil {
+			logFor(r).Error("Importing links", "error", err)
+			http.Error(w, "Failed to save links", http.StatusInternalServerError)
+			return
+		}
+		var entries []AuditEntry
+		for _, link := range links {
+			old, existed := before[linkKey{link.Namespace, link.Shortcut}]
+			entries = append(entries, s.linkEntry(r, auditLink(old, existed), auditLink(s.store.Get(link.Namespace, link.Shortcut))))
+		}
+		s.record(entries...)
+		logFor(r).Info("Imported links", "added", result.Added, "updated", result.Updated, "user", s.currentUser(r))
+	}
+	json.NewEncoder(w).Encode(result)
+}
+
+// readImport reads the rows of a file sent to import or apply, as the
+// request body or uploaded as the file form field, and the column mapping,
+// answering the request itself when they're invalid
+func readImport(w http.ResponseWriter, r *http.Request) ([]importRow, columnMap, bool) {
+	mapping, err := parseColumnMap(r.URL.Query()["map"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, nil, false
+	}
+	var body io.Reader = r.Body
+	format := importFormat(r, "", r.Header.Get("Content-Type"))
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, "Choose a file to import", http.StatusBadRequest)
+			return nil, nil, false
+		}
+		defer file.Close()
+		body, format = file, importFormat(r, header.Filename, header.Header.Get("Content-Type"))
+	}
+
+	var rows []importRow
+	switch format {
+	case "csv":
+		rows, err = readImportCSV(body)
+	case "json", "yaml":
+		rows, err = readImportItems(body, format)
+	default:
+		adapter, ok := importAdapters[format]
+		if !ok {
+			http.Error(w, "Unknown format, want csv, yaml, json, golinks, trotto, nginx or bookmarks", http.StatusBadRequest)
+			return nil, nil, false
+		}
+		rows, err = adapter(body)
+	}
+	if err != nil {
+		http.Error(w, "Invalid "+strings.ToUpper(format)+": "+err.Error(), http.StatusBadRequest)
+		return nil, nil, false
+	}
+	return rows, mapping, true
+}
+
+// checkImport builds links from imported rows, returning what importing
+// them would do, the links that would be added or changed, and the
+// existing versions of those being changed
+func (s *Server) checkImport(r *http.Request, rows []importRow, mapping columnMap) (importResult, []Link, map[linkKey]Link) {
+	var result importResult
+	var links []Link
+	before := make(map[linkKey]Link)
+	seen := make(map[linkKey]int)
+	user := s.currentUser(r)
+	for _, row := range rows {
+		if row.skip != "" {
+			result.Skipped = append(result.Skipped, importProblem{Line: row.line, Shortcut: row.values["shortcut"], Error: row.skip})
+			continue
+		}
+
+		// Map the row's columns to link fields
+		fields := make(map[string]string)
+		for column, value := range row.values {
+			field := mapping.field(column)
+			if field == "" {
+				if !slices.Contains(result.IgnoredColumns, column) {
+					result.IgnoredColumns = append(result.IgnoredColumns, column)
+				}
+				continue
+			}
+			fields[field] = value
+		}
+
+		shortcut := strings.TrimSpace(fields["shortcut"])
+		namespace, ok := fields["namespace"]
+		if !ok {
+			namespace = s.hosts.Namespace(r)
+		}
+		namespace = strings.TrimSpace(namespace)
+		key := linkKey{namespace, shortcut}
+		problem := func(err error) {
+			result.Problems = append(result.Problems, importProblem{Line: row.line, Shortcut: shortcut, Error: err.Error()})
+		}
+		switch {
+		case shortcut == "":
+			problem(errors.New("shortcut is required"))
+			continue
+		case s.blocklist.Blocked(shortcut):
+			problem(fmt.Errorf("shortcut %q is not allowed", shortcut))
+			continue
+		case seen[key] != 0:
+			problem(fmt.Errorf("shortcut %q is also on line %d", shortcut, seen[key]))
+			continue
+		}
+		seen[key] = row.line
+		result.listed = append(result.listed, key)
+
+		// Fields left out keep their values on existing links
+		existing, exists := s.store.Get(namespace, shortcut)
+		if exists {
+			for field, value := range linkFields(existing) {
+				if _, ok := fields[field]; !ok {
+					fields[field] = value
+				}
+			}
+		}
+		hidden, err := parseImportBool(fields["hidden"])
+		if err != nil {
+			problem(err)
+			continue
+		}
+		fields["hidden"] = ""
+		if hidden {
+			fields["hidden"] = "true"
+		}
+		link, err := s.linkFromFields(func(name string) string { return fields[name] }, namespace, shortcut)
+		if err != nil {
+			problem(err)
+			continue
+		}
+
+		switch {
+		case !exists:
+			link.CreatedBy = user
+			result.Added++
+		case maps.Equal(editableFields(linkFields(existing)), editableFields(linkFields(link))):
+			result.Unchanged++
+			continue
+		default:
+			before[key] = existing
+			result.Updated++
+		}
+		links = append(links, link)
+	}
+	slices.Sort(result.IgnoredColumns)
+	return result, links, before
+}
+
+// editableFields leaves out the fields an import doesn't change
+func editableFields(fields map[string]string) map[string]string {
+	for _, column := range exportOnlyColumns {
+		delete(fields, column)
+	}
+	return fields
+}
+
+// parseImportBool parses a yes or no cell, empty meaning no
+func parseImportBool(value string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "false", "no", "n", "0":
+		return false, nil
+	case "true", "yes", "y", "1", "x":
+		return true, nil
+	}
+	return false, fmt.Errorf("hidden %q must be true or false", value)
+}
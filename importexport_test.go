@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestExportAndImportRoundTrip(t *testing.T) {
+	for _, format := range []string{"csv", "yaml", "json"} {
+		t.Run(format, func(t *testing.T) {
+			s := newTestServer(t,
+				Link{Shortcut: "wiki", URL: "https://wiki.example.com", Description: "Team wiki, with notes", Tags: []string{"docs", "onboarding"}, Hidden: true},
+				Link{Namespace: "eng", Shortcut: "ci", URL: "https://ci.example.com", Regions: map[string]string{"eu": "https://ci.example.eu"}})
+			w := httptest.NewRecorder()
+			s.handleExport(w, httptest.NewRequest("GET", "/api/export?format="+format, nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("export: status %d, %s", w.Code, w.Body)
+			}
+
+			// Importing the export elsewhere creates the same links, and
+			// importing it again changes nothing
+			other := newTestServer(t)
+			for _, want := range []importResult{{Added: 2}, {Unchanged: 2}} {
+				r := httptest.NewRequest("POST", "/api/import?format="+format, strings.NewReader(w.Body.String()))
+				got := httptest.NewRecorder()
+				other.handleImport(got, r)
+				var result importResult
+				json.NewDecoder(got.Body).Decode(&result)
+				if got.Code != http.StatusOK || result.Added != want.Added || result.Unchanged != want.Unchanged || result.Updated != 0 {
+					t.Fatalf("import: status %d, %+v, want %+v", got.Code, result, want)
+				}
+			}
+			for _, want := range s.store.All() {
+				got, ok := other.store.Get(want.Namespace, want.Shortcut)
+				if !ok || got.URL != want.URL || got.Description != want.Description || !slices.Equal(got.Tags, want.Tags) ||
+					got.Hidden != want.Hidden || got.Regions["eu"] != want.Regions["eu"] || len(got.History) != 0 {
+					t.Errorf("imported %s = %+v, want %+v", want.Shortcut, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestImportColumnMappingAndDryRun(t *testing.T) {
+	s := newTestServer(t, Link{Shortcut: "wiki", URL: "https://wiki.example.com", Owner: "alice", Description: "Team wiki"})
+	sheet := "Short name,Destination,Notes\nwiki,https://new-wiki.example.com,moved\ndocs,https://docs.example.com,\n"
+	do := func(query, body string) (int, importResult) {
+		r := httptest.NewRequest("POST", "/api/import?map=Short+name:shortcut&map=destination:url&"+query, strings.NewReader(body))
+		r.Header.Set("Content-Type", "text/csv")
+		w := httptest.NewRecorder()
+		s.handleImport(w, r)
+		var result importResult
+		json.NewDecoder(w.Body).Decode(&result)
+		return w.Code, result
+	}
+
+	code, result := do("dry_run=true", sheet)
+	if code != http.StatusOK || !result.DryRun || result.Added != 1 || result.Updated != 1 || !slices.Equal(result.IgnoredColumns, []string{"Notes"}) {
+		t.Errorf("dry run: status %d, %+v", code, result)
+	}
+	if link, _ := s.store.Get("", "wiki"); link.URL != "https://wiki.example.com" {
+		t.Errorf("dry run changed wiki to %s", link.URL)
+	}
+
+	if code, result = do("", sheet); code != http.StatusOK || result.Added != 1 || result.Updated != 1 {
+		t.Fatalf("import: status %d, %+v", code, result)
+	}
+	// Columns left out of the sheet are kept
+	if link, _ := s.store.Get("", "wiki"); link.URL != "https://new-wiki.example.com" || link.Owner != "alice" || link.Description != "Team wiki" {
+		t.Errorf("wiki after import = %+v", link)
+	}
+
+	// Any problem stops the whole import
+	code, result = do("", "Short name,Destination\nnew,https://new.example.com\nbad,\nnew,https://again.example.com\n")
+	if code != http.StatusUnprocessableEntity || len(result.Problems) != 2 || result.Problems[0].Line != 3 || result.Problems[1].Line != 4 {
+		t.Errorf("import with problems: status %d, %+v", code, result)
+	}
+	if _, ok := s.store.Get("", "new"); ok {
+		t.Error("link added despite problems")
+	}
+}
+
+func TestExportColumns(t *testing.T) {
+	s := newTestServer(t, Link{Shortcut: "wiki", URL: "https://wiki.example.com", Tags: []string{"docs", "eng"}})
+	w := httptest.NewRecorder()
+	s.handleExport(w, httptest.NewRequest("GET", "/api/export?format=csv&columns=shortcut,url,tags&map=Destination:url", nil))
+	if want := "shortcut,Destination,tags\nwiki,https://wiki.example.com,\"docs,eng\"\n"; w.Body.String() != want {
+		t.Errorf("export = %q, want %q", w.Body, want)
+	}
+	w = httptest.NewRecorder()
+	s.handleExport(w, httptest.NewRequest("GET", "/api/export?format=csv&columns=password", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("unknown column: status %d, want 400", w.Code)
+	}
+}
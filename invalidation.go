@@ -0,0 +1,352 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Each instance queues up to invalidationQueueSize changes to publish;
+// more are dropped rather than slowing changes down while Redis is away
+const invalidationQueueSize = 1000
+
+// maxResubscribeWait caps how long listening waits before reconnecting
+const maxResubscribeWait = 30 * time.Second
+
+// Invalidations tells the other instances sharing a data directory which
+// links have changed, through a Redis pub/sub channel, so each reads them
+// from the links file again within moments. Without it an instance keeps
+// serving its own copy of the links until restarted or reloaded, and its
+// next save overwrites the changes made elsewhere.
+type Invalidations struct {
+	addr     string
+	tls      *tls.Config // nil for a plain connection
+	username string
+	password string
+	channel  string
+	instance string
+	timeout  time.Duration // for connecting and each command but listening
+	queue    chan invalidation
+}
+
+// invalidation is the message published for a change
+type invalidation struct {
+	Instance string            `json:"instance"`        // who made the change, which ignores it
+	Links    []invalidatedLink `json:"links,omitempty"` // every link, when empty
+}
+
+// invalidatedLink names a link that was changed, added or removed
+type invalidatedLink struct {
+	Namespace string `json:"namespace,omitempty"`
+	Shortcut  string `json:"shortcut"`
+}
+
+// NewInvalidations sets up publishing changes to a Redis URL such as
+// redis://:password@redis:6379?channel=go-links (or rediss:// over TLS) as
+// instance id, or returns nil when no URL is configured
+func NewInvalidations(rawURL, id string) (*Invalidations, error) {
+	if rawURL = strings.TrimSpace(rawURL); rawURL == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "redis" && u.Scheme != "rediss") || u.Hostname() == "" {
+		return nil, fmt.Errorf("%q must be a redis:// or rediss:// URL", rawURL)
+	}
+	id, err = instanceID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	inv := &Invalidations{
+		addr:     net.JoinHostPort(u.Hostname(), cmp.Or(u.Port(), "6379")),
+		channel:  cmp.Or(u.Query().Get("channel"), "go-links"),
+		instance: id,
+		timeout:  5 * time.Second,
+		queue:    make(chan invalidation, invalidationQueueSize),
+	}
+	if u.Scheme == "rediss" {
+		inv.tls = &tls.Config{ServerName: u.Hostname()}
+	}
+	if password, ok := u.User.Password(); ok {
+		inv.username, inv.password = u.User.Username(), password
+	} else if u.User != nil {
+		// redis://secret@host, the password alone
+		inv.password = u.User.Username()
+	}
+	return inv, nil
+}
+
+// Start publishes queued changes and listens for other instances' in the
+// background, reading the links they changed into store
+func (inv *Invalidations) Start(store *LinkStore) {
+	go inv.publish()
+	go inv.listen(store)
+}
+
+// Publish queues the links changed in entries to be published
+func (inv *Invalidations) Publish(entries []AuditEntry) {
+	if len(entries) == 0 {
+		return
+	}
+	message := newInvalidation(inv.instance, entries)
+	select {
+	case inv.queue <- message:
+	default:
+		log.Printf("Warning: Dropped a change for other instances, too many are waiting to be published")
+	}
+}
+
+// newInvalidation names the links changed in entries by instance. Changes
+// that don't name links, such as reloading the links file, have every link
+// read again.
+func newInvalidation(instance string, entries []AuditEntry) invalidation {
+	message := invalidation{Instance: instance}
+	for _, entry := range entries {
+		if entry.Old == nil && entry.New == nil && entry.Shortcut == "" {
+			message.Links = nil
+			break
+		}
+		for _, link := range []*Link{entry.Old, entry.New, {Namespace: entry.Namespace, Shortcut: entry.Shortcut}} {
+			if link == nil || link.Shortcut == "" {
+				continue
+			}
+			if changed := (invalidatedLink{link.Namespace, link.Shortcut}); !slices.Contains(message.Links, changed) {
+				message.Links = append(message.Links, changed)
+			}
+		}
+	}
+	return message
+}
+
+// publish sends queued changes one at a time over a connection kept open
+// between them, trying once more on a new connection if it has gone
+func (inv *Invalidations) publish() {
+	var conn *redisConn
+	for message := range inv.queue {
+		payload, err := json.Marshal(message)
+		if err != nil {
+			log.Printf("Warning: Could not publish a change: %v", err)
+			continue
+		}
+		for attempt := 0; attempt < 2; attempt++ {
+			if conn == nil {
+				if conn, err = inv.dial(); err != nil {
+					continue
+				}
+			}
+			conn.conn.SetDeadline(time.Now().Add(inv.timeout))
+			if _, err = conn.do("PUBLISH", inv.channel, string(payload)); err == nil {
+				break
+			}
+			conn.conn.Close()
+			conn = nil
+		}
+		if err != nil {
+			log.Printf("Warning: Could not publish a change to other instances: %v", err)
+		}
+	}
+}
+
+// listen subscribes to the channel and reads the links other instances
+// changed into store. Whenever it has to subscribe again, changes may have
+// been missed meanwhile, so every link is read again.
+func (inv *Invalidations) listen(store *LinkStore) {
+	wait, subscribed := time.Second, false
+	for {
+		err := inv.subscribe(func() {
+			wait = time.Second
+			if subscribed {
+				readChanges(store, nil)
+			}
+			subscribed = true
+		}, func(message invalidation) {
+			if message.Instance != inv.instance {
+				readChanges(store, message.Links)
+			}
+		})
+		log.Printf("Warning: Not hearing of changes made by other instances, trying again in %s: %v", wait, err)
+		time.Sleep(wait)
+		wait = min(wait*2, maxResubscribeWait)
+	}
+}
+
+// subscribe listens on the channel until the connection fails, calling
+// ready once subscribed and received for each message
+func (inv *Invalidations) subscribe(ready func(), received func(invalidation)) error {
+	conn, err := inv.dial()
+	if err != nil {
+		return err
+	}
+	defer conn.conn.Close()
+	conn.conn.SetDeadline(time.Now().Add(inv.timeout))
+	if _, err := conn.do("SUBSCRIBE", inv.channel); err != nil {
+		return err
+	}
+	conn.conn.SetDeadline(time.Time{})
+	ready()
+
+	for {
+		reply, err := conn.read()
+		if err != nil {
+			return err
+		}
+		// Messages arrive as ["message", channel, payload]
+		parts, _ := reply.([]any)
+		if len(parts) != 3 || parts[0] != "message" {
+			continue
+		}
+		payload, _ := parts[2].(string)
+		var message invalidation
+		if err := json.Unmarshal([]byte(payload), &message); err != nil {
+			log.Printf("Warning: Ignored a malformed change from another instance: %v", err)
+			continue
+		}
+		received(message)
+	}
+}
+
+// refreshRetries is how many times reading links changed elsewhere is
+// tried again, every link this time, after refreshRetryDelay and then twice
+// as long each time, as the file may be briefly unreadable, such as on a
+// network filesystem. Should every try fail, the next change reads them all.
+const (
+	refreshRetries    = 5
+	refreshRetryDelay = time.Second
+)
+
+// readChanges reads the links changed elsewhere (or every link, if none
+// are named) from the links file into store
+func readChanges(store *LinkStore, links []invalidatedLink) {
+	var keys []linkKey
+	for _, link := range links {
+		keys = append(keys, linkKey{link.Namespace, link.Shortcut})
+	}
+	if err := store.Refresh(keys); err != nil {
+		log.Printf("Warning: Could not read links changed by another instance, reading them all in %v: %v", refreshRetryDelay, err)
+		retryRefresh(store, 1, refreshRetryDelay)
+	}
+}
+
+// retryRefresh reads every link into store after delay, trying again up
+// to refreshRetries times in all
+func retryRefresh(store *LinkStore, attempt int, delay time.Duration) {
+	time.AfterFunc(delay, func() {
+		err := store.Refresh(nil)
+		switch {
+		case err == nil:
+		case attempt == refreshRetries:
+			log.Printf("Warning: Could not read links changed by another instance, giving up until the next change: %v", err)
+		default:
+			log.Printf("Warning: Could not read links changed by another instance, trying again in %v: %v", delay*2, err)
+			retryRefresh(store, attempt+1, delay*2)
+		}
+	})
+}
+
+// redisConn is a connection to Redis, speaking just enough of its protocol
+// (RESP) to publish and subscribe
+type redisConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// redisError is an error reply from Redis, such as a wrong password
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+// dial connects to Redis and signs in, if there's a password
+func (inv *Invalidations) dial() (*redisConn, error) {
+	dialer := &net.Dialer{Timeout: inv.timeout}
+	var conn net.Conn
+	var err error
+	if inv.tls != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", inv.addr, inv.tls)
+	} else {
+		conn, err = dialer.Dial("tcp", inv.addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := &redisConn{conn: conn, r: bufio.NewReader(conn)}
+	if inv.password != "" {
+		args := []string{"AUTH", inv.password}
+		if inv.username != "" {
+			args = []string{"AUTH", inv.username, inv.password}
+		}
+		conn.SetDeadline(time.Now().Add(inv.timeout))
+		if _, err := c.do(args...); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// do sends a command and reads its reply
+func (c *redisConn) do(args ...string) (any, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(c.conn, b.String()); err != nil {
+		return nil, err
+	}
+	return c.read()
+}
+
+// read reads a reply: a string, an integer, nil or a list of replies. An
+// error reply is returned as a redisError.
+func (c *redisConn) read() (any, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$', '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: malformed reply %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		if line[0] == '$' {
+			data := make([]byte, n+2)
+			if _, err := io.ReadFull(c.r, data); err != nil {
+				return nil, err
+			}
+			return string(data[:n]), nil
+		}
+		items := make([]any, n)
+		for i := range items {
+			if items[i], err = c.read(); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: unexpected reply %q", line)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis is a Redis server that only knows AUTH, PUBLISH and SUBSCRIBE
+type fakeRedis struct {
+	listener    net.Listener
+	password    string
+	mu          sync.Mutex
+	subscribers map[string][]net.Conn
+}
+
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	fr := &fakeRedis{listener: listener, password: password, subscribers: make(map[string][]net.Conn)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { conn.Close() })
+			go fr.serve(conn)
+		}
+	}()
+	return fr
+}
+
+func (fr *fakeRedis) serve(conn net.Conn) {
+	c := &redisConn{conn: conn, r: bufio.NewReader(conn)}
+	authed := fr.password == ""
+	for {
+		reply, err := c.read()
+		if err != nil {
+			return
+		}
+		var args []string
+		for _, arg := range reply.([]any) {
+			args = append(args, arg.(string))
+		}
+		fr.mu.Lock()
+		switch {
+		case args[0] == "AUTH" && args[len(args)-1] == fr.password:
+			authed = true
+			fmt.Fprint(conn, "+OK\r\n")
+		case args[0] == "AUTH":
+			fmt.Fprint(conn, "-WRONGPASS invalid password\r\n")
+		case !authed:
+			fmt.Fprint(conn, "-NOAUTH Authentication required.\r\n")
+		case args[0] == "SUBSCRIBE":
+			fr.subscribers[args[1]] = append(fr.subscribers[args[1]], conn)
+			fmt.Fprintf(conn, "*3\r\n$9\r\nsubscribe\r\n$%d\r\n%s\r\n:1\r\n", len(args[1]), args[1])
+		case args[0] == "PUBLISH":
+			for _, sub := range fr.subscribers[args[1]] {
+				fmt.Fprintf(sub, "*3\r\n$7\r\nmessage\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n", len(args[1]), args[1], len(args[2]), args[2])
+			}
+			fmt.Fprintf(conn, ":%d\r\n", len(fr.subscribers[args[1]]))
+		}
+		fr.mu.Unlock()
+	}
+}
+
+// subscribed returns how many connections listen on channel
+func (fr *fakeRedis) subscribed(channel string) int {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	return len(fr.subscribers[channel])
+}
+
+// eventually fails the test unless ok becomes true within a few seconds
+func eventually(t *testing.T, what string, ok func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); !ok(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
+
+func TestInvalidations(t *testing.T) {
+	redis := newFakeRedis(t, "secret")
+	path := filepath.Join(t.TempDir(), "links.json")
+	a, b := &LinkStore{filePath: path}, &LinkStore{filePath: path}
+	a.Add(Link{Shortcut: "gh", URL: "https://github.com"})
+	b.Load()
+	b.RecordClick("", "gh", clickSource{})
+
+	url := "redis://:secret@" + redis.listener.Addr().String() + "?channel=links"
+	invA, err := NewInvalidations(url, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	invB, _ := NewInvalidations(url, "b")
+	invA.Start(a)
+	invB.Start(b)
+	eventually(t, "both instances to subscribe", func() bool { return redis.subscribed("links") == 2 })
+
+	// A change on one instance shows on the other, keeping its clicks
+	old, _ := a.Get("", "gh")
+	a.Update(Link{Shortcut: "gh", URL: "https://github.com/org"})
+	updated, _ := a.Get("", "gh")
+	a.Add(Link{Shortcut: "ci", URL: "https://ci.example.com"})
+	added, _ := a.Get("", "ci")
+	invA.Publish([]AuditEntry{{Action: auditUpdate, Shortcut: "gh", Old: &old, New: &updated}, {Action: auditCreate, Shortcut: "ci", New: &added}})
+	eventually(t, "the change to reach the other instance", func() bool {
+		link, _ := b.Get("", "gh")
+		_, added := b.Get("", "ci")
+		return link.URL == "https://github.com/org" && added
+	})
+	if link, _ := b.Get("", "gh"); link.Clicks != 1 {
+		t.Errorf("clicks = %d, want the other instance's 1 kept", link.Clicks)
+	}
+
+	a.Delete("", "ci")
+	invA.Publish([]AuditEntry{{Action: auditDelete, Shortcut: "ci", Old: &added}})
+	eventually(t, "the removal to reach the other instance", func() bool {
+		_, found := b.Get("", "ci")
+		return !found
+	})
+
+	// A reload names no links, so every link is read again
+	b.Add(Link{Shortcut: "wiki", URL: "https://wiki.example.com"})
+	invB.Publish([]AuditEntry{{Action: auditReload}})
+	eventually(t, "the reload to reach the other instance", func() bool {
+		_, found := a.Get("", "wiki")
+		return found
+	})
+}
+
+func TestNewInvalidations(t *testing.T) {
+	inv, err := NewInvalidations("", "")
+	if inv != nil || err != nil {
+		t.Errorf("NewInvalidations(\"\") = %v, %v, want nil, nil", inv, err)
+	}
+	for _, bad := range []string{"http://redis:6379", "redis://", "://"} {
+		if _, err := NewInvalidations(bad, ""); err == nil {
+			t.Errorf("NewInvalidations accepted %q", bad)
+		}
+	}
+
+	inv, err = NewInvalidations("rediss://links:pw@redis.example.com", "links-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inv.addr != "redis.example.com:6379" || inv.tls == nil || inv.username != "links" || inv.password != "pw" || inv.channel != "go-links" {
+		t.Errorf("got %+v", inv)
+	}
+
+	// A wrong password is refused on connecting
+	redis := newFakeRedis(t, "secret")
+	inv, _ = NewInvalidations("redis://wrong@"+redis.listener.Addr().String(), "")
+	if _, err := inv.dial(); err == nil || err.Error() != "redis: WRONGPASS invalid password" {
+		t.Errorf("dial with a wrong password: %v", err)
+	}
+}
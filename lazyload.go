@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// lazyBatch is how many links a background load reads before publishing
+// them first. After that it publishes whenever the links read have doubled,
+// so copying snapshots costs no more than reading.
+const lazyBatch = 1000
+
+// LoadInBackground reads the links file as Load does, but returns at once
+// and publishes the links read so far as it goes, so a server with hundreds
+// of thousands of links redirects to the first of them while the rest load.
+// Changes, saving clicks among them, wait until every link is read. The
+// channel returned gets any error, then is closed once the load is done; as
+// with Load, a file that can't be read leaves the store empty.
+func (ls *LinkStore) LoadInBackground() <-chan error {
+	loaded := make(chan struct{})
+	ls.loading.Store(&loaded)
+	// Locked here rather than in the goroutine, so changes made as soon as
+	// this returns already wait
+	ls.mu.Lock()
+	done := make(chan error, 1)
+	go func() {
+		defer close(done)
+		err := ls.stream()
+		if err != nil {
+			ls.snapshot.Store(nil)
+			ls.version.Add(1)
+		}
+		ls.removedAt = time.Now().UTC()
+		ls.loading.Store(nil)
+		ls.mu.Unlock()
+		close(loaded)
+		if err != nil {
+			done <- err
+		}
+	}()
+	return done
+}
+
+// stream reads the links file a link at a time, publishing them in
+// batches; the caller must hold ls.mu
+func (ls *LinkStore) stream() error {
+	if err := os.MkdirAll(filepath.Dir(ls.filePath), 0755); err != nil {
+		return err
+	}
+	f, err := os.Open(ls.filePath)
+	if os.IsNotExist(err) {
+		ls.remember(nil, nil)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(bufio.NewReaderSize(f, 64<<10))
+	switch start, err := dec.Token(); {
+	case err != nil:
+		return err
+	case start == nil:
+		ls.remember(info, nil)
+		return nil
+	case start != json.Delim('['):
+		return errors.New("the links file should hold a list of links")
+	}
+	var batch []Link
+	published := 0
+	for dec.More() {
+		var link Link
+		if err := dec.Decode(&link); err != nil {
+			return err
+		}
+		batch = append(batch, link)
+		if len(batch) >= max(lazyBatch, published) {
+			ls.publishLoaded(batch)
+			published += len(batch)
+			batch = batch[:0]
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+	ls.publishLoaded(batch)
+	var links []Link
+	for _, entry := range ls.entries() {
+		links = append(links, entry.get())
+	}
+	ls.remember(info, links)
+	return nil
+}
+
+// publishLoaded adds links read by a background load to the snapshot.
+// Links already published keep their entries, and the clicks counted on
+// them.
+func (ls *LinkStore) publishLoaded(links []Link) {
+	entries := ls.entries()
+	next := make(linkEntries, len(entries)+len(links))
+	maps.Copy(next, entries)
+	for _, link := range links {
+		next[linkKey{link.Namespace, link.Shortcut}] = &storedLink{link: link}
+	}
+	ls.snapshot.Store(&next)
+	ls.version.Add(1)
+}
+
+// loaded returns a channel closed once a background load is done, or nil
+// when no links are loading
+func (ls *LinkStore) loaded() <-chan struct{} {
+	if loaded := ls.loading.Load(); loaded != nil {
+		return *loaded
+	}
+	return nil
+}
+
+// waitForLinks waits for links loading in the background, reporting false
+// if the client gave up first
+func (s *Server) waitForLinks(r *http.Request) bool {
+	loaded := s.store.loaded()
+	if loaded == nil {
+		return true
+	}
+	select {
+	case <-loaded:
+		return true
+	case <-r.Context().Done():
+		return false
+	}
+}
+
+// holdUntilLoaded serves redirects while links load in the background
+// (GOLINKS_LAZY_LOAD), and holds everything else back until they have all
+// loaded, as pages, the API and exports would otherwise list and search
+// only some of them
+func (s *Server) holdUntilLoaded(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.store.loaded() != nil {
+			// Redirects are the catch-all route, apart from the homepage
+			if _, route := mux.Handler(r); (route != "/" || r.URL.Path == "/") && !s.waitForLinks(r) {
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
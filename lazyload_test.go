@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadInBackground(t *testing.T) {
+	path := newBenchStore(t, 5000).filePath
+	store := &LinkStore{filePath: path}
+	done := store.LoadInBackground()
+
+	// Changes wait for every link, so saving doesn't lose the rest
+	added := make(chan error)
+	go func() { added <- store.Add(Link{Shortcut: "new", URL: "https://example.com"}) }()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if err := <-added; err != nil {
+		t.Fatal(err)
+	}
+	if n := len(store.All()); n != 5001 {
+		t.Errorf("loaded %d links, want 5001", n)
+	}
+	if link, ok := store.Get("", "gh4999"); !ok || link.URL != "https://github.com/org/repo4999" {
+		t.Errorf("gh4999 = %+v, %v", link, ok)
+	}
+	if store.loaded() != nil {
+		t.Error("still loading after done")
+	}
+	reloaded := &LinkStore{filePath: path}
+	if err := reloaded.Load(); err != nil || len(reloaded.All()) != 5001 {
+		t.Errorf("saved %d links, %v, want 5001", len(reloaded.All()), err)
+	}
+
+	// A missing file loads no links, as with Load
+	empty := &LinkStore{filePath: filepath.Join(t.TempDir(), "links.json")}
+	if err := <-empty.LoadInBackground(); err != nil || len(empty.All()) != 0 {
+		t.Errorf("missing file: %d links, %v", len(empty.All()), err)
+	}
+
+	// A broken file loads none either, rather than some
+	broken := filepath.Join(t.TempDir(), "links.json")
+	os.WriteFile(broken, []byte(`[{"shortcut": "gh", "url": "https://github.com"}, {"shortcut": `), 0644)
+	store = &LinkStore{filePath: broken}
+	if err := <-store.LoadInBackground(); err == nil || len(store.All()) != 0 {
+		t.Errorf("broken file: %d links, %v, want none and an error", len(store.All()), err)
+	}
+}
+
+func TestHoldUntilLoaded(t *testing.T) {
+	s := newTestServer(t, Link{Shortcut: "gh", URL: "https://github.com"})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.handleHome)
+	mux.HandleFunc("GET /api/links", func(w http.ResponseWriter, r *http.Request) {})
+	handler := s.holdUntilLoaded(mux, mux)
+
+	// As if gh had been read and the rest of the file hadn't
+	loaded := make(chan struct{})
+	s.store.loading.Store(&loaded)
+	request := func(path string) <-chan int {
+		code := make(chan int, 1)
+		go func() {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+			code <- w.Code
+		}()
+		return code
+	}
+
+	if code := <-request("/gh"); code != http.StatusFound {
+		t.Errorf("loaded shortcut: status %d, want 302", code)
+	}
+	missing, prefix, api := request("/wiki"), request("/gh/pulls"), request("/api/links")
+	select {
+	case <-missing:
+		t.Error("a shortcut not loaded yet was answered")
+	case <-prefix:
+		t.Error("a longer shortcut not loaded yet was ruled out")
+	case <-api:
+		t.Error("the API was served before the links loaded")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	s.store.publishLoaded([]Link{{Shortcut: "wiki", URL: "https://wiki.example.com"}, {Shortcut: "gh/pulls", URL: "https://github.com/pulls"}})
+	s.store.loading.Store(nil)
+	close(loaded)
+	for path, code := range map[string]<-chan int{"/wiki": missing, "/gh/pulls": prefix, "/api/links": api} {
+		want := http.StatusFound
+		if path == "/api/links" {
+			want = http.StatusOK
+		}
+		if got := <-code; got != want {
+			t.Errorf("%s once loaded: status %d, want %d", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// errBadCredentials is returned for any failed sign-in, so the message
+// doesn't reveal which accounts exist
+var errBadCredentials = errors.New("wrong username or password")
+
+// LDAPConfig describes how to check credentials against an LDAP directory
+// such as Active Directory
+type LDAPConfig struct {
+	URL          string // ldap:// or ldaps:// server
+	BindDN       string // service account used to find users; anonymous when empty
+	BindPassword string
+	BaseDN       string // where to search for users
+	UserFilter   string // finds a user by name, %s being the escaped username
+	UserGroups   string // comma-separated groups allowed to sign in; empty allows anyone
+	EditorGroups string // groups whose members may add, edit and delete links
+	AdminGroups  string // groups whose members are admins
+}
+
+// LDAP signs users in by binding to an LDAP directory as them, and maps
+// their groups (from memberOf) to go-links roles. Groups are matched by
+// common name, case-insensitively.
+type LDAP struct {
+	config       LDAPConfig
+	userGroups   map[string]bool
+	editorGroups map[string]bool
+	adminGroups  map[string]bool
+	dial         func() (ldapConn, error)
+}
+
+// ldapConn is the part of an LDAP connection sign-in uses
+type ldapConn interface {
+	Bind(username, password string) error
+	Search(*ldap.SearchRequest) (*ldap.SearchResult, error)
+	Close() error
+}
+
+// NewLDAP creates an LDAP sign-in backend. An empty URL disables it.
+func NewLDAP(config LDAPConfig) (*LDAP, error) {
+	if config.URL == "" {
+		return nil, nil
+	}
+	if config.BaseDN == "" {
+		return nil, errors.New("a base DN is required")
+	}
+	if config.UserFilter == "" {
+		config.UserFilter = "(uid=%s)"
+	}
+	if strings.Count(config.UserFilter, "%s") != 1 {
+		return nil, fmt.Errorf("user filter %q must contain %%s once", config.UserFilter)
+	}
+
+	l := &LDAP{
+		config:       config,
+		userGroups:   groupSet(config.UserGroups),
+		editorGroups: groupSet(config.EditorGroups),
+		adminGroups:  groupSet(config.AdminGroups),
+	}
+	l.dial = func() (ldapConn, error) {
+		return ldap.DialURL(config.URL)
+	}
+	return l, nil
+}
+
+func groupSet(groups string) map[string]bool {
+	set := make(map[string]bool)
+	for _, group := range splitList(groups) {
+		set[strings.ToLower(group)] = true
+	}
+	return set
+}
+
+// RestrictsEditing reports whether editing is limited to editor groups
+func (l *LDAP) RestrictsEditing() bool {
+	return len(l.editorGroups) > 0
+}
+
+// HasAdmins reports whether any groups are mapped to admins
+func (l *LDAP) HasAdmins() bool {
+	return len(l.adminGroups) > 0
+}
+
+// Authenticate checks a username and password against the directory,
+// returning a session for the user's identity (their mail attribute, or
+// else the username) with their go-links roles and groups
+func (l *LDAP) Authenticate(username, password string) (session, error) {
+	// An empty password would be an unauthenticated bind, which succeeds
+	if username == "" || password == "" {
+		return session{}, errBadCredentials
+	}
+
+	conn, err := l.dial()
+	if err != nil {
+		return session{}, fmt.Errorf("connecting to %s: %w", l.config.URL, err)
+	}
+	defer conn.Close()
+
+	if l.config.BindDN != "" {
+		if err := conn.Bind(l.config.BindDN, l.config.BindPassword); err != nil {
+			return session{}, fmt.Errorf("binding as %s: %w", l.config.BindDN, err)
+		}
+	}
+
+	result, err := conn.Search(ldap.NewSearchRequest(
+		l.config.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 10, false,
+		fmt.Sprintf(l.config.UserFilter, ldap.EscapeFilter(username)),
+		[]string{"mail", "memberOf"}, nil,
+	))
+	if err != nil {
+		return session{}, fmt.Errorf("searching for %s: %w", username, err)
+	}
+	if len(result.Entries) != 1 {
+		return session{}, errBadCredentials
+	}
+	entry := result.Entries[0]
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return session{}, errBadCredentials
+		}
+		return session{}, fmt.Errorf("binding as %s: %w", entry.DN, err)
+	}
+
+	var names []string
+	groups := make(map[string]bool)
+	for _, dn := range entry.GetAttributeValues("memberOf") {
+		name := groupName(dn)
+		names = append(names, name)
+		groups[strings.ToLower(name)] = true
+	}
+	inAny := func(set map[string]bool) bool {
+		for group := range set {
+			if groups[group] {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(l.userGroups) > 0 && !inAny(l.userGroups) {
+		return session{}, fmt.Errorf("%s is not in an allowed group", username)
+	}
+	var roles []string
+	if inAny(l.editorGroups) || inAny(l.adminGroups) {
+		roles = append(roles, roleEditor)
+	}
+	if inAny(l.adminGroups) {
+		roles = append(roles, roleAdmin)
+	}
+
+	user := entry.GetAttributeValue("mail")
+	if user == "" {
+		user = username
+	}
+	return session{User: user, Roles: roles, Groups: names}, nil
+}
+
+// groupName returns a group's common name when given its DN, such as
+// "Payments" for "CN=Payments,OU=Groups,DC=example,DC=com", and the name
+// unchanged otherwise
+func groupName(group string) string {
+	group = strings.TrimSpace(group)
+	if !strings.Contains(group, "=") {
+		return group
+	}
+	dn, err := ldap.ParseDN(group)
+	if err != nil || len(dn.RDNs) == 0 || len(dn.RDNs[0].Attributes) == 0 {
+		return group
+	}
+	return dn.RDNs[0].Attributes[0].Value
+}
+
+// handleLDAPLogin serves /ldap/login: GET shows the sign-in form, and POST
+// checks the credentials and signs the user in
+func (s *Server) handleLDAPLogin(w http.ResponseWriter, r *http.Request) {
+	next := localRedirect(r.FormValue("next"))
+	username := strings.TrimSpace(r.PostFormValue("username"))
+
+	status, message := http.StatusOK, ""
+	if r.Method == http.MethodPost {
+		sess, err := s.ldap.Authenticate(username, r.PostFormValue("password"))
+		if err == nil {
+			if err := s.sessions.Start(w, r, sess); err != nil {
+				log.Printf("Starting session for %s: %v", sess.User, err)
+				s.showError(w, r, http.StatusInternalServerError, "Sign-in is unavailable right now. Please try again later.")
+				return
+			}
+			http.Redirect(w, r, next, http.StatusSeeOther)
+			return
+		}
+
+		log.Printf("LDAP sign-in failed for %q: %v", username, err)
+		status, message = http.StatusUnauthorized, "Wrong username or password, or your account isn't allowed to sign in."
+	}
+
+	lang := translatorFor(w, r)
+	data := struct {
+		Prefix      string
+		Theme       *Theme
+		Maintenance *maintenanceState
+		CSRFToken   string
+		Lang        *translator
+		Next        string
+		Username    string
+		Error       string
+	}{
+		Prefix:      s.hosts.Prefix(r),
+		Theme:       s.theme.Load(),
+		Maintenance: s.maintenance.State(),
+		CSRFToken:   s.csrfToken(w, r),
+		Lang:        lang,
+		Next:        next,
+		Username:    username,
+		Error:       lang.T(message),
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writePage(w, status, "login.html", data, "Sign-in page unavailable")
+}
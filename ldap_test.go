@@ -0,0 +1,176 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// fakeDirectory is an LDAP server with a few users, keyed by DN
+type fakeDirectory struct {
+	passwords map[string]string
+	entries   []*ldap.Entry
+	filters   []string
+}
+
+func (d *fakeDirectory) Bind(dn, password string) error {
+	if want, ok := d.passwords[dn]; !ok || password != want {
+		return ldap.NewError(ldap.LDAPResultInvalidCredentials, nil)
+	}
+	return nil
+}
+
+func (d *fakeDirectory) Search(req *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	d.filters = append(d.filters, req.Filter)
+	result := &ldap.SearchResult{}
+	for _, entry := range d.entries {
+		uid := entry.GetAttributeValue("uid")
+		if req.Filter == "(uid="+ldap.EscapeFilter(uid)+")" {
+			result.Entries = append(result.Entries, entry)
+		}
+	}
+	return result, nil
+}
+
+func (d *fakeDirectory) Close() error { return nil }
+
+func newTestLDAP(t *testing.T, config LDAPConfig) (*LDAP, *fakeDirectory) {
+	t.Helper()
+	config.URL = "ldap://directory.test"
+	config.BaseDN = "dc=example,dc=com"
+	config.BindDN = "cn=golinks,dc=example,dc=com"
+	config.BindPassword = "service"
+	l, err := NewLDAP(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := &fakeDirectory{
+		passwords: map[string]string{
+			"cn=golinks,dc=example,dc=com":          "service",
+			"uid=alice,ou=people,dc=example,dc=com": "wonderland",
+			"uid=bob,ou=people,dc=example,dc=com":   "builder",
+		},
+		entries: []*ldap.Entry{
+			ldap.NewEntry("uid=alice,ou=people,dc=example,dc=com", map[string][]string{
+				"uid":      {"alice"},
+				"mail":     {"alice@example.com"},
+				"memberOf": {"cn=Staff,ou=groups,dc=example,dc=com", "cn=IT Admins,ou=groups,dc=example,dc=com"},
+			}),
+			ldap.NewEntry("uid=bob,ou=people,dc=example,dc=com", map[string][]string{
+				"uid":      {"bob"},
+				"memberOf": {"cn=Staff,ou=groups,dc=example,dc=com"},
+			}),
+		},
+	}
+	l.dial = func() (ldapConn, error) { return dir, nil }
+	return l, dir
+}
+
+func TestNewLDAP(t *testing.T) {
+	if l, err := NewLDAP(LDAPConfig{}); l != nil || err != nil {
+		t.Errorf("NewLDAP with no URL = %v, %v, want disabled", l, err)
+	}
+	for _, config := range []LDAPConfig{
+		{URL: "ldap://directory.test"},
+		{URL: "ldap://directory.test", BaseDN: "dc=example,dc=com", UserFilter: "(uid=alice)"},
+	} {
+		if _, err := NewLDAP(config); err == nil {
+			t.Errorf("NewLDAP(%+v) succeeded, want an error", config)
+		}
+	}
+}
+
+func TestLDAPAuthenticate(t *testing.T) {
+	l, dir := newTestLDAP(t, LDAPConfig{UserGroups: "staff", EditorGroups: "Editors", AdminGroups: "it admins"})
+
+	alice, err := l.Authenticate("alice", "wonderland")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alice.User != "alice@example.com" || strings.Join(alice.Roles, ",") != "editor,admin" {
+		t.Errorf("alice = %q %v, want alice@example.com [editor admin]", alice.User, alice.Roles)
+	}
+	if strings.Join(alice.Groups, ",") != "Staff,IT Admins" {
+		t.Errorf("alice's groups = %v, want [Staff IT Admins]", alice.Groups)
+	}
+
+	// Without a mail attribute the username is used
+	bob, err := l.Authenticate("bob", "builder")
+	if err != nil || bob.User != "bob" || len(bob.Roles) != 0 {
+		t.Errorf("bob = %+v %v, want bob with no roles", bob, err)
+	}
+
+	for _, tc := range []struct{ username, password string }{
+		{"alice", "guess"},
+		{"alice", ""},
+		{"mallory", "wonderland"},
+	} {
+		if _, err := l.Authenticate(tc.username, tc.password); err != errBadCredentials {
+			t.Errorf("Authenticate(%q, %q) = %v, want %v", tc.username, tc.password, err, errBadCredentials)
+		}
+	}
+
+	// Usernames can't change the filter
+	l.Authenticate("*)(uid=*", "x")
+	if got := dir.filters[len(dir.filters)-1]; got != `(uid=\2a\29\28uid=\2a)` {
+		t.Errorf("filter = %q, want the username escaped", got)
+	}
+
+	// Only allowed groups may sign in
+	l, _ = newTestLDAP(t, LDAPConfig{UserGroups: "IT Admins"})
+	if _, err := l.Authenticate("bob", "builder"); err == nil {
+		t.Error("bob signed in without being in an allowed group")
+	}
+}
+
+func TestLDAPSignIn(t *testing.T) {
+	s := newTestServer(t)
+	s.ldap, _ = newTestLDAP(t, LDAPConfig{EditorGroups: "Editors", AdminGroups: "IT Admins"})
+	s.sessions = NewSessions("secret", newMemorySessionStore())
+
+	signIn := func(username, password string) *httptest.ResponseRecorder {
+		form := url.Values{"username": {username}, "password": {password}, "next": {"/my"}}
+		r := httptest.NewRequest("POST", "/ldap/login", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		s.handleLDAPLogin(w, r)
+		return w
+	}
+	withCookies := func(r *http.Request, w *httptest.ResponseRecorder) *http.Request {
+		for _, cookie := range w.Result().Cookies() {
+			r.AddCookie(cookie)
+		}
+		return r
+	}
+
+	if w := signIn("alice", "guess"); w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), "Wrong username or password") {
+		t.Errorf("wrong password: status %d, body %q", w.Code, w.Body.String())
+	}
+
+	alice := signIn("alice", "wonderland")
+	if alice.Code != http.StatusSeeOther || alice.Header().Get("Location") != "/my" {
+		t.Fatalf("sign-in: status %d, location %q", alice.Code, alice.Header().Get("Location"))
+	}
+	r := withCookies(httptest.NewRequest("GET", "/", nil), alice)
+	if user := s.currentUser(r); user != "alice@example.com" {
+		t.Errorf("currentUser = %q, want alice@example.com", user)
+	}
+	if !s.isAdmin(r) || !s.mayEdit(r) {
+		t.Errorf("alice: admin %v, may edit %v, want both", s.isAdmin(r), s.mayEdit(r))
+	}
+
+	// Editor groups restrict editing to their members
+	bob := signIn("bob", "builder")
+	r = withCookies(httptest.NewRequest("GET", "/", nil), bob)
+	if s.isAdmin(r) || s.mayEdit(r) {
+		t.Errorf("bob: admin %v, may edit %v, want neither", s.isAdmin(r), s.mayEdit(r))
+	}
+	if s.mayEdit(httptest.NewRequest("GET", "/", nil)) {
+		t.Error("anonymous users may edit with editor groups configured")
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// leaseTTL is how long a leader's lease lasts without being renewed
+const leaseTTL = 30 * time.Second
+
+// lease is who leads the instances sharing a data directory, and until when
+type lease struct {
+	Holder  string    `json:"holder"`
+	Expires time.Time `json:"expires"`
+}
+
+// Leadership elects one of the instances sharing a data directory to run
+// jobs that must only run once across them, such as the expiry policy and
+// the weekly digest. Instances take turns holding a lease in a file next
+// to the links, which the leader renews regularly; when it stops, another
+// takes over once the lease expires.
+type Leadership struct {
+	id   string
+	path string
+
+	mu sync.Mutex
+	// A new lease only counts once it has been renewed, so two instances
+	// that took an expired lease at the same moment can't both lead
+	acquired bool
+	leading  bool
+	holder   string
+}
+
+// NewLeadership sets up leader election when enabled is "true", as
+// instance id (by default the hostname and process ID), with the lease kept
+// at path. Without it, every instance runs every job.
+func NewLeadership(enabled, id, path string) (*Leadership, error) {
+	switch enabled {
+	case "", "false":
+		return nil, nil
+	case "true":
+	default:
+		return nil, fmt.Errorf("GOLINKS_LEADER_ELECTION must be true or false, not %q", enabled)
+	}
+	id, err := instanceID(id)
+	if err != nil {
+		return nil, err
+	}
+	return &Leadership{id: id, path: path}, nil
+}
+
+// instanceID returns id, or when empty a name for this instance made of its
+// hostname and process ID
+func instanceID(id string) (string, error) {
+	if id != "" {
+		return id, nil
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "", fmt.Errorf("naming this instance: %w", err)
+	}
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid()), nil
+}
+
+// IsLeader reports whether this instance should run leader-only jobs,
+// which it always should without leader election
+func (l *Leadership) IsLeader() bool {
+	if l == nil {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.leading
+}
+
+// Leader returns the instance holding the lease when last checked
+func (l *Leadership) Leader() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.holder
+}
+
+// Renew takes or renews the lease when it is free, expired or already
+// ours, and notes who leads otherwise
+func (l *Leadership) Renew(now time.Time) error {
+	current, err := l.read()
+	if err != nil {
+		l.setLeading(false, "")
+		return err
+	}
+	if current.Holder != l.id && now.Before(current.Expires) {
+		l.setLeading(false, current.Holder)
+		return nil
+	}
+
+	if err := l.write(lease{Holder: l.id, Expires: now.Add(leaseTTL)}); err != nil {
+		l.setLeading(false, "")
+		return err
+	}
+	// Another instance may have replaced the lease at the same time, so
+	// only the one whose write stuck goes on
+	if current, err = l.read(); err != nil {
+		l.setLeading(false, "")
+		return err
+	}
+	l.setLeading(current.Holder == l.id, current.Holder)
+	return nil
+}
+
+// setLeading records the outcome of renewing the lease, leading only once
+// it has been held for two renewals in a row
+func (l *Leadership) setLeading(held bool, holder string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.holder = holder
+	wasLeading := l.leading
+	l.leading = held && l.acquired
+	l.acquired = held
+	switch {
+	case l.leading && !wasLeading:
+		log.Printf("This instance (%s) is now the leader", l.id)
+	case !l.leading && wasLeading:
+		log.Printf("This instance (%s) is no longer the leader", l.id)
+	}
+}
+
+// Resign gives up the lease, if held, so another instance can take over
+// straight away rather than when it expires
+func (l *Leadership) Resign() error {
+	l.mu.Lock()
+	l.leading, l.acquired = false, false
+	l.mu.Unlock()
+	current, err := l.read()
+	if err != nil || current.Holder != l.id {
+		return err
+	}
+	return l.write(lease{Holder: l.id})
+}
+
+// Job returns the background job renewing the lease
+func (l *Leadership) Job() Job {
+	return Job{Name: "renew_leadership", Every: leaseTTL / 3, RunAtStart: true, Run: func() error {
+		return l.Renew(time.Now())
+	}}
+}
+
+// read reads the lease, which is free when the file doesn't exist
+func (l *Leadership) read() (lease, error) {
+	var current lease
+	data, err := os.ReadFile(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return current, nil
+	}
+	if err != nil {
+		return current, err
+	}
+	if err := json.Unmarshal(data, &current); err != nil {
+		// A torn or garbled lease is as good as expired
+		return lease{}, nil
+	}
+	return current, nil
+}
+
+// write replaces the lease atomically, so other instances never read half
+// of it
+func (l *Leadership) write(next lease) error {
+	data, err := json.Marshal(next)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(l.path), ".leader-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), l.path)
+}
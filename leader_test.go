@@ -0,0 +1,93 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLeaderElection(t *testing.T) {
+	if l, err := NewLeadership("", "", ""); l != nil || err != nil || !l.IsLeader() {
+		t.Errorf("NewLeadership disabled = %v, %v, want nil leading everything", l, err)
+	}
+	if _, err := NewLeadership("yes", "", ""); err == nil {
+		t.Error("NewLeadership with an invalid setting succeeded")
+	}
+
+	path := filepath.Join(t.TempDir(), "leader.json")
+	a, _ := NewLeadership("true", "a", path)
+	b, _ := NewLeadership("true", "b", path)
+	now := time.Now()
+	renew := func(l *Leadership, at time.Time) {
+		t.Helper()
+		if err := l.Renew(at); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A new lease only counts once it has been renewed
+	renew(a, now)
+	renew(b, now)
+	if a.IsLeader() || b.IsLeader() {
+		t.Error("an instance led before renewing its lease")
+	}
+	renew(a, now.Add(10*time.Second))
+	renew(b, now.Add(10*time.Second))
+	if !a.IsLeader() || b.IsLeader() || b.Leader() != "a" {
+		t.Errorf("after renewing, a leading = %v, b leading = %v with leader %q; want only a", a.IsLeader(), b.IsLeader(), b.Leader())
+	}
+
+	// When the leader stops renewing, another takes over after the lease
+	// expires
+	later := now.Add(10*time.Second + leaseTTL)
+	renew(b, later)
+	renew(b, later.Add(10*time.Second))
+	if !b.IsLeader() {
+		t.Error("b didn't take over an expired lease")
+	}
+	renew(a, later.Add(10*time.Second))
+	if a.IsLeader() {
+		t.Error("a still leads after its lease was taken over")
+	}
+
+	// Resigning frees the lease straight away
+	if err := b.Resign(); err != nil {
+		t.Fatal(err)
+	}
+	renew(a, later.Add(11*time.Second))
+	renew(a, later.Add(21*time.Second))
+	if !a.IsLeader() || b.IsLeader() {
+		t.Error("a didn't take over after b resigned")
+	}
+
+	// A garbled lease is treated as expired
+	os.WriteFile(path, []byte("{"), 0644)
+	c, _ := NewLeadership("true", "c", path)
+	renew(c, later.Add(22*time.Second))
+	if c.Leader() != "c" {
+		t.Errorf("leader after the lease was garbled = %q, want c", c.Leader())
+	}
+}
+
+func TestLeaderOnlyJobs(t *testing.T) {
+	sc := NewScheduler()
+	sc.UseLeader(func() bool { return false })
+	ran := make(chan string, 2)
+	sc.Add(Job{Name: "digest", Every: time.Hour, RunAtStart: true, LeaderOnly: true, Run: func() error {
+		ran <- "digest"
+		return nil
+	}})
+	sc.Add(Job{Name: "save", Every: time.Hour, RunAtStart: true, Run: func() error {
+		ran <- "save"
+		return nil
+	}})
+	sc.Start()
+	if job := <-ran; job != "save" {
+		t.Errorf("%s ran on an instance that isn't the leader", job)
+	}
+	sc.Stop(t.Context())
+	if statuses := sc.Status(); statuses[0].Runs != 0 {
+		t.Errorf("leader-only job ran %d times, want 0", statuses[0].Runs)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// handleUpdate serves PUT /api/links/{shortcut}, replacing an existing
+// link's destinations with the form-encoded fields used by the add form.
+// The updated link is returned as JSON.
+func (s *Server) handleUpdate(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	link, err := s.linkFromForm(r, r.PathValue("shortcut"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	old, _ := s.store.Get(link.Namespace, link.Shortcut)
+	span := startSpan(r, "LinkStore.Update", linkAttrs(link.Namespace, link.Shortcut)...)
+	found, err := s.store.Update(link)
+	span.End()
+	if err != nil {
+		http.Error(w, "Failed to save link", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Link not found", http.StatusNotFound)
+		return
+	}
+
+	link, _ = s.store.Get(link.Namespace, link.Shortcut)
+	s.audit(r, auditLink(old, true), auditLink(link, true))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(link)
+}
+
+// handleDelete serves DELETE /api/links/{shortcut}
+func (s *Server) handleDelete(w http.ResponseWriter, r *http.Request) {
+	namespace, shortcut := s.hosts.Namespace(r), r.PathValue("shortcut")
+	old, _ := s.store.Get(namespace, shortcut)
+	span := startSpan(r, "LinkStore.Delete", linkAttrs(namespace, shortcut)...)
+	found, err := s.store.Delete(namespace, shortcut)
+	span.End()
+	if err != nil {
+		http.Error(w, "Failed to save links", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Link not found", http.StatusNotFound)
+		return
+	}
+	s.audit(r, auditLink(old, true), nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleListLinks serves GET /api/links, the links in the request's
+// namespace the request may see, ordered by shortcut. They're written as
+// they're read rather than gathered first, as a JSON array or, with
+// format=ndjson or an Accept header asking for application/x-ndjson, one
+// JSON object per line. The links can be filtered with q (as for search),
+// tags (any of them), owner, after (shortcuts following it) and limit.
+func (s *Server) handleListLinks(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	ndjson := query.Get("format") == "ndjson" || strings.Contains(r.Header.Get("Accept"), "application/x-ndjson")
+	if format := query.Get("format"); format != "" && format != "json" && format != "ndjson" {
+		http.Error(w, "Unknown format, want json or ndjson", http.StatusBadRequest)
+		return
+	}
+	limit := -1
+	if value := query.Get("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit < 0 {
+			http.Error(w, "limit must be a number of links", http.StatusBadRequest)
+			return
+		}
+	}
+	search := strings.ToLower(strings.TrimSpace(query.Get("q")))
+	tags := parseTags(query.Get("tags"))
+	owner, after := query.Get("owner"), query.Get("after")
+
+	if ndjson {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	enc := json.NewEncoder(w)
+	sep := "["
+	for link := range s.store.Ordered([]string{s.hosts.Namespace(r)}) {
+		if limit == 0 {
+			break
+		}
+		if after != "" && link.Shortcut <= after ||
+			search != "" && !linkMatches(&link, search) ||
+			len(tags) > 0 && !slices.ContainsFunc(link.Tags, func(tag string) bool { return slices.Contains(tags, tag) }) ||
+			owner != "" && link.Owner != owner && link.CreatedBy != owner ||
+			!s.canSee(r, link) {
+			continue
+		}
+		if !ndjson {
+			io.WriteString(w, sep)
+			sep = ","
+		}
+		if err := enc.Encode(link); err != nil {
+			// The client has gone, and the status was sent with the first links
+			return
+		}
+		limit--
+	}
+	if !ndjson {
+		if sep == "[" {
+			io.WriteString(w, sep)
+		}
+		io.WriteString(w, "]\n")
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestListLinks(t *testing.T) {
+	s := newTestServer(t,
+		Link{Shortcut: "gh", URL: "https://github.com", Tags: []string{"eng"}, Owner: "alice"},
+		Link{Shortcut: "ci", URL: "https://ci.example.com", Tags: []string{"eng"}},
+		Link{Shortcut: "hr", URL: "https://hr.example.com", Description: "People team"},
+		Link{Shortcut: "secret", URL: "https://example.com/secret", Hidden: true},
+		Link{Namespace: "wiki", Shortcut: "home", URL: "https://wiki.example.com"},
+	)
+
+	list := func(query string) string {
+		t.Helper()
+		w := httptest.NewRecorder()
+		s.handleListLinks(w, httptest.NewRequest("GET", "/api/links?"+query, nil))
+		if w.Code != 200 {
+			t.Fatalf("%s: status %d: %s", query, w.Code, w.Body.String())
+		}
+		var links []Link
+		if err := json.Unmarshal(w.Body.Bytes(), &links); err != nil {
+			t.Fatalf("%s: %v:\n%s", query, err, w.Body.String())
+		}
+		var shortcuts []string
+		for _, link := range links {
+			shortcuts = append(shortcuts, link.Shortcut)
+		}
+		return strings.Join(shortcuts, ",")
+	}
+	for query, want := range map[string]string{
+		"":                   "ci,gh,hr",
+		"q=people":           "hr",
+		"tags=ENG,docs":      "ci,gh",
+		"owner=alice":        "gh",
+		"after=ci&limit=1":   "gh",
+		"limit=0":            "",
+		"q=nothing+matching": "",
+	} {
+		if got := list(query); got != want {
+			t.Errorf("%q lists %s, want %s", query, got, want)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	s.handleListLinks(w, httptest.NewRequest("GET", "/api/links?limit=lots", nil))
+	if w.Code != 400 {
+		t.Errorf("limit=lots: status %d, want 400", w.Code)
+	}
+}
+
+func TestListLinksNDJSON(t *testing.T) {
+	s := newTestServer(t)
+	s.store = newBenchStore(t, 1000)
+
+	r := httptest.NewRequest("GET", "/api/links", nil)
+	r.Header.Set("Accept", "application/x-ndjson")
+	w := httptest.NewRecorder()
+	s.handleListLinks(w, r)
+	if ct := w.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+
+	lines := bufio.NewScanner(w.Body)
+	var n int
+	for ; lines.Scan(); n++ {
+		var link Link
+		if err := json.Unmarshal(lines.Bytes(), &link); err != nil {
+			t.Fatalf("line %d: %v", n+1, err)
+		}
+		if n == 0 && link.Shortcut != "gh0" {
+			t.Errorf("first link is %s, want gh0", link.Shortcut)
+		}
+	}
+	if n != 1000 {
+		t.Errorf("got %d lines, want 1000", n)
+	}
+}
+
+func TestExportMatchesLinksFile(t *testing.T) {
+	s := newTestServer(t)
+	var b strings.Builder
+	if err := s.store.Export(&b); err != nil || b.String() != "[]\n" {
+		t.Errorf("empty export = %q, %v", b.String(), err)
+	}
+
+	for i := range 3 {
+		s.store.Add(Link{Namespace: fmt.Sprint("ns", i%2), Shortcut: fmt.Sprint("l", 3-i), URL: "https://example.com/<a>"})
+	}
+	// Ordered by namespace, then shortcut, as when encoded all at once
+	var links []Link
+	for _, key := range []linkKey{{"ns0", "l1"}, {"ns0", "l3"}, {"ns1", "l2"}} {
+		link, _ := s.store.Get(key.namespace, key.shortcut)
+		links = append(links, link)
+	}
+	want, _ := json.MarshalIndent(links, "", "  ")
+	b.Reset()
+	if err := s.store.Export(&b); err != nil || b.String() != string(want)+"\n" {
+		t.Errorf("export = %s, want %s", b.String(), want)
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// tcpNetwork returns the network to listen on for an IP version: "4" or
+// "6" for just that one, or by default both, in which case an IPv6
+// wildcard address such as [::]:3001 also accepts IPv4 connections
+func tcpNetwork(ipVersion string) (string, error) {
+	switch ipVersion {
+	case "":
+		return "tcp", nil
+	case "4":
+		return "tcp4", nil
+	case "6":
+		return "tcp6", nil
+	}
+	return "", fmt.Errorf("IP version %q: want 4 or 6, or nothing for both", ipVersion)
+}
+
+// listenTCP listens on a TCP address. A hostname is resolved and every
+// address it has for the IP version is listened on, so localhost:3001
+// means both 127.0.0.1:3001 and [::1]:3001.
+func listenTCP(addr string, config ListenConfig) ([]net.Listener, error) {
+	network, err := tcpNetwork(config.IPVersion)
+	if err != nil {
+		return nil, err
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	listenConfig := net.ListenConfig{}
+	if config.ReusePort {
+		listenConfig.Control = reusePortControl
+	}
+
+	hosts := []string{host}
+	if _, err := netip.ParseAddr(host); host != "" && err != nil {
+		ips, err := net.DefaultResolver.LookupNetIP(context.Background(), "ip"+strings.TrimPrefix(network, "tcp"), host)
+		if err != nil {
+			return nil, fmt.Errorf("resolving %s: %w", host, err)
+		}
+		hosts = hosts[:0]
+		for _, ip := range ips {
+			if h := ip.Unmap().String(); !slices.Contains(hosts, h) {
+				hosts = append(hosts, h)
+			}
+		}
+	}
+
+	var listeners []net.Listener
+	for _, host := range hosts {
+		listener, err := listenConfig.Listen(context.Background(), network, net.JoinHostPort(host, port))
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, err
+		}
+		listeners = append(listeners, listener)
+	}
+	return listeners, nil
+}
+
+// describeListener lists the addresses a listener is listening on for the
+// startup log, noting those that take both IPv4 and IPv6 connections
+func describeListener(listener net.Listener, ipVersion string) string {
+	addrs := []net.Addr{listener.Addr()}
+	if ml, ok := listener.(*multiListener); ok {
+		addrs = ml.Addrs()
+	}
+	var described []string
+	for _, addr := range addrs {
+		text := addr.String()
+		if addr.Network() == "unix" {
+			text = "unix:" + text
+		} else if tcp, ok := addr.(*net.TCPAddr); ok && ipVersion == "" && tcp.IP.IsUnspecified() && tcp.IP.To4() == nil {
+			text += " (IPv4 and IPv6)"
+		}
+		described = append(described, text)
+	}
+	return strings.Join(described, ", ")
+}
+
+// multiListener accepts connections from several listeners at once, so
+// one server can listen on, say, both 127.0.0.1 and ::1
+type multiListener struct {
+	listeners []net.Listener
+	conns     chan net.Conn
+	errs      chan error
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newMultiListener(listeners []net.Listener) *multiListener {
+	ml := &multiListener{
+		listeners: listeners,
+		conns:     make(chan net.Conn),
+		errs:      make(chan error),
+		done:      make(chan struct{}),
+	}
+	for _, listener := range listeners {
+		go ml.accept(listener)
+	}
+	return ml
+}
+
+// accept passes on connections and errors from one of the listeners until
+// it is closed
+func (ml *multiListener) accept(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			select {
+			case ml.errs <- err:
+				continue
+			case <-ml.done:
+				return
+			}
+		}
+		select {
+		case ml.conns <- conn:
+		case <-ml.done:
+			conn.Close()
+			return
+		}
+	}
+}
+
+func (ml *multiListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-ml.conns:
+		return conn, nil
+	case err := <-ml.errs:
+		return nil, err
+	case <-ml.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (ml *multiListener) Close() error {
+	var errs []error
+	ml.closeOnce.Do(func() {
+		close(ml.done)
+		for _, listener := range ml.listeners {
+			errs = append(errs, listener.Close())
+		}
+	})
+	return errors.Join(errs...)
+}
+
+// Addr returns the first listener's address
+func (ml *multiListener) Addr() net.Addr {
+	return ml.listeners[0].Addr()
+}
+
+// Addrs returns every listener's address
+func (ml *multiListener) Addrs() []net.Addr {
+	addrs := make([]net.Addr, len(ml.listeners))
+	for i, listener := range ml.listeners {
+		addrs[i] = listener.Addr()
+	}
+	return addrs
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestListenOnSeveralAddresses(t *testing.T) {
+	if l, err := net.Listen("tcp6", "[::1]:0"); err != nil {
+		t.Skip("no IPv6 loopback here")
+	} else {
+		l.Close()
+	}
+	listener, err := listen("127.0.0.1:0, [::1]:0", ListenConfig{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	described := describeListener(listener, "")
+	if !strings.HasPrefix(described, "127.0.0.1:") || !strings.Contains(described, ", [::1]:") {
+		t.Errorf("listening on %s, want 127.0.0.1 and ::1", described)
+	}
+
+	go http.Serve(listener, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	for _, addr := range listener.(*multiListener).Addrs() {
+		resp, err := http.Get("http://" + addr.String())
+		if err != nil {
+			t.Errorf("%s: %v", addr, err)
+			continue
+		}
+		resp.Body.Close()
+	}
+}
+
+func TestListenIPVersion(t *testing.T) {
+	if _, err := listen("127.0.0.1:0", ListenConfig{IPVersion: "5"}, false); err == nil {
+		t.Error("IP version 5 accepted")
+	}
+	if _, err := listen("127.0.0.1:0", ListenConfig{IPVersion: "6"}, false); err == nil {
+		t.Error("listening on an IPv4 address for IPv6 only succeeded")
+	}
+
+	listener, err := listen(":0", ListenConfig{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	if ip := listener.Addr().(*net.TCPAddr).IP; ip.To4() == nil && !strings.HasSuffix(describeListener(listener, ""), "(IPv4 and IPv6)") {
+		t.Errorf("wildcard address described as %q, want it noted as dual-stack", describeListener(listener, ""))
+	}
+	if described := describeListener(listener, "6"); strings.Contains(described, "IPv4") {
+		t.Errorf("IPv6-only wildcard address described as %q", described)
+	}
+}
+
+func TestListenResolvesHostnames(t *testing.T) {
+	listener, err := listen("localhost:0", ListenConfig{IPVersion: "4"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	if !strings.HasPrefix(listener.Addr().String(), "127.0.0.1:") {
+		t.Errorf("localhost for IPv4 = %s, want 127.0.0.1", listener.Addr())
+	}
+}
+
+func TestMultiListenerClose(t *testing.T) {
+	var listeners []net.Listener
+	for range 2 {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		listeners = append(listeners, l)
+	}
+	ml := newMultiListener(listeners)
+	accepted := make(chan error)
+	go func() {
+		_, err := ml.Accept()
+		accepted <- err
+	}()
+	if err := ml.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-accepted; err != net.ErrClosed {
+		t.Errorf("Accept after Close = %v, want net.ErrClosed", err)
+	}
+	if _, err := net.Dial("tcp", listeners[1].Addr().String()); err == nil {
+		t.Error("still accepting connections after Close")
+	}
+}
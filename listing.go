@@ -0,0 +1,174 @@
+package main
+
+import (
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// perPageOptions are the page sizes offered on the homepage
+var perPageOptions = []int{25, 50, 100, 250}
+
+// linkListing is one page of the homepage links table
+type linkListing struct {
+	Links   []Link
+	Query   string
+	Sort    string // "name", "created" or "clicks"
+	Order   string // "asc" or "desc"
+	Page    int
+	Pages   int
+	PerPage int
+	Total   int
+}
+
+// newLinkListing builds the page of links, which are sorted by shortcut,
+// described by the homepage query string: q filters, sort and order pick
+// the column and direction, and page and per_page select the slice.
+// Invalid values fall back to the first page of links sorted by name.
+func newLinkListing(links []*Link, params url.Values) *linkListing {
+	l := &linkListing{
+		Query:   strings.TrimSpace(params.Get("q")),
+		Sort:    params.Get("sort"),
+		Order:   params.Get("order"),
+		PerPage: perPageOptions[0],
+	}
+
+	switch l.Sort {
+	case "created", "clicks":
+		// Newest and most used first unless asked otherwise
+		if l.Order != "asc" {
+			l.Order = "desc"
+		}
+	default:
+		l.Sort = "name"
+		if l.Order != "desc" {
+			l.Order = "asc"
+		}
+	}
+
+	if n, err := strconv.Atoi(params.Get("per_page")); err == nil {
+		for _, option := range perPageOptions {
+			if n == option {
+				l.PerPage = n
+			}
+		}
+	}
+
+	query := strings.ToLower(l.Query)
+	matches := links
+	if query != "" {
+		matches = make([]*Link, 0, len(links))
+		for _, link := range links {
+			if linkMatches(link, query) {
+				matches = append(matches, link)
+			}
+		}
+	}
+	// The links are in name order already
+	if l.Sort != "name" || l.Order == "desc" {
+		matches = slices.Clone(matches)
+		sortLinks(matches, l.Sort, l.Order == "desc")
+	}
+
+	l.Total = len(matches)
+	l.Pages = max(1, (l.Total+l.PerPage-1)/l.PerPage)
+	l.Page, _ = strconv.Atoi(params.Get("page"))
+	l.Page = min(max(l.Page, 1), l.Pages)
+
+	start := (l.Page - 1) * l.PerPage
+	l.Links = []Link{}
+	for _, link := range matches[start:min(start+l.PerPage, l.Total)] {
+		l.Links = append(l.Links, *link)
+	}
+	return l
+}
+
+// sortLinks orders links by the given column, breaking ties by shortcut
+func sortLinks(links []*Link, column string, desc bool) {
+	sort.SliceStable(links, func(i, j int) bool {
+		a, b := links[i], links[j]
+		if desc {
+			a, b = b, a
+		}
+		switch column {
+		case "created":
+			if !a.CreatedAt.Equal(b.CreatedAt) {
+				return a.CreatedAt.Before(b.CreatedAt)
+			}
+		case "clicks":
+			if a.Clicks != b.Clicks {
+				return a.Clicks < b.Clicks
+			}
+		}
+		return a.Shortcut < b.Shortcut
+	})
+}
+
+// URL returns the homepage URL for this listing with the given parameters
+// changed, e.g. l.URL("page", "2")
+func (l *linkListing) URL(changes ...string) string {
+	params := url.Values{}
+	if l.Query != "" {
+		params.Set("q", l.Query)
+	}
+	params.Set("sort", l.Sort)
+	params.Set("order", l.Order)
+	params.Set("per_page", strconv.Itoa(l.PerPage))
+	params.Set("page", strconv.Itoa(l.Page))
+
+	for i := 0; i+1 < len(changes); i += 2 {
+		params.Set(changes[i], changes[i+1])
+	}
+	return "/?" + params.Encode()
+}
+
+// SortURL returns the URL for sorting by column: toggling the direction
+// when it's already the sort column, and starting from the first page
+func (l *linkListing) SortURL(column string) string {
+	order := ""
+	if column == l.Sort {
+		order = "desc"
+		if l.Order == "desc" {
+			order = "asc"
+		}
+	} else if column == "name" {
+		order = "asc"
+	} else {
+		order = "desc"
+	}
+	return l.URL("sort", column, "order", order, "page", "1")
+}
+
+// SortIndicator returns an arrow for the current sort column
+func (l *linkListing) SortIndicator(column string) string {
+	switch {
+	case column != l.Sort:
+		return ""
+	case l.Order == "desc":
+		return " ▼"
+	default:
+		return " ▲"
+	}
+}
+
+// PageURL returns the URL for page n of this listing
+func (l *linkListing) PageURL(n int) string {
+	return l.URL("page", strconv.Itoa(n))
+}
+
+// PrevPage returns the number of the previous page
+func (l *linkListing) PrevPage() int {
+	return l.Page - 1
+}
+
+// NextPage returns the number of the next page
+func (l *linkListing) NextPage() int {
+	return l.Page + 1
+}
+
+// PerPageOptions returns the page sizes offered on the homepage
+func (l *linkListing) PerPageOptions() []int {
+	return perPageOptions
+}
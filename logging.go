@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// logLevel is the level the server logs at, which can change while running
+var logLevel = new(slog.LevelVar)
+
+// LogConfig says how and where the server logs
+type LogConfig struct {
+	Format   string // "text" (the default) or "json"
+	Level    string // "debug", "info" (the default), "warn" or "error"
+	File     string // log to this file instead of stderr
+	MaxSize  string // rotate the file past this many megabytes, default 100
+	MaxFiles string // rotated files to keep, default 5
+}
+
+// NewLogger creates the server's logger from config, also copying its
+// output to tail
+func NewLogger(config LogConfig, tail io.Writer) (*slog.Logger, error) {
+	var level slog.Level
+	if config.Level != "" {
+		if err := level.UnmarshalText([]byte(config.Level)); err != nil {
+			return nil, fmt.Errorf("log level %q: %v", config.Level, err)
+		}
+	}
+
+	var out io.Writer = os.Stderr
+	if config.File != "" {
+		maxSize, err := parseLogCount("log file size", config.MaxSize, 100)
+		if err != nil {
+			return nil, err
+		}
+		maxFiles, err := parseLogCount("log files", config.MaxFiles, 5)
+		if err != nil {
+			return nil, err
+		}
+		f, err := openRotatingFile(config.File, int64(maxSize)<<20, maxFiles)
+		if err != nil {
+			return nil, err
+		}
+		out = f
+	}
+	if tail != nil {
+		out = io.MultiWriter(out, tail)
+	}
+
+	logLevel.Set(level)
+	options := &slog.HandlerOptions{Level: logLevel}
+	var handler slog.Handler
+	switch strings.ToLower(config.Format) {
+	case "", "text":
+		handler = slog.NewTextHandler(out, options)
+	case "json":
+		handler = slog.NewJSONHandler(out, options)
+	default:
+		return nil, fmt.Errorf("log format %q: want text or json", config.Format)
+	}
+	return slog.New(handler), nil
+}
+
+// parseLogCount parses a non-negative number from the log configuration,
+// defaulting to def when it is empty
+func parseLogCount(name, value string, def int) (int, error) {
+	if value == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s %q: want a number", name, value)
+	}
+	return n, nil
+}
+
+// useLogger makes logger the default, for both slog and the log package, so
+// log.Printf calls come out in the same format as everything else
+func useLogger(logger *slog.Logger) {
+	slog.SetDefault(logger)
+	log.SetFlags(0)
+	log.SetOutput(logBridge{logger})
+}
+
+// logBridge passes lines written with the log package to a slog.Logger.
+// Lines starting "Warning" are logged as warnings, the rest as information.
+type logBridge struct {
+	logger *slog.Logger
+}
+
+func (b logBridge) Write(p []byte) (int, error) {
+	msg := strings.TrimRight(string(p), "\n")
+	level := slog.LevelInfo
+	if strings.HasPrefix(msg, "Warning") {
+		level = slog.LevelWarn
+	}
+	b.logger.Log(context.Background(), level, msg)
+	return len(p), nil
+}
+
+// rotatingFile is a log file that is renamed aside once it grows too big:
+// app.log becomes app.log.1, app.log.1 becomes app.log.2 and so on, keeping
+// up to maxFiles old files
+type rotatingFile struct {
+	mu       sync.Mutex
+	path     string
+	maxSize  int64
+	maxFiles int
+	f        *os.File
+	size     int64
+}
+
+// openRotatingFile opens path for appending, creating its directory if
+// needed. A maxSize of 0 never rotates.
+func openRotatingFile(path string, maxSize int64, maxFiles int) (*rotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	rf := &rotatingFile{path: path, maxSize: maxSize, maxFiles: maxFiles}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+func (rf *rotatingFile) open() error {
+	f, err := os.OpenFile(rf.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	rf.f, rf.size = f, info.Size()
+	return nil
+}
+
+func (rf *rotatingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.maxSize > 0 && rf.size > 0 && rf.size+int64(len(p)) > rf.maxSize {
+		if err := rf.rotate(); err != nil {
+			// Keep logging to the full file rather than losing lines
+			fmt.Fprintf(os.Stderr, "Rotating log file: %v\n", err)
+		}
+	}
+	n, err := rf.f.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+// rotate shifts the old files along, dropping the oldest, and starts a new
+// file
+func (rf *rotatingFile) rotate() error {
+	if err := rf.f.Close(); err != nil {
+		return err
+	}
+	if rf.maxFiles > 0 {
+		os.Remove(fmt.Sprintf("%s.%d", rf.path, rf.maxFiles))
+		for i := rf.maxFiles - 1; i >= 1; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", rf.path, i), fmt.Sprintf("%s.%d", rf.path, i+1))
+		}
+		if err := os.Rename(rf.path, rf.path+".1"); err != nil {
+			return err
+		}
+	} else if err := os.Remove(rf.path); err != nil {
+		return err
+	}
+	return rf.open()
+}
+
+// requestIDHeader carries a request's ID, from a proxy in front of the
+// server if it sets one, and back to the client
+const requestIDHeader = "X-Request-ID"
+
+// validRequestID matches request IDs accepted from clients, keeping the
+// logs free of anything odd
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,64}$`)
+
+type requestIDKey struct{}
+
+// requestID returns the ID given to a request by logRequests, or ""
+func requestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey{}).(string)
+	return id
+}
+
+// logFor returns the logger to use while handling r, which tags each entry
+// with the request's ID
+func logFor(r *http.Request) *slog.Logger {
+	logger := slog.Default()
+	if id := requestID(r); id != "" {
+		logger = logger.With("request_id", id)
+	}
+	if sc := trace.SpanContextFromContext(r.Context()); sc.IsValid() {
+		logger = logger.With("trace_id", sc.TraceID().String())
+	}
+	return logger
+}
+
+// newRequestID makes a random request ID
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// statusRecorder notes the status and size of a response on its way out
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	if sr.status == 0 {
+		sr.status = status
+	}
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+func (sr *statusRecorder) Write(p []byte) (int, error) {
+	if sr.status == 0 {
+		sr.status = http.StatusOK
+	}
+	n, err := sr.ResponseWriter.Write(p)
+	sr.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (sr *statusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
+
+// outcome sums up a response status for the access log
+func outcome(status int) string {
+	switch {
+	case status >= 500:
+		return "error"
+	case status >= 400:
+		return "rejected"
+	case status >= 300:
+		return "redirect"
+	default:
+		return "ok"
+	}
+}
+
+// logRequests gives every request an ID, returned in the X-Request-ID
+// header, and writes an access log entry for it once handled (unless
+// access logging is off). Static files are only logged at debug level.
+func (s *Server) logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		r = r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id))
+		trace.SpanFromContext(r.Context()).SetAttributes(attribute.String("golinks.request_id", id))
+
+		sr := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(sr, r)
+		if s.accessLog == nil {
+			return
+		}
+		if sr.status == 0 {
+			sr.status = http.StatusOK
+		}
+
+		level := slog.LevelInfo
+		switch {
+		case sr.status >= 500:
+			level = slog.LevelError
+		case strings.HasPrefix(r.URL.Path, "/static/"):
+			level = slog.LevelDebug
+		}
+		attrs := []slog.Attr{
+			slog.String("request_id", id),
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", sr.status),
+			slog.String("outcome", outcome(sr.status)),
+			slog.Int64("bytes", sr.bytes),
+			slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("user", s.currentUser(r)),
+			slog.String("ip", s.anonIP(r)),
+		}
+		if sc := trace.SpanContextFromContext(r.Context()); sc.IsValid() {
+			attrs = append(attrs, slog.String("trace_id", sc.TraceID().String()))
+		}
+		s.accessLog.LogAttrs(r.Context(), level, "request", attrs...)
+	})
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewLogger(t *testing.T) {
+	for _, config := range []LogConfig{
+		{Level: "loud"},
+		{Format: "xml"},
+		{File: filepath.Join(t.TempDir(), "app.log"), MaxSize: "big"},
+	} {
+		if _, err := NewLogger(config, nil); err == nil {
+			t.Errorf("NewLogger(%+v) succeeded, want an error", config)
+		}
+	}
+
+	var tail bytes.Buffer
+	logger, err := NewLogger(LogConfig{Format: "json", Level: "warn"}, &tail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Info("chatter")
+	logBridge{logger}.Write([]byte("Warning: Could not load stars file: oops\n"))
+	var entry map[string]any
+	if err := json.Unmarshal(tail.Bytes(), &entry); err != nil {
+		t.Fatalf("log output %q: %v", tail.String(), err)
+	}
+	if entry["level"] != "WARN" || entry["msg"] != "Warning: Could not load stars file: oops" {
+		t.Errorf("entry = %v, want just the warning", entry)
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "app.log")
+	rf, err := openRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := rf.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for name, want := range map[string]string{
+		path:        "fourth\n",
+		path + ".1": "third\n",
+		path + ".2": "second\n",
+	} {
+		if got, _ := os.ReadFile(name); string(got) != want {
+			t.Errorf("%s = %q, want %q", filepath.Base(name), got, want)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("kept more than 2 old files")
+	}
+}
+
+func TestLogRequests(t *testing.T) {
+	s := newTestServer(t, Link{Shortcut: "wiki", URL: "https://wiki.example.com"})
+	s.userHeader = "X-User"
+	s.proxies = httptestProxy
+	var out bytes.Buffer
+	s.accessLog = slog.New(slog.NewJSONHandler(&out, nil))
+
+	var seen string
+	handler := s.logRequests(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = requestID(r)
+		s.handleHome(w, r)
+	}))
+
+	r := httptest.NewRequest("GET", "/wiki", nil)
+	r.Header.Set("X-User", "alice@example.com")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	id := w.Header().Get(requestIDHeader)
+	if id == "" || id != seen {
+		t.Errorf("request ID %q, handler saw %q", id, seen)
+	}
+	var entry struct {
+		RequestID string  `json:"request_id"`
+		Method    string  `json:"method"`
+		Path      string  `json:"path"`
+		Status    int     `json:"status"`
+		Outcome   string  `json:"outcome"`
+		User      string  `json:"user"`
+		Duration  float64 `json:"duration_ms"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &entry); err != nil {
+		t.Fatalf("access log %q: %v", out.String(), err)
+	}
+	if entry.RequestID != id || entry.Method != "GET" || entry.Path != "/wiki" || entry.Status != http.StatusFound ||
+		entry.Outcome != "redirect" || entry.User != "alice@example.com" {
+		t.Errorf("access log entry = %+v", entry)
+	}
+
+	// IDs from a proxy in front are kept, unless they look odd
+	for header, keep := range map[string]bool{"req-42": true, "<script>": false, strings.Repeat("a", 65): false} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set(requestIDHeader, header)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if got := w.Header().Get(requestIDHeader); (got == header) != keep {
+			t.Errorf("incoming ID %q: got %q", header, got)
+		}
+	}
+
+	// Requests still get IDs with access logging off
+	s.accessLog = nil
+	out.Reset()
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Header().Get(requestIDHeader) == "" || out.Len() != 0 {
+		t.Errorf("with access logging off: ID %q, logged %q", w.Header().Get(requestIDHeader), out.String())
+	}
+}
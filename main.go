@@ -1,109 +1,923 @@
 package main
 
 import (
+	"bufio"
+	"cmp"
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"iter"
 	"log"
+	"log/slog"
+	"maps"
+	"net"
 	"net/http"
+	"net/netip"
+	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
-	"text/template"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
 )
 
 // Link represents a shortcut and its destination URL
 type Link struct {
 	Shortcut string `json:"shortcut"`
 	URL      string `json:"url"`
+
+	// Description is a short note on what the link is for
+	Description string `json:"description,omitempty"`
+
+	// Namespace separates links served on different vanity hostnames;
+	// empty is the default namespace
+	Namespace string `json:"namespace,omitempty"`
+
+	// Regions maps a region code (e.g. "us", "eu") to an override destination
+	Regions map[string]string `json:"regions,omitempty"`
+
+	// MobileURL is an alternate destination for phones and tablets
+	MobileURL string `json:"mobile_url,omitempty"`
+
+	// Calendar makes the link go to the video call of the next event in a
+	// calendar whose title matches, as "calendar: event title"
+	Calendar string `json:"calendar,omitempty"`
+
+	// Fragment is appended as #fragment when the destination has none
+	Fragment string `json:"fragment,omitempty"`
+
+	// CacheControl overrides the server-wide Cache-Control header on redirects
+	CacheControl string `json:"cache_control,omitempty"`
+
+	// CreatedAt is when the link was first added; zero for older links
+	CreatedAt time.Time `json:"created_at,omitzero"`
+
+	// Clicks counts redirects served for the link
+	Clicks int `json:"clicks,omitempty"`
+
+	// DailyClicks counts redirects per UTC day ("2006-01-02") over the
+	// last clickHistoryDays days
+	DailyClicks map[string]int `json:"daily_clicks,omitempty"`
+
+	// Referrers counts clicks by the site they came from, and Clients by
+	// browser and operating system, see clickSource
+	Referrers map[string]int `json:"referrers,omitempty"`
+	Clients   map[string]int `json:"clients,omitempty"`
+
+	// UpdatedAt is when the link was last edited, moved or archived; zero
+	// if it hasn't been since it was created
+	UpdatedAt time.Time `json:"updated_at,omitzero"`
+
+	// LastClickedAt is when the link was last followed
+	LastClickedAt time.Time `json:"last_clicked_at,omitzero"`
+
+	// ExpiryWarnedAt is when the link was flagged as unused and its owner
+	// told it would be archived, and ArchivedAt when it was archived; see
+	// ExpiryPolicy. Archived links don't redirect. Following or editing a
+	// link clears both.
+	ExpiryWarnedAt time.Time `json:"expiry_warned_at,omitzero"`
+	ArchivedAt     time.Time `json:"archived_at,omitzero"`
+
+	// Owner is who is responsible for the link
+	Owner string `json:"owner,omitempty"`
+
+	// CreatedBy is the signed-in user who added the link, if known
+	CreatedBy string `json:"created_by,omitempty"`
+
+	// Tags group related links, e.g. "onboarding"
+	Tags []string `json:"tags,omitempty"`
+
+	// Hidden links redirect as usual but are left out of the listing,
+	// search and suggestions for everyone but their owner and admins
+	Hidden bool `json:"hidden,omitempty"`
+
+	// VisibleTo restricts the link to members of these groups: nobody else
+	// can follow it or see it listed
+	VisibleTo []string `json:"visible_to,omitempty"`
+
+	// History holds earlier versions of the link, oldest first
+	History []Revision `json:"history,omitempty"`
 }
 
-// LinkStore manages the storage and retrieval of links
+// Revision is an earlier version of a link's settings, kept when the link
+// is edited
+type Revision struct {
+	// ReplacedAt is when this version was replaced by the next one
+	ReplacedAt   time.Time         `json:"replaced_at"`
+	URL          string            `json:"url"`
+	Description  string            `json:"description,omitempty"`
+	Owner        string            `json:"owner,omitempty"`
+	Regions      map[string]string `json:"regions,omitempty"`
+	MobileURL    string            `json:"mobile_url,omitempty"`
+	Calendar     string            `json:"calendar,omitempty"`
+	Fragment     string            `json:"fragment,omitempty"`
+	CacheControl string            `json:"cache_control,omitempty"`
+}
+
+const (
+	// clickHistoryDays is how many days of daily click counts are kept
+	clickHistoryDays = 30
+
+	// maxRevisions is how many earlier versions of a link are kept
+	maxRevisions = 20
+)
+
+// LinkStore manages the storage and retrieval of links. Redirects read
+// links without taking a lock: readers load a snapshot of the links, which
+// changes swap for a new one, and each link counts its own clicks.
 type LinkStore struct {
-	links    map[string]string
+	mu       sync.Mutex                  // held while changing links, see lockWrite
+	links    map[linkKey]Link            // the links being changed, while mu is held
+	snapshot atomic.Pointer[linkEntries] // the links as readers see them
+	version  atomic.Uint64               // counts snapshots, see Version
 	filePath string
+	dirty    atomic.Bool // clicks recorded since the last save
+
+	// saving is held while the file is written, outside mu so changes
+	// can be made meanwhile and then saved together, see persist
+	saving       sync.Mutex
+	savedVersion uint64    // the newest snapshot written, while saving is held
+	savedAt      time.Time // when the file was last written, while saving is held
+
+	// removedAt is when links were last deleted, moved away or reloaded
+	// from the file, which Changes can't list one by one
+	removedAt time.Time
+
+	file  atomic.Pointer[fileLinks] // the file as last read or written whole, see merge
+	stale atomic.Bool               // a refresh failed, so the next reads every link
+
+	loading atomic.Pointer[chan struct{}] // closed once a background load is done, see LoadInBackground
+}
+
+// linkEntries are the links in a snapshot. The map isn't changed once
+// published, only the clicks counted on its links.
+type linkEntries map[linkKey]*storedLink
+
+// storedLink is a link in a snapshot
+type storedLink struct {
+	mu      sync.Mutex
+	link    Link
+	retired bool // replaced by the next snapshot, so clicks go there
+}
+
+// get returns a copy of the link
+func (sl *storedLink) get() Link {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+	return sl.link
+}
+
+// linkKey identifies a link within its namespace
+type linkKey struct {
+	namespace string
+	shortcut  string
 }
 
 // Server handles HTTP requests
 type Server struct {
-	store *LinkStore
+	store         *LinkStore
+	hosts         *HostMap
+	blocklist     *Blocklist
+	urls          atomic.Pointer[URLValidator] // swapped on reload, see reloadConfig
+	regions       *RegionResolver
+	fallback      *Fallback
+	theme         atomic.Pointer[Theme]
+	stars         *StarStore
+	misses        *MissStore
+	clickEvents   *ClickEvents // nil unless clicks are exported
+	memory        *Memory      // nil when memory isn't accounted for
+	tokens        *TokenStore
+	proposals     *ProposalStore
+	userHeader    string
+	groupsHeader  string
+	proxies       []netip.Prefix // trusted to set identity and X-Forwarded-* headers; empty trusts identity headers over loopback only
+	admins        *AdminAuth
+	editors       *EditAuth
+	reserved      map[string]bool // namespaces only admins may change
+	acl           *ACL
+	groups        *GroupStore
+	sso           *SSO
+	saml          *SAML
+	ldap          *LDAP
+	sessions      *Sessions
+	clientCerts   *ClientCerts
+	signInToEdit  bool
+	readOnly      bool // refuse all changes, see rejectWrites
+	maintenance   *Maintenance
+	quotas        *Quotas
+	rateLimiter   atomic.Pointer[RateLimiter] // nil when requests aren't rate limited
+	concurrency   *ConcurrencyLimit           // nil when requests aren't limited
+	expiry        *ExpiryPolicy
+	privacy       *Privacy       // nil collects analytics and keeps IP addresses in full
+	digest        *Digest        // nil when no digest is emailed
+	metrics       *Metrics       // nil when metrics aren't served
+	slack         *Slack         // nil without a Slack app for the slash command
+	announcer     *Announcer     // nil when new links aren't announced
+	gitRepo       *GitRepo       // nil when changes aren't committed to Git
+	calendars     *Calendars     // nil when no calendars are configured
+	webhooks      *Webhooks      // nil when no outbound webhooks are configured
+	invalidations *Invalidations // nil when no other instances are told of changes
+	peers         *Peers         // nil when changes aren't sent to peers directly
+	home          homeCache      // the homepage's view of the links
+	search        searchIndexes  // for search and suggestions
+	jobs          *Scheduler
+	leadership    *Leadership // nil when every instance runs every job
+	auditLog      *AuditLog
+	logs          *logTail
+	accessLog     *slog.Logger // nil when requests aren't logged
+	startedAt     time.Time
+	cacheControl  string
 }
 
-// Load reads links from the JSON file
+// Load reads links from the JSON file, replacing any links in memory
 func (ls *LinkStore) Load() error {
+	loaded, info, err := ls.read()
+	if err != nil {
+		return err
+	}
+	ls.remember(info, slices.Collect(maps.Values(loaded)))
+	if loaded == nil {
+		return nil
+	}
+
+	ls.lockWrite()
+	defer ls.unlockWrite()
+	ls.links = loaded
+	ls.dirty.Store(false)
+	ls.removedAt = time.Now().UTC()
+	return nil
+}
+
+// read reads the links in the JSON file, with the file's details, or nil
+// if there isn't one yet
+func (ls *LinkStore) read() (map[linkKey]Link, os.FileInfo, error) {
 	// Ensure directory exists
 	dir := filepath.Dir(ls.filePath)
 	if err := os.MkdirAll(dir, 0755); err != nil {
-		return err
+		return nil, nil, err
 	}
 
-	// Check if file exists
-	if _, err := os.Stat(ls.filePath); os.IsNotExist(err) {
-		// File doesn't exist, start with empty map
-		return nil
+	// Read the file, if it exists yet
+	f, err := os.Open(ls.filePath)
+	if os.IsNotExist(err) {
+		return nil, nil, nil
+	} else if err != nil {
+		return nil, nil, err
 	}
-
-	// Read the file
-	data, err := os.ReadFile(ls.filePath)
+	defer f.Close()
+	info, err := f.Stat()
 	if err != nil {
-		return err
+		return nil, nil, err
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	// Parse JSON
 	var links []Link
 	if err := json.Unmarshal(data, &links); err != nil {
-		return err
+		return nil, nil, err
 	}
 
 	// Convert to map
+	loaded := make(map[linkKey]Link, len(links))
 	for _, link := range links {
-		ls.links[link.Shortcut] = link.URL
+		loaded[linkKey{link.Namespace, link.Shortcut}] = link
 	}
+	return loaded, info, nil
+}
 
+// Refresh reads the links in keys (or every link, if nil) from the JSON
+// file again, after another instance sharing it has changed them. Clicks
+// counted here are kept, saved or not, as the other instance's counts
+// can't be told apart from ours. After a refresh fails, the next reads
+// every link, as changes may have been missed.
+func (ls *LinkStore) Refresh(keys []linkKey) error {
+	if ls.stale.Load() {
+		keys = nil
+	}
+	loaded, info, err := ls.read()
+	if err != nil {
+		ls.stale.Store(true)
+		return err
+	}
+	if loaded == nil {
+		return nil
+	}
+	ls.apply(loaded, keys)
+	if keys == nil {
+		ls.remember(info, slices.Collect(maps.Values(loaded)))
+		ls.stale.Store(false)
+	}
 	return nil
 }
 
+// apply takes the links in keys (or every link, if nil) from loaded, links
+// read from the file, keeping the clicks counted here
+func (ls *LinkStore) apply(loaded map[linkKey]Link, keys []linkKey) {
+	ls.lockWrite()
+	defer ls.unlockWrite()
+	if keys == nil {
+		for key := range ls.links {
+			keys = append(keys, key)
+		}
+		for key := range loaded {
+			keys = append(keys, key)
+		}
+	}
+	for _, key := range keys {
+		link, ok := loaded[key]
+		existing, had := ls.links[key]
+		switch {
+		case !ok && had:
+			delete(ls.links, key)
+			ls.removedAt = time.Now().UTC()
+		case ok && had:
+			ls.links[key] = keepClicks(existing, link)
+		case ok:
+			ls.links[key] = link
+		}
+	}
+}
+
+// keepClicks returns link with the click counts of existing
+func keepClicks(existing, link Link) Link {
+	link.Clicks, link.DailyClicks = existing.Clicks, existing.DailyClicks
+	link.Referrers, link.Clients = existing.Referrers, existing.Clients
+	link.LastClickedAt = existing.LastClickedAt
+	return link
+}
+
 // Save writes links to the JSON file
 func (ls *LinkStore) Save() error {
-	// Convert map to slice
+	ls.saving.Lock()
+	defer ls.saving.Unlock()
+	return ls.save()
+}
+
+// lockWrite locks the store for a change, filling ls.links with the links
+// to change. The snapshot's links are retired, so clicks on them wait for
+// the change and are counted on the new versions.
+func (ls *LinkStore) lockWrite() {
+	ls.mu.Lock()
+	entries := ls.entries()
+	ls.links = make(map[linkKey]Link, len(entries))
+	for key, entry := range entries {
+		entry.mu.Lock()
+		ls.links[key] = entry.link
+		entry.retired = true
+		entry.mu.Unlock()
+	}
+}
+
+// unlockWrite publishes ls.links as the new snapshot and unlocks the store,
+// returning the snapshot's version
+func (ls *LinkStore) unlockWrite() uint64 {
+	entries := make(linkEntries, len(ls.links))
+	for key, link := range ls.links {
+		entries[key] = &storedLink{link: link}
+	}
+	ls.snapshot.Store(&entries)
+	version := ls.version.Add(1)
+	ls.links = nil
+	ls.mu.Unlock()
+	return version
+}
+
+// unlockAndSave publishes a change, unlocks the store and returns once the
+// change is saved
+func (ls *LinkStore) unlockAndSave() error {
+	return ls.persist(ls.unlockWrite())
+}
+
+// persist saves the links as of version, unless a save since has. Changes
+// don't write the file themselves: the first to find no save in progress
+// writes every change published so far, and those arriving meanwhile wait
+// for it and then save together, so a burst of changes costs a few writes
+// rather than one each.
+func (ls *LinkStore) persist(version uint64) error {
+	ls.saving.Lock()
+	defer ls.saving.Unlock()
+	if ls.savedVersion >= version {
+		return nil
+	}
+	return ls.save()
+}
+
+// Version changes whenever links are changed or their clicks saved, for
+// caching what's worked out from them. Clicks alone don't change it until
+// they're saved.
+func (ls *LinkStore) Version() uint64 {
+	return ls.version.Load()
+}
+
+// entries returns the current snapshot of the links
+func (ls *LinkStore) entries() linkEntries {
+	if entries := ls.snapshot.Load(); entries != nil {
+		return *entries
+	}
+	return nil
+}
+
+// saveRetries is how many times a failed save is tried again, after
+// saveRetryDelay and then twice as long each time, as a disk that's briefly
+// full or a network filesystem may recover
+const (
+	saveRetries    = 3
+	saveRetryDelay = 100 * time.Millisecond
+)
+
+// save writes the current snapshot to the JSON file, clicks and all,
+// trying again if it fails; the caller must hold ls.saving. Links still
+// loading in the background are waited for, as writing only some of them
+// would lose the rest.
+func (ls *LinkStore) save() error {
+	if loaded := ls.loaded(); loaded != nil {
+		<-loaded
+	}
+	delay := saveRetryDelay
+	for attempt := 0; ; attempt++ {
+		err := ls.write()
+		if err == nil || attempt == saveRetries {
+			return err
+		}
+		log.Printf("Warning: Could not save links, trying again in %v: %v", delay, err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// write writes the current snapshot to the JSON file; the caller must hold
+// ls.saving
+func (ls *LinkStore) write() error {
+	// Clicks recorded from here on are saved next time
+	ls.dirty.Store(false)
+	version := ls.version.Load()
 	var links []Link
-	for shortcut, url := range ls.links {
-		links = append(links, Link{
-			Shortcut: shortcut,
-			URL:      url,
-		})
+	for _, entry := range ls.entries() {
+		links = append(links, entry.get())
 	}
 
-	// Marshal to JSON
-	data, err := json.MarshalIndent(links, "", "  ")
+	// Other instances sharing the file may have saved changes since it was
+	// last read, which are kept rather than written over, and read here
+	// too. The file is replaced whole, so they never read half of it.
+	unlock, err := lockFile(ls.lockPath())
 	if err != nil {
+		ls.dirty.Store(true)
 		return err
 	}
+	defer unlock()
+	links, theirs, changed, err := ls.merge(links)
+	var data []byte
+	if err == nil {
+		data, err = json.MarshalIndent(links, "", "  ")
+	}
+	if err == nil {
+		err = replaceFile(ls.filePath, data, 0644)
+	}
+	var info os.FileInfo
+	if err == nil {
+		info, err = os.Stat(ls.filePath)
+	}
+	if err != nil {
+		ls.dirty.Store(true)
+		return err
+	}
+	ls.remember(info, links)
+	if len(changed) > 0 {
+		ls.apply(theirs, changed)
+	}
+	ls.savedVersion = version
+	ls.savedAt = time.Now()
+	return nil
+}
+
+// Add creates a new link. Re-adding an existing shortcut replaces its
+// destination but keeps its creation time and click count.
+func (ls *LinkStore) Add(link Link) error {
+	ls.lockWrite()
+	key := linkKey{link.Namespace, link.Shortcut}
+	if existing, ok := ls.links[key]; ok {
+		link = replaceLink(existing, link)
+	} else if link.CreatedAt.IsZero() {
+		link.CreatedAt = time.Now().UTC()
+	}
+	ls.links[key] = link
+	return ls.unlockAndSave()
+}
+
+// AddMany adds several links at once, as Add does, saving them together
+func (ls *LinkStore) AddMany(links []Link) error {
+	ls.lockWrite()
+	now := time.Now().UTC()
+	for _, link := range links {
+		key := linkKey{link.Namespace, link.Shortcut}
+		if existing, ok := ls.links[key]; ok {
+			link = replaceLink(existing, link)
+		} else if link.CreatedAt.IsZero() {
+			link.CreatedAt = now
+		}
+		ls.links[key] = link
+	}
+	return ls.unlockAndSave()
+}
+
+// Update replaces an existing link, keeping its creation time and click
+// count. It returns false if there is no such link.
+func (ls *LinkStore) Update(link Link) (bool, error) {
+	ls.lockWrite()
+	key := linkKey{link.Namespace, link.Shortcut}
+	existing, ok := ls.links[key]
+	if !ok {
+		ls.unlockWrite()
+		return false, nil
+	}
+	ls.links[key] = replaceLink(existing, link)
+	return true, ls.unlockAndSave()
+}
+
+// replaceLink returns link as the new version of existing: it carries over
+// the creation time and click counts, and records existing in the history.
+// An archived link is restored.
+func replaceLink(existing, link Link) Link {
+	link.CreatedAt = existing.CreatedAt
+	link.CreatedBy = existing.CreatedBy
+	link.Clicks = existing.Clicks
+	link.DailyClicks = existing.DailyClicks
+	link.Referrers = existing.Referrers
+	link.Clients = existing.Clients
+	link.LastClickedAt = existing.LastClickedAt
 
-	// Write to file
-	return os.WriteFile(ls.filePath, data, 0644)
+	revision := Revision{
+		ReplacedAt:   time.Now().UTC(),
+		URL:          existing.URL,
+		Description:  existing.Description,
+		Owner:        existing.Owner,
+		Regions:      existing.Regions,
+		MobileURL:    existing.MobileURL,
+		Calendar:     existing.Calendar,
+		Fragment:     existing.Fragment,
+		CacheControl: existing.CacheControl,
+	}
+	link.UpdatedAt = revision.ReplacedAt
+	link.History = append(slices.Clone(existing.History), revision)
+	if len(link.History) > maxRevisions {
+		link.History = link.History[len(link.History)-maxRevisions:]
+	}
+	return link
 }
 
-// Add creates a new link
-func (ls *LinkStore) Add(shortcut, url string) error {
-	ls.links[shortcut] = url
-	return ls.Save()
+// Delete removes a link. It returns false if there is no such link.
+func (ls *LinkStore) Delete(namespace, shortcut string) (bool, error) {
+	ls.lockWrite()
+	key := linkKey{namespace, shortcut}
+	if _, ok := ls.links[key]; !ok {
+		ls.unlockWrite()
+		return false, nil
+	}
+	delete(ls.links, key)
+	ls.removedAt = time.Now().UTC()
+	return true, ls.unlockAndSave()
 }
 
-// Get retrieves a URL by shortcut
-func (ls *LinkStore) Get(shortcut string) (string, bool) {
-	url, exists := ls.links[shortcut]
-	return url, exists
+// UpdateMany applies change to each of the given links in a namespace,
+// recording the previous versions in their history. It returns how many
+// links were found and changed.
+func (ls *LinkStore) UpdateMany(namespace string, shortcuts []string, change func(Link) Link) (int, error) {
+	ls.lockWrite()
+	updated := 0
+	for _, shortcut := range shortcuts {
+		key := linkKey{namespace, shortcut}
+		if existing, ok := ls.links[key]; ok {
+			ls.links[key] = replaceLink(existing, change(existing))
+			updated++
+		}
+	}
+	if updated == 0 {
+		ls.unlockWrite()
+		return 0, nil
+	}
+	return updated, ls.unlockAndSave()
 }
 
-// GetAll returns all links
-func (ls *LinkStore) GetAll() map[string]string {
-	result := make(map[string]string)
-	for k, v := range ls.links {
-		result[k] = v
+// DeleteMany removes the given links from a namespace, returning how many
+// were found
+func (ls *LinkStore) DeleteMany(namespace string, shortcuts []string) (int, error) {
+	ls.lockWrite()
+	deleted := 0
+	for _, shortcut := range shortcuts {
+		key := linkKey{namespace, shortcut}
+		if _, ok := ls.links[key]; ok {
+			delete(ls.links, key)
+			deleted++
+		}
+	}
+	if deleted == 0 {
+		ls.unlockWrite()
+		return 0, nil
+	}
+	ls.removedAt = time.Now().UTC()
+	return deleted, ls.unlockAndSave()
+}
+
+// Move transfers the given links to another namespace. Links whose shortcut
+// is already taken there are left where they are and returned as conflicts.
+func (ls *LinkStore) Move(from string, shortcuts []string, to string) (int, []string, error) {
+	ls.lockWrite()
+	moved := 0
+	var conflicts []string
+	for _, shortcut := range shortcuts {
+		key := linkKey{from, shortcut}
+		link, ok := ls.links[key]
+		if !ok || from == to {
+			continue
+		}
+		target := linkKey{to, shortcut}
+		if _, taken := ls.links[target]; taken {
+			conflicts = append(conflicts, shortcut)
+			continue
+		}
+		delete(ls.links, key)
+		link.Namespace = to
+		link.UpdatedAt = time.Now().UTC()
+		ls.links[target] = link
+		moved++
+	}
+	if moved == 0 {
+		ls.unlockWrite()
+		return 0, conflicts, nil
+	}
+	ls.removedAt = time.Now().UTC()
+	return moved, conflicts, ls.unlockAndSave()
+}
+
+// StoreStats summarizes the link store for the admin console
+type StoreStats struct {
+	Backend    string
+	FilePath   string
+	Links      int
+	Namespaces int
+	SavedAt    time.Time
+	Unsaved    bool // clicks recorded but not yet written
+}
+
+// Stats returns a summary of the store
+func (ls *LinkStore) Stats() StoreStats {
+	ls.saving.Lock()
+	entries, savedAt := ls.entries(), ls.savedAt
+	ls.saving.Unlock()
+	namespaces := make(map[string]bool)
+	for key := range entries {
+		namespaces[key.namespace] = true
+	}
+	return StoreStats{
+		Backend:    "JSON file",
+		FilePath:   ls.filePath,
+		Links:      len(entries),
+		Namespaces: len(namespaces),
+		SavedAt:    savedAt,
+		Unsaved:    ls.dirty.Load(),
+	}
+}
+
+// Compact drops daily click counts older than clickHistoryDays and history
+// beyond maxRevisions, then rewrites the file. It returns how many links
+// were trimmed.
+func (ls *LinkStore) Compact() (int, error) {
+	ls.lockWrite()
+	oldest := time.Now().UTC().AddDate(0, 0, -clickHistoryDays+1).Format(time.DateOnly)
+	trimmed := 0
+	for key, link := range ls.links {
+		changed := false
+		if len(link.History) > maxRevisions {
+			link.History = link.History[len(link.History)-maxRevisions:]
+			changed = true
+		}
+		daily := make(map[string]int, len(link.DailyClicks))
+		for day, n := range link.DailyClicks {
+			if day >= oldest {
+				daily[day] = n
+			}
+		}
+		if len(daily) != len(link.DailyClicks) {
+			link.DailyClicks = daily
+			changed = true
+		}
+		if changed {
+			ls.links[key] = link
+			trimmed++
+		}
+	}
+	return trimmed, ls.unlockAndSave()
+}
+
+// Export writes every link, in all namespaces, as indented JSON in the
+// same format as the links file. Links are written as they're read, so a
+// large export needs little memory.
+func (ls *LinkStore) Export(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	sep := "[\n  "
+	for link := range ls.Ordered(nil) {
+		data, err := json.MarshalIndent(link, "  ", "  ")
+		if err != nil {
+			return err
+		}
+		bw.WriteString(sep)
+		bw.Write(data)
+		sep = ",\n  "
+	}
+	if sep == "[\n  " {
+		bw.WriteString("[]\n")
+	} else {
+		bw.WriteString("\n]\n")
+	}
+	return bw.Flush()
+}
+
+// RecordClick counts a redirect for a link, coming from source (if it may
+// be tracked, or else the zero clickSource). Counts are written to disk
+// with the next save, see Flush.
+func (ls *LinkStore) RecordClick(namespace, shortcut string, source clickSource) {
+	for {
+		entry, ok := ls.entries()[linkKey{namespace, shortcut}]
+		if !ok {
+			return
+		}
+		entry.mu.Lock()
+		if entry.retired {
+			// The link is being changed: wait for the change, then count
+			// the click on the new snapshot
+			entry.mu.Unlock()
+			ls.mu.Lock()
+			ls.mu.Unlock()
+			continue
+		}
+		link := &entry.link
+		link.Clicks++
+		link.LastClickedAt = time.Now().UTC()
+		link.ExpiryWarnedAt = time.Time{}
+		link.DailyClicks = countDailyClick(link.DailyClicks, time.Now().UTC())
+		if source != (clickSource{}) {
+			link.Referrers = countSource(link.Referrers, source.Referrer)
+			link.Clients = countSource(link.Clients, source.Client)
+		}
+		entry.mu.Unlock()
+		ls.dirty.Store(true)
+		return
+	}
+}
+
+// countDailyClick returns a copy of daily with a click counted for now's
+// day, dropping days older than clickHistoryDays. The map is copied because
+// links returned by Get share it.
+func countDailyClick(daily map[string]int, now time.Time) map[string]int {
+	oldest := now.AddDate(0, 0, -clickHistoryDays+1).Format(time.DateOnly)
+
+	counts := make(map[string]int, len(daily)+1)
+	for day, n := range daily {
+		if day >= oldest {
+			counts[day] = n
+		}
+	}
+	counts[now.Format(time.DateOnly)]++
+	return counts
+}
+
+// Flush saves the store if clicks have been recorded since the last save.
+// It runs in the background regularly, so redirects don't each rewrite the
+// file.
+func (ls *LinkStore) Flush() error {
+	if !ls.dirty.Load() {
+		return nil
+	}
+	ls.saving.Lock()
+	defer ls.saving.Unlock()
+	_, span := tracer.Start(context.Background(), "LinkStore.SaveClicks")
+	defer span.End()
+	if err := ls.save(); err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	return nil
+}
+
+// Get retrieves a link by namespace and shortcut. It takes no store-wide
+// lock and doesn't allocate, as it's called for every redirect.
+func (ls *LinkStore) Get(namespace, shortcut string) (Link, bool) {
+	entry, exists := ls.entries()[linkKey{namespace, shortcut}]
+	if !exists {
+		return Link{}, false
+	}
+	return entry.get(), true
+}
+
+// All returns every link, in any namespace
+func (ls *LinkStore) All() []Link {
+	entries := ls.entries()
+	links := make([]Link, 0, len(entries))
+	for _, entry := range entries {
+		links = append(links, entry.get())
+	}
+	return links
+}
+
+// Ordered returns the links in namespaces (or every namespace, if nil)
+// ordered by namespace and then shortcut, all from the same snapshot. Only
+// the link being yielded is copied, so it suits going through more links
+// than are worth copying at once.
+func (ls *LinkStore) Ordered(namespaces []string) iter.Seq[Link] {
+	return func(yield func(Link) bool) {
+		type keyed struct {
+			key   linkKey
+			entry *storedLink
+		}
+		var ordered []keyed
+		for key, entry := range ls.entries() {
+			if namespaces == nil || slices.Contains(namespaces, key.namespace) {
+				ordered = append(ordered, keyed{key, entry})
+			}
+		}
+		slices.SortFunc(ordered, func(a, b keyed) int {
+			return cmp.Or(cmp.Compare(a.key.namespace, b.key.namespace), cmp.Compare(a.key.shortcut, b.key.shortcut))
+		})
+		for _, k := range ordered {
+			if !yield(k.entry.get()) {
+				return
+			}
+		}
+	}
+}
+
+// Mark applies change to a link without recording a new version in its
+// history, for bookkeeping such as archiving. It returns the link as it
+// was, and false if there is no such link.
+func (ls *LinkStore) Mark(namespace, shortcut string, change func(Link) Link) (Link, bool, error) {
+	ls.lockWrite()
+	key := linkKey{namespace, shortcut}
+	existing, ok := ls.links[key]
+	if !ok {
+		ls.unlockWrite()
+		return Link{}, false, nil
+	}
+	link := change(existing)
+	link.UpdatedAt = time.Now().UTC()
+	ls.links[key] = link
+	return existing, true, ls.unlockAndSave()
+}
+
+// GetAll returns all links in a namespace, keyed by shortcut
+func (ls *LinkStore) GetAll(namespace string) map[string]Link {
+	result := make(map[string]Link)
+	for k, entry := range ls.entries() {
+		if k.namespace == namespace {
+			result[k.shortcut] = entry.get()
+		}
 	}
 	return result
 }
 
+// Changes returns the links in namespace added or changed since t. If
+// links may have been removed since then, it returns every link and true,
+// so a copy kept elsewhere can be replaced rather than brought up to date.
+func (ls *LinkStore) Changes(namespace string, since time.Time) ([]Link, bool) {
+	// Changes publish their snapshot and removedAt together, under ls.mu
+	ls.mu.Lock()
+	entries, removedAt := ls.entries(), ls.removedAt
+	ls.mu.Unlock()
+	full := since.IsZero() || !removedAt.Before(since)
+	var links []Link
+	for key, entry := range entries {
+		if key.namespace != namespace {
+			continue
+		}
+		link := entry.get()
+		changed := link.CreatedAt.After(since) || link.UpdatedAt.After(since)
+		if full || changed {
+			links = append(links, link)
+		}
+	}
+	return links, full
+}
+
+// CountCreatedBy returns how many links user has created, in any namespace
+func (ls *LinkStore) CountCreatedBy(user string) int {
+	count := 0
+	for _, entry := range ls.entries() {
+		if strings.EqualFold(entry.get().CreatedBy, user) {
+			count++
+		}
+	}
+	return count
+}
+
 // handleHome handles the homepage and redirect requests
 func (s *Server) handleHome(w http.ResponseWriter, r *http.Request) {
 	path := strings.TrimPrefix(r.URL.Path, "/")
@@ -115,13 +929,215 @@ func (s *Server) handleHome(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Try to redirect to the URL for this shortcut
-	if url, exists := s.store.Get(path); exists {
-		http.Redirect(w, r, url, http.StatusFound)
+	namespace := s.hosts.Namespace(r)
+	span := startSpan(r, "LinkStore.Get", linkAttrs(namespace, path)...)
+	link, rest, exists := s.lookup(namespace, path)
+	span.End()
+	if (!exists || link.Shortcut != path) && s.store.loaded() != nil {
+		// The shortcut, or a longer one matching more of the path, may not
+		// have loaded yet
+		if !s.waitForLinks(r) {
+			return
+		}
+		link, rest, exists = s.lookup(namespace, path)
+	}
+	if exists {
+		if s.blocklist.Blocked(link.Shortcut) {
+			w.Header().Set("Cache-Control", "no-store")
+			s.showError(w, r, http.StatusGone, "This shortcut has been disabled")
+			return
+		}
+
+		if !link.ArchivedAt.IsZero() {
+			w.Header().Set("Cache-Control", "no-store")
+			s.showError(w, r, http.StatusGone, "This link was archived because nobody had used it for a while. Ask its owner or an admin to restore it.")
+			return
+		}
+
+		if !s.mayFollow(r, link) {
+			w.Header().Set("Cache-Control", "no-store")
+			s.showError(w, r, http.StatusForbidden, "This link is only available to some groups. Sign in, or ask its owner for access.")
+			return
+		}
+
+		// Chat apps previewing a pasted link get a card describing it
+		// rather than the redirect, and aren't counted as clicks
+		if isLinkPreview(r) {
+			s.showPreview(w, r, link, expandDestination(s.destinationFor(link, r), link.Fragment, rest))
+			return
+		}
+
+		// Read-only servers leave the links file as it is, click counts
+		// too, as do servers in maintenance
+		if !s.changesRefused() && !isPrefetch(r) {
+			span := startSpan(r, "LinkStore.RecordClick", linkAttrs(link.Namespace, link.Shortcut)...)
+			var source clickSource
+			if s.privacy.Tracks(r) {
+				source = newClickSource(r)
+			}
+			s.store.RecordClick(link.Namespace, link.Shortcut, source)
+			span.End()
+		}
+		destination := expandDestination(s.destinationFor(link, r), link.Fragment, rest)
+		if !isPrefetch(r) {
+			s.publishClick(r, link, destination)
+		}
+		s.setRedirectCaching(w, link)
+		if isPrefetch(r) {
+			// Make the browser come back when the link is actually followed,
+			// so that visit is counted
+			w.Header().Set("Cache-Control", "no-store")
+		}
+		http.Redirect(w, r, destination, http.StatusFound)
 		return
 	}
 
-	// Shortcut not found, redirect to homepage
-	http.Redirect(w, r, "/", http.StatusFound)
+	// Hand unknown shortcuts to the legacy shortener while migrating
+	if s.fallback != nil {
+		s.fallback.ServeHTTP(w, r)
+		return
+	}
+
+	// Shortcut not found, count it for the missing-link report and suggest
+	// similar ones
+	w.Header().Set("Cache-Control", "no-store")
+	s.recordMiss(r, namespace, path)
+	s.showNotFound(w, r, namespace, path)
+}
+
+// showNotFound renders the page for an unknown shortcut, listing similar
+// shortcuts and offering to create it
+func (s *Server) showNotFound(w http.ResponseWriter, r *http.Request, namespace, shortcut string) {
+	index, visible := s.searchFor(r, namespace)
+	data := struct {
+		Prefix      string
+		Theme       *Theme
+		Maintenance *maintenanceState
+		CSRFToken   string
+		Lang        *translator
+		Shortcut    string
+		Suggestions []suggestion
+	}{
+		Prefix:      s.hosts.Prefix(r),
+		Theme:       s.theme.Load(),
+		Maintenance: s.maintenance.State(),
+		CSRFToken:   s.csrfToken(w, r),
+		Lang:        translatorFor(w, r),
+		Shortcut:    shortcut,
+		Suggestions: index.suggest(shortcut, 10, visible),
+	}
+
+	writePage(w, http.StatusNotFound, "notfound.html", data, "Shortcut not found")
+}
+
+// showError renders the error page with a message for the visitor, which
+// is translated into their language
+func (s *Server) showError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	lang := translatorFor(w, r)
+	data := struct {
+		Prefix      string
+		Theme       *Theme
+		Maintenance *maintenanceState
+		CSRFToken   string
+		Lang        *translator
+		Status      int
+		Title       string
+		Message     string
+	}{
+		Prefix:      s.hosts.Prefix(r),
+		Theme:       s.theme.Load(),
+		Maintenance: s.maintenance.State(),
+		CSRFToken:   s.csrfToken(w, r),
+		Lang:        lang,
+		Status:      status,
+		Title:       lang.T(http.StatusText(status)),
+		Message:     lang.T(message),
+	}
+
+	writePage(w, status, "error.html", data, data.Message)
+}
+
+// lookup finds the link for a request path, trying the longest matching
+// shortcut first so "gh/foo" matches "gh" with "foo" left over
+func (s *Server) lookup(namespace, path string) (Link, string, bool) {
+	shortcut, rest := path, ""
+	for {
+		if link, exists := s.store.Get(namespace, shortcut); exists {
+			return link, rest, true
+		}
+
+		i := strings.LastIndex(shortcut, "/")
+		if i < 0 {
+			return Link{}, "", false
+		}
+		shortcut, rest = shortcut[:i], strings.TrimPrefix(path[i+1:], "/")
+	}
+}
+
+// setRedirectCaching sets the Cache-Control header for a redirect, plus Vary
+// for any request headers that can change where the link goes
+func (s *Server) setRedirectCaching(w http.ResponseWriter, link Link) {
+	cacheControl := s.cacheControl
+	if link.CacheControl != "" {
+		cacheControl = link.CacheControl
+	}
+	if len(link.VisibleTo) > 0 {
+		// Shared caches mustn't hand restricted links to anyone else
+		cacheControl = "private, no-store"
+	}
+	if link.Calendar != "" {
+		// Where the link goes changes as meetings come and go
+		cacheControl = "no-store"
+	}
+	if cacheControl != "" {
+		w.Header().Set("Cache-Control", cacheControl)
+	}
+
+	if link.MobileURL != "" {
+		w.Header().Add("Vary", "User-Agent")
+	}
+	if len(link.Regions) > 0 && s.regions.header != "" {
+		w.Header().Add("Vary", s.regions.header)
+	}
+}
+
+// isPrefetch reports whether a request is a browser prefetching or
+// prerendering a link, or asking only for its headers, rather than someone
+// following it. These are redirected as usual but not counted, so a link
+// isn't counted twice when the visitor then follows it.
+func isPrefetch(r *http.Request) bool {
+	if r.Method == http.MethodHead {
+		return true
+	}
+	for _, header := range []string{"Sec-Purpose", "Purpose", "X-Purpose", "X-Moz"} {
+		value := strings.ToLower(r.Header.Get(header))
+		if strings.Contains(value, "prefetch") || strings.Contains(value, "prerender") || value == "preview" {
+			return true
+		}
+	}
+	return false
+}
+
+// destinationFor picks the URL a request should be sent to for link: the
+// video call of its calendar's next matching event, then the mobile
+// destination for mobile devices, then any regional override, falling back
+// to the default URL
+func (s *Server) destinationFor(link Link, r *http.Request) string {
+	if link.Calendar != "" {
+		if url := s.calendars.Destination(link.Calendar, time.Now()); url != "" {
+			return url
+		}
+	}
+	if link.MobileURL != "" && isMobileUserAgent(r.UserAgent()) {
+		return link.MobileURL
+	}
+
+	for _, region := range s.regions.Regions(r) {
+		if url, ok := link.Regions[region]; ok {
+			return url
+		}
+	}
+	return link.URL
 }
 
 // handleAdd handles form submissions to add new links
@@ -138,197 +1154,538 @@ func (s *Server) handleAdd(w http.ResponseWriter, r *http.Request) {
 	}
 
 	shortcut := strings.TrimSpace(r.FormValue("shortcut"))
-	url := strings.TrimSpace(r.FormValue("url"))
 
-	// Basic validation
-	if shortcut == "" || url == "" {
-		http.Error(w, "Shortcut and URL are required", http.StatusBadRequest)
+	// Basic validation, shown next to the field so the form can be fixed
+	// without retyping it
+	var link Link
+	var err error
+	switch {
+	case shortcut == "":
+		err = &formError{"shortcut", "Shortcut is required"}
+	case s.blocklist.Blocked(shortcut):
+		err = &formError{"shortcut", fmt.Sprintf("Shortcut %q is not allowed, please choose another", shortcut)}
+	default:
+		link, err = s.linkFromForm(r, shortcut)
+	}
+
+	var fe *formError
+	if errors.As(err, &fe) {
+		s.renderHomepage(w, r, http.StatusBadRequest, r.PostForm, map[string]string{fe.field: fe.message})
+		return
+	}
+
+	// Saving over an existing link changes it, which editors may only do
+	// to their own links, and ACL spaces belong to their teams
+	existing, exists := s.store.Get(link.Namespace, shortcut)
+	if (exists && !s.mayChange(r, existing)) || !s.mayAdd(r, link.Namespace, shortcut) {
+		s.renderHomepage(w, r, http.StatusForbidden, r.PostForm,
+			map[string]string{"shortcut": "That shortcut belongs to someone else, please choose another"})
 		return
 	}
 
-	// Add http:// if no protocol specified
-	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
-		url = "http://" + url
+	// Only new links count against quotas
+	if !exists && !s.withinQuota(w, r) {
+		return
 	}
 
 	// Save the new link
-	if err := s.store.Add(shortcut, url); err != nil {
-		http.Error(w, "Failed to save link", http.StatusInternalServerError)
+	link.CreatedBy = s.currentUser(r)
+	span := startSpan(r, "LinkStore.Add", linkAttrs(link.Namespace, shortcut)...)
+	err = s.store.Add(link)
+	span.End()
+	if err != nil {
+		logFor(r).Error("Saving link", "shortcut", shortcut, "error", err)
+		s.showError(w, r, http.StatusInternalServerError, "The link couldn't be saved. Please try again later.")
 		return
 	}
+	saved, _ := s.store.Get(link.Namespace, shortcut)
+	s.audit(r, auditLink(existing, exists), auditLink(saved, true))
 
-	// Redirect back to homepage
-	http.Redirect(w, r, "/", http.StatusSeeOther)
+	// Redirect back to homepage, confirming what was saved
+	http.Redirect(w, r, "/?added="+url.QueryEscape(shortcut), http.StatusSeeOther)
 }
 
-// showHomepage renders the HTML homepage
-func (s *Server) showHomepage(w http.ResponseWriter, r *http.Request) {
-	const htmlTemplate = `<!DOCTYPE html>
-<html lang="en">
-<head>
-    <meta charset="UTF-8">
-    <meta name="viewport" content="width=device-width, initial-scale=1.0">
-    <title>Go Links</title>
-    <style>
-        body {
-            font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif;
-            max-width: 800px;
-            margin: 0 auto;
-            padding: 2rem;
-            background-color: #f8f9fa;
-        }
-        .container {
-            background: white;
-            padding: 2rem;
-            border-radius: 8px;
-            box-shadow: 0 2px 10px rgba(0,0,0,0.1);
-        }
-        h1 {
-            color: #333;
-            text-align: center;
-            margin-bottom: 2rem;
-        }
-        .form-group {
-            margin-bottom: 1rem;
-        }
-        label {
-            display: block;
-            margin-bottom: 0.5rem;
-            font-weight: 500;
-            color: #555;
-        }
-        input[type="text"], input[type="url"] {
-            width: 100%;
-            padding: 0.75rem;
-            border: 1px solid #ddd;
-            border-radius: 4px;
-            font-size: 1rem;
-            box-sizing: border-box;
-        }
-        button {
-            background-color: #007bff;
-            color: white;
-            padding: 0.75rem 2rem;
-            border: none;
-            border-radius: 4px;
-            font-size: 1rem;
-            cursor: pointer;
-            transition: background-color 0.2s;
-        }
-        button:hover {
-            background-color: #0056b3;
-        }
-        .links-section {
-            margin-top: 3rem;
-        }
-        .links-list {
-            background: #f8f9fa;
-            border-radius: 4px;
-            padding: 1rem;
-        }
-        .link-item {
-            display: flex;
-            justify-content: space-between;
-            align-items: center;
-            padding: 0.75rem;
-            margin: 0.5rem 0;
-            background: white;
-            border-radius: 4px;
-            border: 1px solid #e9ecef;
-        }
-        .shortcut {
-            font-weight: 600;
-            color: #007bff;
-            font-family: monospace;
-        }
-        .url {
-            color: #666;
-            word-break: break-all;
-        }
-        .empty-state {
-            text-align: center;
-            color: #666;
-            font-style: italic;
-            padding: 2rem;
-        }
-    </style>
-</head>
-<body>
-    <div class="container">
-        <h1>🔗 Go Links</h1>
-        
-        <form action="/add" method="post">
-            <div class="form-group">
-                <label for="shortcut">Shortcut:</label>
-                <input type="text" id="shortcut" name="shortcut" placeholder="e.g., gh" required>
-            </div>
-            <div class="form-group">
-                <label for="url">URL:</label>
-                <input type="url" id="url" name="url" placeholder="e.g., https://github.com" required>
-            </div>
-            <button type="submit">Add Link</button>
-        </form>
-
-        <div class="links-section">
-            <h2>Your Links</h2>
-            <div class="links-list">
-                {{if .Links}}
-                    {{range $shortcut, $url := .Links}}
-                    <div class="link-item">
-                        <span class="shortcut">go/{{$shortcut}}</span>
-                        <span class="url">→ {{$url}}</span>
-                    </div>
-                    {{end}}
-                {{else}}
-                    <div class="empty-state">
-                        No links yet. Add your first one above!
-                    </div>
-                {{end}}
-            </div>
-        </div>
-    </div>
-</body>
-</html>`
-
-	tmpl, err := template.New("homepage").Parse(htmlTemplate)
+// formError is a problem with one field of a form, such as the add or
+// edit form
+type formError struct {
+	field   string // form field name, e.g. "url"
+	message string
+}
+
+func (e *formError) Error() string {
+	return e.message
+}
+
+// linkFromForm builds a link for shortcut from the add or edit form fields,
+// validating and normalizing its destinations
+func (s *Server) linkFromForm(r *http.Request, shortcut string) (Link, error) {
+	return s.linkFromFields(r.FormValue, s.hosts.Namespace(r), shortcut)
+}
+
+// linkFromFields builds a link for shortcut in namespace from fields named
+// like those of the add form, such as from a form or an imported row
+func (s *Server) linkFromFields(field func(string) string, namespace, shortcut string) (Link, error) {
+	url := strings.TrimSpace(field("url"))
+	if url == "" {
+		return Link{}, &formError{"url", "URL is required"}
+	}
+
+	url, err := s.urls.Load().Normalize(url)
 	if err != nil {
-		http.Error(w, "Template error", http.StatusInternalServerError)
-		return
+		return Link{}, &formError{"url", err.Error()}
+	}
+
+	regions, err := parseRegions(field("regions"), s.urls.Load().Normalize)
+	if err != nil {
+		return Link{}, &formError{"regions", err.Error()}
+	}
+
+	link := Link{
+		Shortcut:     shortcut,
+		URL:          url,
+		Description:  strings.TrimSpace(field("description")),
+		Owner:        strings.TrimSpace(field("owner")),
+		Tags:         parseTags(field("tags")),
+		Namespace:    namespace,
+		Regions:      regions,
+		Fragment:     strings.TrimPrefix(strings.TrimSpace(field("fragment")), "#"),
+		CacheControl: strings.TrimSpace(field("cache_control")),
+		Hidden:       field("hidden") != "",
+		VisibleTo:    splitList(field("visible_to")),
+	}
+	if mobileURL := strings.TrimSpace(field("mobile_url")); mobileURL != "" {
+		if link.MobileURL, err = s.urls.Load().Normalize(mobileURL); err != nil {
+			return Link{}, &formError{"mobile_url", "Mobile URL: " + err.Error()}
+		}
+	}
+	if calendar := strings.TrimSpace(field("calendar")); calendar != "" {
+		if s.calendars == nil {
+			return Link{}, &formError{"calendar", "Calendar: no calendars are configured"}
+		}
+		if _, _, err := s.calendars.parseEvent(calendar); err != nil {
+			return Link{}, &formError{"calendar", "Calendar: " + err.Error()}
+		}
+		link.Calendar = calendar
+	}
+
+	return link, nil
+}
+
+// showHomepage renders the HTML homepage, prefilling the add form's
+// shortcut from ?shortcut= (e.g. from the not-found page)
+func (s *Server) showHomepage(w http.ResponseWriter, r *http.Request) {
+	form := url.Values{"shortcut": {r.URL.Query().Get("shortcut")}}
+	s.renderHomepage(w, r, http.StatusOK, form, nil)
+}
+
+// renderHomepage renders the homepage with the add form filled in from form
+// and any validation errors, keyed by field name, shown beside their fields
+func (s *Server) renderHomepage(w http.ResponseWriter, r *http.Request, status int, form url.Values, fieldErrors map[string]string) {
+	view := s.homeView(r)
+	listing := newLinkListing(s.visibleIn(r, view.byName), r.URL.Query())
+	disabled := make(map[string]bool)
+	for _, link := range listing.Links {
+		if s.blocklist.Blocked(link.Shortcut) {
+			disabled[link.Shortcut] = true
+		}
+	}
+	// Show the signed-in user's stars
+	user := s.currentUser(r)
+	stars := map[string]bool{}
+	if user != "" {
+		stars = s.stars.Starred(user, s.hosts.Namespace(r))
+	}
+
+	mostUsed, recent := s.discover(r, view, 5)
+
+	// Confirm a link that was just added
+	var added *Link
+	if shortcut := r.URL.Query().Get("added"); shortcut != "" {
+		if link, exists := s.store.Get(s.hosts.Namespace(r), shortcut); exists {
+			added = &link
+		}
 	}
 
 	data := struct {
-		Links map[string]string
+		Prefix      string
+		Theme       *Theme
+		Maintenance *maintenanceState
+		CSRFToken   string
+		Lang        *translator
+		Added       *Link
+		Form        url.Values
+		Errors      map[string]string
+		User        string
+		SignInURL   string
+		Stars       map[string]bool
+		MostUsed    []popularLink
+		Recent      []Link
+		Listing     *linkListing
+		Disabled    map[string]bool
+		ReadOnly    bool
+		Propose     bool
+		Calendars   bool // whether links can follow a calendar
 	}{
-		Links: s.store.GetAll(),
+		Prefix:      s.hosts.Prefix(r),
+		Theme:       s.theme.Load(),
+		Maintenance: s.maintenance.State(),
+		CSRFToken:   s.csrfToken(w, r),
+		Lang:        translatorFor(w, r),
+		Added:       added,
+		Form:        form,
+		Errors:      fieldErrors,
+		User:        user,
+		SignInURL:   s.signInURL(),
+		Stars:       stars,
+		MostUsed:    mostUsed,
+		Recent:      recent,
+		Listing:     listing,
+		Disabled:    disabled,
+		ReadOnly:    s.changesRefused(),
+		Propose:     !s.mayEdit(r),
+		Calendars:   s.calendars != nil,
 	}
 
 	w.Header().Set("Content-Type", "text/html")
-	if err := tmpl.Execute(w, data); err != nil {
+	w.WriteHeader(status)
+	if err := templates.ExecuteTemplate(w, "home.html", data); err != nil {
 		http.Error(w, "Template execution error", http.StatusInternalServerError)
 		return
 	}
 }
 
 func main() {
-	// Initialize the link store
-	store := &LinkStore{
-		links:    make(map[string]string),
-		filePath: "/app/data/links.json",
+	// Read settings from a configuration file and flags as well as the
+	// environment, remembering the environment as it was for reloads
+	initialSettings := currentSettings()
+	cmd, err := loadConfig(os.Args[1:], os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	} else if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
 	}
 
-	// Load existing links from file
-	if err := store.Load(); err != nil {
-		log.Printf("Warning: Could not load links file: %v", err)
+	// Log as text or JSON, to stderr or a rotated file, keeping recent
+	// output for the admin console
+	logs := newLogTail(200)
+	logger, err := NewLogger(LogConfig{
+		Format:   os.Getenv("GOLINKS_LOG_FORMAT"),
+		Level:    os.Getenv("GOLINKS_LOG_LEVEL"),
+		File:     os.Getenv("GOLINKS_LOG_FILE"),
+		MaxSize:  os.Getenv("GOLINKS_LOG_MAX_SIZE"),
+		MaxFiles: os.Getenv("GOLINKS_LOG_MAX_FILES"),
+	}, logs)
+	if err != nil {
+		log.Fatalf("Invalid log configuration: %v", err)
 	}
+	useLogger(logger)
+
+	// Send traces to an OpenTelemetry collector when one is configured
+	tracing, err := NewTracing(context.Background())
+	if err != nil {
+		log.Fatalf("Invalid tracing configuration: %v", err)
+	}
+
+	// Log every request unless turned off
+	var accessLog *slog.Logger
+	if os.Getenv("GOLINKS_ACCESS_LOG") != "false" {
+		accessLog = logger
+	}
+
+	// Initialize the link store, keeping other data files alongside it
+	dataPath := cmp.Or(os.Getenv("GOLINKS_DATA"), "/app/data/links.json")
 
-	// Initialize the server
-	server := &Server{store: store}
+	// Back up, restore or migrate the data, or check everything is in
+	// order before a rollout, instead of serving, with -backup, -restore,
+	// -migrate or -check
+	switch {
+	case cmd.backup != "":
+		path, err := backupTo(dataPath, cmd.backup)
+		if err != nil {
+			log.Fatalf("Backup failed: %v", err)
+		}
+		log.Printf("Backed up %s to %s", filepath.Dir(dataPath), path)
+		return
+	case cmd.restore != "":
+		restored, err := restoreFrom(dataPath, cmd.restore)
+		if err != nil {
+			log.Fatalf("Restore failed: %v", err)
+		}
+		log.Printf("Restored %d links from %s", restored, cmd.restore)
+		return
+	case cmd.migrate != "":
+		report, err := migrateData(dataPath, auditLogPath(dataPath), cmd.migrate)
+		if err != nil {
+			log.Fatalf("Migration failed: %v; run it again to carry on", err)
+		}
+		log.Printf("Migrated %d links with %d clicks to %s: %d files copied, %d unchanged, %d new audit entries",
+			report.Links, report.Clicks, cmd.migrate, report.Copied, report.Unchanged, report.AuditEntries)
+		return
+	case cmd.check:
+		if !runChecks(os.Stdout, dataPath) {
+			os.Exit(1)
+		}
+		return
+	}
+	// Set up everything the server needs from the environment, the same
+	// way -check does, stopping at the first thing that's wrong
+	c := buildComponents(dataPath, false, func(step, _ string, err error, warning bool) {
+		switch {
+		case err == nil:
+		case warning:
+			log.Printf("Warning: %s: %v", step, err)
+		default:
+			log.Fatalf("Invalid %s configuration: %v", step, err)
+		}
+	})
+	server, jobs := c.server, c.server.jobs
+	server.logs, server.accessLog = logs, accessLog
+	if server.maintenance.Active() {
+		log.Printf("In maintenance: links can't be changed until an admin ends it")
+	}
+	server.applyLiveSettings(c.live)
+	go server.reloadOnSIGHUP(os.Args[1:], initialSettings)
 
 	// Set up routes
-	http.HandleFunc("/", server.handleHome)
-	http.HandleFunc("/add", server.handleAdd)
+	debug := newDebugHandler(server.startedAt)
+	server.routes(http.DefaultServeMux, debug)
+
+	// Start the server, checking CSRF tokens on every state-changing request
+	// (and refusing them in read-only mode) and renewing sessions in use
+	if server.readOnly {
+		log.Printf("Read-only mode: links can't be changed")
+	} else {
+		if server.expiry != nil {
+			jobs.Add(server.expiry.Job(server, time.Hour))
+		}
+		jobs.Add(server.privacy.PurgeJob(server, 24*time.Hour))
+		if server.digest != nil {
+			jobs.Add(server.digest.Job(server))
+		}
+	}
+	if c.wiki != nil {
+		jobs.Add(c.wiki.Job(server))
+	}
+	jobs.Add(server.memory.Job(server))
+	// With WatchdogSec= set, tell systemd twice an interval that the server
+	// is alive, so one that hangs is restarted
+	if every := watchdogInterval(); every > 0 {
+		jobs.Add(Job{Name: "systemd_watchdog", Every: every / 2, Run: server.pingWatchdog})
+	}
+	jobs.Start()
+	handler := server.limitRate(server.csrfProtect(server.rejectWrites(server.holdUntilLoaded(http.DefaultServeMux, http.DefaultServeMux))))
+	if server.sessions != nil {
+		handler = server.sessions.Renew(handler)
+	}
+	// Compress pages, API responses and exports for clients that accept gzip
+	if os.Getenv("GOLINKS_COMPRESSION") != "false" {
+		handler = compress(handler)
+	}
+	handler = server.logRequests(server.limitConcurrency(handler))
+	if tracing != nil {
+		handler = server.traceRequests(http.DefaultServeMux, handler)
+	}
+	handler = server.forwarded(handler)
+
+	// Listen on TCP, over IPv4 and IPv6 unless limited to one, or on a Unix
+	// socket for addresses like unix:/run/go-links.sock, with its
+	// permissions and group
+	listenConfig := ListenConfig{
+		ReusePort:   os.Getenv("GOLINKS_REUSE_PORT") == "true",
+		IPVersion:   os.Getenv("GOLINKS_IP_VERSION"),
+		SocketMode:  os.Getenv("GOLINKS_SOCKET_MODE"),
+		SocketGroup: os.Getenv("GOLINKS_SOCKET_GROUP"),
+	}
+	listener, err := listen(c.addr, listenConfig, false)
+	if err != nil {
+		log.Fatalf("Could not listen: %v", err)
+	}
+	log.Printf("Listening on %s", describeListener(listener, listenConfig.IPVersion))
+
+	// Optionally serve the admin console, metrics, profiles and the API
+	// only on a separate address, such as one on the internal network,
+	// leaving redirects and browsing on the public one
+	var adminSrv *http.Server
+	if adminAddr := os.Getenv("GOLINKS_ADMIN_ADDR"); adminAddr != "" {
+		if adminSrv, err = NewHTTPServer(handler, c.limits); err != nil {
+			log.Fatalf("Invalid server limits: %v", err)
+		}
+		adminListener, err := listen(adminAddr, ListenConfig{IPVersion: listenConfig.IPVersion, SocketMode: listenConfig.SocketMode, SocketGroup: listenConfig.SocketGroup}, true)
+		if err != nil {
+			log.Fatalf("Could not listen for management: %v", err)
+		}
+		handler = hideManagement(handler, os.Getenv("GOLINKS_PUBLIC_API") == "true")
+		go func() {
+			log.Printf("Management endpoints listening on %s", describeListener(adminListener, listenConfig.IPVersion))
+			if err := adminSrv.Serve(adminListener); !errors.Is(err, http.ErrServerClosed) {
+				log.Printf("Warning: Management listener stopped: %v", err)
+			}
+		}()
+	}
 
-	// Start the server
-	fmt.Println("Go Links server starting on http://localhost:3001")
-	log.Fatal(http.ListenAndServe(":3001", nil))
+	// Optionally serve profiles and runtime stats on a separate address,
+	// without admin sign-in, so keep it private (such as localhost:6060)
+	var debugSrv *http.Server
+	if debugAddr := os.Getenv("GOLINKS_DEBUG_ADDR"); debugAddr != "" {
+		if debugSrv, err = NewHTTPServer(debug, c.limits); err != nil {
+			log.Fatalf("Invalid server limits: %v", err)
+		}
+		// Profiles and traces are written for as long as they're asked for
+		debugSrv.Addr, debugSrv.WriteTimeout = debugAddr, 0
+		go func() {
+			log.Printf("Debug endpoints listening on %s", debugAddr)
+			if err := debugSrv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				log.Printf("Warning: Debug listener stopped: %v", err)
+			}
+		}()
+	}
+	srv, err := NewHTTPServer(handler, c.limits)
+	if err != nil {
+		log.Fatalf("Invalid server limits: %v", err)
+	}
+	scheme := "http"
+	if c.serverTLS != nil {
+		srv.TLSConfig = c.serverTLS.Config(server.clientCerts)
+		scheme = "https"
+
+		// Optionally redirect plain HTTP to HTTPS, by default on port 80
+		// with automatic certificates
+		redirectAddr, ok := os.LookupEnv("GOLINKS_HTTP_REDIRECT_ADDR")
+		if !ok && c.serverTLS.Automatic() {
+			redirectAddr = ":80"
+		}
+		if redirectAddr != "" {
+			_, httpsPort, _ := net.SplitHostPort(listener.Addr().String())
+			go func() {
+				log.Printf("Redirecting HTTP on %s to HTTPS", redirectAddr)
+				log.Printf("Warning: HTTP redirect listener stopped: %v", http.ListenAndServe(redirectAddr, c.serverTLS.RedirectHandler(httpsPort)))
+			}()
+		}
+	}
+	where := scheme + "://" + displayAddr(listener.Addr().String())
+	if listener.Addr().Network() == "unix" {
+		where = "unix:" + listener.Addr().String()
+	}
+	fmt.Printf("Go Links server starting on %s\n", where)
+	// Under systemd with Type=notify, say we're ready to serve
+	notifySystemd("READY=1\nSTATUS=Serving on " + listener.Addr().String())
+	err = serve(srv, listener, c.shutdownTimeout, func() {
+		// Let management requests and background jobs in progress finish
+		// before saving what's left
+		ctx, cancel := context.WithTimeout(context.Background(), c.shutdownTimeout)
+		defer cancel()
+		if adminSrv != nil {
+			if err := adminSrv.Shutdown(ctx); err != nil {
+				log.Printf("Warning: Management requests still in flight were cut off: %v", err)
+			}
+		}
+		if debugSrv != nil {
+			if err := debugSrv.Shutdown(ctx); err != nil {
+				log.Printf("Warning: Debug requests still in flight were cut off: %v", err)
+			}
+		}
+		if err := jobs.Stop(ctx); err != nil {
+			log.Printf("Warning: Background jobs still running were cut off: %v", err)
+		}
+		if server.leadership != nil {
+			if err := server.leadership.Resign(); err != nil {
+				log.Printf("Warning: Could not give up leadership: %v", err)
+			}
+		}
+		server.flush()
+		if tracing != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			tracing.Shutdown(ctx)
+		}
+	})
+	if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		log.Fatal(err)
+	}
+	log.Printf("Stopped")
+}
+
+// routes registers the server's handlers on mux, with the profiles and
+// runtime stats of debug under /admin/debug/
+func (s *Server) routes(mux *http.ServeMux, debug http.Handler) {
+	mux.HandleFunc("/", s.handleHome)
+	mux.HandleFunc("/add", s.requireEditor(s.handleAdd))
+	mux.HandleFunc("GET /new", s.handleNew)
+	mux.HandleFunc("GET /propose", s.handleProposeForm)
+	mux.HandleFunc("POST /propose", s.handlePropose)
+	mux.HandleFunc("GET /opensearch.xml", s.handleOpenSearch)
+	mux.HandleFunc("GET /sitemap.xml", s.handleSitemap)
+	mux.HandleFunc("GET /feed.xml", s.handleFeed)
+	mux.HandleFunc("GET /search", s.handleSearchRedirect)
+	mux.HandleFunc("GET /search/suggest", s.handleSearchSuggest)
+	mux.HandleFunc("/api/search", s.handleSearch)
+	mux.HandleFunc("/api/suggest", s.handleSuggest)
+	mux.HandleFunc("GET /api/unused", s.handleUnused)
+	mux.HandleFunc("GET /api/sync", s.handleSync)
+	mux.HandleFunc("GET /api/links", s.handleListLinks)
+	mux.HandleFunc("POST /api/links", s.requireEditor(s.handleQuickAdd))
+	mux.HandleFunc("POST /api/links/bulk", s.requireEditor(s.handleBulk))
+	mux.HandleFunc("GET /api/export", s.requireAdmin(s.handleExport))
+	mux.HandleFunc("POST /api/import", s.requireAdmin(s.handleImport))
+	mux.HandleFunc("POST /api/apply", s.requireAdmin(s.handleApply))
+	mux.HandleFunc("PUT /api/links/{shortcut...}", s.requireLinkChanger(s.handleUpdate))
+	mux.HandleFunc("DELETE /api/links/{shortcut...}", s.requireLinkChanger(s.handleDelete))
+	mux.HandleFunc("GET /api/qr/{shortcut...}", s.handleQR)
+	mux.HandleFunc("GET /links/{shortcut...}", s.handleDetail)
+	mux.HandleFunc("POST /api/stars/{shortcut...}", s.handleStar)
+	mux.HandleFunc("GET /my", s.handleMyLinks)
+	mux.HandleFunc("GET /tokens", s.handleTokens)
+	mux.HandleFunc("POST /tokens", s.handleTokenForm)
+	mux.HandleFunc("POST /tokens/{id}/revoke", s.handleTokenRevokeForm)
+	mux.HandleFunc("GET /api/tokens", s.handleListTokens)
+	mux.HandleFunc("POST /api/tokens", s.handleCreateToken)
+	mux.HandleFunc("DELETE /api/tokens/{id}", s.handleRevokeToken)
+	mux.HandleFunc("GET /admin", s.requireAdmin(s.handleAdmin))
+	mux.HandleFunc("POST /admin/reload", s.requireAdmin(s.handleAdminReload))
+	mux.HandleFunc("POST /admin/compact", s.requireAdmin(s.handleAdminCompact))
+	mux.HandleFunc("POST /admin/maintenance", s.requireAdmin(s.handleAdminMaintenance))
+	mux.HandleFunc("GET /admin/backup", s.requireAdmin(s.handleAdminBackup))
+	mux.HandleFunc("POST /admin/restore", s.requireAdmin(s.handleAdminRestore))
+	mux.HandleFunc("GET /admin/export", s.requireAdmin(s.handleAdminExport))
+	mux.HandleFunc("GET /admin/proposals", s.requireAdmin(s.handleProposals))
+	mux.HandleFunc("POST /admin/proposals/{id}/approve", s.requireAdmin(s.handleApproveProposal))
+	mux.HandleFunc("POST /admin/proposals/{id}/reject", s.requireAdmin(s.handleRejectProposal))
+	mux.HandleFunc("GET /admin/missing", s.requireAdmin(s.handleMissing))
+	if s.digest != nil {
+		mux.HandleFunc("GET /admin/digest", s.requireAdmin(s.handleDigest))
+		mux.HandleFunc("POST /admin/digest", s.requireAdmin(s.handleSendDigest))
+	}
+	mux.HandleFunc("GET /admin/debug/", s.requireAdmin(http.StripPrefix("/admin", debug).ServeHTTP))
+	mux.HandleFunc("POST /admin/missing/dismiss", s.requireAdmin(s.handleDismissMissing))
+	mux.HandleFunc("GET /admin/unused", s.requireAdmin(s.handleAdminUnused))
+	mux.HandleFunc("POST /admin/unused/archive", s.requireAdmin(s.handleAdminArchive))
+	mux.HandleFunc("POST /admin/unused/restore", s.requireAdmin(s.handleAdminArchive))
+	if s.auditLog != nil {
+		mux.HandleFunc("GET /admin/audit", s.requireAdmin(s.handleAudit))
+	}
+	mux.Handle("/static/", staticHandler())
+	if s.metrics != nil {
+		mux.HandleFunc("GET /metrics", s.handleMetrics)
+	}
+	if s.slack != nil {
+		mux.HandleFunc("POST /slack/command", s.handleSlackCommand)
+	}
+	if s.peers != nil {
+		mux.HandleFunc("POST "+peerChangesPath, s.handlePeerChanges)
+	}
+	if s.sso != nil {
+		mux.HandleFunc("GET /auth/login", s.handleLogin)
+		mux.HandleFunc("GET /auth/callback", s.handleCallback)
+	}
+	if s.saml != nil {
+		mux.HandleFunc("GET /saml/metadata", s.handleSAMLMetadata)
+		mux.HandleFunc("GET /saml/login", s.handleSAMLLogin)
+		mux.HandleFunc("POST /saml/acs", s.handleSAMLACS)
+	}
+	if s.ldap != nil {
+		mux.HandleFunc("/ldap/login", s.handleLDAPLogin)
+	}
+	if s.sessions != nil {
+		mux.HandleFunc("POST /auth/logout", s.handleLogout)
+	}
 }
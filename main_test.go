@@ -0,0 +1,251 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// newBenchStore returns a store holding n links, gh0 to gh<n-1>
+func newBenchStore(tb testing.TB, n int) *LinkStore {
+	tb.Helper()
+	store := &LinkStore{filePath: filepath.Join(tb.TempDir(), "links.json")}
+	links := make([]Link, n)
+	for i := range links {
+		links[i] = Link{Shortcut: fmt.Sprintf("gh%d", i), URL: fmt.Sprintf("https://github.com/org/repo%d", i)}
+	}
+	if err := store.AddMany(links); err != nil {
+		tb.Fatal(err)
+	}
+	return store
+}
+
+func TestLookupDoesNotAllocate(t *testing.T) {
+	s := newTestServer(t)
+	s.store = newBenchStore(t, 1000)
+
+	if allocs := testing.AllocsPerRun(100, func() { s.store.Get("", "gh500") }); allocs != 0 {
+		t.Errorf("Get allocates %v times, want none", allocs)
+	}
+	if allocs := testing.AllocsPerRun(100, func() { s.lookup("", "gh500/pulls/42") }); allocs != 0 {
+		t.Errorf("lookup allocates %v times, want none", allocs)
+	}
+}
+
+func TestClicksCountedDuringChanges(t *testing.T) {
+	store := newBenchStore(t, 10)
+	const clicks = 1000
+
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range clicks / 4 {
+				store.RecordClick("", "gh1", clickSource{})
+			}
+		}()
+	}
+	// Changing links meanwhile swaps the snapshot clicks are counted on
+	for i := range 20 {
+		if _, err := store.Update(Link{Shortcut: "gh1", URL: fmt.Sprintf("https://example.com/%d", i)}); err != nil {
+			t.Fatal(err)
+		}
+		store.Add(Link{Shortcut: fmt.Sprintf("new%d", i), URL: "https://example.com"})
+	}
+	wg.Wait()
+
+	link, _ := store.Get("", "gh1")
+	if link.Clicks != clicks || link.URL != "https://example.com/19" {
+		t.Errorf("gh1 has %d clicks and goes to %s, want %d clicks", link.Clicks, link.URL, clicks)
+	}
+	if err := store.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	reloaded := &LinkStore{filePath: store.filePath}
+	if err := reloaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if link, _ := reloaded.Get("", "gh1"); link.Clicks != clicks {
+		t.Errorf("saved %d clicks, want %d", link.Clicks, clicks)
+	}
+}
+
+func TestConcurrentChangesSaved(t *testing.T) {
+	store := newBenchStore(t, 1000)
+	var wg sync.WaitGroup
+	for i := range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := store.Add(Link{Shortcut: fmt.Sprintf("new%d", i), URL: "https://example.com"}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Each change is saved by the time it returns, together or not
+	reloaded := &LinkStore{filePath: store.filePath}
+	if err := reloaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(reloaded.All()); n != 1050 {
+		t.Errorf("saved %d links, want 1050", n)
+	}
+}
+
+func TestSaveFailure(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "data")
+	// The data directory is a file, so saving fails every time
+	os.WriteFile(dir, nil, 0644)
+	store := &LinkStore{filePath: filepath.Join(dir, "links.json")}
+	if err := store.Add(Link{Shortcut: "gh", URL: "https://github.com"}); err == nil {
+		t.Fatal("Add succeeded without anywhere to save")
+	}
+	if _, ok := store.Get("", "gh"); !ok || !store.Stats().Unsaved {
+		t.Errorf("the link should be kept and marked unsaved")
+	}
+
+	// Saved by the next flush once the disk recovers
+	os.Remove(dir)
+	os.Mkdir(dir, 0755)
+	if err := store.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	reloaded := &LinkStore{filePath: store.filePath}
+	if err := reloaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := reloaded.Get("", "gh"); !ok {
+		t.Error("gh wasn't saved")
+	}
+}
+
+func BenchmarkLinkStoreGet(b *testing.B) {
+	store := newBenchStore(b, 10000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			store.Get("", benchShortcuts[i%len(benchShortcuts)])
+			i++
+		}
+	})
+}
+
+func BenchmarkLookupWhileEditing(b *testing.B) {
+	s := newTestServer(b)
+	s.store = newBenchStore(b, 10000)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+				s.store.Mark("", "gh1", func(link Link) Link { link.Description = fmt.Sprint(i); return link })
+			}
+		}
+	}()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			s.lookup("", "gh9999/pulls")
+		}
+	})
+}
+
+func BenchmarkRedirect(b *testing.B) {
+	s := newTestServer(b)
+	s.store = newBenchStore(b, 10000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			w := httptest.NewRecorder()
+			s.handleHome(w, httptest.NewRequest("GET", "/"+benchShortcuts[i%len(benchShortcuts)], nil))
+			if w.Code != 302 {
+				b.Fatalf("status %d", w.Code)
+			}
+			i++
+		}
+	})
+}
+
+func BenchmarkAdd(b *testing.B) {
+	for _, n := range []int{1000, 10000} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			s := newTestServer(b)
+			s.store = newBenchStore(b, n)
+			b.ReportAllocs()
+			i := 0
+			for b.Loop() {
+				form := url.Values{"shortcut": {fmt.Sprintf("new%d", i)}, "url": {"https://example.com"}}
+				r := httptest.NewRequest("POST", "/api/links", strings.NewReader(form.Encode()))
+				r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+				w := httptest.NewRecorder()
+				s.handleQuickAdd(w, r)
+				if w.Code != http.StatusCreated {
+					b.Fatalf("status %d: %s", w.Code, w.Body)
+				}
+				i++
+			}
+		})
+	}
+}
+
+// BenchmarkAddParallel measures adding links from many clients at once,
+// as a burst of API imports would
+func BenchmarkAddParallel(b *testing.B) {
+	store := newBenchStore(b, 10000)
+	var next atomic.Int64
+	// Many more clients than CPUs, waiting on the disk rather than working
+	b.SetParallelism(16)
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := store.Add(Link{Shortcut: fmt.Sprintf("new%d", next.Add(1)), URL: "https://example.com"}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkLoad measures starting up: reading the links file into a store
+func BenchmarkLoad(b *testing.B) {
+	for _, n := range []int{1000, 10000, 50000} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			path := newBenchStore(b, n).filePath
+			b.ReportAllocs()
+			for b.Loop() {
+				store := &LinkStore{filePath: path}
+				if err := store.Load(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// benchShortcuts are the shortcuts benchmarks follow, spread over the store
+var benchShortcuts = func() []string {
+	shortcuts := make([]string, 100)
+	for i := range shortcuts {
+		shortcuts[i] = fmt.Sprintf("gh%d", i*97)
+	}
+	return shortcuts
+}()
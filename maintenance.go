@@ -0,0 +1,165 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maintenanceMessage explains why a change was refused during maintenance
+const maintenanceMessage = "go-links is down for maintenance, so links can't be changed right now. Please try again later."
+
+// maintenanceState is what an admin said when starting maintenance
+type maintenanceState struct {
+	Message string    `json:"message,omitempty"`
+	Since   time.Time `json:"since"`
+	By      string    `json:"by,omitempty"`
+}
+
+// Maintenance is maintenance mode, which admins turn on for work such as a
+// storage migration: links keep redirecting, but changes are refused and
+// every page shows a banner. It is kept in a file alongside the links, so
+// it lasts through restarts and reaches every instance sharing them.
+type Maintenance struct {
+	mu       sync.RWMutex
+	state    *maintenanceState // nil when not in maintenance
+	filePath string
+	modTime  time.Time
+}
+
+// NewMaintenance creates maintenance mode backed by filePath; call Load to
+// read it
+func NewMaintenance(filePath string) *Maintenance {
+	return &Maintenance{filePath: filePath}
+}
+
+// Load reads the maintenance file. A missing file means no maintenance.
+func (m *Maintenance) Load() error {
+	info, err := os.Stat(m.filePath)
+	if os.IsNotExist(err) {
+		m.mu.Lock()
+		m.state, m.modTime = nil, time.Time{}
+		m.mu.Unlock()
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(m.filePath)
+	if err != nil {
+		return err
+	}
+	var state maintenanceState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.state, m.modTime = &state, info.ModTime()
+	return nil
+}
+
+// ReloadIfChanged reloads the maintenance file when it has changed, so
+// maintenance started on one instance reaches the others
+func (m *Maintenance) ReloadIfChanged() error {
+	info, err := os.Stat(m.filePath)
+
+	m.mu.RLock()
+	modTime := m.modTime
+	m.mu.RUnlock()
+
+	switch {
+	case err == nil && info.ModTime().Equal(modTime):
+		return nil
+	case err != nil && !os.IsNotExist(err):
+		return fmt.Errorf("checking maintenance file: %w", err)
+	case os.IsNotExist(err) && modTime.IsZero():
+		return nil
+	}
+
+	if err := m.Load(); err != nil {
+		return fmt.Errorf("reloading maintenance file: %w", err)
+	}
+	if state := m.State(); state != nil {
+		log.Printf("Maintenance started by %s", cmp.Or(state.By, "an admin"))
+	} else {
+		log.Printf("Maintenance ended")
+	}
+	return nil
+}
+
+// Start turns maintenance on, showing message in the banner
+func (m *Maintenance) Start(message, by string, now time.Time) error {
+	state := &maintenanceState{Message: strings.TrimSpace(message), Since: now.UTC(), By: by}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := os.WriteFile(m.filePath, data, 0644); err != nil {
+		return err
+	}
+	m.state = state
+	if info, err := os.Stat(m.filePath); err == nil {
+		m.modTime = info.ModTime()
+	}
+	return nil
+}
+
+// End turns maintenance off
+func (m *Maintenance) End() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := os.Remove(m.filePath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	m.state, m.modTime = nil, time.Time{}
+	return nil
+}
+
+// State returns the current maintenance, or nil when there is none
+func (m *Maintenance) State() *maintenanceState {
+	if m == nil {
+		return nil
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.state
+}
+
+// Active reports whether the server is in maintenance
+func (m *Maintenance) Active() bool {
+	return m.State() != nil
+}
+
+// handleAdminMaintenance serves POST /admin/maintenance, starting
+// maintenance with an optional message for the banner, or ending it
+func (s *Server) handleAdminMaintenance(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form", http.StatusBadRequest)
+		return
+	}
+	var err error
+	done := "Ended maintenance"
+	if r.PostFormValue("action") == "start" {
+		err = s.maintenance.Start(r.PostFormValue("message"), s.currentUser(r), time.Now())
+		done = "Started maintenance: changes are refused until it ends"
+	} else {
+		err = s.maintenance.End()
+	}
+	if err != nil {
+		http.Error(w, "Could not change maintenance mode: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("%s (by %s)", done, cmp.Or(s.currentUser(r), "an admin"))
+	http.Redirect(w, r, "/admin?done="+url.QueryEscape(done), http.StatusSeeOther)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMaintenanceReachesOtherInstances(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "maintenance.json")
+	here, there := NewMaintenance(path), NewMaintenance(path)
+	if err := here.Load(); err != nil || here.Active() {
+		t.Fatalf("without a file: active %v, %v", here.Active(), err)
+	}
+
+	if err := here.Start("  Moving storage  ", "alice", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if err := there.ReloadIfChanged(); err != nil {
+		t.Fatal(err)
+	}
+	if state := there.State(); state == nil || state.Message != "Moving storage" || state.By != "alice" {
+		t.Errorf("other instance's state = %+v, want alice's maintenance", state)
+	}
+
+	if err := there.End(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("maintenance file still there: %v", err)
+	}
+	if err := here.ReloadIfChanged(); err != nil || here.Active() {
+		t.Errorf("after ending elsewhere: active %v, %v", here.Active(), err)
+	}
+}
+
+func TestMaintenanceMode(t *testing.T) {
+	s := newTestServer(t, Link{Shortcut: "wiki", URL: "https://wiki.example.com"})
+	s.maintenance = NewMaintenance(filepath.Join(t.TempDir(), "maintenance.json"))
+	if err := s.maintenance.Start("Back by 18:00 UTC", "alice", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.handleHome)
+	mux.HandleFunc("/add", s.requireEditor(s.handleAdd))
+	mux.HandleFunc("POST /admin/maintenance", s.handleAdminMaintenance)
+	handler := s.rejectWrites(mux)
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := do("GET", "/wiki", ""); w.Code != http.StatusFound {
+		t.Errorf("redirect: status %d, want 302", w.Code)
+	}
+	if link, _ := s.store.Get("", "wiki"); link.Clicks != 0 {
+		t.Errorf("clicks = %d, want none recorded", link.Clicks)
+	}
+	w := do("GET", "/", "")
+	if body := w.Body.String(); !strings.Contains(body, "down for maintenance") || !strings.Contains(body, "Back by 18:00 UTC") ||
+		strings.Contains(body, "read-only") || strings.Contains(body, `action="/add"`) {
+		t.Errorf("homepage: want the maintenance banner and no add form, got %s", body)
+	}
+	if w := do("POST", "/add", "shortcut=docs&url=https://docs.example.com"); w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), maintenanceMessage) {
+		t.Errorf("add: status %d, body %q", w.Code, w.Body)
+	}
+
+	// Admins can still end it
+	if w := do("POST", "/admin/maintenance", "action=end"); w.Code != http.StatusSeeOther || s.maintenance.Active() {
+		t.Errorf("ending maintenance: status %d, active %v", w.Code, s.maintenance.Active())
+	}
+	if w := do("POST", "/add", "shortcut=docs&url=https://docs.example.com"); w.Code != http.StatusSeeOther {
+		t.Errorf("add after maintenance: status %d, want 303", w.Code)
+	}
+}
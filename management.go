@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+	"path"
+	"strings"
+)
+
+// managementPath reports whether path is a management endpoint, served
+// only on GOLINKS_ADMIN_ADDR when that is set: the admin console and
+// profiles, metrics, peers' changes, API token management and, unless
+// publicAPI, the API
+func managementPath(path string, publicAPI bool) bool {
+	switch {
+	case path == "/admin" || strings.HasPrefix(path, "/admin/"):
+		return true
+	case path == "/metrics" || path == peerChangesPath:
+		return true
+	case path == "/tokens" || strings.HasPrefix(path, "/tokens/") || strings.HasPrefix(path, "/api/tokens"):
+		return true
+	case strings.HasPrefix(path, "/api/"):
+		return !publicAPI
+	}
+	return false
+}
+
+// hideManagement answers 404 for management endpoints, so the listener it
+// guards only serves redirects and browsing
+func hideManagement(next http.Handler, publicAPI bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Cleaned as the mux would, so /x/../admin can't slip through
+		if managementPath(path.Clean("/"+r.URL.Path), publicAPI) {
+			http.NotFound(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHideManagement(t *testing.T) {
+	handler := hideManagement(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), false)
+	status := func(path string) int {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w.Code
+	}
+	for _, path := range []string{"/admin", "/admin/debug/pprof/", "/metrics", "/peers/changes", "/tokens", "/api/tokens", "/api/links/bulk", "/docs/../admin"} {
+		if code := status(path); code != http.StatusNotFound {
+			t.Errorf("public %s: status %d, want 404", path, code)
+		}
+	}
+	for _, path := range []string{"/", "/wiki", "/administrator", "/metrics-dashboard", "/links/wiki", "/static/app.js", "/auth/login"} {
+		if code := status(path); code != http.StatusOK {
+			t.Errorf("public %s: status %d, want 200", path, code)
+		}
+	}
+
+	// The web UI's API can stay public
+	if !managementPath("/api/tokens", true) || managementPath("/api/search", true) {
+		t.Error("with a public API, only token management should be hidden")
+	}
+}
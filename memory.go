@@ -0,0 +1,280 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// MemoryUsage is roughly how many bytes each part of go-links' data takes.
+// Strings and maps are counted by what they hold plus a little for their
+// own bookkeeping, so it's an estimate that grows and shrinks with the
+// data, not what the Go runtime reports.
+type MemoryUsage struct {
+	Links         int64 // the links, with their click counts and history
+	SearchIndexes int64 // see searchIndexes
+	HomeCache     int64 // see homeCache
+	ClickQueue    int64 // click events waiting to be sent, see ClickEvents
+	Misses        int64 // missing shortcuts being counted, see MissStore
+}
+
+// Total returns the bytes taken by every part
+func (u MemoryUsage) Total() int64 {
+	return u.Links + u.SearchIndexes + u.HomeCache + u.ClickQueue + u.Misses
+}
+
+// caches returns the bytes taken by what's worked out from the links and
+// can be done without
+func (u MemoryUsage) caches() int64 {
+	return u.SearchIndexes + u.HomeCache
+}
+
+// Memory keeps account of the memory go-links' data takes and, with a
+// limit, keeps it under it. The links and the queues can't be let go, so
+// over the limit the search indexes and homepage views are dropped, and
+// search, suggestions and the homepage work from the links directly until
+// there's room for them again.
+type Memory struct {
+	limit int64 // 0 for no limit
+	over  atomic.Bool
+
+	mu     sync.Mutex
+	usage  MemoryUsage
+	caches int64 // what the caches took when last kept, for telling whether they fit
+}
+
+// NewMemory sets up memory accounting with an optional limit, such as 512MB
+// or 2GiB
+func NewMemory(limit string) (*Memory, error) {
+	bytes, err := parseBytes(limit)
+	if err != nil {
+		return nil, fmt.Errorf("memory limit: %w", err)
+	}
+	return &Memory{limit: bytes}, nil
+}
+
+// parseBytes parses a size such as 512MB, 2GiB or a number of bytes; empty
+// is 0
+func parseBytes(value string) (int64, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	if value == "" {
+		return 0, nil
+	}
+	number := strings.TrimRight(value, "KMGTIB")
+	unit := strings.TrimSuffix(strings.TrimSuffix(value[len(number):], "B"), "I")
+	multiplier, ok := map[string]int64{"": 1, "K": 1 << 10, "M": 1 << 20, "G": 1 << 30, "T": 1 << 40}[unit]
+	n, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+	if !ok || err != nil || n < 0 {
+		return 0, fmt.Errorf("%q is not a size like 512MB", value)
+	}
+	return int64(n * float64(multiplier)), nil
+}
+
+// Over reports whether the caches are being done without to stay under
+// the limit. It is safe to call on a nil *Memory.
+func (m *Memory) Over() bool {
+	return m != nil && m.over.Load()
+}
+
+// Usage returns the memory last measured
+func (m *Memory) Usage() MemoryUsage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.usage
+}
+
+// Measure works out what s's data takes, then drops the caches if they
+// don't fit under the limit, or lets them be kept again once they do
+func (m *Memory) Measure(s *Server) MemoryUsage {
+	usage := MemoryUsage{
+		Links:         s.store.memory(),
+		SearchIndexes: s.search.memory(),
+		HomeCache:     s.home.memory(),
+		ClickQueue:    s.clickEvents.memory(),
+		Misses:        s.misses.memory(),
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if usage.caches() > 0 {
+		m.caches = usage.caches()
+	}
+	m.usage = usage
+	if m.limit == 0 {
+		return usage
+	}
+
+	over := usage.Total()-usage.caches()+m.caches > m.limit
+	if over && !m.over.Swap(true) {
+		log.Printf("Warning: go-links' data takes about %s, more than the %s memory limit; search and the homepage are working without their caches",
+			formatBytes(usage.Total()), formatBytes(m.limit))
+	} else if !over && m.over.Swap(false) {
+		log.Printf("Memory use is back under the %s limit; search and the homepage are cached again", formatBytes(m.limit))
+	}
+	if over {
+		s.search.clear()
+		s.home.clear()
+	}
+	return usage
+}
+
+// Job measures memory use regularly, for metrics and the limit
+func (m *Memory) Job(s *Server) Job {
+	return Job{Name: "measure_memory", Every: 30 * time.Second, RunAtStart: true, Run: func() error {
+		m.Measure(s)
+		return nil
+	}}
+}
+
+// formatBytes formats a number of bytes for people, as 1.5GiB
+func formatBytes(n int64) string {
+	for _, unit := range []struct {
+		name string
+		size int64
+	}{{"TiB", 1 << 40}, {"GiB", 1 << 30}, {"MiB", 1 << 20}, {"KiB", 1 << 10}} {
+		if n >= unit.size {
+			return strconv.FormatFloat(float64(n)/float64(unit.size), 'f', 1, 64) + unit.name
+		}
+	}
+	return strconv.FormatInt(n, 10) + "B"
+}
+
+// Sizes of what's counted, as held in memory; maps are counted as a little
+// over their keys and values for their buckets
+const (
+	linkStructSize     = int64(unsafe.Sizeof(Link{}))
+	revisionStructSize = int64(unsafe.Sizeof(Revision{}))
+	storedLinkSize     = int64(unsafe.Sizeof(storedLink{}))
+	clickEventSize     = int64(unsafe.Sizeof(ClickEvent{}))
+	missSize           = int64(unsafe.Sizeof(Miss{}))
+	stringHeaderSize   = int64(unsafe.Sizeof(""))
+	mapEntryOverhead   = 16
+)
+
+// linkMemory returns roughly how many bytes link takes beyond its struct
+func linkMemory(link *Link) int64 {
+	size := int64(len(link.Shortcut) + len(link.URL) + len(link.Description) + len(link.Namespace) + len(link.MobileURL) +
+		len(link.Calendar) + len(link.Fragment) + len(link.CacheControl) + len(link.Owner) + len(link.CreatedBy))
+	size += stringsMemory(link.Tags) + stringsMemory(link.VisibleTo)
+	size += stringMapMemory(link.Regions) + countMapMemory(link.DailyClicks) + countMapMemory(link.Referrers) + countMapMemory(link.Clients)
+	for _, revision := range link.History {
+		size += revisionStructSize + int64(len(revision.URL)+len(revision.Description)+len(revision.Owner)+
+			len(revision.MobileURL)+len(revision.Calendar)+len(revision.Fragment)+len(revision.CacheControl))
+		size += stringMapMemory(revision.Regions)
+	}
+	return size
+}
+
+func stringsMemory(values []string) int64 {
+	size := int64(len(values)) * stringHeaderSize
+	for _, value := range values {
+		size += int64(len(value))
+	}
+	return size
+}
+
+func stringMapMemory(values map[string]string) int64 {
+	size := int64(len(values)) * (2*stringHeaderSize + mapEntryOverhead)
+	for key, value := range values {
+		size += int64(len(key) + len(value))
+	}
+	return size
+}
+
+func countMapMemory(counts map[string]int) int64 {
+	size := int64(len(counts)) * (stringHeaderSize + 8 + mapEntryOverhead)
+	for key := range counts {
+		size += int64(len(key))
+	}
+	return size
+}
+
+// memory returns roughly how many bytes the links take
+func (ls *LinkStore) memory() int64 {
+	var size int64
+	for key, entry := range ls.entries() {
+		link := entry.get()
+		size += 2*stringHeaderSize + mapEntryOverhead + int64(len(key.namespace)+len(key.shortcut)) + 8 + storedLinkSize + linkMemory(&link)
+	}
+	return size
+}
+
+// memory returns roughly how many bytes the search indexes take. Their
+// links share their strings with the store, so only their own copies of
+// each link and what they add are counted.
+func (si *searchIndexes) memory() int64 {
+	si.mu.Lock()
+	defer si.mu.Unlock()
+	var size int64
+	for _, idx := range si.indexes {
+		n := int64(len(idx.links))
+		size += n * (linkStructSize + 2*stringHeaderSize + 4 + 8 + 4)
+		for i := range idx.links {
+			size += int64(len(idx.text[i]) + len(idx.shortcuts[i]))
+		}
+		for _, postings := range idx.trigrams {
+			size += int64(4+mapEntryOverhead+24) + int64(cap(postings))*4
+		}
+		for tag, postings := range idx.tags {
+			size += stringHeaderSize + mapEntryOverhead + 24 + int64(len(tag)) + int64(cap(postings))*4
+		}
+	}
+	return size
+}
+
+// clear drops the search indexes, to be built again when next searched
+func (si *searchIndexes) clear() {
+	si.mu.Lock()
+	defer si.mu.Unlock()
+	si.indexes = nil
+}
+
+// memory returns roughly how many bytes the homepage views take, sharing
+// their strings with the store
+func (hc *homeCache) memory() int64 {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	var size int64
+	for _, view := range hc.views {
+		size += int64(len(view.byName)+len(view.recent)) * linkStructSize
+		size += int64(len(view.popular)) * int64(unsafe.Sizeof(popularLink{}))
+	}
+	return size
+}
+
+// clear drops the homepage views, to be built again when next shown
+func (hc *homeCache) clear() {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	hc.views = nil
+}
+
+// memory returns roughly how many bytes the click event queue takes: its
+// buffer, allocated up front, and the events waiting in it. It is safe to
+// call on a nil *ClickEvents.
+func (ce *ClickEvents) memory() int64 {
+	if ce == nil {
+		return 0
+	}
+	// Each waiting event's strings are about a shortcut, URL and referrer
+	return int64(cap(ce.queue))*clickEventSize + int64(len(ce.queue))*128
+}
+
+// memory returns roughly how many bytes the missing shortcuts take. It is
+// safe to call on a nil *MissStore.
+func (ms *MissStore) memory() int64 {
+	if ms == nil {
+		return 0
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	var size int64
+	for key := range ms.misses {
+		size += missSize + 2*stringHeaderSize + mapEntryOverhead + 2*int64(len(key.namespace)+len(key.shortcut))
+	}
+	return size
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseBytes(t *testing.T) {
+	for value, want := range map[string]int64{"": 0, "1024": 1024, "512MB": 512 << 20, "2GiB": 2 << 30, "1.5g": 3 << 29, "64 KB": 64 << 10} {
+		if got, err := parseBytes(value); err != nil || got != want {
+			t.Errorf("parseBytes(%q) = %d, %v, want %d", value, got, err, want)
+		}
+	}
+	for _, bad := range []string{"lots", "MB", "-1MB", "5PB"} {
+		if _, err := parseBytes(bad); err == nil {
+			t.Errorf("parseBytes(%q) succeeded, want an error", bad)
+		}
+	}
+	if got := formatBytes(3 << 29); got != "1.5GiB" {
+		t.Errorf("formatBytes(1.5GiB) = %s", got)
+	}
+}
+
+func TestMemoryUsage(t *testing.T) {
+	s := newTestServer(t)
+	s.store = newBenchStore(t, 1000)
+	s.memory, _ = NewMemory("")
+	usage := s.memory.Measure(s)
+	// Each link's struct, strings and place in the snapshot
+	if perLink := usage.Links / 1000; perLink < linkStructSize || perLink > 2*linkStructSize {
+		t.Errorf("%d bytes a link, want about %d", perLink, linkStructSize+100)
+	}
+	if usage.SearchIndexes != 0 || usage.HomeCache != 0 {
+		t.Errorf("caches take %d and %d bytes before they're used", usage.SearchIndexes, usage.HomeCache)
+	}
+
+	s.handleSearch(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/search?q=repo1", nil))
+	s.showHomepage(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	usage = s.memory.Measure(s)
+	if usage.SearchIndexes == 0 || usage.HomeCache == 0 {
+		t.Errorf("caches take %d and %d bytes once used", usage.SearchIndexes, usage.HomeCache)
+	}
+	if s.memory.Over() {
+		t.Error("over a limit that isn't set")
+	}
+
+	s.metrics, _ = NewMetrics("true", "", "", "", "")
+	if body := string(s.metrics.Render(s)); !strings.Contains(body, `go_links_memory_bytes{part="links"}`) || strings.Contains(body, "go_links_memory_limit_bytes") {
+		t.Errorf("metrics without a limit:\n%s", body)
+	}
+}
+
+func TestMemoryLimit(t *testing.T) {
+	s := newTestServer(t)
+	s.store = newBenchStore(t, 1000)
+	s.memory, _ = NewMemory("100KB")
+	s.handleSearch(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/search?q=repo1", nil))
+
+	// Over the limit, the caches are dropped and not kept again
+	if s.memory.Measure(s); !s.memory.Over() || s.search.indexes != nil {
+		t.Fatalf("over the limit: over = %v, %d indexes kept", s.memory.Over(), len(s.search.indexes))
+	}
+	w := httptest.NewRecorder()
+	s.handleSearch(w, httptest.NewRequest("GET", "/api/search?q=repo999", nil))
+	if !strings.Contains(w.Body.String(), `"gh999"`) {
+		t.Errorf("search without an index = %s", w.Body)
+	}
+	w = httptest.NewRecorder()
+	s.showHomepage(w, httptest.NewRequest("GET", "/", nil))
+	if !strings.Contains(w.Body.String(), "gh0") {
+		t.Error("homepage without a cache leaves out gh0")
+	}
+	if s.search.indexes != nil || s.home.views != nil {
+		t.Error("caches kept while over the limit")
+	}
+
+	// With room again, they're kept
+	s.memory.limit = 100 << 20
+	if s.memory.Measure(s); s.memory.Over() {
+		t.Error("still over a limit with room to spare")
+	}
+	s.handleSearch(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/search?q=repo1", nil))
+	if s.search.indexes == nil {
+		t.Error("search index not kept under the limit")
+	}
+}
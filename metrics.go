@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/subtle"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// otherShortcut labels the clicks of every link outside the top links, so
+// totals still add up
+const otherShortcut = "__other__"
+
+// defaultClickBuckets are the upper bounds of the link click histogram
+var defaultClickBuckets = []float64{0, 1, 10, 100, 1000, 10000}
+
+// Metrics serves link metrics in the Prometheus text format. Per-shortcut
+// series are limited to the most clicked links in each namespace, with the
+// rest summed up under otherShortcut, and the spread of clicks across all
+// links is a histogram, so a deployment with tens of thousands of links
+// still exposes a bounded number of series. Metrics are computed at most
+// once per refresh interval, however often they are scraped.
+type Metrics struct {
+	top     int       // per-shortcut series per namespace; 0 for none
+	buckets []float64 // histogram upper bounds, ascending
+	refresh time.Duration
+	token   string // bearer token scrapers must present, if set
+
+	mu       sync.Mutex
+	snapshot []byte
+	takenAt  time.Time
+}
+
+// NewMetrics creates the metrics endpoint from whether it is enabled
+// ("true"), how many shortcuts per namespace get their own series (100 by
+// default), comma-separated histogram buckets, a refresh interval and an
+// optional bearer token. It returns nil when metrics are off.
+func NewMetrics(enabled, top, buckets, refresh, token string) (*Metrics, error) {
+	if enabled != "true" {
+		return nil, nil
+	}
+	m := &Metrics{top: 100, buckets: defaultClickBuckets, refresh: 30 * time.Second, token: token}
+	if top != "" {
+		n, err := strconv.Atoi(top)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("%q isn't a number of shortcuts", top)
+		}
+		m.top = n
+	}
+	if buckets != "" {
+		m.buckets = nil
+		for _, bucket := range splitList(buckets) {
+			le, err := strconv.ParseFloat(bucket, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%q isn't a bucket bound", bucket)
+			}
+			m.buckets = append(m.buckets, le)
+		}
+		slices.Sort(m.buckets)
+		m.buckets = slices.Compact(m.buckets)
+	}
+	if refresh != "" {
+		d, err := time.ParseDuration(refresh)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("%q isn't a refresh interval", refresh)
+		}
+		m.refresh = d
+	}
+	return m, nil
+}
+
+// namespaceMetrics sums up one namespace's links
+type namespaceMetrics struct {
+	links  int
+	clicks int
+	series []Link // links with their own series, most clicked first
+	other  int    // clicks of the rest
+}
+
+// Render writes the metrics for the current links, missing shortcuts and
+// proposals
+func (m *Metrics) Render(s *Server) []byte {
+	links := s.store.All()
+	namespaces := make(map[string]*namespaceMetrics)
+	counts := make([]int, len(m.buckets))
+	var sum int
+	for _, link := range links {
+		ns := namespaces[link.Namespace]
+		if ns == nil {
+			ns = &namespaceMetrics{}
+			namespaces[link.Namespace] = ns
+		}
+		ns.links++
+		ns.clicks += link.Clicks
+		sum += link.Clicks
+		for i, le := range m.buckets {
+			if float64(link.Clicks) <= le {
+				counts[i]++
+			}
+		}
+		// Hidden and group-only shortcuts are never named
+		if link.Clicks > 0 && !link.Hidden && len(link.VisibleTo) == 0 {
+			ns.series = append(ns.series, link)
+		} else {
+			ns.other += link.Clicks
+		}
+	}
+	for _, ns := range namespaces {
+		slices.SortFunc(ns.series, func(a, b Link) int {
+			return cmp.Or(b.Clicks-a.Clicks, strings.Compare(a.Shortcut, b.Shortcut))
+		})
+		for _, link := range ns.series[min(m.top, len(ns.series)):] {
+			ns.other += link.Clicks
+		}
+		ns.series = ns.series[:min(m.top, len(ns.series))]
+	}
+	names := slices.Sorted(maps.Keys(namespaces))
+
+	var b bytes.Buffer
+	b.WriteString("# HELP go_links_links Links stored, by namespace.\n# TYPE go_links_links gauge\n")
+	for _, name := range names {
+		fmt.Fprintf(&b, "go_links_links{namespace=%s} %d\n", promLabel(name), namespaces[name].links)
+	}
+	b.WriteString("# HELP go_links_clicks_total Redirects followed, by namespace.\n# TYPE go_links_clicks_total counter\n")
+	for _, name := range names {
+		fmt.Fprintf(&b, "go_links_clicks_total{namespace=%s} %d\n", promLabel(name), namespaces[name].clicks)
+	}
+	if m.top > 0 {
+		fmt.Fprintf(&b, "# HELP go_links_shortcut_clicks_total Redirects followed for the %d most clicked shortcuts in each namespace; the rest are counted as %s.\n", m.top, otherShortcut)
+		b.WriteString("# TYPE go_links_shortcut_clicks_total counter\n")
+		for _, name := range names {
+			ns := namespaces[name]
+			for _, link := range ns.series {
+				fmt.Fprintf(&b, "go_links_shortcut_clicks_total{namespace=%s,shortcut=%s} %d\n", promLabel(name), promLabel(link.Shortcut), link.Clicks)
+			}
+			if ns.other > 0 {
+				fmt.Fprintf(&b, "go_links_shortcut_clicks_total{namespace=%s,shortcut=%s} %d\n", promLabel(name), promLabel(otherShortcut), ns.other)
+			}
+		}
+	}
+	b.WriteString("# HELP go_links_link_clicks How many times links have been followed.\n# TYPE go_links_link_clicks histogram\n")
+	for i, le := range m.buckets {
+		fmt.Fprintf(&b, "go_links_link_clicks_bucket{le=%q} %d\n", strconv.FormatFloat(le, 'g', -1, 64), counts[i])
+	}
+	fmt.Fprintf(&b, "go_links_link_clicks_bucket{le=\"+Inf\"} %d\n", len(links))
+	fmt.Fprintf(&b, "go_links_link_clicks_sum %d\ngo_links_link_clicks_count %d\n", sum, len(links))
+	if s.misses != nil {
+		fmt.Fprintf(&b, "# HELP go_links_missing_shortcuts Missing shortcuts being counted.\n# TYPE go_links_missing_shortcuts gauge\ngo_links_missing_shortcuts %d\n", s.misses.Len())
+	}
+	fmt.Fprintf(&b, "# HELP go_links_proposals Suggested links waiting for review.\n# TYPE go_links_proposals gauge\ngo_links_proposals %d\n", len(s.proposals.List()))
+	if s.jobs != nil {
+		writeJobMetrics(&b, s.jobs.Status())
+	}
+	if s.memory != nil {
+		usage := s.memory.Usage()
+		b.WriteString("# HELP go_links_memory_bytes Roughly how much memory go-links' data takes, by part.\n# TYPE go_links_memory_bytes gauge\n")
+		for _, part := range []struct {
+			name  string
+			bytes int64
+		}{{"links", usage.Links}, {"search_indexes", usage.SearchIndexes}, {"home_cache", usage.HomeCache}, {"click_queue", usage.ClickQueue}, {"missing_shortcuts", usage.Misses}} {
+			fmt.Fprintf(&b, "go_links_memory_bytes{part=%q} %d\n", part.name, part.bytes)
+		}
+		if s.memory.limit > 0 {
+			over := 0
+			if s.memory.Over() {
+				over = 1
+			}
+			fmt.Fprintf(&b, "# HELP go_links_memory_limit_bytes The memory limit for go-links' data.\n# TYPE go_links_memory_limit_bytes gauge\ngo_links_memory_limit_bytes %d\n", s.memory.limit)
+			fmt.Fprintf(&b, "# HELP go_links_memory_over_limit Whether caches are being done without to stay under the memory limit.\n# TYPE go_links_memory_over_limit gauge\ngo_links_memory_over_limit %d\n", over)
+		}
+	}
+	if s.concurrency != nil {
+		handling, waiting, shed := s.concurrency.InFlight()
+		fmt.Fprintf(&b, "# HELP go_links_requests_in_flight Requests being handled.\n# TYPE go_links_requests_in_flight gauge\ngo_links_requests_in_flight %d\n", handling)
+		fmt.Fprintf(&b, "# HELP go_links_requests_queued Requests waiting to be handled, over the concurrency limit.\n# TYPE go_links_requests_queued gauge\ngo_links_requests_queued %d\n", waiting)
+		fmt.Fprintf(&b, "# HELP go_links_requests_shed_total Requests turned away with 503 while overloaded.\n# TYPE go_links_requests_shed_total counter\ngo_links_requests_shed_total %d\n", shed)
+	}
+	if s.leadership != nil {
+		leading := 0
+		if s.leadership.IsLeader() {
+			leading = 1
+		}
+		fmt.Fprintf(&b, "# HELP go_links_leader Whether this instance runs leader-only background jobs.\n# TYPE go_links_leader gauge\ngo_links_leader %d\n", leading)
+	}
+	if s.peers != nil {
+		found, unreachable := s.peers.Count()
+		fmt.Fprintf(&b, "# HELP go_links_peers Peers changes are sent to.\n# TYPE go_links_peers gauge\ngo_links_peers %d\n", found)
+		fmt.Fprintf(&b, "# HELP go_links_peers_unreachable Peers that couldn't be sent the last change.\n# TYPE go_links_peers_unreachable gauge\ngo_links_peers_unreachable %d\n", unreachable)
+	}
+	return b.Bytes()
+}
+
+// writeJobMetrics writes how each background job has been doing
+func writeJobMetrics(b *bytes.Buffer, jobs []JobStatus) {
+	b.WriteString("# HELP go_links_job_runs_total Background job runs, by job.\n# TYPE go_links_job_runs_total counter\n")
+	for _, job := range jobs {
+		fmt.Fprintf(b, "go_links_job_runs_total{job=%s} %d\n", promLabel(job.Name), job.Runs)
+	}
+	b.WriteString("# HELP go_links_job_failures_total Background job runs that failed, by job.\n# TYPE go_links_job_failures_total counter\n")
+	for _, job := range jobs {
+		fmt.Fprintf(b, "go_links_job_failures_total{job=%s} %d\n", promLabel(job.Name), job.Failures)
+	}
+	b.WriteString("# HELP go_links_job_last_duration_seconds How long each background job's last run took.\n# TYPE go_links_job_last_duration_seconds gauge\n")
+	for _, job := range jobs {
+		fmt.Fprintf(b, "go_links_job_last_duration_seconds{job=%s} %g\n", promLabel(job.Name), job.LastDuration.Seconds())
+	}
+	b.WriteString("# HELP go_links_job_last_success_timestamp_seconds When each background job last succeeded, 0 if never.\n# TYPE go_links_job_last_success_timestamp_seconds gauge\n")
+	for _, job := range jobs {
+		var last int64
+		if !job.LastSuccess.IsZero() {
+			last = job.LastSuccess.Unix()
+		}
+		fmt.Fprintf(b, "go_links_job_last_success_timestamp_seconds{job=%s} %d\n", promLabel(job.Name), last)
+	}
+}
+
+// promLabel quotes a label value for the Prometheus text format
+func promLabel(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value) + `"`
+}
+
+// handleMetrics serves GET /metrics
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	m := s.metrics
+	if m.token != "" && subtle.ConstantTimeCompare([]byte(presentedToken(r)), []byte(m.token)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="go-links metrics"`)
+		http.Error(w, "Metrics token required", http.StatusUnauthorized)
+		return
+	}
+
+	m.mu.Lock()
+	if m.snapshot == nil || time.Since(m.takenAt) >= m.refresh {
+		m.snapshot, m.takenAt = m.Render(s), time.Now()
+	}
+	snapshot := m.snapshot
+	m.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(snapshot)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsLimitCardinality(t *testing.T) {
+	var links []Link
+	for i := range 50 {
+		links = append(links, Link{Shortcut: fmt.Sprintf("link%02d", i), URL: "https://example.com", Clicks: i})
+	}
+	links = append(links,
+		Link{Shortcut: "secret", URL: "https://example.com", Clicks: 1000, Hidden: true},
+		Link{Shortcut: "ci", URL: "https://ci.example.com", Namespace: "eng", Clicks: 7},
+	)
+	s := newTestServer(t, links...)
+	var err error
+	if s.metrics, err = NewMetrics("true", "3", "5,50,0", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	s.jobs = NewScheduler()
+	s.jobs.Add(Job{Name: "save_clicks", Every: time.Hour, Run: s.store.Flush})
+
+	w := httptest.NewRecorder()
+	s.handleMetrics(w, httptest.NewRequest("GET", "/metrics", nil))
+	body := w.Body.String()
+	for _, want := range []string{
+		`go_links_links{namespace=""} 51`,
+		`go_links_clicks_total{namespace="eng"} 7`,
+		`go_links_shortcut_clicks_total{namespace="",shortcut="link49"} 49`,
+		`go_links_shortcut_clicks_total{namespace="",shortcut="link47"} 47`,
+		// Everything but the top 3, including the hidden link
+		fmt.Sprintf(`go_links_shortcut_clicks_total{namespace="",shortcut="__other__"} %d`, 1225-49-48-47+1000),
+		`go_links_shortcut_clicks_total{namespace="eng",shortcut="ci"} 7`,
+		`go_links_link_clicks_bucket{le="0"} 1`,
+		`go_links_link_clicks_bucket{le="5"} 6`,
+		`go_links_link_clicks_bucket{le="50"} 51`,
+		`go_links_link_clicks_bucket{le="+Inf"} 52`,
+		`go_links_link_clicks_count 52`,
+		`go_links_job_runs_total{job="save_clicks"} 0`,
+		`go_links_job_last_success_timestamp_seconds{job="save_clicks"} 0`,
+	} {
+		if !strings.Contains(body, want+"\n") {
+			t.Errorf("metrics are missing %s:\n%s", want, body)
+		}
+	}
+	if n := strings.Count(body, "go_links_shortcut_clicks_total{"); n != 5 {
+		t.Errorf("%d per-shortcut series, want 5", n)
+	}
+	if strings.Contains(body, "secret") || strings.Contains(body, "link46") {
+		t.Errorf("metrics name shortcuts they shouldn't:\n%s", body)
+	}
+
+	// Snapshots are reused until the refresh interval is over
+	s.store.Add(Link{Shortcut: "new", URL: "https://example.com"})
+	w = httptest.NewRecorder()
+	s.handleMetrics(w, httptest.NewRequest("GET", "/metrics", nil))
+	if w.Body.String() != body {
+		t.Error("metrics were recomputed within the refresh interval")
+	}
+}
+
+func TestMetricsToken(t *testing.T) {
+	s := newTestServer(t)
+	s.metrics, _ = NewMetrics("true", "", "", "0s", "scrape-me")
+	for token, want := range map[string]int{"": http.StatusUnauthorized, "guess": http.StatusUnauthorized, "scrape-me": http.StatusOK} {
+		r := httptest.NewRequest("GET", "/metrics", nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		s.handleMetrics(w, r)
+		if w.Code != want {
+			t.Errorf("token %q: status %d, want %d", token, w.Code, want)
+		}
+	}
+
+	for _, bad := range [][]string{{"true", "-1", "", ""}, {"true", "", "1,lots", ""}, {"true", "", "", "soon"}} {
+		if _, err := NewMetrics(bad[0], bad[1], bad[2], bad[3], ""); err == nil {
+			t.Errorf("NewMetrics(%q) succeeded", bad)
+		}
+	}
+	if m, err := NewMetrics("", "", "", "", ""); m != nil || err != nil {
+		t.Errorf("NewMetrics when off = %v, %v; want nil, nil", m, err)
+	}
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// importAdapters read exports from other link tools, for migrating to
+// go-links, into rows of link fields. Entries with no equivalent here are
+// kept as rows to skip, so they can be reported.
+var importAdapters = map[string]func(io.Reader) ([]importRow, error){
+	"golinks":   readGolinksExport,
+	"trotto":    readTrottoExport,
+	"nginx":     readNginxRedirects,
+	"bookmarks": readBookmarks,
+}
+
+// golinksColumns name the fields of a golinks.io export, CSV or JSON
+var golinksColumns = columnMap{
+	"name":            "shortcut",
+	"golink":          "shortcut",
+	"go link":         "shortcut",
+	"destination":     "url",
+	"destination url": "url",
+	"destination_url": "url",
+	"owner email":     "owner",
+	"owner_email":     "owner",
+	"created by":      "owner",
+}
+
+// readGolinksExport reads a golinks.io export, as CSV or JSON
+func readGolinksExport(r io.Reader) ([]importRow, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var rows []importRow
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		rows, err = readImportItems(bytes.NewReader(data), "json")
+	} else {
+		rows, err = readImportCSV(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i, row := range rows {
+		fields := make(map[string]string)
+		for column, value := range row.values {
+			if field := golinksColumns.field(column); field != "" {
+				fields[field] = value
+			}
+		}
+		fields["shortcut"] = strings.TrimPrefix(strings.TrimSpace(fields["shortcut"]), "go/")
+		fields["url"] = placeholders(fields["url"])
+		rows[i].values = fields
+	}
+	return rows, nil
+}
+
+// trottoLink is a link in a Trotto export
+type trottoLink struct {
+	Shortpath      string `json:"shortpath"`
+	DestinationURL string `json:"destination_url"`
+	Owner          string `json:"owner"`
+}
+
+// readTrottoExport reads a Trotto export, a JSON list of links. Trotto's
+// %s placeholders, as in jira/%s, become path parameters.
+func readTrottoExport(r io.Reader) ([]importRow, error) {
+	var links []trottoLink
+	if err := json.NewDecoder(r).Decode(&links); err != nil {
+		return nil, err
+	}
+	rows := make([]importRow, len(links))
+	for i, link := range links {
+		shortcut := strings.TrimSuffix(strings.ReplaceAll(link.Shortpath, "/%s", ""), "/")
+		rows[i] = importRow{line: i + 1, values: map[string]string{
+			"shortcut": shortcut,
+			"url":      placeholders(link.DestinationURL),
+			"owner":    link.Owner,
+		}}
+	}
+	return rows, nil
+}
+
+// placeholders turns %s placeholders, used by other tools, into {1}, {2}...
+func placeholders(url string) string {
+	for n := 1; strings.Contains(url, "%s"); n++ {
+		url = strings.Replace(url, "%s", fmt.Sprintf("{%d}", n), 1)
+	}
+	return url
+}
+
+// nginxRewrite matches the rewrite patterns for a single path, such as
+// ^/gh$ or ^/gh/?$
+var nginxRewrite = regexp.MustCompile(`^\^/([A-Za-z0-9._~-]+(?:/[A-Za-z0-9._~-]+)*)/?\??\$$`)
+
+// readNginxRedirects reads redirects from an nginx configuration: entries
+// of a map block, such as "/gh https://github.com;", rewrites of a single
+// path, and exact locations returning a redirect. Regular expressions and
+// variables can't become links, so they are skipped.
+func readNginxRedirects(r io.Reader) ([]importRow, error) {
+	statements, err := nginxStatements(r)
+	if err != nil {
+		return nil, err
+	}
+	var rows []importRow
+	var blocks []nginxStatement // the statements opening the enclosing blocks
+	for _, st := range statements {
+		switch st.end {
+		case "}":
+			if len(blocks) > 0 {
+				blocks = blocks[:len(blocks)-1]
+			}
+			continue
+		case "{":
+			blocks = append(blocks, st)
+			continue
+		}
+		var block nginxStatement
+		if len(blocks) > 0 {
+			block = blocks[len(blocks)-1]
+		}
+
+		var from, to string
+		switch {
+		case block.is("map") && len(st.words) == 2 && !st.is("default", "hostnames", "volatile", "include"):
+			from, to = st.words[0], st.words[1]
+			if strings.HasPrefix(from, "~") {
+				rows = append(rows, st.skip("regular expression map entries can't become links"))
+				continue
+			}
+		case st.is("rewrite") && len(st.words) >= 3:
+			match := nginxRewrite.FindStringSubmatch(st.words[1])
+			if match == nil {
+				rows = append(rows, st.skip("only rewrites of a single path, such as ^/gh$, can become links"))
+				continue
+			}
+			from, to = match[1], st.words[2]
+		case st.is("return") && block.is("location") && len(st.words) == 3:
+			switch {
+			case len(block.words) == 3 && block.words[1] == "=":
+				from = block.words[2]
+			case len(block.words) == 2 && !strings.HasPrefix(block.words[1], "~"):
+				from = block.words[1]
+			default:
+				rows = append(rows, st.skip("only exact locations, such as location = /gh, can become links"))
+				continue
+			}
+			to = st.words[2]
+		default:
+			continue
+		}
+		if strings.Contains(to, "$") {
+			rows = append(rows, st.skip("destinations with nginx variables can't become links"))
+			continue
+		}
+		rows = append(rows, importRow{line: st.line, values: map[string]string{
+			"shortcut": strings.Trim(from, "/"),
+			"url":      to,
+		}})
+	}
+	return rows, nil
+}
+
+// nginxStatement is a directive in an nginx configuration, ended by ";",
+// or opening a block with "{", or "}" closing one
+type nginxStatement struct {
+	line  int
+	words []string
+	end   string
+}
+
+// is reports whether the statement is one of the named directives
+func (st nginxStatement) is(names ...string) bool {
+	for _, name := range names {
+		if len(st.words) > 0 && st.words[0] == name {
+			return true
+		}
+	}
+	return false
+}
+
+// skip returns a row to skip for the statement, saying why
+func (st nginxStatement) skip(reason string) importRow {
+	return importRow{line: st.line, skip: reason, values: map[string]string{"shortcut": strings.Join(st.words, " ")}}
+}
+
+// nginxStatements splits an nginx configuration into statements, dropping
+// comments and the quotes around words
+func nginxStatements(r io.Reader) ([]nginxStatement, error) {
+	var statements []nginxStatement
+	var current nginxStatement
+	var word strings.Builder
+	inWord := false
+	endWord := func() {
+		if inWord {
+			current.words = append(current.words, word.String())
+			word.Reset()
+			inWord = false
+		}
+	}
+
+	br := bufio.NewReader(r)
+	line := 1
+	var quote rune
+	for {
+		c, _, err := br.ReadRune()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if c == '\n' {
+			line++
+		}
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				word.WriteRune(c)
+			}
+		case c == '"' || c == '\'':
+			if len(current.words) == 0 && !inWord {
+				current.line = line
+			}
+			quote, inWord = c, true
+		case c == '#' && !inWord:
+			endWord()
+			br.ReadString('\n')
+			line++
+		case c == ';' || c == '{' || c == '}':
+			endWord()
+			if len(current.words) > 0 || c == '}' {
+				current.end = string(c)
+				statements = append(statements, current)
+			}
+			current = nginxStatement{}
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			endWord()
+		default:
+			if len(current.words) == 0 && !inWord {
+				current.line = line
+			}
+			word.WriteRune(c)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote on line %d", line)
+	}
+	return statements, nil
+}
+
+// readBookmarks reads a browser's bookmarks export, the Netscape bookmark
+// HTML every browser writes. A bookmark's keyword, where the browser has
+// them, is its shortcut, and otherwise one is made from its title; the
+// folders it is in and its tags become tags.
+func readBookmarks(r io.Reader) ([]importRow, error) {
+	z := html.NewTokenizer(r)
+	var rows []importRow
+	var folders []string
+	var folder string // the heading of the folder about to open
+	var special bool  // whether that folder is one the browser made
+	var bookmark *importRow
+	var text strings.Builder
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			if z.Err() == io.EOF {
+				return rows, nil
+			}
+			return nil, z.Err()
+		case html.StartTagToken:
+			name, _ := z.TagName()
+			switch string(name) {
+			case "a":
+				bookmark = &importRow{line: len(rows) + 1, values: map[string]string{}}
+				for more := true; more; {
+					var key, value []byte
+					key, value, more = z.TagAttr()
+					switch string(key) {
+					case "href":
+						bookmark.values["url"] = string(value)
+					case "shortcuturl":
+						bookmark.values["shortcut"] = string(value)
+					case "tags":
+						bookmark.values["tags"] = string(value)
+					}
+				}
+				text.Reset()
+			case "h3":
+				// The bookmarks bar and other bookmarks aren't folders
+				// anyone chose, so they don't become tags
+				special = false
+				for more := true; more; {
+					var key []byte
+					key, _, more = z.TagAttr()
+					special = special || string(key) == "personal_toolbar_folder" || string(key) == "unfiled_bookmarks_folder"
+				}
+				text.Reset()
+			case "dl":
+				folders = append(folders, folder)
+				folder = ""
+			}
+		case html.TextToken:
+			text.Write(z.Text())
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			switch string(name) {
+			case "a":
+				if bookmark == nil {
+					continue
+				}
+				title := strings.TrimSpace(text.String())
+				bookmark.values["description"] = title
+				if bookmark.values["shortcut"] == "" {
+					bookmark.values["shortcut"] = slugify(title)
+				}
+				var tags []string
+				for _, f := range folders {
+					if slug := slugify(f); slug != "" {
+						tags = append(tags, slug)
+					}
+				}
+				bookmark.values["tags"] = strings.Join(append(tags, splitList(bookmark.values["tags"])...), ",")
+				if !strings.HasPrefix(bookmark.values["url"], "http") {
+					bookmark.skip = "only web bookmarks can become links"
+				}
+				rows = append(rows, *bookmark)
+				bookmark = nil
+			case "h3":
+				if !special {
+					folder = strings.TrimSpace(text.String())
+				}
+			case "dl":
+				if len(folders) > 0 {
+					folders = folders[:len(folders)-1]
+				}
+			}
+		}
+	}
+}
+
+// slugify makes a shortcut from a title, such as team-wiki from "Team Wiki"
+func slugify(title string) string {
+	var b strings.Builder
+	dash := false
+	for _, c := range strings.ToLower(title) {
+		if c >= 'a' && c <= 'z' || c >= '0' && c <= '9' {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(c)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	return b.String()
+}
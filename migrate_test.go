@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestImportAdapters(t *testing.T) {
+	tests := []struct {
+		format  string
+		export  string
+		want    map[string]string // shortcut to URL
+		skipped int
+	}{
+		{"golinks", "Name,Destination URL,Description,Owner Email\ngo/gh,https://github.com,Code,alice@example.com\njira,https://jira.example.com/browse/%s,,\n",
+			map[string]string{"gh": "https://github.com", "jira": "https://jira.example.com/browse/{1}"}, 0},
+		{"trotto", `[{"shortpath": "wiki", "destination_url": "https://wiki.example.com", "owner": "bob@example.com"},
+			{"shortpath": "jira/%s", "destination_url": "https://jira.example.com/browse/%s"}]`,
+			map[string]string{"wiki": "https://wiki.example.com", "jira": "https://jira.example.com/browse/{1}"}, 0},
+		{"nginx", `
+map $uri $golink {
+    default "";
+    /gh   https://github.com;   # our code
+    "/docs" "https://docs.example.com/#start";
+    ~^/u/(.*)$ https://users.example.com/$1;
+}
+server {
+    rewrite ^/hr/?$ https://hr.example.com permanent;
+    rewrite ^/t/(.*)$ https://tickets.example.com/$1 redirect;
+    location = /status { return 302 https://status.example.com; }
+}`,
+			map[string]string{"gh": "https://github.com", "docs": "https://docs.example.com/#start", "hr": "https://hr.example.com", "status": "https://status.example.com"}, 2},
+		{"bookmarks", `<!DOCTYPE NETSCAPE-Bookmark-file-1>
+<TITLE>Bookmarks</TITLE>
+<H1>Bookmarks</H1>
+<DL><p>
+    <DT><H3 PERSONAL_TOOLBAR_FOLDER="true">Bookmarks bar</H3>
+    <DL><p>
+        <DT><A HREF="https://wiki.example.com/" SHORTCUTURL="wiki">Team Wiki</A>
+        <DT><H3>Eng Tools</H3>
+        <DL><p>
+            <DT><A HREF="https://ci.example.com/" TAGS="builds">CI &amp; Deploys</A>
+        </DL><p>
+        <DT><A HREF="javascript:alert(1)">Bookmarklet</A>
+    </DL><p>
+</DL><p>`,
+			map[string]string{"wiki": "https://wiki.example.com/", "ci-deploys": "https://ci.example.com/"}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			s := newTestServer(t)
+			w := httptest.NewRecorder()
+			s.handleImport(w, httptest.NewRequest("POST", "/api/import?format="+tt.format, strings.NewReader(tt.export)))
+			var result importResult
+			json.NewDecoder(w.Body).Decode(&result)
+			if w.Code != http.StatusOK || result.Added != len(tt.want) || len(result.Skipped) != tt.skipped {
+				t.Fatalf("import: status %d, %+v", w.Code, result)
+			}
+			for shortcut, url := range tt.want {
+				if link, ok := s.store.Get("", shortcut); !ok || link.URL != url {
+					t.Errorf("%s = %q, %v, want %s", shortcut, link.URL, ok, url)
+				}
+			}
+		})
+	}
+}
+
+func TestBookmarkFoldersBecomeTags(t *testing.T) {
+	rows, err := readBookmarks(strings.NewReader(`<DL><p><DT><H3>Eng Tools</H3><DL><p><DT><A HREF="https://ci.example.com/" TAGS="builds">CI</A></DL><p></DL>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].values["tags"] != "eng-tools,builds" {
+		t.Errorf("rows = %+v, want CI tagged eng-tools and builds", rows)
+	}
+}
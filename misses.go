@@ -0,0 +1,246 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxMisses caps how many missing shortcuts are counted. Once full, the
+// least wanted one is forgotten to make room.
+const maxMisses = 1000
+
+// Miss counts attempts to follow a shortcut that doesn't exist
+type Miss struct {
+	Namespace string    `json:"namespace,omitempty"`
+	Shortcut  string    `json:"shortcut"`
+	Count     int       `json:"count"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// MissStore counts missing shortcuts people try, persisted as JSON
+// alongside the links. Counts are saved periodically, see SaveEvery.
+type MissStore struct {
+	mu       sync.Mutex
+	misses   map[linkKey]Miss
+	dirty    bool
+	filePath string
+}
+
+// NewMissStore creates a miss store backed by filePath; call Load to read it
+func NewMissStore(filePath string) *MissStore {
+	return &MissStore{
+		misses:   make(map[linkKey]Miss),
+		filePath: filePath,
+	}
+}
+
+// Load reads counts from the JSON file. A missing file means no misses.
+func (ms *MissStore) Load() error {
+	data, err := os.ReadFile(ms.filePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var misses []Miss
+	if err := json.Unmarshal(data, &misses); err != nil {
+		return err
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	for _, miss := range misses {
+		ms.misses[linkKey{miss.Namespace, miss.Shortcut}] = miss
+	}
+	return nil
+}
+
+// save writes the counts to the JSON file; the caller must hold ms.mu
+func (ms *MissStore) save() error {
+	data, err := json.MarshalIndent(ms.sorted(), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(ms.filePath, data, 0644); err != nil {
+		return err
+	}
+	ms.dirty = false
+	return nil
+}
+
+// Flush saves the counts if they have changed since the last save
+func (ms *MissStore) Flush() error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if !ms.dirty {
+		return nil
+	}
+	return ms.save()
+}
+
+// Record counts an attempt to follow a missing shortcut
+func (ms *MissStore) Record(namespace, shortcut string, now time.Time) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	key := linkKey{namespace, shortcut}
+	miss, ok := ms.misses[key]
+	if !ok {
+		if len(ms.misses) >= maxMisses {
+			ms.evict()
+		}
+		miss = Miss{Namespace: namespace, Shortcut: shortcut, FirstSeen: now}
+	}
+	miss.Count++
+	miss.LastSeen = now
+	ms.misses[key] = miss
+	ms.dirty = true
+}
+
+// evict forgets the least wanted miss; the caller must hold ms.mu
+func (ms *MissStore) evict() {
+	var least linkKey
+	first := true
+	for key, miss := range ms.misses {
+		if first || compareMisses(miss, ms.misses[least]) > 0 {
+			least, first = key, false
+		}
+	}
+	delete(ms.misses, least)
+}
+
+// compareMisses orders misses most wanted first: the most attempts, then
+// the most recent
+func compareMisses(a, b Miss) int {
+	return cmp.Or(b.Count-a.Count, b.LastSeen.Compare(a.LastSeen), strings.Compare(a.Shortcut, b.Shortcut))
+}
+
+// sorted returns every miss, most wanted first; the caller must hold ms.mu
+func (ms *MissStore) sorted() []Miss {
+	misses := slices.Collect(maps.Values(ms.misses))
+	slices.SortFunc(misses, compareMisses)
+	return misses
+}
+
+// Top returns the most wanted missing shortcuts in a namespace
+func (ms *MissStore) Top(namespace string, limit int) []Miss {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	var misses []Miss
+	for _, miss := range ms.sorted() {
+		if miss.Namespace == namespace && len(misses) < limit {
+			misses = append(misses, miss)
+		}
+	}
+	return misses
+}
+
+// Since returns up to limit of the most wanted missing shortcuts in any
+// namespace tried since the given time
+func (ms *MissStore) Since(since time.Time, limit int) []Miss {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	var misses []Miss
+	for _, miss := range ms.sorted() {
+		if miss.LastSeen.After(since) && len(misses) < limit {
+			misses = append(misses, miss)
+		}
+	}
+	return misses
+}
+
+// Len returns how many missing shortcuts are being counted
+func (ms *MissStore) Len() int {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return len(ms.misses)
+}
+
+// Forget stops counting a missing shortcut
+func (ms *MissStore) Forget(namespace, shortcut string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	delete(ms.misses, linkKey{namespace, shortcut})
+	return ms.save()
+}
+
+// ignoredMisses are paths browsers and crawlers ask for on their own
+var ignoredMisses = []string{"favicon.ico", "robots.txt", "apple-touch-icon", ".well-known/", "sitemap.xml"}
+
+// recordMiss counts a request for a missing shortcut, unless it comes from
+// a bot, a prefetch or the browser itself, or mustn't be tracked
+func (s *Server) recordMiss(r *http.Request, namespace, shortcut string) {
+	if s.misses == nil || s.changesRefused() || !s.privacy.Tracks(r) || isPrefetch(r) || clientSource(r.UserAgent()) == "bot" {
+		return
+	}
+	shortcut = strings.TrimSuffix(shortcut, "/")
+	if shortcut == "" || len(shortcut) > 100 {
+		return
+	}
+	for _, ignored := range ignoredMisses {
+		if strings.HasPrefix(shortcut, ignored) {
+			return
+		}
+	}
+	s.misses.Record(namespace, shortcut, time.Now().UTC())
+}
+
+// handleMissing serves GET /admin/missing, the most wanted missing links
+// with buttons to create or dismiss them, or as JSON with ?format=json
+func (s *Server) handleMissing(w http.ResponseWriter, r *http.Request) {
+	namespace := s.hosts.Namespace(r)
+	misses := []Miss{}
+	for _, miss := range s.misses.Top(namespace, maxMisses) {
+		// Skip shortcuts created since they were missed
+		if _, _, exists := s.lookup(namespace, miss.Shortcut); !exists && len(misses) < 100 {
+			misses = append(misses, miss)
+		}
+	}
+
+	if r.URL.Query().Get("format") == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(misses)
+		return
+	}
+
+	data := struct {
+		Prefix      string
+		Theme       *Theme
+		Maintenance *maintenanceState
+		CSRFToken   string
+		Lang        *translator
+		Done        string
+		Misses      []Miss
+	}{
+		Prefix:      s.hosts.Prefix(r),
+		Theme:       s.theme.Load(),
+		Maintenance: s.maintenance.State(),
+		CSRFToken:   s.csrfToken(w, r),
+		Lang:        translatorFor(w, r),
+		Done:        r.URL.Query().Get("done"),
+		Misses:      misses,
+	}
+
+	writePage(w, http.StatusOK, "missing.html", data, "Missing-link report unavailable")
+}
+
+// handleDismissMissing serves POST /admin/missing/dismiss, dropping a
+// missing shortcut from the report
+func (s *Server) handleDismissMissing(w http.ResponseWriter, r *http.Request) {
+	shortcut := r.PostFormValue("shortcut")
+	if err := s.misses.Forget(s.hosts.Namespace(r), shortcut); err != nil {
+		http.Error(w, "Failed to save missing shortcuts", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/admin/missing?done="+url.QueryEscape("Dismissed "+shortcut), http.StatusSeeOther)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMissingShortcutsAreCounted(t *testing.T) {
+	s := newTestServer(t, Link{Shortcut: "wiki", URL: "https://wiki.example.com"})
+
+	try := func(path string, header ...string) {
+		r := httptest.NewRequest("GET", path, nil)
+		if len(header) == 2 {
+			r.Header.Set(header[0], header[1])
+		}
+		w := httptest.NewRecorder()
+		s.handleHome(w, r)
+	}
+	for range 3 {
+		try("/roadmap")
+	}
+	try("/oncall/")
+	try("/favicon.ico")
+	try("/wiki/Some_Page") // handled by wiki
+	try("/crawled", "User-Agent", "Googlebot/2.1 (+http://www.google.com/bot.html)")
+	try("/prefetched", "Sec-Purpose", "prefetch")
+
+	got := s.misses.Top("", 10)
+	if len(got) != 2 || got[0].Shortcut != "roadmap" || got[0].Count != 3 || got[1].Shortcut != "oncall" {
+		t.Errorf("misses = %+v, want roadmap 3 times and oncall once", got)
+	}
+
+	// Shortcuts created since are left out of the report
+	if err := s.store.Add(Link{Shortcut: "oncall", URL: "https://oncall.example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	s.handleMissing(w, httptest.NewRequest("GET", "/admin/missing?format=json", nil))
+	var report []Miss
+	if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	if len(report) != 1 || report[0].Shortcut != "roadmap" {
+		t.Errorf("report = %+v, want just roadmap", report)
+	}
+
+	// Dismissing drops a shortcut for good
+	form := url.Values{"shortcut": {"roadmap"}}
+	r := httptest.NewRequest("POST", "/admin/missing/dismiss", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	s.handleDismissMissing(httptest.NewRecorder(), r)
+	w = httptest.NewRecorder()
+	s.handleMissing(w, httptest.NewRequest("GET", "/admin/missing", nil))
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "roadmap") {
+		t.Errorf("report after dismissing: status %d\n%s", w.Code, w.Body.String())
+	}
+}
+
+func TestMissStoreEvictsLeastWanted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "misses.json")
+	ms := NewMissStore(path)
+	now := time.Now()
+	ms.Record("", "popular", now)
+	ms.Record("", "popular", now)
+	for i := range maxMisses - 1 {
+		ms.Record("", fmt.Sprintf("typo%d", i), now.Add(time.Duration(i)*time.Second))
+	}
+	ms.Record("", "newest", now.Add(time.Hour))
+
+	if len(ms.misses) != maxMisses {
+		t.Errorf("kept %d misses, want %d", len(ms.misses), maxMisses)
+	}
+	if _, ok := ms.misses[linkKey{"", "typo0"}]; ok {
+		t.Error("the least wanted miss was kept")
+	}
+	if _, ok := ms.misses[linkKey{"", "popular"}]; !ok {
+		t.Error("the most wanted miss was evicted")
+	}
+
+	// Counts survive a restart
+	ms.mu.Lock()
+	if err := ms.save(); err != nil {
+		t.Fatal(err)
+	}
+	ms.mu.Unlock()
+	loaded := NewMissStore(path)
+	if err := loaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if top := loaded.Top("", 1); len(top) != 1 || top[0].Shortcut != "popular" || top[0].Count != 2 {
+		t.Errorf("top after reloading = %+v", top)
+	}
+}
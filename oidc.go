@@ -0,0 +1,156 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// SSO signs users in with an OpenID Connect provider such as Google
+// Workspace, Okta or Azure AD
+type SSO struct {
+	config   oauth2.Config
+	verifier *oidc.IDTokenVerifier
+	domains  map[string]bool // allowed email domains; empty allows any
+}
+
+// loginState is what the callback needs to finish a sign-in safely
+type loginState struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	Next     string `json:"next"`
+}
+
+// NewSSO sets up sign-in with the OpenID Connect provider at issuer,
+// fetching its configuration. redirectURL is this server's /auth/callback
+// as registered with the provider, domains optionally restricts sign-in to
+// a comma-separated list of email domains. An empty issuer disables SSO.
+func NewSSO(ctx context.Context, issuer, clientID, clientSecret, redirectURL, domains string) (*SSO, error) {
+	if issuer == "" {
+		return nil, nil
+	}
+	if clientID == "" || redirectURL == "" {
+		return nil, errors.New("a client ID and redirect URL are required")
+	}
+
+	provider, err := oidc.NewProvider(ctx, issuer)
+	if err != nil {
+		return nil, fmt.Errorf("discovering %s: %w", issuer, err)
+	}
+
+	sso := &SSO{
+		config: oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			Endpoint:     provider.Endpoint(),
+			RedirectURL:  redirectURL,
+			Scopes:       []string{oidc.ScopeOpenID, "email", "profile"},
+		},
+		verifier: provider.Verifier(&oidc.Config{ClientID: clientID}),
+		domains:  make(map[string]bool),
+	}
+	for _, domain := range splitList(domains) {
+		sso.domains[strings.ToLower(strings.TrimPrefix(domain, "@"))] = true
+	}
+	return sso, nil
+}
+
+// verify finishes a sign-in from the provider's callback, returning a
+// session for the user's email (or username when the provider has no
+// email) and any groups in the "groups" claim
+func (sso *SSO) verify(ctx context.Context, r *http.Request, login loginState) (session, error) {
+	query := r.URL.Query()
+	if query.Get("state") != login.State {
+		return session{}, errors.New("sign-in state doesn't match")
+	}
+	if msg := query.Get("error"); msg != "" {
+		return session{}, fmt.Errorf("provider refused sign-in: %s %s", msg, query.Get("error_description"))
+	}
+
+	token, err := sso.config.Exchange(ctx, query.Get("code"), oauth2.VerifierOption(login.Verifier))
+	if err != nil {
+		return session{}, fmt.Errorf("exchanging code: %w", err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return session{}, errors.New("provider returned no ID token")
+	}
+	idToken, err := sso.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return session{}, fmt.Errorf("verifying ID token: %w", err)
+	}
+	if idToken.Nonce != login.Nonce {
+		return session{}, errors.New("ID token nonce doesn't match")
+	}
+
+	var claims struct {
+		Email             string   `json:"email"`
+		EmailVerified     *bool    `json:"email_verified"`
+		PreferredUsername string   `json:"preferred_username"`
+		Groups            []string `json:"groups"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return session{}, fmt.Errorf("reading ID token claims: %w", err)
+	}
+	if claims.EmailVerified != nil && !*claims.EmailVerified {
+		return session{}, fmt.Errorf("email %s is not verified", claims.Email)
+	}
+
+	user := cmp.Or(claims.Email, claims.PreferredUsername, idToken.Subject)
+	if len(sso.domains) > 0 {
+		_, domain, _ := strings.Cut(user, "@")
+		if !sso.domains[strings.ToLower(domain)] {
+			return session{}, fmt.Errorf("%s is not in an allowed domain", user)
+		}
+	}
+	return session{User: user, Groups: claims.Groups}, nil
+}
+
+// handleLogin serves GET /auth/login, sending the browser to the provider
+// to sign in and then back to ?next= (the homepage by default)
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	login := loginState{
+		State:    randomToken(),
+		Nonce:    randomToken(),
+		Verifier: oauth2.GenerateVerifier(),
+		Next:     localRedirect(r.URL.Query().Get("next")),
+	}
+	s.sessions.setCookie(w, r, loginCookie, login, loginLifetime, http.SameSiteLaxMode)
+
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, s.sso.config.AuthCodeURL(login.State,
+		oidc.Nonce(login.Nonce), oauth2.S256ChallengeOption(login.Verifier)), http.StatusFound)
+}
+
+// handleCallback serves GET /auth/callback, where the provider sends the
+// browser back after signing in
+func (s *Server) handleCallback(w http.ResponseWriter, r *http.Request) {
+	var login loginState
+	if !s.sessions.readCookie(r, loginCookie, &login) {
+		s.showError(w, r, http.StatusBadRequest, "The sign-in took too long or was started in another browser. Please try again.")
+		return
+	}
+	s.sessions.clearCookie(w, r, loginCookie)
+
+	sess, err := s.sso.verify(r.Context(), r, login)
+	if err != nil {
+		log.Printf("Sign-in failed: %v", err)
+		s.showError(w, r, http.StatusForbidden, "Sign-in failed. Check that you're using your work account and try again.")
+		return
+	}
+
+	if err := s.sessions.Start(w, r, sess); err != nil {
+		log.Printf("Starting session for %s: %v", sess.User, err)
+		s.showError(w, r, http.StatusInternalServerError, "Sign-in is unavailable right now. Please try again later.")
+		return
+	}
+	http.Redirect(w, r, login.Next, http.StatusSeeOther)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+)
+
+// fakeProvider is a minimal OpenID Connect provider that signs in whoever
+// email is set to
+type fakeProvider struct {
+	*httptest.Server
+	key   *rsa.PrivateKey
+	email string
+	nonce string
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &fakeProvider{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                                p.URL,
+			"authorization_endpoint":                p.URL + "/authorize",
+			"token_endpoint":                        p.URL + "/token",
+			"jwks_uri":                              p.URL + "/keys",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+			{Key: &key.PublicKey, KeyID: "test", Algorithm: "RS256", Use: "sig"},
+		}})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("code") != "good-code" || r.FormValue("code_verifier") == "" {
+			http.Error(w, `{"error": "invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: jose.JSONWebKey{Key: key, KeyID: "test"}}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		claims, _ := json.Marshal(map[string]any{
+			"iss":   p.URL,
+			"aud":   "golinks",
+			"sub":   "12345",
+			"email": p.email,
+			"nonce": p.nonce,
+			"iat":   time.Now().Unix(),
+			"exp":   time.Now().Add(time.Hour).Unix(),
+		})
+		signed, err := signer.Sign(claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		idToken, _ := signed.CompactSerialize()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"access_token": "x", "token_type": "Bearer", "id_token": idToken})
+	})
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+func TestSSOSignIn(t *testing.T) {
+	provider := newFakeProvider(t)
+	sso, err := NewSSO(context.Background(), provider.URL, "golinks", "secret", "https://go.example.com/auth/callback", "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newTestServer(t)
+	s.sso = sso
+	s.sessions = NewSessions("session-secret", newMemorySessionStore())
+	s.signInToEdit = true
+
+	// signIn runs the login flow for email, returning the callback response
+	signIn := func(email, next string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.handleLogin(w, httptest.NewRequest("GET", "/auth/login?next="+url.QueryEscape(next), nil))
+		authURL, err := url.Parse(w.Header().Get("Location"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if authURL.Query().Get("code_challenge") == "" {
+			t.Errorf("login doesn't use PKCE: %s", authURL)
+		}
+		provider.email, provider.nonce = email, authURL.Query().Get("nonce")
+
+		r := httptest.NewRequest("GET", "/auth/callback?code=good-code&state="+authURL.Query().Get("state"), nil)
+		for _, cookie := range w.Result().Cookies() {
+			r.AddCookie(cookie)
+		}
+		w = httptest.NewRecorder()
+		s.handleCallback(w, r)
+		return w
+	}
+	withSession := func(w *httptest.ResponseRecorder) *http.Request {
+		r := httptest.NewRequest("POST", "/add", nil)
+		for _, cookie := range w.Result().Cookies() {
+			if cookie.Name == sessionCookie {
+				r.AddCookie(cookie)
+			}
+		}
+		return r
+	}
+
+	w := signIn("alice@example.com", "/links/gh")
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/links/gh" {
+		t.Fatalf("callback: status %d to %q, body:\n%s", w.Code, w.Header().Get("Location"), w.Body)
+	}
+	r := withSession(w)
+	if user := s.currentUser(r); user != "alice@example.com" {
+		t.Errorf("currentUser = %q, want alice@example.com", user)
+	}
+	if !s.mayEdit(r) {
+		t.Errorf("signed-in user may not edit")
+	}
+	if s.mayEdit(httptest.NewRequest("POST", "/add", nil)) {
+		t.Errorf("anonymous user may edit with GOLINKS_REQUIRE_SIGN_IN")
+	}
+
+	// A tampered session cookie signs nobody in
+	r = httptest.NewRequest("GET", "/", nil)
+	cookie := withSession(w).Cookies()[0]
+	cookie.Value = "x" + cookie.Value
+	r.AddCookie(cookie)
+	if user := s.currentUser(r); user != "" {
+		t.Errorf("tampered cookie signed in %q", user)
+	}
+
+	// Accounts outside the allowed domains are turned away
+	if w := signIn("eve@elsewhere.com", "/"); w.Code != http.StatusForbidden {
+		t.Errorf("other domain: status %d, want %d", w.Code, http.StatusForbidden)
+	}
+
+	// Only local paths are followed after signing in
+	if w := signIn("alice@example.com", "//evil.example/"); w.Header().Get("Location") != "/" {
+		t.Errorf("redirected to %q after sign-in, want /", w.Header().Get("Location"))
+	}
+
+	// The callback only completes a sign-in this browser started
+	w = httptest.NewRecorder()
+	s.handleCallback(w, httptest.NewRequest("GET", "/auth/callback?code=good-code&state=forged", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("callback without login cookie: status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// openSearchDescription describes go-links as a search engine, so
+// browsers can add it and "go gh" typed in the address bar follows go/gh
+type openSearchDescription struct {
+	XMLName       xml.Name        `xml:"http://a9.com/-/spec/opensearch/1.1/ OpenSearchDescription"`
+	ShortName     string          `xml:"ShortName"`
+	Description   string          `xml:"Description"`
+	InputEncoding string          `xml:"InputEncoding"`
+	URLs          []openSearchURL `xml:"Url"`
+}
+
+// openSearchURL is a URL template in an OpenSearch description
+type openSearchURL struct {
+	Type     string `xml:"type,attr"`
+	Method   string `xml:"method,attr"`
+	Template string `xml:"template,attr"`
+}
+
+// handleOpenSearch serves GET /opensearch.xml, the OpenSearch description
+// for the request's host, which pages link to so browsers offer to add it
+func (s *Server) handleOpenSearch(w http.ResponseWriter, r *http.Request) {
+	base := baseURL(r)
+	prefix := s.hosts.Prefix(r)
+	description := openSearchDescription{
+		ShortName:     prefix,
+		Description:   "Follow " + prefix + "/ links",
+		InputEncoding: "UTF-8",
+		URLs: []openSearchURL{
+			{Type: "text/html", Method: "get", Template: base + "/search?q={searchTerms}"},
+			{Type: "application/x-suggestions+json", Method: "get", Template: base + "/search/suggest?q={searchTerms}"},
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/opensearchdescription+xml")
+	w.Write([]byte(xml.Header))
+	xml.NewEncoder(w).Encode(description)
+}
+
+// handleSearchRedirect serves GET /search?q=..., what the browser opens
+// for a search typed after the keyword. "gh" or "go/gh" follows go/gh, and
+// words after the shortcut fill its path parameters, so "jira 123" follows
+// go/jira/123. Anything that isn't a shortcut searches the links instead.
+func (s *Server) handleSearchRedirect(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	path := strings.Join(strings.Fields(strings.TrimPrefix(query, s.hosts.Prefix(r)+"/")), "/")
+
+	w.Header().Set("Cache-Control", "no-store")
+	if path == "" {
+		http.Redirect(w, r, "/", http.StatusFound)
+		return
+	}
+	if _, _, exists := s.lookup(s.hosts.Namespace(r), path); exists {
+		http.Redirect(w, r, (&url.URL{Path: "/" + path}).String(), http.StatusFound)
+		return
+	}
+	http.Redirect(w, r, "/?q="+url.QueryEscape(query), http.StatusFound)
+}
+
+// handleSearchSuggest serves GET /search/suggest?q=..., the suggestions a
+// browser shows as a search is typed after the keyword, in the OpenSearch
+// suggestions format: the query, then the shortcuts, their descriptions
+// and where they go
+func (s *Server) handleSearchSuggest(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("q")
+	index, visible := s.searchFor(r, s.hosts.Namespace(r))
+	results := index.suggest(strings.TrimPrefix(query, s.hosts.Prefix(r)+"/"), 8, visible)
+
+	shortcuts, descriptions, urls := []string{}, []string{}, []string{}
+	for _, result := range results {
+		shortcuts = append(shortcuts, result.Shortcut)
+		descriptions = append(descriptions, result.Description)
+		urls = append(urls, result.URL)
+	}
+
+	w.Header().Set("Content-Type", "application/x-suggestions+json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode([]any{query, shortcuts, descriptions, urls})
+}
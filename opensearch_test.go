@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+)
+
+func TestOpenSearch(t *testing.T) {
+	s := newTestServer(t,
+		Link{Shortcut: "gh", URL: "https://github.com", Description: "GitHub"},
+		Link{Shortcut: "jira", URL: "https://jira.example.com/browse/{1}"},
+	)
+
+	r := httptest.NewRequest("GET", "https://go.example.com/opensearch.xml", nil)
+	r.Header.Set("X-Forwarded-Proto", "https")
+	w := httptest.NewRecorder()
+	s.handleOpenSearch(w, r)
+	var description openSearchDescription
+	if err := xml.Unmarshal(w.Body.Bytes(), &description); err != nil {
+		t.Fatalf("descriptor: %v\n%s", err, w.Body)
+	}
+	if description.ShortName != "go" || len(description.URLs) != 2 ||
+		description.URLs[0].Template != "https://go.example.com/search?q={searchTerms}" {
+		t.Errorf("descriptor = %+v", description)
+	}
+
+	for q, want := range map[string]string{
+		"gh":         "/gh",
+		" go/gh ":    "/gh",
+		"jira 123":   "/jira/123",
+		"wiki pages": "/?q=wiki+pages",
+		"":           "/",
+	} {
+		w := httptest.NewRecorder()
+		s.handleSearchRedirect(w, httptest.NewRequest("GET", "/search?q="+url.QueryEscape(q), nil))
+		if got := w.Header().Get("Location"); w.Code != http.StatusFound || got != want {
+			t.Errorf("search %q: status %d, Location %q; want %q", q, w.Code, got, want)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	s.handleSearchSuggest(w, httptest.NewRequest("GET", "/search/suggest?q=g", nil))
+	var suggestions []any
+	if err := json.Unmarshal(w.Body.Bytes(), &suggestions); err != nil || len(suggestions) != 4 {
+		t.Fatalf("suggestions = %s (%v)", w.Body, err)
+	}
+	if shortcuts := suggestions[1].([]any); !slices.Contains(shortcuts, any("gh")) || suggestions[0] != "g" {
+		t.Errorf("suggestions = %v", suggestions)
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// peerChangesPath is where replicas send each other their changes
+const peerChangesPath = "/peers/changes"
+
+// Each peer queues up to peerQueueSize changes; past that it's sent every
+// link instead, once it can take them
+const peerQueueSize = 100
+
+// Peers tells the other replicas sharing a data directory which links have
+// changed by posting to each of them directly, for clusters without a Redis
+// server for Invalidations. Peers are listed, found through DNS SRV
+// records, or both, and found again every 30 seconds as replicas come and
+// go. A peer that misses changes, being down, unreachable or too far
+// behind, reads every link again once it can be reached.
+type Peers struct {
+	sources   []peerSource
+	secret    string // sent with changes, and required of them
+	instance  string
+	client    *http.Client
+	lookupSRV func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+
+	mu    sync.Mutex
+	peers map[string]*peer // by URL
+}
+
+// peerSource is a peer's URL or, with srv set, a DNS SRV name whose
+// targets are peers reached with scheme
+type peerSource struct {
+	url    string
+	srv    string
+	scheme string
+}
+
+// peer is a replica changes are sent to, one at a time in the background
+type peer struct {
+	url     string
+	queue   chan invalidation
+	missed  atomic.Bool // changes were lost, so it's next sent every link
+	failing atomic.Bool
+}
+
+// NewPeers sets up sending changes to peers listed in list, comma
+// separated, as instance id. Each is a URL such as http://links-2:8080 or
+// host:port for plain HTTP, or dnssrv+ and a DNS name, such as
+// dnssrv+_go-links._tcp.links.internal or dnssrv+https://..., whose SRV
+// records name the peers. It returns nil when no peers are listed.
+func NewPeers(list, secret, id string) (*Peers, error) {
+	if list = strings.TrimSpace(list); list == "" {
+		return nil, nil
+	}
+	if secret == "" {
+		return nil, errors.New("GOLINKS_PEER_SECRET must be set too, so only peers can send changes")
+	}
+	p := &Peers{
+		secret:    secret,
+		client:    &http.Client{Timeout: 5 * time.Second},
+		lookupSRV: net.DefaultResolver.LookupSRV,
+		peers:     make(map[string]*peer),
+	}
+	for _, field := range strings.Split(list, ",") {
+		if field = strings.TrimSpace(field); field == "" {
+			continue
+		}
+		name, srv := strings.CutPrefix(field, "dnssrv+")
+		if !strings.Contains(name, "://") {
+			name = "http://" + name
+		}
+		u, err := url.Parse(name)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+			return nil, fmt.Errorf("peer %q must be a URL, host:port or dnssrv+ and a DNS name", field)
+		}
+		switch {
+		case srv && u.Port() != "":
+			return nil, fmt.Errorf("peer %q: ports come from the SRV records", field)
+		case srv:
+			p.sources = append(p.sources, peerSource{srv: u.Hostname(), scheme: u.Scheme})
+		default:
+			p.sources = append(p.sources, peerSource{url: u.Scheme + "://" + u.Host})
+		}
+	}
+	if len(p.sources) == 0 {
+		return nil, nil
+	}
+
+	var err error
+	if p.instance, err = instanceID(id); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// find returns the URLs of the peers listed and those named by their SRV
+// records, which may include this replica's own
+func (p *Peers) find() ([]string, error) {
+	var urls []string
+	for _, source := range p.sources {
+		if source.srv == "" {
+			urls = append(urls, source.url)
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		_, records, err := p.lookupSRV(ctx, "", "", source.srv)
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("looking up peers: %w", err)
+		}
+		for _, record := range records {
+			host := strings.TrimSuffix(record.Target, ".")
+			urls = append(urls, source.scheme+"://"+net.JoinHostPort(host, strconv.Itoa(int(record.Port))))
+		}
+	}
+	slices.Sort(urls)
+	return slices.Compact(urls), nil
+}
+
+// Discover finds the peers again, starting to send changes to new ones and
+// stopping for those gone. New peers, and those that missed changes, are
+// sent every link, as they may not have heard of changes made meanwhile. If
+// a lookup fails, the peers already found are kept.
+func (p *Peers) Discover() error {
+	urls, err := p.find()
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for peerURL, pr := range p.peers {
+		if !slices.Contains(urls, peerURL) {
+			close(pr.queue)
+			delete(p.peers, peerURL)
+		}
+	}
+	for _, peerURL := range urls {
+		pr, ok := p.peers[peerURL]
+		if !ok {
+			pr = &peer{url: peerURL, queue: make(chan invalidation, peerQueueSize)}
+			pr.missed.Store(true)
+			p.peers[peerURL] = pr
+			go p.send(pr)
+		}
+		if pr.missed.Load() {
+			pr.enqueue(invalidation{Instance: p.instance})
+		}
+	}
+	return nil
+}
+
+// Job finds the peers regularly, and sends every link to those that
+// missed changes
+func (p *Peers) Job() Job {
+	return Job{Name: "discover_peers", Every: 30 * time.Second, RunAtStart: true, Run: p.Discover}
+}
+
+// Publish queues the links changed in entries to be sent to every peer
+func (p *Peers) Publish(entries []AuditEntry) {
+	if len(entries) == 0 {
+		return
+	}
+	message := newInvalidation(p.instance, entries)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, pr := range p.peers {
+		pr.enqueue(message)
+	}
+}
+
+// Count returns how many peers have been found, and how many of them
+// couldn't be reached last time changes were sent
+func (p *Peers) Count() (found, unreachable int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, pr := range p.peers {
+		if pr.failing.Load() {
+			unreachable++
+		}
+	}
+	return len(p.peers), unreachable
+}
+
+// enqueue queues message to be sent, or marks the peer as having missed
+// it when too many are waiting; the caller must hold Peers.mu
+func (pr *peer) enqueue(message invalidation) {
+	select {
+	case pr.queue <- message:
+	default:
+		pr.missed.Store(true)
+	}
+}
+
+// send posts the peer's queued changes until it's gone
+func (p *Peers) send(pr *peer) {
+	for message := range pr.queue {
+		if pr.missed.Swap(false) {
+			// Every link is read again, which covers the changes waiting too
+			message.Links = nil
+		drain:
+			for {
+				select {
+				case _, ok := <-pr.queue:
+					if !ok {
+						break drain
+					}
+				default:
+					break drain
+				}
+			}
+		}
+
+		err := p.post(pr.url, message)
+		switch {
+		case err != nil:
+			pr.missed.Store(true)
+			if !pr.failing.Swap(true) {
+				log.Printf("Warning: Could not send changes to peer %s, it will read every link once it can be reached: %v", pr.url, err)
+			}
+		case pr.failing.Swap(false):
+			log.Printf("Peer %s can be reached again", pr.url)
+		}
+	}
+}
+
+// post sends message to the peer at peerURL
+func (p *Peers) post(peerURL string, message invalidation) error {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, peerURL+peerChangesPath, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+p.secret)
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("%s returned %s", req.URL.Host, resp.Status)
+	}
+	return nil
+}
+
+// handlePeerChanges serves POST /peers/changes, reading the links another
+// replica changed from the links file
+func (s *Server) handlePeerChanges(w http.ResponseWriter, r *http.Request) {
+	if subtle.ConstantTimeCompare([]byte(presentedToken(r)), []byte(s.peers.secret)) != 1 {
+		http.Error(w, "Peer secret required", http.StatusUnauthorized)
+		return
+	}
+	var message invalidation
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&message); err != nil {
+		http.Error(w, "Malformed changes: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Replicas found through DNS are sent their own changes too
+	if message.Instance != s.peers.instance {
+		readChanges(s.store, message.Links)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestNewPeers(t *testing.T) {
+	p, err := NewPeers("", "", "")
+	if p != nil || err != nil {
+		t.Errorf("NewPeers(\"\") = %v, %v, want nil, nil", p, err)
+	}
+	if _, err := NewPeers("links-2:8080", "", ""); err == nil {
+		t.Error("peers accepted without a secret")
+	}
+	for _, bad := range []string{"ftp://links-2", "http://", "dnssrv+", "dnssrv+_go-links._tcp.links.internal:8080"} {
+		if _, err := NewPeers(bad, "secret", ""); err == nil {
+			t.Errorf("NewPeers accepted %q", bad)
+		}
+	}
+
+	p, err = NewPeers("links-2:8080, https://links-3.example.com/ignored,dnssrv+_go-links._tcp.links.internal", "secret", "links-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.lookupSRV = func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+		if name != "_go-links._tcp.links.internal" {
+			t.Errorf("looked up %q", name)
+		}
+		return "", []*net.SRV{{Target: "links-4.links.internal.", Port: 8080}, {Target: "links-2.", Port: 8080}}, nil
+	}
+	urls, err := p.find()
+	want := "http://links-2:8080 http://links-4.links.internal:8080 https://links-3.example.com"
+	if err != nil || strings.Join(urls, " ") != want {
+		t.Errorf("found %v, %v, want %s", urls, err, want)
+	}
+}
+
+func TestPeers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "links.json")
+	a, b := newTestServer(t), newTestServer(t)
+	a.store, b.store = &LinkStore{filePath: path}, &LinkStore{filePath: path}
+	a.store.Add(Link{Shortcut: "gh", URL: "https://github.com"})
+	b.store.Load()
+	b.store.RecordClick("", "gh", clickSource{})
+
+	// b is found through DNS, alongside a itself, and can be taken down
+	var down atomic.Bool
+	serve := func(s *Server) *httptest.Server {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if down.Load() {
+				http.Error(w, "down", http.StatusServiceUnavailable)
+				return
+			}
+			s.handlePeerChanges(w, r)
+		}))
+		t.Cleanup(srv.Close)
+		return srv
+	}
+	srvA, srvB := serve(a), serve(b)
+	var err error
+	if a.peers, err = NewPeers("dnssrv+_go-links._tcp.links.internal", "secret", "a"); err != nil {
+		t.Fatal(err)
+	}
+	a.peers.lookupSRV = func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+		var records []*net.SRV
+		for _, srv := range []*httptest.Server{srvA, srvB} {
+			u, _ := url.Parse(srv.URL)
+			port, _ := strconv.Atoi(u.Port())
+			records = append(records, &net.SRV{Target: u.Hostname() + ".", Port: uint16(port)})
+		}
+		return "", records, nil
+	}
+	b.peers, _ = NewPeers("localhost:1", "secret", "b")
+	if err := a.peers.Discover(); err != nil {
+		t.Fatal(err)
+	}
+	if found, _ := a.peers.Count(); found != 2 {
+		t.Fatalf("found %d peers, want 2", found)
+	}
+
+	// A change on one replica shows on the other, keeping its clicks
+	old, _ := a.store.Get("", "gh")
+	a.store.Update(Link{Shortcut: "gh", URL: "https://github.com/org"})
+	updated, _ := a.store.Get("", "gh")
+	a.peers.Publish([]AuditEntry{{Action: auditUpdate, Shortcut: "gh", Old: &old, New: &updated}})
+	eventually(t, "the change to reach the peer", func() bool {
+		link, _ := b.store.Get("", "gh")
+		return link.URL == "https://github.com/org"
+	})
+	if link, _ := b.store.Get("", "gh"); link.Clicks != 1 {
+		t.Errorf("clicks = %d, want the peer's 1 kept", link.Clicks)
+	}
+
+	// A peer that was down reads every link once it's found again
+	down.Store(true)
+	a.store.Add(Link{Shortcut: "ci", URL: "https://ci.example.com"})
+	added, _ := a.store.Get("", "ci")
+	a.peers.Publish([]AuditEntry{{Action: auditCreate, Shortcut: "ci", New: &added}})
+	eventually(t, "the peers to be unreachable", func() bool {
+		_, unreachable := a.peers.Count()
+		return unreachable == 2
+	})
+	down.Store(false)
+	a.peers.Discover()
+	eventually(t, "the missed change to reach the peer", func() bool {
+		_, found := b.store.Get("", "ci")
+		_, unreachable := a.peers.Count()
+		return found && unreachable == 0
+	})
+
+	// Changes are only taken with the secret
+	for _, token := range []string{"", "wrong"} {
+		r := httptest.NewRequest("POST", peerChangesPath, strings.NewReader(`{"instance": "c"}`))
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		b.handlePeerChanges(w, r)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("token %q: status %d, want 401", token, w.Code)
+		}
+	}
+}
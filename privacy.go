@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// How client IP addresses are kept in logs, the audit log and suggestions
+const (
+	ipFull     = "full"     // as they are
+	ipHash     = "hash"     // replaced by a keyed hash, so one address still matches itself
+	ipTruncate = "truncate" // cut to their /24 (IPv4) or /48 (IPv6) network
+	ipDrop     = "drop"     // not kept at all
+)
+
+// Privacy decides what go-links keeps about the people using it. By
+// default analytics are collected and IP addresses kept in full.
+type Privacy struct {
+	analytics bool          // collect click breakdowns and exports and missing shortcuts
+	honorDNT  bool          // leave out requests sent with DNT: 1 or Sec-GPC: 1
+	ipMode    string        // see ipFull and friends
+	hashKey   []byte        // for ipHash
+	retention time.Duration // how long analytics and IP addresses are kept; 0 for ever
+}
+
+// NewPrivacy creates privacy settings from whether analytics are collected
+// ("false" turns them off), how IP addresses are kept, the key IP
+// addresses are hashed with (a random one per run if empty), whether to
+// honor Do Not Track, and a retention window in days
+func NewPrivacy(analytics, ipMode, hashKey, honorDNT, retentionDays string) (*Privacy, error) {
+	p := &Privacy{
+		analytics: analytics != "false",
+		honorDNT:  honorDNT == "true",
+		ipMode:    ipMode,
+	}
+	switch p.ipMode {
+	case "":
+		p.ipMode = ipFull
+	case ipFull, ipTruncate, ipDrop:
+	case ipHash:
+		p.hashKey = []byte(hashKey)
+		if hashKey == "" {
+			p.hashKey = make([]byte, 32)
+			rand.Read(p.hashKey)
+		}
+	default:
+		return nil, fmt.Errorf("IP address mode %q: want full, hash, truncate or drop", ipMode)
+	}
+	if retentionDays != "" {
+		days, err := parseDays(retentionDays, 0)
+		if err != nil {
+			return nil, err
+		}
+		p.retention = time.Duration(days) * 24 * time.Hour
+	}
+	return p, nil
+}
+
+// IP returns a client IP address as it may be kept. It is safe to call on
+// a nil *Privacy, which keeps addresses in full.
+func (p *Privacy) IP(ip string) string {
+	if p == nil || ip == "" {
+		return ip
+	}
+	switch p.ipMode {
+	case ipHash:
+		mac := hmac.New(sha256.New, p.hashKey)
+		mac.Write([]byte(ip))
+		return "h:" + hex.EncodeToString(mac.Sum(nil))[:16]
+	case ipTruncate:
+		addr, err := netip.ParseAddr(ip)
+		if err != nil {
+			return ""
+		}
+		bits := 48
+		if addr.Unmap().Is4() {
+			addr, bits = addr.Unmap(), 24
+		}
+		prefix, _ := addr.Prefix(bits)
+		return prefix.Addr().String()
+	case ipDrop:
+		return ""
+	default:
+		return ip
+	}
+}
+
+// ForwardedFor returns an X-Forwarded-For header as it may be kept: as
+// sent when addresses are kept in full, otherwise not at all
+func (p *Privacy) ForwardedFor(header string) string {
+	if p == nil || p.ipMode == ipFull {
+		return header
+	}
+	return ""
+}
+
+// Tracks reports whether a request may be counted in analytics. It is safe
+// to call on a nil *Privacy, which tracks everything.
+func (p *Privacy) Tracks(r *http.Request) bool {
+	if p == nil {
+		return true
+	}
+	if !p.analytics {
+		return false
+	}
+	return !p.honorDNT || !doNotTrack(r)
+}
+
+// anonIP returns the request's client IP address as it may be kept
+func (s *Server) anonIP(r *http.Request) string {
+	return s.privacy.IP(clientIP(r))
+}
+
+// Purge drops analytics and IP addresses older than the retention window:
+// missing-shortcut counts not seen since, and IP addresses in the audit log
+// and in suggestions waiting for review
+func (p *Privacy) Purge(s *Server, now time.Time) {
+	if p == nil || p.retention == 0 {
+		return
+	}
+	cutoff := now.Add(-p.retention)
+	if s.misses != nil {
+		if n, err := s.misses.PurgeBefore(cutoff); err != nil {
+			log.Printf("Warning: Could not purge missing shortcuts: %v", err)
+		} else if n > 0 {
+			log.Printf("Purged %d missing shortcuts last seen before %s", n, cutoff.Format(time.DateOnly))
+		}
+	}
+	if s.auditLog != nil {
+		if n, err := s.auditLog.ScrubIPs(cutoff); err != nil {
+			log.Printf("Warning: Could not purge IP addresses from the audit log: %v", err)
+		} else if n > 0 {
+			log.Printf("Purged IP addresses from %d audit log entries before %s", n, cutoff.Format(time.DateOnly))
+		}
+	}
+	if s.proposals != nil {
+		if err := s.proposals.ScrubIPs(cutoff); err != nil {
+			log.Printf("Warning: Could not purge IP addresses from suggestions: %v", err)
+		}
+	}
+}
+
+// PurgeJob returns the background job purging expired data at each
+// interval, starting straight away
+func (p *Privacy) PurgeJob(s *Server, interval time.Duration) Job {
+	return Job{Name: "purge_expired_data", Every: interval, RunAtStart: true, LeaderOnly: true, Run: func() error {
+		if s.maintenance.Active() {
+			return nil
+		}
+		p.Purge(s, time.Now())
+		return nil
+	}}
+}
+
+// ScrubIPs removes IP addresses from entries made before cutoff, keeping
+// the entries themselves. It returns how many entries were scrubbed.
+// This is the only time the audit log is rewritten.
+func (al *AuditLog) ScrubIPs(cutoff time.Time) (int, error) {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+
+	file, err := os.Open(al.filePath)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	var out []byte
+	scrubbed := 0
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 16<<20)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		var entry AuditEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return 0, err
+		}
+		if entry.Time.Before(cutoff) && (entry.IP != "" || entry.ForwardedFor != "") {
+			entry.IP, entry.ForwardedFor = "", ""
+			if line, err = json.Marshal(entry); err != nil {
+				return 0, err
+			}
+			scrubbed++
+		}
+		out = append(append(out, line...), '\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	if scrubbed == 0 {
+		return 0, nil
+	}
+
+	// Swap in the scrubbed copy and carry on appending to it
+	tmp := al.filePath + ".tmp"
+	if err := os.WriteFile(tmp, out, 0600); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmp, al.filePath); err != nil {
+		return 0, err
+	}
+	reopened, err := os.OpenFile(al.filePath, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return 0, err
+	}
+	al.file.Close()
+	al.file = reopened
+	return scrubbed, nil
+}
+
+// PurgeBefore forgets missing shortcuts last tried before cutoff,
+// returning how many were forgotten
+func (ms *MissStore) PurgeBefore(cutoff time.Time) (int, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	purged := 0
+	for key, miss := range ms.misses {
+		if miss.LastSeen.Before(cutoff) {
+			delete(ms.misses, key)
+			purged++
+		}
+	}
+	if purged == 0 {
+		return 0, nil
+	}
+	return purged, ms.save()
+}
+
+// ScrubIPs removes IP addresses from suggestions made before cutoff
+func (ps *ProposalStore) ScrubIPs(cutoff time.Time) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	// Copied, as List shares the slice
+	proposals := slices.Clone(ps.proposals)
+	changed := false
+	for i, p := range proposals {
+		if p.ProposedAt.Before(cutoff) && p.IP != "" {
+			proposals[i].IP = ""
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	ps.proposals = proposals
+	return ps.save()
+}
+
+// doNotTrack reports whether a request asks not to be tracked
+func doNotTrack(r *http.Request) bool {
+	return strings.TrimSpace(r.Header.Get("DNT")) == "1" || strings.TrimSpace(r.Header.Get("Sec-GPC")) == "1"
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrivacyIPAddresses(t *testing.T) {
+	tests := []struct {
+		mode, ip, want string
+	}{
+		{"", "192.0.2.7", "192.0.2.7"},
+		{"full", "2001:db8::1", "2001:db8::1"},
+		{"truncate", "192.0.2.7", "192.0.2.0"},
+		{"truncate", "::ffff:192.0.2.7", "192.0.2.0"},
+		{"truncate", "2001:db8:1:2:3::1", "2001:db8:1::"},
+		{"truncate", "not an address", ""},
+		{"drop", "192.0.2.7", ""},
+	}
+	for _, tt := range tests {
+		p, err := NewPrivacy("", tt.mode, "", "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := p.IP(tt.ip); got != tt.want {
+			t.Errorf("%s: IP(%q) = %q, want %q", tt.mode, tt.ip, got, tt.want)
+		}
+	}
+
+	// Hashes are stable for one key and differ between keys
+	p, _ := NewPrivacy("", "hash", "secret", "", "")
+	other, _ := NewPrivacy("", "hash", "other", "", "")
+	hashed := p.IP("192.0.2.7")
+	if !strings.HasPrefix(hashed, "h:") || strings.Contains(hashed, "192") || hashed != p.IP("192.0.2.7") {
+		t.Errorf("IP hashed to %q", hashed)
+	}
+	if hashed == p.IP("192.0.2.8") || hashed == other.IP("192.0.2.7") {
+		t.Error("different addresses or keys hashed alike")
+	}
+	if got := p.ForwardedFor("192.0.2.7, 198.51.100.1"); got != "" {
+		t.Errorf("ForwardedFor = %q, want it dropped", got)
+	}
+
+	for _, bad := range [][]string{{"", "anonymize", "", "", ""}, {"", "", "", "", "a month"}} {
+		if _, err := NewPrivacy(bad[0], bad[1], bad[2], bad[3], bad[4]); err == nil {
+			t.Errorf("NewPrivacy(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestPrivacyTracking(t *testing.T) {
+	s := newTestServer(t, Link{Shortcut: "wiki", URL: "https://wiki.example.com"})
+	follow := func(path string, header ...string) {
+		r := httptest.NewRequest("GET", path, nil)
+		r.Header.Set("Referer", "https://mail.google.com/")
+		if len(header) == 2 {
+			r.Header.Set(header[0], header[1])
+		}
+		s.handleHome(httptest.NewRecorder(), r)
+	}
+
+	var err error
+	if s.privacy, err = NewPrivacy("", "", "", "true", ""); err != nil {
+		t.Fatal(err)
+	}
+	follow("/wiki", "DNT", "1")
+	follow("/wiki", "Sec-GPC", "1")
+	follow("/roadmap", "DNT", "1")
+	link, _ := s.store.Get("", "wiki")
+	if link.Clicks != 2 || len(link.Referrers) != 0 || len(link.Clients) != 0 {
+		t.Errorf("with Do Not Track: clicks %d, referrers %v, clients %v; want 2 clicks and no breakdown", link.Clicks, link.Referrers, link.Clients)
+	}
+	if misses := s.misses.Top("", 10); len(misses) != 0 {
+		t.Errorf("with Do Not Track: misses = %+v", misses)
+	}
+
+	follow("/wiki")
+	if link, _ = s.store.Get("", "wiki"); link.Referrers["Gmail"] != 1 {
+		t.Errorf("without Do Not Track: referrers = %v", link.Referrers)
+	}
+
+	if s.privacy, err = NewPrivacy("false", "", "", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	follow("/wiki")
+	follow("/roadmap")
+	if link, _ = s.store.Get("", "wiki"); link.Clicks != 4 || link.Referrers["Gmail"] != 1 {
+		t.Errorf("with analytics off: clicks %d, referrers %v; want 4 clicks and the same breakdown", link.Clicks, link.Referrers)
+	}
+	if misses := s.misses.Top("", 10); len(misses) != 0 {
+		t.Errorf("with analytics off: misses = %+v", misses)
+	}
+}
+
+func TestPrivacyPurge(t *testing.T) {
+	s := newTestServer(t)
+	var err error
+	if s.auditLog, err = OpenAuditLog(filepath.Join(t.TempDir(), "audit.jsonl")); err != nil {
+		t.Fatal(err)
+	}
+	if s.privacy, err = NewPrivacy("", "", "", "", "30"); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC()
+	old, recent := now.AddDate(0, 0, -40), now.AddDate(0, 0, -10)
+	s.auditLog.Append(
+		AuditEntry{Time: old, Actor: "alice@example.com", IP: "192.0.2.7", ForwardedFor: "198.51.100.1", Action: auditCreate, Shortcut: "wiki"},
+		AuditEntry{Time: recent, Actor: "bob@example.com", IP: "192.0.2.8", Action: auditCreate, Shortcut: "ci"},
+	)
+	s.misses.Record("", "roadmap", old)
+	s.misses.Record("", "oncall", recent)
+
+	s.privacy.Purge(s, now)
+
+	entries, err := s.auditLog.Query(auditQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("audit log has %d entries after purging, want 2", len(entries))
+	}
+	for _, entry := range entries {
+		scrubbed := entry.IP == "" && entry.ForwardedFor == ""
+		if scrubbed != (entry.Shortcut == "wiki") || entry.Actor == "" {
+			t.Errorf("entry after purging: %+v", entry)
+		}
+	}
+	if misses := s.misses.Top("", 10); len(misses) != 1 || misses[0].Shortcut != "oncall" {
+		t.Errorf("misses after purging = %+v, want just oncall", misses)
+	}
+
+	// The log is still appended to after being rewritten
+	s.auditLog.Append(AuditEntry{Time: now, Action: auditDelete, Shortcut: "ci"})
+	if entries, _ = s.auditLog.Query(auditQuery{}); len(entries) != 3 {
+		t.Errorf("audit log has %d entries after appending, want 3", len(entries))
+	}
+}
+
+func TestPrivacyAccessLog(t *testing.T) {
+	s := newTestServer(t, Link{Shortcut: "wiki", URL: "https://wiki.example.com"})
+	s.privacy, _ = NewPrivacy("", "truncate", "", "", "")
+	var out bytes.Buffer
+	s.accessLog = slog.New(slog.NewJSONHandler(&out, nil))
+
+	r := httptest.NewRequest("GET", "/wiki", nil)
+	r.RemoteAddr = "192.0.2.7:4321"
+	s.logRequests(http.HandlerFunc(s.handleHome)).ServeHTTP(httptest.NewRecorder(), r)
+	if logged := out.String(); !strings.Contains(logged, `"ip":"192.0.2.0"`) || strings.Contains(logged, "192.0.2.7") {
+		t.Errorf("access log = %s, want the truncated address", logged)
+	}
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxProposals caps the moderation queue, and maxProposalsPerIP how
+	// much of it one address can fill, so the open form can't be used to
+	// flood it
+	maxProposals      = 500
+	maxProposalsPerIP = 5
+)
+
+// errTooManyProposals is returned when the moderation queue, or the
+// proposer's share of it, is full
+var errTooManyProposals = errors.New("too many proposals waiting for review")
+
+// Proposal is a link suggested by someone who can't add links themselves,
+// waiting for an admin to approve or reject it
+type Proposal struct {
+	ID         string    `json:"id"`
+	Link       Link      `json:"link"`
+	Note       string    `json:"note,omitempty"`        // why it's useful, for the moderator
+	ProposedBy string    `json:"proposed_by,omitempty"` // empty when not signed in
+	IP         string    `json:"ip"`
+	ProposedAt time.Time `json:"proposed_at"`
+}
+
+// ProposalStore is the moderation queue of proposed links, persisted as
+// JSON alongside the links
+type ProposalStore struct {
+	mu        sync.RWMutex
+	proposals []Proposal
+	filePath  string
+}
+
+// NewProposalStore creates a proposal store backed by filePath; call Load
+// to read it
+func NewProposalStore(filePath string) *ProposalStore {
+	return &ProposalStore{filePath: filePath}
+}
+
+// Load reads proposals from the JSON file. A missing file means none.
+func (ps *ProposalStore) Load() error {
+	data, err := os.ReadFile(ps.filePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var proposals []Proposal
+	if err := json.Unmarshal(data, &proposals); err != nil {
+		return err
+	}
+
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.proposals = proposals
+	return nil
+}
+
+// save writes proposals to the JSON file; the caller must hold ps.mu
+func (ps *ProposalStore) save() error {
+	data, err := json.MarshalIndent(ps.proposals, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(ps.filePath, data, 0600)
+}
+
+// Add queues a proposal, giving it an ID
+func (ps *ProposalStore) Add(p Proposal) (Proposal, error) {
+	id := make([]byte, 8)
+	rand.Read(id)
+	p.ID = hex.EncodeToString(id)
+	p.ProposedAt = time.Now().UTC()
+
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	fromIP := 0
+	for _, queued := range ps.proposals {
+		if queued.IP == p.IP {
+			fromIP++
+		}
+	}
+	if len(ps.proposals) >= maxProposals || fromIP >= maxProposalsPerIP {
+		return Proposal{}, errTooManyProposals
+	}
+
+	ps.proposals = append(ps.proposals, p)
+	if err := ps.save(); err != nil {
+		ps.proposals = ps.proposals[:len(ps.proposals)-1]
+		return Proposal{}, err
+	}
+	return p, nil
+}
+
+// List returns the queued proposals, oldest first
+func (ps *ProposalStore) List() []Proposal {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+	return slices.Clone(ps.proposals)
+}
+
+// Get returns the proposal with id
+func (ps *ProposalStore) Get(id string) (Proposal, bool) {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+	i := slices.IndexFunc(ps.proposals, func(p Proposal) bool { return p.ID == id })
+	if i < 0 {
+		return Proposal{}, false
+	}
+	return ps.proposals[i], true
+}
+
+// Remove takes a proposal out of the queue, reporting whether it was there
+func (ps *ProposalStore) Remove(id string) (bool, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	i := slices.IndexFunc(ps.proposals, func(p Proposal) bool { return p.ID == id })
+	if i < 0 {
+		return false, nil
+	}
+	ps.proposals = slices.Delete(slices.Clone(ps.proposals), i, i+1)
+	return true, ps.save()
+}
+
+// handleProposeForm serves GET /propose, where anyone can suggest a link
+func (s *Server) handleProposeForm(w http.ResponseWriter, r *http.Request) {
+	form := url.Values{"shortcut": {r.URL.Query().Get("shortcut")}}
+	s.renderPropose(w, r, http.StatusOK, form, nil)
+}
+
+// handlePropose serves POST /propose, queueing the suggested link for an
+// admin to review
+func (s *Server) handlePropose(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	namespace := s.hosts.Namespace(r)
+	shortcut := strings.TrimSpace(r.PostFormValue("shortcut"))
+	rawURL := strings.TrimSpace(r.PostFormValue("url"))
+	fieldErrors := map[string]string{}
+	switch _, taken := s.store.Get(namespace, shortcut); {
+	case shortcut == "":
+		fieldErrors["shortcut"] = "Shortcut is required"
+	case s.blocklist.Blocked(shortcut):
+		fieldErrors["shortcut"] = fmt.Sprintf("Shortcut %q is not allowed, please choose another", shortcut)
+	case taken:
+		fieldErrors["shortcut"] = "That shortcut is already taken, please choose another"
+	}
+	normalized, err := s.urls.Load().Normalize(rawURL)
+	switch {
+	case rawURL == "":
+		fieldErrors["url"] = "URL is required"
+	case err != nil:
+		fieldErrors["url"] = err.Error()
+	}
+	if len(fieldErrors) > 0 {
+		s.renderPropose(w, r, http.StatusBadRequest, r.PostForm, fieldErrors)
+		return
+	}
+
+	proposal, err := s.proposals.Add(Proposal{
+		Link: Link{
+			Shortcut:    shortcut,
+			URL:         normalized,
+			Description: strings.TrimSpace(r.PostFormValue("description")),
+			Namespace:   namespace,
+		},
+		Note:       strings.TrimSpace(r.PostFormValue("note")),
+		ProposedBy: s.currentUser(r),
+		IP:         s.anonIP(r),
+	})
+	if errors.Is(err, errTooManyProposals) {
+		s.renderPropose(w, r, http.StatusTooManyRequests, r.PostForm,
+			map[string]string{"shortcut": "Too many suggestions are waiting for review. Please try again later."})
+		return
+	}
+	if err != nil {
+		log.Printf("Saving proposal %q: %v", shortcut, err)
+		s.showError(w, r, http.StatusInternalServerError, "Your suggestion couldn't be saved. Please try again later.")
+		return
+	}
+
+	log.Printf("Link %q proposed for review (%s)", shortcut, proposal.ID)
+	http.Redirect(w, r, "/propose?sent=1", http.StatusSeeOther)
+}
+
+// renderPropose renders the suggestion form filled in from form, with any
+// validation errors beside their fields
+func (s *Server) renderPropose(w http.ResponseWriter, r *http.Request, status int, form url.Values, fieldErrors map[string]string) {
+	data := struct {
+		Prefix      string
+		Theme       *Theme
+		Maintenance *maintenanceState
+		CSRFToken   string
+		Lang        *translator
+		Sent        bool
+		Form        url.Values
+		Errors      map[string]string
+	}{
+		Prefix:      s.hosts.Prefix(r),
+		Theme:       s.theme.Load(),
+		Maintenance: s.maintenance.State(),
+		CSRFToken:   s.csrfToken(w, r),
+		Lang:        translatorFor(w, r),
+		Sent:        r.URL.Query().Get("sent") != "",
+		Form:        form,
+		Errors:      fieldErrors,
+	}
+
+	writePage(w, status, "propose.html", data, "Suggestion form unavailable")
+}
+
+// handleProposals serves GET /admin/proposals, the moderation queue
+func (s *Server) handleProposals(w http.ResponseWriter, r *http.Request) {
+	data := struct {
+		Prefix      string
+		Theme       *Theme
+		Maintenance *maintenanceState
+		CSRFToken   string
+		Lang        *translator
+		Done        string
+		Proposals   []Proposal
+	}{
+		Prefix:      s.hosts.Prefix(r),
+		Theme:       s.theme.Load(),
+		Maintenance: s.maintenance.State(),
+		CSRFToken:   s.csrfToken(w, r),
+		Lang:        translatorFor(w, r),
+		Done:        r.URL.Query().Get("done"),
+		Proposals:   s.proposals.List(),
+	}
+
+	writePage(w, http.StatusOK, "proposals.html", data, "Moderation queue unavailable")
+}
+
+// handleApproveProposal serves POST /admin/proposals/{id}/approve, adding
+// the proposed link as the approving admin's
+func (s *Server) handleApproveProposal(w http.ResponseWriter, r *http.Request) {
+	proposal, ok := s.proposals.Get(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Proposal not found", http.StatusNotFound)
+		return
+	}
+
+	link := proposal.Link
+	if _, taken := s.store.Get(link.Namespace, link.Shortcut); taken {
+		done := fmt.Sprintf("%s has been taken since it was proposed, reject the proposal instead", link.Shortcut)
+		http.Redirect(w, r, "/admin/proposals?done="+url.QueryEscape(done), http.StatusSeeOther)
+		return
+	}
+
+	link.CreatedBy = s.currentUser(r)
+	span := startSpan(r, "LinkStore.Add", linkAttrs(link.Namespace, link.Shortcut)...)
+	err := s.store.Add(link)
+	span.End()
+	if err != nil {
+		log.Printf("Saving link %q: %v", link.Shortcut, err)
+		http.Error(w, "Failed to save link", http.StatusInternalServerError)
+		return
+	}
+	saved, _ := s.store.Get(link.Namespace, link.Shortcut)
+	s.audit(r, nil, auditLink(saved, true))
+	if _, err := s.proposals.Remove(proposal.ID); err != nil {
+		log.Printf("Removing proposal %s: %v", proposal.ID, err)
+	}
+
+	http.Redirect(w, r, "/admin/proposals?done="+url.QueryEscape("Approved "+link.Shortcut), http.StatusSeeOther)
+}
+
+// handleRejectProposal serves POST /admin/proposals/{id}/reject, dropping
+// the proposal
+func (s *Server) handleRejectProposal(w http.ResponseWriter, r *http.Request) {
+	proposal, ok := s.proposals.Get(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Proposal not found", http.StatusNotFound)
+		return
+	}
+	if _, err := s.proposals.Remove(proposal.ID); err != nil {
+		http.Error(w, "Failed to save proposals", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/admin/proposals?done="+url.QueryEscape("Rejected "+proposal.Link.Shortcut), http.StatusSeeOther)
+}
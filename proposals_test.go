@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestProposals(t *testing.T) {
+	s := newTestServer(t, Link{Shortcut: "wiki", URL: "https://wiki.example.com"})
+	s.editors, _ = NewEditAuth("alice:secret", "")
+	s.admins = NewAdminAuth("", "admin-token")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /propose", s.handleProposeForm)
+	mux.HandleFunc("POST /propose", s.handlePropose)
+	mux.HandleFunc("GET /admin/proposals", s.requireAdmin(s.handleProposals))
+	mux.HandleFunc("POST /admin/proposals/{id}/approve", s.requireAdmin(s.handleApproveProposal))
+	mux.HandleFunc("POST /admin/proposals/{id}/reject", s.requireAdmin(s.handleRejectProposal))
+	do := func(method, path, ip string, form url.Values, admin bool) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+		r.RemoteAddr = ip + ":1234"
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if admin {
+			r.Header.Set("Authorization", "Bearer admin-token")
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w
+	}
+	propose := func(ip, shortcut, rawURL string) *httptest.ResponseRecorder {
+		return do("POST", "/propose", ip, url.Values{"shortcut": {shortcut}, "url": {rawURL}, "note": {"for onboarding"}}, false)
+	}
+
+	// Anyone may propose a link, which doesn't go live
+	if w := propose("192.0.2.1", "docs", "https://docs.example.com"); w.Code != http.StatusSeeOther {
+		t.Fatalf("propose: status %d: %s", w.Code, w.Body)
+	}
+	if _, ok := s.store.Get("", "docs"); ok {
+		t.Fatal("proposed link went live without review")
+	}
+
+	for _, tc := range []struct{ shortcut, url, want string }{
+		{"", "https://x.example.com", "Shortcut is required"},
+		{"wiki", "https://x.example.com", "already taken"},
+		{"x", "", "URL is required"},
+	} {
+		if w := propose("192.0.2.1", tc.shortcut, tc.url); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), tc.want) {
+			t.Errorf("propose %q %q: status %d, want 400 with %q", tc.shortcut, tc.url, w.Code, tc.want)
+		}
+	}
+
+	// One address can only fill so much of the queue
+	for i := range maxProposalsPerIP {
+		propose("192.0.2.2", "spam"+strings.Repeat("x", i), "https://spam.example.com")
+	}
+	if w := propose("192.0.2.2", "spam", "https://spam.example.com"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("flooding the queue: status %d, want 429", w.Code)
+	}
+
+	// Only admins moderate
+	if w := do("GET", "/admin/proposals", "192.0.2.1", nil, false); w.Code != http.StatusUnauthorized {
+		t.Errorf("queue without admin: status %d, want 401", w.Code)
+	}
+	w := do("GET", "/admin/proposals", "192.0.2.1", nil, true)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "for onboarding") {
+		t.Errorf("queue: status %d", w.Code)
+	}
+
+	proposals := s.proposals.List()
+	docs, spam := proposals[0], proposals[1]
+	if w := do("POST", "/admin/proposals/"+docs.ID+"/approve", "192.0.2.1", nil, false); w.Code != http.StatusUnauthorized {
+		t.Errorf("approving without admin: status %d, want 401", w.Code)
+	}
+	if w := do("POST", "/admin/proposals/"+docs.ID+"/approve", "192.0.2.9", nil, true); w.Code != http.StatusSeeOther {
+		t.Errorf("approve: status %d", w.Code)
+	}
+	if link, ok := s.store.Get("", "docs"); !ok || link.URL != "https://docs.example.com" {
+		t.Errorf("approved link = %+v, %v", link, ok)
+	}
+	if w := do("POST", "/admin/proposals/"+spam.ID+"/reject", "192.0.2.9", nil, true); w.Code != http.StatusSeeOther {
+		t.Errorf("reject: status %d", w.Code)
+	}
+	if _, ok := s.store.Get("", spam.Link.Shortcut); ok {
+		t.Error("rejected link went live")
+	}
+	if n := len(s.proposals.List()); n != maxProposalsPerIP-1 {
+		t.Errorf("%d proposals left, want %d", n, maxProposalsPerIP-1)
+	}
+	if w := do("POST", "/admin/proposals/"+docs.ID+"/approve", "192.0.2.9", nil, true); w.Code != http.StatusNotFound {
+		t.Errorf("approving twice: status %d, want 404", w.Code)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// peerKey is the context key for the address a request's connection came
+// from, kept when RemoteAddr is replaced with the client behind a proxy
+type peerKey struct{}
+
+// forwarded applies X-Forwarded-For, X-Forwarded-Proto and X-Forwarded-Host
+// from the proxies in GOLINKS_TRUSTED_PROXIES, so logs, rate limits and
+// absolute URLs see the client and the address it visited rather than the
+// proxy. RemoteAddr becomes the client's address, Host the forwarded host
+// and X-Forwarded-Proto a single scheme. Without trusted proxies nothing is
+// rewritten, and from anyone else the headers that would be believed
+// further in are dropped. The proxy on the other end of a Unix socket is
+// always trusted.
+func (s *Server) forwarded(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = r.WithContext(context.WithValue(r.Context(), peerKey{}, r.RemoteAddr))
+		if len(s.proxies) == 0 && !unixPeer(r.RemoteAddr) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !s.trustedProxy(clientIP(r)) {
+			r.Header.Del("X-Forwarded-Proto")
+			r.Header.Del("X-Forwarded-Host")
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if ip := s.forwardedClient(r.Header.Values("X-Forwarded-For")); ip != "" {
+			r.RemoteAddr = net.JoinHostPort(ip, "0")
+		}
+		// The proxy nearest the client adds the first value
+		if host := firstForwarded(r.Header.Get("X-Forwarded-Host")); host != "" {
+			r.Host = host
+		}
+		if proto := strings.ToLower(firstForwarded(r.Header.Get("X-Forwarded-Proto"))); proto != "" {
+			r.Header.Set("X-Forwarded-Proto", proto)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// forwardedClient returns the client address in X-Forwarded-For headers:
+// the last one not added by a trusted proxy, since anything before it could
+// have been sent by the client itself
+func (s *Server) forwardedClient(headers []string) string {
+	var hops []string
+	for _, header := range headers {
+		hops = append(hops, splitList(header)...)
+	}
+	client := ""
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(hops[i])
+		if err != nil {
+			// Not an address, so nothing further left can be trusted
+			break
+		}
+		client = addr.Unmap().String()
+		if !s.trustedProxy(client) {
+			break
+		}
+	}
+	return client
+}
+
+// firstForwarded returns the first of a comma-separated forwarded header's
+// values
+func firstForwarded(header string) string {
+	first, _, _ := strings.Cut(header, ",")
+	return strings.TrimSpace(first)
+}
+
+// unixPeer reports whether a connection's remote address is that of a
+// Unix socket, which only local processes allowed by its permissions can
+// connect to
+func unixPeer(addr string) bool {
+	return addr == "@" || strings.HasPrefix(addr, "/")
+}
+
+// trustedProxy reports whether ip is one of GOLINKS_TRUSTED_PROXIES, or
+// the peer on a Unix socket
+func (s *Server) trustedProxy(ip string) bool {
+	if unixPeer(ip) {
+		return true
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range s.proxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// peerIP returns the address a request's connection came from, which is
+// the proxy's for requests through a trusted proxy
+func peerIP(r *http.Request) string {
+	if peer, ok := r.Context().Value(peerKey{}).(string); ok {
+		if ip, _, err := net.SplitHostPort(peer); err == nil {
+			return ip
+		}
+		return peer
+	}
+	return clientIP(r)
+}
+
+// baseURL returns the scheme and host a request was made to, such as
+// https://go.example.com, for building absolute links back to go-links
+func baseURL(r *http.Request) string {
+	if isHTTPS(r) {
+		return "https://" + r.Host
+	}
+	return "http://" + r.Host
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestForwardedHeaders(t *testing.T) {
+	s := newTestServer(t)
+	s.userHeader = "X-Forwarded-User"
+	var err error
+	if s.proxies, err = parseTrustedProxies("10.0.0.0/8"); err != nil {
+		t.Fatal(err)
+	}
+
+	var got *http.Request
+	handler := s.forwarded(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { got = r }))
+	request := func(remoteAddr, forwardedFor string) *http.Request {
+		r := httptest.NewRequest("GET", "http://127.0.0.1:3001/qr/wiki", nil)
+		r.RemoteAddr = remoteAddr
+		r.Header.Set("X-Forwarded-For", forwardedFor)
+		r.Header.Set("X-Forwarded-Proto", "HTTPS, http")
+		r.Header.Set("X-Forwarded-Host", "go.example.com")
+		r.Header.Set("X-Forwarded-User", "alice@example.com")
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+		return got
+	}
+
+	// Addresses the client sent before the proxies' own are ignored
+	r := request("10.0.0.1:4321", "198.51.100.1, 203.0.113.9, 10.0.0.2")
+	if ip := clientIP(r); ip != "203.0.113.9" {
+		t.Errorf("client through proxies = %s, want 203.0.113.9", ip)
+	}
+	if base := baseURL(r); base != "https://go.example.com" {
+		t.Errorf("baseURL through a proxy = %s, want https://go.example.com", base)
+	}
+	if user := s.currentUser(r); user != "alice@example.com" {
+		t.Errorf("user through a proxy = %q, want alice@example.com", user)
+	}
+
+	r = request("203.0.113.9:4321", "198.51.100.1")
+	if ip := clientIP(r); ip != "203.0.113.9" {
+		t.Errorf("client sending its own X-Forwarded-For = %s, want 203.0.113.9", ip)
+	}
+	if base := baseURL(r); base != "http://127.0.0.1:3001" {
+		t.Errorf("baseURL from a client = %s, want its forwarded headers ignored", base)
+	}
+	if user := s.currentUser(r); user != "" {
+		t.Errorf("user from a client = %q, want the header ignored", user)
+	}
+
+	// A garbled hop stops the search at the last address known good
+	if ip := clientIP(request("10.0.0.1:4321", "203.0.113.9, unknown, 10.0.0.2")); ip != "10.0.0.2" {
+		t.Errorf("client behind a garbled hop = %s, want 10.0.0.2", ip)
+	}
+
+	// Without trusted proxies the connection is believed
+	s.proxies = nil
+	if ip := clientIP(request("10.0.0.1:4321", "203.0.113.9")); ip != "10.0.0.1" {
+		t.Errorf("client without trusted proxies = %s, want 10.0.0.1", ip)
+	}
+}
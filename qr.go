@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// handleQR serves GET /api/qr/{shortcut} as a PNG QR code for the link's
+// full URL on this host, for dropping into slides and posters. The optional
+// size parameter sets the image width in pixels.
+func (s *Server) handleQR(w http.ResponseWriter, r *http.Request) {
+	shortcut := r.PathValue("shortcut")
+	if _, exists := s.store.Get(s.hosts.Namespace(r), shortcut); !exists {
+		http.Error(w, "Link not found", http.StatusNotFound)
+		return
+	}
+
+	size := 256
+	if n, err := strconv.Atoi(r.URL.Query().Get("size")); err == nil {
+		size = min(max(n, 64), 1024)
+	}
+
+	// Phones scanning the code don't have the short hostname configured,
+	// so encode the host exactly as the request reached us
+	png, err := qrcode.Encode(baseURL(r)+"/"+shortcut, qrcode.Medium, size)
+	if err != nil {
+		http.Error(w, "Failed to generate QR code", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(png)
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// quotaWindow is the period rate limits count links over
+const quotaWindow = time.Hour
+
+// quota limits how many links someone may have created, and how many they
+// may add per quotaWindow; zero means no limit
+type quota struct {
+	links int
+	rate  int
+}
+
+// Quotas stops one user, or a runaway script, from flooding go-links with
+// new links. Everyone gets the default quota except users with an override;
+// admins have none. Editing existing links is never limited.
+type Quotas struct {
+	defaults  quota
+	overrides map[string]quota // by lowercased user
+
+	mu     sync.Mutex
+	recent map[string][]time.Time // when each user (or address) added links
+}
+
+// NewQuotas sets up link quotas: links is how many links each user may
+// have created, rate how many they may add per hour, and overrides a
+// comma-separated list of user=links, user=links/rate or user=unlimited
+// entries for users who need more (or less). With nothing set quotas are
+// disabled.
+func NewQuotas(links, rate, overrides string) (*Quotas, error) {
+	if links == "" && rate == "" && overrides == "" {
+		return nil, nil
+	}
+
+	q := &Quotas{overrides: make(map[string]quota), recent: make(map[string][]time.Time)}
+	var err error
+	if q.defaults.links, err = parseLimit(links); err != nil {
+		return nil, fmt.Errorf("link quota: %w", err)
+	}
+	if q.defaults.rate, err = parseLimit(rate); err != nil {
+		return nil, fmt.Errorf("link rate: %w", err)
+	}
+
+	for _, entry := range splitList(overrides) {
+		user, limits, ok := strings.Cut(entry, "=")
+		user = strings.ToLower(strings.TrimSpace(user))
+		if !ok || user == "" {
+			return nil, fmt.Errorf("override %q is not user=limit", entry)
+		}
+		override := q.defaults
+		if limits = strings.TrimSpace(limits); limits == "unlimited" {
+			override = quota{}
+		} else {
+			links, rate, hasRate := strings.Cut(limits, "/")
+			if override.links, err = parseLimit(links); err == nil && hasRate {
+				override.rate, err = parseLimit(rate)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("override for %s: %w", user, err)
+			}
+		}
+		q.overrides[user] = override
+	}
+	return q, nil
+}
+
+// parseLimit parses a limit, empty or 0 for none
+func parseLimit(value string) (int, error) {
+	if value = strings.TrimSpace(value); value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%q is not a number of links", value)
+	}
+	return n, nil
+}
+
+// For returns user's quota
+func (q *Quotas) For(user string) quota {
+	if override, ok := q.overrides[strings.ToLower(user)]; ok {
+		return override
+	}
+	return q.defaults
+}
+
+// Take counts a new link against key's rate limit, reporting whether it is
+// allowed and, when not, how long until it would be
+func (q *Quotas) Take(key string, rate int) (time.Duration, bool) {
+	if rate <= 0 {
+		return 0, true
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := time.Now()
+	recent := q.recent[key]
+	for len(recent) > 0 && now.Sub(recent[0]) >= quotaWindow {
+		recent = recent[1:]
+	}
+	if len(recent) >= rate {
+		q.recent[key] = recent
+		return quotaWindow - now.Sub(recent[0]), false
+	}
+	q.recent[key] = append(recent, now)
+	return 0, true
+}
+
+// withinQuota reports whether the request may add a new link, rendering
+// the homepage with the reason when it may not
+func (s *Server) withinQuota(w http.ResponseWriter, r *http.Request) bool {
+	status, message := s.quotaRefusal(w, r)
+	if status == 0 {
+		return true
+	}
+	s.renderHomepage(w, r, status, r.PostForm, map[string]string{"shortcut": message})
+	return false
+}
+
+// quotaRefusal returns the status and reason refusing the request a new
+// link, setting Retry-After when it should wait, or 0 if it may add one.
+// Signed-in users are limited by name; anonymous visitors, when editing is
+// open to them, share the rate limit by address.
+func (s *Server) quotaRefusal(w http.ResponseWriter, r *http.Request) (int, string) {
+	if s.quotas == nil || s.isAdmin(r) {
+		return 0, ""
+	}
+
+	user := s.currentUser(r)
+	key := user
+	if key == "" {
+		key = "ip:" + clientIP(r)
+	}
+	status, message, wait := s.userQuotaRefusal(user, key)
+	if wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+	}
+	return status, message
+}
+
+// userQuotaRefusal returns the status and reason refusing user a new link,
+// rate limited by key, and how long they should wait, or 0 if they may add
+// one. It's quotaRefusal for users known other than by the request, such
+// as from Slack.
+func (s *Server) userQuotaRefusal(user, key string) (int, string, time.Duration) {
+	if s.quotas == nil {
+		return 0, "", 0
+	}
+	limits := s.quotas.For(user)
+	if user != "" && limits.links > 0 && s.store.CountCreatedBy(user) >= limits.links {
+		log.Printf("%s reached their quota of %d links", user, limits.links)
+		return http.StatusForbidden, "You've reached your limit on links. Delete some you no longer need, or ask an admin to raise it.", 0
+	}
+	if wait, ok := s.quotas.Take(key, limits.rate); !ok {
+		log.Printf("Rate limited new links from %s", key)
+		return http.StatusTooManyRequests, "You're adding links too quickly. Please wait a while and try again.", wait
+	}
+	return 0, "", 0
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestNewQuotas(t *testing.T) {
+	if q, err := NewQuotas("", "", ""); q != nil || err != nil {
+		t.Errorf("NewQuotas with nothing set = %v, %v, want disabled", q, err)
+	}
+
+	q, err := NewQuotas("100", "20", "ci-bot@example.com=5000/500, Alice@example.com=unlimited, bob@example.com=10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for user, want := range map[string]quota{
+		"carol@example.com":  {100, 20},
+		"ci-bot@example.com": {5000, 500},
+		"alice@example.com":  {},
+		"bob@example.com":    {10, 20},
+	} {
+		if got := q.For(user); got != want {
+			t.Errorf("For(%q) = %+v, want %+v", user, got, want)
+		}
+	}
+
+	for _, config := range [][3]string{
+		{"lots", "", ""},
+		{"", "-1", ""},
+		{"", "", "alice@example.com"},
+		{"", "", "alice@example.com=10/often"},
+	} {
+		if _, err := NewQuotas(config[0], config[1], config[2]); err == nil {
+			t.Errorf("NewQuotas%q succeeded, want an error", config)
+		}
+	}
+}
+
+func TestQuotas(t *testing.T) {
+	s := newTestServer(t,
+		Link{Shortcut: "one", URL: "https://one.example.com", CreatedBy: "alice@example.com"},
+		Link{Shortcut: "two", URL: "https://two.example.com", CreatedBy: "Alice@example.com"},
+	)
+	s.userHeader = "X-User"
+	s.proxies = httptestProxy
+	s.admins = NewAdminAuth("root@example.com", "")
+	s.quotas, _ = NewQuotas("2", "3", "bob@example.com=0/1")
+
+	add := func(user, shortcut string) *httptest.ResponseRecorder {
+		form := url.Values{"shortcut": {shortcut}, "url": {"https://" + shortcut + ".example.com"}}
+		r := httptest.NewRequest("POST", "/add", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if user != "" {
+			r.Header.Set("X-User", user)
+		}
+		w := httptest.NewRecorder()
+		s.handleAdd(w, r)
+		return w
+	}
+
+	// alice has already created her two links, but may still edit them
+	if w := add("alice@example.com", "three"); w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "limit on links") {
+		t.Errorf("alice over quota: status %d", w.Code)
+	}
+	if w := add("alice@example.com", "one"); w.Code != http.StatusSeeOther {
+		t.Errorf("alice editing: status %d, want 303", w.Code)
+	}
+
+	// bob has no link limit but may only add one link an hour
+	if w := add("bob@example.com", "b1"); w.Code != http.StatusSeeOther {
+		t.Errorf("bob's first link: status %d, want 303", w.Code)
+	}
+	w := add("bob@example.com", "b2")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("bob's second link: status %d, Retry-After %q, want 429 with Retry-After", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	// Anonymous visitors share a rate limit per address
+	for i, want := range []int{http.StatusSeeOther, http.StatusSeeOther, http.StatusSeeOther, http.StatusTooManyRequests} {
+		if w := add("", "anon"+string(rune('a'+i))); w.Code != want {
+			t.Errorf("anonymous link %d: status %d, want %d", i+1, w.Code, want)
+		}
+	}
+
+	// Admins aren't limited
+	for _, shortcut := range []string{"r1", "r2", "r3", "r4"} {
+		if w := add("root@example.com", shortcut); w.Code != http.StatusSeeOther {
+			t.Errorf("admin adding %s: status %d, want 303", shortcut, w.Code)
+		}
+	}
+}
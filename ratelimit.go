@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateLimitMessage explains why a request was refused for coming too fast
+const rateLimitMessage = "Too many requests. Please slow down and try again shortly."
+
+// rateLimit is a token bucket's refill rate, in requests per second, and
+// how many requests it holds
+type rateLimit struct {
+	rate  float64
+	burst float64
+}
+
+// bucket is one client's token bucket
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// RateLimiter stops misbehaving scripts from hammering the store. Changes
+// and API requests take a token from the bucket of the signed-in user, or
+// of the client's address for anonymous requests; buckets refill steadily
+// and requests finding theirs empty get 429 Too Many Requests.
+type RateLimiter struct {
+	anonymous rateLimit
+	users     rateLimit
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// NewRateLimiter sets up rate limiting from limits like 60/m: perAddress
+// for anonymous requests, by address, and perUser for signed-in users,
+// by name, defaulting to perAddress. burst is how many requests may come
+// at once, by default the number in the limit. With no limits set rate
+// limiting is disabled.
+func NewRateLimiter(perAddress, perUser, burst string) (*RateLimiter, error) {
+	if perAddress == "" && perUser == "" {
+		return nil, nil
+	}
+	if perUser == "" {
+		perUser = perAddress
+	}
+
+	rl := &RateLimiter{buckets: make(map[string]*bucket)}
+	var err error
+	if rl.anonymous, err = parseRateLimit(perAddress, burst); err != nil {
+		return nil, fmt.Errorf("rate limit: %w", err)
+	}
+	if rl.users, err = parseRateLimit(perUser, burst); err != nil {
+		return nil, fmt.Errorf("user rate limit: %w", err)
+	}
+	return rl, nil
+}
+
+// parseRateLimit parses a limit of requests per second, minute or hour,
+// such as 10/s, 60/m or 1000/h, with burst overriding the bucket size.
+// An empty limit is unlimited.
+func parseRateLimit(value, burst string) (rateLimit, error) {
+	if value = strings.TrimSpace(value); value == "" {
+		return rateLimit{}, nil
+	}
+	count, unit, _ := strings.Cut(value, "/")
+	n, err := strconv.Atoi(strings.TrimSpace(count))
+	if err != nil || n <= 0 {
+		return rateLimit{}, fmt.Errorf("%q is not a number of requests like 60/m", value)
+	}
+	per := map[string]time.Duration{"s": time.Second, "m": time.Minute, "h": time.Hour}[strings.TrimSpace(unit)]
+	if per == 0 {
+		return rateLimit{}, fmt.Errorf("%q should be per second (/s), minute (/m) or hour (/h)", value)
+	}
+
+	limit := rateLimit{rate: float64(n) / per.Seconds(), burst: float64(n)}
+	if burst = strings.TrimSpace(burst); burst != "" {
+		b, err := strconv.Atoi(burst)
+		if err != nil || b <= 0 {
+			return rateLimit{}, fmt.Errorf("burst %q is not a number of requests", burst)
+		}
+		limit.burst = float64(b)
+	}
+	return limit, nil
+}
+
+// Allow takes a token from key's bucket, reporting whether there was one
+// and, when not, how long until there will be
+func (rl *RateLimiter) Allow(key string, limit rateLimit, now time.Time) (time.Duration, bool) {
+	if limit.rate == 0 {
+		return 0, true
+	}
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.sweep(now)
+	b, ok := rl.buckets[key]
+	if !ok {
+		b = &bucket{tokens: limit.burst, last: now}
+		rl.buckets[key] = b
+	}
+	b.tokens = min(limit.burst, b.tokens+now.Sub(b.last).Seconds()*limit.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / limit.rate * float64(time.Second)), false
+	}
+	b.tokens--
+	return 0, true
+}
+
+// sweep forgets buckets idle long enough to have refilled, at most once a
+// minute, so clients that have gone away don't hold memory
+func (rl *RateLimiter) sweep(now time.Time) {
+	if now.Sub(rl.lastSweep) < time.Minute {
+		return
+	}
+	rl.lastSweep = now
+	slowest := min(rl.anonymous.rate, rl.users.rate)
+	if slowest == 0 {
+		slowest = max(rl.anonymous.rate, rl.users.rate)
+	}
+	idle := time.Duration(max(rl.anonymous.burst, rl.users.burst) / slowest * float64(time.Second))
+	for key, b := range rl.buckets {
+		if now.Sub(b.last) > idle {
+			delete(rl.buckets, key)
+		}
+	}
+}
+
+// rateLimited reports whether a request counts against rate limits:
+// anything that changes state, and all API requests
+func rateLimited(r *http.Request) bool {
+	if r.URL.Path == peerChangesPath {
+		// Peers send every change, and can't be told to slow down
+		return false
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return strings.HasPrefix(r.URL.Path, "/api/")
+	}
+	return true
+}
+
+// limitRate refuses requests over the rate limit (GOLINKS_RATE_LIMIT and
+// GOLINKS_USER_RATE_LIMIT) with 429 and a Retry-After header. Browsers
+// submitting a form get an error page, other clients the message as text.
+func (s *Server) limitRate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limiter := s.rateLimiter.Load()
+		if limiter == nil || !rateLimited(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key, limit := "ip:"+clientIP(r), limiter.anonymous
+		if user := s.currentUser(r); user != "" {
+			key, limit = "user:"+strings.ToLower(user), limiter.users
+		}
+		wait, ok := limiter.Allow(key, limit, time.Now())
+		if ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		log.Printf("Rate limited %s %s from %s", r.Method, r.URL.Path, key)
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		if r.Header.Get("Sec-Fetch-Mode") == "navigate" {
+			s.showError(w, r, http.StatusTooManyRequests, rateLimitMessage)
+			return
+		}
+		http.Error(w, rateLimitMessage, http.StatusTooManyRequests)
+	})
+}
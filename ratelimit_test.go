@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewRateLimiter(t *testing.T) {
+	if rl, err := NewRateLimiter("", "", "5"); rl != nil || err != nil {
+		t.Errorf("NewRateLimiter with no limits = %v, %v, want disabled", rl, err)
+	}
+	rl, err := NewRateLimiter("60/m", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rl.users != rl.anonymous || rl.anonymous.rate != 1 || rl.anonymous.burst != 60 {
+		t.Errorf("60/m = %+v for addresses and %+v for users, want 1/s with a burst of 60 for both", rl.anonymous, rl.users)
+	}
+	for _, limits := range [][3]string{{"60", "", ""}, {"60/d", "", ""}, {"x/m", "", ""}, {"0/s", "", ""}, {"10/s", "", "-1"}} {
+		if _, err := NewRateLimiter(limits[0], limits[1], limits[2]); err == nil {
+			t.Errorf("NewRateLimiter%q succeeded, want an error", limits)
+		}
+	}
+}
+
+func TestRateLimiterRefills(t *testing.T) {
+	rl, _ := NewRateLimiter("2/s", "", "")
+	now := time.Now()
+	for i := range 2 {
+		if _, ok := rl.Allow("ip:192.0.2.1", rl.anonymous, now); !ok {
+			t.Errorf("request %d within the burst refused", i+1)
+		}
+	}
+	wait, ok := rl.Allow("ip:192.0.2.1", rl.anonymous, now)
+	if ok || wait != 500*time.Millisecond {
+		t.Errorf("request over the burst = %v, %v, want refused for 500ms", wait, ok)
+	}
+	if _, ok := rl.Allow("ip:192.0.2.2", rl.anonymous, now); !ok {
+		t.Error("another address shared the bucket")
+	}
+	if _, ok := rl.Allow("ip:192.0.2.1", rl.anonymous, now.Add(500*time.Millisecond)); !ok {
+		t.Error("request after refilling refused")
+	}
+
+	// Idle buckets are forgotten
+	rl.Allow("ip:192.0.2.3", rl.anonymous, now.Add(time.Hour))
+	if len(rl.buckets) != 1 {
+		t.Errorf("%d buckets after an hour, want only the new one", len(rl.buckets))
+	}
+}
+
+func TestLimitRate(t *testing.T) {
+	s := newTestServer(t)
+	s.userHeader = "X-Forwarded-Email"
+	s.proxies = httptestProxy
+	limiter, err := NewRateLimiter("1/m", "2/m", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.rateLimiter.Store(limiter)
+	handler := s.limitRate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	request := func(method, path, user string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, nil)
+		r.RemoteAddr = "192.0.2.1:4321"
+		if user != "" {
+			r.Header.Set("X-Forwarded-Email", user)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	// Browsing and redirects never count
+	for range 3 {
+		if w := request("GET", "/wiki", ""); w.Code != http.StatusOK {
+			t.Fatalf("redirect: status %d, want 200", w.Code)
+		}
+	}
+	if w := request("GET", "/api/search", ""); w.Code != http.StatusOK {
+		t.Errorf("first API request: status %d, want 200", w.Code)
+	}
+	w := request("POST", "/add", "")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "60" {
+		t.Errorf("second anonymous request: status %d, Retry-After %q, want 429 after 60s", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	// Signed-in users from the same address have their own, larger bucket
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		if w := request("DELETE", "/api/links/wiki", "alice@example.com"); w.Code != want {
+			t.Errorf("alice's request %d: status %d, want %d", i+1, w.Code, want)
+		}
+	}
+}
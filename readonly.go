@@ -0,0 +1,55 @@
+package main
+
+import "net/http"
+
+// readOnlyMessage explains why a change was refused in read-only mode
+const readOnlyMessage = "This go-links server is read-only, so links can't be changed here."
+
+// readOnlyAllowed are the state-changing endpoints still served in
+// read-only mode: signing in and out, reloading the links file so a
+// replica can pick up copies of it, and Slack's lookups
+var readOnlyAllowed = map[string]bool{
+	"/ldap/login":    true,
+	"/saml/acs":      true,
+	"/auth/logout":   true,
+	"/admin/reload":  true,
+	"/slack/command": true, // refuses to add links itself
+	peerChangesPath:  true, // reads changes made elsewhere
+}
+
+// changesRefused reports whether changes are refused, in read-only mode or
+// during maintenance
+func (s *Server) changesRefused() bool {
+	return s.readOnly || s.maintenance.Active()
+}
+
+// rejectWrites refuses state-changing requests with 403 while the server is
+// read-only (GOLINKS_READ_ONLY), such as on a disaster-recovery replica or
+// a demo, and with 503 during maintenance, when admins may still end it.
+// Redirects and browsing are unaffected. Browsers submitting a form get an
+// error page, other clients the message as text.
+func (s *Server) rejectWrites(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		status, message := http.StatusForbidden, readOnlyMessage
+		switch {
+		case s.readOnly && !readOnlyAllowed[r.URL.Path]:
+		case s.maintenance.Active() && !readOnlyAllowed[r.URL.Path] && r.URL.Path != "/admin/maintenance":
+			status, message = http.StatusServiceUnavailable, maintenanceMessage
+		default:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if r.Header.Get("Sec-Fetch-Mode") == "navigate" {
+			s.showError(w, r, status, message)
+			return
+		}
+		http.Error(w, message, status)
+	})
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReadOnly(t *testing.T) {
+	s := newTestServer(t, Link{Shortcut: "wiki", URL: "https://wiki.example.com"})
+	s.readOnly = true
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.handleHome)
+	mux.HandleFunc("/add", s.requireEditor(s.handleAdd))
+	mux.HandleFunc("DELETE /api/links/{shortcut...}", s.requireLinkChanger(s.handleDelete))
+	mux.HandleFunc("POST /admin/reload", s.handleAdminReload)
+	handler := s.rejectWrites(mux)
+	do := func(method, path string, header http.Header) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader("shortcut=docs&url=https://docs.example.com"))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		for name, values := range header {
+			r.Header[name] = values
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := do("GET", "/wiki", nil); w.Code != http.StatusFound {
+		t.Errorf("redirect: status %d, want 302", w.Code)
+	}
+	if link, _ := s.store.Get("", "wiki"); link.Clicks != 0 {
+		t.Errorf("clicks = %d, want none recorded", link.Clicks)
+	}
+	w := do("GET", "/", nil)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "read-only") || strings.Contains(w.Body.String(), `action="/add"`) {
+		t.Errorf("homepage: status %d, want the read-only notice and no add form", w.Code)
+	}
+
+	w = do("POST", "/add", nil)
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), readOnlyMessage) {
+		t.Errorf("add: status %d, body %q", w.Code, w.Body)
+	}
+	if w := do("POST", "/add", http.Header{"Sec-Fetch-Mode": {"navigate"}}); w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "<html") {
+		t.Errorf("add from a browser: status %d, want an error page", w.Code)
+	}
+	if w := do("DELETE", "/api/links/wiki", nil); w.Code != http.StatusForbidden {
+		t.Errorf("delete: status %d, want 403", w.Code)
+	}
+	if _, ok := s.store.Get("", "wiki"); !ok {
+		t.Error("wiki was deleted")
+	}
+	if w := do("POST", "/admin/reload", nil); w.Code != http.StatusSeeOther {
+		t.Errorf("reload: status %d, want 303", w.Code)
+	}
+
+	s.readOnly = false
+	if w := do("POST", "/add", nil); w.Code != http.StatusSeeOther {
+		t.Errorf("add when writable: status %d, want 303", w.Code)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// RegionResolver works out which region a request comes from, so links can
+// send staff in different countries or offices to different destinations
+type RegionResolver struct {
+	header   string
+	networks []regionNetwork
+}
+
+// regionNetwork maps a client IP range to a region code
+type regionNetwork struct {
+	prefix netip.Prefix
+	region string
+}
+
+// NewRegionResolver creates a resolver from a header name (e.g. "CF-IPCountry")
+// and a comma-separated list of "cidr=region" pairs. Either may be empty.
+func NewRegionResolver(header, networks string) (*RegionResolver, error) {
+	rr := &RegionResolver{header: strings.TrimSpace(header)}
+
+	for _, entry := range strings.Split(networks, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		cidr, region, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("region network %q must be in the form cidr=region", entry)
+		}
+
+		prefix, err := netip.ParsePrefix(strings.TrimSpace(cidr))
+		if err != nil {
+			return nil, fmt.Errorf("region network %q: %w", entry, err)
+		}
+
+		rr.networks = append(rr.networks, regionNetwork{
+			prefix: prefix.Masked(),
+			region: normalizeRegion(region),
+		})
+	}
+
+	return rr, nil
+}
+
+// Regions returns the candidate regions for a request in priority order:
+// the region header first, then the region derived from the client IP
+func (rr *RegionResolver) Regions(r *http.Request) []string {
+	var regions []string
+
+	if rr.header != "" {
+		if region := normalizeRegion(r.Header.Get(rr.header)); region != "" {
+			regions = append(regions, region)
+		}
+	}
+
+	if len(rr.networks) > 0 {
+		if addr, err := netip.ParseAddr(clientIP(r)); err == nil {
+			addr = addr.Unmap()
+			for _, network := range rr.networks {
+				if network.prefix.Contains(addr) {
+					regions = append(regions, network.region)
+					break
+				}
+			}
+		}
+	}
+
+	return regions
+}
+
+// parseRegions parses "region=url" lines from the add form, passing each
+// URL through normalize
+func parseRegions(value string, normalize func(string) (string, error)) (map[string]string, error) {
+	var regions map[string]string
+
+	for _, line := range strings.Split(value, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		region, url, ok := strings.Cut(line, "=")
+		region = normalizeRegion(region)
+		url = strings.TrimSpace(url)
+		if !ok || region == "" || url == "" {
+			return nil, fmt.Errorf("regional override %q must be in the form region=url", line)
+		}
+
+		url, err := normalize(url)
+		if err != nil {
+			return nil, fmt.Errorf("regional override for %s: %w", region, err)
+		}
+
+		if regions == nil {
+			regions = make(map[string]string)
+		}
+		regions[region] = url
+	}
+
+	return regions, nil
+}
+
+// normalizeRegion makes region codes case-insensitive
+func normalizeRegion(region string) string {
+	return strings.ToLower(strings.TrimSpace(region))
+}
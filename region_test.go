@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestNewRegionResolver(t *testing.T) {
+	for _, tc := range []struct {
+		networks string
+		ok       bool
+	}{
+		{"", true},
+		{"10.1.0.0/16=eu, 10.2.0.0/16=US ,", true},
+		{"2001:db8::/32=apac", true},
+		{"10.1.0.0/16", false},
+		{"10.1.0.0/33=eu", false},
+		{"10.1.0/16=eu", false},
+		{"eu=10.1.0.0/16", false},
+	} {
+		if _, err := NewRegionResolver("", tc.networks); (err == nil) != tc.ok {
+			t.Errorf("NewRegionResolver(%q): %v, want ok %v", tc.networks, err, tc.ok)
+		}
+	}
+}
+
+func TestRegions(t *testing.T) {
+	rr, err := NewRegionResolver(" CF-IPCountry ", "10.1.2.3/16=eu, 10.0.0.0/8=us, 2001:db8::/32=APAC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name, remoteAddr, header string
+		want                     []string
+	}{
+		{"nothing known", "192.0.2.1:1234", "", nil},
+		{"header", "192.0.2.1:1234", " DE ", []string{"de"}},
+		{"first matching network", "10.1.5.6:1234", "", []string{"eu"}},
+		{"wider network", "10.9.5.6:1234", "", []string{"us"}},
+		{"header before network", "10.1.5.6:1234", "GB", []string{"gb", "eu"}},
+		{"IPv6", "[2001:db8::1]:1234", "", []string{"apac"}},
+		{"IPv4-mapped IPv6", "[::ffff:10.1.5.6]:1234", "", []string{"eu"}},
+		{"address without a port", "10.1.5.6", "", []string{"eu"}},
+		{"unparseable address", "@pipe", "", nil},
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tc.remoteAddr
+		if tc.header != "" {
+			r.Header.Set("CF-IPCountry", tc.header)
+		}
+		if got := rr.Regions(r); !slices.Equal(got, tc.want) {
+			t.Errorf("%s: Regions = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+
+	// Without a header configured, the header is ignored
+	rr, _ = NewRegionResolver("", "")
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("CF-IPCountry", "DE")
+	if got := rr.Regions(r); got != nil {
+		t.Errorf("Regions with nothing configured = %q, want none", got)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+)
+
+// liveSettingNames are the settings that take effect when the configuration
+// is reloaded; the rest need a restart
+var liveSettingNames = []string{
+	"log_level", "rate_limit", "user_rate_limit", "rate_burst",
+	"allowed_schemes", "allowed_domains", "upgrade_https",
+	"logo_url", "accent_color",
+}
+
+// liveSettings are the parts of the configuration that can change while
+// running: the log level, rate limits, where links may point and branding
+type liveSettings struct {
+	logLevel    slog.Level
+	rateLimiter *RateLimiter
+	urls        *URLValidator
+	theme       *Theme
+}
+
+// readLiveSettings reads the settings that can change while running from
+// the environment
+func readLiveSettings() (*liveSettings, error) {
+	live := &liveSettings{}
+	if level := os.Getenv("GOLINKS_LOG_LEVEL"); level != "" {
+		if err := live.logLevel.UnmarshalText([]byte(level)); err != nil {
+			return nil, fmt.Errorf("log level %q: %v", level, err)
+		}
+	}
+	var err error
+	if live.rateLimiter, err = NewRateLimiter(os.Getenv("GOLINKS_RATE_LIMIT"), os.Getenv("GOLINKS_USER_RATE_LIMIT"), os.Getenv("GOLINKS_RATE_BURST")); err != nil {
+		return nil, err
+	}
+	live.urls = NewURLValidator(
+		os.Getenv("GOLINKS_ALLOWED_SCHEMES"),
+		os.Getenv("GOLINKS_ALLOWED_DOMAINS"),
+		os.Getenv("GOLINKS_UPGRADE_HTTPS") != "false",
+	)
+	if live.theme, err = NewTheme(os.Getenv("GOLINKS_LOGO_URL"), os.Getenv("GOLINKS_ACCENT_COLOR")); err != nil {
+		return nil, err
+	}
+	return live, nil
+}
+
+// applyLiveSettings makes live the settings in use
+func (s *Server) applyLiveSettings(live *liveSettings) {
+	logLevel.Set(live.logLevel)
+	s.rateLimiter.Store(live.rateLimiter)
+	s.urls.Store(live.urls)
+	s.theme.Store(live.theme)
+}
+
+// currentSettings returns the settings set in the environment
+func currentSettings() map[string]string {
+	values := make(map[string]string)
+	for _, name := range settings {
+		if value, ok := os.LookupEnv(settingEnv(name)); ok {
+			values[name] = value
+		}
+	}
+	return values
+}
+
+// setSettings replaces the settings in the environment with values
+func setSettings(values map[string]string) {
+	for _, name := range settings {
+		if value, ok := values[name]; ok {
+			os.Setenv(settingEnv(name), value)
+		} else {
+			os.Unsetenv(settingEnv(name))
+		}
+	}
+}
+
+// reloadConfig reads the configuration file and flags in args again, on
+// top of the environment go-links started with (initial), and applies the
+// settings that can change while running. An invalid configuration is
+// rejected and the current one kept. Other settings that changed are
+// reported as needing a restart.
+func (s *Server) reloadConfig(args []string, initial map[string]string) error {
+	previous := currentSettings()
+	setSettings(initial)
+	if _, err := loadConfig(args, io.Discard); err != nil {
+		setSettings(previous)
+		return err
+	}
+	live, err := readLiveSettings()
+	if err != nil {
+		setSettings(previous)
+		return err
+	}
+	s.applyLiveSettings(live)
+
+	var restart []string
+	for _, name := range settings {
+		if !slices.Contains(liveSettingNames, name) && os.Getenv(settingEnv(name)) != previous[name] {
+			restart = append(restart, settingEnv(name))
+		}
+	}
+	if len(restart) > 0 {
+		log.Printf("Warning: Restart go-links to apply changes to %s", strings.Join(restart, ", "))
+	}
+	return nil
+}
+
+// reloadOnSIGHUP reloads the configuration whenever the process gets
+// SIGHUP, such as from systemctl reload
+func (s *Server) reloadOnSIGHUP(args []string, initial map[string]string) {
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	for range hangups {
+		// systemd, with Type=notify-reload, waits until we're ready again
+		notifySystemd(reloadingState())
+		if err := s.reloadConfig(args, initial); err != nil {
+			log.Printf("Warning: Kept the current configuration, the new one is invalid: %v", err)
+			notifySystemd("READY=1\nSTATUS=Kept the current configuration, the new one is invalid")
+			continue
+		}
+		log.Printf("Reloaded configuration")
+		notifySystemd("READY=1\nSTATUS=Reloaded configuration")
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReloadConfig(t *testing.T) {
+	initial := currentSettings()
+	t.Cleanup(func() {
+		setSettings(initial)
+		logLevel.Set(slog.LevelInfo)
+	})
+	unsetenv(t, "GOLINKS_CONFIG", "GOLINKS_LOG_LEVEL", "GOLINKS_RATE_LIMIT", "GOLINKS_ACCENT_COLOR",
+		"GOLINKS_ALLOWED_DOMAINS", "GOLINKS_READ_ONLY")
+	t.Setenv("GOLINKS_LOGO_URL", "https://example.com/logo.png")
+	startup := currentSettings()
+
+	path := filepath.Join(t.TempDir(), "go-links.yaml")
+	os.WriteFile(path, []byte("log_level: warn\nrate_limit: 10/m\naccent_color: teal\nlogo_url: https://example.com/other.png\nallowed_domains: [example.com]\n"), 0644)
+	args := []string{"-config", path}
+	s := newTestServer(t)
+	if err := s.reloadConfig(args, startup); err != nil {
+		t.Fatal(err)
+	}
+	if logLevel.Level() != slog.LevelWarn {
+		t.Errorf("log level after reload = %v, want WARN", logLevel.Level())
+	}
+	if s.rateLimiter.Load() == nil {
+		t.Error("rate limiting is still off after reload")
+	}
+	// The environment still wins over the file
+	if theme := s.theme.Load(); theme.Accent != "teal" || theme.LogoURL != "https://example.com/logo.png" {
+		t.Errorf("theme after reload = %+v, want a teal accent and the logo from the environment", theme)
+	}
+	if _, err := s.urls.Load().Normalize("https://elsewhere.org"); err == nil {
+		t.Error("the new allowlist isn't applied")
+	}
+
+	// Settings dropped from the file go back to how they started
+	os.WriteFile(path, []byte("accent_color: '#0a7'\nread_only: true\n"), 0644)
+	if err := s.reloadConfig(args, startup); err != nil {
+		t.Fatal(err)
+	}
+	if logLevel.Level() != slog.LevelInfo || s.rateLimiter.Load() != nil || s.theme.Load().Accent != "#0a7" {
+		t.Errorf("after removing settings: level %v, rate limiter %v, accent %q", logLevel.Level(), s.rateLimiter.Load(), s.theme.Load().Accent)
+	}
+
+	// A bad configuration is rejected whole, keeping the current one
+	for _, bad := range []string{"accent_color: 'url(evil)'\nlog_level: debug\n", "rate_limit: lots\n", "not_a_setting: 1\n"} {
+		os.WriteFile(path, []byte(bad), 0644)
+		if err := s.reloadConfig(args, startup); err == nil {
+			t.Errorf("reloading %q succeeded", bad)
+		}
+		if logLevel.Level() != slog.LevelInfo || s.theme.Load().Accent != "#0a7" || os.Getenv("GOLINKS_ACCENT_COLOR") != "#0a7" {
+			t.Errorf("after rejecting %q: level %v, accent %q", bad, logLevel.Level(), s.theme.Load().Accent)
+		}
+	}
+}
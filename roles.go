@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Roles decide what a request may do:
+//
+//   - viewers resolve shortcuts and browse links
+//   - editors also add links, and change and delete their own
+//   - admins change any link, including in reserved namespaces, and use
+//     the admin console
+//
+// While edit access isn't restricted (see mayEdit) everyone is at least an
+// editor and may change any link, as before roles existed. On top of
+// roles, the ACL hands shortcut spaces to users and groups: only they (and
+// admins) may add and change links there, whatever their role.
+const (
+	roleViewer = "viewer"
+	roleEditor = "editor"
+	roleAdmin  = "admin"
+)
+
+// roleOf returns the role of whoever is making a request
+func (s *Server) roleOf(r *http.Request) string {
+	switch {
+	case s.isAdmin(r):
+		return roleAdmin
+	case s.mayEdit(r):
+		return roleEditor
+	default:
+		return roleViewer
+	}
+}
+
+// mayAdd reports whether a request may add a link with shortcut in
+// namespace: admins anywhere, those the ACL grants its space to, and
+// editors outside reserved namespaces and ACL spaces
+func (s *Server) mayAdd(r *http.Request, namespace, shortcut string) bool {
+	role := s.roleOf(r)
+	if role == roleAdmin {
+		return true
+	}
+	if rule, ok := s.acl.Rule(namespace, shortcut); ok {
+		return rule.grants(s.currentUser(r), s.currentGroups(r))
+	}
+	return role == roleEditor && !s.reserved[namespace]
+}
+
+// mayChange reports whether a request may edit or delete link. Admins may
+// change any link, and those the ACL grants a space to any link in it.
+// Otherwise editors may change links in unreserved namespaces that they
+// created or own, directly or through a group, and links nobody has
+// claimed, such as those added before sign-in was set up.
+func (s *Server) mayChange(r *http.Request, link Link) bool {
+	if !s.mayAdd(r, link.Namespace, link.Shortcut) {
+		return false
+	}
+	if s.roleOf(r) == roleAdmin {
+		return true
+	}
+	if _, ok := s.acl.Rule(link.Namespace, link.Shortcut); ok {
+		return true
+	}
+	if !s.editRestricted() || (link.CreatedBy == "" && link.Owner == "") {
+		return true
+	}
+	return s.owns(r, link)
+}
+
+// owns reports whether a request comes from link's creator or owner, or
+// from a member of the group owning it
+func (s *Server) owns(r *http.Request, link Link) bool {
+	if ownedBy(link, s.currentUser(r)) {
+		return true
+	}
+	group, ok := ownerGroup(link)
+	return ok && inGroup(s.currentGroups(r), group)
+}
+
+// ownedBy reports whether user created link or is named as its owner
+func ownedBy(link Link, user string) bool {
+	return user != "" && (strings.EqualFold(link.CreatedBy, user) || strings.EqualFold(link.Owner, user))
+}
+
+// parseReservedNamespaces parses a comma-separated list of namespaces only
+// admins may change links in, where "default" is the default namespace
+func parseReservedNamespaces(config string) map[string]bool {
+	reserved := make(map[string]bool)
+	for _, namespace := range splitList(config) {
+		if namespace == "default" {
+			namespace = ""
+		}
+		reserved[namespace] = true
+	}
+	return reserved
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestRoles(t *testing.T) {
+	s := newTestServer(t,
+		Link{Shortcut: "wiki", URL: "https://wiki.example.com", CreatedBy: "alice@example.com"},
+		Link{Shortcut: "ci", URL: "https://ci.example.com", CreatedBy: "dave@example.com", Owner: "bob@example.com"},
+		Link{Shortcut: "old", URL: "https://old.example.com"},
+		Link{Shortcut: "handbook", URL: "https://handbook.example.com", Namespace: "official"},
+	)
+	s.hosts, _ = NewHostMap("go=,official")
+	s.userHeader = "X-User"
+	s.proxies = httptestProxy
+	s.signInToEdit = true
+	s.admins = NewAdminAuth("root@example.com", "")
+	s.reserved = parseReservedNamespaces("official")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /add", s.requireEditor(s.handleAdd))
+	mux.HandleFunc("PUT /api/links/{shortcut...}", s.requireLinkChanger(s.handleUpdate))
+	mux.HandleFunc("DELETE /api/links/{shortcut...}", s.requireLinkChanger(s.handleDelete))
+	do := func(method, host, path, user string, form url.Values) int {
+		r := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+		r.Host = host
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if user != "" {
+			r.Header.Set("X-User", user)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w.Code
+	}
+	edit := url.Values{"url": {"https://new.example.com"}}
+
+	for _, tc := range []struct {
+		user, role string
+	}{
+		{"", roleViewer},
+		{"carol@example.com", roleEditor},
+		{"root@example.com", roleAdmin},
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		if tc.user != "" {
+			r.Header.Set("X-User", tc.user)
+		}
+		if got := s.roleOf(r); got != tc.role {
+			t.Errorf("roleOf(%q) = %s, want %s", tc.user, got, tc.role)
+		}
+	}
+
+	for _, tc := range []struct {
+		name, method, host, path, user string
+		status                         int
+	}{
+		{"viewer", "PUT", "go", "/api/links/old", "", http.StatusUnauthorized},
+		{"someone else's link", "PUT", "go", "/api/links/wiki", "bob@example.com", http.StatusForbidden},
+		{"someone else's link", "DELETE", "go", "/api/links/ci", "alice@example.com", http.StatusForbidden},
+		{"creator", "PUT", "go", "/api/links/wiki", "Alice@example.com", http.StatusOK},
+		{"owner", "PUT", "go", "/api/links/ci", "bob@example.com", http.StatusOK},
+		{"unclaimed link", "PUT", "go", "/api/links/old", "carol@example.com", http.StatusOK},
+		{"reserved namespace", "PUT", "official", "/api/links/handbook", "alice@example.com", http.StatusForbidden},
+		{"admin in reserved namespace", "PUT", "official", "/api/links/handbook", "root@example.com", http.StatusOK},
+		{"admin", "DELETE", "go", "/api/links/wiki", "root@example.com", http.StatusNoContent},
+	} {
+		if got := do(tc.method, tc.host, tc.path, tc.user, edit); got != tc.status {
+			t.Errorf("%s: %s %s as %q = %d, want %d", tc.name, tc.method, tc.path, tc.user, got, tc.status)
+		}
+	}
+
+	// Adding over someone else's link would change it
+	form := url.Values{"shortcut": {"ci"}, "url": {"https://mine.example.com"}}
+	if got := do("POST", "go", "/add", "carol@example.com", form); got != http.StatusForbidden {
+		t.Errorf("adding over another user's link = %d, want %d", got, http.StatusForbidden)
+	}
+	if link, _ := s.store.Get("", "ci"); link.URL != "https://new.example.com" {
+		t.Errorf("ci URL = %q, want it unchanged", link.URL)
+	}
+	form.Set("shortcut", "new")
+	if got := do("POST", "go", "/add", "carol@example.com", form); got != http.StatusSeeOther {
+		t.Errorf("adding a new link = %d, want %d", got, http.StatusSeeOther)
+	}
+}
+
+func TestBulkSkipsOthersLinks(t *testing.T) {
+	s := newTestServer(t,
+		Link{Shortcut: "a", URL: "https://a.example.com", CreatedBy: "alice@example.com"},
+		Link{Shortcut: "b", URL: "https://b.example.com", CreatedBy: "bob@example.com"},
+	)
+	s.userHeader = "X-User"
+	s.proxies = httptestProxy
+	s.signInToEdit = true
+	s.reserved = parseReservedNamespaces("official")
+
+	bulk := func(body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/api/links/bulk", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set("X-User", "alice@example.com")
+		w := httptest.NewRecorder()
+		s.handleBulk(w, r)
+		return w
+	}
+
+	w := bulk("action=move&value=official&shortcut=a")
+	if !strings.Contains(w.Body.String(), `"updated":0,"forbidden":["a"]`) {
+		t.Errorf("move to reserved namespace = %s, want a left alone", w.Body)
+	}
+
+	w = bulk("action=delete&shortcut=a&shortcut=b")
+	if !strings.Contains(w.Body.String(), `"updated":1,"forbidden":["b"]`) {
+		t.Errorf("bulk delete = %s, want b left alone", w.Body)
+	}
+	if _, exists := s.store.Get("", "b"); !exists {
+		t.Error("deleted another user's link")
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"crypto/rsa"
+	"crypto/tls"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/crewjam/saml"
+	"github.com/crewjam/saml/samlsp"
+)
+
+// SAML signs users in with a SAML 2.0 identity provider, as a service
+// provider with its metadata at /saml/metadata and its assertion consumer
+// service at /saml/acs
+type SAML struct {
+	sp        saml.ServiceProvider
+	attribute string // assertion attribute naming the user; NameID when empty
+}
+
+// samlLogin is what the assertion consumer service needs to accept the
+// response to a sign-in this browser started
+type samlLogin struct {
+	RequestID  string `json:"request_id"`
+	RelayState string `json:"relay_state"`
+	Next       string `json:"next"`
+}
+
+// NewSAML sets up a service provider at rootURL (e.g.
+// https://go.example.com) for the identity provider whose metadata is at
+// idpMetadata, a URL or file. certFile and keyFile hold the PEM certificate
+// and RSA key the service provider signs requests with. attribute names the
+// assertion attribute holding the user's identity, such as "email"; empty
+// uses the subject's NameID. An empty rootURL disables SAML.
+func NewSAML(ctx context.Context, rootURL, idpMetadata, certFile, keyFile, attribute string) (*SAML, error) {
+	if rootURL == "" {
+		return nil, nil
+	}
+	root, err := url.Parse(strings.TrimSuffix(rootURL, "/"))
+	if err != nil || (root.Scheme != "http" && root.Scheme != "https") || root.Host == "" {
+		return nil, fmt.Errorf("root URL %q must be an http(s) URL", rootURL)
+	}
+	if idpMetadata == "" || certFile == "" || keyFile == "" {
+		return nil, errors.New("IdP metadata, a certificate and a key are required")
+	}
+
+	keyPair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading key pair: %w", err)
+	}
+	key, ok := keyPair.PrivateKey.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("the key must be an RSA key")
+	}
+
+	var metadata *saml.EntityDescriptor
+	if u, err := url.Parse(idpMetadata); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		metadata, err = samlsp.FetchMetadata(ctx, http.DefaultClient, *u)
+		if err != nil {
+			return nil, fmt.Errorf("fetching IdP metadata: %w", err)
+		}
+	} else {
+		data, err := os.ReadFile(idpMetadata)
+		if err != nil {
+			return nil, fmt.Errorf("reading IdP metadata: %w", err)
+		}
+		if metadata, err = samlsp.ParseMetadata(data); err != nil {
+			return nil, fmt.Errorf("parsing IdP metadata: %w", err)
+		}
+	}
+
+	return &SAML{
+		sp: saml.ServiceProvider{
+			EntityID:    root.String() + "/saml/metadata",
+			Key:         key,
+			Certificate: keyPair.Leaf,
+			MetadataURL: *root.JoinPath("saml", "metadata"),
+			AcsURL:      *root.JoinPath("saml", "acs"),
+			IDPMetadata: metadata,
+		},
+		attribute: attribute,
+	}, nil
+}
+
+// user returns the identity an assertion signs in: the configured
+// attribute, matched by name or friendly name, or else the NameID
+func (sm *SAML) user(assertion *saml.Assertion) string {
+	if sm.attribute == "" {
+		if assertion.Subject != nil && assertion.Subject.NameID != nil {
+			return strings.TrimSpace(assertion.Subject.NameID.Value)
+		}
+		return ""
+	}
+	for _, statement := range assertion.AttributeStatements {
+		for _, attr := range statement.Attributes {
+			if (attr.Name == sm.attribute || attr.FriendlyName == sm.attribute) && len(attr.Values) > 0 {
+				return strings.TrimSpace(attr.Values[0].Value)
+			}
+		}
+	}
+	return ""
+}
+
+// groups returns the groups an assertion lists in a "groups" or "memberOf"
+// attribute, matched by name or friendly name
+func (sm *SAML) groups(assertion *saml.Assertion) []string {
+	isGroups := func(name string) bool { return name == "groups" || name == "memberOf" }
+	var groups []string
+	for _, statement := range assertion.AttributeStatements {
+		for _, attr := range statement.Attributes {
+			if !isGroups(attr.Name) && !isGroups(attr.FriendlyName) {
+				continue
+			}
+			for _, value := range attr.Values {
+				groups = append(groups, groupName(value.Value))
+			}
+		}
+	}
+	return groups
+}
+
+// handleSAMLMetadata serves GET /saml/metadata, the service provider
+// metadata to register with the identity provider
+func (s *Server) handleSAMLMetadata(w http.ResponseWriter, r *http.Request) {
+	data, err := xml.MarshalIndent(s.saml.sp.Metadata(), "", "  ")
+	if err != nil {
+		http.Error(w, "Failed to encode metadata", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/samlmetadata+xml")
+	w.Write(data)
+}
+
+// handleSAMLLogin serves GET /saml/login, sending the browser to the
+// identity provider to sign in and then back to ?next=
+func (s *Server) handleSAMLLogin(w http.ResponseWriter, r *http.Request) {
+	sp := &s.saml.sp
+	req, err := sp.MakeAuthenticationRequest(sp.GetSSOBindingLocation(saml.HTTPRedirectBinding), saml.HTTPRedirectBinding, saml.HTTPPostBinding)
+	if err != nil {
+		log.Printf("Starting SAML sign-in: %v", err)
+		s.showError(w, r, http.StatusInternalServerError, "Sign-in is unavailable right now. Please try again later.")
+		return
+	}
+
+	login := samlLogin{
+		RequestID:  req.ID,
+		RelayState: randomToken(),
+		Next:       localRedirect(r.URL.Query().Get("next")),
+	}
+	redirect, err := req.Redirect(login.RelayState, sp)
+	if err != nil {
+		log.Printf("Starting SAML sign-in: %v", err)
+		s.showError(w, r, http.StatusInternalServerError, "Sign-in is unavailable right now. Please try again later.")
+		return
+	}
+
+	// The identity provider posts back from its own site, so the cookie
+	// has to be sent on cross-site requests
+	s.sessions.setCookie(w, r, loginCookie, login, loginLifetime, http.SameSiteNoneMode)
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+// handleSAMLACS serves POST /saml/acs, where the identity provider posts
+// its signed response after signing in
+func (s *Server) handleSAMLACS(w http.ResponseWriter, r *http.Request) {
+	var login samlLogin
+	if !s.sessions.readCookie(r, loginCookie, &login) || r.PostFormValue("RelayState") != login.RelayState {
+		s.showError(w, r, http.StatusBadRequest, "The sign-in took too long or was started in another browser. Please try again.")
+		return
+	}
+	s.sessions.clearCookie(w, r, loginCookie)
+
+	assertion, err := s.saml.sp.ParseResponse(r, []string{login.RequestID})
+	if err != nil {
+		var invalid *saml.InvalidResponseError
+		if errors.As(err, &invalid) {
+			err = invalid.PrivateErr
+		}
+		log.Printf("SAML sign-in failed: %v", err)
+		s.showError(w, r, http.StatusForbidden, "Sign-in failed. Check that you're using your work account and try again.")
+		return
+	}
+
+	user := s.saml.user(assertion)
+	if user == "" {
+		log.Printf("SAML sign-in failed: assertion has no %q attribute", cmp.Or(s.saml.attribute, "NameID"))
+		s.showError(w, r, http.StatusForbidden, "Sign-in failed. Check that you're using your work account and try again.")
+		return
+	}
+
+	if err := s.sessions.Start(w, r, session{User: user, Groups: s.saml.groups(assertion)}); err != nil {
+		log.Printf("Starting session for %s: %v", user, err)
+		s.showError(w, r, http.StatusInternalServerError, "Sign-in is unavailable right now. Please try again later.")
+		return
+	}
+	http.Redirect(w, r, login.Next, http.StatusSeeOther)
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"encoding/xml"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/crewjam/saml"
+)
+
+// newKeyPair returns a self-signed certificate and its key
+func newKeyPair(t *testing.T, name string) (*x509.Certificate, *rsa.PrivateKey) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+// fakeIdP is an identity provider that trusts a single service provider
+type fakeIdP struct {
+	saml.IdentityProvider
+	sp *saml.EntityDescriptor
+}
+
+func (idp *fakeIdP) GetServiceProvider(r *http.Request, id string) (*saml.EntityDescriptor, error) {
+	if idp.sp == nil || id != idp.sp.EntityID {
+		return nil, os.ErrNotExist
+	}
+	return idp.sp, nil
+}
+
+// respond answers the authentication request in loginURL by signing in a
+// user with the given attributes, returning the form to post to the ACS
+func (idp *fakeIdP) respond(t *testing.T, loginURL string, attributes ...saml.Attribute) saml.IdpAuthnRequestForm {
+	t.Helper()
+	req, err := saml.NewIdpAuthnRequest(&idp.IdentityProvider, httptest.NewRequest("GET", loginURL, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := req.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	session := &saml.Session{ID: "session", NameID: "alice-nameid", CreateTime: time.Now(), ExpireTime: time.Now().Add(time.Hour), CustomAttributes: attributes}
+	if err := (saml.DefaultAssertionMaker{}).MakeAssertion(req, session); err != nil {
+		t.Fatal(err)
+	}
+	form, err := req.PostBinding()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return form
+}
+
+func TestSAMLSignIn(t *testing.T) {
+	dir := t.TempDir()
+
+	idpCert, idpKey := newKeyPair(t, "idp.example.com")
+	idp := &fakeIdP{}
+	idp.IdentityProvider = saml.IdentityProvider{
+		Key:                     idpKey,
+		Certificate:             idpCert,
+		MetadataURL:             url.URL{Scheme: "https", Host: "idp.example.com", Path: "/metadata"},
+		SSOURL:                  url.URL{Scheme: "https", Host: "idp.example.com", Path: "/sso"},
+		ServiceProviderProvider: idp,
+	}
+	metadata, err := xml.Marshal(idp.Metadata())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spCert, spKey := newKeyPair(t, "go.example.com")
+	files := map[string][]byte{
+		"idp.xml":  metadata,
+		"cert.pem": pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: spCert.Raw}),
+		"key.pem":  pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(spKey)}),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sm, err := NewSAML(context.Background(), "https://go.example.com", filepath.Join(dir, "idp.xml"),
+		filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"), "email")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newTestServer(t)
+	s.saml = sm
+	s.sessions = NewSessions("session-secret", newMemorySessionStore())
+
+	// The IdP learns about us from our metadata
+	w := httptest.NewRecorder()
+	s.handleSAMLMetadata(w, httptest.NewRequest("GET", "/saml/metadata", nil))
+	if !strings.Contains(w.Body.String(), `Location="https://go.example.com/saml/acs"`) {
+		t.Fatalf("metadata has no ACS:\n%s", w.Body)
+	}
+	idp.sp = &saml.EntityDescriptor{}
+	if err := xml.Unmarshal(w.Body.Bytes(), idp.sp); err != nil {
+		t.Fatal(err)
+	}
+
+	// signIn starts a sign-in and posts the IdP's response back to the ACS
+	signIn := func(next string, attributes ...saml.Attribute) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.handleSAMLLogin(w, httptest.NewRequest("GET", "/saml/login?next="+url.QueryEscape(next), nil))
+		if w.Code != http.StatusFound || !strings.HasPrefix(w.Header().Get("Location"), "https://idp.example.com/sso?") {
+			t.Fatalf("login: status %d to %q", w.Code, w.Header().Get("Location"))
+		}
+		form := idp.respond(t, w.Header().Get("Location"), attributes...)
+
+		body := url.Values{"SAMLResponse": {form.SAMLResponse}, "RelayState": {form.RelayState}}
+		r := httptest.NewRequest("POST", "/saml/acs", strings.NewReader(body.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		for _, cookie := range w.Result().Cookies() {
+			if cookie.SameSite != http.SameSiteNoneMode || !cookie.Secure {
+				t.Errorf("login cookie isn't sent back on the IdP's cross-site post: %v", cookie)
+			}
+			r.AddCookie(cookie)
+		}
+		w = httptest.NewRecorder()
+		s.handleSAMLACS(w, r)
+		return w
+	}
+
+	email := saml.Attribute{Name: "email", Values: []saml.AttributeValue{{Value: "alice@example.com"}}}
+	w = signIn("/my", email)
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/my" {
+		t.Fatalf("acs: status %d to %q, body:\n%s", w.Code, w.Header().Get("Location"), w.Body)
+	}
+	r := httptest.NewRequest("GET", "/", nil)
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == sessionCookie {
+			r.AddCookie(cookie)
+		}
+	}
+	if user := s.currentUser(r); user != "alice@example.com" {
+		t.Errorf("currentUser = %q, want alice@example.com", user)
+	}
+
+	// Without the configured attribute there's nobody to sign in
+	if w := signIn("/"); w.Code != http.StatusForbidden {
+		t.Errorf("no email attribute: status %d, want %d", w.Code, http.StatusForbidden)
+	}
+
+	// Responses nobody asked for are turned away
+	w = httptest.NewRecorder()
+	s.handleSAMLACS(w, httptest.NewRequest("POST", "/saml/acs", strings.NewReader("SAMLResponse=x")))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("unsolicited response: status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestSAMLUser(t *testing.T) {
+	assertion := &saml.Assertion{
+		Subject: &saml.Subject{NameID: &saml.NameID{Value: "00u1abcd"}},
+		AttributeStatements: []saml.AttributeStatement{{Attributes: []saml.Attribute{
+			{Name: "http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress", FriendlyName: "mail", Values: []saml.AttributeValue{{Value: " bob@example.com "}}},
+		}}},
+	}
+	tests := map[string]string{
+		"": "00u1abcd",
+		"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress": "bob@example.com",
+		"mail": "bob@example.com",
+		"upn":  "",
+	}
+	for attribute, want := range tests {
+		if got := (&SAML{attribute: attribute}).user(assertion); got != want {
+			t.Errorf("user with attribute %q = %q, want %q", attribute, got, want)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// jobJitter is how far, as a fraction of the interval, runs of a job are
+// spread either side of it, so jobs started together don't stay in step
+const jobJitter = 0.1
+
+// Job is background work the scheduler runs repeatedly
+type Job struct {
+	Name       string
+	Every      time.Duration                 // run at about this interval...
+	Next       func(now time.Time) time.Time // ...or at the times this returns
+	RunAtStart bool                          // run once straight away too
+	LeaderOnly bool                          // run only on the leader, see Leadership
+	Run        func() error
+}
+
+// JobStatus is how a job has been doing, for the admin console and metrics
+type JobStatus struct {
+	Name         string
+	LeaderOnly   bool
+	Runs         int
+	Failures     int
+	Running      bool
+	LastRun      time.Time
+	LastDuration time.Duration
+	LastSuccess  time.Time
+	LastError    string
+}
+
+// scheduledJob is a job and how it has been doing
+type scheduledJob struct {
+	Job
+
+	mu     sync.Mutex
+	status JobStatus
+}
+
+// Scheduler runs background jobs such as saving click counts, reloading
+// files that changed and applying the expiry policy, in place of each
+// feature starting its own goroutine. Jobs never overlap themselves, and
+// Stop lets runs in progress finish.
+type Scheduler struct {
+	jobs     []*scheduledJob
+	leader   func() bool // nil when every job runs on every instance
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewScheduler creates a scheduler with no jobs
+func NewScheduler() *Scheduler {
+	return &Scheduler{stop: make(chan struct{})}
+}
+
+// Add adds a job, to be run once the scheduler starts
+func (sc *Scheduler) Add(job Job) {
+	sc.jobs = append(sc.jobs, &scheduledJob{Job: job, status: JobStatus{Name: job.Name, LeaderOnly: job.LeaderOnly}})
+}
+
+// UseLeader makes leader-only jobs run only while leader reports true
+func (sc *Scheduler) UseLeader(leader func() bool) {
+	sc.leader = leader
+}
+
+// Start starts running the jobs
+func (sc *Scheduler) Start() {
+	for _, job := range sc.jobs {
+		sc.wg.Add(1)
+		go sc.loop(job)
+	}
+}
+
+// loop runs a job at its times until the scheduler stops
+func (sc *Scheduler) loop(job *scheduledJob) {
+	defer sc.wg.Done()
+	if job.RunAtStart {
+		sc.run(job)
+	}
+	for {
+		timer := time.NewTimer(time.Until(job.next(time.Now())))
+		select {
+		case <-sc.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+			sc.run(job)
+		}
+	}
+}
+
+// run runs a job, unless it is leader-only and another instance leads
+func (sc *Scheduler) run(job *scheduledJob) {
+	if job.LeaderOnly && sc.leader != nil && !sc.leader() {
+		return
+	}
+	job.run()
+}
+
+// next returns when the job should next run after now
+func (job *scheduledJob) next(now time.Time) time.Time {
+	if job.Next != nil {
+		return job.Next(now)
+	}
+	spread := (rand.Float64()*2 - 1) * jobJitter
+	return now.Add(job.Every + time.Duration(spread*float64(job.Every)))
+}
+
+// run runs the job once, recording how it went. A panicking job is
+// recorded as failed rather than taking down the server.
+func (job *scheduledJob) run() {
+	start := time.Now()
+	job.mu.Lock()
+	job.status.Running = true
+	job.mu.Unlock()
+
+	err := func() (err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				err = fmt.Errorf("panic: %v", p)
+			}
+		}()
+		return job.Run()
+	}()
+
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	job.status.Running = false
+	job.status.Runs++
+	job.status.LastRun = start
+	job.status.LastDuration = time.Since(start)
+	if err != nil {
+		job.status.Failures++
+		job.status.LastError = err.Error()
+		log.Printf("Warning: Background job %s failed: %v", job.Name, err)
+		return
+	}
+	job.status.LastSuccess = start
+	job.status.LastError = ""
+}
+
+// Stop stops scheduling jobs and waits for runs in progress to finish, or
+// for ctx to be done
+func (sc *Scheduler) Stop(ctx context.Context) error {
+	sc.stopOnce.Do(func() { close(sc.stop) })
+	done := make(chan struct{})
+	go func() {
+		sc.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Status returns how each job has been doing, in the order they were added
+func (sc *Scheduler) Status() []JobStatus {
+	statuses := make([]JobStatus, len(sc.jobs))
+	for i, job := range sc.jobs {
+		job.mu.Lock()
+		statuses[i] = job.status
+		job.mu.Unlock()
+	}
+	return statuses
+}
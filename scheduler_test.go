@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestScheduler(t *testing.T) {
+	sc := NewScheduler()
+	var ticks, attempts atomic.Int32
+	sc.Add(Job{Name: "tick", Every: 10 * time.Millisecond, Run: func() error {
+		ticks.Add(1)
+		return nil
+	}})
+	sc.Add(Job{Name: "flaky", Every: time.Hour, RunAtStart: true, Run: func() error {
+		if attempts.Add(1) == 1 {
+			return errors.New("disk full")
+		}
+		return nil
+	}})
+	sc.Add(Job{Name: "broken", Next: func(now time.Time) time.Time { return now.Add(10 * time.Millisecond) }, Run: func() error {
+		panic("nil map")
+	}})
+	sc.Start()
+	time.Sleep(100 * time.Millisecond)
+	if err := sc.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	statuses := sc.Status()
+	if tick := statuses[0]; tick.Runs < 3 || tick.Failures != 0 || tick.LastSuccess.IsZero() {
+		t.Errorf("tick = %+v, want several successful runs", tick)
+	}
+	if flaky := statuses[1]; flaky.Runs != 1 || flaky.Failures != 1 || flaky.LastError != "disk full" {
+		t.Errorf("flaky = %+v, want one failed run at start", flaky)
+	}
+	if broken := statuses[2]; broken.Runs == 0 || broken.Failures != broken.Runs || !strings.Contains(broken.LastError, "nil map") {
+		t.Errorf("broken = %+v, want every run recorded as failing", broken)
+	}
+
+	// Nothing runs once stopped
+	stopped := ticks.Load()
+	time.Sleep(30 * time.Millisecond)
+	if ticks.Load() != stopped {
+		t.Error("jobs kept running after Stop")
+	}
+}
+
+func TestSchedulerStopWaits(t *testing.T) {
+	sc := NewScheduler()
+	started, finished := make(chan bool), atomic.Bool{}
+	sc.Add(Job{Name: "slow", Every: time.Hour, RunAtStart: true, Run: func() error {
+		started <- true
+		time.Sleep(50 * time.Millisecond)
+		finished.Store(true)
+		return nil
+	}})
+	sc.Start()
+	<-started
+	if err := sc.Stop(context.Background()); err != nil || !finished.Load() {
+		t.Errorf("Stop returned %v before the run in progress finished", err)
+	}
+
+	sc = NewScheduler()
+	sc.Add(Job{Name: "stuck", Every: time.Hour, RunAtStart: true, Run: func() error {
+		started <- true
+		time.Sleep(time.Second)
+		return nil
+	}})
+	sc.Start()
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := sc.Stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Stop with a job stuck = %v, want the deadline exceeded", err)
+	}
+}
+
+func TestJobJitter(t *testing.T) {
+	job := &scheduledJob{Job: Job{Every: time.Minute}}
+	now := time.Now()
+	for range 100 {
+		if wait := job.next(now).Sub(now); wait < 54*time.Second || wait > 66*time.Second {
+			t.Fatalf("next run in %s, want within 10%% of a minute", wait)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+#!/usr/bin/env bash
+# Load tests a fresh build of go-links with vegeta
+# (https://github.com/tsenart/vegeta), to catch performance regressions
+# the Go benchmarks can't: a real server, over real connections.
+#
+#   scripts/loadtest.sh [startup|redirect|add|all]
+#
+# It builds go-links, fills a links file with LINKS links (gh0 to gh<n-1>),
+# starts the server on ADDR and reports how long it took to start serving,
+# then for RATE requests a second over DURATION:
+#
+#   redirect  follows the shortcuts, spread over the links
+#   add       adds new links through POST /api/links
+#
+# Settings are environment variables, such as
+#
+#   LINKS=50000 RATE=2000 DURATION=1m scripts/loadtest.sh redirect
+#
+# Any GOLINKS_* variables set are passed to the server, so the same run can
+# be compared with and without a setting.
+
+# Not pipefail: the target generators run until vegeta stops reading
+set -eu
+
+LINKS=${LINKS:-10000}
+RATE=${RATE:-500}
+DURATION=${DURATION:-30s}
+ADDR=${ADDR:-127.0.0.1:3099}
+what=${1:-all}
+
+case $what in
+startup | redirect | add | all) ;;
+*)
+	echo "usage: $0 [startup|redirect|add|all]" >&2
+	exit 2
+	;;
+esac
+if [[ $what != startup ]] && ! command -v vegeta >/dev/null; then
+	echo "vegeta is needed: go install github.com/tsenart/vegeta/v12@latest" >&2
+	exit 1
+fi
+
+dir=$(mktemp -d)
+server=
+cleanup() {
+	[[ -n $server ]] && kill "$server" 2>/dev/null && wait "$server" 2>/dev/null
+	rm -rf "$dir"
+}
+trap cleanup EXIT
+
+cd "$(dirname "$0")/.."
+go build -o "$dir/go-links" .
+
+echo "Writing $LINKS links"
+awk -v n="$LINKS" 'BEGIN {
+	print "["
+	for (i = 0; i < n; i++) {
+		printf "  {\"shortcut\": \"gh%d\", \"url\": \"https://github.com/org/repo%d\"}%s\n", i, i, (i < n - 1 ? "," : "")
+	}
+	print "]"
+}' >"$dir/links.json"
+
+# Cold start: from launching until the first request is answered
+start=$(date +%s%N)
+GOLINKS_ADDR=$ADDR GOLINKS_DATA=$dir/links.json GOLINKS_LOG_LEVEL=warn "$dir/go-links" >"$dir/server.log" 2>&1 &
+server=$!
+until curl -fso /dev/null "http://$ADDR/"; do
+	if ! kill -0 "$server" 2>/dev/null; then
+		echo "go-links didn't start:" >&2
+		cat "$dir/server.log" >&2
+		exit 1
+	fi
+	sleep 0.01
+done
+echo "Started serving $LINKS links in $((($(date +%s%N) - start) / 1000000))ms"
+
+# attack runs vegeta with targets read from stdin and reports the latencies
+attack() {
+	echo
+	echo "== $1: $RATE requests/s for $DURATION"
+	vegeta attack -lazy -rate "$RATE" -duration "$DURATION" -redirects -1 |
+		vegeta report -type text
+}
+
+if [[ $what == redirect || $what == all ]]; then
+	awk -v n="$LINKS" -v addr="$ADDR" 'BEGIN {
+		for (i = 0; ; i = (i + 97) % n) printf "GET http://%s/gh%d\n\n", addr, i
+	}' | attack redirect
+fi
+if [[ $what == add || $what == all ]]; then
+	# Each link added is new, and the form is read from the query string
+	awk -v addr="$ADDR" 'BEGIN {
+		for (i = 0; ; i++) printf "POST http://%s/api/links?shortcut=load%d&url=https%%3A%%2F%%2Fexample.com%%2F%d\n\n", addr, i, i
+	}' | attack add
+fi
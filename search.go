@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// searchLinks returns the links whose shortcut, URL or description contains
+// query, or that have it as a tag, case-insensitively, sorted by shortcut.
+// An empty query matches every link.
+func searchLinks(links map[string]Link, query string) []Link {
+	query = strings.ToLower(strings.TrimSpace(query))
+
+	results := []Link{}
+	for _, link := range links {
+		if query == "" || linkMatches(&link, query) {
+			results = append(results, link)
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Shortcut < results[j].Shortcut
+	})
+	return results
+}
+
+// linkMatches reports whether a link's shortcut, URL or description
+// contains query, which is in lower case, or it has query as a tag
+func linkMatches(link *Link, query string) bool {
+	return strings.Contains(strings.ToLower(link.Shortcut), query) ||
+		strings.Contains(strings.ToLower(link.URL), query) ||
+		strings.Contains(strings.ToLower(link.Description), query) ||
+		slices.Contains(link.Tags, query)
+}
+
+// handleSearch serves GET /api/search?q=... with the matching links in the
+// request's namespace as JSON
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	index, visible := s.searchFor(r, s.hosts.Namespace(r))
+	results := index.search(r.URL.Query().Get("q"), visible)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(results); err != nil {
+		http.Error(w, "Failed to encode results", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"cmp"
+	"math/bits"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// searchIndex is a namespace's links indexed for search and suggestions,
+// so each keystroke looks up a few links rather than going through them
+// all. It's built for one version of the store and never changed after.
+type searchIndex struct {
+	version   uint64
+	links     []Link             // by shortcut
+	text      []string           // each link's shortcut, URL and description in lower case, split by \x00
+	shortcuts []string           // each link's shortcut in lower case
+	lengths   []int32            // how many letters each shortcut has
+	masks     []uint64           // the letters in each shortcut, see letterMask
+	prefixes  []int32            // the links by lower-case shortcut, for finding prefixes
+	trigrams  map[uint32][]int32 // the links whose text has each three bytes, in order, see trigram
+	tags      map[string][]int32 // the links with each tag, in order
+}
+
+// newSearchIndex indexes links, sorting them by shortcut
+func newSearchIndex(version uint64, links []Link) *searchIndex {
+	slices.SortFunc(links, func(a, b Link) int { return cmp.Compare(a.Shortcut, b.Shortcut) })
+	idx := &searchIndex{
+		version:   version,
+		links:     links,
+		text:      make([]string, len(links)),
+		shortcuts: make([]string, len(links)),
+		lengths:   make([]int32, len(links)),
+		masks:     make([]uint64, len(links)),
+		prefixes:  make([]int32, len(links)),
+		trigrams:  make(map[uint32][]int32),
+		tags:      make(map[string][]int32),
+	}
+	for i, link := range idx.links {
+		shortcut := strings.ToLower(link.Shortcut)
+		idx.shortcuts[i] = shortcut
+		idx.lengths[i] = int32(utf8.RuneCountInString(shortcut))
+		idx.masks[i] = letterMask(shortcut)
+		idx.prefixes[i] = int32(i)
+		text := shortcut + "\x00" + strings.ToLower(link.URL) + "\x00" + strings.ToLower(link.Description)
+		idx.text[i] = text
+		for j := 0; j+3 <= len(text); j++ {
+			// Links come in order, so a link already listed is the last one
+			key := trigram(text[j:])
+			if postings := idx.trigrams[key]; len(postings) == 0 || postings[len(postings)-1] != int32(i) {
+				idx.trigrams[key] = append(postings, int32(i))
+			}
+		}
+		for _, tag := range link.Tags {
+			if postings := idx.tags[tag]; len(postings) == 0 || postings[len(postings)-1] != int32(i) {
+				idx.tags[tag] = append(postings, int32(i))
+			}
+		}
+	}
+	slices.SortFunc(idx.prefixes, func(a, b int32) int { return cmp.Compare(idx.shortcuts[a], idx.shortcuts[b]) })
+	return idx
+}
+
+// trigram packs the first three bytes of s into a map key
+func trigram(s string) uint32 {
+	return uint32(s[0])<<16 | uint32(s[1])<<8 | uint32(s[2])
+}
+
+// letterMask returns a bit for each byte in s, folded into 64 bits. A
+// string can only be made from another's letters if its mask is covered.
+func letterMask(s string) uint64 {
+	var mask uint64
+	for i := 0; i < len(s); i++ {
+		mask |= 1 << (s[i] % 64)
+	}
+	return mask
+}
+
+// search returns the links kept by keep whose shortcut, URL or description
+// contains query, or that have it as a tag, case-insensitively, sorted by
+// shortcut, as searchLinks does. An empty query matches every link.
+func (idx *searchIndex) search(query string, keep func(*Link) bool) []Link {
+	query = strings.ToLower(strings.TrimSpace(query))
+	results := []Link{}
+	if strings.Contains(query, "\x00") {
+		return results
+	}
+
+	// Links with three bytes of the query in their text are the only ones
+	// that can contain it: check those listed for its rarest three
+	var candidates []int32
+	if len(query) >= 3 {
+		candidates = idx.trigrams[trigram(query)]
+		for j := 1; j+3 <= len(query); j++ {
+			if postings := idx.trigrams[trigram(query[j:])]; len(postings) < len(candidates) {
+				candidates = postings
+			}
+		}
+	}
+	tagged := idx.tags[query]
+
+	add := func(i int32) {
+		if link := &idx.links[i]; keep == nil || keep(link) {
+			results = append(results, *link)
+		}
+	}
+	if len(query) < 3 {
+		for i, text := range idx.text {
+			if strings.Contains(text, query) || slices.Contains(idx.links[i].Tags, query) {
+				add(int32(i))
+			}
+		}
+		return results
+	}
+	// Both lists are in link order, so merge them to keep that order
+	for len(candidates) > 0 || len(tagged) > 0 {
+		switch {
+		case len(tagged) == 0 || len(candidates) > 0 && candidates[0] < tagged[0]:
+			if strings.Contains(idx.text[candidates[0]], query) {
+				add(candidates[0])
+			}
+			candidates = candidates[1:]
+		case len(candidates) > 0 && candidates[0] == tagged[0]:
+			add(tagged[0])
+			candidates, tagged = candidates[1:], tagged[1:]
+		default:
+			add(tagged[0])
+			tagged = tagged[1:]
+		}
+	}
+	return results
+}
+
+// suggest returns up to limit links kept by keep whose shortcut starts with
+// query, followed by links whose shortcut is a close misspelling of it or
+// contains its letters in order, as suggestLinks does. Each group is
+// ranked by popularity.
+//
+// Prefixes are found by binary search. The edit distance allowed is too
+// generous for trigrams to rule shortcuts out, so misspellings are looked
+// for among shortcuts of about the right length with enough of the query's
+// letters, which is cheap to check, before working out the distance.
+func (idx *searchIndex) suggest(query string, limit int, keep func(*Link) bool) []suggestion {
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return []suggestion{}
+	}
+
+	type candidate struct {
+		link  *Link
+		score int // lower is better: 0 prefix, 1 fuzzy
+	}
+	var candidates []candidate
+	first := sort.Search(len(idx.prefixes), func(i int) bool { return idx.shortcuts[idx.prefixes[i]] >= query })
+	for _, i := range idx.prefixes[first:] {
+		if !strings.HasPrefix(idx.shortcuts[i], query) {
+			break
+		}
+		if link := &idx.links[i]; keep == nil || keep(link) {
+			candidates = append(candidates, candidate{link, 0})
+		}
+	}
+
+	// Each edit loses at most one of the query's letters, which is up to
+	// utf8.UTFMax bytes
+	distance, length, mask := max(1, len(query)/3), int32(utf8.RuneCountInString(query)), letterMask(query)
+	lost := distance
+	if length != int32(len(query)) {
+		lost *= utf8.UTFMax
+	}
+	for i, shortcut := range idx.shortcuts {
+		missing := bits.OnesCount64(mask &^ idx.masks[i])
+		misspelt := abs(int(idx.lengths[i]-length)) <= distance && missing <= lost
+		contains := len(query) > 1 && missing == 0
+		if !misspelt && !contains || strings.HasPrefix(shortcut, query) {
+			continue
+		}
+		if misspelt && withinEditDistance(shortcut, query, distance) || contains && isSubsequence(query, shortcut) {
+			if link := &idx.links[i]; keep == nil || keep(link) {
+				candidates = append(candidates, candidate{link, 1})
+			}
+		}
+	}
+
+	slices.SortFunc(candidates, func(a, b candidate) int {
+		return cmp.Or(cmp.Compare(a.score, b.score), cmp.Compare(b.link.Clicks, a.link.Clicks), cmp.Compare(a.link.Shortcut, b.link.Shortcut))
+	})
+	results := []suggestion{}
+	for _, c := range candidates[:min(limit, len(candidates))] {
+		results = append(results, suggestion{
+			Shortcut:    c.link.Shortcut,
+			URL:         c.link.URL,
+			Description: c.link.Description,
+			Clicks:      c.link.Clicks,
+		})
+	}
+	return results
+}
+
+// abs returns the absolute value of n
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// searchIndexes keeps the search index of each namespace, built again once
+// the links change. The zero value is ready to use.
+type searchIndexes struct {
+	mu      sync.Mutex
+	indexes map[string]*searchIndex
+}
+
+// index returns namespace's search index, building it when the links have
+// changed. Searches arriving while it's built wait for it rather than each
+// building their own.
+func (si *searchIndexes) index(store *LinkStore, namespace string) *searchIndex {
+	version := store.Version()
+	si.mu.Lock()
+	defer si.mu.Unlock()
+	if idx := si.indexes[namespace]; idx != nil && idx.version == version {
+		return idx
+	}
+
+	idx := indexNamespace(store, namespace, version)
+	if si.indexes == nil {
+		si.indexes = make(map[string]*searchIndex)
+	}
+	si.indexes[namespace] = idx
+	return idx
+}
+
+// indexNamespace indexes namespace's links as of version
+func indexNamespace(store *LinkStore, namespace string, version uint64) *searchIndex {
+	var links []Link
+	for link := range store.Ordered([]string{namespace}) {
+		links = append(links, link)
+	}
+	return newSearchIndex(version, links)
+}
+
+// searchFor returns the search index of namespace and a function keeping
+// the links r may see. When memory is short the index is built for r alone
+// rather than kept.
+func (s *Server) searchFor(r *http.Request, namespace string) (*searchIndex, func(*Link) bool) {
+	visible := func(link *Link) bool { return s.seenBy(r, link) }
+	if s.memory.Over() {
+		return indexNamespace(s.store, namespace, s.store.Version()), visible
+	}
+	return s.search.index(s.store, namespace), visible
+}
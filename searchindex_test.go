@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSearchIndexMatchesScan(t *testing.T) {
+	links := map[string]Link{}
+	for i, shortcut := range []string{"gh", "GitHub", "gha", "google-docs", "jira", "wiki", "onboarding", "ci", "über", "Docs2"} {
+		links[shortcut] = Link{
+			Shortcut:    shortcut,
+			URL:         fmt.Sprintf("https://example.com/%s/%d", strings.ToLower(shortcut), i),
+			Description: []string{"", "Team wiki", "Build status", "Where the docs live"}[i%4],
+			Tags:        [][]string{nil, {"eng"}, {"docs", "onboarding"}}[i%3],
+			Clicks:      i * 7 % 5,
+		}
+	}
+	idx := newSearchIndex(0, slices.Collect(maps.Values(links)))
+
+	for _, query := range []string{"", "g", "gh", "GIT", "docs", "docs live", "eng", "onboard", "example.com/ci", "üb", "nothing", "s/"} {
+		want := searchLinks(links, query)
+		if got := idx.search(query, nil); !reflect.DeepEqual(got, want) {
+			t.Errorf("search(%q) = %v, want %v", query, shortcutsOf(got), shortcutsOf(want))
+		}
+	}
+
+	// Links not kept are left out without taking the others' places
+	keep := func(link *Link) bool { return link.Shortcut != "gh" }
+	if got := shortcutsOf(idx.search("g", keep)); got != "GitHub,gha,google-docs,onboarding" {
+		t.Errorf("search(g) without gh = %s", got)
+	}
+	var suggested []string
+	for _, s := range idx.suggest("gh", 2, keep) {
+		suggested = append(suggested, s.Shortcut)
+	}
+	if got := strings.Join(suggested, ","); got != "gha,GitHub" {
+		t.Errorf("suggest(gh) without gh = %s, want gha,GitHub", got)
+	}
+	if got := idx.suggest("ubr", 10, nil); len(got) != 0 {
+		t.Errorf("suggest(ubr) = %v, want nothing", got)
+	}
+	if got := idx.suggest("übr", 10, nil); len(got) != 1 || got[0].Shortcut != "über" {
+		t.Errorf("suggest(übr) = %v, want über", got)
+	}
+}
+
+func TestWithinEditDistance(t *testing.T) {
+	for _, test := range []struct {
+		a, b     string
+		distance int
+	}{
+		{"jira", "jira", 0},
+		{"jria", "jira", 1},
+		{"githbu", "github", 1},
+		{"gh", "github", 4},
+		{"kitten", "sitting", 3},
+		{"über", "uber", 1},
+		{"", "docs", 4},
+		{strings.Repeat("a", 40), strings.Repeat("a", 39) + "b", 1},
+	} {
+		for k := range 5 {
+			if got, want := withinEditDistance(test.a, test.b, k), test.distance <= k; got != want {
+				t.Errorf("withinEditDistance(%q, %q, %d) = %v, want %v", test.a, test.b, k, got, want)
+			}
+		}
+	}
+}
+
+func TestSearchIndexFollowsChanges(t *testing.T) {
+	s := newTestServer(t, Link{Shortcut: "gh", URL: "https://github.com"})
+	search := func() string {
+		w := httptest.NewRecorder()
+		s.handleSearch(w, httptest.NewRequest("GET", "/api/search?q=github", nil))
+		return w.Body.String()
+	}
+	if body := search(); !strings.Contains(body, `"gh"`) {
+		t.Fatalf("search = %s", body)
+	}
+	s.store.Add(Link{Shortcut: "code", URL: "https://github.com/org"})
+	if body := search(); !strings.Contains(body, `"code"`) {
+		t.Errorf("new link not found, search = %s", body)
+	}
+}
+
+// shortcutsOf lists the links' shortcuts
+func shortcutsOf(links []Link) string {
+	var shortcuts []string
+	for _, link := range links {
+		shortcuts = append(shortcuts, link.Shortcut)
+	}
+	return strings.Join(shortcuts, ",")
+}
+
+func BenchmarkSuggest(b *testing.B) {
+	s := newTestServer(b)
+	s.store = newBenchStore(b, 50000)
+	for _, query := range []string{"gh499", "gh4999", "gh4999x", "hg4999"} {
+		b.Run(query, func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				s.handleSuggest(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/suggest?q="+query, nil))
+			}
+		})
+	}
+}
+
+func BenchmarkSearch(b *testing.B) {
+	s := newTestServer(b)
+	s.store = newBenchStore(b, 50000)
+	for _, query := range []string{"repo4999", "gh4999", "nothing"} {
+		b.Run(query, func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				s.handleSearch(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/search?q="+query, nil))
+			}
+		})
+	}
+}
+
+func BenchmarkSearchIndexBuild(b *testing.B) {
+	links := newBenchStore(b, 50000).All()
+	b.ReportAllocs()
+	for b.Loop() {
+		newSearchIndex(0, links)
+	}
+}
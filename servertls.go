@@ -0,0 +1,98 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// TLSSettings says how go-links serves HTTPS itself
+type TLSSettings struct {
+	CertFile string // certificate and key files...
+	KeyFile  string
+
+	AutocertHosts     string // ...or certificates from Let's Encrypt for these comma-separated hosts
+	AutocertEmail     string // contact address for the ACME account
+	AutocertCache     string // directory certificates are kept in
+	AutocertDirectory string // ACME directory URL, Let's Encrypt by default
+}
+
+// ServerTLS serves HTTPS with a certificate from files or one obtained and
+// renewed automatically over ACME
+type ServerTLS struct {
+	certificate *tls.Certificate
+	manager     *autocert.Manager
+}
+
+// NewServerTLS loads the certificate or sets up automatic certificates,
+// returning nil when HTTPS isn't configured
+func NewServerTLS(settings TLSSettings) (*ServerTLS, error) {
+	hosts := splitList(settings.AutocertHosts)
+	switch {
+	case len(hosts) > 0 && (settings.CertFile != "" || settings.KeyFile != ""):
+		return nil, errors.New("use either certificate files or automatic certificates, not both")
+	case len(hosts) > 0:
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(hosts...),
+			Cache:      autocert.DirCache(settings.AutocertCache),
+			Email:      settings.AutocertEmail,
+		}
+		if settings.AutocertDirectory != "" {
+			manager.Client = &acme.Client{DirectoryURL: settings.AutocertDirectory}
+		}
+		return &ServerTLS{manager: manager}, nil
+	case settings.CertFile != "" || settings.KeyFile != "":
+		certificate, err := tls.LoadX509KeyPair(settings.CertFile, settings.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		return &ServerTLS{certificate: &certificate}, nil
+	}
+	return nil, nil
+}
+
+// Automatic reports whether certificates are obtained over ACME
+func (st *ServerTLS) Automatic() bool {
+	return st != nil && st.manager != nil
+}
+
+// Config returns the server's TLS configuration, asking for client
+// certificates when clientCerts is set
+func (st *ServerTLS) Config(clientCerts *ClientCerts) *tls.Config {
+	config := &tls.Config{}
+	if st.manager != nil {
+		config = st.manager.TLSConfig()
+	} else {
+		config.Certificates = []tls.Certificate{*st.certificate}
+	}
+	if clientCerts != nil {
+		clientConfig := clientCerts.TLSConfig()
+		config.ClientAuth, config.ClientCAs = clientConfig.ClientAuth, clientConfig.ClientCAs
+	}
+	return config
+}
+
+// RedirectHandler sends plain HTTP requests to the same URL over HTTPS on
+// httpsPort, answering ACME HTTP challenges first when certificates are
+// automatic
+func (st *ServerTLS) RedirectHandler(httpsPort string) http.Handler {
+	redirect := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := requestHost(r)
+		if httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+	if st.manager != nil {
+		return st.manager.HTTPHandler(redirect)
+	}
+	return redirect
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewServerTLS(t *testing.T) {
+	if st, err := NewServerTLS(TLSSettings{}); st != nil || err != nil {
+		t.Errorf("NewServerTLS with nothing set = %v, %v, want disabled", st, err)
+	}
+
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	keyDER, err := x509.MarshalECPrivateKey(ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(certFile, ca.pem, 0644)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+
+	st, err := NewServerTLS(TLSSettings{CertFile: certFile, KeyFile: keyFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Automatic() {
+		t.Error("certificate files reported as automatic")
+	}
+	config := st.Config(newTestClientCerts(t, ca, ""))
+	if len(config.Certificates) != 1 {
+		t.Errorf("config has %d certificates, want 1", len(config.Certificates))
+	}
+	if config.ClientAuth != tls.VerifyClientCertIfGiven || config.ClientCAs == nil {
+		t.Error("config doesn't ask for client certificates")
+	}
+
+	for name, settings := range map[string]TLSSettings{
+		"both":        {CertFile: certFile, KeyFile: keyFile, AutocertHosts: "go.example.com"},
+		"missing key": {CertFile: certFile},
+		"wrong key":   {CertFile: certFile, KeyFile: certFile},
+	} {
+		if _, err := NewServerTLS(settings); err == nil {
+			t.Errorf("%s: NewServerTLS succeeded", name)
+		}
+	}
+
+	auto, err := NewServerTLS(TLSSettings{AutocertHosts: "go.example.com", AutocertCache: filepath.Join(dir, "certs")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !auto.Automatic() || auto.Config(nil).GetCertificate == nil {
+		t.Error("automatic certificates aren't fetched on demand")
+	}
+}
+
+func TestRedirectToHTTPS(t *testing.T) {
+	st := &ServerTLS{}
+	for port, want := range map[string]string{
+		"443":  "https://go.example.com/wiki/page?q=1",
+		"8443": "https://go.example.com:8443/wiki/page?q=1",
+	} {
+		rec := httptest.NewRecorder()
+		st.RedirectHandler(port).ServeHTTP(rec, httptest.NewRequest("GET", "http://Go.Example.com:8080/wiki/page?q=1", nil))
+		if rec.Code != http.StatusMovedPermanently || rec.Header().Get("Location") != want {
+			t.Errorf("port %s: redirected %d to %q, want %q", port, rec.Code, rec.Header().Get("Location"), want)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// sessionCookie holds the ID of a signed-in user's session
+	sessionCookie = "golinks_session"
+
+	// loginCookie carries the state of a sign-in in progress to the
+	// provider's callback
+	loginCookie = "golinks_login"
+
+	// Sessions end after sessionLifetime without use, and after
+	// maxSessionAge however much they're used. They are renewed at most
+	// every sessionRenewal.
+	sessionLifetime = 7 * 24 * time.Hour
+	maxSessionAge   = 30 * 24 * time.Hour
+	sessionRenewal  = time.Hour
+
+	loginLifetime = 10 * time.Minute
+)
+
+// Sessions keeps users signed in after single sign-on (OIDC, SAML or LDAP).
+// Sessions live on the server, in a SessionStore, and the browser only
+// holds a random session ID, so they can be ended from the server. Sign-ins
+// in progress are carried in cookies signed by the server instead.
+type Sessions struct {
+	key   []byte
+	store SessionStore
+}
+
+// session is who a session signs in, their go-links roles (when the
+// sign-in provider maps them) and groups (when it sends them), and when it
+// started and ends
+type session struct {
+	User    string   `json:"user"`
+	Roles   []string `json:"roles,omitempty"`
+	Groups  []string `json:"groups,omitempty"`
+	Created int64    `json:"created"`
+	Expires int64    `json:"exp"`
+}
+
+// NewSessions creates sessions kept in store, signing sign-in state with
+// secret. With no secret a random one is used, so sign-ins in progress
+// fail if the server restarts.
+func NewSessions(secret string, store SessionStore) *Sessions {
+	if secret == "" {
+		secret = randomToken()
+	}
+	return &Sessions{key: []byte(secret), store: store}
+}
+
+// current returns the request's unexpired session, if any, and the key it
+// is stored under
+func (ss *Sessions) current(r *http.Request) (session, string, bool) {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil || cookie.Value == "" {
+		return session{}, "", false
+	}
+	key := hashToken(cookie.Value)
+	sess, ok := ss.store.Get(key)
+	if !ok || time.Now().Unix() > sess.Expires {
+		return session{}, "", false
+	}
+	return sess, key, true
+}
+
+// User returns the user signed in by the request's session, or ""
+func (ss *Sessions) User(r *http.Request) string {
+	sess, _, _ := ss.current(r)
+	return sess.User
+}
+
+// HasRole reports whether the request's session grants role
+func (ss *Sessions) HasRole(r *http.Request, role string) bool {
+	sess, _, ok := ss.current(r)
+	return ok && slices.Contains(sess.Roles, role)
+}
+
+// Start signs sess.User in on this browser with a new session, replacing
+// any session it had
+func (ss *Sessions) Start(w http.ResponseWriter, r *http.Request, sess session) error {
+	if _, key, ok := ss.current(r); ok {
+		ss.store.Delete(key)
+	}
+
+	id := randomToken()
+	now := time.Now()
+	sess.Created = now.Unix()
+	sess.Expires = now.Add(sessionLifetime).Unix()
+	if err := ss.store.Put(hashToken(id), sess); err != nil {
+		return err
+	}
+	ss.writeCookie(w, r, sessionCookie, id, sessionLifetime, http.SameSiteLaxMode)
+	log.Printf("Signed in %s", sess.User)
+	return nil
+}
+
+// End signs the browser out
+func (ss *Sessions) End(w http.ResponseWriter, r *http.Request) error {
+	ss.clearCookie(w, r, sessionCookie)
+	if _, key, ok := ss.current(r); ok {
+		return ss.store.Delete(key)
+	}
+	return nil
+}
+
+// EndAll signs user out on every browser, returning how many sessions
+// were ended
+func (ss *Sessions) EndAll(user string) (int, error) {
+	return ss.store.DeleteUser(user)
+}
+
+// Renew wraps a handler so sessions in use are extended, keeping active
+// users signed in up to maxSessionAge
+func (ss *Sessions) Renew(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if sess, key, ok := ss.current(r); ok {
+			now := time.Now()
+			expires := min(now.Add(sessionLifetime).Unix(), time.Unix(sess.Created, 0).Add(maxSessionAge).Unix())
+			if expires-sess.Expires >= int64(sessionRenewal.Seconds()) {
+				sess.Expires = expires
+				if err := ss.store.Put(key, sess); err != nil {
+					log.Printf("Renewing session for %s: %v", sess.User, err)
+				} else if cookie, err := r.Cookie(sessionCookie); err == nil {
+					ss.writeCookie(w, r, sessionCookie, cookie.Value, time.Until(time.Unix(expires, 0)), http.SameSiteLaxMode)
+				}
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// setCookie stores value in a signed cookie
+func (ss *Sessions) setCookie(w http.ResponseWriter, r *http.Request, name string, value any, lifetime time.Duration, sameSite http.SameSite) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		panic(err)
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	ss.writeCookie(w, r, name, payload+"."+ss.sign(payload), lifetime, sameSite)
+}
+
+// writeCookie sets a cookie scripts can't read, sent only over HTTPS when
+// the browser is using it
+func (ss *Sessions) writeCookie(w http.ResponseWriter, r *http.Request, name, value string, lifetime time.Duration, sameSite http.SameSite) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   int(lifetime.Seconds()),
+		HttpOnly: true,
+		Secure:   isHTTPS(r) || sameSite == http.SameSiteNoneMode,
+		SameSite: sameSite,
+	})
+}
+
+// readCookie decodes a cookie written by setCookie into value, reporting
+// whether it was present and its signature valid
+func (ss *Sessions) readCookie(r *http.Request, name string, value any) bool {
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return false
+	}
+	payload, signature, ok := strings.Cut(cookie.Value, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(ss.sign(payload))) {
+		return false
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	return err == nil && json.Unmarshal(data, value) == nil
+}
+
+func (ss *Sessions) clearCookie(w http.ResponseWriter, r *http.Request, name string) {
+	http.SetCookie(w, &http.Cookie{Name: name, Path: "/", MaxAge: -1, HttpOnly: true, Secure: isHTTPS(r)})
+}
+
+func (ss *Sessions) sign(payload string) string {
+	mac := hmac.New(sha256.New, ss.key)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// isHTTPS reports whether the browser reached us over HTTPS, directly or
+// through a TLS-terminating proxy
+func isHTTPS(r *http.Request) bool {
+	return r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https"
+}
+
+// localRedirect returns next if it is a path on this server, and "/"
+// otherwise, so sign-in can't be used to send people to other sites
+func localRedirect(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
+
+// handleLogout serves POST /auth/logout, ending the session. With
+// everywhere=1 in the form it ends all of the user's sessions, on every
+// browser.
+func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
+	user := s.sessions.User(r)
+	if err := s.sessions.End(w, r); err != nil {
+		log.Printf("Ending session: %v", err)
+	}
+	if user != "" && r.PostFormValue("everywhere") != "" {
+		n, err := s.sessions.EndAll(user)
+		if err != nil {
+			log.Printf("Ending sessions for %s: %v", user, err)
+			s.showError(w, r, http.StatusInternalServerError, "You couldn't be signed out everywhere. Please try again later.")
+			return
+		}
+		log.Printf("Signed %s out of %d other sessions", user, n)
+	}
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"sync"
+	"time"
+)
+
+// SessionStore keeps sessions on the server, keyed by a hash of their ID
+// so a leaked store can't be used to sign in
+type SessionStore interface {
+	Get(key string) (session, bool)
+	Put(key string, sess session) error
+	Delete(key string) error
+
+	// DeleteUser deletes all of a user's sessions, returning how many
+	DeleteUser(user string) (int, error)
+}
+
+// NewSessionStore creates the session store named by kind: "file" (the
+// default, matching the JSON file link store) keeps sessions in a JSON file
+// at filePath so they survive restarts, and "memory" keeps them in memory
+func NewSessionStore(kind, filePath string) (SessionStore, error) {
+	switch kind {
+	case "", "file":
+		store := &fileSessionStore{memorySessionStore: newMemorySessionStore(), filePath: filePath}
+		if err := store.load(); err != nil {
+			log.Printf("Warning: Could not load sessions file: %v", err)
+		}
+		return store, nil
+	case "memory":
+		return newMemorySessionStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown session store %q, want file or memory", kind)
+	}
+}
+
+// memorySessionStore keeps sessions in memory, so everyone is signed out
+// when the server restarts
+type memorySessionStore struct {
+	mu       sync.RWMutex
+	sessions map[string]session
+}
+
+func newMemorySessionStore() *memorySessionStore {
+	return &memorySessionStore{sessions: make(map[string]session)}
+}
+
+func (ms *memorySessionStore) Get(key string) (session, bool) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	sess, ok := ms.sessions[key]
+	return sess, ok
+}
+
+func (ms *memorySessionStore) Put(key string, sess session) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.prune()
+	ms.sessions[key] = sess
+	return nil
+}
+
+func (ms *memorySessionStore) Delete(key string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	delete(ms.sessions, key)
+	return nil
+}
+
+func (ms *memorySessionStore) DeleteUser(user string) (int, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	n := len(ms.sessions)
+	maps.DeleteFunc(ms.sessions, func(_ string, sess session) bool { return sess.User == user })
+	return n - len(ms.sessions), nil
+}
+
+// prune drops expired sessions; the caller must hold ms.mu
+func (ms *memorySessionStore) prune() {
+	now := time.Now().Unix()
+	maps.DeleteFunc(ms.sessions, func(_ string, sess session) bool { return now > sess.Expires })
+}
+
+// fileSessionStore keeps sessions in memory and writes them to a JSON file
+// alongside the links on every change
+type fileSessionStore struct {
+	*memorySessionStore
+	filePath string
+}
+
+// load reads sessions from the JSON file. A missing file means none.
+func (fs *fileSessionStore) load() error {
+	data, err := os.ReadFile(fs.filePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return json.Unmarshal(data, &fs.sessions)
+}
+
+// save writes sessions to the JSON file; the caller must hold fs.mu
+func (fs *fileSessionStore) save() error {
+	data, err := json.MarshalIndent(fs.sessions, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fs.filePath, data, 0600)
+}
+
+func (fs *fileSessionStore) Put(key string, sess session) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.prune()
+	fs.sessions[key] = sess
+	return fs.save()
+}
+
+func (fs *fileSessionStore) Delete(key string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	delete(fs.sessions, key)
+	return fs.save()
+}
+
+func (fs *fileSessionStore) DeleteUser(user string) (int, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	n := len(fs.sessions)
+	maps.DeleteFunc(fs.sessions, func(_ string, sess session) bool { return sess.User == user })
+	return n - len(fs.sessions), fs.save()
+}
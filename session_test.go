@@ -0,0 +1,151 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// signIn starts a session for user and returns a request carrying it
+func signIn(t *testing.T, ss *Sessions, user string) *http.Request {
+	t.Helper()
+	w := httptest.NewRecorder()
+	if err := ss.Start(w, httptest.NewRequest("GET", "/", nil), session{User: user}); err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest("GET", "/", nil)
+	for _, cookie := range w.Result().Cookies() {
+		r.AddCookie(cookie)
+	}
+	return r
+}
+
+func TestSessions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.json")
+	store, err := NewSessionStore("", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss := NewSessions("secret", store)
+
+	r := signIn(t, ss, "alice")
+	if user := ss.User(r); user != "alice" {
+		t.Fatalf("User = %q, want alice", user)
+	}
+
+	// Only a hash of the session ID is stored
+	cookie, _ := r.Cookie(sessionCookie)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), cookie.Value) || !strings.Contains(string(data), hashToken(cookie.Value)) {
+		t.Errorf("sessions file doesn't hold just the hash: %s", data)
+	}
+
+	// Sessions survive a restart with the file store
+	reloaded, err := NewSessionStore("file", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user := NewSessions("other-secret", reloaded).User(r); user != "alice" {
+		t.Errorf("User after restart = %q, want alice", user)
+	}
+
+	// Made-up session IDs sign nobody in
+	forged := httptest.NewRequest("GET", "/", nil)
+	forged.AddCookie(&http.Cookie{Name: sessionCookie, Value: randomToken()})
+	if user := ss.User(forged); user != "" {
+		t.Errorf("User with a made-up session = %q, want none", user)
+	}
+
+	// Signing out ends the session on the server, not just in the browser
+	w := httptest.NewRecorder()
+	if err := ss.End(w, r); err != nil {
+		t.Fatal(err)
+	}
+	if user := ss.User(r); user != "" {
+		t.Errorf("User after signing out = %q, want none", user)
+	}
+
+	if _, err := NewSessionStore("redis", path); err == nil {
+		t.Error("NewSessionStore accepted an unknown kind")
+	}
+}
+
+func TestSessionRenewal(t *testing.T) {
+	store := newMemorySessionStore()
+	ss := NewSessions("secret", store)
+	r := signIn(t, ss, "alice")
+	_, key, _ := ss.current(r)
+
+	renew := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		ss.Renew(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})).ServeHTTP(w, r)
+		return w
+	}
+
+	// Fresh sessions aren't rewritten on every request
+	if w := renew(); len(w.Result().Cookies()) != 0 {
+		t.Error("renewed a session that was just started")
+	}
+
+	// A session that's been idle a while is extended
+	sess, _ := store.Get(key)
+	sess.Expires = time.Now().Add(sessionLifetime - 2*time.Hour).Unix()
+	store.Put(key, sess)
+	if w := renew(); len(w.Result().Cookies()) != 1 {
+		t.Error("didn't renew the session cookie")
+	}
+	if renewed, _ := store.Get(key); renewed.Expires <= sess.Expires {
+		t.Errorf("expiry %d not extended past %d", renewed.Expires, sess.Expires)
+	}
+
+	// ...but not past the maximum age
+	sess.Created = time.Now().Add(-maxSessionAge + time.Minute).Unix()
+	sess.Expires = time.Now().Add(time.Minute).Unix()
+	store.Put(key, sess)
+	renew()
+	if renewed, _ := store.Get(key); renewed.Expires > sess.Expires {
+		t.Errorf("session renewed past its maximum age")
+	}
+
+	// Expired sessions sign nobody in
+	sess.Expires = time.Now().Add(-time.Minute).Unix()
+	store.Put(key, sess)
+	if user := ss.User(r); user != "" {
+		t.Errorf("User with an expired session = %q, want none", user)
+	}
+}
+
+func TestLogoutEverywhere(t *testing.T) {
+	s := newTestServer(t)
+	s.sessions = NewSessions("secret", newMemorySessionStore())
+	laptop := signIn(t, s.sessions, "alice")
+	phone := signIn(t, s.sessions, "alice")
+	bob := signIn(t, s.sessions, "bob")
+
+	form := url.Values{"everywhere": {"1"}}
+	r := httptest.NewRequest("POST", "/auth/logout", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for _, cookie := range laptop.Cookies() {
+		r.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	s.handleLogout(w, r)
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("status %d, want %d", w.Code, http.StatusSeeOther)
+	}
+
+	if s.sessions.User(laptop) != "" || s.sessions.User(phone) != "" {
+		t.Error("alice is still signed in somewhere")
+	}
+	if s.sessions.User(bob) != "bob" {
+		t.Error("signing alice out everywhere signed bob out")
+	}
+}
@@ -0,0 +1,438 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// setupReport is told how each step of setting go-links up went, with a
+// detail for the -check report. A warning is a failure the server can run
+// without, such as a damaged stars file.
+type setupReport func(step, detail string, err error, warning bool)
+
+// components are what go-links serves with, set up from the environment
+type components struct {
+	server          *Server
+	live            *liveSettings
+	wiki            *WikiPublisher
+	serverTLS       *ServerTLS
+	limits          ServerLimits
+	shutdownTimeout time.Duration
+	addr            string // to listen on
+}
+
+// buildComponents sets go-links up from the environment for the data at
+// dataPath, for serving and for -check alike, so the two can't drift
+// apart. When checking, nothing is created or started and every step is
+// reported, even after one fails; when serving, report is expected to stop
+// at the first failure that isn't a warning.
+func buildComponents(dataPath string, checking bool, report setupReport) *components {
+	dir := filepath.Dir(dataPath)
+	dataFile := func(env, name string) string {
+		if path, ok := os.LookupEnv(env); ok {
+			return path
+		}
+		return filepath.Join(dir, name)
+	}
+	c := &components{}
+
+	// Settings that can change on SIGHUP: the log level, rate limits on
+	// changes and API requests, where links may point and the logo and
+	// accent color branding the homepage
+	live, err := readLiveSettings()
+	report("settings", "", err, false)
+	c.live = live
+
+	// Background jobs, such as saving click counts and picking up edited
+	// files, are run by the scheduler once the server starts
+	jobs := NewScheduler()
+
+	// Optionally elect one of the instances sharing the data directory to
+	// run jobs that must only run once, such as the weekly digest
+	leadership, err := NewLeadership(os.Getenv("GOLINKS_LEADER_ELECTION"), os.Getenv("GOLINKS_INSTANCE_ID"),
+		filepath.Join(dir, "leader.json"))
+	report("leader election", "", err, false)
+	if leadership != nil {
+		jobs.Add(leadership.Job())
+		jobs.UseLeader(leadership.IsLeader)
+	}
+
+	// The links and everything kept alongside them are written to their
+	// directory, which a check makes sure of unless links can't be changed
+	if checking && os.Getenv("GOLINKS_READ_ONLY") != "true" {
+		report("data directory", dir, checkWritable(dir), false)
+	}
+
+	// Load the operator-managed blocklist and pick up edits while running
+	blocklist := NewBlocklist(dataFile("GOLINKS_BLOCKLIST", "blocklist.txt"))
+	report("blocklist", "", blocklist.Load(), true)
+	jobs.Add(Job{Name: "reload_blocklist", Every: 5 * time.Second, Run: blocklist.ReloadIfChanged})
+
+	// Set up region detection for per-link overrides
+	regions, err := NewRegionResolver(os.Getenv("GOLINKS_REGION_HEADER"), os.Getenv("GOLINKS_REGION_NETWORKS"))
+	report("regions", "", err, false)
+
+	// Load existing links from file, optionally in the background so
+	// redirects are served while a very large file loads, along with each
+	// user's starred links, the missing shortcuts people try, API tokens
+	// for automation, kept hashed, and links suggested by people who can't
+	// add them. A damaged file is only a warning, so links keep redirecting.
+	store := &LinkStore{filePath: dataPath}
+	stars := NewStarStore(filepath.Join(dir, "stars.json"))
+	misses := NewMissStore(filepath.Join(dir, "misses.json"))
+	tokens := NewTokenStore(filepath.Join(dir, "tokens.json"))
+	proposals := NewProposalStore(filepath.Join(dir, "proposals.json"))
+	data := &Server{store: store, stars: stars, misses: misses, tokens: tokens, proposals: proposals}
+	lazy := os.Getenv("GOLINKS_LAZY_LOAD") == "true" && !checking
+	loaded := true
+	for _, part := range data.backupParts() {
+		if part.path == dataPath && lazy {
+			start := time.Now()
+			done := store.LoadInBackground()
+			go func() {
+				if err := <-done; err != nil {
+					log.Printf("Warning: Could not load links file: %v", err)
+					return
+				}
+				log.Printf("Loaded %d links in %v", len(store.entries()), time.Since(start).Round(time.Millisecond))
+			}()
+			continue
+		}
+		if err := part.load(); err != nil {
+			report("data files", "", fmt.Errorf("loading %s: %w", part.name, err), true)
+			loaded = false
+		}
+	}
+	if loaded && !lazy {
+		report("data files", fmt.Sprintf("%d links", store.Stats().Links), nil, false)
+	}
+	jobs.Add(Job{Name: "save_clicks", Every: 30 * time.Second, Run: store.Flush})
+	jobs.Add(Job{Name: "save_missing_shortcuts", Every: 30 * time.Second, Run: misses.Flush})
+
+	// Optionally tell the other instances sharing the data directory which
+	// links changed through Redis, and read the links they change
+	invalidations, err := NewInvalidations(os.Getenv("GOLINKS_INVALIDATION_URL"), os.Getenv("GOLINKS_INSTANCE_ID"))
+	report("invalidation", "", err, false)
+	if invalidations != nil && !checking {
+		invalidations.Start(store)
+	}
+
+	// Or tell them directly, listed or found through DNS
+	peers, err := NewPeers(os.Getenv("GOLINKS_PEERS"), os.Getenv("GOLINKS_PEER_SECRET"), os.Getenv("GOLINKS_INSTANCE_ID"))
+	var found string
+	if peers != nil {
+		jobs.Add(peers.Job())
+		if checking {
+			var urls []string
+			urls, err = peers.find()
+			found = fmt.Sprintf("%d found", len(urls))
+		}
+	}
+	report("peers", found, err, false)
+
+	// Map vanity hostnames to their own namespaces
+	hosts, err := NewHostMap(os.Getenv("GOLINKS_HOSTS"))
+	report("hosts", "", err, false)
+
+	// Optionally pass unknown shortcuts through to a legacy shortener
+	fallback, err := NewFallback(os.Getenv("GOLINKS_FALLBACK_URL"), os.Getenv("GOLINKS_FALLBACK_MODE"))
+	report("fallback", "", err, false)
+
+	// Let operators replace page templates, such as the not-found and
+	// error pages, with their own
+	templateDir := os.Getenv("GOLINKS_TEMPLATE_DIR")
+	if templateDir != "" {
+		parsed, err := parseTemplates(templateDir)
+		if err == nil {
+			templates = parsed
+		}
+		report("templates", templateDir, err, false)
+	} else {
+		report("templates", "built in", nil, false)
+	}
+
+	// Browsers may cache redirects briefly so edits still propagate quickly
+	cacheControl, ok := os.LookupEnv("GOLINKS_REDIRECT_CACHE_CONTROL")
+	if !ok {
+		cacheControl = "private, max-age=60"
+	}
+
+	// Optionally require signing in to add, edit or delete links
+	editors, err := NewEditAuth(os.Getenv("GOLINKS_AUTH_USERS"), os.Getenv("GOLINKS_AUTH_TOKEN"))
+	report("auth", "", err, false)
+
+	// Identity headers from an authenticating proxy (GOLINKS_USER_HEADER
+	// and GOLINKS_GROUPS_HEADER) are only trusted from it, by default over
+	// loopback, and the client address, scheme and host it forwards are
+	// used too when it's listed
+	trustedProxies, err := parseTrustedProxies(os.Getenv("GOLINKS_TRUSTED_PROXIES"))
+	report("trusted proxies", "", err, false)
+
+	// Optionally limit how many links each user may add, in total and per hour
+	quotas, err := NewQuotas(os.Getenv("GOLINKS_LINK_QUOTA"), os.Getenv("GOLINKS_LINK_RATE"), os.Getenv("GOLINKS_QUOTA_OVERRIDES"))
+	report("quotas", "", err, false)
+
+	// Optionally cap how many requests are handled at once, queueing and
+	// then turning away the rest, so traffic spikes can't swamp the store
+	concurrency, err := NewConcurrencyLimit(os.Getenv("GOLINKS_MAX_REQUESTS"), os.Getenv("GOLINKS_REQUEST_QUEUE"), os.Getenv("GOLINKS_QUEUE_TIMEOUT"))
+	var detail string
+	if concurrency != nil {
+		detail = fmt.Sprintf("%d at once, %d queued for up to %s", cap(concurrency.slots), concurrency.queue, concurrency.timeout)
+	}
+	report("concurrency", detail, err, false)
+
+	// Keep account of the memory the links, caches and queues take,
+	// optionally keeping it under a limit
+	memory, err := NewMemory(os.Getenv("GOLINKS_MEMORY_LIMIT"))
+	detail = ""
+	if memory != nil && memory.limit > 0 {
+		detail = "limited to " + formatBytes(memory.limit)
+	}
+	report("memory", detail, err, false)
+
+	// Optionally archive links nobody has used for a while, after warning
+	// their owners
+	expiry, err := NewExpiryPolicy(os.Getenv("GOLINKS_ARCHIVE_UNUSED_DAYS"), os.Getenv("GOLINKS_ARCHIVE_GRACE_DAYS"), os.Getenv("GOLINKS_ARCHIVE_WEBHOOK"))
+	report("expiry", "", err, false)
+
+	// Optionally collect less about the people following links: turn
+	// analytics off, honor Do Not Track, hash, truncate or drop IP
+	// addresses, and forget analytics and addresses after some days
+	privacy, err := NewPrivacy(os.Getenv("GOLINKS_ANALYTICS"), os.Getenv("GOLINKS_IP_ADDRESSES"), os.Getenv("GOLINKS_IP_HASH_KEY"),
+		os.Getenv("GOLINKS_HONOR_DNT"), os.Getenv("GOLINKS_RETENTION_DAYS"))
+	report("privacy", "", err, false)
+
+	// Optionally email admins, and owners, a weekly digest of link activity
+	digest, err := NewDigest(DigestConfig{
+		SMTPAddr: os.Getenv("GOLINKS_SMTP_ADDR"),
+		Username: os.Getenv("GOLINKS_SMTP_USERNAME"),
+		Password: os.Getenv("GOLINKS_SMTP_PASSWORD"),
+		From:     os.Getenv("GOLINKS_SMTP_FROM"),
+		To:       os.Getenv("GOLINKS_DIGEST_TO"),
+		Owners:   os.Getenv("GOLINKS_DIGEST_OWNERS") == "true",
+		Day:      os.Getenv("GOLINKS_DIGEST_DAY"),
+		Hour:     os.Getenv("GOLINKS_DIGEST_HOUR"),
+	})
+	report("digest", "", err, false)
+
+	// Optionally serve Prometheus metrics, with per-shortcut series for
+	// only the most clicked links so large deployments stay scrapeable
+	metrics, err := NewMetrics(os.Getenv("GOLINKS_METRICS"), os.Getenv("GOLINKS_METRICS_TOP"), os.Getenv("GOLINKS_METRICS_BUCKETS"),
+		os.Getenv("GOLINKS_METRICS_REFRESH"), os.Getenv("GOLINKS_METRICS_TOKEN"))
+	report("metrics", "", err, false)
+
+	// Optionally commit every change to a Git repository, and push it. A
+	// check only looks at the repository and remote, creating nothing.
+	gitRepo, err := NewGitRepo(os.Getenv("GOLINKS_GIT_REPO"), os.Getenv("GOLINKS_GIT_REMOTE"), os.Getenv("GOLINKS_GIT_BRANCH"))
+	detail = ""
+	if gitRepo != nil {
+		if checking {
+			detail, err = gitRepo.Check()
+		} else if err = gitRepo.Init(); err != nil {
+			err = fmt.Errorf("could not create the repository: %w", err)
+		}
+	}
+	report("git", detail, err, false)
+
+	// Optionally publish the link directory to a Confluence or Notion page
+	c.wiki, err = NewWikiPublisher(WikiConfig{
+		Kind:     os.Getenv("GOLINKS_WIKI"),
+		URL:      os.Getenv("GOLINKS_WIKI_URL"),
+		Page:     os.Getenv("GOLINKS_WIKI_PAGE"),
+		User:     os.Getenv("GOLINKS_WIKI_USER"),
+		Token:    os.Getenv("GOLINKS_WIKI_TOKEN"),
+		Interval: os.Getenv("GOLINKS_WIKI_INTERVAL"),
+	})
+	report("wiki", "", err, false)
+
+	// Optionally announce new links to a Slack, Teams or Matrix webhook
+	announcer, err := NewAnnouncer(os.Getenv("GOLINKS_ANNOUNCE_WEBHOOK"), os.Getenv("GOLINKS_ANNOUNCE_FORMAT"), os.Getenv("GOLINKS_ANNOUNCE_NAMESPACES"))
+	report("announcements", "", err, false)
+
+	// Optionally send links to the video call of a calendar's next event,
+	// from ICS feeds given as name=URL
+	calendars, err := NewCalendars(os.Getenv("GOLINKS_CALENDARS"))
+	report("calendars", "", err, false)
+
+	// Optionally send changes to outbound webhooks, such as Zapier or Jira
+	// automation, shaped by the templates in a webhooks file
+	webhooks, err := NewWebhooks(os.Getenv("GOLINKS_WEBHOOKS"))
+	report("webhooks", "", err, false)
+
+	// Let teams manage their own shortcut spaces, as granted in the ACL file
+	acl := NewACL(dataFile("GOLINKS_ACL", "acl.txt"))
+	report("ACL", "", acl.Load(), false)
+	jobs.Add(Job{Name: "reload_acl", Every: 5 * time.Second, Run: acl.ReloadIfChanged})
+
+	// Groups can also be managed locally, next to the links, as well as
+	// coming from the identity provider
+	groups := NewGroupStore(dataFile("GOLINKS_GROUPS", "groups.txt"))
+	report("groups", "", groups.Load(), false)
+	jobs.Add(Job{Name: "reload_groups", Every: 5 * time.Second, Run: groups.ReloadIfChanged})
+
+	// Optionally sign users in with an OpenID Connect provider, a SAML
+	// identity provider or an LDAP directory such as Active Directory,
+	// contacting them as serving would
+	sso, err := NewSSO(context.Background(),
+		os.Getenv("GOLINKS_OIDC_ISSUER"),
+		os.Getenv("GOLINKS_OIDC_CLIENT_ID"),
+		os.Getenv("GOLINKS_OIDC_CLIENT_SECRET"),
+		os.Getenv("GOLINKS_OIDC_REDIRECT_URL"),
+		os.Getenv("GOLINKS_OIDC_DOMAINS"),
+	)
+	report("OIDC", "", err, false)
+	samlSP, err := NewSAML(context.Background(),
+		os.Getenv("GOLINKS_SAML_ROOT_URL"),
+		os.Getenv("GOLINKS_SAML_IDP_METADATA"),
+		os.Getenv("GOLINKS_SAML_CERT"),
+		os.Getenv("GOLINKS_SAML_KEY"),
+		os.Getenv("GOLINKS_SAML_USER_ATTRIBUTE"),
+	)
+	report("SAML", "", err, false)
+	ldapAuth, err := NewLDAP(LDAPConfig{
+		URL:          os.Getenv("GOLINKS_LDAP_URL"),
+		BindDN:       os.Getenv("GOLINKS_LDAP_BIND_DN"),
+		BindPassword: os.Getenv("GOLINKS_LDAP_BIND_PASSWORD"),
+		BaseDN:       os.Getenv("GOLINKS_LDAP_BASE_DN"),
+		UserFilter:   os.Getenv("GOLINKS_LDAP_USER_FILTER"),
+		UserGroups:   os.Getenv("GOLINKS_LDAP_USER_GROUPS"),
+		EditorGroups: os.Getenv("GOLINKS_LDAP_EDITOR_GROUPS"),
+		AdminGroups:  os.Getenv("GOLINKS_LDAP_ADMIN_GROUPS"),
+	})
+	report("LDAP", "", err, false)
+
+	// Optionally serve HTTPS directly, with a certificate from files or
+	// from Let's Encrypt, which also lets API clients sign in with TLS
+	// client certificates from a trusted CA
+	c.serverTLS, err = NewServerTLS(TLSSettings{
+		CertFile:          os.Getenv("GOLINKS_TLS_CERT"),
+		KeyFile:           os.Getenv("GOLINKS_TLS_KEY"),
+		AutocertHosts:     os.Getenv("GOLINKS_AUTOCERT_HOSTS"),
+		AutocertEmail:     os.Getenv("GOLINKS_AUTOCERT_EMAIL"),
+		AutocertCache:     cmp.Or(os.Getenv("GOLINKS_AUTOCERT_CACHE"), filepath.Join(dir, "certs")),
+		AutocertDirectory: os.Getenv("GOLINKS_AUTOCERT_DIRECTORY"),
+	})
+	detail = "off"
+	if c.serverTLS != nil {
+		detail = "on"
+	}
+	report("TLS", detail, err, false)
+	clientCerts, err := NewClientCerts(os.Getenv("GOLINKS_CLIENT_CA"), dataFile("GOLINKS_CLIENT_CERTS", "client-certs.txt"))
+	if err == nil && clientCerts != nil && c.serverTLS == nil {
+		err = errors.New("client certificates need HTTPS, see GOLINKS_TLS_CERT or GOLINKS_AUTOCERT_HOSTS")
+	}
+	report("client certificates", "", err, false)
+
+	// Signed-in users stay signed in with a session kept on the server,
+	// by default in a file next to the links
+	var sessions *Sessions
+	if sso != nil || samlSP != nil || ldapAuth != nil {
+		sessionStore, err := NewSessionStore(os.Getenv("GOLINKS_SESSION_STORE"), filepath.Join(dir, "sessions.json"))
+		report("sessions", "", err, false)
+		sessions = NewSessions(os.Getenv("GOLINKS_SESSION_SECRET"), sessionStore)
+	}
+
+	// Optionally export click events to a webhook, Google Analytics or Kafka
+	clickSinks, err := NewClickSinks(ClickSinkConfig{
+		WebhookURL:      os.Getenv("GOLINKS_CLICK_WEBHOOK"),
+		GAMeasurementID: os.Getenv("GOLINKS_GA_MEASUREMENT_ID"),
+		GAAPISecret:     os.Getenv("GOLINKS_GA_API_SECRET"),
+		KafkaBrokers:    os.Getenv("GOLINKS_KAFKA_BROKERS"),
+		KafkaTopic:      os.Getenv("GOLINKS_KAFKA_TOPIC"),
+	})
+	report("click export", "", err, false)
+
+	// Maintenance mode, started by an admin, is kept next to the links as
+	// well so it reaches every instance
+	maintenance := NewMaintenance(filepath.Join(dir, "maintenance.json"))
+	report("maintenance", "", maintenance.Load(), true)
+	jobs.Add(Job{Name: "reload_maintenance", Every: 5 * time.Second, Run: maintenance.ReloadIfChanged})
+
+	// Record every change to the links in an append-only audit log, unless
+	// GOLINKS_AUDIT_LOG is set to ""
+	var auditLog *AuditLog
+	if auditPath := auditLogPath(dataPath); auditPath != "" && !checking {
+		auditLog, err = OpenAuditLog(auditPath)
+		report("audit log", "", err, false)
+	}
+
+	// On SIGTERM or SIGINT, requests in flight get GOLINKS_SHUTDOWN_TIMEOUT
+	// to finish, and clients only so long to send and read them. Listening
+	// addresses are only parsed, as when checking they may be in use by the
+	// running server.
+	c.limits = ServerLimits{
+		ReadHeaderTimeout: os.Getenv("GOLINKS_READ_HEADER_TIMEOUT"),
+		ReadTimeout:       os.Getenv("GOLINKS_READ_TIMEOUT"),
+		WriteTimeout:      os.Getenv("GOLINKS_WRITE_TIMEOUT"),
+		IdleTimeout:       os.Getenv("GOLINKS_IDLE_TIMEOUT"),
+		MaxHeaderKB:       os.Getenv("GOLINKS_MAX_HEADER_KB"),
+		MaxBodyMB:         os.Getenv("GOLINKS_MAX_BODY_MB"),
+		HTTP2:             os.Getenv("GOLINKS_HTTP2"),
+	}
+	// Let's Encrypt only checks certificate requests on port 443
+	c.addr = listenAddr(":3001")
+	if c.serverTLS.Automatic() {
+		c.addr = listenAddr(":443")
+	}
+	if c.shutdownTimeout, err = time.ParseDuration(cmp.Or(os.Getenv("GOLINKS_SHUTDOWN_TIMEOUT"), "30s")); err != nil {
+		err = fmt.Errorf("shutdown timeout: %w", err)
+	} else if _, err = tcpNetwork(os.Getenv("GOLINKS_IP_VERSION")); err == nil {
+		_, err = NewHTTPServer(nil, c.limits)
+	}
+	report("server", "listening on "+c.addr, err, false)
+
+	c.server = &Server{
+		store:         store,
+		hosts:         hosts,
+		blocklist:     blocklist,
+		regions:       regions,
+		fallback:      fallback,
+		stars:         stars,
+		misses:        misses,
+		clickEvents:   NewClickEvents(clickSinks...),
+		tokens:        tokens,
+		proposals:     proposals,
+		userHeader:    os.Getenv("GOLINKS_USER_HEADER"),
+		groupsHeader:  os.Getenv("GOLINKS_GROUPS_HEADER"),
+		proxies:       trustedProxies,
+		admins:        NewAdminAuth(os.Getenv("GOLINKS_ADMINS"), os.Getenv("GOLINKS_ADMIN_TOKEN")),
+		editors:       editors,
+		reserved:      parseReservedNamespaces(os.Getenv("GOLINKS_RESERVED_NAMESPACES")),
+		acl:           acl,
+		groups:        groups,
+		sso:           sso,
+		saml:          samlSP,
+		ldap:          ldapAuth,
+		sessions:      sessions,
+		clientCerts:   clientCerts,
+		signInToEdit:  os.Getenv("GOLINKS_REQUIRE_SIGN_IN") == "true",
+		readOnly:      os.Getenv("GOLINKS_READ_ONLY") == "true",
+		maintenance:   maintenance,
+		quotas:        quotas,
+		concurrency:   concurrency,
+		memory:        memory,
+		jobs:          jobs,
+		leadership:    leadership,
+		expiry:        expiry,
+		privacy:       privacy,
+		digest:        digest,
+		slack:         NewSlack(os.Getenv("GOLINKS_SLACK_SIGNING_SECRET")),
+		announcer:     announcer,
+		gitRepo:       gitRepo,
+		calendars:     calendars,
+		webhooks:      webhooks,
+		invalidations: invalidations,
+		peers:         peers,
+		metrics:       metrics,
+		auditLog:      auditLog,
+		startedAt:     time.Now(),
+		cacheControl:  cacheControl,
+	}
+	return c
+}
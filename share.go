@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// handleNew serves GET /new?url=...&title=..., the homepage with the add
+// form prefilled so a bookmarklet or the browser's share menu can start a
+// link from the current page. Share targets on some platforms put the URL
+// in the text parameter instead, so the first web address in text is used
+// when url is missing.
+func (s *Server) handleNew(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	destination := strings.TrimSpace(query.Get("url"))
+	if destination == "" {
+		destination = firstWebAddress(query.Get("text"))
+	}
+
+	form := url.Values{
+		"shortcut":    {query.Get("shortcut")},
+		"url":         {destination},
+		"description": {strings.TrimSpace(query.Get("title"))},
+	}
+	s.renderHomepage(w, r, http.StatusOK, form, nil)
+}
+
+// firstWebAddress returns the first http or https URL in text, or ""
+func firstWebAddress(text string) string {
+	for _, word := range strings.Fields(text) {
+		if strings.HasPrefix(word, "http://") || strings.HasPrefix(word, "https://") {
+			return word
+		}
+	}
+	return ""
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+)
+
+// fileLinks is what the links file held when this instance last read or
+// wrote it whole, so changes other instances sharing it have saved since
+// can be told from changes made here, see merge
+type fileLinks struct {
+	info   os.FileInfo        // nil when there was no file
+	hashes map[linkKey]uint64 // each link's hash, see linkHash
+}
+
+// linkHash hashes a link without its click counts, which each instance
+// counts for itself, so it only changes when the link is changed
+func linkHash(link Link) uint64 {
+	data, _ := json.Marshal(keepClicks(Link{}, link))
+	h := fnv.New64a()
+	h.Write(data)
+	return h.Sum64()
+}
+
+// remember records links as what the file, as described by info, holds
+func (ls *LinkStore) remember(info os.FileInfo, links []Link) {
+	hashes := make(map[linkKey]uint64, len(links))
+	for _, link := range links {
+		hashes[linkKey{link.Namespace, link.Shortcut}] = linkHash(link)
+	}
+	ls.file.Store(&fileLinks{info: info, hashes: hashes})
+}
+
+// lockPath is the file locked while the links file is written, next to it
+func (ls *LinkStore) lockPath() string {
+	return filepath.Join(filepath.Dir(ls.filePath), "."+filepath.Base(ls.filePath)+".lock")
+}
+
+// merge returns the links to write for ours, the links here, keeping the
+// changes other instances have saved to the file since this one last read
+// or wrote it, along with theirs, the links the file holds, and the keys
+// of those changes, to read here too. A link changed here keeps the change
+// made here; one deleted in one place and changed in the other is kept. The
+// caller must hold the file's lock.
+func (ls *LinkStore) merge(ours []Link) (merged []Link, theirs map[linkKey]Link, changed []linkKey, err error) {
+	last := ls.file.Load()
+	info, err := os.Stat(ls.filePath)
+	if os.IsNotExist(err) {
+		return ours, nil, nil, nil
+	} else if err != nil {
+		return nil, nil, nil, err
+	}
+	// Nothing to merge when the file is as this instance left it, or was
+	// never read, as when it was damaged
+	if last == nil || last.info != nil && os.SameFile(last.info, info) &&
+		last.info.ModTime().Equal(info.ModTime()) && last.info.Size() == info.Size() {
+		return ours, nil, nil, nil
+	}
+	if theirs, _, err = ls.read(); err != nil {
+		return nil, nil, nil, err
+	}
+
+	merged = make([]Link, 0, len(ours))
+	seen := make(map[linkKey]bool, len(ours))
+	for _, link := range ours {
+		key := linkKey{link.Namespace, link.Shortcut}
+		seen[key] = true
+		their, there := theirs[key]
+		hash, known := last.hashes[key]
+		switch {
+		case !known || linkHash(link) != hash:
+			merged = append(merged, link)
+		case there:
+			merged = append(merged, keepClicks(link, their))
+			if linkHash(their) != hash {
+				changed = append(changed, key)
+			}
+		default:
+			changed = append(changed, key)
+		}
+	}
+	for key, link := range theirs {
+		if seen[key] {
+			continue
+		}
+		if hash, known := last.hashes[key]; known && linkHash(link) == hash {
+			continue // deleted here
+		}
+		merged = append(merged, link)
+		changed = append(changed, key)
+	}
+	return merged, theirs, changed, nil
+}
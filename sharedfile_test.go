@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSharedLinksFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "links.json")
+	a, b := &LinkStore{filePath: path}, &LinkStore{filePath: path}
+	a.Load()
+	b.Load()
+	a.Add(Link{Shortcut: "wiki", URL: "https://wiki.example.com"})
+	a.Add(Link{Shortcut: "old", URL: "https://old.example.com"})
+	b.Load()
+
+	// Changes saved by each, before hearing of the other's, are all kept
+	a.Add(Link{Shortcut: "ci", URL: "https://ci.example.com"})
+	a.Update(Link{Shortcut: "wiki", URL: "https://wiki.example.org"})
+	b.Add(Link{Shortcut: "docs", URL: "https://docs.example.com"})
+	b.Delete("", "old")
+	if link, ok := b.Get("", "ci"); !ok || link.URL != "https://ci.example.com" {
+		t.Errorf("b didn't read a's new link when saving: %+v", link)
+	}
+	if link, _ := b.Get("", "wiki"); link.URL != "https://wiki.example.org" {
+		t.Errorf("b didn't read a's change when saving: %+v", link)
+	}
+
+	// Clicks saved by one don't undo the other's changes
+	a.RecordClick("", "docs", clickSource{})
+	b.RecordClick("", "ci", clickSource{})
+	a.Flush()
+	b.Flush()
+	c := &LinkStore{filePath: path}
+	if err := c.Load(); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, link := range c.All() {
+		got = append(got, link.Shortcut+" "+link.URL)
+	}
+	slices.Sort(got)
+	if want := "ci https://ci.example.com,docs https://docs.example.com,wiki https://wiki.example.org"; strings.Join(got, ",") != want {
+		t.Errorf("file holds %v, want %s", got, want)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 2 {
+		t.Errorf("saving left %v, want the links and their lock", entries)
+	}
+}
+
+func TestRefreshAfterFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "links.json")
+	a, b := &LinkStore{filePath: path}, &LinkStore{filePath: path}
+	a.Add(Link{Shortcut: "wiki", URL: "https://wiki.example.com"})
+	b.Load()
+
+	// A change b never heard of, then a file b couldn't read
+	a.Add(Link{Shortcut: "ci", URL: "https://ci.example.com"})
+	data, _ := os.ReadFile(path)
+	os.WriteFile(path, data[:len(data)/2], 0644)
+	if err := b.Refresh([]linkKey{{"", "wiki"}}); err == nil {
+		t.Fatal("read half a file")
+	}
+	os.WriteFile(path, data, 0644)
+	a.Add(Link{Shortcut: "docs", URL: "https://docs.example.com"})
+	if err := b.Refresh([]linkKey{{"", "docs"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := b.Get("", "ci"); !ok {
+		t.Error("the change missed while the file couldn't be read wasn't read")
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ListenConfig says how to open the listeners
+type ListenConfig struct {
+	ReusePort   bool   // bind TCP addresses with SO_REUSEPORT
+	IPVersion   string // "4" or "6" to listen for just that, default both
+	SocketMode  string // permissions for Unix sockets, in octal, default 0660
+	SocketGroup string // group to give Unix sockets, by name or ID
+}
+
+// listen opens the listener to serve on. A socket passed in by systemd
+// socket activation (see passedSockets) is used as is, so a restart never
+// leaves the port closed: the one named "admin" when admin is set, for the
+// management address, and otherwise the main one. Failing that each of the
+// comma-separated addresses is bound: a Unix socket for addresses like
+// unix:/run/go-links.sock (see listenUnix), and otherwise TCP (see
+// listenTCP), with SO_REUSEPORT when config.ReusePort is set so a new
+// process can bind it before the old one stops.
+func listen(addr string, config ListenConfig, admin bool) (net.Listener, error) {
+	sockets, err := passedSockets()
+	if err != nil {
+		return nil, err
+	}
+	if listener := activatedListener(sockets, admin); listener != nil {
+		return listener, nil
+	}
+
+	var listeners []net.Listener
+	for _, addr := range splitList(addr) {
+		var bound []net.Listener
+		if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+			var listener net.Listener
+			if listener, err = listenUnix(path, config); err == nil {
+				bound = []net.Listener{listener}
+			}
+		} else {
+			bound, err = listenTCP(addr, config)
+		}
+		if err != nil {
+			for _, listener := range listeners {
+				listener.Close()
+			}
+			return nil, err
+		}
+		listeners = append(listeners, bound...)
+	}
+	switch len(listeners) {
+	case 0:
+		return nil, errors.New("no address to listen on")
+	case 1:
+		return listeners[0], nil
+	}
+	return newMultiListener(listeners), nil
+}
+
+// serve handles requests on listener, over TLS when srv has a TLS
+// configuration, until SIGINT or SIGTERM. It then stops accepting
+// connections, waits up to timeout for requests in flight to finish and
+// calls cleanup. It returns nil after a clean shutdown.
+func serve(srv *http.Server, listener net.Listener, timeout time.Duration, cleanup func()) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errs := make(chan error, 1)
+	go func() {
+		if srv.TLSConfig != nil {
+			errs <- srv.ServeTLS(listener, "", "")
+		} else {
+			errs <- srv.Serve(listener)
+		}
+	}()
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	// A second signal stops at once
+	stop()
+	notifySystemd("STOPPING=1")
+	log.Printf("Shutting down, waiting up to %s for requests in flight", timeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	err := srv.Shutdown(shutdownCtx)
+	if err != nil {
+		log.Printf("Warning: Requests still in flight were cut off: %v", err)
+	}
+	cleanup()
+	return err
+}
+
+// flush writes out everything held in memory: click counts, missing
+// shortcuts and queued click events, and closes the audit log
+func (s *Server) flush() {
+	if err := s.store.Flush(); err != nil {
+		log.Printf("Warning: Could not save click counts: %v", err)
+	}
+	if s.misses != nil {
+		if err := s.misses.Flush(); err != nil {
+			log.Printf("Warning: Could not save missing shortcuts: %v", err)
+		}
+	}
+	s.clickEvents.Close()
+	if s.auditLog != nil {
+		if err := s.auditLog.Close(); err != nil {
+			log.Printf("Warning: Could not close the audit log: %v", err)
+		}
+	}
+}
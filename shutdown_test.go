@@ -0,0 +1,123 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestGracefulShutdown(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("interrupts can't be sent to a process on Windows")
+	}
+	listener, err := listen("127.0.0.1:0", ListenConfig{ReusePort: true}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan bool)
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			started <- true
+			time.Sleep(200 * time.Millisecond)
+		}
+		io.WriteString(w, "done")
+	})}
+
+	cleanedUp := false
+	stopped := make(chan error)
+	go func() {
+		stopped <- serve(srv, listener, 5*time.Second, func() { cleanedUp = true })
+	}()
+	url := "http://" + listener.Addr().String()
+	// Without keep-alives, so no idle connection holds up shutting down
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	// Once a request is answered, serve is listening for signals
+	for {
+		if resp, err := client.Get(url + "/"); err == nil {
+			resp.Body.Close()
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	slow := make(chan string)
+	go func() {
+		resp, err := client.Get(url + "/slow")
+		if err != nil {
+			slow <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		slow <- string(body)
+	}()
+	<-started
+	self, _ := os.FindProcess(os.Getpid())
+	if err := self.Signal(os.Interrupt); err != nil {
+		t.Fatal(err)
+	}
+
+	if body := <-slow; body != "done" {
+		t.Errorf("request in flight during shutdown got %q, want it finished", body)
+	}
+	if err := <-stopped; err != nil {
+		t.Errorf("serve returned %v", err)
+	}
+	if !cleanedUp {
+		t.Error("cleanup wasn't called")
+	}
+	if _, err := client.Get(url + "/"); err == nil {
+		t.Error("still accepting connections after shutdown")
+	}
+}
+
+func TestReusePort(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("SO_REUSEPORT is Unix-only")
+	}
+	first, err := listen("127.0.0.1:0", ListenConfig{ReusePort: true}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	// A restarted server can bind the same port while the old one drains
+	second, err := listen(first.Addr().String(), ListenConfig{ReusePort: true}, false)
+	if err != nil {
+		t.Fatalf("binding the port again: %v", err)
+	}
+	second.Close()
+}
+
+func TestFlushOnShutdown(t *testing.T) {
+	s := newTestServer(t, Link{Shortcut: "wiki", URL: "https://wiki.example.com"})
+	s.store.RecordClick("", "wiki", clickSource{})
+	s.misses.Record("", "roadmap", time.Now())
+	sink := &recordingSink{batches: make(chan []ClickEvent, 10)}
+	s.clickEvents = NewClickEvents(sink)
+	s.clickEvents.Publish(ClickEvent{Shortcut: "wiki"})
+
+	s.flush()
+
+	if err := s.store.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if link, _ := s.store.Get("", "wiki"); link.Clicks != 1 {
+		t.Errorf("clicks after flushing and reloading = %d, want 1", link.Clicks)
+	}
+	misses := NewMissStore(s.misses.filePath)
+	if err := misses.Load(); err != nil || misses.Len() != 1 {
+		t.Errorf("missing shortcuts after flushing = %d, %v; want 1", misses.Len(), err)
+	}
+	// Queued events are sent before flush returns
+	select {
+	case batch := <-sink.batches:
+		if len(batch) != 1 {
+			t.Errorf("sent %d queued click events, want 1", len(batch))
+		}
+	default:
+		t.Error("queued click events weren't sent")
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// slackMaxAge is how old a signed Slack request may be, so captured
+// requests can't be replayed later
+const slackMaxAge = 5 * time.Minute
+
+// slackUsage explains the slash command
+const slackUsage = "Look up a link with `/golink gh`, or add one with `/golink add gh https://github.com [description]`."
+
+// Slack answers a Slack app's slash command, such as /golink, checking
+// each request is signed with the app's signing secret
+type Slack struct {
+	secret []byte
+}
+
+// NewSlack creates the slash command for the app's signing secret, or
+// returns nil if there is none
+func NewSlack(secret string) *Slack {
+	if secret = strings.TrimSpace(secret); secret == "" {
+		return nil
+	}
+	return &Slack{secret: []byte(secret)}
+}
+
+// verify checks body was signed by Slack, in the last few minutes
+func (sl *Slack) verify(header http.Header, body []byte, now time.Time) error {
+	timestamp := header.Get("X-Slack-Request-Timestamp")
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("missing request timestamp")
+	}
+	if age := now.Sub(time.Unix(seconds, 0)); age > slackMaxAge || age < -slackMaxAge {
+		return errors.New("request timestamp too far from now")
+	}
+	mac := hmac.New(sha256.New, sl.secret)
+	fmt.Fprintf(mac, "v0:%s:", timestamp)
+	mac.Write(body)
+	want := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(header.Get("X-Slack-Signature")), []byte(want)) {
+		return errors.New("bad signature")
+	}
+	return nil
+}
+
+// slackReply is a response to a slash command
+type slackReply struct {
+	ResponseType string `json:"response_type"`
+	Text         string `json:"text"`
+}
+
+// handleSlackCommand serves POST /slack/command, Slack's request for the
+// slash command: "/golink gh" looks up go/gh and "/golink add gh URL
+// [description]" adds it. Links are added in the default namespace,
+// credited to the Slack user as slack:<user ID>, which no go-links user can
+// be, and never replace existing ones.
+func (s *Server) handleSlackCommand(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	if err := s.slack.verify(r.Header, body, time.Now()); err != nil {
+		log.Printf("Rejected Slack command: %v", err)
+		http.Error(w, "Invalid signature", http.StatusUnauthorized)
+		return
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	text := s.slackCommand(r, form.Get("user_id"), form.Get("user_name"), strings.Fields(form.Get("text")))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(slackReply{ResponseType: "ephemeral", Text: text})
+}
+
+// slackCommand runs a slash command's words for the Slack user with
+// userID and name, returning the reply. Adding links is allowed as for
+// anyone not signed in to go-links: only while edit access is open to
+// everyone, and within their quota, by their Slack identity.
+func (s *Server) slackCommand(r *http.Request, userID, name string, words []string) string {
+	if len(words) == 0 || words[0] == "help" {
+		return slackUsage
+	}
+	if words[0] != "add" {
+		return s.slackLookup(strings.TrimPrefix(words[0], "go/"))
+	}
+	if len(words) < 3 {
+		return "Usage: `/golink add gh https://github.com [description]`"
+	}
+
+	shortcut := strings.TrimPrefix(words[1], "go/")
+	user := "slack:" + userID
+	switch _, exists := s.store.Get("", shortcut); {
+	case userID == "":
+		return "Your Slack user couldn't be told, add the link in go-links itself."
+	case s.roleOf(r) == roleViewer:
+		return "Adding links needs signing in, add it in go-links itself."
+	case s.changesRefused():
+		return "Links can't be added right now, go-links is read-only or down for maintenance."
+	case s.blocklist.Blocked(shortcut):
+		return fmt.Sprintf("go/%s is not allowed, please choose another shortcut.", shortcut)
+	case exists:
+		return fmt.Sprintf("go/%s already exists, change it in go-links itself.", shortcut)
+	case s.reserved[""]:
+		return "Only admins can add links, in go-links itself."
+	}
+	if _, ok := s.acl.Rule("", shortcut); ok {
+		return fmt.Sprintf("go/%s is in a team's space, add it in go-links itself.", shortcut)
+	}
+	if status, message, _ := s.userQuotaRefusal(user, user); status != 0 {
+		return message
+	}
+
+	fields := map[string]string{"url": words[2], "description": strings.Join(words[3:], " ")}
+	link, err := s.linkFromFields(func(name string) string { return fields[name] }, "", shortcut)
+	if err != nil {
+		return fmt.Sprintf("Couldn't add go/%s: %v", shortcut, err)
+	}
+	link.CreatedBy = user
+	if err := s.store.Add(link); err != nil {
+		logFor(r).Error("Saving link", "shortcut", shortcut, "error", err)
+		return "The link couldn't be saved. Please try again later."
+	}
+	saved, _ := s.store.Get("", shortcut)
+	entry := s.linkEntry(r, nil, &saved)
+	entry.Actor = user
+	s.record(entry)
+	log.Printf("Added go/%s from Slack (by %s, %s)", shortcut, user, name)
+	return fmt.Sprintf("Added go/%s → %s", shortcut, link.URL)
+}
+
+// slackLookup describes where a shortcut goes, suggesting others when it
+// doesn't exist. Links restricted to groups and archived links are left
+// out, as Slack users aren't known to go-links.
+func (s *Server) slackLookup(shortcut string) string {
+	link, ok := s.store.Get("", shortcut)
+	if ok && len(link.VisibleTo) == 0 && link.ArchivedAt.IsZero() && !s.blocklist.Blocked(shortcut) {
+		text := fmt.Sprintf("go/%s → %s", link.Shortcut, link.URL)
+		if link.Description != "" {
+			text += "\n" + link.Description
+		}
+		return text
+	}
+
+	links := s.store.GetAll("")
+	for key, link := range links {
+		if len(link.VisibleTo) > 0 || link.Hidden || !link.ArchivedAt.IsZero() || s.blocklist.Blocked(key) {
+			delete(links, key)
+		}
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "go/%s doesn't exist yet. Add it with `/golink add %s URL`.", shortcut, shortcut)
+	if suggestions := suggestLinks(links, shortcut, 3); len(suggestions) > 0 {
+		b.WriteString(" Did you mean:")
+		for _, suggestion := range suggestions {
+			fmt.Fprintf(&b, "\n• go/%s → %s", suggestion.Shortcut, suggestion.URL)
+		}
+	}
+	return b.String()
+}
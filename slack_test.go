@@ -0,0 +1,111 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// slackRequest signs a slash command request as Slack would, at t
+func slackRequest(secret, text string, t time.Time) *http.Request {
+	body := url.Values{"command": {"/golink"}, "text": {text}, "user_id": {"U0ALICE"}, "user_name": {"alice"}}.Encode()
+	timestamp := strconv.FormatInt(t.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "v0:%s:%s", timestamp, body)
+	r := httptest.NewRequest("POST", "/slack/command", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("X-Slack-Request-Timestamp", timestamp)
+	r.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+	return r
+}
+
+func TestSlackCommand(t *testing.T) {
+	s := newTestServer(t, Link{Shortcut: "github", URL: "https://github.com", Description: "Our code"})
+	s.slack = NewSlack("8f742231b10e8888abcd99yyyzzz85a5")
+	command := func(text string) string {
+		w := httptest.NewRecorder()
+		s.handleSlackCommand(w, slackRequest("8f742231b10e8888abcd99yyyzzz85a5", text, time.Now()))
+		var reply slackReply
+		if err := json.NewDecoder(w.Body).Decode(&reply); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("/golink %s: status %d, %v", text, w.Code, err)
+		}
+		return reply.Text
+	}
+
+	if reply := command("github"); !strings.Contains(reply, "https://github.com") || !strings.Contains(reply, "Our code") {
+		t.Errorf("looking up github = %q", reply)
+	}
+	if reply := command("githb"); !strings.Contains(reply, "doesn't exist") || !strings.Contains(reply, "go/github") {
+		t.Errorf("looking up a typo = %q, want a suggestion", reply)
+	}
+	if reply := command("add gh https://github.com/my-org Org repos"); !strings.HasPrefix(reply, "Added go/gh") {
+		t.Errorf("adding gh = %q", reply)
+	}
+	if link, ok := s.store.Get("", "gh"); !ok || link.URL != "https://github.com/my-org" || link.Description != "Org repos" || link.CreatedBy != "slack:U0ALICE" {
+		t.Errorf("added link = %+v, %v", link, ok)
+	}
+	if reply := command("add gh https://gitlab.com"); !strings.Contains(reply, "already exists") {
+		t.Errorf("adding gh again = %q, want it refused", reply)
+	}
+	if reply := command("add bad ftp://files"); !strings.HasPrefix(reply, "Couldn't add") {
+		t.Errorf("adding a bad URL = %q", reply)
+	}
+
+	// Slack users have quotas, by their Slack identity
+	s.quotas, _ = NewQuotas("2", "", "")
+	if reply := command("add ci https://ci.example.com"); !strings.HasPrefix(reply, "Added go/ci") {
+		t.Errorf("adding ci = %q", reply)
+	}
+	if reply := command("add docs https://docs.example.com"); !strings.Contains(reply, "limit on links") {
+		t.Errorf("adding past the quota = %q", reply)
+	}
+
+	// And can't add links once editing needs signing in, as they aren't
+	s.quotas = nil
+	s.signInToEdit = true
+	if reply := command("add docs https://docs.example.com"); !strings.Contains(reply, "needs signing in") {
+		t.Errorf("adding with edit access restricted = %q", reply)
+	}
+	if _, ok := s.store.Get("", "docs"); ok {
+		t.Error("docs was added")
+	}
+}
+
+func TestSlackSignature(t *testing.T) {
+	s := newTestServer(t)
+	s.slack = NewSlack("secret")
+	for name, r := range map[string]*http.Request{
+		"wrong secret": slackRequest("other", "gh", time.Now()),
+		"replayed":     slackRequest("secret", "gh", time.Now().Add(-10*time.Minute)),
+	} {
+		w := httptest.NewRecorder()
+		s.handleSlackCommand(w, r)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("%s: status %d, want 401", name, w.Code)
+		}
+	}
+}
+
+func TestSlackRoute(t *testing.T) {
+	s := newTestServer(t, Link{Shortcut: "github", URL: "https://github.com"})
+	s.slack = NewSlack("secret")
+	mux := http.NewServeMux()
+	s.routes(mux, newDebugHandler(s.startedAt))
+	// As main serves it, past CSRF protection and read-only mode
+	handler := s.csrfProtect(s.rejectWrites(mux))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, slackRequest("secret", "github", time.Now()))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "https://github.com") {
+		t.Errorf("POST /slack/command: status %d: %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"cmp"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// maxSources caps how many referrers or clients are counted separately
+// per link; clicks from any more are counted under otherSource
+const maxSources = 20
+
+// Sources clicks are counted under when they can't be told apart
+const (
+	directSource = "direct"
+	otherSource  = "other"
+)
+
+// clickSource is where a click came from, as much as is kept of it: the
+// referring site and the kind of browser, never the full referrer URL, the
+// user agent string or the visitor's IP address
+type clickSource struct {
+	Referrer string
+	Client   string
+}
+
+// newClickSource sums up where a redirect request came from
+func newClickSource(r *http.Request) clickSource {
+	return clickSource{
+		Referrer: referrerSource(r.Referer(), r.Host),
+		Client:   clientSource(r.UserAgent()),
+	}
+}
+
+// knownReferrers names sites whose hostnames say less than their name,
+// keyed by hostname suffix
+var knownReferrers = []struct{ suffix, name string }{
+	{"slack.com", "Slack"},
+	{"teams.microsoft.com", "Teams"},
+	{"teams.live.com", "Teams"},
+	{"mail.google.com", "Gmail"},
+	{"outlook.office.com", "Outlook"},
+	{"outlook.office365.com", "Outlook"},
+	{"outlook.live.com", "Outlook"},
+	{"atlassian.net", "Confluence/Jira"},
+	{"notion.so", "Notion"},
+	{"google.com", "Google"},
+}
+
+// referrerSource names the site a click came from: "direct" without a
+// referrer, "go-links" from this server's own pages, a well-known site's
+// name, or else the referring hostname
+func referrerSource(referrer, host string) string {
+	if referrer == "" {
+		return directSource
+	}
+	u, err := url.Parse(referrer)
+	if err != nil || u.Hostname() == "" {
+		return otherSource
+	}
+	hostname := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	if own, _, _ := strings.Cut(strings.ToLower(host), ":"); hostname == strings.TrimPrefix(own, "www.") {
+		return "go-links"
+	}
+	for _, known := range knownReferrers {
+		if hostname == known.suffix || strings.HasSuffix(hostname, "."+known.suffix) {
+			return known.name
+		}
+	}
+	return hostname
+}
+
+// clientSource sums up a user agent as a browser and operating system,
+// e.g. "Chrome on macOS"
+func clientSource(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+	var browser string
+	switch {
+	case ua == "":
+		return "unknown"
+	case strings.HasPrefix(ua, "curl/"), strings.HasPrefix(ua, "wget/"):
+		return "command line"
+	case strings.Contains(ua, "bot"), strings.Contains(ua, "spider"), strings.Contains(ua, "crawl"):
+		return "bot"
+	case strings.Contains(ua, "edg/"):
+		browser = "Edge"
+	case strings.Contains(ua, "firefox/"), strings.Contains(ua, "fxios/"):
+		browser = "Firefox"
+	case strings.Contains(ua, "chrome/"), strings.Contains(ua, "crios/"):
+		browser = "Chrome"
+	case strings.Contains(ua, "safari/"):
+		browser = "Safari"
+	default:
+		browser = otherSource
+	}
+
+	switch {
+	case strings.Contains(ua, "iphone"), strings.Contains(ua, "ipad"):
+		return browser + " on iOS"
+	case strings.Contains(ua, "android"):
+		return browser + " on Android"
+	case strings.Contains(ua, "windows"):
+		return browser + " on Windows"
+	case strings.Contains(ua, "cros"):
+		return browser + " on ChromeOS"
+	case strings.Contains(ua, "mac os x"), strings.Contains(ua, "macintosh"):
+		return browser + " on macOS"
+	case strings.Contains(ua, "linux"):
+		return browser + " on Linux"
+	default:
+		return browser
+	}
+}
+
+// countSource returns a copy of counts with a click counted for source,
+// or for otherSource when maxSources are already counted. The map is
+// copied because links returned by Get share it.
+func countSource(counts map[string]int, source string) map[string]int {
+	if _, ok := counts[source]; !ok && len(counts) >= maxSources {
+		source = otherSource
+	}
+	counts = maps.Clone(counts)
+	if counts == nil {
+		counts = make(map[string]int, 1)
+	}
+	counts[source]++
+	return counts
+}
+
+// sourceCount is one line of a breakdown of clicks
+type sourceCount struct {
+	Source  string
+	Clicks  int
+	Percent int
+}
+
+// breakdown lists click counts by source, busiest first
+func breakdown(counts map[string]int) []sourceCount {
+	total := 0
+	for _, n := range counts {
+		total += n
+	}
+	lines := make([]sourceCount, 0, len(counts))
+	for source, n := range counts {
+		lines = append(lines, sourceCount{Source: source, Clicks: n, Percent: n * 100 / total})
+	}
+	slices.SortFunc(lines, func(a, b sourceCount) int {
+		return cmp.Or(b.Clicks-a.Clicks, strings.Compare(a.Source, b.Source))
+	})
+	return lines
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReferrerSource(t *testing.T) {
+	tests := map[string]string{
+		"":                                  "direct",
+		"https://app.slack.com/client/T01":  "Slack",
+		"https://mail.google.com/mail/u/0/": "Gmail",
+		"https://acme.atlassian.net/wiki/x": "Confluence/Jira",
+		"https://www.wiki.example.com/Home": "wiki.example.com",
+		"http://go/":                        "go-links",
+		"not a url":                         "other",
+	}
+	for referrer, want := range tests {
+		if got := referrerSource(referrer, "go"); got != want {
+			t.Errorf("referrerSource(%q) = %q, want %q", referrer, got, want)
+		}
+	}
+}
+
+func TestClientSource(t *testing.T) {
+	tests := map[string]string{
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36":                   "Chrome on macOS",
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36 Edg/126.0.0.0":           "Edge on Windows",
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile/15E148 Safari/604.1": "Safari on iOS",
+		"Mozilla/5.0 (X11; Linux x86_64; rv:127.0) Gecko/20100101 Firefox/127.0":                                                                  "Firefox on Linux",
+		"Mozilla/5.0 (Linux; Android 14) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Mobile Safari/537.36":                            "Chrome on Android",
+		"Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)":                                                                              "bot",
+		"curl/8.7.1": "command line",
+		"":           "unknown",
+	}
+	for ua, want := range tests {
+		if got := clientSource(ua); got != want {
+			t.Errorf("clientSource(%q) = %q, want %q", ua, got, want)
+		}
+	}
+}
+
+func TestCountSourceCapsSources(t *testing.T) {
+	var counts map[string]int
+	for i := range maxSources + 5 {
+		counts = countSource(counts, fmt.Sprintf("site%d.example.com", i))
+	}
+	counts = countSource(counts, "site0.example.com")
+	if len(counts) != maxSources+1 || counts[otherSource] != 5 || counts["site0.example.com"] != 2 {
+		t.Errorf("counted %d sources, other %d, site0 %d", len(counts), counts[otherSource], counts["site0.example.com"])
+	}
+}
+
+func TestClickSourcesAreRecorded(t *testing.T) {
+	s := newTestServer(t, Link{Shortcut: "wiki", URL: "https://wiki.example.com"})
+
+	follow := func(referrer string) {
+		r := httptest.NewRequest("GET", "/wiki", nil)
+		r.Header.Set("Referer", referrer)
+		r.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64; rv:127.0) Gecko/20100101 Firefox/127.0")
+		r.RemoteAddr = "203.0.113.9:4321"
+		s.handleHome(httptest.NewRecorder(), r)
+	}
+	follow("https://app.slack.com/client/T01/C02?secret=1")
+	follow("https://app.slack.com/client/T01/C03")
+	follow("")
+
+	link, _ := s.store.Get("", "wiki")
+	if link.Referrers["Slack"] != 2 || link.Referrers["direct"] != 1 || link.Clients["Firefox on Linux"] != 3 {
+		t.Errorf("referrers %v, clients %v", link.Referrers, link.Clients)
+	}
+
+	// Edits keep the counts
+	if _, err := s.store.Update(Link{Shortcut: "wiki", URL: "https://wiki.example.com/new"}); err != nil {
+		t.Fatal(err)
+	}
+	link, _ = s.store.Get("", "wiki")
+	if link.Referrers["Slack"] != 2 {
+		t.Errorf("referrers after an edit = %v", link.Referrers)
+	}
+
+	r := httptest.NewRequest("GET", "/links/wiki", nil)
+	r.SetPathValue("shortcut", "wiki")
+	w := httptest.NewRecorder()
+	s.handleDetail(w, r)
+	body := w.Body.String()
+	if w.Code != http.StatusOK || !strings.Contains(body, "Slack") || !strings.Contains(body, "2 (66%)") {
+		t.Errorf("detail page status %d is missing the breakdown:\n%s", w.Code, body)
+	}
+	for _, private := range []string{"203.0.113.9", "secret", "rv:127.0"} {
+		if strings.Contains(body, private) || strings.Contains(fmt.Sprint(link), private) {
+			t.Errorf("%q was kept", private)
+		}
+	}
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultUnusedDays is how long a link must go unused to be reported when
+// no number of days is asked for
+const defaultUnusedDays = 90
+
+// expiryActor is recorded in the audit log for changes made by the policy
+const expiryActor = "expiry policy"
+
+// lastUsed returns when a link was last followed, or created or edited if
+// it hasn't been followed since. Links added and last followed before
+// either was recorded have no last use.
+func lastUsed(link Link) time.Time {
+	last := link.LastClickedAt
+	if link.CreatedAt.After(last) {
+		last = link.CreatedAt
+	}
+	if n := len(link.History); n > 0 && link.History[n-1].ReplacedAt.After(last) {
+		last = link.History[n-1].ReplacedAt
+	}
+	for day := range link.DailyClicks {
+		if t, err := time.Parse(time.DateOnly, day); err == nil && t.After(last) {
+			last = t
+		}
+	}
+	return last
+}
+
+// unusedSince returns the links not followed since the given time, least
+// recently used first
+func unusedSince(links []Link, since time.Time) []Link {
+	var unused []Link
+	for _, link := range links {
+		if lastUsed(link).Before(since) {
+			unused = append(unused, link)
+		}
+	}
+	slices.SortStableFunc(unused, func(a, b Link) int {
+		return lastUsed(a).Compare(lastUsed(b))
+	})
+	return unused
+}
+
+// parseDays parses a number of days from configuration or a query string,
+// defaulting to def when it is empty
+func parseDays(value string, def int) (int, error) {
+	if value == "" {
+		return def, nil
+	}
+	days, err := strconv.Atoi(strings.TrimSuffix(value, "d"))
+	if err != nil || days < 1 {
+		return 0, fmt.Errorf("%q isn't a number of days", value)
+	}
+	return days, nil
+}
+
+// ExpiryPolicy archives links nobody has used for a while. A link unused
+// for the configured number of days is first flagged and its owner told;
+// if it still isn't followed or edited within the grace period it is
+// archived, after which it no longer redirects until restored.
+type ExpiryPolicy struct {
+	after   time.Duration
+	grace   time.Duration
+	webhook string // where owners are told of links about to be archived
+	client  *http.Client
+}
+
+// NewExpiryPolicy creates the expiry policy from the number of days links
+// may go unused, the grace period in days (14 by default) and an optional
+// webhook URL for notifying owners. With no number of days it returns nil:
+// links are never archived.
+func NewExpiryPolicy(after, grace, webhook string) (*ExpiryPolicy, error) {
+	if after == "" {
+		return nil, nil
+	}
+	afterDays, err := parseDays(after, 0)
+	if err != nil {
+		return nil, err
+	}
+	graceDays, err := parseDays(grace, 14)
+	if err != nil {
+		return nil, err
+	}
+	if webhook != "" {
+		if u, err := url.Parse(webhook); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return nil, fmt.Errorf("webhook %q must be an http or https URL", webhook)
+		}
+	}
+	return &ExpiryPolicy{
+		after:   time.Duration(afterDays) * 24 * time.Hour,
+		grace:   time.Duration(graceDays) * 24 * time.Hour,
+		webhook: webhook,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// expiryNotice tells an owner that links of theirs are about to be
+// archived
+type expiryNotice struct {
+	Owner     string          `json:"owner"`
+	ArchiveAt time.Time       `json:"archive_at"`
+	Links     []unusedLinkRow `json:"links"`
+}
+
+// Apply flags links that have gone unused, archives flagged links whose
+// grace period is over, and notifies owners of newly flagged links. It
+// returns how many links were flagged and archived.
+func (ep *ExpiryPolicy) Apply(s *Server, now time.Time) (flagged, archived int) {
+	var entries []AuditEntry
+	notices := make(map[string]*expiryNotice)
+	for _, link := range unusedSince(s.store.All(), now.Add(-ep.after)) {
+		if !link.ArchivedAt.IsZero() {
+			continue
+		}
+		if link.ExpiryWarnedAt.IsZero() {
+			if _, ok, err := s.store.Mark(link.Namespace, link.Shortcut, func(l Link) Link { l.ExpiryWarnedAt = now; return l }); err != nil || !ok {
+				continue
+			}
+			flagged++
+			owner := cmp.Or(link.Owner, link.CreatedBy)
+			if notices[owner] == nil {
+				notices[owner] = &expiryNotice{Owner: owner, ArchiveAt: now.Add(ep.grace)}
+			}
+			notices[owner].Links = append(notices[owner].Links, newUnusedLinkRow(link))
+			continue
+		}
+		if now.Sub(link.ExpiryWarnedAt) < ep.grace {
+			continue
+		}
+		// Unless it has been followed since
+		old, ok, err := s.store.Mark(link.Namespace, link.Shortcut, func(l Link) Link {
+			if !l.ExpiryWarnedAt.IsZero() {
+				l.ArchivedAt = now
+			}
+			return l
+		})
+		saved, _ := s.store.Get(link.Namespace, link.Shortcut)
+		if err != nil || !ok || saved.ArchivedAt.IsZero() {
+			continue
+		}
+		archived++
+		entries = append(entries, AuditEntry{
+			Time:      now.UTC(),
+			Actor:     expiryActor,
+			Action:    auditArchive,
+			Namespace: link.Namespace,
+			Shortcut:  link.Shortcut,
+			Old:       auditLink(old, true),
+			New:       auditLink(saved, true),
+		})
+	}
+	s.record(entries...)
+
+	for _, notice := range notices {
+		ep.notify(notice)
+	}
+	return flagged, archived
+}
+
+// notify tells an owner about links that will be archived, by webhook if
+// one is configured and in the log either way
+func (ep *ExpiryPolicy) notify(notice *expiryNotice) {
+	shortcuts := make([]string, len(notice.Links))
+	for i, link := range notice.Links {
+		shortcuts[i] = link.Shortcut
+	}
+	log.Printf("Unused links of %q will be archived on %s: %s", cmp.Or(notice.Owner, "nobody"),
+		notice.ArchiveAt.Format(time.DateOnly), strings.Join(shortcuts, ", "))
+	if ep.webhook == "" {
+		return
+	}
+
+	body, err := json.Marshal(notice)
+	if err != nil {
+		return
+	}
+	resp, err := ep.client.Post(ep.webhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("Warning: Could not notify %q of unused links: %v", notice.Owner, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("Warning: Could not notify %q of unused links: webhook returned %s", notice.Owner, resp.Status)
+	}
+}
+
+// Job returns the background job applying the policy at each interval,
+// starting straight away
+func (ep *ExpiryPolicy) Job(s *Server, interval time.Duration) Job {
+	return Job{Name: "expire_links", Every: interval, RunAtStart: true, LeaderOnly: true, Run: func() error {
+		if s.maintenance.Active() {
+			return nil
+		}
+		if flagged, archived := ep.Apply(s, time.Now()); flagged > 0 || archived > 0 {
+			log.Printf("Expiry policy flagged %d unused links and archived %d", flagged, archived)
+		}
+		return nil
+	}}
+}
+
+// unusedLinkRow is a link in the unused-link report
+type unusedLinkRow struct {
+	Namespace  string    `json:"namespace,omitempty"`
+	Shortcut   string    `json:"shortcut"`
+	URL        string    `json:"url"`
+	Owner      string    `json:"owner,omitempty"`
+	CreatedBy  string    `json:"created_by,omitempty"`
+	Clicks     int       `json:"clicks"`
+	LastUsed   time.Time `json:"last_used,omitzero"`
+	WarnedAt   time.Time `json:"warned_at,omitzero"`
+	ArchivedAt time.Time `json:"archived_at,omitzero"`
+}
+
+func newUnusedLinkRow(link Link) unusedLinkRow {
+	return unusedLinkRow{
+		Namespace:  link.Namespace,
+		Shortcut:   link.Shortcut,
+		URL:        link.URL,
+		Owner:      link.Owner,
+		CreatedBy:  link.CreatedBy,
+		Clicks:     link.Clicks,
+		LastUsed:   lastUsed(link),
+		WarnedAt:   link.ExpiryWarnedAt,
+		ArchivedAt: link.ArchivedAt,
+	}
+}
+
+// unusedReport returns the links the request may see that haven't been
+// used in the number of days asked for by its days parameter
+func (s *Server) unusedReport(r *http.Request) (int, []unusedLinkRow, error) {
+	days, err := parseDays(r.URL.Query().Get("days"), defaultUnusedDays)
+	if err != nil {
+		return 0, nil, err
+	}
+	links := s.visibleLinks(r, s.hosts.Namespace(r))
+	rows := []unusedLinkRow{}
+	for _, link := range unusedSince(slices.Collect(maps.Values(links)), time.Now().AddDate(0, 0, -days)) {
+		rows = append(rows, newUnusedLinkRow(link))
+	}
+	return days, rows, nil
+}
+
+// handleUnused serves GET /api/unused, the links not used in the last
+// ?days= days (90 by default), least recently used first
+func (s *Server) handleUnused(w http.ResponseWriter, r *http.Request) {
+	_, rows, err := s.unusedReport(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rows)
+}
+
+// handleAdminUnused serves GET /admin/unused, the unused-link report with
+// buttons to archive and restore links
+func (s *Server) handleAdminUnused(w http.ResponseWriter, r *http.Request) {
+	days, rows, err := s.unusedReport(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	data := struct {
+		Prefix      string
+		Theme       *Theme
+		Maintenance *maintenanceState
+		CSRFToken   string
+		Lang        *translator
+		Done        string
+		Days        int
+		Links       []unusedLinkRow
+		Policy      *ExpiryPolicy
+	}{
+		Prefix:      s.hosts.Prefix(r),
+		Theme:       s.theme.Load(),
+		Maintenance: s.maintenance.State(),
+		CSRFToken:   s.csrfToken(w, r),
+		Lang:        translatorFor(w, r),
+		Done:        r.URL.Query().Get("done"),
+		Days:        days,
+		Links:       rows,
+		Policy:      s.expiry,
+	}
+
+	writePage(w, http.StatusOK, "unused.html", data, "Unused-link report unavailable")
+}
+
+// handleAdminArchive serves POST /admin/unused/archive and
+// /admin/unused/restore, archiving a link by hand or bringing an archived
+// one back
+func (s *Server) handleAdminArchive(w http.ResponseWriter, r *http.Request) {
+	namespace, shortcut := s.hosts.Namespace(r), r.PostFormValue("shortcut")
+	restore := strings.HasSuffix(r.URL.Path, "/restore")
+	old, ok, err := s.store.Mark(namespace, shortcut, func(link Link) Link {
+		if restore {
+			link.ArchivedAt, link.ExpiryWarnedAt = time.Time{}, time.Time{}
+			// Count restoring as a use, so the policy doesn't archive it again straight away
+			link.LastClickedAt = time.Now().UTC()
+		} else {
+			link.ArchivedAt = time.Now().UTC()
+		}
+		return link
+	})
+	if err != nil {
+		http.Error(w, "Failed to save link", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "Link not found", http.StatusNotFound)
+		return
+	}
+
+	saved, _ := s.store.Get(namespace, shortcut)
+	entry := s.linkEntry(r, auditLink(old, true), auditLink(saved, true))
+	done := "Archived " + shortcut
+	entry.Action = auditArchive
+	if restore {
+		done = "Restored " + shortcut
+		entry.Action = auditRestore
+	}
+	s.record(entry)
+	http.Redirect(w, r, "/admin/unused?done="+url.QueryEscape(done), http.StatusSeeOther)
+}
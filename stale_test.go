@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLastUsed(t *testing.T) {
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clicked := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	edited := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		link Link
+		want time.Time
+	}{
+		{Link{}, time.Time{}},
+		{Link{CreatedAt: created}, created},
+		{Link{CreatedAt: created, LastClickedAt: clicked}, clicked},
+		{Link{CreatedAt: created, DailyClicks: map[string]int{"2024-02-01": 1}}, clicked},
+		{Link{LastClickedAt: clicked, History: []Revision{{ReplacedAt: edited}}}, edited},
+	}
+	for _, tc := range tests {
+		if got := lastUsed(tc.link); !got.Equal(tc.want) {
+			t.Errorf("lastUsed(%+v) = %v, want %v", tc.link, got, tc.want)
+		}
+	}
+}
+
+func TestNewExpiryPolicy(t *testing.T) {
+	if ep, err := NewExpiryPolicy("", "", ""); ep != nil || err != nil {
+		t.Errorf("NewExpiryPolicy with no days = %v, %v, want disabled", ep, err)
+	}
+	for _, config := range [][3]string{{"soon", "", ""}, {"90", "0", ""}, {"90", "", "ftp://hooks.example.com"}} {
+		if _, err := NewExpiryPolicy(config[0], config[1], config[2]); err == nil {
+			t.Errorf("NewExpiryPolicy%q succeeded, want an error", config)
+		}
+	}
+}
+
+func TestExpiryPolicy(t *testing.T) {
+	now := time.Now().UTC()
+	old := now.AddDate(0, 0, -200)
+	s := newTestServer(t,
+		Link{Shortcut: "stale", URL: "https://old.example.com", Owner: "alice@example.com", CreatedAt: old},
+		Link{Shortcut: "revived", URL: "https://old.example.com/2", Owner: "alice@example.com", CreatedAt: old},
+		Link{Shortcut: "busy", URL: "https://busy.example.com", CreatedAt: old, LastClickedAt: now.AddDate(0, 0, -1)},
+	)
+
+	var notices []expiryNotice
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var notice expiryNotice
+		json.NewDecoder(r.Body).Decode(&notice)
+		notices = append(notices, notice)
+	}))
+	defer hook.Close()
+	ep, err := NewExpiryPolicy("180", "14", hook.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Unused links are flagged and their owners told
+	if flagged, archived := ep.Apply(s, now); flagged != 2 || archived != 0 {
+		t.Errorf("first run flagged %d and archived %d, want 2 and 0", flagged, archived)
+	}
+	if len(notices) != 1 || notices[0].Owner != "alice@example.com" || len(notices[0].Links) != 2 {
+		t.Errorf("notices = %+v, want one to alice about two links", notices)
+	}
+
+	// Following a flagged link keeps it
+	s.handleHome(httptest.NewRecorder(), httptest.NewRequest("GET", "/revived", nil))
+
+	// Nothing happens until the grace period is over...
+	if flagged, archived := ep.Apply(s, now.AddDate(0, 0, 7)); flagged != 0 || archived != 0 {
+		t.Errorf("run in the grace period flagged %d and archived %d, want none", flagged, archived)
+	}
+	// ...when the links still unused are archived
+	if flagged, archived := ep.Apply(s, now.AddDate(0, 0, 15)); flagged != 0 || archived != 1 {
+		t.Errorf("run after the grace period flagged %d and archived %d, want 0 and 1", flagged, archived)
+	}
+	if link, _ := s.store.Get("", "stale"); link.ArchivedAt.IsZero() {
+		t.Fatal("stale wasn't archived")
+	}
+	if link, _ := s.store.Get("", "revived"); !link.ArchivedAt.IsZero() || !link.ExpiryWarnedAt.IsZero() {
+		t.Errorf("revived = %+v, want it kept and unflagged", link)
+	}
+
+	// Archived links don't redirect and aren't listed
+	w := httptest.NewRecorder()
+	s.handleHome(w, httptest.NewRequest("GET", "/stale", nil))
+	if w.Code != http.StatusGone {
+		t.Errorf("archived link: status %d, want %d", w.Code, http.StatusGone)
+	}
+	w = httptest.NewRecorder()
+	s.handleHome(w, httptest.NewRequest("GET", "/", nil))
+	if strings.Contains(w.Body.String(), "/stale") {
+		t.Error("homepage lists an archived link")
+	}
+
+	// Admins can restore them
+	form := url.Values{"shortcut": {"stale"}}
+	r := httptest.NewRequest("POST", "/admin/unused/restore", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	s.handleAdminArchive(w, r)
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("restore: status %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	s.handleHome(w, httptest.NewRequest("GET", "/stale", nil))
+	if w.Code != http.StatusFound {
+		t.Errorf("restored link: status %d, want %d", w.Code, http.StatusFound)
+	}
+}
+
+func TestUnusedReport(t *testing.T) {
+	now := time.Now().UTC()
+	created := now.AddDate(-2, 0, 0)
+	s := newTestServer(t,
+		Link{Shortcut: "ancient", URL: "https://a.example.com", CreatedAt: created},
+		Link{Shortcut: "older", URL: "https://b.example.com", CreatedAt: created, LastClickedAt: now.AddDate(0, 0, -100)},
+		Link{Shortcut: "recent", URL: "https://c.example.com", CreatedAt: created, LastClickedAt: now.AddDate(0, 0, -10)},
+		Link{Shortcut: "secret", URL: "https://d.example.com", CreatedAt: created, Hidden: true, CreatedBy: "alice@example.com"},
+	)
+
+	unused := func(query string) (int, string) {
+		w := httptest.NewRecorder()
+		s.handleUnused(w, httptest.NewRequest("GET", "/api/unused"+query, nil))
+		var rows []unusedLinkRow
+		json.NewDecoder(w.Body).Decode(&rows)
+		var shortcuts []string
+		for _, row := range rows {
+			shortcuts = append(shortcuts, row.Shortcut)
+		}
+		return w.Code, strings.Join(shortcuts, ",")
+	}
+
+	for query, want := range map[string]string{
+		"":          "ancient,older",
+		"?days=5":   "ancient,older,recent",
+		"?days=365": "ancient",
+	} {
+		if code, got := unused(query); code != http.StatusOK || got != want {
+			t.Errorf("unused%s = %d %s, want %s", query, code, got, want)
+		}
+	}
+	if code, _ := unused("?days=lots"); code != http.StatusBadRequest {
+		t.Errorf("bad days: status %d, want %d", code, http.StatusBadRequest)
+	}
+}
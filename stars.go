@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+)
+
+// StarStore records which links each user has starred, persisted as JSON
+// alongside the links
+type StarStore struct {
+	mu       sync.RWMutex
+	stars    map[string][]linkKey // user -> starred links
+	filePath string
+}
+
+// starRecord is how a user's stars are written to the JSON file
+type starRecord struct {
+	User      string `json:"user"`
+	Namespace string `json:"namespace,omitempty"`
+	Shortcut  string `json:"shortcut"`
+}
+
+// NewStarStore creates a star store backed by filePath; call Load to read it
+func NewStarStore(filePath string) *StarStore {
+	return &StarStore{
+		stars:    make(map[string][]linkKey),
+		filePath: filePath,
+	}
+}
+
+// Load reads stars from the JSON file. A missing file means no stars.
+func (ss *StarStore) Load() error {
+	data, err := os.ReadFile(ss.filePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var records []starRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return err
+	}
+
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	for _, rec := range records {
+		ss.stars[rec.User] = append(ss.stars[rec.User], linkKey{rec.Namespace, rec.Shortcut})
+	}
+	return nil
+}
+
+// save writes stars to the JSON file; the caller must hold ss.mu
+func (ss *StarStore) save() error {
+	records := []starRecord{}
+	for user, keys := range ss.stars {
+		for _, key := range keys {
+			records = append(records, starRecord{user, key.namespace, key.shortcut})
+		}
+	}
+
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(ss.filePath, data, 0644)
+}
+
+// Toggle stars a link for user, or unstars it if it was already starred,
+// and reports whether it is now starred
+func (ss *StarStore) Toggle(user, namespace, shortcut string) (bool, error) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	key := linkKey{namespace, shortcut}
+	if i := slices.Index(ss.stars[user], key); i >= 0 {
+		ss.stars[user] = slices.Delete(slices.Clone(ss.stars[user]), i, i+1)
+		return false, ss.save()
+	}
+	ss.stars[user] = append(ss.stars[user], key)
+	return true, ss.save()
+}
+
+// Starred returns the shortcuts user has starred in a namespace
+func (ss *StarStore) Starred(user, namespace string) map[string]bool {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+	starred := make(map[string]bool)
+	for _, key := range ss.stars[user] {
+		if key.namespace == namespace {
+			starred[key.shortcut] = true
+		}
+	}
+	return starred
+}
+
+// handleStar serves POST /api/stars/{shortcut}, toggling the signed-in
+// user's star on a link and returning {"starred": true|false}
+func (s *Server) handleStar(w http.ResponseWriter, r *http.Request) {
+	user := s.currentUser(r)
+	if user == "" {
+		http.Error(w, "Sign in to star links", http.StatusUnauthorized)
+		return
+	}
+
+	namespace, shortcut := s.hosts.Namespace(r), r.PathValue("shortcut")
+	if _, exists := s.store.Get(namespace, shortcut); !exists {
+		http.Error(w, "Link not found", http.StatusNotFound)
+		return
+	}
+
+	starred, err := s.stars.Toggle(user, namespace, shortcut)
+	if err != nil {
+		http.Error(w, "Failed to save stars", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"starred": starred})
+}
+
+// handleMyLinks serves GET /my, the signed-in user's links: the ones they
+// starred, the ones they created and the ones their groups own
+func (s *Server) handleMyLinks(w http.ResponseWriter, r *http.Request) {
+	user := s.currentUser(r)
+	namespace := s.hosts.Namespace(r)
+
+	var created, starredLinks, teamLinks []Link
+	starred := map[string]bool{}
+	if user != "" {
+		starred = s.stars.Starred(user, namespace)
+		groups := s.currentGroups(r)
+		for _, link := range searchLinks(s.visibleLinks(r, namespace), "") {
+			if starred[link.Shortcut] {
+				starredLinks = append(starredLinks, link)
+			}
+			if link.CreatedBy == user {
+				created = append(created, link)
+			} else if group, ok := ownerGroup(link); ok && inGroup(groups, group) {
+				teamLinks = append(teamLinks, link)
+			}
+		}
+	}
+
+	data := struct {
+		Prefix      string
+		Theme       *Theme
+		Maintenance *maintenanceState
+		CSRFToken   string
+		Lang        *translator
+		User        string
+		Starred     []Link
+		Created     []Link
+		Team        []Link
+		Stars       map[string]bool
+	}{
+		Prefix:      s.hosts.Prefix(r),
+		Theme:       s.theme.Load(),
+		Maintenance: s.maintenance.State(),
+		CSRFToken:   s.csrfToken(w, r),
+		Lang:        translatorFor(w, r),
+		User:        user,
+		Starred:     starredLinks,
+		Created:     created,
+		Team:        teamLinks,
+		Stars:       starred,
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	if err := templates.ExecuteTemplate(w, "my.html", data); err != nil {
+		http.Error(w, "Template execution error", http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMyLinks(t *testing.T) {
+	s := newTestServer(t,
+		Link{Shortcut: "mine", URL: "https://mine.example.com", CreatedBy: "alice@example.com"},
+		Link{Shortcut: "theirs", URL: "https://theirs.example.com", CreatedBy: "bob@example.com"},
+		Link{Shortcut: "popular", URL: "https://popular.example.com"},
+	)
+	s.userHeader = "X-Forwarded-Email"
+	s.proxies = httptestProxy
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/stars/{shortcut...}", s.handleStar)
+	mux.HandleFunc("GET /my", s.handleMyLinks)
+
+	request := func(method, target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		req.Header.Set("X-Forwarded-Email", "alice@example.com")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := request("POST", "/api/stars/popular"); !strings.Contains(w.Body.String(), `"starred":true`) {
+		t.Fatalf("starring: %d %s", w.Code, w.Body)
+	}
+
+	body := request("GET", "/my").Body.String()
+	for _, want := range []string{"go/mine", "go/popular"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("my links page is missing %q", want)
+		}
+	}
+	if strings.Contains(body, "go/theirs") {
+		t.Errorf("my links page shows someone else's link")
+	}
+
+	if w := request("POST", "/api/stars/popular"); !strings.Contains(w.Body.String(), `"starred":false`) {
+		t.Errorf("unstarring: %d %s", w.Code, w.Body)
+	}
+
+	// Without an identity there is nothing to star with
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("POST", "/api/stars/popular", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous star: status %d, want 401", w.Code)
+	}
+}
+
+func TestStarStorePersists(t *testing.T) {
+	path := t.TempDir() + "/stars.json"
+	ss := NewStarStore(path)
+	if _, err := ss.Toggle("alice", "wiki", "onboarding"); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded := NewStarStore(path)
+	if err := reloaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if !reloaded.Starred("alice", "wiki")["onboarding"] {
+		t.Errorf("star was not persisted")
+	}
+	if len(reloaded.Starred("alice", "")) != 0 {
+		t.Errorf("star leaked into the default namespace")
+	}
+}
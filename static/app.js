@@ -0,0 +1,335 @@
+// send wraps fetch for state-changing requests, adding the page's CSRF token
+function send(url, options) {
+    var meta = document.querySelector('meta[name="csrf-token"]');
+    options.headers = { "X-CSRF-Token": meta ? meta.content : "" };
+    return fetch(url, options);
+}
+
+(function () {
+    // linkAPI returns the API URL for a shortcut, which may contain slashes
+    function linkAPI(shortcut) {
+        return "/api/links/" + shortcut.split("/").map(encodeURIComponent).join("/");
+    }
+
+    function editRow(shortcut) {
+        return Array.prototype.find.call(document.querySelectorAll(".edit-row"), function (row) {
+            return row.dataset.shortcut === shortcut;
+        });
+    }
+
+    function reportError(resp) {
+        return resp.text().then(function (text) {
+            alert(text.trim() || "Request failed");
+        });
+    }
+
+    document.addEventListener("click", function (event) {
+        var target = event.target;
+        if (target.dataset.star !== undefined) {
+            send("/api/stars/" + target.dataset.star.split("/").map(encodeURIComponent).join("/"), { method: "POST" })
+                .then(function (resp) {
+                    return resp.ok ? resp.json().then(function (result) {
+                        target.textContent = result.starred ? "★" : "☆";
+                        target.classList.toggle("starred", result.starred);
+                    }) : reportError(resp);
+                });
+        } else if (target.dataset.copy !== undefined) {
+            var label = target.textContent;
+            navigator.clipboard.writeText(target.dataset.copy).then(function () {
+                target.textContent = target.dataset.copied || "Copied!";
+                setTimeout(function () { target.textContent = label; }, 1500);
+            });
+        } else if (target.dataset.edit !== undefined) {
+            editRow(target.dataset.edit).hidden = false;
+        } else if (target.dataset.cancel !== undefined) {
+            var row = editRow(target.dataset.cancel);
+            row.querySelector("form").reset();
+            row.hidden = true;
+        } else if (target.dataset.delete !== undefined) {
+            var shortcut = target.dataset.delete;
+            if (!confirm(target.dataset.confirm || "Delete " + shortcut + "? This can't be undone.")) {
+                return;
+            }
+            send(linkAPI(shortcut), { method: "DELETE" }).then(function (resp) {
+                return resp.ok ? location.reload() : reportError(resp);
+            });
+        }
+    });
+
+    document.querySelectorAll(".edit-form").forEach(function (form) {
+        form.addEventListener("submit", function (event) {
+            event.preventDefault();
+            send(linkAPI(form.dataset.shortcut), {
+                method: "PUT",
+                body: new URLSearchParams(new FormData(form))
+            }).then(function (resp) {
+                return resp.ok ? location.reload() : reportError(resp);
+            });
+        });
+    });
+})();
+
+// Bulk actions on the links selected with the row checkboxes
+(function () {
+    var bar = document.getElementById("bulk-bar");
+    if (!bar) {
+        return;
+    }
+    var selectAll = document.getElementById("select-all");
+    var boxes = document.querySelectorAll(".select-link");
+    var action = document.getElementById("bulk-action");
+    var value = document.getElementById("bulk-value");
+
+    function selected() {
+        return Array.prototype.filter.call(boxes, function (box) {
+            return box.checked && !box.closest("tr").hidden;
+        }).map(function (box) { return box.value; });
+    }
+
+    function update() {
+        var count = selected().length;
+        bar.hidden = count === 0;
+        document.getElementById("bulk-count").textContent = count + " selected";
+        value.hidden = action.value === "delete";
+        selectAll.checked = count > 0 && count === boxes.length;
+    }
+
+    selectAll.addEventListener("change", function () {
+        boxes.forEach(function (box) {
+            if (!box.closest("tr").hidden) {
+                box.checked = selectAll.checked;
+            }
+        });
+        update();
+    });
+    boxes.forEach(function (box) { box.addEventListener("change", update); });
+    action.addEventListener("change", update);
+
+    document.getElementById("bulk-apply").addEventListener("click", function () {
+        var shortcuts = selected();
+        if (action.value === "delete" &&
+            !confirm("Delete " + shortcuts.length + " links? This can't be undone.")) {
+            return;
+        }
+
+        var body = new URLSearchParams();
+        body.set("action", action.value);
+        body.set("value", value.value);
+        shortcuts.forEach(function (shortcut) { body.append("shortcut", shortcut); });
+
+        send("/api/links/bulk", { method: "POST", body: body }).then(function (resp) {
+            if (!resp.ok) {
+                return resp.text().then(function (text) { alert(text.trim() || "Request failed"); });
+            }
+            return resp.json().then(function (result) {
+                if (result.conflicts) {
+                    alert("Not moved, the shortcut already exists there: " + result.conflicts.join(", "));
+                }
+                if (result.forbidden) {
+                    alert("Not changed, only their creator, owner or an admin can: " + result.forbidden.join(", "));
+                }
+                location.reload();
+            });
+        });
+    });
+})();
+
+(function () {
+    var input = document.getElementById("search");
+    if (!input) {
+        return;
+    }
+    var rows = document.querySelectorAll(".link-item");
+    var noResults = document.getElementById("no-results");
+    var suggestions = document.getElementById("suggestions");
+    var pending = null;
+
+    // highlight wraps case-insensitive matches of query in <mark>,
+    // working on text nodes so link values are never parsed as HTML
+    function highlight(row, query) {
+        row.querySelectorAll("mark").forEach(function (mark) {
+            mark.replaceWith(document.createTextNode(mark.textContent));
+        });
+        row.normalize();
+        if (!query) {
+            return;
+        }
+        var walker = document.createTreeWalker(row, NodeFilter.SHOW_TEXT);
+        var nodes = [];
+        while (walker.nextNode()) {
+            nodes.push(walker.currentNode);
+        }
+        nodes.forEach(function (node) {
+            var text = node.textContent;
+            var lower = text.toLowerCase();
+            var i = lower.indexOf(query);
+            if (i < 0) {
+                return;
+            }
+            var fragment = document.createDocumentFragment();
+            var last = 0;
+            for (; i >= 0; i = lower.indexOf(query, last)) {
+                fragment.appendChild(document.createTextNode(text.slice(last, i)));
+                var mark = document.createElement("mark");
+                mark.textContent = text.slice(i, i + query.length);
+                fragment.appendChild(mark);
+                last = i + query.length;
+            }
+            fragment.appendChild(document.createTextNode(text.slice(last)));
+            node.replaceWith(fragment);
+        });
+    }
+
+    function show(matches, query) {
+        var visible = 0;
+        rows.forEach(function (row) {
+            var match = matches[row.dataset.shortcut] === true;
+            row.hidden = !match;
+            highlight(row, match ? query : "");
+            if (match) {
+                visible++;
+            }
+        });
+        if (noResults) {
+            noResults.hidden = visible > 0;
+        }
+    }
+
+    // suggest fills the search box's dropdown with popular shortcuts
+    // matching what has been typed so far
+    function suggest(query, signal) {
+        fetch("/api/suggest?q=" + encodeURIComponent(query), { signal: signal })
+            .then(function (resp) { return resp.json(); })
+            .then(function (results) {
+                suggestions.replaceChildren();
+                results.forEach(function (result) {
+                    var option = document.createElement("option");
+                    option.value = result.shortcut;
+                    option.label = result.description || result.url;
+                    suggestions.appendChild(option);
+                });
+            })
+            .catch(function () {});
+    }
+
+    input.addEventListener("input", function () {
+        var query = input.value.trim().toLowerCase();
+        if (pending) {
+            pending.abort();
+        }
+        pending = new AbortController();
+        suggest(query, pending.signal);
+        fetch("/api/search?q=" + encodeURIComponent(query), { signal: pending.signal })
+            .then(function (resp) { return resp.json(); })
+            .then(function (links) {
+                var matches = {};
+                links.forEach(function (link) { matches[link.shortcut] = true; });
+                show(matches, query);
+            })
+            .catch(function () {});
+    });
+})();
+
+// Keyboard navigation: "/" focuses search, arrow keys (or j/k) move through
+// the visible links, Enter opens the selected one, "e" edits it and Escape
+// leaves the search box
+(function () {
+    var search = document.getElementById("search");
+    var selectedRow = null;
+
+    function visibleRows() {
+        return Array.prototype.filter.call(document.querySelectorAll(".link-item"), function (row) {
+            return !row.hidden;
+        });
+    }
+
+    function select(row) {
+        if (selectedRow) {
+            selectedRow.classList.remove("selected");
+        }
+        selectedRow = row;
+        if (row) {
+            row.classList.add("selected");
+            row.scrollIntoView({ block: "nearest" });
+        }
+    }
+
+    function move(step) {
+        var rows = visibleRows();
+        if (rows.length === 0) {
+            return;
+        }
+        var i = rows.indexOf(selectedRow);
+        if (i < 0) {
+            i = step > 0 ? 0 : rows.length - 1;
+        } else {
+            i = Math.min(Math.max(i + step, 0), rows.length - 1);
+        }
+        select(rows[i]);
+    }
+
+    document.addEventListener("keydown", function (event) {
+        if (event.ctrlKey || event.metaKey || event.altKey) {
+            return;
+        }
+        var target = event.target;
+        var inSearch = target === search;
+        var typing = !inSearch && (target.isContentEditable ||
+            ["INPUT", "TEXTAREA", "SELECT"].indexOf(target.tagName) >= 0);
+        if (typing) {
+            return;
+        }
+
+        switch (event.key) {
+        case "/":
+            if (search && !inSearch) {
+                event.preventDefault();
+                search.focus();
+                search.select();
+            }
+            break;
+        case "ArrowDown":
+        case "j":
+            if (event.key === "j" && inSearch) {
+                return;
+            }
+            event.preventDefault();
+            move(1);
+            break;
+        case "ArrowUp":
+        case "k":
+            if (event.key === "k" && inSearch) {
+                return;
+            }
+            event.preventDefault();
+            move(-1);
+            break;
+        case "Enter":
+            if (selectedRow && !selectedRow.hidden) {
+                event.preventDefault();
+                location.href = "/" + selectedRow.dataset.shortcut;
+            }
+            break;
+        case "e":
+            if (selectedRow && !inSearch) {
+                event.preventDefault();
+                selectedRow.querySelector("[data-edit]").click();
+                var edit = selectedRow.nextElementSibling;
+                if (edit) {
+                    edit.querySelector("input").focus();
+                }
+            }
+            break;
+        case "Escape":
+            if (inSearch) {
+                search.blur();
+            }
+            break;
+        }
+    });
+
+    // Searching changes which rows are visible, so start the selection over
+    if (search) {
+        search.addEventListener("input", function () { select(null); });
+    }
+})();
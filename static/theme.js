@@ -0,0 +1,31 @@
+// Loaded in <head> so a saved theme applies before the page paints; with no
+// saved choice the stylesheet follows prefers-color-scheme
+(function () {
+    var saved = localStorage.getItem("theme");
+    if (saved === "light" || saved === "dark") {
+        document.documentElement.dataset.theme = saved;
+    }
+
+    function current() {
+        return document.documentElement.dataset.theme ||
+            (matchMedia("(prefers-color-scheme: dark)").matches ? "dark" : "light");
+    }
+
+    document.addEventListener("DOMContentLoaded", function () {
+        var toggle = document.getElementById("theme-toggle");
+        if (!toggle) {
+            return;
+        }
+        function label() {
+            toggle.textContent = current() === "dark" ? "☀️" : "🌙";
+            toggle.title = current() === "dark" ? "Switch to light theme" : "Switch to dark theme";
+        }
+        label();
+        toggle.addEventListener("click", function () {
+            var next = current() === "dark" ? "light" : "dark";
+            document.documentElement.dataset.theme = next;
+            localStorage.setItem("theme", next);
+            label();
+        });
+    });
+})();
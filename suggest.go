@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// suggestion is a shortcut offered while typing or on the not-found page
+type suggestion struct {
+	Shortcut    string `json:"shortcut"`
+	URL         string `json:"url"`
+	Description string `json:"description,omitempty"`
+	Clicks      int    `json:"clicks"`
+}
+
+// suggestLinks returns up to limit links whose shortcut starts with query,
+// followed by links whose shortcut is a close misspelling of it or contains
+// its letters in order. Each group is ranked by popularity.
+func suggestLinks(links map[string]Link, query string, limit int) []suggestion {
+	return newSearchIndex(0, slices.Collect(maps.Values(links))).suggest(query, limit, nil)
+}
+
+// isSubsequence reports whether the letters of s appear in t in order,
+// e.g. "gdoc" in "google-docs"
+func isSubsequence(s, t string) bool {
+	for _, r := range t {
+		if s == "" {
+			break
+		}
+		if strings.HasPrefix(s, string(r)) {
+			s = s[len(string(r)):]
+		}
+	}
+	return s == ""
+}
+
+// withinEditDistance reports whether a can be turned into b with at most k
+// single-letter insertions, deletions, substitutions and adjacent swaps,
+// stopping as soon as it can't be
+func withinEditDistance(a, b string, k int) bool {
+	// Shortcuts are short, so this is called for many of them without
+	// allocating
+	var runesA, runesB [32]rune
+	var stack [3 * 33]int
+	ra, rb := appendRunes(runesA[:0], a), appendRunes(runesB[:0], b)
+	if abs(len(ra)-len(rb)) > k {
+		return false
+	}
+	// Only the last three rows are needed
+	rows := stack[:]
+	if 3*(len(rb)+1) > len(stack) {
+		rows = make([]int, 3*(len(rb)+1))
+	}
+	n := len(rb) + 1
+	before, prev, cur := rows[:n], rows[n:2*n], rows[2*n:3*n]
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		best := i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				cur[j] = min(cur[j], before[j-2]+1)
+			}
+			best = min(best, cur[j])
+		}
+		if best > k {
+			return false
+		}
+		before, prev, cur = prev, cur, before
+	}
+	return prev[len(rb)] <= k
+}
+
+// appendRunes appends the letters of s to runes
+func appendRunes(runes []rune, s string) []rune {
+	for _, r := range s {
+		runes = append(runes, r)
+	}
+	return runes
+}
+
+// handleSuggest serves GET /api/suggest?q=...&limit=... with shortcut
+// suggestions for the request's namespace as JSON
+func (s *Server) handleSuggest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit := 10
+	if n, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil {
+		limit = min(max(n, 1), 50)
+	}
+
+	index, visible := s.searchFor(r, s.hosts.Namespace(r))
+	results := index.suggest(r.URL.Query().Get("q"), limit, visible)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(results); err != nil {
+		http.Error(w, "Failed to encode suggestions", http.StatusInternalServerError)
+	}
+}
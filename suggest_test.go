@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSuggestLinksRanking(t *testing.T) {
+	links := map[string]Link{
+		"github":      {Shortcut: "github", Clicks: 5},
+		"gh":          {Shortcut: "gh", Clicks: 50},
+		"gha":         {Shortcut: "gha", Clicks: 1},
+		"google-docs": {Shortcut: "google-docs", Clicks: 100},
+		"jira":        {Shortcut: "jira", Clicks: 1000},
+	}
+
+	var got []string
+	for _, s := range suggestLinks(links, "gh", 10) {
+		got = append(got, s.Shortcut)
+	}
+
+	// Prefix matches by popularity, then fuzzy matches
+	want := []string{"gh", "gha", "github"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("suggestLinks(gh) = %v, want %v", got, want)
+	}
+
+	got = got[:0]
+	for _, s := range suggestLinks(links, "gdocs", 10) {
+		got = append(got, s.Shortcut)
+	}
+	if len(got) != 1 || got[0] != "google-docs" {
+		t.Errorf("suggestLinks(gdocs) = %v, want [google-docs]", got)
+	}
+
+	if got := suggestLinks(links, "jria", 10); len(got) != 1 || got[0].Shortcut != "jira" {
+		t.Errorf("suggestLinks(jria) = %v, want the jira link", got)
+	}
+}
+
+func TestNotFoundPageSuggestsShortcuts(t *testing.T) {
+	s := newTestServer(t, Link{Shortcut: "github", URL: "https://github.com"})
+
+	w := httptest.NewRecorder()
+	s.handleHome(w, httptest.NewRequest("GET", "/githbu", nil))
+
+	body := w.Body.String()
+	if w.Code != 404 {
+		t.Errorf("status = %d, want 404", w.Code)
+	}
+	for _, want := range []string{`href="/github"`, `href="/?shortcut=githbu"`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("not-found page is missing %q", want)
+		}
+	}
+}
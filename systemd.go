@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// passedSocket is a socket passed in by systemd socket activation
+type passedSocket struct {
+	name     string // FileDescriptorName=, by default the socket unit's name
+	listener net.Listener
+}
+
+// passedSockets takes the sockets passed in by systemd socket activation,
+// or anything following its LISTEN_FDS protocol, once. The variables are
+// cleared so processes started by the server don't take them as theirs.
+var passedSockets = sync.OnceValues(func() ([]passedSocket, error) {
+	defer func() {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	}()
+	if pid, _ := strconv.Atoi(os.Getenv("LISTEN_PID")); pid != os.Getpid() {
+		return nil, nil
+	}
+	fds, _ := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	files := make([]*os.File, max(fds, 0))
+	for i := range files {
+		// Passed sockets start after stdin, stdout and stderr
+		files[i] = os.NewFile(uintptr(3+i), "listener")
+	}
+	return socketsFrom(files, os.Getenv("LISTEN_FDNAMES"))
+})
+
+// socketsFrom turns passed files into listeners, named from the
+// colon-separated names, closing the files
+func socketsFrom(files []*os.File, names string) ([]passedSocket, error) {
+	nameList := strings.Split(names, ":")
+	var sockets []passedSocket
+	for i, file := range files {
+		name := "unknown"
+		if i < len(nameList) && nameList[i] != "" {
+			name = nameList[i]
+		}
+		listener, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("using the passed socket %q: %w", name, err)
+		}
+		sockets = append(sockets, passedSocket{name, listener})
+	}
+	return sockets, nil
+}
+
+// activatedListener returns the passed socket to serve on, or nil: the
+// one named "admin" for the management address, and otherwise the one
+// named "http" or, failing that, the first not named "admin"
+func activatedListener(sockets []passedSocket, admin bool) net.Listener {
+	want := "http"
+	if admin {
+		want = "admin"
+	}
+	for _, socket := range sockets {
+		if socket.name == want {
+			return socket.listener
+		}
+	}
+	if !admin {
+		for _, socket := range sockets {
+			if socket.name != "admin" {
+				return socket.listener
+			}
+		}
+	}
+	return nil
+}
+
+// sdNotify sends state, such as READY=1, to systemd when it is
+// supervising the server with Type=notify, and does nothing otherwise
+func sdNotify(state string) error {
+	addr := os.Getenv("NOTIFY_SOCKET")
+	if addr == "" {
+		return nil
+	}
+	if addr[0] == '@' {
+		// An abstract socket, on Linux
+		addr = "\x00" + addr[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// notifySystemd is sdNotify, logging rather than returning failures
+func notifySystemd(state string) {
+	if err := sdNotify(state); err != nil {
+		log.Printf("Warning: Could not notify systemd: %v", err)
+	}
+}
+
+// reloadingState tells systemd a reload has started, for Type=notify-reload
+func reloadingState() string {
+	state := "RELOADING=1"
+	if now := monotonicMicros(); now > 0 {
+		state += "\nMONOTONIC_USEC=" + strconv.FormatInt(now, 10)
+	}
+	return state
+}
+
+// watchdogInterval returns how often systemd expects to hear the server is
+// alive, from WatchdogSec=, or 0 when it isn't watching
+func watchdogInterval() time.Duration {
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// pingWatchdog tells systemd the server is alive, once the link store has
+// answered, so a server stuck on its lock is restarted
+func (s *Server) pingWatchdog() error {
+	s.store.Stats()
+	return sdNotify("WATCHDOG=1")
+}
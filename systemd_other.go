@@ -0,0 +1,8 @@
+//go:build !linux
+
+package main
+
+// monotonicMicros returns 0, as systemd only runs on Linux
+func monotonicMicros() int64 {
+	return 0
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSocketsFrom(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sockets can't be passed as files on Windows")
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	file, err := listener.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sockets, err := socketsFrom([]*os.File{file}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sockets) != 1 || sockets[0].name != "unknown" || sockets[0].listener.Addr().String() != listener.Addr().String() {
+		t.Fatalf("socketsFrom = %+v, want the listener on %s", sockets, listener.Addr())
+	}
+	sockets[0].listener.Close()
+}
+
+func TestActivatedListener(t *testing.T) {
+	socket := func(name string) passedSocket {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { l.Close() })
+		return passedSocket{name, l}
+	}
+	unit, admin, http := socket("go-links.socket"), socket("admin"), socket("http")
+
+	tests := []struct {
+		sockets []passedSocket
+		admin   bool
+		want    net.Listener
+	}{
+		{nil, false, nil},
+		{[]passedSocket{unit}, false, unit.listener},
+		{[]passedSocket{unit}, true, nil},
+		{[]passedSocket{admin, unit}, false, unit.listener},
+		{[]passedSocket{admin, unit}, true, admin.listener},
+		{[]passedSocket{admin}, false, nil},
+		{[]passedSocket{unit, http}, false, http.listener},
+	}
+	for i, tt := range tests {
+		if got := activatedListener(tt.sockets, tt.admin); got != tt.want {
+			t.Errorf("test %d: activatedListener(admin=%v) = %v, want %v", i, tt.admin, got, tt.want)
+		}
+	}
+}
+
+func TestSdNotify(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("systemd notifications use Unix datagram sockets")
+	}
+	t.Setenv("NOTIFY_SOCKET", "")
+	if err := sdNotify("READY=1"); err != nil {
+		t.Errorf("without systemd: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	t.Setenv("NOTIFY_SOCKET", path)
+	if err := sdNotify("READY=1\nSTATUS=Serving"); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, 256)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(buf[:n]); got != "READY=1\nSTATUS=Serving" {
+		t.Errorf("systemd was sent %q", got)
+	}
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	t.Setenv("WATCHDOG_PID", "")
+	t.Setenv("WATCHDOG_USEC", "")
+	if d := watchdogInterval(); d != 0 {
+		t.Errorf("without a watchdog = %v, want 0", d)
+	}
+	t.Setenv("WATCHDOG_USEC", "30000000")
+	if d := watchdogInterval(); d != 30*time.Second {
+		t.Errorf("WatchdogSec=30 = %v, want 30s", d)
+	}
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()+1))
+	if d := watchdogInterval(); d != 0 {
+		t.Errorf("another process's watchdog = %v, want 0", d)
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// colorPattern matches the accent colors operators may configure: hex
+// colors like #0a7 or #00aa77, or a CSS color name like "teal"
+var colorPattern = regexp.MustCompile(`^(#[0-9a-fA-F]{3,8}|[a-zA-Z]+)$`)
+
+// Theme holds operator branding shown on the homepage
+type Theme struct {
+	// LogoURL is an image shown beside the page title
+	LogoURL string
+
+	// Accent replaces the default accent color for buttons and links
+	Accent string
+}
+
+// NewTheme creates a theme from an optional logo URL and accent color
+func NewTheme(logoURL, accent string) (*Theme, error) {
+	t := &Theme{
+		LogoURL: strings.TrimSpace(logoURL),
+		Accent:  strings.TrimSpace(accent),
+	}
+
+	if t.Accent != "" && !colorPattern.MatchString(t.Accent) {
+		return nil, fmt.Errorf("accent color %q must be a hex color or CSS color name", t.Accent)
+	}
+
+	return t, nil
+}
@@ -0,0 +1,11 @@
+package main
+
+import "testing"
+
+func TestNewThemeRejectsUnsafeAccent(t *testing.T) {
+	for _, accent := range []string{"red; background: url(x)", "#zzz", "}</style><script>"} {
+		if _, err := NewTheme("", accent); err == nil {
+			t.Errorf("NewTheme accepted accent %q", accent)
+		}
+	}
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// tokenPrefix starts every API token, so leaked tokens are easy to
+	// recognise and scan for
+	tokenPrefix = "golinks_"
+
+	scopeRead  = "read"  // resolve and browse links
+	scopeWrite = "write" // also add, edit and delete them
+)
+
+// APIToken lets automation call the API as the user who created it,
+// without their password or session cookie. Only a hash of the secret is
+// stored.
+type APIToken struct {
+	ID        string    `json:"id"`
+	User      string    `json:"user"`
+	Name      string    `json:"name"`
+	Scope     string    `json:"scope"`
+	Roles     []string  `json:"roles,omitempty"`  // the creator's roles (see grantedRoles)
+	Groups    []string  `json:"groups,omitempty"` // the creator's groups, for ACLs
+	Hash      string    `json:"hash,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Permits reports whether the token's scope allows a request: read tokens
+// may only make safe requests
+func (t APIToken) Permits(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return t.Scope == scopeWrite
+}
+
+// TokenStore holds users' API tokens, persisted as JSON alongside the links
+type TokenStore struct {
+	mu       sync.RWMutex
+	tokens   []APIToken
+	filePath string
+}
+
+// NewTokenStore creates a token store backed by filePath; call Load to
+// read it
+func NewTokenStore(filePath string) *TokenStore {
+	return &TokenStore{filePath: filePath}
+}
+
+// Load reads tokens from the JSON file. A missing file means no tokens.
+func (ts *TokenStore) Load() error {
+	data, err := os.ReadFile(ts.filePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var tokens []APIToken
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return err
+	}
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.tokens = tokens
+	return nil
+}
+
+// save writes tokens to the JSON file; the caller must hold ts.mu
+func (ts *TokenStore) save() error {
+	data, err := json.MarshalIndent(ts.tokens, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(ts.filePath, data, 0600)
+}
+
+// Create issues a new token for user, returning it with its secret, which
+// is shown once and can't be recovered
+func (ts *TokenStore) Create(user, name, scope string, roles, groups []string) (APIToken, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return APIToken{}, "", &formError{"name", "Token name is required"}
+	}
+	if scope != scopeRead && scope != scopeWrite {
+		return APIToken{}, "", &formError{"scope", "Scope must be read or write"}
+	}
+
+	id := make([]byte, 8)
+	rand.Read(id)
+	secret := tokenPrefix + randomToken()
+	token := APIToken{
+		ID:        hex.EncodeToString(id),
+		User:      user,
+		Name:      name,
+		Scope:     scope,
+		Roles:     roles,
+		Groups:    groups,
+		Hash:      hashToken(secret),
+		CreatedAt: time.Now().UTC(),
+	}
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.tokens = append(ts.tokens, token)
+	if err := ts.save(); err != nil {
+		ts.tokens = ts.tokens[:len(ts.tokens)-1]
+		return APIToken{}, "", err
+	}
+	token.Hash = ""
+	return token, secret, nil
+}
+
+// List returns user's tokens, oldest first, without their hashes
+func (ts *TokenStore) List(user string) []APIToken {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	tokens := []APIToken{}
+	for _, token := range ts.tokens {
+		if token.User == user {
+			token.Hash = ""
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens
+}
+
+// Revoke deletes one of user's tokens, reporting whether it existed
+func (ts *TokenStore) Revoke(user, id string) (bool, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	i := slices.IndexFunc(ts.tokens, func(token APIToken) bool {
+		return token.User == user && token.ID == id
+	})
+	if i < 0 {
+		return false, nil
+	}
+	ts.tokens = slices.Delete(slices.Clone(ts.tokens), i, i+1)
+	return true, ts.save()
+}
+
+// FromRequest returns the API token a request presents as a bearer token
+func (ts *TokenStore) FromRequest(r *http.Request) (APIToken, bool) {
+	secret, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "+tokenPrefix)
+	if !ok {
+		return APIToken{}, false
+	}
+	hash := hashToken(tokenPrefix + secret)
+
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	for _, token := range ts.tokens {
+		if subtle.ConstantTimeCompare([]byte(token.Hash), []byte(hash)) == 1 {
+			return token, true
+		}
+	}
+	return APIToken{}, false
+}
+
+func hashToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// tokenOwner returns who may manage tokens on a request: the signed-in
+// user, unless they're using an API token, so a leaked token can't be used
+// to mint more
+func (s *Server) tokenOwner(r *http.Request) string {
+	if strings.HasPrefix(r.Header.Get("Authorization"), "Bearer "+tokenPrefix) {
+		return ""
+	}
+	return s.currentUser(r)
+}
+
+// grantedRoles returns the roles a new token carries: those the request's
+// session grants, and editor if the user creating it may edit. Like
+// sessions, tokens keep them (and the user's groups) until they're revoked.
+func (s *Server) grantedRoles(r *http.Request) []string {
+	var roles []string
+	if s.sessions != nil {
+		sess, _, _ := s.sessions.current(r)
+		roles = slices.Clone(sess.Roles)
+	}
+	if s.mayEdit(r) && !slices.Contains(roles, roleEditor) {
+		roles = append(roles, roleEditor)
+	}
+	return roles
+}
+
+// handleTokens serves GET /tokens, where signed-in users manage their API
+// tokens
+func (s *Server) handleTokens(w http.ResponseWriter, r *http.Request) {
+	s.renderTokens(w, r, http.StatusOK, "", "")
+}
+
+// handleTokenForm serves POST /tokens, creating a token from the form and
+// showing its secret once
+func (s *Server) handleTokenForm(w http.ResponseWriter, r *http.Request) {
+	user := s.tokenOwner(r)
+	if user == "" {
+		http.Error(w, "Sign in to create API tokens", http.StatusUnauthorized)
+		return
+	}
+
+	_, secret, err := s.tokens.Create(user, r.PostFormValue("name"), r.PostFormValue("scope"), s.grantedRoles(r), s.currentGroups(r))
+	if err != nil {
+		s.renderTokens(w, r, http.StatusBadRequest, "", err.Error())
+		return
+	}
+	s.renderTokens(w, r, http.StatusOK, secret, "")
+}
+
+// handleTokenRevokeForm serves POST /tokens/{id}/revoke
+func (s *Server) handleTokenRevokeForm(w http.ResponseWriter, r *http.Request) {
+	user := s.tokenOwner(r)
+	if user == "" {
+		http.Error(w, "Sign in to revoke API tokens", http.StatusUnauthorized)
+		return
+	}
+	if _, err := s.tokens.Revoke(user, r.PathValue("id")); err != nil {
+		http.Error(w, "Failed to save tokens", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/tokens", http.StatusSeeOther)
+}
+
+// renderTokens renders the token page, with a newly created secret or an
+// error when there is one
+func (s *Server) renderTokens(w http.ResponseWriter, r *http.Request, status int, secret, message string) {
+	user := s.tokenOwner(r)
+	data := struct {
+		Prefix      string
+		Theme       *Theme
+		Maintenance *maintenanceState
+		CSRFToken   string
+		Lang        *translator
+		User        string
+		Tokens      []APIToken
+		Secret      string
+		Error       string
+	}{
+		Prefix:      s.hosts.Prefix(r),
+		Theme:       s.theme.Load(),
+		Maintenance: s.maintenance.State(),
+		CSRFToken:   s.csrfToken(w, r),
+		Lang:        translatorFor(w, r),
+		User:        user,
+		Tokens:      s.tokens.List(user),
+		Secret:      secret,
+		Error:       message,
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writePage(w, status, "tokens.html", data, "Token page unavailable")
+}
+
+// handleListTokens serves GET /api/tokens, the signed-in user's tokens as
+// JSON
+func (s *Server) handleListTokens(w http.ResponseWriter, r *http.Request) {
+	user := s.tokenOwner(r)
+	if user == "" {
+		http.Error(w, "Sign in to list API tokens", http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.tokens.List(user))
+}
+
+// handleCreateToken serves POST /api/tokens, creating a token from the
+// form-encoded "name" and "scope" ("read" or "write"). The response
+// includes the secret, which isn't shown again.
+func (s *Server) handleCreateToken(w http.ResponseWriter, r *http.Request) {
+	user := s.tokenOwner(r)
+	if user == "" {
+		http.Error(w, "Sign in to create API tokens", http.StatusUnauthorized)
+		return
+	}
+
+	token, secret, err := s.tokens.Create(user, r.PostFormValue("name"), r.PostFormValue("scope"), s.grantedRoles(r), s.currentGroups(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(struct {
+		APIToken
+		Secret string `json:"secret"`
+	}{token, secret})
+}
+
+// handleRevokeToken serves DELETE /api/tokens/{id}
+func (s *Server) handleRevokeToken(w http.ResponseWriter, r *http.Request) {
+	user := s.tokenOwner(r)
+	if user == "" {
+		http.Error(w, "Sign in to revoke API tokens", http.StatusUnauthorized)
+		return
+	}
+
+	found, err := s.tokens.Revoke(user, r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Failed to save tokens", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Token not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestAPITokens(t *testing.T) {
+	s := newTestServer(t, Link{Shortcut: "wiki", URL: "https://wiki.example.com", CreatedBy: "alice"})
+	var err error
+	if s.editors, err = NewEditAuth("alice:wonderland", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /add", s.requireEditor(s.handleAdd))
+	mux.HandleFunc("DELETE /api/links/{shortcut...}", s.requireLinkChanger(s.handleDelete))
+	mux.HandleFunc("GET /api/tokens", s.handleListTokens)
+	mux.HandleFunc("POST /api/tokens", s.handleCreateToken)
+	mux.HandleFunc("DELETE /api/tokens/{id}", s.handleRevokeToken)
+	do := func(method, path string, form url.Values, auth func(*http.Request)) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		auth(r)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w
+	}
+	alice := func(r *http.Request) { r.SetBasicAuth("alice", "wonderland") }
+	bearer := func(secret string) func(*http.Request) {
+		return func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+secret) }
+	}
+	create := func(scope string) (APIToken, string) {
+		w := do("POST", "/api/tokens", url.Values{"name": {"bot"}, "scope": {scope}}, alice)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("create %s token: status %d: %s", scope, w.Code, w.Body)
+		}
+		var created struct {
+			APIToken
+			Secret string `json:"secret"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&created); err != nil {
+			t.Fatal(err)
+		}
+		return created.APIToken, created.Secret
+	}
+
+	if w := do("POST", "/api/tokens", url.Values{"name": {"bot"}, "scope": {"read"}}, func(*http.Request) {}); w.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous create: status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	if w := do("POST", "/api/tokens", url.Values{"name": {"bot"}, "scope": {"admin"}}, alice); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown scope: status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+
+	readToken, readSecret := create(scopeRead)
+	_, writeSecret := create(scopeWrite)
+	if !strings.HasPrefix(readSecret, tokenPrefix) {
+		t.Errorf("secret %q lacks the %q prefix", readSecret, tokenPrefix)
+	}
+
+	// Only hashes are stored
+	data, err := os.ReadFile(s.tokens.filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), readSecret) || !strings.Contains(string(data), hashToken(readSecret)) {
+		t.Errorf("tokens file doesn't hold just the hash: %s", data)
+	}
+
+	// Read tokens act as their user for safe requests only
+	r := httptest.NewRequest("GET", "/my", nil)
+	bearer(readSecret)(r)
+	if user := s.currentUser(r); user != "alice" {
+		t.Errorf("currentUser with read token = %q, want alice", user)
+	}
+	form := url.Values{"shortcut": {"docs"}, "url": {"https://docs.example.com"}}
+	if w := do("POST", "/add", form, bearer(readSecret)); w.Code != http.StatusUnauthorized {
+		t.Errorf("add with read token: status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	if w := do("POST", "/add", form, bearer(writeSecret)); w.Code != http.StatusSeeOther {
+		t.Errorf("add with write token: status %d, want %d", w.Code, http.StatusSeeOther)
+	}
+	if link, _ := s.store.Get("", "docs"); link.CreatedBy != "alice" {
+		t.Errorf("CreatedBy = %q, want alice", link.CreatedBy)
+	}
+
+	// Tokens can't manage tokens
+	if w := do("POST", "/api/tokens", url.Values{"name": {"more"}, "scope": {"write"}}, bearer(writeSecret)); w.Code != http.StatusUnauthorized {
+		t.Errorf("create with a token: status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	var listed []APIToken
+	if err := json.NewDecoder(do("GET", "/api/tokens", nil, alice).Body).Decode(&listed); err != nil {
+		t.Fatal(err)
+	}
+	if len(listed) != 2 || listed[0].Hash != "" {
+		t.Errorf("listed tokens = %+v, want two without hashes", listed)
+	}
+
+	if w := do("DELETE", "/api/tokens/"+readToken.ID, nil, alice); w.Code != http.StatusNoContent {
+		t.Errorf("revoke: status %d, want %d", w.Code, http.StatusNoContent)
+	}
+	r = httptest.NewRequest("GET", "/my", nil)
+	bearer(readSecret)(r)
+	if user := s.currentUser(r); user != "" {
+		t.Errorf("currentUser with revoked token = %q, want none", user)
+	}
+}
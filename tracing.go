@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer starts the server's spans. Until tracing is set up by NewTracing
+// it does nothing.
+var tracer = otel.Tracer("go-links")
+
+// NewTracing sends spans to an OpenTelemetry collector over OTLP/HTTP when
+// OTEL_EXPORTER_OTLP_ENDPOINT (or OTEL_EXPORTER_OTLP_TRACES_ENDPOINT) is
+// set, returning nil otherwise. The exporter, sampler and resource are
+// configured with the standard OTEL_* variables, the service name
+// defaulting to go-links. Trace context arriving in traceparent headers is
+// continued.
+func NewTracing(ctx context.Context) (*sdktrace.TracerProvider, error) {
+	if os.Getenv("OTEL_SDK_DISABLED") == "true" ||
+		(os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "") {
+		return nil, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Attributes from OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES win
+	res, err := resource.Merge(
+		resource.NewSchemaless(attribute.String("service.name", "go-links")),
+		resource.Environment(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return provider, nil
+}
+
+// traceRequests wraps each request in a server span named after the route
+// it matches in mux, continuing any trace the caller started
+func (s *Server) traceRequests(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		_, route := mux.Handler(r)
+		ctx, span := tracer.Start(ctx, r.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("http.route", route),
+				attribute.String("url.path", r.URL.Path),
+				attribute.String("client.address", s.anonIP(r)),
+				attribute.String("user_agent.original", r.UserAgent()),
+			),
+		)
+		defer span.End()
+
+		sr := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(sr, r.WithContext(ctx))
+		if sr.status == 0 {
+			sr.status = http.StatusOK
+		}
+		span.SetAttributes(attribute.Int("http.response.status_code", sr.status))
+		if sr.status >= 500 {
+			span.SetStatus(codes.Error, http.StatusText(sr.status))
+		}
+	})
+}
+
+// startSpan starts a span for work done while handling r, such as a call
+// to the link store. End it when the work is done.
+func startSpan(r *http.Request, name string, attrs ...attribute.KeyValue) trace.Span {
+	_, span := tracer.Start(r.Context(), name, trace.WithAttributes(attrs...))
+	return span
+}
+
+// linkAttrs identifies a link on a span
+func linkAttrs(namespace, shortcut string) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("golinks.namespace", namespace),
+		attribute.String("golinks.shortcut", shortcut),
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestNewTracingDisabledByDefault(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+	if provider, err := NewTracing(t.Context()); provider != nil || err != nil {
+		t.Errorf("NewTracing = %v, %v, want disabled", provider, err)
+	}
+}
+
+func TestTraceRequests(t *testing.T) {
+	// The package's tracer follows the first provider installed, so this is
+	// the only test that may install one
+	spans := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	s := newTestServer(t, Link{Shortcut: "wiki", URL: "https://wiki.example.com"})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.handleHome)
+	handler := s.traceRequests(mux, s.logRequests(mux))
+
+	r := httptest.NewRequest("GET", "/wiki", nil)
+	r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusFound {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusFound)
+	}
+
+	ended := spans.Ended()
+	names := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range ended {
+		names[span.Name()] = span
+	}
+	server, ok := names["GET /"]
+	if !ok {
+		t.Fatalf("spans = %v, want a server span named GET /", names)
+	}
+	if got := server.SpanContext().TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("trace ID = %s, want the caller's", got)
+	}
+	var status, requestID bool
+	for _, attr := range server.Attributes() {
+		status = status || (attr.Key == "http.response.status_code" && attr.Value.AsInt64() == http.StatusFound)
+		requestID = requestID || (attr.Key == "golinks.request_id" && attr.Value.AsString() == w.Header().Get(requestIDHeader))
+	}
+	if !status || !requestID {
+		t.Errorf("server span attributes = %v, want the status and request ID", server.Attributes())
+	}
+	for _, name := range []string{"LinkStore.Get", "LinkStore.RecordClick"} {
+		span, ok := names[name]
+		if !ok {
+			t.Errorf("no %s span", name)
+		} else if span.Parent().SpanID() != server.SpanContext().SpanID() {
+			t.Errorf("%s isn't a child of the server span", name)
+		}
+	}
+}
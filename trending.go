@@ -0,0 +1,52 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// popularLink is a link with its click count over a recent period
+type popularLink struct {
+	Link
+	RecentClicks int
+}
+
+// mostUsedLinks returns up to n links with the most clicks in the days
+// days up to and including now, busiest first. Links without clicks in
+// that period are left out.
+func mostUsedLinks(links map[string]Link, now time.Time, days, n int) []popularLink {
+	var popular []popularLink
+	for _, link := range links {
+		clicks := 0
+		for i := range days {
+			clicks += link.DailyClicks[now.AddDate(0, 0, -i).Format(time.DateOnly)]
+		}
+		if clicks > 0 {
+			popular = append(popular, popularLink{link, clicks})
+		}
+	}
+
+	sort.Slice(popular, func(i, j int) bool {
+		if popular[i].RecentClicks != popular[j].RecentClicks {
+			return popular[i].RecentClicks > popular[j].RecentClicks
+		}
+		return popular[i].Shortcut < popular[j].Shortcut
+	})
+	return popular[:min(n, len(popular))]
+}
+
+// recentLinks returns up to n links, newest first. Links from before
+// creation times were recorded are left out.
+func recentLinks(links map[string]Link, n int) []Link {
+	var recent []Link
+	for _, link := range links {
+		if !link.CreatedAt.IsZero() {
+			recent = append(recent, link)
+		}
+	}
+
+	sort.Slice(recent, func(i, j int) bool {
+		return recent[i].CreatedAt.After(recent[j].CreatedAt)
+	})
+	return recent[:min(n, len(recent))]
+}
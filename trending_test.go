@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMostUsedLinksCountsThisWeek(t *testing.T) {
+	now := time.Date(2024, 3, 31, 12, 0, 0, 0, time.UTC)
+	links := map[string]Link{
+		"steady": {Shortcut: "steady", DailyClicks: map[string]int{"2024-03-31": 3, "2024-03-25": 3}},
+		"old":    {Shortcut: "old", DailyClicks: map[string]int{"2024-03-24": 100}},
+		"spike":  {Shortcut: "spike", DailyClicks: map[string]int{"2024-03-30": 10}},
+		"unused": {Shortcut: "unused"},
+	}
+
+	got := mostUsedLinks(links, now, 7, 5)
+
+	if len(got) != 2 || got[0].Shortcut != "spike" || got[1].Shortcut != "steady" || got[1].RecentClicks != 6 {
+		t.Errorf("mostUsedLinks = %+v, want spike then steady with 6 clicks", got)
+	}
+}
+
+func TestRecentLinksNewestFirst(t *testing.T) {
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	links := map[string]Link{
+		"a":      {Shortcut: "a", CreatedAt: day},
+		"b":      {Shortcut: "b", CreatedAt: day.AddDate(0, 0, 2)},
+		"c":      {Shortcut: "c", CreatedAt: day.AddDate(0, 0, 1)},
+		"legacy": {Shortcut: "legacy"},
+	}
+
+	got := recentLinks(links, 2)
+
+	if len(got) != 2 || got[0].Shortcut != "b" || got[1].Shortcut != "c" {
+		t.Errorf("recentLinks = %v, want b, c", got)
+	}
+}
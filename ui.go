@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// templateFS holds the HTML page templates, compiled into the binary
+//
+//go:embed templates/*.html
+var templateFS embed.FS
+
+// staticFS holds the CSS and JavaScript served under /static/
+//
+//go:embed static
+var staticFS embed.FS
+
+// templates are parsed once at startup; a broken template fails fast
+var templates = template.Must(parseTemplates(""))
+
+// parseTemplates parses the embedded page templates, then any *.html files
+// in dir, which replace the embedded page or partial of the same name
+func parseTemplates(dir string) (*template.Template, error) {
+	t, err := template.New("").Funcs(template.FuncMap{
+		"join": strings.Join,
+		"dict": dict,
+	}).ParseFS(templateFS, "templates/*.html")
+	if err != nil || dir == "" {
+		return t, err
+	}
+
+	overrides, err := filepath.Glob(filepath.Join(dir, "*.html"))
+	if err != nil {
+		return nil, err
+	}
+	if len(overrides) == 0 {
+		return nil, fmt.Errorf("no .html templates in %s", dir)
+	}
+	return t.ParseFiles(overrides...)
+}
+
+// writePage renders a page template with the given status. The page is
+// rendered in full first so a broken operator template falls back to a
+// plain-text message rather than half a page.
+func writePage(w http.ResponseWriter, status int, name string, data any, fallback string) {
+	var buf bytes.Buffer
+	if err := templates.ExecuteTemplate(&buf, name, data); err != nil {
+		log.Printf("Rendering %s: %v", name, err)
+		http.Error(w, fallback, status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	buf.WriteTo(w)
+}
+
+// staticHandler serves the embedded static assets under /static/
+func staticHandler() http.Handler {
+	assets, err := fs.Sub(staticFS, "static")
+	if err != nil {
+		panic(err)
+	}
+	mime.AddExtensionType(".webmanifest", "application/manifest+json")
+	return http.StripPrefix("/static/", http.FileServerFS(assets))
+}
+
+// dict builds a map from alternating keys and values, for passing several
+// values to a nested template
+func dict(pairs ...any) map[string]any {
+	m := make(map[string]any, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		m[pairs[i].(string)] = pairs[i+1]
+	}
+	return m
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestServer returns a server backed by a temporary links file
+func newTestServer(t testing.TB, links ...Link) *Server {
+	t.Helper()
+
+	store := &LinkStore{filePath: filepath.Join(t.TempDir(), "links.json")}
+	for _, link := range links {
+		if err := store.Add(link); err != nil {
+			t.Fatalf("adding %q: %v", link.Shortcut, err)
+		}
+	}
+
+	hosts, err := NewHostMap("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	editors, err := NewEditAuth("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Server{
+		store:     store,
+		hosts:     hosts,
+		blocklist: NewBlocklist(filepath.Join(t.TempDir(), "blocklist.txt")),
+		regions:   &RegionResolver{},
+		stars:     NewStarStore(filepath.Join(t.TempDir(), "stars.json")),
+		misses:    NewMissStore(filepath.Join(t.TempDir(), "misses.json")),
+		tokens:    NewTokenStore(filepath.Join(t.TempDir(), "tokens.json")),
+		proposals: NewProposalStore(filepath.Join(t.TempDir(), "proposals.json")),
+		acl:       NewACL(filepath.Join(t.TempDir(), "acl.txt")),
+		groups:    NewGroupStore(filepath.Join(t.TempDir(), "groups.txt")),
+		admins:    NewAdminAuth("", ""),
+		editors:   editors,
+	}
+	s.urls.Store(NewURLValidator("", "", false))
+	s.theme.Store(&Theme{})
+	return s
+}
+
+func TestHomepageEscapesLinkValues(t *testing.T) {
+	s := newTestServer(t, Link{
+		Shortcut:     `<script>alert("shortcut")</script>`,
+		URL:          `https://example.com/"><img src=x onerror=alert(1)>`,
+		Description:  `<b onmouseover="alert('description')">hi</b>`,
+		MobileURL:    `https://example.com/'><svg onload=alert(2)>`,
+		Fragment:     `</textarea><script>alert("fragment")</script>`,
+		CacheControl: `"><script>alert("cache")</script>`,
+		Regions:      map[string]string{`<i>eu</i>`: `https://example.eu/<iframe>`},
+	})
+
+	w := httptest.NewRecorder()
+	s.handleHome(w, httptest.NewRequest("GET", "/", nil))
+
+	body := w.Body.String()
+	if w.Code != 200 {
+		t.Fatalf("status = %d, body:\n%s", w.Code, body)
+	}
+
+	for _, injected := range []string{
+		"<script>alert",
+		"<img src=x",
+		"<b onmouseover",
+		"<svg onload",
+		"<i>eu</i>",
+		"<iframe>",
+		`"><script`,
+	} {
+		if strings.Contains(body, injected) {
+			t.Errorf("homepage contains unescaped %q", injected)
+		}
+	}
+
+	if !strings.Contains(body, "&lt;script&gt;alert(&#34;shortcut&#34;)&lt;/script&gt;") {
+		t.Errorf("homepage does not show the escaped shortcut")
+	}
+}
+
+func TestHomepageEscapesSearchQuery(t *testing.T) {
+	s := newTestServer(t, Link{Shortcut: "gh", URL: "https://github.com"})
+
+	w := httptest.NewRecorder()
+	s.handleHome(w, httptest.NewRequest("GET", `/?q=%22%3E%3Cscript%3Ealert(1)%3C/script%3E`, nil))
+
+	if body := w.Body.String(); strings.Contains(body, "<script>alert") {
+		t.Errorf("homepage contains the unescaped search query:\n%s", body)
+	}
+}
+
+func TestHomepageSortLinksAreEscapedForURLs(t *testing.T) {
+	s := newTestServer(t, Link{Shortcut: "gh", URL: "https://github.com", Description: "a&b"})
+
+	w := httptest.NewRecorder()
+	s.handleHome(w, httptest.NewRequest("GET", `/?q=a%26b`, nil))
+
+	body := w.Body.String()
+	if !strings.Contains(body, `href="/?order=desc&amp;page=1&amp;per_page=25&amp;q=a%26b&amp;sort=name"`) {
+		t.Errorf("sort link is not escaped as an attribute:\n%s", body)
+	}
+}
+
+func TestHomepageTheme(t *testing.T) {
+	s := newTestServer(t)
+	theme, err := NewTheme("https://example.com/logo.png", "#0a7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.theme.Store(theme)
+
+	w := httptest.NewRecorder()
+	s.handleHome(w, httptest.NewRequest("GET", "/", nil))
+
+	body := w.Body.String()
+	for _, want := range []string{
+		`<style>:root { --accent: #0a7; }</style>`,
+		`<img class="logo" src="https://example.com/logo.png" alt="">`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("homepage is missing %q", want)
+		}
+	}
+}
+
+func TestAddShowsConfirmation(t *testing.T) {
+	s := newTestServer(t)
+
+	req := httptest.NewRequest("POST", "/add", strings.NewReader("shortcut=gh&url=https://github.com"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	s.handleAdd(w, req)
+
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/?added=gh" {
+		t.Fatalf("add: status %d, Location %q", w.Code, w.Header().Get("Location"))
+	}
+
+	w = httptest.NewRecorder()
+	s.handleHome(w, httptest.NewRequest("GET", "/?added=gh", nil))
+	if body := w.Body.String(); !strings.Contains(body, `class="flash success"`) || !strings.Contains(body, "go/gh") {
+		t.Errorf("homepage does not confirm the added link:\n%s", body)
+	}
+}
+
+func TestAddShowsErrorsInline(t *testing.T) {
+	s := newTestServer(t)
+
+	req := httptest.NewRequest("POST", "/add", strings.NewReader("shortcut=gh&url=javascript:alert(1)&description=kept"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	s.handleAdd(w, req)
+
+	body := w.Body.String()
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", w.Code)
+	}
+	for _, want := range []string{`class="flash error"`, `class="field-error"`, `value="kept"`, `value="gh"`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("homepage is missing %q", want)
+		}
+	}
+	if _, exists := s.store.Get("", "gh"); exists {
+		t.Errorf("invalid link was saved")
+	}
+}
+
+func TestNewPrefillsForm(t *testing.T) {
+	s := newTestServer(t)
+
+	for _, target := range []string{
+		"/new?url=https%3A%2F%2Fexample.com%2Fdoc&title=Design+doc",
+		"/new?title=Design+doc&text=Have+a+look+https%3A%2F%2Fexample.com%2Fdoc",
+	} {
+		w := httptest.NewRecorder()
+		s.handleNew(w, httptest.NewRequest("GET", target, nil))
+
+		body := w.Body.String()
+		for _, want := range []string{`value="https://example.com/doc"`, `value="Design doc"`, "autofocus"} {
+			if !strings.Contains(body, want) {
+				t.Errorf("%s: form is missing %q", target, want)
+			}
+		}
+	}
+}
+
+func TestTemplateOverrides(t *testing.T) {
+	dir := t.TempDir()
+	page := `<html><body>{{.Lang.T "Nothing at %s" (print .Prefix "/" .Shortcut)}}, ask in #help</body></html>`
+	if err := os.WriteFile(filepath.Join(dir, "notfound.html"), []byte(page), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	overridden, err := parseTemplates(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	embedded := templates
+	templates = overridden
+	t.Cleanup(func() { templates = embedded })
+
+	s := newTestServer(t)
+	w := httptest.NewRecorder()
+	s.handleHome(w, httptest.NewRequest("GET", "/nope", nil))
+	if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), "Nothing at go/nope, ask in #help") {
+		t.Errorf("custom not-found page not used, got %d:\n%s", w.Code, w.Body.String())
+	}
+
+	// Pages without an override keep the embedded template
+	w = httptest.NewRecorder()
+	s.handleHome(w, httptest.NewRequest("GET", "/", nil))
+	if !strings.Contains(w.Body.String(), "Add Link") {
+		t.Errorf("homepage lost its embedded template")
+	}
+
+	if _, err := parseTemplates(t.TempDir()); err == nil {
+		t.Errorf("parseTemplates accepted a directory without templates")
+	}
+}
+
+func TestErrorPageFallsBackToText(t *testing.T) {
+	broken, err := parseTemplates("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.Must(broken.New("error.html").Parse(`{{.NoSuchField}}`))
+	embedded := templates
+	templates = broken
+	t.Cleanup(func() { templates = embedded })
+
+	s := newTestServer(t)
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/links/nope", nil)
+	r.SetPathValue("shortcut", "nope")
+	s.handleDetail(w, r)
+	if w.Code != http.StatusNotFound || strings.TrimSpace(w.Body.String()) != "There's no link with that shortcut." {
+		t.Errorf("got %d %q, want the plain-text message", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"cmp"
+	"net/http"
+	"strings"
+)
+
+// linkPreviewAgents identify chat apps fetching a pasted link to show a
+// preview card for it: Slack, Microsoft Teams (as Skype), Discord and the
+// like
+var linkPreviewAgents = []string{
+	"slackbot-linkexpanding", "slack-imgproxy", "skypeuripreview", "microsoftpreview",
+	"discordbot", "telegrambot", "whatsapp", "mattermost", "twitterbot",
+	"facebookexternalhit", "linkedinbot",
+}
+
+// isLinkPreview reports whether a request comes from a chat app previewing
+// a link. Following the redirect would show the destination's card, which
+// is blank for pages the app can't reach, such as those behind sign-in.
+func isLinkPreview(r *http.Request) bool {
+	agent := strings.ToLower(r.UserAgent())
+	for _, name := range linkPreviewAgents {
+		if strings.Contains(agent, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// showPreview answers a chat app previewing a link with a page of
+// OpenGraph metadata, so the card shows the link's description and where
+// it goes rather than nothing
+func (s *Server) showPreview(w http.ResponseWriter, r *http.Request, link Link, destination string) {
+	shortcut := s.hosts.Prefix(r) + "/" + link.Shortcut
+	data := struct {
+		Lang        *translator
+		Title       string
+		Description string
+		Destination string
+	}{
+		Lang:        translatorFor(w, r),
+		Title:       cmp.Or(link.Description, shortcut),
+		Description: shortcut + " → " + destination,
+		Destination: destination,
+	}
+	writePage(w, http.StatusOK, "preview.html", data, data.Description)
+}
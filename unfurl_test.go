@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLinkPreview(t *testing.T) {
+	s := newTestServer(t,
+		Link{Shortcut: "wiki", URL: "https://wiki.example.com/{*}", Description: "Team wiki"},
+		Link{Shortcut: "payroll", URL: "https://payroll.example.com", VisibleTo: []string{"finance"}})
+
+	for _, agent := range []string{
+		"Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)",
+		"Mozilla/5.0 (Windows NT 6.1; WOW64) SkypeUriPreview Preview/0.5",
+	} {
+		r := httptest.NewRequest("GET", "/wiki/onboarding", nil)
+		r.Header.Set("User-Agent", agent)
+		w := httptest.NewRecorder()
+		s.handleHome(w, r)
+		body := w.Body.String()
+		if w.Code != http.StatusOK || !strings.Contains(body, `<meta property="og:title" content="Team wiki">`) ||
+			!strings.Contains(body, "go/wiki → https://wiki.example.com/onboarding") {
+			t.Errorf("%s: status %d, %s", agent, w.Code, body)
+		}
+	}
+	if link, _ := s.store.Get("", "wiki"); link.Clicks != 0 {
+		t.Errorf("previews counted as %d clicks", link.Clicks)
+	}
+
+	// Links restricted to groups aren't described to anyone outside them
+	r := httptest.NewRequest("GET", "/payroll", nil)
+	r.Header.Set("User-Agent", "Slackbot-LinkExpanding 1.0")
+	w := httptest.NewRecorder()
+	s.handleHome(w, r)
+	if w.Code != http.StatusForbidden || strings.Contains(w.Body.String(), "payroll.example.com") {
+		t.Errorf("restricted link preview: status %d", w.Code)
+	}
+
+	r = httptest.NewRequest("GET", "/wiki", nil)
+	r.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh) Safari/605.1.15")
+	w = httptest.NewRecorder()
+	s.handleHome(w, r)
+	if w.Code != http.StatusFound {
+		t.Errorf("browser: status %d, want the redirect", w.Code)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"time"
+)
+
+// listenUnix listens on a Unix socket at path, so a reverse proxy on the
+// same machine can reach the server without it exposing a port. The
+// socket gets config.SocketMode and config.SocketGroup, deciding who may
+// connect. A socket left behind by a server that didn't stop cleanly is
+// replaced, but not one still in use or any other kind of file.
+func listenUnix(path string, config ListenConfig) (net.Listener, error) {
+	mode := os.FileMode(0660)
+	if config.SocketMode != "" {
+		m, err := strconv.ParseUint(config.SocketMode, 8, 32)
+		if err != nil || m > 0777 {
+			return nil, fmt.Errorf("socket mode %q: want permissions in octal, like 0660", config.SocketMode)
+		}
+		mode = os.FileMode(m)
+	}
+	gid := -1
+	if config.SocketGroup != "" {
+		group, err := user.LookupGroup(config.SocketGroup)
+		if err != nil {
+			group, err = user.LookupGroupId(config.SocketGroup)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("socket group %q: %w", config.SocketGroup, err)
+		}
+		if gid, err = strconv.Atoi(group.Gid); err != nil {
+			return nil, fmt.Errorf("socket group %q: %w", config.SocketGroup, err)
+		}
+	}
+
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s already exists and isn't a socket", path)
+		}
+		if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s is in use by another server", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	if gid >= 0 {
+		if err := os.Chown(path, -1, gid); err != nil {
+			listener.Close()
+			return nil, err
+		}
+	}
+	return listener, nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// socketPath returns a path for a Unix socket, short enough for the limit
+// on socket path lengths
+func socketPath(t *testing.T) string {
+	if runtime.GOOS == "windows" {
+		t.Skip("socket permissions don't apply on Windows")
+	}
+	dir, err := os.MkdirTemp("", "golinks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return filepath.Join(dir, "go.sock")
+}
+
+func TestListenUnix(t *testing.T) {
+	path := socketPath(t)
+	listener, err := listen("unix:"+path, ListenConfig{SocketMode: "0600"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("socket: %v, %v, want mode 0600", info, err)
+	}
+	go http.Serve(listener, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.RemoteAddr)
+	}))
+	client := &http.Client{Transport: &http.Transport{DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, "unix", path)
+	}}}
+	resp, err := client.Get("http://go/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !unixPeer(string(body)) {
+		t.Errorf("remote address over the socket = %q, want a Unix peer", body)
+	}
+
+	// A socket in use is left alone, and one left behind replaced
+	if _, err := listen("unix:"+path, ListenConfig{}, false); err == nil || !strings.Contains(err.Error(), "in use") {
+		t.Errorf("listening on a socket in use = %v, want refused", err)
+	}
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	listener.Close()
+	again, err := listen("unix:"+path, ListenConfig{}, false)
+	if err != nil {
+		t.Fatalf("replacing a stale socket: %v", err)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0660 {
+		t.Errorf("default socket mode = %v, want 0660", info.Mode().Perm())
+	}
+	again.Close()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("socket left behind after closing: %v", err)
+	}
+
+	os.WriteFile(path, []byte("links"), 0644)
+	if _, err := listen("unix:"+path, ListenConfig{}, false); err == nil {
+		t.Error("listening over a regular file succeeded")
+	}
+	os.Remove(path)
+	for _, config := range []ListenConfig{{SocketMode: "rw"}, {SocketMode: "1777"}, {SocketGroup: "no-such-group-here"}} {
+		if _, err := listen("unix:"+path, config, false); err == nil {
+			t.Errorf("listen with %+v succeeded", config)
+		}
+	}
+}
+
+func TestUnixSocketPeerIsTrusted(t *testing.T) {
+	s := newTestServer(t)
+	var remote string
+	handler := s.forwarded(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		remote = r.RemoteAddr
+	}))
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "@"
+	r.Header.Set("X-Forwarded-For", "198.51.100.7")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	if remote != "198.51.100.7:0" {
+		t.Errorf("client through a Unix socket = %q, want the forwarded address", remote)
+	}
+}
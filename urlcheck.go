@@ -0,0 +1,210 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// URLValidator parses, validates and normalizes destination URLs before they
+// are saved, so links can't point at javascript:, data: or malformed URLs
+type URLValidator struct {
+	// schemes lists the allowed destination schemes
+	schemes map[string]bool
+
+	// domains optionally restricts destinations to these domains and their
+	// subdomains; empty means any host is allowed
+	domains []string
+
+	// upgradeHTTPS probes plain http destinations and switches them to
+	// https when the host answers over TLS
+	upgradeHTTPS bool
+	client       *http.Client
+}
+
+// NewURLValidator creates a validator from comma-separated scheme and domain
+// lists. An empty scheme list allows http and https.
+func NewURLValidator(schemes, domains string, upgradeHTTPS bool) *URLValidator {
+	v := &URLValidator{
+		schemes:      make(map[string]bool),
+		upgradeHTTPS: upgradeHTTPS,
+		client: &http.Client{
+			Timeout: 2 * time.Second,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+
+	for _, scheme := range splitList(schemes) {
+		v.schemes[strings.ToLower(scheme)] = true
+	}
+	if len(v.schemes) == 0 {
+		v.schemes["http"] = true
+		v.schemes["https"] = true
+	}
+
+	for _, domain := range splitList(domains) {
+		v.domains = append(v.domains, strings.ToLower(strings.TrimPrefix(domain, "*.")))
+	}
+
+	return v
+}
+
+// Normalize validates a destination typed by a user and returns the URL to
+// store. Destinations without a scheme are treated as http, and http
+// destinations are switched to https when upgrading is enabled and the host
+// supports it.
+func (v *URLValidator) Normalize(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", errors.New("URL is required")
+	}
+
+	// Anything without a scheme is treated as a web address
+	if !hasScheme(raw) {
+		raw = "http://" + raw
+	}
+
+	// Placeholders like {1} may appear in the path, query and fragment but
+	// not the host, which url.Parse rejects
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("%q is not a valid URL", raw)
+	}
+	if u.User != nil {
+		return "", errors.New("URLs with embedded credentials are not allowed")
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+	if !v.schemes[scheme] {
+		return "", fmt.Errorf("URLs using %s: are not allowed", scheme)
+	}
+
+	if scheme == "http" || scheme == "https" {
+		if err := v.checkHost(u); err != nil {
+			return "", err
+		}
+	}
+
+	// Lowercase the scheme and host; the rest of the URL is case-sensitive
+	prefix := scheme + ":"
+	rest := raw[len(u.Scheme)+1:]
+	if u.Host != "" {
+		prefix += "//" + strings.ToLower(u.Host)
+		rest = rest[len("//")+len(u.Host):]
+	}
+	normalized := prefix + rest
+
+	if scheme == "http" && v.upgradeHTTPS && v.supportsHTTPS(u.Hostname(), u.Port()) {
+		normalized = "https" + strings.TrimPrefix(normalized, "http")
+	}
+
+	return normalized, nil
+}
+
+// checkHost validates the host of a web URL against syntax rules and the
+// domain allowlist
+func (v *URLValidator) checkHost(u *url.URL) error {
+	host := strings.ToLower(u.Hostname())
+	if host == "" {
+		return errors.New("URL must include a host")
+	}
+
+	if port := u.Port(); port != "" {
+		if _, err := net.LookupPort("tcp", port); err != nil {
+			return fmt.Errorf("%q is not a valid port", port)
+		}
+	}
+
+	if net.ParseIP(host) == nil && !validHostname(host) {
+		return fmt.Errorf("%q is not a valid host name", host)
+	}
+
+	if len(v.domains) == 0 {
+		return nil
+	}
+	for _, domain := range v.domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return nil
+		}
+	}
+	return fmt.Errorf("links to %s are not allowed", host)
+}
+
+// supportsHTTPS reports whether a host answers HTTPS requests. Any HTTP
+// response counts; only connection and TLS failures don't.
+func (v *URLValidator) supportsHTTPS(host, port string) bool {
+	// A non-default port almost certainly serves plain HTTP only
+	if port != "" && port != "80" {
+		return false
+	}
+
+	req, err := http.NewRequest(http.MethodHead, "https://"+host+"/", nil)
+	if err != nil {
+		return false
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return true
+}
+
+// hasScheme reports whether raw starts with a URL scheme like "https:".
+// "localhost:8080" is a host and port, not a scheme.
+func hasScheme(raw string) bool {
+	scheme, rest, ok := strings.Cut(raw, ":")
+	if !ok || scheme == "" {
+		return false
+	}
+	for i, c := range scheme {
+		isLetter := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+		if !isLetter && (i == 0 || !(c >= '0' && c <= '9' || c == '+' || c == '-' || c == '.')) {
+			return false
+		}
+	}
+
+	// A port number after the colon means this is host:port
+	port, _, _ := strings.Cut(rest, "/")
+	if port != "" && strings.Trim(port, "0123456789") == "" {
+		return false
+	}
+	return true
+}
+
+// validHostname checks a DNS name: dot-separated labels of letters, digits
+// and hyphens that don't start or end with a hyphen
+func validHostname(host string) bool {
+	host = strings.TrimSuffix(host, ".")
+	if host == "" || len(host) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(host, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// splitList splits a comma-separated setting, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
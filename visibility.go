@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+)
+
+// canSee reports whether a request may see a link in listings. Hidden links
+// still redirect for everyone but are only listed for the user who created
+// them, their owner (or the owning group's members), and admins, as are
+// archived links. Links restricted to groups are only listed for those who
+// may follow them.
+func (s *Server) canSee(r *http.Request, link Link) bool {
+	if !s.mayFollow(r, link) {
+		return false
+	}
+	if !link.Hidden && link.ArchivedAt.IsZero() {
+		return true
+	}
+	return s.owns(r, link) || s.isAdmin(r)
+}
+
+// mayFollow reports whether a request may follow a link: anyone, unless
+// it is restricted to groups, when only their members, the link's creator
+// and owner, and admins may
+func (s *Server) mayFollow(r *http.Request, link Link) bool {
+	if len(link.VisibleTo) == 0 || s.owns(r, link) || s.isAdmin(r) {
+		return true
+	}
+	groups := s.currentGroups(r)
+	return slices.ContainsFunc(link.VisibleTo, func(group string) bool { return inGroup(groups, group) })
+}
+
+// visibleLinks returns the links in namespace the request may see, keyed by
+// shortcut
+func (s *Server) visibleLinks(r *http.Request, namespace string) map[string]Link {
+	links := s.store.GetAll(namespace)
+	for shortcut, link := range links {
+		if !s.canSee(r, link) {
+			delete(links, shortcut)
+		}
+	}
+	return links
+}
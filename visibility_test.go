@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHiddenLinks(t *testing.T) {
+	s := newTestServer(t,
+		Link{Shortcut: "payroll", URL: "https://hr.example.com/payroll", Hidden: true, CreatedBy: "alice@example.com"},
+		Link{Shortcut: "perf", URL: "https://hr.example.com/reviews", Hidden: true, Owner: "bob@example.com"},
+		Link{Shortcut: "pto", URL: "https://hr.example.com/pto"},
+	)
+	s.userHeader = "X-User"
+	s.proxies = httptestProxy
+	s.admins = NewAdminAuth("root@example.com", "")
+
+	search := func(user string) []string {
+		r := httptest.NewRequest("GET", "/api/search?q=hr.example", nil)
+		if user != "" {
+			r.Header.Set("X-User", user)
+		}
+		w := httptest.NewRecorder()
+		s.handleSearch(w, r)
+		var links []Link
+		if err := json.NewDecoder(w.Body).Decode(&links); err != nil {
+			t.Fatal(err)
+		}
+		var shortcuts []string
+		for _, link := range links {
+			shortcuts = append(shortcuts, link.Shortcut)
+		}
+		return shortcuts
+	}
+
+	tests := map[string]string{
+		"":                  "pto",
+		"carol@example.com": "pto",
+		"alice@example.com": "payroll,pto",
+		"Bob@example.com":   "perf,pto",
+		"root@example.com":  "payroll,perf,pto",
+	}
+	for user, want := range tests {
+		if got := strings.Join(search(user), ","); got != want {
+			t.Errorf("search as %q = %s, want %s", user, got, want)
+		}
+	}
+
+	// Hidden links still redirect for everyone
+	w := httptest.NewRecorder()
+	s.handleHome(w, httptest.NewRequest("GET", "/payroll", nil))
+	if w.Code != http.StatusFound {
+		t.Errorf("redirect status = %d, want %d", w.Code, http.StatusFound)
+	}
+
+	// ...but aren't listed, suggested or described to others
+	w = httptest.NewRecorder()
+	s.handleHome(w, httptest.NewRequest("GET", "/", nil))
+	if strings.Contains(w.Body.String(), "payroll") {
+		t.Errorf("homepage lists a hidden link")
+	}
+	w = httptest.NewRecorder()
+	s.handleHome(w, httptest.NewRequest("GET", "/payrol", nil))
+	if strings.Contains(w.Body.String(), "go/payroll") {
+		t.Errorf("not-found page suggests a hidden link")
+	}
+	r := httptest.NewRequest("GET", "/links/payroll", nil)
+	r.SetPathValue("shortcut", "payroll")
+	w = httptest.NewRecorder()
+	s.handleDetail(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("detail page status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestGroupOnlyLinks(t *testing.T) {
+	s := newTestServer(t,
+		Link{Shortcut: "revenue", URL: "https://bi.example.com/revenue", VisibleTo: []string{"Finance"}, Owner: "dana@example.com"},
+		Link{Shortcut: "wiki", URL: "https://wiki.example.com/"},
+	)
+	s.userHeader = "X-User"
+	s.proxies = httptestProxy
+	s.groupsHeader = "X-Groups"
+	s.admins = NewAdminAuth("root@example.com", "")
+
+	follow := func(user, groups string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/revenue", nil)
+		if user != "" {
+			r.Header.Set("X-User", user)
+		}
+		if groups != "" {
+			r.Header.Set("X-Groups", groups)
+		}
+		w := httptest.NewRecorder()
+		s.handleHome(w, r)
+		return w
+	}
+
+	tests := []struct {
+		user, groups string
+		want         int
+	}{
+		{"", "", http.StatusForbidden},
+		{"carol@example.com", "Engineering", http.StatusForbidden},
+		{"erin@example.com", "Engineering, finance", http.StatusFound},
+		{"dana@example.com", "", http.StatusFound},
+		{"root@example.com", "", http.StatusFound},
+	}
+	for _, tc := range tests {
+		w := follow(tc.user, tc.groups)
+		if w.Code != tc.want {
+			t.Errorf("%q in %q: status %d, want %d", tc.user, tc.groups, w.Code, tc.want)
+		}
+		if w.Code == http.StatusFound && w.Header().Get("Cache-Control") != "private, no-store" {
+			t.Errorf("%q: Cache-Control = %q, want private, no-store", tc.user, w.Header().Get("Cache-Control"))
+		}
+	}
+	if w := follow("", ""); strings.Contains(w.Body.String(), "bi.example.com") {
+		t.Error("403 page gives away the destination")
+	}
+
+	// Group-only links aren't listed for outsiders either
+	w := httptest.NewRecorder()
+	s.handleHome(w, httptest.NewRequest("GET", "/", nil))
+	if strings.Contains(w.Body.String(), "revenue") || !strings.Contains(w.Body.String(), "wiki") {
+		t.Error("homepage lists a group-only link to an outsider")
+	}
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-User", "erin@example.com")
+	r.Header.Set("X-Groups", "Finance")
+	w = httptest.NewRecorder()
+	s.handleHome(w, r)
+	if !strings.Contains(w.Body.String(), "revenue") {
+		t.Error("homepage hides a group-only link from a member")
+	}
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Each webhook queues up to webhookQueueSize events; more are dropped
+// rather than slowing changes down while an endpoint is failing
+const webhookQueueSize = 100
+
+// maxWebhookRetries caps how often a delivery is retried
+const maxWebhookRetries = 10
+
+// maxRetryAfter caps how long a Retry-After header can hold deliveries up
+const maxRetryAfter = time.Minute
+
+// webhookEvents are the changes webhooks can be sent for
+var webhookEvents = []string{auditCreate, auditUpdate, auditDelete, auditMove, auditReload, auditArchive, auditRestore}
+
+// WebhookConfig is an outbound webhook, as configured in the webhooks file
+type WebhookConfig struct {
+	Name        string            `yaml:"name"`
+	URL         string            `yaml:"url"`
+	Method      string            `yaml:"method"`       // POST by default
+	Events      []string          `yaml:"events"`       // every change by default
+	Namespaces  []string          `yaml:"namespaces"`   // every namespace by default
+	Headers     map[string]string `yaml:"headers"`      // templates, like the body
+	ContentType string            `yaml:"content_type"` // application/json by default
+	Body        string            `yaml:"body"`         // a template; the event as JSON by default
+	Retries     *int              `yaml:"retries"`      // 3 by default
+	Restricted  bool              `yaml:"restricted"`   // also send changes to group-only links
+}
+
+// WebhookEvent is a change as given to webhook templates, and sent as JSON
+// when a webhook has no body template
+type WebhookEvent struct {
+	Event       string    `json:"event"`
+	Time        time.Time `json:"time"`
+	Actor       string    `json:"actor,omitempty"`
+	Namespace   string    `json:"namespace,omitempty"`
+	Shortcut    string    `json:"shortcut,omitempty"`
+	Name        string    `json:"name,omitempty"`    // e.g. go/gh
+	Address     string    `json:"address,omitempty"` // e.g. http://go/gh
+	URL         string    `json:"url,omitempty"`
+	OldURL      string    `json:"old_url,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Owner       string    `json:"owner,omitempty"`
+	Link        *Link     `json:"link,omitempty"`
+	Old         *Link     `json:"old,omitempty"`
+}
+
+// Webhooks sends changes to the links to outbound webhooks configured in a
+// file, such as Zapier catch hooks, Jira automation or internal services.
+// Requests are built from templates, so each can be shaped as the receiver
+// expects, and failed ones are retried with backoff.
+type Webhooks struct {
+	hooks []*webhook
+}
+
+// webhook is one configured webhook and the queue of events for it
+type webhook struct {
+	WebhookConfig
+	body    *template.Template
+	headers map[string]*template.Template
+	backoff time.Duration // before the first retry, doubling after each
+	client  *http.Client
+	queue   chan WebhookEvent
+}
+
+// webhookFuncs are the functions webhook templates can use besides the
+// built-in ones
+var webhookFuncs = template.FuncMap{
+	// json writes a value as JSON, such as a quoted and escaped string
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	// env reads an environment variable, for secrets kept out of the file
+	"env": os.Getenv,
+}
+
+// NewWebhooks reads the webhooks from a YAML or JSON file and starts
+// sending to them, or returns nil when no file is configured
+func NewWebhooks(path string) (*Webhooks, error) {
+	if path = strings.TrimSpace(path); path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var configs []WebhookConfig
+	if err := yaml.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(configs) == 0 {
+		return nil, fmt.Errorf("%s: no webhooks", path)
+	}
+
+	wh := &Webhooks{}
+	for i, config := range configs {
+		hook, err := newWebhook(config)
+		if err != nil {
+			return nil, fmt.Errorf("%s: webhook %s: %w", path, cmp.Or(config.Name, strconv.Itoa(i+1)), err)
+		}
+		wh.hooks = append(wh.hooks, hook)
+	}
+	for _, hook := range wh.hooks {
+		go hook.run()
+	}
+	return wh, nil
+}
+
+// newWebhook checks a webhook's configuration and parses its templates
+func newWebhook(config WebhookConfig) (*webhook, error) {
+	if u, err := url.Parse(config.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("url %q must be an http or https URL", config.URL)
+	}
+	config.Name = cmp.Or(config.Name, config.URL)
+	config.Method = strings.ToUpper(cmp.Or(config.Method, http.MethodPost))
+	config.ContentType = cmp.Or(config.ContentType, "application/json")
+	for _, event := range config.Events {
+		if !slices.Contains(webhookEvents, event) {
+			return nil, fmt.Errorf("unknown event %q, want %s", event, strings.Join(webhookEvents, ", "))
+		}
+	}
+	if config.Retries == nil {
+		retries := 3
+		config.Retries = &retries
+	}
+	if *config.Retries < 0 || *config.Retries > maxWebhookRetries {
+		return nil, fmt.Errorf("retries must be between 0 and %d", maxWebhookRetries)
+	}
+
+	hook := &webhook{
+		WebhookConfig: config,
+		headers:       make(map[string]*template.Template),
+		backoff:       time.Second,
+		client:        &http.Client{Timeout: 10 * time.Second},
+		queue:         make(chan WebhookEvent, webhookQueueSize),
+	}
+	var err error
+	if config.Body != "" {
+		if hook.body, err = template.New("body").Funcs(webhookFuncs).Parse(config.Body); err != nil {
+			return nil, err
+		}
+	}
+	for name, value := range config.Headers {
+		if hook.headers[name], err = template.New(name).Funcs(webhookFuncs).Parse(value); err != nil {
+			return nil, err
+		}
+	}
+	return hook, nil
+}
+
+// Send queues the changes in entries for each webhook that wants them.
+// Deliveries happen in the background, in order for each webhook.
+func (wh *Webhooks) Send(hosts *HostMap, entries []AuditEntry) {
+	for _, entry := range entries {
+		event := webhookEvent(hosts, entry)
+		for _, hook := range wh.hooks {
+			if !hook.wants(event) {
+				continue
+			}
+			select {
+			case hook.queue <- event:
+			default:
+				log.Printf("Warning: Dropped %s event for webhook %s, too many are waiting", event.Event, hook.Name)
+			}
+		}
+	}
+}
+
+// webhookEvent describes an audited change for webhooks
+func webhookEvent(hosts *HostMap, entry AuditEntry) WebhookEvent {
+	event := WebhookEvent{
+		Event:     entry.Action,
+		Time:      entry.Time,
+		Actor:     entry.Actor,
+		Namespace: entry.Namespace,
+		Shortcut:  entry.Shortcut,
+		Link:      entry.New,
+		Old:       entry.Old,
+	}
+	if entry.Shortcut != "" {
+		event.Name = hosts.PrefixFor(entry.Namespace) + "/" + entry.Shortcut
+		event.Address = "http://" + event.Name
+	}
+	if entry.Old != nil {
+		event.OldURL = entry.Old.URL
+	}
+	if link := cmp.Or(entry.New, entry.Old); link != nil {
+		event.URL, event.Description, event.Owner = link.URL, link.Description, link.Owner
+	}
+	return event
+}
+
+// wants reports whether the webhook is sent the event
+func (hook *webhook) wants(event WebhookEvent) bool {
+	if len(hook.Events) > 0 && !slices.Contains(hook.Events, event.Event) {
+		return false
+	}
+	if len(hook.Namespaces) > 0 && !slices.Contains(hook.Namespaces, cmp.Or(event.Namespace, "default")) {
+		return false
+	}
+	if !hook.Restricted {
+		for _, link := range []*Link{event.Link, event.Old} {
+			if link != nil && len(link.VisibleTo) > 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// run delivers queued events one at a time
+func (hook *webhook) run() {
+	for event := range hook.queue {
+		if err := hook.deliver(event); err != nil {
+			log.Printf("Warning: Could not send %s of %s to webhook %s: %v", event.Event, event.Name, hook.Name, err)
+		}
+	}
+}
+
+// deliver sends an event, retrying after network errors, 5xx responses and
+// 429 Too Many Requests. The wait doubles after each attempt, unless the
+// endpoint asks for a particular wait with Retry-After.
+func (hook *webhook) deliver(event WebhookEvent) error {
+	req, err := hook.request(event)
+	if err != nil {
+		return err
+	}
+	wait := hook.backoff
+	for attempt := 0; ; attempt++ {
+		retryAfter, err := hook.send(req)
+		if err == nil || attempt >= *hook.Retries || errors.Is(err, errWebhookRefused) {
+			return err
+		}
+		if retryAfter > 0 {
+			wait = min(retryAfter, maxRetryAfter)
+		}
+		time.Sleep(wait)
+		wait *= 2
+	}
+}
+
+// errWebhookRefused is a response that retrying won't change, such as 400
+// Bad Request
+var errWebhookRefused = errors.New("refused")
+
+// webhookRequest is a rendered request, sent again on each retry
+type webhookRequest struct {
+	header http.Header
+	body   []byte
+}
+
+// request renders the event into the webhook's headers and body
+func (hook *webhook) request(event WebhookEvent) (webhookRequest, error) {
+	req := webhookRequest{header: make(http.Header)}
+	req.header.Set("Content-Type", hook.ContentType)
+	req.header.Set("User-Agent", "go-links")
+	for name, tmpl := range hook.headers {
+		var value strings.Builder
+		if err := tmpl.Execute(&value, event); err != nil {
+			return req, err
+		}
+		req.header.Set(name, strings.TrimSpace(value.String()))
+	}
+
+	if hook.body == nil {
+		body, err := json.Marshal(event)
+		req.body = body
+		return req, err
+	}
+	var body bytes.Buffer
+	if err := hook.body.Execute(&body, event); err != nil {
+		return req, err
+	}
+	req.body = body.Bytes()
+	return req, nil
+}
+
+// send makes one attempt at a request, returning how long the endpoint
+// asked to wait before trying again, if it did
+func (hook *webhook) send(request webhookRequest) (time.Duration, error) {
+	req, err := http.NewRequest(hook.Method, hook.URL, bytes.NewReader(request.body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header = request.header.Clone()
+	resp, err := hook.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 300 {
+		return 0, nil
+	}
+
+	var retryAfter time.Duration
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		retryAfter = time.Duration(seconds) * time.Second
+	}
+	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+		return retryAfter, fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return 0, fmt.Errorf("webhook %w it with %s", errWebhookRefused, resp.Status)
+}
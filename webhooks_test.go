@@ -0,0 +1,138 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeWebhooks writes a webhooks file and loads it, with retries sped up
+func writeWebhooks(t *testing.T, config string) *Webhooks {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "webhooks.yaml")
+	if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	wh, err := NewWebhooks(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, hook := range wh.hooks {
+		hook.backoff = time.Millisecond
+	}
+	return wh
+}
+
+func TestWebhooks(t *testing.T) {
+	type delivery struct {
+		method, path, contentType, auth, body string
+	}
+	deliveries := make(chan delivery, 10)
+	attempts := 0
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.URL.Path == "/flaky" {
+			if attempts++; attempts < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+		}
+		deliveries <- delivery{r.Method, r.URL.Path, r.Header.Get("Content-Type"), r.Header.Get("Authorization"), string(body)}
+	}))
+	defer endpoint.Close()
+	t.Setenv("TEST_WEBHOOK_TOKEN", "s3cret")
+
+	wh := writeWebhooks(t, `
+- name: jira
+  url: `+endpoint.URL+`/jira
+  events: [create]
+  headers:
+    Authorization: Bearer {{env "TEST_WEBHOOK_TOKEN"}}
+  body: |
+    {"summary": {{json (printf "New link %s" .Name)}}, "url": {{json .URL}}, "by": {{json .Actor}}}
+- name: flaky
+  url: `+endpoint.URL+`/flaky
+  method: put
+  namespaces: [wiki]
+  content_type: text/plain
+  body: "{{.Event}} {{.Name}}: {{.OldURL}} -> {{.URL}}"
+`)
+	hosts, _ := NewHostMap("go=,wiki")
+	gh := Link{Shortcut: "gh", URL: "https://github.com/\"org\""}
+	wh.Send(hosts, []AuditEntry{
+		{Action: auditCreate, Actor: "alice", Shortcut: "gh", New: &gh},
+		{Action: auditCreate, Shortcut: "pay", New: &Link{Shortcut: "pay", VisibleTo: []string{"finance"}}},
+		{Action: auditUpdate, Namespace: "wiki", Shortcut: "docs", Old: &Link{URL: "https://old.example.com"}, New: &Link{URL: "https://new.example.com"}},
+	})
+
+	want := map[string]delivery{
+		"/jira":  {"POST", "/jira", "application/json", "Bearer s3cret", `{"summary": "New link go/gh", "url": "https://github.com/\"org\"", "by": "alice"}` + "\n"},
+		"/flaky": {"PUT", "/flaky", "text/plain", "", "update wiki/docs: https://old.example.com -> https://new.example.com"},
+	}
+	for range want {
+		select {
+		case got := <-deliveries:
+			if got != want[got.path] {
+				t.Errorf("delivery = %+v, want %+v", got, want[got.path])
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("webhook not sent")
+		}
+	}
+	if attempts != 3 {
+		t.Errorf("flaky webhook tried %d times, want 3", attempts)
+	}
+	select {
+	case got := <-deliveries:
+		t.Errorf("unexpected delivery %+v, group-only links aren't sent by default", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestWebhookDefaultsAndRefusals(t *testing.T) {
+	requests := 0
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.Error(w, "bad", http.StatusBadRequest)
+	}))
+	defer endpoint.Close()
+
+	wh := writeWebhooks(t, `[{"url": "`+endpoint.URL+`"}]`)
+	hook := wh.hooks[0]
+	hosts, _ := NewHostMap("")
+	event := webhookEvent(hosts, AuditEntry{Action: auditDelete, Shortcut: "gh", Old: &Link{Shortcut: "gh", URL: "https://github.com"}})
+	req, err := hook.request(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body := string(req.body); !strings.Contains(body, `"event":"delete"`) || !strings.Contains(body, `"address":"http://go/gh"`) || !strings.Contains(body, `"url":"https://github.com"`) {
+		t.Errorf("default body = %s", body)
+	}
+	if err := hook.deliver(event); err == nil || requests != 1 {
+		t.Errorf("400 response: error %v after %d requests, want no retries", err, requests)
+	}
+}
+
+func TestWebhookConfig(t *testing.T) {
+	for _, config := range []string{
+		`[{"url": "ftp://example.com"}]`,
+		`[{"url": "https://example.com", "events": ["clicked"]}]`,
+		`[{"url": "https://example.com", "retries": 99}]`,
+		`[{"url": "https://example.com", "body": "{{.Missing"}]`,
+		`[]`,
+	} {
+		path := filepath.Join(t.TempDir(), "webhooks.json")
+		os.WriteFile(path, []byte(config), 0644)
+		if _, err := NewWebhooks(path); err == nil {
+			t.Errorf("%s was accepted", config)
+		}
+	}
+	if wh, err := NewWebhooks(""); wh != nil || err != nil {
+		t.Errorf("without a file: %v, %v", wh, err)
+	}
+}
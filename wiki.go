@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// notionAPI is where Notion's API is, unless another URL is configured
+const notionAPI = "https://api.notion.com/v1"
+
+// notionBatch is how many blocks Notion takes in one request
+const notionBatch = 100
+
+// WikiConfig configures publishing the link directory to a wiki page
+type WikiConfig struct {
+	Kind     string // confluence or notion
+	URL      string // Confluence's base URL, e.g. https://example.atlassian.net/wiki
+	Page     string // the ID of the page to replace
+	User     string // Confluence user to sign in as with Token, for Confluence Cloud
+	Token    string // Confluence API token or personal access token, or Notion integration token
+	Interval string // how often to publish, hourly by default
+}
+
+// WikiPublisher keeps a Confluence or Notion page listing every public
+// link, for teams whose documentation lives in the wiki. The page is
+// replaced each time, so it should be one kept for the purpose.
+type WikiPublisher struct {
+	kind      string
+	url       string
+	page      string
+	user      string
+	token     string
+	interval  time.Duration
+	client    *http.Client
+	published [sha256.Size]byte // what was last published, to skip unchanged directories
+}
+
+// NewWikiPublisher creates the publisher from its configuration, or
+// returns nil when no wiki is configured
+func NewWikiPublisher(config WikiConfig) (*WikiPublisher, error) {
+	kind := strings.ToLower(strings.TrimSpace(config.Kind))
+	if kind == "" {
+		return nil, nil
+	}
+	wp := &WikiPublisher{
+		kind:     kind,
+		url:      strings.TrimSuffix(strings.TrimSpace(config.URL), "/"),
+		page:     strings.TrimSpace(config.Page),
+		user:     config.User,
+		token:    config.Token,
+		interval: time.Hour,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}
+	switch kind {
+	case "confluence":
+		if wp.url == "" {
+			return nil, errors.New("Confluence needs its URL, such as https://example.atlassian.net/wiki")
+		}
+	case "notion":
+		wp.url = cmp.Or(wp.url, notionAPI)
+	default:
+		return nil, fmt.Errorf("unknown wiki %q, want confluence or notion", config.Kind)
+	}
+	if u, err := url.Parse(wp.url); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("wiki URL %q must be an http or https URL", wp.url)
+	}
+	if wp.page == "" {
+		return nil, errors.New("the ID of the page to publish to is required")
+	}
+	if wp.token == "" {
+		return nil, errors.New("an API token is required")
+	}
+	if config.Interval != "" {
+		d, err := time.ParseDuration(config.Interval)
+		if err != nil || d < time.Minute {
+			return nil, fmt.Errorf("%q isn't an interval of a minute or more", config.Interval)
+		}
+		wp.interval = d
+	}
+	return wp, nil
+}
+
+// wikiEntry is a link as listed on the wiki page
+type wikiEntry struct {
+	Name        string // e.g. go/gh
+	Address     string // e.g. http://go/gh
+	URL         string
+	Description string
+	Owner       string
+}
+
+// wikiDirectory lists the links anyone may see and follow, by namespace
+// and shortcut. Hidden, archived, blocked and group-only links are left
+// out, since the page can be read by everyone with access to the wiki.
+func (s *Server) wikiDirectory() []wikiEntry {
+	links := s.store.All()
+	slices.SortFunc(links, func(a, b Link) int {
+		return cmp.Or(cmp.Compare(a.Namespace, b.Namespace), cmp.Compare(a.Shortcut, b.Shortcut))
+	})
+	var entries []wikiEntry
+	for _, link := range links {
+		if link.Hidden || len(link.VisibleTo) > 0 || !link.ArchivedAt.IsZero() || s.blocklist.Blocked(link.Shortcut) {
+			continue
+		}
+		name := s.hosts.PrefixFor(link.Namespace) + "/" + link.Shortcut
+		entries = append(entries, wikiEntry{
+			Name:        name,
+			Address:     "http://" + name,
+			URL:         link.URL,
+			Description: link.Description,
+			Owner:       cmp.Or(link.Owner, link.CreatedBy),
+		})
+	}
+	return entries
+}
+
+// Job returns the background job publishing the directory at the
+// configured interval, starting straight away
+func (wp *WikiPublisher) Job(s *Server) Job {
+	return Job{Name: "publish_wiki", Every: wp.interval, RunAtStart: true, LeaderOnly: true, Run: func() error {
+		return wp.Publish(s.wikiDirectory())
+	}}
+}
+
+// Publish replaces the wiki page with entries, unless they're what was
+// last published
+func (wp *WikiPublisher) Publish(entries []wikiEntry) error {
+	data, _ := json.Marshal(entries)
+	sum := sha256.Sum256(data)
+	if sum == wp.published {
+		return nil
+	}
+	var err error
+	if wp.kind == "confluence" {
+		err = wp.publishConfluence(entries)
+	} else {
+		err = wp.publishNotion(entries)
+	}
+	if err != nil {
+		return err
+	}
+	wp.published = sum
+	log.Printf("Published %d links to %s page %s", len(entries), wp.kind, wp.page)
+	return nil
+}
+
+// confluenceTable renders entries as a table in Confluence's storage
+// format
+func confluenceTable(entries []wikiEntry) string {
+	var b strings.Builder
+	b.WriteString("<p>Every go link, kept up to date by go-links. Changes made here are overwritten.</p>")
+	b.WriteString("<table><tbody><tr><th>Link</th><th>Goes to</th><th>Description</th><th>Owner</th></tr>")
+	for _, entry := range entries {
+		fmt.Fprintf(&b, `<tr><td><a href="%s">%s</a></td><td><a href="%s">%s</a></td><td>%s</td><td>%s</td></tr>`,
+			html.EscapeString(entry.Address), html.EscapeString(entry.Name),
+			html.EscapeString(entry.URL), html.EscapeString(entry.URL),
+			html.EscapeString(entry.Description), html.EscapeString(entry.Owner))
+	}
+	b.WriteString("</tbody></table>")
+	return b.String()
+}
+
+// publishConfluence replaces the page's body, as the next version of it
+func (wp *WikiPublisher) publishConfluence(entries []wikiEntry) error {
+	var page struct {
+		Title   string `json:"title"`
+		Version struct {
+			Number int `json:"number"`
+		} `json:"version"`
+	}
+	content := wp.url + "/rest/api/content/" + url.PathEscape(wp.page)
+	if err := wp.call("GET", content+"?expand=version", nil, &page); err != nil {
+		return err
+	}
+
+	update := map[string]any{
+		"id":      wp.page,
+		"type":    "page",
+		"title":   page.Title,
+		"version": map[string]any{"number": page.Version.Number + 1, "message": "Updated by go-links"},
+		"body": map[string]any{"storage": map[string]string{
+			"value":          confluenceTable(entries),
+			"representation": "storage",
+		}},
+	}
+	return wp.call("PUT", content, update, nil)
+}
+
+// notionBlocks renders entries as Notion blocks: a bulleted list, each
+// shortcut linking to its destination
+func notionBlocks(entries []wikiEntry) []map[string]any {
+	text := func(content, link string, bold bool) map[string]any {
+		t := map[string]any{"content": content}
+		if link != "" {
+			t["link"] = map[string]string{"url": link}
+		}
+		return map[string]any{"type": "text", "text": t, "annotations": map[string]bool{"bold": bold}}
+	}
+	blocks := []map[string]any{{
+		"type":      "paragraph",
+		"paragraph": map[string]any{"rich_text": []any{text("Every go link, kept up to date by go-links. Changes made here are overwritten.", "", false)}},
+	}}
+	for _, entry := range entries {
+		richText := []any{text(entry.Name, entry.URL, true)}
+		if entry.Description != "" {
+			richText = append(richText, text(" — "+entry.Description, "", false))
+		}
+		if entry.Owner != "" {
+			richText = append(richText, text(" ("+entry.Owner+")", "", false))
+		}
+		blocks = append(blocks, map[string]any{
+			"type":               "bulleted_list_item",
+			"bulleted_list_item": map[string]any{"rich_text": richText},
+		})
+	}
+	return blocks
+}
+
+// publishNotion replaces the page's blocks: Notion can't replace a page's
+// content in one go, so its blocks are deleted and the new ones appended
+func (wp *WikiPublisher) publishNotion(entries []wikiEntry) error {
+	children := wp.url + "/blocks/" + url.PathEscape(wp.page) + "/children"
+	var old []string
+	for cursor := ""; ; {
+		var list struct {
+			Results []struct {
+				ID string `json:"id"`
+			} `json:"results"`
+			HasMore    bool   `json:"has_more"`
+			NextCursor string `json:"next_cursor"`
+		}
+		target := children + "?page_size=100"
+		if cursor != "" {
+			target += "&start_cursor=" + url.QueryEscape(cursor)
+		}
+		if err := wp.call("GET", target, nil, &list); err != nil {
+			return err
+		}
+		for _, block := range list.Results {
+			old = append(old, block.ID)
+		}
+		if !list.HasMore {
+			break
+		}
+		cursor = list.NextCursor
+	}
+	for _, id := range old {
+		if err := wp.call("DELETE", wp.url+"/blocks/"+url.PathEscape(id), nil, nil); err != nil {
+			return err
+		}
+	}
+
+	for batch := range slices.Chunk(notionBlocks(entries), notionBatch) {
+		if err := wp.call("PATCH", children, map[string]any{"children": batch}, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// call makes a request to the wiki's API, sending body and decoding the
+// response into result as JSON when they're given
+func (wp *WikiPublisher) call(method, target string, body, result any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, target, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	switch {
+	case wp.kind == "notion":
+		req.Header.Set("Authorization", "Bearer "+wp.token)
+		req.Header.Set("Notion-Version", "2022-06-28")
+	case wp.user != "":
+		req.SetBasicAuth(wp.user, wp.token)
+	default:
+		req.Header.Set("Authorization", "Bearer "+wp.token)
+	}
+
+	resp, err := wp.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s %s: %s: %s", method, target, resp.Status, bytes.TrimSpace(message))
+	}
+	if result != nil {
+		return json.NewDecoder(resp.Body).Decode(result)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWikiDirectory(t *testing.T) {
+	s := newTestServer(t,
+		Link{Shortcut: "gh", URL: "https://github.com", Description: "GitHub", Owner: "alice"},
+		Link{Shortcut: "secret", URL: "https://secret.example.com", Hidden: true},
+		Link{Shortcut: "pay", URL: "https://pay.example.com", VisibleTo: []string{"finance"}},
+		Link{Namespace: "wiki", Shortcut: "onboarding", URL: "https://wiki.example.com", CreatedBy: "bob"},
+	)
+	s.hosts, _ = NewHostMap("wiki")
+	entries := s.wikiDirectory()
+	if len(entries) != 2 || entries[0] != (wikiEntry{"go/gh", "http://go/gh", "https://github.com", "GitHub", "alice"}) ||
+		entries[1].Name != "wiki/onboarding" || entries[1].Owner != "bob" {
+		t.Errorf("directory = %+v", entries)
+	}
+}
+
+func TestPublishConfluence(t *testing.T) {
+	var update map[string]any
+	confluence := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, token, _ := r.BasicAuth(); user != "bot@example.com" || token != "api-token" || r.URL.Path != "/wiki/rest/api/content/123" {
+			http.Error(w, "no", http.StatusUnauthorized)
+			return
+		}
+		switch r.Method {
+		case "GET":
+			w.Write([]byte(`{"title": "Go links", "version": {"number": 7}}`))
+		case "PUT":
+			json.NewDecoder(r.Body).Decode(&update)
+		}
+	}))
+	defer confluence.Close()
+
+	wp, err := NewWikiPublisher(WikiConfig{Kind: "confluence", URL: confluence.URL + "/wiki", Page: "123", User: "bot@example.com", Token: "api-token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := []wikiEntry{{Name: "go/gh", Address: "http://go/gh", URL: "https://github.com", Description: "<b>code</b>"}}
+	if err := wp.Publish(entries); err != nil {
+		t.Fatal(err)
+	}
+	body, _ := json.Marshal(update)
+	if !strings.Contains(string(body), `"number":8`) || !strings.Contains(string(body), `"title":"Go links"`) ||
+		!strings.Contains(update["body"].(map[string]any)["storage"].(map[string]any)["value"].(string), `<td>&lt;b&gt;code&lt;/b&gt;</td>`) {
+		t.Errorf("update = %s", body)
+	}
+
+	// The same directory isn't published again
+	update = nil
+	if err := wp.Publish(entries); err != nil || update != nil {
+		t.Errorf("republished an unchanged directory: %v", err)
+	}
+}
+
+func TestPublishNotion(t *testing.T) {
+	var deleted []string
+	var appended int
+	notion := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret_x" || r.Header.Get("Notion-Version") == "" {
+			http.Error(w, "no", http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.Method == "GET" && r.URL.Query().Get("start_cursor") == "":
+			w.Write([]byte(`{"results": [{"id": "a"}], "has_more": true, "next_cursor": "c1"}`))
+		case r.Method == "GET":
+			w.Write([]byte(`{"results": [{"id": "b"}], "has_more": false}`))
+		case r.Method == "DELETE":
+			deleted = append(deleted, strings.TrimPrefix(r.URL.Path, "/blocks/"))
+		case r.Method == "PATCH" && r.URL.Path == "/blocks/page/children":
+			var batch struct{ Children []any }
+			json.NewDecoder(r.Body).Decode(&batch)
+			appended += len(batch.Children)
+		}
+	}))
+	defer notion.Close()
+
+	wp, err := NewWikiPublisher(WikiConfig{Kind: "notion", URL: notion.URL, Page: "page", Token: "secret_x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := make([]wikiEntry, 150)
+	for i := range entries {
+		entries[i] = wikiEntry{Name: "go/x", URL: "https://example.com"}
+	}
+	if err := wp.Publish(entries); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(deleted, ",") != "a,b" || appended != 151 {
+		t.Errorf("deleted %v and appended %d blocks, want a,b and 151", deleted, appended)
+	}
+}
+
+func TestNewWikiPublisher(t *testing.T) {
+	for _, bad := range []WikiConfig{
+		{Kind: "mediawiki", Page: "1", Token: "t"},
+		{Kind: "confluence", Page: "1", Token: "t"},
+		{Kind: "notion", Token: "t"},
+		{Kind: "notion", Page: "1"},
+		{Kind: "notion", Page: "1", Token: "t", Interval: "5s"},
+	} {
+		if _, err := NewWikiPublisher(bad); err == nil {
+			t.Errorf("NewWikiPublisher(%+v) succeeded", bad)
+		}
+	}
+	if wp, err := NewWikiPublisher(WikiConfig{}); wp != nil || err != nil {
+		t.Errorf("NewWikiPublisher when off = %v, %v; want nil, nil", wp, err)
+	}
+}
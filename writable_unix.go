@@ -0,0 +1,11 @@
+//go:build unix
+
+package main
+
+import "golang.org/x/sys/unix"
+
+// canWrite reports whether this process may create files in the directory
+// dir, read-only mounts included, without creating any
+func canWrite(dir string) error {
+	return unix.Access(dir, unix.W_OK)
+}